@@ -0,0 +1,110 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func testVersioned() Versioned {
+	v := Versioned{
+		Name:  "thing",
+		Rev:   3,
+		Tags:  []string{"a", "b"},
+		Attrs: map[string]string{"k": "v"},
+	}
+	v.Inner.On = true
+	v.Inner.X = 1.5
+	return v
+}
+
+// acceptBothForms returns the map and
+// the tuple encodings of the same value
+func acceptBothForms(t *testing.T) (asMap, asTuple []byte) {
+	v := testVersioned()
+	asMap, err := v.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := msgp.NextType(asMap); typ != msgp.MapType {
+		t.Fatalf("Versioned is written as %s", typ)
+	}
+	tv := VersionedTuple(v)
+	asTuple, err = tv.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := msgp.NextType(asTuple); typ != msgp.ArrayType {
+		t.Fatalf("VersionedTuple is written as %s", typ)
+	}
+	return asMap, asTuple
+}
+
+func TestAcceptBothUnmarshal(t *testing.T) {
+	asMap, asTuple := acceptBothForms(t)
+	want := testVersioned()
+	for name, bts := range map[string][]byte{"map": asMap, "tuple": asTuple} {
+		var v Versioned
+		left, err := v.UnmarshalMsg(bts)
+		if err != nil {
+			t.Errorf("Versioned from the %s form: %s", name, err)
+		} else if len(left) != 0 {
+			t.Errorf("Versioned from the %s form: %d bytes left over", name, len(left))
+		} else if !reflect.DeepEqual(v, want) {
+			t.Errorf("Versioned from the %s form: got %+v; want %+v", name, v, want)
+		}
+
+		var tv VersionedTuple
+		left, err = tv.UnmarshalMsg(bts)
+		if err != nil {
+			t.Errorf("VersionedTuple from the %s form: %s", name, err)
+		} else if len(left) != 0 {
+			t.Errorf("VersionedTuple from the %s form: %d bytes left over", name, len(left))
+		} else if !reflect.DeepEqual(Versioned(tv), want) {
+			t.Errorf("VersionedTuple from the %s form: got %+v; want %+v", name, tv, want)
+		}
+	}
+}
+
+func TestAcceptBothDecode(t *testing.T) {
+	asMap, asTuple := acceptBothForms(t)
+	want := testVersioned()
+	for name, bts := range map[string][]byte{"map": asMap, "tuple": asTuple} {
+		var v Versioned
+		if err := msgp.Decode(bytes.NewReader(bts), &v); err != nil {
+			t.Errorf("Versioned from the %s form: %s", name, err)
+		} else if !reflect.DeepEqual(v, want) {
+			t.Errorf("Versioned from the %s form: got %+v; want %+v", name, v, want)
+		}
+
+		var tv VersionedTuple
+		if err := msgp.Decode(bytes.NewReader(bts), &tv); err != nil {
+			t.Errorf("VersionedTuple from the %s form: %s", name, err)
+		} else if !reflect.DeepEqual(Versioned(tv), want) {
+			t.Errorf("VersionedTuple from the %s form: got %+v; want %+v", name, tv, want)
+		}
+	}
+}
+
+func TestAcceptBothInvalid(t *testing.T) {
+	// the tuple form still has to have
+	// every field, in order
+	short := msgp.AppendArrayHeader(nil, 2)
+	short = msgp.AppendString(short, "thing")
+	short = msgp.AppendInt(short, 3)
+
+	// and anything else is an error
+	// from reading the map header
+	str := msgp.AppendString(nil, "thing")
+
+	for name, bts := range map[string][]byte{"short tuple": short, "string": str, "empty": nil} {
+		var v Versioned
+		if _, err := v.UnmarshalMsg(bts); err == nil {
+			t.Errorf("UnmarshalMsg: no error from the %s", name)
+		}
+		if err := msgp.Decode(bytes.NewReader(bts), &v); err == nil {
+			t.Errorf("DecodeMsg: no error from the %s", name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// invert is a reversible transform
+// that works in place, which UnmarshalMsg
+// mustn't do to the buffer it's reading
+func invert(b []byte) ([]byte, error) {
+	for i := range b {
+		b[i] = ^b[i]
+	}
+	return b, nil
+}
+
+func init() {
+	msgp.RegisterTransform("inplace", invert, invert)
+}
+
+type marshalUnmarshaler interface {
+	msgp.Marshaler
+	msgp.Unmarshaler
+}
+
+// aliasFixtures returns a value of each
+// of the struct types in def.go
+func aliasFixtures() []marshalUnmarshaler {
+	return []marshalUnmarshaler{
+		new(TestType), new(TestBench), new(TestFast), new(TestHidden),
+		new(Embedded), new(Things), new(Custom), new(PII),
+		new(NilContainers), new(Coerced), new(ByteHolder), new(Flags),
+		new(MixedFlags), new(TupleFlags), new(AnonContainers), new(Converted),
+		new(Account), new(AccountWire), new(Accounts), new(BoundedMaps),
+		new(Nested), new(ImportedShims), new(Versioned), new(VersionedTuple),
+		new(Deprecated), new(InPlace), new(IntKeyed), new(Headers),
+		new(Tables), new(Entries), new(Directory), new(Routed),
+		new(EventList), new(Matrix), new(Blob), new(Journal),
+	}
+}
+
+var rawExtType = reflect.TypeOf(msgp.RawExtension{})
+
+// fill sets every exported field of 'v' that can be
+// encoded to a non-zero value: containers get two
+// elements, and pointers are followed a few levels
+func fill(v reflect.Value, depth int) {
+	switch v.Kind() {
+	case reflect.Struct:
+		switch v.Type() {
+		case reflect.TypeOf(time.Time{}):
+			v.Set(reflect.ValueOf(time.Unix(1500000000, 12345).UTC()))
+			return
+		case rawExtType:
+			// the type has to match the one
+			// that the field is decoded as
+			v.FieldByName("Data").SetBytes([]byte("extension data"))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fill(v.Field(i), depth)
+			}
+		}
+	case reflect.Ptr:
+		if depth < 3 {
+			v.Set(reflect.New(v.Type().Elem()))
+			fill(v.Elem(), depth+1)
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte("some bytes"))
+			return
+		}
+		if depth < 3 {
+			v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+			for i := 0; i < 2; i++ {
+				fill(v.Index(i), depth+1)
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), depth)
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		for i := 0; i < 2; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			switch key.Kind() {
+			case reflect.String:
+				key.SetString("key" + strconv.Itoa(i))
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				key.SetInt(int64(i))
+			default:
+				key.SetUint(uint64(i))
+			}
+			val := reflect.New(v.Type().Elem()).Elem()
+			fill(val, depth+1)
+			v.SetMapIndex(key, val)
+		}
+	case reflect.String:
+		v.SetString("a string")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1) // MyEnum(1) is B
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1.5)
+	case reflect.Complex64, reflect.Complex128:
+		v.SetComplex(complex(1, 2))
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			v.Set(reflect.ValueOf([]byte("interface bytes")))
+		}
+	}
+}
+
+// TestUnmarshalDoesNotAlias unmarshals each fixture,
+// overwrites the input, and checks that the value is
+// the same as one unmarshaled from a copy of it: the
+// generated code must copy everything it keeps, and
+// must leave its input alone, since callers reuse it
+func TestUnmarshalDoesNotAlias(t *testing.T) {
+	for _, in := range aliasFixtures() {
+		tp := reflect.TypeOf(in).Elem()
+		fill(reflect.ValueOf(in).Elem(), 0)
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Errorf("%s: %s", tp.Name(), err)
+			continue
+		}
+		orig := append([]byte(nil), bts...)
+
+		ref := reflect.New(tp).Interface().(marshalUnmarshaler)
+		if _, err := ref.UnmarshalMsg(append([]byte(nil), bts...)); err != nil {
+			t.Errorf("%s: %s", tp.Name(), err)
+			continue
+		}
+		got := reflect.New(tp).Interface().(marshalUnmarshaler)
+		if _, err := got.UnmarshalMsg(bts); err != nil {
+			t.Errorf("%s: %s", tp.Name(), err)
+			continue
+		}
+		if !bytes.Equal(bts, orig) {
+			t.Errorf("%s: UnmarshalMsg modified its input", tp.Name())
+		}
+		for i := range bts {
+			bts[i] = 0xff
+		}
+		if !reflect.DeepEqual(got, ref) {
+			t.Errorf("%s: overwriting the input changed the value:\ngot:  %+v\nwant: %+v", tp.Name(), got, ref)
+		}
+	}
+}
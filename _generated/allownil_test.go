@@ -0,0 +1,100 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func TestAllowNil(t *testing.T) {
+	cases := []NilContainers{
+		{},
+		{Slice: []string{}, NilSlice: []string{}, Map: map[string]int{}, NilMap: map[string]int{}, NilNamed: EventList{}, NilHdrs: Headers{}},
+		{
+			Slice: []string{"a"}, NilSlice: []string{"b", "c"}, Map: map[string]int{"a": 1}, NilMap: map[string]int{"b": 2},
+			NilNamed: EventList{{Kind: "k", At: 1}}, NilHdrs: Headers{"h": "v"},
+		},
+	}
+
+	for i, in := range cases {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		err = msgp.Encode(&buf, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bts, buf.Bytes()) {
+			t.Errorf("case %d: MarshalMsg and EncodeMsg disagree", i)
+		}
+
+		var out NilContainers
+		_, err = out.UnmarshalMsg(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dout NilContainers
+		err = msgp.Decode(&buf, &dout)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, got := range []NilContainers{out, dout} {
+			// allownil fields preserve nil-ness exactly
+			if (in.NilSlice == nil) != (got.NilSlice == nil) || !reflect.DeepEqual(in.NilSlice, got.NilSlice) {
+				t.Errorf("case %d: nil_slice: %#v in; %#v out", i, in.NilSlice, got.NilSlice)
+			}
+			if (in.NilMap == nil) != (got.NilMap == nil) || !reflect.DeepEqual(in.NilMap, got.NilMap) {
+				t.Errorf("case %d: nil_map: %#v in; %#v out", i, in.NilMap, got.NilMap)
+			}
+			if (in.NilNamed == nil) != (got.NilNamed == nil) || !reflect.DeepEqual(in.NilNamed, got.NilNamed) {
+				t.Errorf("case %d: nil_named: %#v in; %#v out", i, in.NilNamed, got.NilNamed)
+			}
+			if (in.NilHdrs == nil) != (got.NilHdrs == nil) || !reflect.DeepEqual(in.NilHdrs, got.NilHdrs) {
+				t.Errorf("case %d: nil_hdrs: %#v in; %#v out", i, in.NilHdrs, got.NilHdrs)
+			}
+			// other fields decode nil as empty
+			if got.Slice == nil || len(got.Slice) != len(in.Slice) {
+				t.Errorf("case %d: slice: %#v in; %#v out", i, in.Slice, got.Slice)
+			}
+			if got.Map == nil || len(got.Map) != len(in.Map) {
+				t.Errorf("case %d: map: %#v in; %#v out", i, in.Map, got.Map)
+			}
+		}
+	}
+}
+
+func TestDecodeNilContainers(t *testing.T) {
+	// fields without allownil still accept 'nil' on the wire
+	var bts []byte
+	bts = msgp.AppendMapHeader(bts, 2)
+	bts = msgp.AppendString(bts, "slice")
+	bts = msgp.AppendNil(bts)
+	bts = msgp.AppendString(bts, "map")
+	bts = msgp.AppendNil(bts)
+
+	out := NilContainers{Slice: []string{"x"}, Map: map[string]int{"x": 1}}
+	left, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("%d bytes left over", len(left))
+	}
+	if out.Slice != nil || out.Map != nil {
+		t.Errorf("expected nil slice and map; got %#v and %#v", out.Slice, out.Map)
+	}
+
+	dout := NilContainers{Slice: []string{"x"}, Map: map[string]int{"x": 1}}
+	err = msgp.Decode(bytes.NewReader(bts), &dout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dout.Slice != nil || dout.Map != nil {
+		t.Errorf("expected nil slice and map; got %#v and %#v", dout.Slice, dout.Map)
+	}
+}
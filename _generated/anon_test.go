@@ -0,0 +1,126 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func anonContainers() *AnonContainers {
+	v := &AnonContainers{}
+	v.Settings = make(map[string]struct {
+		On    bool
+		Level int
+	})
+	v.Settings["fast"] = struct {
+		On    bool
+		Level int
+	}{true, 3}
+	v.Settings["slow"] = struct {
+		On    bool
+		Level int
+	}{false, -1}
+	v.List = append(v.List, struct {
+		Name string `msg:"name"`
+		N    int    `msg:"n"`
+	}{"one", 1})
+	v.Pair[0].X, v.Pair[0].Y = 1.5, 2.5
+	v.Pair[1].X, v.Pair[1].Y = -3, 4
+	return v
+}
+
+func TestAnonContainers(t *testing.T) {
+	in := anonContainers()
+
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() is %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+	out := &AnonContainers{}
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: got %+v; want %+v", out, in)
+	}
+
+	var buf bytes.Buffer
+	if err = msgp.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out = &AnonContainers{}
+	if err = msgp.Decode(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, in)
+	}
+
+	if cp := in.Clone(); !reflect.DeepEqual(in, cp) {
+		t.Errorf("Clone: got %+v; want %+v", cp, in)
+	}
+}
+
+// anonRows fills every container, since empty
+// ones are decoded as empty, rather than nil
+func anonRows() *AnonRows {
+	type row = struct {
+		Key string
+		Val int64
+	}
+	type inner = struct{ S string }
+	type set = map[string]struct{ On bool }
+	v := &AnonRows{}
+	v.Rows = []row{{"a", 1}}
+	v.More = []row{{"b", 2}, {"c", -3}}
+	v.Ptrs = []*struct{ N int }{{N: 4}, {N: 5}}
+	v.Nested = make([]struct {
+		Inner []struct{ S string }
+		Set   map[string]struct{ On bool }
+	}, 2)
+	v.Nested[0].Inner = []inner{{"x"}, {"y"}}
+	v.Nested[0].Set = set{"on": {true}}
+	v.Nested[1].Inner = []inner{{"z"}}
+	v.Nested[1].Set = set{"off": {false}}
+	v.Groups = map[string][]struct{ X int }{"g": {{6}, {7}}}
+	return v
+}
+
+func TestAnonRows(t *testing.T) {
+	in := anonRows()
+
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > in.Msgsize() {
+		t.Errorf("Msgsize() is %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+	out := &AnonRows{}
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: got %+v; want %+v", out, in)
+	}
+
+	var buf bytes.Buffer
+	if err = msgp.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out = &AnonRows{}
+	if err = msgp.Decode(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, in)
+	}
+
+	if cp := in.Clone(); !reflect.DeepEqual(in, cp) {
+		t.Errorf("Clone: got %+v; want %+v", cp, in)
+	}
+}
@@ -0,0 +1,126 @@
+package _generated
+
+import (
+	"bytes"
+	"errors"
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+	"time"
+)
+
+// batchOf returns 'n' marshaled TestBenches
+// one after another, named by their indexes
+func batchOf(tb testing.TB, n int) []byte {
+	var bts []byte
+	for i := 0; i < n; i++ {
+		v := TestBench{Name: string(rune('a' + i%26)), Siblings: i, BirthDay: time.Unix(int64(i), 0)}
+		var err error
+		bts, err = v.MarshalMsg(bts)
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return bts
+}
+
+func TestUnmarshalBatch(t *testing.T) {
+	bts := batchOf(t, 10)
+
+	var got []int
+	left, err := UnmarshalTestBenchBatch(bts, func(v *TestBench) error {
+		got = append(got, v.Siblings)
+		return nil
+	})
+	if err != nil || len(left) > 0 || len(got) != 10 || got[9] != 9 {
+		t.Fatalf("read %v (%v), with %d bytes left", got, err, len(left))
+	}
+
+	// the value is reset before each message, so
+	// fields that one leaves out aren't the last one's
+	var first, second []byte
+	first, _ = (&Versioned{Name: "a", Rev: 1}).MarshalMsg(nil)
+	second = msgp.AppendMapHeader(nil, 1)
+	second = msgp.AppendString(second, "name")
+	second = msgp.AppendString(second, "b")
+	var revs []int
+	_, err = UnmarshalVersionedBatch(append(first, second...), func(v *Versioned) error {
+		revs = append(revs, v.Rev)
+		return nil
+	})
+	if err != nil || len(revs) != 2 || revs[1] != 0 {
+		t.Errorf("read revs %v (%v); want the second to be 0", revs, err)
+	}
+
+	// it stops at the first error from 'fn',
+	// after the message it was called with
+	stop := errors.New("stop")
+	n := 0
+	left, err = UnmarshalTestBenchBatch(bts, func(v *TestBench) error {
+		n++
+		if v.Siblings == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 4 || !bytes.Equal(left, batchOf(t, 10)[len(batchOf(t, 4)):]) {
+		t.Errorf("stopped with %v after %d, with %d bytes left", err, n, len(left))
+	}
+
+	// and at the first that doesn't decode, at its start
+	bad := append(batchOf(t, 2), msgp.AppendString(nil, "not a TestBench")...)
+	left, err = UnmarshalTestBenchBatch(bad, func(v *TestBench) error { return nil })
+	if err == nil || !bytes.Equal(left, bad[len(batchOf(t, 2)):]) {
+		t.Errorf("got error %v, with %x left", err, left)
+	}
+}
+
+// handle is what the benchmarks hand each
+// value to, as an ingest path would, which
+// the compiler can't see through
+var handle = func(*TestBench) error { return nil }
+
+// BenchmarkUnmarshalLoop is the loop that
+// UnmarshalTestBenchBatch takes the place of
+func BenchmarkUnmarshalLoop(b *testing.B) {
+	bts := batchOf(b, 1000)
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		for o := bts; len(o) > 0; {
+			v := new(TestBench)
+			o, err = v.UnmarshalMsg(o)
+			if err != nil {
+				b.Fatal(err)
+			}
+			handle(v)
+		}
+	}
+}
+
+func BenchmarkUnmarshalBatchGeneric(b *testing.B) {
+	bts := batchOf(b, 1000)
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := msgp.UnmarshalBatch(bts, func() msgp.Unmarshaler { return new(TestBench) }, func(v msgp.Unmarshaler) error { return handle(v.(*TestBench)) })
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalBatch(b *testing.B) {
+	bts := batchOf(b, 1000)
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := UnmarshalTestBenchBatch(bts, handle)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func TestPermissionsBitset(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 8, 9, 64, 65} {
+		in := Permissions{User: "u", Flags: make([]bool, n), Plain: make([]bool, n)}
+		for i := range in.Flags {
+			in.Flags[i] = i%3 == 0
+			in.Plain[i] = in.Flags[i]
+		}
+		b, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > in.Msgsize() {
+			t.Errorf("%d bools: Msgsize is %d, but %d bytes were written", n, in.Msgsize(), len(b))
+		}
+		flags := msgp.Locate("flags", b)
+		if want := msgp.AppendBitset(nil, in.Flags); !bytes.Equal(flags, want) {
+			t.Errorf("%d bools: flags written as %x; want the bitset %x", n, flags, want)
+		}
+
+		var out Permissions
+		if _, err = out.UnmarshalMsg(b); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("%d bools: unmarshaled %#v as %#v", n, in, out)
+		}
+
+		var buf bytes.Buffer
+		if err = msgp.Encode(&buf, &in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Errorf("%d bools: EncodeMsg wrote %x; MarshalMsg %x", n, buf.Bytes(), b)
+		}
+		out = Permissions{}
+		if err = msgp.Decode(&buf, &out); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("%d bools: decoded %#v as %#v", n, in, out)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package _generated
+
+import (
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func cloneTestType() *TestType {
+	f := 3.5
+	v := &TestType{
+		F:   &f,
+		Els: map[string]string{"a": "b"},
+		Any: map[string]interface{}{"list": []interface{}{int64(1), []byte("raw")}},
+		Child: &TestType{
+			Els: map[string]string{"child": "yes"},
+		},
+	}
+	v.Obj.ValueA = "value"
+	v.Obj.ValueB = []byte("bytes")
+	return v
+}
+
+func TestCloneTestType(t *testing.T) {
+	orig := cloneTestType()
+	cp := orig.Clone()
+	if !reflect.DeepEqual(orig, cp) {
+		t.Fatalf("clone isn't equal:\n%+v\n%+v", orig, cp)
+	}
+
+	*orig.F = 0
+	orig.Els["a"] = "changed"
+	orig.Obj.ValueB[0] = 'X'
+	orig.Child.Els["child"] = "changed"
+	orig.Any.(map[string]interface{})["list"].([]interface{})[1].([]byte)[0] = 'X'
+
+	if !reflect.DeepEqual(cp, cloneTestType()) {
+		t.Errorf("clone was changed by mutating the original:\n%+v", cp)
+	}
+}
+
+func TestCloneCustom(t *testing.T) {
+	mk := func() *Custom {
+		return &Custom{
+			Int: map[string]CustomInt{"one": 1},
+			Bts: CustomBytes("bytes"),
+			Mp: map[string]*Embedded{
+				"e":   {Embedded: &Embedded{Other: "inner"}, Children: []Embedded{{Other: "child"}}},
+				"nil": nil,
+			},
+			Enums: []MyEnum{A, B},
+		}
+	}
+	orig := mk()
+	cp := orig.Clone()
+	if !reflect.DeepEqual(orig, cp) {
+		t.Fatalf("clone isn't equal:\n%+v\n%+v", orig, cp)
+	}
+
+	orig.Int["one"] = 2
+	orig.Bts[0] = 'X'
+	orig.Mp["e"].Embedded.Other = "changed"
+	orig.Mp["e"].Children[0].Other = "changed"
+	orig.Enums[0] = C
+
+	if !reflect.DeepEqual(cp, mk()) {
+		t.Errorf("clone was changed by mutating the original:\n%+v", cp)
+	}
+}
+
+func TestCloneExtensions(t *testing.T) {
+	orig := &Things{
+		Vals: []int32{1, 2, 3},
+		Ext:  &msgp.RawExtension{Type: 10, Data: []byte("ext")},
+		Oext: msgp.RawExtension{Type: 11, Data: []byte("oext")},
+	}
+	cp := orig.Clone()
+	if !reflect.DeepEqual(orig, cp) {
+		t.Fatalf("clone isn't equal:\n%+v\n%+v", orig, cp)
+	}
+	orig.Vals[0] = 100
+	orig.Ext.Data[0] = 'X'
+	orig.Oext.Data[0] = 'X'
+	if cp.Vals[0] != 1 || string(cp.Ext.Data) != "ext" || string(cp.Oext.Data) != "oext" {
+		t.Errorf("clone was changed by mutating the original:\n%+v", cp)
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	var v *TestType
+	if v.Clone() != nil {
+		t.Error("expected the clone of nil to be nil")
+	}
+	cp := (&NilContainers{Slice: []string{}}).Clone()
+	if cp.Slice == nil || cp.NilSlice != nil || cp.Map != nil {
+		t.Errorf("nil-ness wasn't preserved: %+v", cp)
+	}
+}
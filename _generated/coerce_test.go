@@ -0,0 +1,94 @@
+package _generated
+
+import (
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+)
+
+// coerced returns a Coerced with one field,
+// 'name', set to 'val'
+func coerced(name string, val func([]byte) []byte) []byte {
+	var bts []byte
+	bts = msgp.AppendMapHeader(bts, 1)
+	bts = msgp.AppendString(bts, name)
+	return val(bts)
+}
+
+func str(s string) func([]byte) []byte {
+	return func(b []byte) []byte { return msgp.AppendString(b, s) }
+}
+
+// decodeCoerced decodes 'bts' with both UnmarshalMsg
+// and DecodeMsg (see decodeBoth)
+func decodeCoerced(t *testing.T, bts []byte) (Coerced, error) {
+	out, err := decodeBoth(t, bts, func() decoder { return new(Coerced) }, nil)
+	return *out.(*Coerced), err
+}
+
+func TestCoerce(t *testing.T) {
+	// valid strings
+	v, err := decodeCoerced(t, coerced("int", str("-42")))
+	if err != nil || v.Int != -42 {
+		t.Errorf("int: got %d, %v", v.Int, err)
+	}
+	v, err = decodeCoerced(t, coerced("int8", str("127")))
+	if err != nil || v.Int8 != 127 {
+		t.Errorf("int8: got %d, %v", v.Int8, err)
+	}
+	v, err = decodeCoerced(t, coerced("uint", str("4000000000")))
+	if err != nil || v.Uint != 4000000000 {
+		t.Errorf("uint: got %d, %v", v.Uint, err)
+	}
+	v, err = decodeCoerced(t, coerced("float", str("3.25")))
+	if err != nil || v.Float != 3.25 {
+		t.Errorf("float: got %g, %v", v.Float, err)
+	}
+	v, err = decodeCoerced(t, coerced("f32", str("1.5")))
+	if err != nil || v.F32 == nil || *v.F32 != 1.5 {
+		t.Errorf("f32: got %v, %v", v.F32, err)
+	}
+	v, err = decodeCoerced(t, coerced("named", str("7")))
+	if err != nil || v.Named != 7 {
+		t.Errorf("named: got %d, %v", v.Named, err)
+	}
+
+	// invalid strings
+	for _, in := range []struct {
+		field string
+		value string
+	}{
+		{"int", "forty-two"},
+		{"int", ""},
+		{"int8", "128"},
+		{"uint", "-1"},
+		{"float", "1.2.3"},
+		{"named", "seven"},
+	} {
+		_, err = decodeCoerced(t, coerced(in.field, str(in.value)))
+		if _, ok := err.(msgp.CoerceError); !ok {
+			t.Errorf("%s = %q: expected a CoerceError; got %v", in.field, in.value, err)
+		}
+	}
+
+	// the normal numeric wire encoding
+	f32 := float32(2.5)
+	in := Coerced{Int: 1, Int8: -2, Uint: 3, Float: 4.5, F32: &f32, Named: 6}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = decodeCoerced(t, bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Int != in.Int || v.Int8 != in.Int8 || v.Uint != in.Uint ||
+		v.Float != in.Float || *v.F32 != *in.F32 || v.Named != in.Named {
+		t.Errorf("%+v in; %+v out", in, v)
+	}
+
+	// numbers that don't fit are still overflows
+	_, err = decodeCoerced(t, coerced("int8", func(b []byte) []byte { return msgp.AppendInt(b, 300) }))
+	if _, ok := err.(msgp.IntOverflow); !ok {
+		t.Errorf("expected an IntOverflow; got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func converted() *Converted {
+	s, i, f, b := NamedStr("str"), NamedInt(-7), NamedFloat(2.5), NamedBytes("bts")
+	return &Converted{
+		Str:       s,
+		Int:       i,
+		Float:     f,
+		Bytes:     b,
+		PtrStr:    &s,
+		PtrInt:    &i,
+		PtrFloat:  &f,
+		PtrBytes:  &b,
+		SlcStr:    []NamedStr{"a", "b"},
+		SlcInt:    []NamedInt{1, 2, 3},
+		SlcFloat:  []NamedFloat{0.5},
+		SlcBytes:  []NamedBytes{NamedBytes("x"), NamedBytes("yz")},
+		ArrStr:    [2]NamedStr{"c", "d"},
+		ArrInt:    [2]NamedInt{4, 5},
+		ArrFloat:  [2]NamedFloat{-1, 1},
+		ArrBytes:  [2]NamedBytes{NamedBytes("p"), NamedBytes("q")},
+		MapStr:    map[string]NamedStr{"k": "v"},
+		MapInt:    map[string]NamedInt{"k": 9},
+		MapFloat:  map[string]NamedFloat{"k": 1.25},
+		MapBytes:  map[string]NamedBytes{"k": NamedBytes("w")},
+		SlcPtrInt: []*NamedInt{&i, &i},
+		MapPtrStr: map[string]*NamedStr{"k": &s},
+	}
+}
+
+func TestConvertedRoundTrip(t *testing.T) {
+	in := converted()
+
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every field has an exact size
+	if len(bts) != in.Msgsize() {
+		t.Errorf("Msgsize() is %d; encoded %d bytes", in.Msgsize(), len(bts))
+	}
+	if zero, _ := (&Converted{}).MarshalMsg(nil); len(zero) != (&Converted{}).Msgsize() {
+		t.Errorf("Msgsize() of the zero value is %d; encoded %d bytes", (&Converted{}).Msgsize(), len(zero))
+	}
+	out := &Converted{}
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: got %+v; want %+v", out, in)
+	}
+
+	var buf bytes.Buffer
+	if err = msgp.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Error("EncodeMsg and MarshalMsg wrote different bytes")
+	}
+	out = &Converted{}
+	if err = msgp.Decode(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, in)
+	}
+
+	if cp := in.Clone(); !reflect.DeepEqual(in, cp) {
+		t.Errorf("Clone: got %+v; want %+v", cp, in)
+	}
+}
+
+// the named types are written
+// the same way as their bases
+func TestConvertedWireTypes(t *testing.T) {
+	bts, err := converted().MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _, err := msgp.ReadMapStrIntfBytes(bts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"str":       "str",
+		"ptr_int":   int64(-7),
+		"arr_float": []interface{}{float64(-1), float64(1)},
+		"arr_bytes": []interface{}{[]byte("p"), []byte("q")},
+		"map_bytes": map[string]interface{}{"k": []byte("w")},
+	}
+	for k, w := range want {
+		if !reflect.DeepEqual(v[k], w) {
+			t.Errorf("%s: got %#v; want %#v", k, v[k], w)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+// decoder is a type with generated
+// UnmarshalMsg and DecodeMsg methods
+type decoder interface {
+	msgp.Unmarshaler
+	msgp.Decodable
+}
+
+// decodeBoth decodes 'b' with both UnmarshalMsg and
+// DecodeMsg, each into a new value from 'fresh', and
+// checks that they agree: that they return the same
+// error, or else decode values that 'equal' says are
+// equal (reflect.DeepEqual, if 'equal' is nil). It
+// returns what UnmarshalMsg decoded.
+func decodeBoth(t *testing.T, b []byte, fresh func() decoder, equal func(a, b decoder) bool) (decoder, error) {
+	if equal == nil {
+		equal = func(a, b decoder) bool { return reflect.DeepEqual(a, b) }
+	}
+	out := fresh()
+	left, err := out.UnmarshalMsg(b)
+	if err == nil && len(left) > 0 {
+		t.Errorf("%d bytes left", len(left))
+	}
+	dout := fresh()
+	derr := msgp.Decode(bytes.NewReader(b), dout)
+	if !reflect.DeepEqual(err, derr) {
+		t.Errorf("UnmarshalMsg returned %v, but DecodeMsg returned %v", err, derr)
+	} else if err == nil && !equal(out, dout) {
+		t.Errorf("UnmarshalMsg decoded %+v, but DecodeMsg decoded %+v", out, dout)
+	}
+	return out, err
+}
+
+// encoder is a type with generated
+// MarshalMsg, EncodeMsg and Msgsize methods
+type encoder interface {
+	msgp.Marshaler
+	msgp.Encodable
+	msgp.Sizer
+}
+
+// roundTrip writes 'in' with both MarshalMsg and
+// EncodeMsg, checks that Msgsize is big enough, and
+// decodes each message with decodeBoth into new
+// values from 'fresh', which should equal 'in'. The
+// messages themselves aren't compared, since the
+// order of map entries varies; it returns them.
+func roundTrip(t *testing.T, in encoder, fresh func() decoder) (marshaled, encoded []byte) {
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Msgsize() < len(bts) {
+		t.Errorf("Msgsize() is %d, but the message is %d bytes", in.Msgsize(), len(bts))
+	}
+	var buf bytes.Buffer
+	if err = msgp.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []struct {
+		name string
+		b    []byte
+	}{{"MarshalMsg", bts}, {"EncodeMsg", buf.Bytes()}} {
+		out, err := decodeBoth(t, msg.b, fresh, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", msg.name, err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("%s: got %+v; want %+v", msg.name, out, in)
+		}
+	}
+	return bts, buf.Bytes()
+}
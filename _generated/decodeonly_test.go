@@ -0,0 +1,108 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// wireKeys returns the keys of the map in 'bts'
+func wireKeys(t *testing.T, bts []byte) []string {
+	sz, bts, err := msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, sz)
+	for i := uint32(0); i < sz; i++ {
+		var key []byte
+		key, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(key))
+		bts, err = msgp.Skip(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(bts) != 0 {
+		t.Fatalf("%d bytes after the map", len(bts))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestDecodeOnlyEncode(t *testing.T) {
+	in := Deprecated{Name: "n", Old: "old", Sum: 3, Gone: true}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := msgp.Encode(&buf, &in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Errorf("EncodeMsg wrote %x; MarshalMsg wrote %x", buf.Bytes(), bts)
+	}
+	if s := in.Msgsize(); s < len(bts) {
+		t.Errorf("Msgsize is %d, but %d bytes were written", s, len(bts))
+	}
+
+	// the header only counts the encoded fields
+	if keys := wireKeys(t, bts); !reflect.DeepEqual(keys, []string{"name", "sum"}) {
+		t.Errorf("keys on the wire: %q", keys)
+	}
+
+	// and the encodeonly field isn't read back
+	want := Deprecated{Name: "n"}
+	var out Deprecated
+	if _, err := out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("UnmarshalMsg: got %+v; want %+v", out, want)
+	}
+	out = Deprecated{}
+	if err := msgp.Decode(bytes.NewReader(bts), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, want)
+	}
+}
+
+func TestDecodeOnlyDecode(t *testing.T) {
+	// what an older version wrote
+	bts := msgp.AppendMapHeader(nil, 4)
+	bts = msgp.AppendString(bts, "name")
+	bts = msgp.AppendString(bts, "n")
+	bts = msgp.AppendString(bts, "old")
+	bts = msgp.AppendString(bts, "old")
+	bts = msgp.AppendString(bts, "sum")
+	bts = msgp.AppendInt(bts, 3)
+	bts = msgp.AppendString(bts, "gone")
+	bts = msgp.AppendBool(bts, true)
+
+	want := Deprecated{Name: "n", Old: "old", Gone: true}
+	var out Deprecated
+	left, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("%d bytes left over", len(left))
+	}
+	if out != want {
+		t.Errorf("UnmarshalMsg: got %+v; want %+v", out, want)
+	}
+	out = Deprecated{}
+	if err := msgp.Decode(bytes.NewReader(bts), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != want {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, want)
+	}
+}
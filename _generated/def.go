@@ -2,10 +2,13 @@ package _generated
 
 import (
 	"github.com/philhofer/msgp/msgp"
+	"net"
+	"net/netip"
+	"sort"
 	"time"
 )
 
-//go:generate msgp -o generated.go
+//go:generate msgp -o generated.go -clone -schema -descriptors -golden testdata/golden -observe -random -batch -fuzz
 
 // All of the struct
 // definitions in this
@@ -121,6 +124,18 @@ func myenumStr(s string) MyEnum {
 	}
 }
 
+// test shims in tags, which take the
+// place of the shim directive above
+type FieldShims struct {
+	Named MyEnum   `msg:"named"`
+	Code  MyEnum   `msg:"code,as=uint8,using=myenumToByte/myenumFromByte"`
+	Ptr   *MyEnum  `msg:"ptr,as=uint8,using=myenumToByte/myenumFromByte"`
+	Codes []MyEnum `msg:"codes"`
+}
+
+func myenumToByte(m MyEnum) uint8   { return uint8(m) }
+func myenumFromByte(b uint8) MyEnum { return MyEnum(b) }
+
 type Custom struct {
 	Int   map[string]CustomInt `msg:"mapstrint"`
 	Bts   CustomBytes          `msg:"bts"`
@@ -129,3 +144,576 @@ type Custom struct {
 }
 type CustomInt int
 type CustomBytes []byte
+
+// test transform directive (below)
+
+//msgp:transform pii
+
+type PII struct {
+	Name  string      `msg:"name"`
+	SSN   string      `msg:"ssn,transform=pii"`
+	Age   int         `msg:"age,transform=pii"`
+	Phone CustomBytes `msg:"phone,transform=pii"`
+	Fast  *TestFast   `msg:"fast,transform=pii"`
+}
+
+// test allownil (nil containers round-trip as nil),
+// on named slice and map types, too
+type NilContainers struct {
+	Slice    []string       `msg:"slice"`
+	NilSlice []string       `msg:"nil_slice,allownil"`
+	Map      map[string]int `msg:"map"`
+	NilMap   map[string]int `msg:"nil_map,allownil"`
+	NilNamed EventList      `msg:"nil_named,allownil"`
+	NilHdrs  Headers        `msg:"nil_hdrs,allownil"`
+}
+
+// test coerce (numbers encoded as strings)
+type Coerced struct {
+	Int   int       `msg:"int,coerce"`
+	Int8  int8      `msg:"int8,coerce"`
+	Uint  uint32    `msg:"uint,coerce"`
+	Float float64   `msg:"float,coerce"`
+	F32   *float32  `msg:"f32,coerce"`
+	Named CustomInt `msg:"named,coerce"`
+}
+
+// test byte fields
+type ByteHolder struct {
+	B   byte    `msg:"b"`
+	Arr [4]byte `msg:"arr"`
+}
+
+// test batched appends of fields
+// with statically-known sizes
+type Flags struct {
+	F00 bool `msg:"f00"`
+	F01 bool `msg:"f01"`
+	F02 bool `msg:"f02"`
+	F03 bool `msg:"f03"`
+	F04 bool `msg:"f04"`
+	F05 bool `msg:"f05"`
+	F06 bool `msg:"f06"`
+	F07 bool `msg:"f07"`
+	F08 bool `msg:"f08"`
+	F09 bool `msg:"f09"`
+	F10 bool `msg:"f10"`
+	F11 bool `msg:"f11"`
+	F12 bool `msg:"f12"`
+	F13 bool `msg:"f13"`
+	F14 bool `msg:"f14"`
+	F15 bool `msg:"f15"`
+	F16 bool `msg:"f16"`
+	F17 bool `msg:"f17"`
+	F18 bool `msg:"f18"`
+	F19 bool `msg:"f19"`
+	F20 bool `msg:"f20"`
+	F21 bool `msg:"f21"`
+	F22 bool `msg:"f22"`
+	F23 bool `msg:"f23"`
+	F24 bool `msg:"f24"`
+	F25 bool `msg:"f25"`
+	F26 bool `msg:"f26"`
+	F27 bool `msg:"f27"`
+	F28 bool `msg:"f28"`
+	F29 bool `msg:"f29"`
+	F30 bool `msg:"f30"`
+	F31 bool `msg:"f31"`
+}
+
+type MyBool bool
+
+type MixedFlags struct {
+	On    bool   `msg:"on"`
+	Name  string `msg:"name"`
+	Named MyBool `msg:"named"`
+	Off   bool   `msg:"off"`
+	Ptr   *bool  `msg:"ptr"`
+	Last  bool   `msg:"last"`
+}
+
+//msgp:tuple TupleFlags
+
+type TupleFlags struct {
+	A bool
+	B bool
+	N int
+	C bool
+}
+
+type AnonContainers struct {
+	Settings map[string]struct {
+		On    bool
+		Level int
+	} `msg:"settings"`
+	List []struct {
+		Name string `msg:"name"`
+		N    int    `msg:"n"`
+	} `msg:"list"`
+	Pair [2]struct {
+		X, Y float64
+	} `msg:"pair"`
+}
+
+// anonymous structs side by side, in
+// each other, and behind pointers, which
+// need temporaries with names of their own
+type AnonRows struct {
+	Rows []struct {
+		Key string
+		Val int64
+	} `msg:"rows"`
+	More []struct {
+		Key string
+		Val int64
+	} `msg:"more"`
+	Ptrs   []*struct{ N int } `msg:"ptrs"`
+	Nested []struct {
+		Inner []struct{ S string }
+		Set   map[string]struct{ On bool }
+	} `msg:"nested"`
+	Groups map[string][]struct{ X int } `msg:"groups"`
+}
+
+// test named types over base types
+// in every container position
+type NamedStr string
+type NamedInt int
+type NamedFloat float64
+type NamedBytes []byte
+
+type Converted struct {
+	Str       NamedStr              `msg:"str"`
+	Int       NamedInt              `msg:"int"`
+	Float     NamedFloat            `msg:"float"`
+	Bytes     NamedBytes            `msg:"bytes"`
+	PtrStr    *NamedStr             `msg:"ptr_str"`
+	PtrInt    *NamedInt             `msg:"ptr_int"`
+	PtrFloat  *NamedFloat           `msg:"ptr_float"`
+	PtrBytes  *NamedBytes           `msg:"ptr_bytes"`
+	SlcStr    []NamedStr            `msg:"slc_str"`
+	SlcInt    []NamedInt            `msg:"slc_int"`
+	SlcFloat  []NamedFloat          `msg:"slc_float"`
+	SlcBytes  []NamedBytes          `msg:"slc_bytes"`
+	ArrStr    [2]NamedStr           `msg:"arr_str"`
+	ArrInt    [2]NamedInt           `msg:"arr_int"`
+	ArrFloat  [2]NamedFloat         `msg:"arr_float"`
+	ArrBytes  [2]NamedBytes         `msg:"arr_bytes"`
+	MapStr    map[string]NamedStr   `msg:"map_str"`
+	MapInt    map[string]NamedInt   `msg:"map_int"`
+	MapFloat  map[string]NamedFloat `msg:"map_float"`
+	MapBytes  map[string]NamedBytes `msg:"map_bytes"`
+	SlcPtrInt []*NamedInt           `msg:"slc_ptr_int"`
+	MapPtrStr map[string]*NamedStr  `msg:"map_ptr_str"`
+}
+
+// named string types as map keys
+type NamedKeys struct {
+	Counts map[NamedStr]int                 `msg:"counts"`
+	Nested map[NamedStr]map[NamedStr]string `msg:"nested"`
+}
+
+// test marshalas (Account is
+// written as an AccountWire)
+
+//msgp:marshalas Account AccountWire
+
+type Account struct {
+	ID    string
+	Owner struct {
+		First, Last string
+	}
+	Tags map[string]bool
+
+	balance int64
+}
+
+type AccountWire struct {
+	ID      string   `msg:"id"`
+	Name    string   `msg:"name"`
+	Tags    []string `msg:"tags"`
+	Balance int64    `msg:"balance"`
+}
+
+func (a *Account) ToWire() *AccountWire {
+	w := &AccountWire{
+		ID:      a.ID,
+		Name:    a.Owner.First + " " + a.Owner.Last,
+		Balance: a.balance,
+	}
+	for tag := range a.Tags {
+		w.Tags = append(w.Tags, tag)
+	}
+	sort.Strings(w.Tags)
+	return w
+}
+
+// errNoAccountName is a msgp.Error, as the errors
+// that FromWire returns for input it can't take
+// have to be for the fuzz tests to pass
+var errNoAccountName = accountError("account name has no space")
+
+type accountError string
+
+func (e accountError) Error() string   { return string(e) }
+func (e accountError) Resumable() bool { return true }
+
+func (a *Account) FromWire(w *AccountWire) error {
+	first, last := w.Name, ""
+	for i := range w.Name {
+		if w.Name[i] == ' ' {
+			first, last = w.Name[:i], w.Name[i+1:]
+			break
+		}
+	}
+	if first == w.Name {
+		return errNoAccountName
+	}
+	a.ID = w.ID
+	a.Owner.First, a.Owner.Last = first, last
+	a.Tags = nil
+	for _, tag := range w.Tags {
+		if a.Tags == nil {
+			a.Tags = make(map[string]bool)
+		}
+		a.Tags[tag] = true
+	}
+	a.balance = w.Balance
+	return nil
+}
+
+// marshalas types are used like any others
+type Accounts struct {
+	Main   Account    `msg:"main"`
+	Others []*Account `msg:"others"`
+}
+
+// test maxentries (bounded map decoding)
+type BoundedMaps struct {
+	Strict map[string]int    `msg:"strict,maxentries=2"`
+	Drop   map[string]string `msg:"drop,maxentries=2,overflow=drop"`
+	After  string            `msg:"after"`
+}
+
+// nested containers reuse index
+// and size variables at each depth
+type Nested struct {
+	Maps    map[string]map[string]int `msg:"maps"`
+	Slices  [][]string                `msg:"slices"`
+	Structs map[string][]struct {
+		Name  string            `msg:"name"`
+		Attrs map[string]string `msg:"attrs"`
+		Grid  [][2]float64      `msg:"grid"`
+	} `msg:"structs"`
+	Arrays [2][3]int             `msg:"arrays"`
+	Ptrs   []map[string]*float64 `msg:"ptrs"`
+}
+
+// shims can use functions from
+// imported packages
+//msgp:import "path/filepath"
+//msgp:import htmlesc "html"
+//msgp:shim SlashPath as:string using:filepath.ToSlash/filepath.FromSlash
+//msgp:shim EscapedHTML as:string using:htmlesc.EscapeString/htmlesc.UnescapeString
+
+type (
+	SlashPath   = string
+	EscapedHTML = string
+)
+
+type ImportedShims struct {
+	Dir  SlashPath   `msg:"dir"`
+	Body EscapedHTML `msg:"body"`
+}
+
+// types that can be read from either
+// the map or the tuple form, but are
+// written in the form they're declared with
+//msgp:accept-both Versioned VersionedTuple
+//msgp:tuple VersionedTuple
+
+type Versioned struct {
+	Name  string            `msg:"name"`
+	Rev   int               `msg:"rev"`
+	Tags  []string          `msg:"tags"`
+	Attrs map[string]string `msg:"attrs"`
+	Inner struct {
+		On bool    `msg:"on"`
+		X  float64 `msg:"x"`
+	} `msg:"inner"`
+}
+
+type VersionedTuple struct {
+	Name  string            `msg:"name"`
+	Rev   int               `msg:"rev"`
+	Tags  []string          `msg:"tags"`
+	Attrs map[string]string `msg:"attrs"`
+	Inner struct {
+		On bool    `msg:"on"`
+		X  float64 `msg:"x"`
+	} `msg:"inner"`
+}
+
+// fields that are being phased out
+// are only read, and computed fields
+// are only written
+type Deprecated struct {
+	Name string `msg:"name"`
+	Old  string `msg:"old,decodeonly"`
+	Sum  int    `msg:"sum,encodeonly"`
+	Gone bool   `msg:"gone,decodeonly"`
+}
+
+// a transform that decodes in place,
+// as a cipher may (see alias_test.go)
+//msgp:transform inplace
+
+type InPlace struct {
+	Secret []byte `msg:"secret,transform=inplace"`
+	Code   string `msg:"code,transform=inplace"`
+}
+
+// a transform that makes its input larger,
+// as sealing with a MAC does (see transform_test.go)
+//msgp:transform seal
+
+type Sealed struct {
+	Note string    `msg:"note,transform=seal"`
+	Fast *TestFast `msg:"fast,transform=seal"`
+}
+
+// maps with integer keys
+type IntKeyed struct {
+	ByID    map[int64]string         `msg:"by_id"`
+	Small   map[int8]int             `msg:"small"`
+	Ports   map[uint16]bool          `msg:"ports"`
+	Bytes   map[byte][]byte          `msg:"bytes"`
+	Counts  map[uint]map[int]float64 `msg:"counts"`
+	Bounded map[int32]string         `msg:"bounded,maxentries=2,overflow=drop"`
+}
+
+// named maps get methods of their own,
+// which other types call
+type Headers map[string]string
+
+type Tables map[string]map[string]int
+
+type Entry struct {
+	Name string   `msg:"name"`
+	Tags []string `msg:"tags"`
+}
+
+type Entries map[uint16]*Entry
+
+type Directory map[string]Entry
+
+type Routed struct {
+	Headers Headers            `msg:"headers"`
+	Groups  map[string]Headers `msg:"groups"`
+	Tables  Tables             `msg:"tables"`
+	Entries *Entries           `msg:"entries"`
+	Dir     Directory          `msg:"dir"`
+}
+
+// map values that are pointers to generated
+// types are allocated on decode, and nil
+// values are written and read back as nil
+type Sessions struct {
+	ByID   map[string]*Entry            `msg:"by_id"`
+	ByUser map[string]map[string]*Entry `msg:"by_user"`
+}
+
+// named slices get methods of their own,
+// too, except for named []byte, which is
+// still written as bytes by other types
+type Event struct {
+	Kind string `msg:"kind"`
+	At   int64  `msg:"at"`
+}
+
+type EventList []Event
+
+type Matrix [][]float64
+
+type Blob []byte
+
+type Journal struct {
+	Events  EventList            `msg:"events"`
+	Ptr     *EventList           `msg:"ptr"`
+	ByName  map[string]EventList `msg:"by_name"`
+	Pending []EventList          `msg:"pending"`
+	Grid    Matrix               `msg:"grid"`
+	Blob    Blob                 `msg:"blob"`
+}
+
+// fields that are left out when they're empty,
+// so the size of the map is counted as it's written
+type Sparse struct {
+	Name    string            `msg:"name,omitempty"`
+	Count   int64             `msg:"count,omitempty"`
+	Ratio   float64           `msg:"ratio,omitempty"`
+	On      bool              `msg:"on,omitempty"`
+	Level   NamedInt          `msg:"level,omitempty"`
+	Data    []byte            `msg:"data,omitempty"`
+	Tags    []string          `msg:"tags,omitempty"`
+	Attrs   map[string]string `msg:"attrs,omitempty"`
+	Ptr     *Event            `msg:"ptr,omitempty"`
+	When    time.Time         `msg:"when,omitempty"`
+	Any     interface{}       `msg:"any,omitempty"`
+	Headers Headers           `msg:"headers,omitempty"`
+	Kept    string            `msg:"kept"`
+	Old     string            `msg:"old,decodeonly"`
+	Inner   struct {
+		X int `msg:"x,omitempty"`
+		Y int `msg:"y"`
+	} `msg:"inner"`
+}
+
+// a struct whose descriptor describes it
+// as it's written (see descriptor_test.go):
+// without the skipped field, and with the
+// shimmed one written as a string
+type Profile struct {
+	User     string    `msg:"user"`
+	Password string    `msg:"password,omitempty"`
+	Session  []byte    `msg:"-"`
+	Level    MyEnum    `msg:"level"`
+	Logins   uint32    `msg:"logins"`
+	Seen     time.Time `msg:"seen"`
+	Last     *Event    `msg:"last"`
+	Old      string    `msg:"old,decodeonly"`
+}
+
+// fields without msg tags are
+// named by their json tags
+type JSONTagged struct {
+	UserID int64  `json:"user_id,omitempty"`
+	Secret string `json:"-"`
+	Name   string `json:"name" msg:"display_name"`
+	Plain  bool   `json:",omitempty"`
+}
+
+// bool slices tagged bitset are
+// packed into bits on the wire
+type Permissions struct {
+	User  string `msg:"user"`
+	Flags []bool `msg:"flags,bitset"`
+	Bits  []bool `msg:"bits,bitset,allownil"`
+	Plain []bool `msg:"plain"`
+}
+
+// types that refer to themselves through
+// maps, slices and pointers, and to each
+// other, which Msgsize sizes by walking
+// their values, however deep they are
+type Node struct {
+	Name string           `msg:"name"`
+	Kids map[string]*Node `msg:"kids"`
+	List []Node           `msg:"list"`
+	Next *Node            `msg:"next"`
+	Tree *Tree            `msg:"tree"`
+}
+
+type Tree struct {
+	Root   *Node  `msg:"root"`
+	Forest []Tree `msg:"forest"`
+}
+
+// a tree whose nodes refer to their
+// own type through a slice of pointers
+type Branch struct {
+	Name     string    `msg:"name"`
+	Children []*Branch `msg:"children"`
+}
+
+// time.Time in each kind of
+// container, which the generated
+// code names, so it imports "time"
+type Times struct {
+	Ptr   *time.Time           `msg:"ptr"`
+	Slice []time.Time          `msg:"slice"`
+	Map   map[string]time.Time `msg:"map"`
+	Array [2]time.Time         `msg:"array"`
+	Ptrs  []*time.Time         `msg:"ptrs"`
+}
+
+// times written as integers since the Unix
+// epoch, in each unit, rather than as the
+// time extension
+type Epochs struct {
+	Sec   time.Time  `msg:"sec,epoch=s"`
+	Milli time.Time  `msg:"milli,epoch=ms"`
+	Nano  time.Time  `msg:"nano,epoch=ns"`
+	Ptr   *time.Time `msg:"ptr,epoch=ms"`
+	Opt   time.Time  `msg:"opt,epoch=ms,omitempty"`
+	Plain time.Time  `msg:"plain"`
+}
+
+// network addresses, which are base
+// types, like time.Time
+type Network struct {
+	IP     net.IP                `msg:"ip"`
+	Net    net.IPNet             `msg:"net"`
+	Addr   netip.Addr            `msg:"addr"`
+	PtrNet *net.IPNet            `msg:"ptr_net"`
+	IPs    []net.IP              `msg:"ips"`
+	Addrs  map[string]netip.Addr `msg:"addrs"`
+	Opt    net.IP                `msg:"opt,omitempty"`
+	OptAdr netip.Addr            `msg:"opt_adr,omitempty"`
+}
+
+// time.Duration is written as the
+// int64 it's defined as, without a
+// tag or a shim, as are named types
+// defined as it
+type Timeout time.Duration
+
+type Durations struct {
+	Wait    time.Duration            `msg:"wait"`
+	Ptr     *time.Duration           `msg:"ptr"`
+	Steps   []time.Duration          `msg:"steps"`
+	ByName  map[string]time.Duration `msg:"by_name"`
+	Opt     time.Duration            `msg:"opt,omitempty"`
+	Timeout Timeout                  `msg:"timeout"`
+}
+
+// types defined as net.IP and net.IPNet are
+// written as them, without a shim; decoding
+// reuses the memory of the addresses there
+type Gateway net.IP
+
+type Subnet net.IPNet
+
+type Route struct {
+	Via   Gateway   `msg:"via"`
+	Dest  Subnet    `msg:"dest"`
+	Hops  []Gateway `msg:"hops"`
+	Alt   *Subnet   `msg:"alt"`
+	Spare Gateway   `msg:"spare,omitempty"`
+}
+
+// each name in a grouped declaration
+// has all of the tag
+type Grouped struct {
+	Min, Max   int64              `msg:",omitempty"`
+	Head, Tail *msgp.RawExtension `msg:",extension"`
+	Tmp, Buf   []byte             `msg:"-"`
+}
+
+// Sample is a tuple by the directive right
+// above it, without naming it, and Series,
+// which has Samples, is still a map
+//
+//msgp:tuple
+type Sample struct {
+	At    int64
+	Value float64
+	Label string
+}
+
+type Series struct {
+	Name    string            `msg:"name"`
+	Samples []Sample          `msg:"samples"`
+	Last    *Sample           `msg:"last"`
+	ByLabel map[string]Sample `msg:"by_label"`
+}
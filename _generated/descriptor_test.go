@@ -0,0 +1,67 @@
+package _generated
+
+import (
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDescriptor(t *testing.T) {
+	want := msgp.TypeDescriptor{
+		Name: "Profile",
+		Fields: []msgp.FieldDescriptor{
+			{Name: "User", Tag: "user", Kind: msgp.StrType, TypeName: "string"},
+			{Name: "Password", Tag: "password", Kind: msgp.StrType, TypeName: "string", OmitEmpty: true},
+			{Name: "Level", Tag: "level", Kind: msgp.StrType, TypeName: "MyEnum"},
+			{Name: "Logins", Tag: "logins", Kind: msgp.UintType, TypeName: "uint32"},
+			{Name: "Seen", Tag: "seen", Kind: msgp.TimeType, TypeName: "time.Time", Extension: true},
+			{Name: "Last", Tag: "last", Kind: msgp.InvalidType, TypeName: "*Event"},
+			{Name: "Old", Tag: "old", Kind: msgp.StrType, TypeName: "string", DecodeOnly: true},
+		},
+	}
+	if !reflect.DeepEqual(ProfileDescriptor, want) {
+		t.Errorf("got descriptor\n%+v\nwant\n%+v", ProfileDescriptor, want)
+	}
+
+	// as tooling that redacts fields by tag would,
+	// find a field and the bytes that it's written as
+	p := Profile{User: "someone", Password: "hunter2", Level: B, Logins: 3, Seen: time.Unix(1, 0)}
+	b, err := p.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := ProfileDescriptor.Field("password")
+	if !ok || f.Name != "Password" {
+		t.Fatalf("Field(%q) = %+v, %t", "password", f, ok)
+	}
+	raw := ProfileDescriptor.Locate(f.Tag, b)
+	if typ := msgp.NextType(raw); typ != f.Kind {
+		t.Errorf("the located field is a %s; its descriptor says %s", typ, f.Kind)
+	}
+	s, _, err := msgp.ReadStringBytes(raw)
+	if err != nil || s != "hunter2" {
+		t.Errorf("read %q (%v) at the located field; want %q", s, err, "hunter2")
+	}
+	if _, ok := ProfileDescriptor.Field("Session"); ok {
+		t.Error("found the skipped field")
+	}
+	if raw := ProfileDescriptor.Locate("old", b); len(raw) != 0 {
+		t.Errorf("located the decodeonly field at %x", raw)
+	}
+
+	// tuples are written without tags
+	tf := TupleFlags{A: true, N: 42, C: true}
+	b, err = tf.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !TupleFlagsDescriptor.Tuple {
+		t.Error("TupleFlagsDescriptor isn't a tuple")
+	}
+	raw = TupleFlagsDescriptor.Locate("N", b)
+	n, _, err := msgp.ReadIntBytes(raw)
+	if err != nil || n != 42 {
+		t.Errorf("read %d (%v) at the located tuple field; want 42", n, err)
+	}
+}
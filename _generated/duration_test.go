@@ -0,0 +1,62 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDurationsRoundTrip(t *testing.T) {
+	d := -90 * time.Second
+	for _, in := range []*Durations{
+		// empty containers, since nil
+		// ones are read back as empty
+		{Steps: []time.Duration{}, ByName: map[string]time.Duration{}},
+		{
+			Wait:    1500 * time.Millisecond,
+			Ptr:     &d,
+			Steps:   []time.Duration{0, time.Nanosecond, -time.Hour, 1<<63 - 1},
+			ByName:  map[string]time.Duration{"day": 24 * time.Hour},
+			Opt:     time.Minute,
+			Timeout: Timeout(30 * time.Second),
+		},
+	} {
+		bts, enc := roundTrip(t, in, func() decoder { return new(Durations) })
+		if !bytes.Equal(enc, bts) {
+			t.Errorf("EncodeMsg wrote %x; MarshalMsg %x", enc, bts)
+		}
+	}
+}
+
+func TestDurationWire(t *testing.T) {
+	// a Duration is its int64 of nanoseconds,
+	// and the zero one is left out by omitempty
+	in := Durations{Wait: 1500 * time.Millisecond}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := wireKeys(t, bts); !reflect.DeepEqual(keys, []string{"by_name", "ptr", "steps", "timeout", "wait"}) {
+		t.Errorf("keys on the wire: %q", keys)
+	}
+	want := msgp.AppendMapHeader(nil, 1)
+	want = msgp.AppendString(want, "wait")
+	want = msgp.AppendInt64(want, int64(1500*time.Millisecond))
+	var one Durations
+	if _, err = one.UnmarshalMsg(want); err != nil || one.Wait != 1500*time.Millisecond {
+		t.Errorf("read %v, %v from an int64", one.Wait, err)
+	}
+
+	// named types defined as
+	// Duration have methods
+	to := Timeout(time.Second)
+	bts, err = to.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _, err := msgp.ReadInt64Bytes(bts); err != nil || n != int64(time.Second) {
+		t.Errorf("a Timeout was written as %x", bts)
+	}
+}
@@ -0,0 +1,81 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func init() {
+	msgp.RegisterMessage("fast", func() msgp.Decodable { return new(TestFast) })
+	msgp.RegisterMessage("custom", func() msgp.Decodable { return new(Custom) })
+}
+
+func TestEnvelope(t *testing.T) {
+	fast := &TestFast{Lat: 1, Long: 2, Alt: 3, Data: []byte("data")}
+	custom := &Custom{
+		Int:   map[string]CustomInt{"one": 1},
+		Bts:   CustomBytes("bts"),
+		Mp:    map[string]*Embedded{},
+		Enums: []MyEnum{A, B},
+	}
+	unknown := &Things{Cmplx: complex(1, 2)}
+
+	var buf bytes.Buffer
+	en := msgp.NewWriter(&buf)
+	for _, e := range []struct {
+		kind string
+		v    msgp.Encodable
+	}{
+		{"fast", fast},
+		{"custom", custom},
+		{"things", unknown},
+	} {
+		err := msgp.EncodeEnvelope(en, e.kind, e.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	en.Flush()
+
+	dc := msgp.NewReader(&buf)
+
+	kind, v, err := msgp.DecodeEnvelope(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != "fast" || !reflect.DeepEqual(v, fast) {
+		t.Errorf("got %q: %#v", kind, v)
+	}
+
+	kind, v, err = msgp.DecodeEnvelope(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kind != "custom" || !reflect.DeepEqual(v, custom) {
+		t.Errorf("got %q: %#v", kind, v)
+	}
+
+	// unknown kinds are captured as Raw
+	kind, v, err = msgp.DecodeEnvelope(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := v.(*msgp.Raw)
+	if kind != "things" || !ok {
+		t.Fatalf("expected *msgp.Raw for kind \"things\"; got %q: %T", kind, v)
+	}
+	want, _ := unknown.MarshalMsg(nil)
+	if !bytes.Equal([]byte(*raw), want) {
+		t.Error("raw payload doesn't match the encoded value")
+	}
+	var out Things
+	_, err = out.UnmarshalMsg([]byte(*raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Cmplx != unknown.Cmplx {
+		t.Errorf("%v in; %v out", unknown.Cmplx, out.Cmplx)
+	}
+}
@@ -0,0 +1,171 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+	"time"
+)
+
+// decodeEpochs decodes 'bts' with both UnmarshalMsg
+// and DecodeMsg (see decodeBoth)
+func decodeEpochs(t *testing.T, bts []byte) (Epochs, error) {
+	out, err := decodeBoth(t, bts, func() decoder { return new(Epochs) }, func(a, b decoder) bool {
+		return equalEpochs(a.(*Epochs), b.(*Epochs))
+	})
+	return *out.(*Epochs), err
+}
+
+func equalEpochs(a, b *Epochs) bool {
+	if (a.Ptr == nil) != (b.Ptr == nil) || (a.Ptr != nil && !a.Ptr.Equal(*b.Ptr)) {
+		return false
+	}
+	return a.Sec.Equal(b.Sec) && a.Milli.Equal(b.Milli) && a.Nano.Equal(b.Nano) &&
+		a.Opt.Equal(b.Opt) && a.Plain.Equal(b.Plain)
+}
+
+func TestEpochsRoundTrip(t *testing.T) {
+	for _, tm := range []time.Time{
+		time.Date(2017, 7, 14, 2, 40, 0, 123456789, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 999999999, time.UTC),
+		time.Date(1901, 3, 4, 5, 6, 7, 8, time.UTC),
+		time.Unix(0, 0),
+	} {
+		in := Epochs{Sec: tm, Milli: tm, Nano: tm, Ptr: &tm, Opt: tm, Plain: tm}
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := msgp.Encode(&buf, &in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("%s: EncodeMsg and MarshalMsg disagree", tm)
+		}
+		if len(bts) > in.Msgsize() {
+			t.Errorf("%s: wrote %d bytes; Msgsize is %d", tm, len(bts), in.Msgsize())
+		}
+		out, err := decodeEpochs(t, bts)
+		if err != nil {
+			t.Fatalf("%s: %s", tm, err)
+		}
+		// each is rounded down to its unit
+		want := Epochs{
+			Sec:   tm.Truncate(time.Second),
+			Milli: tm.Truncate(time.Millisecond),
+			Nano:  tm,
+			Ptr:   new(time.Time),
+			Opt:   tm.Truncate(time.Millisecond),
+			Plain: tm,
+		}
+		*want.Ptr = want.Milli
+		if !equalEpochs(&out, &want) {
+			t.Errorf("%s: got %+v; want %+v", tm, out, want)
+		}
+	}
+}
+
+func TestEpochsWire(t *testing.T) {
+	tm := time.Date(1960, 1, 1, 0, 0, 0, 500000000, time.UTC)
+	in := Epochs{Sec: tm, Milli: tm, Nano: tm, Ptr: &tm}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, err := msgp.ReadMapStrIntfBytes(bts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix := tm.Unix()
+	want := map[string]int64{
+		"sec":   unix,
+		"milli": unix*1e3 + 500,
+		"nano":  tm.UnixNano(),
+		"ptr":   unix*1e3 + 500,
+	}
+	for k, w := range want {
+		if got, ok := m[k].(int64); !ok || got != w {
+			t.Errorf("%s: got %#v; want %d", k, m[k], w)
+		}
+	}
+	if _, ok := m["opt"]; ok {
+		t.Error("opt is written though it's zero")
+	}
+
+	// the zero time doesn't fit in nanoseconds,
+	// so it's written as the time extension
+	bts, err = (&Epochs{}).MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, err = msgp.ReadMapStrIntfBytes(bts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["nano"].(time.Time); !ok {
+		t.Errorf("nano: got %#v; want a time.Time", m["nano"])
+	}
+	out, err := decodeEpochs(t, bts)
+	if err != nil || !out.Sec.IsZero() || !out.Milli.IsZero() || !out.Nano.IsZero() {
+		t.Errorf("the zero Epochs: got %+v, %v", out, err)
+	}
+}
+
+// epochs returns an Epochs with one field,
+// 'name', set to 'val'
+func epochs(name string, val func([]byte) []byte) []byte {
+	var bts []byte
+	bts = msgp.AppendMapHeader(bts, 1)
+	bts = msgp.AppendString(bts, name)
+	return val(bts)
+}
+
+func TestEpochsDecodeAny(t *testing.T) {
+	tm := time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		field string
+		val   func([]byte) []byte
+		want  time.Time
+	}{
+		{"uint32 seconds", "sec", func(b []byte) []byte { return msgp.AppendUint32(b, uint32(tm.Unix())) }, tm},
+		{"int64 seconds", "sec", func(b []byte) []byte { return msgp.AppendInt64(b, tm.Unix()) }, tm},
+		{"negative seconds", "sec", func(b []byte) []byte { return msgp.AppendInt64(b, -86400) }, time.Unix(-86400, 0)},
+		{"fixint seconds", "sec", func(b []byte) []byte { return msgp.AppendInt64(b, 3) }, time.Unix(3, 0)},
+		{"uint64 millis", "milli", func(b []byte) []byte { return msgp.AppendUint64(b, uint64(tm.Unix())*1e3) }, tm},
+		{"negative millis", "milli", func(b []byte) []byte { return msgp.AppendInt16(b, -1500) }, time.Unix(-2, 5e8)},
+		{"int8 nanos", "nano", func(b []byte) []byte { return msgp.AppendInt8(b, -100) }, time.Unix(0, -100)},
+		{"uint64 nanos", "nano", func(b []byte) []byte { return msgp.AppendUint64(b, uint64(tm.UnixNano())) }, tm},
+		{"pointer", "ptr", func(b []byte) []byte { return msgp.AppendUint16(b, 1000) }, time.Unix(1, 0)},
+		{"time extension", "sec", func(b []byte) []byte { return msgp.AppendTime(b, tm.Add(1)) }, tm.Add(1)},
+		{"timestamp", "milli", func(b []byte) []byte { return msgp.AppendTimestamp(b, tm.Add(1)) }, tm.Add(1)},
+	}
+	for _, tt := range tests {
+		v, err := decodeEpochs(t, epochs(tt.field, tt.val))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		got := map[string]time.Time{"sec": v.Sec, "milli": v.Milli, "nano": v.Nano}
+		if v.Ptr != nil {
+			got["ptr"] = *v.Ptr
+		}
+		if !got[tt.field].Equal(tt.want) {
+			t.Errorf("%s: got %s; want %s", tt.name, got[tt.field], tt.want)
+		}
+	}
+
+	// neither a string nor a float is a time
+	for _, val := range []func([]byte) []byte{
+		str("1500000000"),
+		func(b []byte) []byte { return msgp.AppendFloat64(b, 1.5e9) },
+	} {
+		_, err := decodeEpochs(t, epochs("sec", val))
+		if err == nil {
+			t.Error("no error")
+		} else if e, ok := err.(msgp.TypeError); !ok || e.Context != "Epochs.sec" {
+			t.Errorf("got %v; want a TypeError about Epochs.sec", err)
+		}
+	}
+}
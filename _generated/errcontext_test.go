@@ -0,0 +1,69 @@
+package _generated
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/philhofer/msgp/msgp"
+)
+
+func TestErrorContext(t *testing.T) {
+	// a map of one field of a Things, or of a
+	// TestType, with 'v' for it; the strings are long
+	// enough to be the wrong type, not too few bytes
+	field := func(key string, v []byte) []byte {
+		b := msgp.AppendMapHeader(nil, 1)
+		return append(msgp.AppendString(b, key), v...)
+	}
+	tests := []struct {
+		name string
+		msg  []byte
+		into interface {
+			msgp.Unmarshaler
+			msgp.Decodable
+		}
+		want string
+		err  error
+	}{
+		{"wrong array size", field("arr", msgp.AppendArrayHeader(nil, 3)), new(Things),
+			"Things.arr: wanted array of size 8; got 3", msgp.ArrayError{}},
+		{"not an array", field("arr", msgp.AppendString(nil, "x")), new(Things),
+			"Things.arr: attempted to decode type", msgp.TypeError{}},
+		{"wrong element", field("values", msgp.AppendString(msgp.AppendArrayHeader(nil, 1), "x")), new(Things),
+			"Things.values: attempted to decode type", msgp.TypeError{}},
+		{"wrong type", field("complex", msgp.AppendString(nil, "not a complex64")), new(Things),
+			"Things.complex: attempted to decode type", msgp.TypeError{}},
+		{"anonymous struct", field("object", field("value_a", msgp.AppendInt(nil, 1))), new(TestType),
+			"TestType.object.value_a: attempted to decode type", msgp.TypeError{}},
+		{"pointer", field("float", msgp.AppendString(nil, "not a float64")), new(TestType),
+			"TestType.float: attempted to decode type", msgp.TypeError{}},
+	}
+	for _, tt := range tests {
+		_, err := tt.into.UnmarshalMsg(tt.msg)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: UnmarshalMsg returned %v; want %q", tt.name, err, tt.want)
+		}
+		if err != nil && !sameType(err, tt.err) {
+			t.Errorf("%s: UnmarshalMsg returned a %T", tt.name, err)
+		}
+		err = msgp.Decode(bytes.NewReader(tt.msg), tt.into)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: DecodeMsg returned %v; want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// sameType returns whether or not 'a'
+// and 'b' are errors of the same type
+func sameType(a, b error) bool {
+	switch b.(type) {
+	case msgp.ArrayError:
+		_, ok := a.(msgp.ArrayError)
+		return ok
+	case msgp.TypeError:
+		_, ok := a.(msgp.TypeError)
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+// TestFieldOrder decodes a map whose keys are out of
+// order and interleaved with unknown ones. (With a
+// small -split, each run of fields is decoded by a
+// helper of its own, and the keys jump between them.)
+func TestFieldOrder(t *testing.T) {
+	b := msgp.AppendMapHeader(nil, 9)
+	b = msgp.AppendString(b, "last")
+	b = msgp.AppendBool(b, true)
+	b = msgp.AppendString(b, "unknown")
+	b = msgp.AppendArrayHeader(b, 1)
+	b = msgp.AppendString(b, "skipped")
+	b = msgp.AppendString(b, "name")
+	b = msgp.AppendString(b, "mixed")
+	b = msgp.AppendString(b, "ptr")
+	b = msgp.AppendBool(b, false)
+	b = msgp.AppendString(b, "on")
+	b = msgp.AppendBool(b, true)
+	b = msgp.AppendString(b, "off")
+	b = msgp.AppendBool(b, true)
+	b = msgp.AppendString(b, "also_unknown")
+	b = msgp.AppendInt(b, 3)
+	b = msgp.AppendString(b, "named")
+	b = msgp.AppendBool(b, true)
+	b = msgp.AppendString(b, "last")
+	b = msgp.AppendBool(b, false)
+
+	f := false
+	want := &MixedFlags{On: true, Name: "mixed", Named: true, Off: true, Ptr: &f}
+
+	out := new(MixedFlags)
+	left, err := out.UnmarshalMsg(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left", len(left))
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("UnmarshalMsg: got %+v; want %+v", out, want)
+	}
+	dout := new(MixedFlags)
+	if err = msgp.Decode(bytes.NewReader(b), dout); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(dout, want) {
+		t.Errorf("DecodeMsg: got %+v; want %+v", dout, want)
+	}
+}
@@ -0,0 +1,44 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+)
+
+// TestUnmarshalHugeHeaders checks that UnmarshalMsg
+// doesn't allocate for the sizes that a few bytes
+// claim, which the fuzz tests found it did
+func TestUnmarshalHugeHeaders(t *testing.T) {
+	for _, field := range []string{"slice", "map"} {
+		var bts []byte
+		bts = msgp.AppendMapHeader(bts, 1)
+		bts = msgp.AppendString(bts, field)
+		if field == "slice" {
+			bts = msgp.AppendArrayHeader(bts, 1<<32-1)
+		} else {
+			bts = msgp.AppendMapHeader(bts, 1<<32-1)
+		}
+		var v Times
+		if _, err := v.UnmarshalMsg(bts); err != msgp.ErrShortBytes {
+			t.Errorf("%s: got %v; want ErrShortBytes", field, err)
+		}
+	}
+}
+
+// TestUnmarshalEmptyKey checks that an empty
+// key is skipped, which the fuzz tests found
+// panicked
+func TestUnmarshalEmptyKey(t *testing.T) {
+	var bts []byte
+	bts = msgp.AppendMapHeader(bts, 1)
+	bts = msgp.AppendString(bts, "")
+	bts = msgp.AppendInt(bts, 1)
+	var v Times
+	if _, err := v.UnmarshalMsg(bts); err != nil {
+		t.Errorf("UnmarshalMsg: %s", err)
+	}
+	if err := msgp.Decode(bytes.NewReader(bts), &v); err != nil {
+		t.Errorf("DecodeMsg: %s", err)
+	}
+}
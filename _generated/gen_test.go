@@ -2,6 +2,7 @@ package _generated
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/philhofer/msgp/msgp"
 	"reflect"
 	"testing"
@@ -58,6 +59,38 @@ func BenchmarkFastDecode(b *testing.B) {
 	}
 }
 
+// benchmark decoding a map with many keys,
+// almost all of which are unknown to the type.
+// key-related allocations should be bounded by
+// the number of stored keys, not wire keys.
+func BenchmarkManyKeysDecode(b *testing.B) {
+	var buf bytes.Buffer
+	en := msgp.NewWriter(&buf)
+	en.WriteMapHeader(1000)
+	en.WriteString("A")
+	en.WriteString("hello")
+	for i := 1; i < 1000; i++ {
+		en.WriteString(fmt.Sprintf("unknown_key_%d", i))
+		en.WriteNil()
+	}
+	en.Flush()
+
+	var v TestHidden
+	rd := bytes.NewReader(buf.Bytes())
+	dc := msgp.NewReader(rd)
+	b.SetBytes(int64(buf.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rd.Seek(0, 0) // reset
+		dc.Reset(rd)
+		err := v.DecodeMsg(dc)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // This covers the following cases:
 //  - Recursive types
 //  - Non-builtin identifiers (and recursive types)
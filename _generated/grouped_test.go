@@ -0,0 +1,36 @@
+package _generated
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/philhofer/msgp/msgp"
+)
+
+func TestGroupedFields(t *testing.T) {
+	in := Grouped{
+		Max:  7,
+		Head: &msgp.RawExtension{Type: 3, Data: []byte("head")},
+		Tail: &msgp.RawExtension{Type: 4, Data: []byte("tail")},
+		Tmp:  []byte("tmp"),
+		Buf:  []byte("buf"),
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Min is empty, and Tmp and Buf are left out
+	if keys := sparseKeys(t, bts); !reflect.DeepEqual(keys, []string{"Max", "Head", "Tail"}) {
+		t.Errorf("wrote keys %q", keys)
+	}
+
+	// a RawExtension reads the type it's set to
+	out := Grouped{Head: &msgp.RawExtension{Type: 3}, Tail: &msgp.RawExtension{Type: 4}}
+	if _, err := out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	in.Tmp, in.Buf = nil, nil
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v; want %+v", out, in)
+	}
+}
@@ -0,0 +1,26 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestImportedShims(t *testing.T) {
+	in := &ImportedShims{Dir: "a/b/c", Body: "<b>bold</b>"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(bts, []byte("&lt;b&gt;bold&lt;/b&gt;")) {
+		t.Errorf("body wasn't escaped: %q", bts)
+	}
+
+	out := new(ImportedShims)
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *out != *in {
+		t.Errorf("in: %+v; out: %+v", in, out)
+	}
+}
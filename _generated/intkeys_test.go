@@ -0,0 +1,97 @@
+package _generated
+
+import (
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func testIntKeyed() *IntKeyed {
+	return &IntKeyed{
+		ByID:    map[int64]string{-1 << 40: "neg", 0: "zero", 1 << 40: "big"},
+		Small:   map[int8]int{-128: 1, 127: 2},
+		Ports:   map[uint16]bool{80: true, 65535: false},
+		Bytes:   map[byte][]byte{0: []byte("a"), 255: []byte("b")},
+		Counts:  map[uint]map[int]float64{3: {-3: 1.5}, 4: {}},
+		Bounded: map[int32]string{-5: "x"},
+	}
+}
+
+// decodeIntKeyed decodes 'b' with both
+// UnmarshalMsg and DecodeMsg (see decodeBoth)
+func decodeIntKeyed(t *testing.T, b []byte) (*IntKeyed, error) {
+	out, err := decodeBoth(t, b, func() decoder { return new(IntKeyed) }, nil)
+	return out.(*IntKeyed), err
+}
+
+func TestIntKeysRoundTrip(t *testing.T) {
+	roundTrip(t, testIntKeyed(), func() decoder { return new(IntKeyed) })
+}
+
+func TestIntKeysEitherEncoding(t *testing.T) {
+	// keys written by other encoders may be
+	// ints or uints, whatever the Go type is
+	b := msgp.AppendMapHeader(nil, 2)
+	b = msgp.AppendString(b, "by_id")
+	b = msgp.AppendMapHeader(b, 2)
+	b = msgp.AppendUint64(b, 7)
+	b = msgp.AppendString(b, "seven")
+	b = msgp.AppendInt8(b, -3)
+	b = msgp.AppendString(b, "minus three")
+	b = msgp.AppendString(b, "ports")
+	b = msgp.AppendMapHeader(b, 1)
+	b = msgp.AppendInt64(b, 443)
+	b = msgp.AppendBool(b, true)
+
+	out, err := decodeIntKeyed(t, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int64]string{7: "seven", -3: "minus three"}; !reflect.DeepEqual(out.ByID, want) {
+		t.Errorf("ByID is %v; want %v", out.ByID, want)
+	}
+	if want := map[uint16]bool{443: true}; !reflect.DeepEqual(out.Ports, want) {
+		t.Errorf("Ports is %v; want %v", out.Ports, want)
+	}
+}
+
+func TestIntKeysInvalid(t *testing.T) {
+	entry := func(field string, key []byte, val []byte) []byte {
+		b := msgp.AppendMapHeader(nil, 1)
+		b = msgp.AppendString(b, field)
+		b = msgp.AppendMapHeader(b, 1)
+		b = append(b, key...)
+		return append(b, val...)
+	}
+	tests := []struct {
+		name string
+		msg  []byte
+		ok   func(error) bool
+	}{
+		{
+			name: "int8 overflow",
+			msg:  entry("small", msgp.AppendInt(nil, 128), msgp.AppendInt(nil, 1)),
+			ok:   func(err error) bool { _, ok := err.(msgp.IntOverflow); return ok },
+		},
+		{
+			name: "uint16 overflow",
+			msg:  entry("ports", msgp.AppendUint(nil, 1<<16), msgp.AppendBool(nil, true)),
+			ok:   func(err error) bool { _, ok := err.(msgp.UintOverflow); return ok },
+		},
+		{
+			name: "negative uint",
+			msg:  entry("ports", msgp.AppendInt(nil, -1), msgp.AppendBool(nil, true)),
+			ok:   func(err error) bool { _, ok := err.(msgp.TypeError); return ok },
+		},
+		{
+			name: "string key",
+			msg:  entry("by_id", msgp.AppendString(nil, "1"), msgp.AppendString(nil, "one")),
+			ok:   func(err error) bool { _, ok := err.(msgp.TypeError); return ok },
+		},
+	}
+	for _, tt := range tests {
+		if _, err := decodeIntKeyed(t, tt.msg); !tt.ok(err) {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package _generated
+
+import (
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+)
+
+func TestJSONTagged(t *testing.T) {
+	in := JSONTagged{UserID: 7, Secret: "s", Name: "n", Plain: true}
+	b, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"user_id", "display_name", "Plain"} {
+		if len(msgp.Locate(key, b)) == 0 {
+			t.Errorf("no %q key", key)
+		}
+	}
+	if n, _, _ := msgp.ReadMapHeaderBytes(b); n != 3 {
+		t.Errorf("%d keys; want 3 (the json:\"-\" field is skipped)", n)
+	}
+}
@@ -0,0 +1,42 @@
+package _generated
+
+import (
+	"reflect"
+	"testing"
+)
+
+// every Entry has Tags, since nil
+// slices are read back as empty ones
+func testSessions() *Sessions {
+	return &Sessions{
+		ByID: map[string]*Entry{
+			"a": {Name: "ann", Tags: []string{"admin"}},
+			"b": nil,
+		},
+		ByUser: map[string]map[string]*Entry{
+			"ann": {"a": {Name: "ann", Tags: []string{"x"}}, "gone": nil},
+		},
+	}
+}
+
+func TestMapPtrValues(t *testing.T) {
+	// decoding into maps that are already filled
+	// replaces their values, rather than writing
+	// through the pointers that were there
+	in := testSessions()
+	old := &Entry{Name: "old", Tags: []string{"y"}}
+	roundTrip(t, in, func() decoder {
+		return &Sessions{ByID: map[string]*Entry{"a": old, "b": old, "c": old}}
+	})
+	if old.Name != "old" {
+		t.Error("a value that was replaced was written to")
+	}
+
+	cp := in.Clone()
+	if !reflect.DeepEqual(in, cp) {
+		t.Errorf("Clone: got %+v; want %+v", cp, in)
+	}
+	if cp.ByID["a"] == in.ByID["a"] {
+		t.Error("Clone shares the values of the map")
+	}
+}
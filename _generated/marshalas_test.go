@@ -0,0 +1,117 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func testAccount() Account {
+	var a Account
+	a.ID = "acct-1"
+	a.Owner.First, a.Owner.Last = "Ada", "Lovelace"
+	a.Tags = map[string]bool{"admin": true, "beta": true}
+	a.balance = -42
+	return a
+}
+
+func TestMarshalAsRoundTrip(t *testing.T) {
+	in := testAccount()
+
+	// the wire type decides the encoding
+	want, err := in.ToWire().MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bts, want) {
+		t.Errorf("MarshalMsg wrote %q; the wire type writes %q", bts, want)
+	}
+	if s := in.Msgsize(); s < len(bts) {
+		t.Errorf("Msgsize is %d, but %d bytes were written", s, len(bts))
+	}
+	if raw := msgp.Locate("name", bts); raw == nil {
+		t.Error("no \"name\" field in the encoding")
+	}
+
+	var out Account
+	left, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left", len(left))
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: %v in; %v out", in, out)
+	}
+
+	var buf bytes.Buffer
+	if err := msgp.Encode(&buf, &in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("EncodeMsg wrote %q; the wire type writes %q", buf.Bytes(), want)
+	}
+	out = Account{}
+	if err := msgp.Decode(&buf, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: %v in; %v out", in, out)
+	}
+}
+
+func TestMarshalAsField(t *testing.T) {
+	other := testAccount()
+	other.ID = "acct-2"
+	in := &Accounts{Main: testAccount(), Others: []*Account{&other, nil}}
+
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(Accounts)
+	if _, err := out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: %v in; %v out", in, out)
+	}
+
+	var buf bytes.Buffer
+	if err := msgp.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out = new(Accounts)
+	if err := msgp.Decode(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: %v in; %v out", in, out)
+	}
+}
+
+func TestMarshalAsFromWireError(t *testing.T) {
+	bts, err := (&AccountWire{ID: "acct-1", Name: "Ada"}).MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a Account
+	if _, err := a.UnmarshalMsg(bts); err != errNoAccountName {
+		t.Errorf("UnmarshalMsg: expected errNoAccountName; got %v", err)
+	}
+	if err := msgp.Decode(bytes.NewReader(bts), &a); err != errNoAccountName {
+		t.Errorf("DecodeMsg: expected errNoAccountName; got %v", err)
+	}
+}
+
+func TestMarshalAsSchema(t *testing.T) {
+	if s := AccountSchema(); s != "Account as AccountWire" {
+		t.Errorf("expected the schema to name the wire type; got %q", s)
+	}
+}
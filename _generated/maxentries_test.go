@@ -0,0 +1,76 @@
+package _generated
+
+import (
+	"fmt"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+// boundedPayload returns a BoundedMaps with 'strict'
+// entries in Strict and 'drop' entries in Drop
+func boundedPayload(strict int, drop int) []byte {
+	b := msgp.AppendMapHeader(nil, 3)
+	b = msgp.AppendString(b, "strict")
+	b = msgp.AppendMapHeader(b, uint32(strict))
+	for i := 0; i < strict; i++ {
+		b = msgp.AppendString(b, fmt.Sprintf("s%d", i))
+		b = msgp.AppendInt(b, i)
+	}
+	b = msgp.AppendString(b, "drop")
+	b = msgp.AppendMapHeader(b, uint32(drop))
+	for i := 0; i < drop; i++ {
+		b = msgp.AppendString(b, fmt.Sprintf("d%d", i))
+		b = msgp.AppendString(b, "value")
+	}
+	b = msgp.AppendString(b, "after")
+	b = msgp.AppendString(b, "end")
+	return b
+}
+
+// decodeBounded decodes 'b' with both
+// UnmarshalMsg and DecodeMsg (see decodeBoth)
+func decodeBounded(t *testing.T, b []byte) (*BoundedMaps, error) {
+	out, err := decodeBoth(t, b, func() decoder { return new(BoundedMaps) }, nil)
+	return out.(*BoundedMaps), err
+}
+
+func TestMaxEntriesExact(t *testing.T) {
+	out, err := decodeBounded(t, boundedPayload(2, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &BoundedMaps{
+		Strict: map[string]int{"s0": 0, "s1": 1},
+		Drop:   map[string]string{"d0": "value", "d1": "value"},
+		After:  "end",
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %v; want %v", out, want)
+	}
+}
+
+func TestMaxEntriesError(t *testing.T) {
+	_, err := decodeBounded(t, boundedPayload(3, 2))
+	want := msgp.LimitError{Kind: msgp.MapType, Size: 3, Limit: 2}
+	if err != want {
+		t.Errorf("expected %v; got %v", want, err)
+	}
+}
+
+func TestMaxEntriesDrop(t *testing.T) {
+	for _, n := range []int{3, 100} {
+		out, err := decodeBounded(t, boundedPayload(1, n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"d0": "value", "d1": "value"}
+		if !reflect.DeepEqual(out.Drop, want) {
+			t.Errorf("%d entries: kept %v; want %v", n, out.Drop, want)
+		}
+		// the dropped entries are skipped
+		if out.After != "end" {
+			t.Errorf("%d entries: the field after the map is %q", n, out.After)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"strconv"
+	"testing"
+)
+
+func TestNamedBaseWireForm(t *testing.T) {
+	// named base types are written as their
+	// base types, or with their shims
+	tests := []struct {
+		name string
+		v    marshalUnmarshaler
+		want []byte
+	}{
+		{"NamedStr", func() *NamedStr { v := NamedStr("str"); return &v }(), msgp.AppendString(nil, "str")},
+		{"NamedInt", func() *NamedInt { v := NamedInt(-7); return &v }(), msgp.AppendInt(nil, -7)},
+		{"NamedFloat", func() *NamedFloat { v := NamedFloat(1.5); return &v }(), msgp.AppendFloat64(nil, 1.5)},
+		{"MyBool", func() *MyBool { v := MyBool(true); return &v }(), msgp.AppendBool(nil, true)},
+		{"MyEnum", func() *MyEnum { v := C; return &v }(), msgp.AppendString(nil, "C")},
+	}
+	for _, tt := range tests {
+		got, err := tt.v.MarshalMsg(nil)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %x; want %x", tt.name, got, tt.want)
+		}
+		if s := tt.v.(msgp.Sizer).Msgsize(); s < len(got) {
+			t.Errorf("%s: Msgsize() is %d, but the message is %d bytes", tt.name, s, len(got))
+		}
+	}
+}
+
+func TestNamedBaseRoundTrip(t *testing.T) {
+	ins := []NamedInt{1 << 30, -1 << 30}
+	if strconv.IntSize == 64 {
+		big := int64(1 << 40)
+		ins = append(ins, NamedInt(big))
+	}
+	for i := range ins {
+		roundTrip(t, &ins[i], func() decoder { return new(NamedInt) })
+	}
+	e := D
+	roundTrip(t, &e, func() decoder { return new(MyEnum) })
+}
+
+func TestNamedMapKeys(t *testing.T) {
+	in := &NamedKeys{
+		Counts: map[NamedStr]int{"eu": 3},
+		Nested: map[NamedStr]map[NamedStr]string{"us": {"east": "1"}},
+	}
+	bts, _ := roundTrip(t, in, func() decoder { return new(NamedKeys) })
+
+	// the keys are written as plain strings
+	want := msgp.AppendMapHeader(nil, 2)
+	want = msgp.AppendString(want, "counts")
+	want = msgp.AppendMapHeader(want, 1)
+	want = msgp.AppendString(want, "eu")
+	want = msgp.AppendInt(want, 3)
+	want = msgp.AppendString(want, "nested")
+	want = msgp.AppendMapHeader(want, 1)
+	want = msgp.AppendString(want, "us")
+	want = msgp.AppendMapStrStr(want, map[string]string{"east": "1"})
+	if !bytes.Equal(bts, want) {
+		t.Errorf("got %x; want %x", bts, want)
+	}
+}
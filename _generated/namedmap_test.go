@@ -0,0 +1,74 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func testRouted() *Routed {
+	entries := Entries{
+		1: {Name: "one", Tags: []string{"a"}},
+		2: nil,
+	}
+	return &Routed{
+		Headers: Headers{"Content-Type": "text/plain", "X-Id": "7"},
+		Groups:  map[string]Headers{"empty": {}, "one": {"k": "v"}},
+		Tables:  Tables{"t": {"x": 1, "y": 2}},
+		Entries: &entries,
+		Dir:     Directory{"e": {Name: "e", Tags: []string{"b", "c"}}},
+	}
+}
+
+func TestNamedMapRoundTrip(t *testing.T) {
+	roundTrip(t, testRouted(), func() decoder { return new(Routed) })
+}
+
+func TestNamedMapWireForm(t *testing.T) {
+	// a named map is written as the
+	// map it's declared as would be
+	h := Headers{"k": "v"}
+	got, err := h.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := msgp.AppendMapHeader(nil, 1)
+	want = msgp.AppendString(want, "k")
+	want = msgp.AppendString(want, "v")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x; want %x", got, want)
+	}
+
+	// and it decodes nil, replacing the
+	// entries that were there before
+	h = Headers{"old": "entry"}
+	if _, err = h.UnmarshalMsg(msgp.AppendNil(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if h != nil {
+		t.Errorf("decoded nil as %v", h)
+	}
+	h = Headers{"old": "entry"}
+	if err = msgp.Decode(bytes.NewReader(want), &h); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h, Headers{"k": "v"}) {
+		t.Errorf("decoded %v", h)
+	}
+}
+
+func TestNamedMapClone(t *testing.T) {
+	orig := testRouted()
+	cp := orig.Clone()
+	if !reflect.DeepEqual(orig, cp) {
+		t.Fatalf("clone isn't equal:\n%+v\n%+v", orig, cp)
+	}
+	orig.Headers["X-Id"] = "changed"
+	orig.Groups["one"]["k"] = "changed"
+	orig.Tables["t"]["x"] = 100
+	(*orig.Entries)[1].Tags[0] = "changed"
+	if !reflect.DeepEqual(cp, testRouted()) {
+		t.Errorf("clone was changed by mutating the original:\n%+v", cp)
+	}
+}
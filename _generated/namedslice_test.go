@@ -0,0 +1,74 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+func testJournal() *Journal {
+	list := EventList{{Kind: "open", At: 1}, {Kind: "close", At: 2}}
+	return &Journal{
+		Events:  list,
+		Ptr:     &EventList{{Kind: "ptr", At: 3}},
+		ByName:  map[string]EventList{"a": list, "empty": {}},
+		Pending: []EventList{{}, list},
+		Grid:    Matrix{{1, 2}, {3}},
+		Blob:    Blob("blob"),
+	}
+}
+
+func TestNamedSliceRoundTrip(t *testing.T) {
+	roundTrip(t, testJournal(), func() decoder { return new(Journal) })
+}
+
+func TestNamedSliceWireForm(t *testing.T) {
+	// a named slice is written as the
+	// slice it's declared as would be
+	list := EventList{{Kind: "k", At: 1}}
+	got, err := list.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := msgp.AppendArrayHeader(nil, 1)
+	want, err = list[0].MarshalMsg(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("EventList: got %x; want %x", got, want)
+	}
+
+	// and a named []byte as bytes
+	b := Blob("bytes")
+	got, err = b.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want = msgp.AppendBytes(nil, []byte("bytes")); !bytes.Equal(got, want) {
+		t.Errorf("Blob: got %x; want %x", got, want)
+	}
+	var out Blob
+	if _, err = out.UnmarshalMsg(want); err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "bytes" {
+		t.Errorf("Blob: decoded %q", out)
+	}
+}
+
+func TestNamedSliceClone(t *testing.T) {
+	orig := testJournal()
+	cp := orig.Clone()
+	if !reflect.DeepEqual(orig, cp) {
+		t.Fatalf("clone isn't equal:\n%+v\n%+v", orig, cp)
+	}
+	orig.Events[0].Kind = "changed"
+	(*orig.Ptr)[0].At = 100
+	orig.Grid[0][0] = 100
+	orig.Blob[0] = 'B'
+	if !reflect.DeepEqual(cp, testJournal()) {
+		t.Errorf("clone was changed by mutating the original:\n%+v", cp)
+	}
+}
@@ -0,0 +1,123 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestNetworkRoundTrip(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+	tests := map[string]*Network{
+		// the zero value of each address, in
+		// containers that aren't nil, since nil
+		// ones are read back as empty ones
+		"zero": {IPs: []net.IP{nil}, Addrs: map[string]netip.Addr{"none": {}}},
+		"v4": {
+			IP:     net.IP{192, 0, 2, 1},
+			Net:    *v4,
+			Addr:   netip.MustParseAddr("192.0.2.1"),
+			PtrNet: v4,
+			IPs:    []net.IP{{192, 0, 2, 2}, nil},
+			Addrs:  map[string]netip.Addr{"gw": netip.MustParseAddr("192.0.2.254")},
+			Opt:    net.IP{192, 0, 2, 3},
+			OptAdr: netip.MustParseAddr("192.0.2.4"),
+		},
+		"v6": {
+			IP:     net.ParseIP("2001:db8::1"),
+			Net:    *v6,
+			Addr:   netip.MustParseAddr("fe80::1%eth0"),
+			PtrNet: &net.IPNet{},
+			IPs:    []net.IP{net.ParseIP("2001:db8::2")},
+			Addrs:  map[string]netip.Addr{"link": netip.MustParseAddr("fe80::2%eth1")},
+		},
+	}
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			bts, enc := roundTrip(t, in, func() decoder { return new(Network) })
+			if !bytes.Equal(enc, bts) {
+				t.Errorf("EncodeMsg wrote %x; MarshalMsg %x", enc, bts)
+			}
+
+			cp := in.Clone()
+			if !reflect.DeepEqual(in, cp) {
+				t.Errorf("Clone: got %+v; want %+v", cp, in)
+			}
+			if len(in.IP) > 0 && &cp.IP[0] == &in.IP[0] {
+				t.Error("Clone shares the IP")
+			}
+			if len(in.Net.Mask) > 0 && &cp.Net.Mask[0] == &in.Net.Mask[0] {
+				t.Error("Clone shares the mask")
+			}
+		})
+	}
+}
+
+func TestNetworkBadAddress(t *testing.T) {
+	// a 5-byte IP, then the rest of
+	// the struct, which is still read
+	b := msgp.AppendMapHeader(nil, 2)
+	b = msgp.AppendString(b, "ip")
+	b = msgp.AppendBytes(b, []byte{1, 2, 3, 4, 5})
+	b = msgp.AppendString(b, "addr")
+	b = msgp.AppendAddr(b, netip.MustParseAddr("192.0.2.1"))
+
+	var n Network
+	_, err := n.UnmarshalMsg(b)
+	if _, ok := err.(msgp.AddressError); !ok {
+		t.Errorf("got error %v; want an AddressError", err)
+	}
+	err = msgp.Decode(bytes.NewReader(b), &n)
+	if _, ok := err.(msgp.AddressError); !ok {
+		t.Errorf("DecodeMsg: got error %v; want an AddressError", err)
+	}
+}
+
+func TestRouteRoundTrip(t *testing.T) {
+	_, v6, _ := net.ParseCIDR("2001:db8::/48")
+	in := &Route{
+		Via:  Gateway{192, 0, 2, 1},
+		Dest: Subnet(*v6),
+		Hops: []Gateway{{192, 0, 2, 2}, nil},
+		Alt:  &Subnet{},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// they're written as net.IP and net.IPNet are
+	if _, _, err := msgp.ReadIPBytes(bts[1+len("\xa3via"):]); err != nil {
+		t.Errorf("via isn't a net.IP: %s", err)
+	}
+
+	// decoding reuses the memory of the
+	// addresses in the destination
+	via := make(Gateway, net.IPv6len)
+	mask := make(net.IPMask, net.IPv6len)
+	out := &Route{Via: via, Dest: Subnet{Mask: mask}}
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v; want %+v", out, in)
+	}
+	if &out.Via[0] != &via[0] || &out.Dest.Mask[0] != &mask[0] {
+		t.Error("UnmarshalMsg didn't reuse the addresses")
+	}
+
+	out = &Route{Via: via}
+	if err = msgp.Decode(bytes.NewReader(bts), out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, in)
+	}
+	if &out.Via[0] != &via[0] {
+		t.Error("DecodeMsg didn't reuse the address")
+	}
+}
@@ -0,0 +1,102 @@
+package _generated
+
+import (
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+// observer is a type with an
+// UnmarshalMsgObserved method
+type observer interface {
+	msgp.Unmarshaler
+	UnmarshalMsgObserved(bts []byte, obs func(key []byte)) ([]byte, error)
+}
+
+// withKeys returns the map in 'bts' with the key 'first'
+// before its entries and 'last' after them, each with
+// a value that isn't a scalar
+func withKeys(t *testing.T, bts []byte, first, last string) []byte {
+	sz, rest, err := msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := msgp.AppendMapHeader(nil, sz+2)
+	o = msgp.AppendString(o, first)
+	o = msgp.AppendArrayHeader(o, 2)
+	o = msgp.AppendInt(o, 1)
+	o = msgp.AppendMapHeader(o, 0)
+	o = append(o, rest...)
+	o = msgp.AppendString(o, last)
+	o = msgp.AppendMapHeader(o, 1)
+	o = msgp.AppendString(o, "name")
+	return msgp.AppendString(o, "not a field of this type")
+}
+
+func marshaled(t *testing.T, m msgp.Marshaler) []byte {
+	bts, err := m.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bts
+}
+
+func TestUnmarshalMsgObserved(t *testing.T) {
+	v := testVersioned()
+	vt := VersionedTuple(v)
+	acct := &Account{ID: "a1", Tags: map[string]bool{"x": true}}
+	acct.Owner.First, acct.Owner.Last = "Ann", "Lee"
+
+	tests := []struct {
+		name string
+		new  func() observer
+		msg  []byte
+		want []string // the keys reported, in order
+	}{
+		{"no unknown keys", func() observer { return new(Versioned) }, marshaled(t, &v), nil},
+		{"unknown keys", func() observer { return new(Versioned) }, withKeys(t, marshaled(t, &v), "added", "later"), []string{"added", "later"}},
+		{"the tuple form", func() observer { return new(Versioned) }, marshaled(t, &vt), nil},
+		{"a tuple", func() observer { return new(VersionedTuple) }, marshaled(t, &vt), nil},
+		// encodeonly fields are skipped, so they're reported
+		{"an encodeonly field", func() observer { return new(Deprecated) }, withKeys(t, marshaled(t, &Deprecated{Name: "n", Sum: 3}), "added", "later"), []string{"added", "sum", "later"}},
+		// the keys are those of the wire type
+		{"a marshalas type", func() observer { return new(Account) }, withKeys(t, marshaled(t, acct), "ID", "owner"), []string{"ID", "owner"}},
+	}
+	for _, tt := range tests {
+		want := tt.new()
+		left, err := want.UnmarshalMsg(tt.msg)
+		if err != nil {
+			t.Fatalf("%s: UnmarshalMsg: %s", tt.name, err)
+		}
+
+		var keys []string
+		got := tt.new()
+		o, err := got.UnmarshalMsgObserved(tt.msg, func(key []byte) { keys = append(keys, string(key)) })
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(keys, tt.want) {
+			t.Errorf("%s: reported %q; want %q", tt.name, keys, tt.want)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: read %+v; UnmarshalMsg read %+v", tt.name, got, want)
+		}
+		if len(o) != len(left) {
+			t.Errorf("%s: %d bytes left; UnmarshalMsg left %d", tt.name, len(o), len(left))
+		}
+	}
+
+	// errors are those of UnmarshalMsg,
+	// and no keys are reported after them
+	msg := withKeys(t, marshaled(t, &v), "added", "later")
+	short := msg[:len(msg)-3]
+	_, want := new(Versioned).UnmarshalMsg(short)
+	var keys []string
+	_, err := new(Versioned).UnmarshalMsgObserved(short, func(key []byte) { keys = append(keys, string(key)) })
+	if err == nil || err != want {
+		t.Errorf("got error %v; UnmarshalMsg returned %v", err, want)
+	}
+	if len(keys) > 0 {
+		t.Errorf("reported %q after an error", keys)
+	}
+}
@@ -0,0 +1,39 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+)
+
+// TestEncodeMsgOldSpec checks that EncodeMsg, which
+// appends with MarshalMsg, writes what the Write
+// methods of a Writer with EncodeOptions.OldSpec do
+func TestEncodeMsgOldSpec(t *testing.T) {
+	v := TestFast{Lat: 1, Long: 2, Alt: 3, Data: []byte("abc")}
+	opt := msgp.EncodeOptions{OldSpec: true}
+
+	var got bytes.Buffer
+	wr := msgp.NewWriterWithOptions(&got, opt)
+	if err := v.EncodeMsg(wr); err != nil {
+		t.Fatal(err)
+	}
+	wr.Flush()
+
+	var want bytes.Buffer
+	wr = msgp.NewWriterWithOptions(&want, opt)
+	wr.WriteArrayHeader(4) // TestFast is a tuple
+	wr.WriteFloat64(v.Lat)
+	wr.WriteFloat64(v.Long)
+	wr.WriteFloat64(v.Alt)
+	wr.WriteBytes(v.Data)
+	wr.Flush()
+
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("EncodeMsg wrote %x; want %x", got.Bytes(), want.Bytes())
+	}
+	// the []byte is a 'str', not a 'bin'
+	if !bytes.HasSuffix(got.Bytes(), []byte{0xa3, 'a', 'b', 'c'}) {
+		t.Errorf("Data isn't written as a 'str': %x", got.Bytes())
+	}
+}
@@ -0,0 +1,125 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// sparseKeys returns the keys of the map in 'bts',
+// checking that the header counts every entry
+func sparseKeys(t *testing.T, bts []byte) []string {
+	sz, bts, err := msgp.ReadMapHeaderBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for len(bts) > 0 {
+		var key []byte
+		key, bts, err = msgp.ReadMapKeyZC(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, string(key))
+		bts, err = msgp.Skip(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if int(sz) != len(keys) {
+		t.Errorf("the header says %d fields, but %d were written: %q", sz, len(keys), keys)
+	}
+	return keys
+}
+
+func TestOmitEmpty(t *testing.T) {
+	full := func() Sparse {
+		s := Sparse{
+			Name:    "n",
+			Count:   -1,
+			Ratio:   0.5,
+			On:      true,
+			Level:   3,
+			Data:    []byte("d"),
+			Tags:    []string{"t"},
+			Attrs:   map[string]string{"k": "v"},
+			Ptr:     &Event{Kind: "e"},
+			When:    time.Unix(1500000000, 0).UTC(),
+			Any:     "x",
+			Headers: Headers{"h": "v"},
+			Kept:    "k",
+		}
+		s.Inner.X = 1
+		return s
+	}
+	tests := []struct {
+		name string
+		in   Sparse
+		keys []string
+	}{
+		{"empty", Sparse{}, []string{"kept", "inner"}},
+		{"full", full(), []string{"name", "count", "ratio", "on", "level", "data", "tags", "attrs", "ptr", "when", "any", "headers", "kept", "inner"}},
+		{"some", Sparse{Count: 7, On: true, Tags: []string{"a"}}, []string{"count", "on", "tags", "kept", "inner"}},
+		{"decodeonly", Sparse{Old: "old"}, []string{"kept", "inner"}},
+	}
+	for _, tt := range tests {
+		bts, err := tt.in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err = msgp.Encode(&buf, &tt.in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("%s: EncodeMsg wrote %x; MarshalMsg wrote %x", tt.name, buf.Bytes(), bts)
+		}
+		if s := tt.in.Msgsize(); s < len(bts) {
+			t.Errorf("%s: Msgsize is %d, but %d bytes were written", tt.name, s, len(bts))
+		}
+		if keys := sparseKeys(t, bts); !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("%s: keys on the wire are %q; want %q", tt.name, keys, tt.keys)
+		}
+
+		// nothing is lost, but what's
+		// decodeonly, since what's left
+		// out was empty to begin with
+		want := tt.in
+		want.Old = ""
+		var out Sparse
+		if _, err = out.UnmarshalMsg(bts); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("%s: got %+v; want %+v", tt.name, out, want)
+		}
+	}
+
+	// the nested struct counts its own fields
+	for x, want := range map[int][]string{0: {"y"}, 1: {"x", "y"}} {
+		var in Sparse
+		in.Inner.X = x
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, bts, err = msgp.ReadMapHeaderBytes(bts)
+		for err == nil {
+			var key []byte
+			key, bts, err = msgp.ReadMapKeyZC(bts)
+			if string(key) == "inner" {
+				break
+			}
+			bts, err = msgp.Skip(bts)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// it's the last field
+		if keys := sparseKeys(t, bts); !reflect.DeepEqual(keys, want) {
+			t.Errorf("Inner.X = %d: nested keys are %q; want %q", x, keys, want)
+		}
+	}
+}
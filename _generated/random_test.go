@@ -0,0 +1,68 @@
+package _generated
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRandomDeterministic(t *testing.T) {
+	// TestBench has no maps, so the same
+	// value is always the same bytes
+	var first []byte
+	for i := 0; i < 3; i++ {
+		bts, err := RandomTestBench(rand.New(rand.NewSource(42))).MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = bts
+		} else if !bytes.Equal(bts, first) {
+			t.Fatalf("seed 42 was written as %x, then %x", first, bts)
+		}
+	}
+
+	// and other seeds are other values
+	a := RandomVersioned(rand.New(rand.NewSource(1)))
+	b := RandomVersioned(rand.New(rand.NewSource(2)))
+	if reflect.DeepEqual(a, b) {
+		t.Errorf("seeds 1 and 2 both made %+v", a)
+	}
+}
+
+// branchDepth returns the levels of Branches in 'b'
+func branchDepth(b *Branch) int {
+	d := 0
+	for _, c := range b.Children {
+		if c != nil {
+			if cd := branchDepth(c); cd > d {
+				d = cd
+			}
+		}
+	}
+	return d + 1
+}
+
+func TestRandomBounds(t *testing.T) {
+	for seed := int64(0); seed < 64; seed++ {
+		r := rand.New(rand.NewSource(seed))
+
+		// types that contain themselves end, with
+		// zero values below the third level
+		b := RandomBranch(r)
+		if d := branchDepth(b); d > 5 {
+			t.Errorf("seed %d: a Branch %d levels deep", seed, d)
+		}
+		if len(b.Children) > 8 || len(b.Name) > 40*3 {
+			t.Errorf("seed %d: %d children, and a name of %d bytes", seed, len(b.Children), len(b.Name))
+		}
+
+		// maps aren't made bigger
+		// than their maxentries
+		m := RandomBoundedMaps(r)
+		if len(m.Strict) > 2 || len(m.Drop) > 2 {
+			t.Errorf("seed %d: %d and %d entries with maxentries=2", seed, len(m.Strict), len(m.Drop))
+		}
+	}
+}
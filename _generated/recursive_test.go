@@ -0,0 +1,113 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// deepNode returns a Node that recurses
+// through each of its fields 'depth' deep
+func deepNode(depth int) *Node {
+	n := &Node{Name: "n" + strconv.Itoa(depth)}
+	if depth == 0 {
+		return n
+	}
+	// (one entry, so that the encoding
+	// is the same every time)
+	n.Kids = map[string]*Node{"a": deepNode(depth - 1)}
+	n.List = []Node{*deepNode(depth - 1), {}}
+	n.Next = deepNode(depth - 1)
+	n.Tree = &Tree{Root: deepNode(depth - 1), Forest: []Tree{{Root: deepNode(depth - 1)}, {}}}
+	return n
+}
+
+func TestRecursiveMsgsize(t *testing.T) {
+	for depth := 0; depth < 5; depth++ {
+		in := deepNode(depth)
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.Msgsize() < len(bts) {
+			t.Errorf("depth %d: Msgsize is %d, but MarshalMsg wrote %d bytes", depth, in.Msgsize(), len(bts))
+		}
+
+		// (nil slices and maps are read back
+		// empty, so it's the bytes that match)
+		out := new(Node)
+		if _, err = out.UnmarshalMsg(bts); err != nil {
+			t.Fatal(err)
+		}
+		again, err := out.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, bts) {
+			t.Errorf("depth %d: unmarshaled %x, which marshals as %x", depth, bts, again)
+		}
+
+		var buf bytes.Buffer
+		if err = msgp.Encode(&buf, in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("depth %d: EncodeMsg and MarshalMsg differ", depth)
+		}
+	}
+}
+
+// deepBranch returns a tree 'depth' levels deep,
+// in which each branch has two children, and a
+// nil one. The leaves have empty slices, rather
+// than nil ones, which are read back as empty.
+func deepBranch(depth int, name string) *Branch {
+	b := &Branch{Name: name, Children: []*Branch{}}
+	if depth > 0 {
+		b.Children = []*Branch{deepBranch(depth-1, name+"0"), nil, deepBranch(depth-1, name+"1")}
+	}
+	return b
+}
+
+func TestBranchRoundTrip(t *testing.T) {
+	in := deepBranch(6, "b")
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.Msgsize() < len(bts) {
+		t.Errorf("Msgsize is %d, but MarshalMsg wrote %d bytes", in.Msgsize(), len(bts))
+	}
+	out := new(Branch)
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Error("UnmarshalMsg: the tree differs")
+	}
+
+	var buf bytes.Buffer
+	if err = msgp.Encode(&buf, in); err != nil {
+		t.Fatal(err)
+	}
+	out = new(Branch)
+	if err = msgp.Decode(&buf, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Error("DecodeMsg: the tree differs")
+	}
+	if leaf := out.Children[2].Children[0].Children[2].Children[0].Children[2].Children[0]; leaf.Name != "b101010" {
+		t.Errorf("got leaf %q; want %q", leaf.Name, "b101010")
+	}
+
+	cp := in.Clone()
+	if !reflect.DeepEqual(in, cp) {
+		t.Error("Clone: the tree differs")
+	}
+	if cp.Children[0].Children[0] == in.Children[0].Children[0] {
+		t.Error("Clone shares branches")
+	}
+}
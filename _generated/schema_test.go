@@ -0,0 +1,17 @@
+package _generated
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSchemaHash(t *testing.T) {
+	sum := sha256.Sum256([]byte(TestTypeSchema()))
+	if h := "sha256:" + hex.EncodeToString(sum[:]); h != TestTypeSchemaHash {
+		t.Errorf("TestTypeSchemaHash is %s; the hash of TestTypeSchema() is %s", TestTypeSchemaHash, h)
+	}
+	if TestTypeSchemaHash == TestBenchSchemaHash {
+		t.Error("different types have the same hash")
+	}
+}
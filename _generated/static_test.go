@@ -0,0 +1,124 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+)
+
+func allFlags() *Flags {
+	return &Flags{
+		F00: true, F03: true, F04: true, F07: true,
+		F10: true, F15: true, F16: true, F21: true,
+		F22: true, F28: true, F31: true,
+	}
+}
+
+// MarshalMsg writes bools and field keys in
+// batches; EncodeMsg writes them one at a time.
+// Their output should be identical.
+func TestStaticAppendsMatchEncode(t *testing.T) {
+	on := true
+	objs := []interface {
+		msgp.Marshaler
+		msgp.Encodable
+	}{
+		allFlags(),
+		&Flags{},
+		&MixedFlags{On: true, Name: "name", Named: true, Last: true},
+		&MixedFlags{Ptr: &on, Off: true},
+		&TupleFlags{A: true, N: -300, C: true},
+	}
+	for _, v := range objs {
+		// start with a short, non-empty prefix
+		// so that the batches have to grow it
+		prefix := []byte{0xc0}
+		bts, err := v.MarshalMsg(prefix[:1:1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		buf.WriteByte(0xc0)
+		if err := msgp.Encode(&buf, v); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bts, buf.Bytes()) {
+			t.Errorf("%T: MarshalMsg and EncodeMsg disagree:\n%x\n%x", v, bts, buf.Bytes())
+		}
+	}
+}
+
+func TestStaticAppendsRoundTrip(t *testing.T) {
+	in := allFlags()
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := new(Flags)
+	left, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left over", len(left))
+	}
+	if *out != *in {
+		t.Errorf("got %+v; want %+v", out, in)
+	}
+
+	on := true
+	mixed := &MixedFlags{On: true, Name: "name", Named: true, Ptr: &on, Last: true}
+	bts, err = mixed.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mout := new(MixedFlags)
+	if _, err = mout.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if mout.On != mixed.On || mout.Name != mixed.Name || mout.Named != mixed.Named ||
+		mout.Off != mixed.Off || mout.Ptr == nil || !*mout.Ptr || mout.Last != mixed.Last {
+		t.Errorf("got %+v; want %+v", mout, mixed)
+	}
+}
+
+func BenchmarkFlagsMarshal(b *testing.B) {
+	v := allFlags()
+	bts := make([]byte, 0, v.Msgsize())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bts, _ = v.MarshalMsg(bts[:0])
+	}
+	b.SetBytes(int64(len(bts)))
+}
+
+// BenchmarkFlagsAppend appends the same
+// fields one object at a time, as MarshalMsg
+// did before batching, for comparison.
+func BenchmarkFlagsAppend(b *testing.B) {
+	v := allFlags()
+	bts := make([]byte, 0, v.Msgsize())
+	fields := []bool{
+		v.F00, v.F01, v.F02, v.F03, v.F04, v.F05, v.F06, v.F07,
+		v.F08, v.F09, v.F10, v.F11, v.F12, v.F13, v.F14, v.F15,
+		v.F16, v.F17, v.F18, v.F19, v.F20, v.F21, v.F22, v.F23,
+		v.F24, v.F25, v.F26, v.F27, v.F28, v.F29, v.F30, v.F31,
+	}
+	keys := []string{
+		"f00", "f01", "f02", "f03", "f04", "f05", "f06", "f07",
+		"f08", "f09", "f10", "f11", "f12", "f13", "f14", "f15",
+		"f16", "f17", "f18", "f19", "f20", "f21", "f22", "f23",
+		"f24", "f25", "f26", "f27", "f28", "f29", "f30", "f31",
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bts = msgp.AppendMapHeader(bts[:0], 32)
+		for j := range fields {
+			bts = msgp.AppendString(bts, keys[j])
+			bts = msgp.AppendBool(bts, fields[j])
+		}
+	}
+	b.SetBytes(int64(len(bts)))
+}
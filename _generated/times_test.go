@@ -0,0 +1,95 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+	"time"
+)
+
+// equalTimes compares the times in 'a' and
+// 'b' with time.Time.Equal, since decoding
+// doesn't keep the monotonic clock reading
+func equalTimes(a, b *Times) bool {
+	if (a.Ptr == nil) != (b.Ptr == nil) || (a.Ptr != nil && !a.Ptr.Equal(*b.Ptr)) {
+		return false
+	}
+	if len(a.Slice) != len(b.Slice) || len(a.Map) != len(b.Map) || len(a.Ptrs) != len(b.Ptrs) {
+		return false
+	}
+	for i := range a.Slice {
+		if !a.Slice[i].Equal(b.Slice[i]) {
+			return false
+		}
+	}
+	for k, v := range a.Map {
+		if w, ok := b.Map[k]; !ok || !v.Equal(w) {
+			return false
+		}
+	}
+	for i := range a.Array {
+		if !a.Array[i].Equal(b.Array[i]) {
+			return false
+		}
+	}
+	for i := range a.Ptrs {
+		p, q := a.Ptrs[i], b.Ptrs[i]
+		if (p == nil) != (q == nil) || (p != nil && !p.Equal(*q)) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTimesRoundTrip(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Hour).UTC()
+	for _, in := range []Times{
+		{},
+		// a nil *time.Time and empty containers
+		{Slice: []time.Time{}, Map: map[string]time.Time{}, Ptrs: []*time.Time{}},
+		{
+			Ptr:   &now,
+			Slice: []time.Time{now, later, {}},
+			// one entry, since the entries of
+			// a map are written in no set order
+			Map:   map[string]time.Time{"now": now},
+			Array: [2]time.Time{later, now},
+			Ptrs:  []*time.Time{&later, nil, &now},
+		},
+	} {
+		b, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > in.Msgsize() {
+			t.Errorf("Msgsize is %d, but %d bytes were written", in.Msgsize(), len(b))
+		}
+		if in.Ptr == nil && !msgp.IsNil(msgp.Locate("ptr", b)) {
+			t.Errorf("a nil *time.Time was written as %x", msgp.Locate("ptr", b))
+		}
+
+		var out Times
+		if _, err = out.UnmarshalMsg(b); err != nil {
+			t.Fatal(err)
+		}
+		if !equalTimes(&in, &out) {
+			t.Errorf("unmarshaled %v as %v", in, out)
+		}
+
+		var buf bytes.Buffer
+		if err = msgp.Encode(&buf, &in); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Errorf("EncodeMsg wrote %x; MarshalMsg %x", buf.Bytes(), b)
+		}
+		out = Times{}
+		if err = msgp.Decode(&buf, &out); err != nil {
+			t.Fatal(err)
+		}
+		if !equalTimes(&in, &out) {
+			t.Errorf("decoded %v as %v", in, out)
+		}
+	}
+}
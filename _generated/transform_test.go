@@ -0,0 +1,120 @@
+package _generated
+
+import (
+	"bytes"
+	"errors"
+	"github.com/philhofer/msgp/msgp"
+	"reflect"
+	"testing"
+)
+
+// xor is a reversible "cipher"
+func xor(b []byte) ([]byte, error) {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ 0x5a
+	}
+	return out, nil
+}
+
+// sealTag stands in for a MAC
+var sealTag = bytes.Repeat([]byte{0xee}, 32)
+
+// seal appends sealTag, so that its
+// output is larger than its input
+func seal(b []byte) ([]byte, error) {
+	return append(append([]byte(nil), b...), sealTag...), nil
+}
+
+func unseal(b []byte) ([]byte, error) {
+	if !bytes.HasSuffix(b, sealTag) {
+		return nil, errors.New("not sealed")
+	}
+	return b[:len(b)-len(sealTag)], nil
+}
+
+func init() {
+	msgp.RegisterTransform("pii", xor, xor)
+	msgp.RegisterTransform("seal", seal, unseal)
+	msgp.RegisterTransformSize("seal", func(n int) int { return n + len(sealTag) })
+}
+
+func TestTransformRoundTrip(t *testing.T) {
+	in := &PII{
+		Name:  "Joe",
+		SSN:   "123-45-6789",
+		Age:   42,
+		Phone: CustomBytes("555-0100"),
+		Fast:  &TestFast{Lat: 1, Long: 2, Alt: 3, Data: []byte("data")},
+	}
+
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(bts, []byte(in.SSN)) {
+		t.Error("SSN was not transformed")
+	}
+	if !bytes.Contains(bts, []byte(in.Name)) {
+		t.Error("untransformed name should be readable")
+	}
+
+	// transformed fields are written as 'bin'
+	raw := msgp.Locate("ssn", bts)
+	if _, _, err := msgp.ReadBytesZC(raw); err != nil {
+		t.Errorf("ssn is not 'bin': %s", err)
+	}
+
+	out := new(PII)
+	left, err := out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left", len(left))
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("UnmarshalMsg: %v in; %v out", in, out)
+	}
+
+	var buf bytes.Buffer
+	err = msgp.Encode(&buf, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), bts) {
+		t.Error("EncodeMsg and MarshalMsg produced different output")
+	}
+	out = new(PII)
+	err = msgp.Decode(&buf, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: %v in; %v out", in, out)
+	}
+}
+
+// TestTransformSize checks that Msgsize counts
+// what a transform adds to the size of a field
+func TestTransformSize(t *testing.T) {
+	for _, in := range []*Sealed{
+		{},
+		{Note: "a note", Fast: &TestFast{Lat: 1, Long: 2, Alt: 3, Data: []byte("data")}},
+	} {
+		bts, err := in.MarshalMsg(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.Msgsize() < len(bts) {
+			t.Errorf("Msgsize() is %d; the encoded size is %d", in.Msgsize(), len(bts))
+		}
+		out := new(Sealed)
+		if _, err := out.UnmarshalMsg(bts); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("%v in; %v out", in, out)
+		}
+	}
+}
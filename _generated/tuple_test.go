@@ -0,0 +1,79 @@
+package _generated
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/philhofer/msgp/msgp"
+)
+
+func TestTupleDirective(t *testing.T) {
+	in := Series{
+		Name:    "cpu",
+		Samples: []Sample{{At: 1, Value: 0.5, Label: "a"}, {At: 2, Value: 0.25}},
+		Last:    &Sample{At: 2, Value: 0.25},
+		ByLabel: map[string]Sample{"a": {At: 1, Value: 0.5, Label: "a"}},
+	}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := msgp.NextType(bts); typ != msgp.MapType {
+		t.Fatalf("Series is a %s", typ)
+	}
+
+	// a Sample is its fields in order
+	b, err := in.Last.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := msgp.AppendArrayHeader(nil, 3)
+	want = msgp.AppendInt64(want, 2)
+	want = msgp.AppendFloat64(want, 0.25)
+	want = msgp.AppendString(want, "")
+	if !bytes.Equal(b, want) {
+		t.Errorf("Sample is %x; want %x", b, want)
+	}
+
+	var out Series
+	if _, err := out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got %+v; want %+v", out, in)
+	}
+	out = Series{}
+	if err := msgp.Decode(bytes.NewReader(bts), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("DecodeMsg: got %+v; want %+v", out, in)
+	}
+}
+
+func TestTupleSize(t *testing.T) {
+	// a Sample of 2 fields, in a Series
+	short := msgp.AppendArrayHeader(nil, 2)
+	short = msgp.AppendInt64(short, 1)
+	short = msgp.AppendFloat64(short, 0.5)
+	msg := msgp.AppendMapHeader(nil, 1)
+	msg = msgp.AppendString(msg, "last")
+	msg = append(msg, short...)
+
+	var s Sample
+	_, err := s.UnmarshalMsg(short)
+	if aerr, ok := err.(msgp.ArrayError); !ok || aerr.Wanted != 3 || aerr.Got != 2 {
+		t.Errorf("got %v; want ArrayError{Wanted: 3, Got: 2}", err)
+	}
+	var ser Series
+	_, err = ser.UnmarshalMsg(msg)
+	if _, ok := err.(msgp.ArrayError); !ok || !strings.Contains(err.Error(), "Series.last") {
+		t.Errorf("got %v; want an ArrayError about Series.last", err)
+	}
+	err = msgp.Decode(bytes.NewReader(msg), &ser)
+	if _, ok := err.(msgp.ArrayError); !ok || !strings.Contains(err.Error(), "Series.last") {
+		t.Errorf("DecodeMsg: got %v; want an ArrayError about Series.last", err)
+	}
+}
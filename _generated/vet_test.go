@@ -0,0 +1,140 @@
+//go:build msgp_vet
+// +build msgp_vet
+
+// The analyzers come from golang.org/x/tools, which
+// the other tests don't need, so this file is only
+// built with the msgp_vet tag (make vet).
+
+package _generated
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/analysis/passes/assign"
+	"golang.org/x/tools/go/analysis/passes/nilness"
+	"golang.org/x/tools/go/analysis/passes/shadow"
+	"golang.org/x/tools/go/analysis/passes/unreachable"
+	"golang.org/x/tools/go/analysis/passes/unusedresult"
+	"golang.org/x/tools/go/analysis/passes/unusedwrite"
+	"golang.org/x/tools/go/packages"
+)
+
+// the files written by the generator;
+// hand-written tests aren't checked
+var generatedFiles = map[string]bool{
+	"generated.go":      true,
+	"generated_test.go": true,
+}
+
+// blankAnalyzer reports temporaries that are only
+// declared to be thrown away, which the compiler
+// lets through but linters complain about
+var blankAnalyzer = &analysis.Analyzer{
+	Name: "blank",
+	Doc:  "report '_ = local' statements and blank range values",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.AssignStmt:
+					if len(n.Lhs) != 1 || len(n.Rhs) != 1 || !isBlank(n.Lhs[0]) {
+						break
+					}
+					id, ok := n.Rhs[0].(*ast.Ident)
+					if !ok {
+						break
+					}
+					if v, ok := pass.TypesInfo.Uses[id].(*types.Var); ok && v.Parent() != v.Pkg().Scope() {
+						pass.Reportf(n.Pos(), "%s is only assigned to _", id.Name)
+					}
+				case *ast.RangeStmt:
+					if n.Value != nil && isBlank(n.Value) {
+						pass.Reportf(n.Value.Pos(), "blank range value")
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+func isBlank(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == "_"
+}
+
+// TestGeneratedVet runs vet's analyzers, with
+// strict shadowing, over the generated code
+func TestGeneratedVet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping analysis in short mode")
+	}
+	if err := shadow.Analyzer.Flags.Set("strict", "true"); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &packages.Config{
+		Mode:  packages.LoadAllSyntax,
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		t.Fatal("couldn't load the package")
+	}
+	analyzers := []*analysis.Analyzer{
+		assign.Analyzer,
+		nilness.Analyzer,
+		shadow.Analyzer,
+		unreachable.Analyzer,
+		unusedresult.Analyzer,
+		unusedwrite.Analyzer,
+		blankAnalyzer,
+	}
+	graph, err := checker.Analyze(analyzers, pkgs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the test variant of the package repeats
+	// the diagnostics of the package itself
+	found := make(map[string]bool)
+	for act := range graph.All() {
+		if !act.IsRoot {
+			continue
+		}
+		if act.Err != nil {
+			t.Errorf("%s: %s", act, act.Err)
+			continue
+		}
+		for _, d := range act.Diagnostics {
+			pos := act.Package.Fset.Position(d.Pos)
+			if !generatedFiles[filepath.Base(pos.Filename)] {
+				continue
+			}
+			found[posString(pos)+": "+d.Message+" ("+act.Analyzer.Name+")"] = true
+		}
+	}
+	msgs := make([]string, 0, len(found))
+	for msg := range found {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+	for _, msg := range msgs {
+		t.Error(msg)
+	}
+}
+
+func posString(pos token.Position) string {
+	pos.Filename = filepath.Base(pos.Filename)
+	return pos.String()
+}
@@ -0,0 +1,65 @@
+package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+	"testing"
+)
+
+func TestWriterBuf(t *testing.T) {
+	v := cloneTestType()
+	want, err := v.MarshalMsg([]byte("prefix"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wr := msgp.NewWriterBuf([]byte("prefix"))
+	if err = v.EncodeMsg(wr); err != nil {
+		t.Fatal(err)
+	}
+	wr.Flush()
+	if !bytes.Equal(wr.Bytes(), want) {
+		t.Errorf("NewWriterBuf wrote\n%x\nMarshalMsg wrote\n%x", wr.Bytes(), want)
+	}
+}
+
+// The next three benchmarks write a mid-size
+// struct to memory through a Writer and a
+// bytes.Buffer, a Writer from NewWriterBuf,
+// and MarshalMsg.
+
+func BenchmarkWriterBuffer(b *testing.B) {
+	v := cloneTestType()
+	var buf bytes.Buffer
+	wr := msgp.NewWriter(&buf)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		v.EncodeMsg(wr)
+		wr.Flush()
+	}
+	b.SetBytes(int64(buf.Len()))
+}
+
+func BenchmarkWriterBuf(b *testing.B) {
+	v := cloneTestType()
+	wr := msgp.NewWriterBuf(make([]byte, 0, v.Msgsize()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wr.Reset(nil)
+		v.EncodeMsg(wr)
+	}
+	b.SetBytes(int64(len(wr.Bytes())))
+}
+
+func BenchmarkWriterAppend(b *testing.B) {
+	v := cloneTestType()
+	bts := make([]byte, 0, v.Msgsize())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bts, _ = v.MarshalMsg(bts[:0])
+	}
+	b.SetBytes(int64(len(bts)))
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"fmt"
+	"github.com/philhofer/msgp/gen"
+	"github.com/philhofer/msgp/msgp"
+	"github.com/philhofer/msgp/parse"
+	"github.com/ttacon/chalk"
+	"strconv"
+	"unicode"
+)
+
+// severities of findings; under -strict,
+// an "error" fails generation
+const (
+	sevWarning = "warning"
+	sevError   = "error"
+)
+
+// maxTagLen is the longest field tag that
+// doesn't draw a finding on a type that's
+// written many times per message
+const maxTagLen = 24
+
+// a rule is one check of -analyze. To add one,
+// write its check and add it to 'rules'.
+type rule struct {
+	name     string
+	severity string
+
+	// check calls 'report' for each problem
+	// with the named type 't' (a struct, or
+	// a named slice) that it finds
+	check func(a *analysis, t gen.Elem, report func(field string, format string, v ...interface{}))
+}
+
+var rules = []rule{
+	{"long-tag", sevWarning, checkLongTags},
+	{"key-overhead", sevWarning, checkKeyOverhead},
+	{"float-counter", sevError, checkFloatCounters},
+	{"one-field-elements", sevWarning, checkOneFieldElements},
+}
+
+// a finding is a problem that a rule
+// found, at the type or field it's about
+type finding struct {
+	parse.Warning
+	Rule     string
+	Severity string
+}
+
+func (f finding) String() string {
+	return fmt.Sprintf("%s: %s [%s]", f.Severity, f.Warning, f.Rule)
+}
+
+// analysis is what the rules know
+// about the types being generated
+type analysis struct {
+	structs map[string]*gen.Struct // by name
+
+	// repeated holds the types that are elements of
+	// slices, arrays or maps, and so are written many
+	// times per message, with where they're listed
+	repeated map[string]string
+}
+
+// analyzeTypes runs every rule on the types in 'elems'
+// and returns what they find, in the order of the
+// types, and then of the rules
+func analyzeTypes(fs *parse.FileSet, elems []gen.Elem) []finding {
+	a := &analysis{
+		structs:  make(map[string]*gen.Struct),
+		repeated: make(map[string]string),
+	}
+	var types []gen.Elem
+	for _, el := range elems {
+		p, ok := el.(*gen.Ptr)
+		if !ok {
+			continue
+		}
+		switch v := p.Value.(type) {
+		case *gen.Struct:
+			a.structs[v.Name] = v
+			for _, f := range v.Fields {
+				a.findRepeated(f.FieldElem, v.Name+"."+f.FieldName, false)
+			}
+		case *gen.Slice, *gen.Map:
+			a.findRepeated(v, v.TypeName(), false)
+		default:
+			continue
+		}
+		types = append(types, p.Value)
+	}
+
+	var out []finding
+	for _, t := range types {
+		name := t.TypeName()
+		for _, r := range rules {
+			r.check(a, t, func(field string, format string, v ...interface{}) {
+				out = append(out, finding{
+					Warning: parse.Warning{
+						Pos:   fs.Position(name, field),
+						Type:  name,
+						Field: field,
+						Err:   fmt.Errorf(format, v...),
+					},
+					Rule:     r.name,
+					Severity: r.severity,
+				})
+			})
+		}
+	}
+	return out
+}
+
+// reportFindings prints the findings, and returns an
+// error if there are errors among them under -strict
+func reportFindings(findings []finding) error {
+	var errs int
+	for _, f := range findings {
+		if f.Severity == sevError {
+			errs++
+			printf(chalk.Red, "%s\n", f.String())
+		} else {
+			printf(chalk.Yellow, "%s\n", f.String())
+		}
+	}
+	if strict && errs > 0 {
+		return fmt.Errorf("-analyze: %d error(s) under -strict", errs)
+	}
+	return nil
+}
+
+// findRepeated records the named types in 'e' that are
+// in a slice, array or map ('in' is whether or not 'e'
+// itself is), where 'where' is the field or type that
+// lists them
+func (a *analysis) findRepeated(e gen.Elem, where string, in bool) {
+	switch e := e.(type) {
+	case *gen.Ptr:
+		a.findRepeated(e.Value, where, in)
+	case *gen.Slice:
+		a.findRepeated(e.Els, where, true)
+	case *gen.Array:
+		a.findRepeated(e.Els, where, true)
+	case *gen.Map:
+		a.findRepeated(e.Value, where, true)
+	case *gen.Struct:
+		for _, f := range e.Fields {
+			a.findRepeated(f.FieldElem, where, in)
+		}
+	case *gen.BaseElem:
+		if in && e.Value == gen.IDENT {
+			if _, ok := a.repeated[e.Ident]; !ok {
+				a.repeated[e.Ident] = where
+			}
+		}
+	}
+}
+
+// checkLongTags finds tags longer than maxTagLen
+// on types that are written many times per message
+func checkLongTags(a *analysis, t gen.Elem, report func(string, string, ...interface{})) {
+	s, ok := t.(*gen.Struct)
+	if !ok || s.AsTuple || s.MarshalAs != "" {
+		return
+	}
+	where, ok := a.repeated[s.Name]
+	if !ok {
+		return
+	}
+	for _, f := range s.EncodedFields() {
+		if len(f.FieldTag) > maxTagLen {
+			report(f.FieldName, "tag %q is %d bytes, and is written with every %s in %s; a shorter tag would save them each time", f.FieldTag, len(f.FieldTag), s.Name, where)
+		}
+	}
+}
+
+// checkKeyOverhead finds structs whose keys are more
+// than half of the smallest encoding of the struct
+// (in which omitempty fields are left out)
+func checkKeyOverhead(a *analysis, t gen.Elem, report func(string, string, ...interface{})) {
+	s, ok := t.(*gen.Struct)
+	if !ok || s.AsTuple || s.MarshalAs != "" {
+		return
+	}
+	var keys int
+	for _, f := range s.EncodedFields() {
+		if !f.OmitEmpty {
+			keys += msgp.StringSize(f.FieldTag)
+		}
+	}
+	min := a.minSize(s, make(map[string]bool))
+	if keys*2 > min {
+		report("", "its keys are %d of the %d bytes of its smallest encoding; as a tuple (//msgp:tuple %s), it would leave them out", keys, min, s.Name)
+	}
+}
+
+// counterWords are the words that, at the end of a
+// field name or tag, say that it counts something.
+// Words like "total" and "index" are left out, since
+// a TotalPrice or a PriceIndex is rightly a float.
+var counterWords = map[string]bool{
+	"count":    true,
+	"counter":  true,
+	"retries":  true,
+	"attempts": true,
+	"tries":    true,
+	"hits":     true,
+	"misses":   true,
+	"idx":      true,
+	"seq":      true,
+}
+
+// checkFloatCounters finds floats whose names say
+// that they're counters, which are small integers
+func checkFloatCounters(a *analysis, t gen.Elem, report func(string, string, ...interface{})) {
+	s, ok := t.(*gen.Struct)
+	if !ok || s.MarshalAs != "" {
+		return
+	}
+	for _, f := range s.EncodedFields() {
+		b := deref(f.FieldElem).Base()
+		if b == nil || (b.Value != gen.Float64 && b.Value != gen.Float32) || b.ShimToBase != "" {
+			continue
+		}
+		if isCounter(f.FieldName) || isCounter(f.FieldTag) {
+			size := msgp.Float64Size
+			if b.Value == gen.Float32 {
+				size = msgp.Float32Size
+			}
+			report(f.FieldName, "is a %s, but is named like a counter; an integer is 1 byte when it's small, where a %s is always %d", b.TypeName(), b.TypeName(), size)
+		}
+	}
+}
+
+// checkOneFieldElements finds lists of structs with
+// only one field, where the key and map header of
+// each element could be left out by listing the
+// field instead
+func checkOneFieldElements(a *analysis, t gen.Elem, report func(string, string, ...interface{})) {
+	check := func(field string, e gen.Elem) {
+		var els gen.Elem
+		switch e := deref(e).(type) {
+		case *gen.Slice:
+			els = e.Els
+		case *gen.Array:
+			els = e.Els
+		default:
+			return
+		}
+		s := a.structOf(deref(els))
+		if s == nil || s.MarshalAs != "" {
+			return
+		}
+		if fields := s.EncodedFields(); len(fields) == 1 {
+			report(field, "is a list of %s, which has only the field %s; a list of %s would leave out the header of each element", s.TypeName(), fields[0].FieldName, fields[0].FieldElem.TypeName())
+		}
+	}
+	switch t := t.(type) {
+	case *gen.Struct:
+		for _, f := range t.EncodedFields() {
+			check(f.FieldName, f.FieldElem)
+		}
+	case *gen.Slice:
+		check("", t)
+	}
+}
+
+// structOf returns the struct that 'e' is,
+// or names, if it's one of the types here
+func (a *analysis) structOf(e gen.Elem) *gen.Struct {
+	switch e := e.(type) {
+	case *gen.Struct:
+		return e
+	case *gen.BaseElem:
+		if e.Value == gen.IDENT {
+			return a.structs[e.Ident]
+		}
+	}
+	return nil
+}
+
+// minSize returns the size of the smallest encoding
+// of 'e'; 'seen' holds the structs that are already
+// being sized, which recursive types come back to
+func (a *analysis) minSize(e gen.Elem, seen map[string]bool) int {
+	switch e := e.(type) {
+	case *gen.Array:
+		n, _ := strconv.Atoi(e.Size)
+		return msgp.ArrayHeaderSizeFor(uint32(n)) + n*a.minSize(e.Els, seen)
+	case *gen.Struct:
+		if e.Name != "" {
+			if seen[e.Name] {
+				return 1
+			}
+			seen[e.Name] = true
+			defer delete(seen, e.Name)
+		}
+		n := e.KeysSize()
+		for _, f := range e.EncodedFields() {
+			if !f.OmitEmpty {
+				n += a.minSize(f.FieldElem, seen)
+			} else if !e.AsTuple {
+				n -= msgp.StringSize(f.FieldTag)
+			}
+		}
+		return n
+	case *gen.BaseElem:
+		if e.ShimToBase != "" || e.Transform != "" || e.IsEpoch() {
+			return 1
+		}
+		switch e.Value {
+		case gen.Float32:
+			return msgp.Float32Size
+		case gen.Float64:
+			return msgp.Float64Size
+		case gen.Complex64:
+			return msgp.Complex64Size
+		case gen.Complex128:
+			return msgp.Complex128Size
+		case gen.Time:
+			return msgp.TimeSize
+		case gen.IDENT:
+			if s := a.structs[e.Ident]; s != nil {
+				return a.minSize(s, seen)
+			}
+		}
+		return 1
+	default:
+		// nil, or an empty
+		// slice or map
+		return 1
+	}
+}
+
+// deref returns what 'e' points to, if it's a pointer
+func deref(e gen.Elem) gen.Elem {
+	for {
+		p, ok := e.(*gen.Ptr)
+		if !ok {
+			return e
+		}
+		e = p.Value
+	}
+}
+
+// isCounter returns whether or not 'name' ends
+// in a counterWord, or starts with "num", as in
+// NumRetries or NumItems
+func isCounter(name string) bool {
+	w := words(name)
+	return len(w) > 0 && (counterWords[w[len(w)-1]] || w[0] == "num" && len(w) > 1)
+}
+
+// words splits a field name or tag into lower-case words,
+// at underscores, dashes, dots and changes of case
+func words(name string) []string {
+	var (
+		out  []string
+		word []rune
+	)
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == '.':
+			out, word = appendWord(out, word), nil
+			continue
+		case unicode.IsUpper(r) && i > 0 &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])):
+			out, word = appendWord(out, word), nil
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	return appendWord(out, word)
+}
+
+func appendWord(out []string, word []rune) []string {
+	if len(word) > 0 {
+		out = append(out, string(word))
+	}
+	return out
+}
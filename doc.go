@@ -12,12 +12,83 @@
 // the generator to execute without any command-line flags. However, the
 // following options are supported, if you need them:
 //
-//  -o = output file name (default is {filename}_gen.go)
-//  -file = input file name (default is $GOPATH/src/$GOPACKAGE/$GOFILE, which are set by the `go generate` command)
-//  -pkg = output package name (default is $GOPACKAGE)
-//  -io = satisfy the `msgp.Decodable` and `msgp.Encodable` interfaces (default is true)
-//  -marshal = satisfy the `msgp.Marshaler` and `msgp.Unmarshaler` interfaces (default is true)
-//  -tests = generate tests and benchmarks (default is true)
+//  -o = output file name, or a directory (see below) (default is {filename}_gen.go)
+//  -file = input file name (default is $GOPATH/src/$GOPACKAGE/$GOFILE, which are set by the `go generate` command); also a directory, or a comma-separated list of files and glob patterns (like msg_*.go) in one package, which are generated into {package}_gen.go; types declared in the package's other files are known, but no methods are generated for them
+//  -pkg = output package name, or the import path of a package to generate (see below) (default is $GOPACKAGE)
+//  -io = satisfy the `msgp.Decodable` and `msgp.Encodable` interfaces; with -marshal, EncodeMsg appends to the Writer's buffer with MarshalMsg, so that the two write the same bytes from the same code (default is true)
+//  -marshal = satisfy the `msgp.Marshaler`, `msgp.Unmarshaler` and `msgp.Sizer` interfaces (default is true)
+//  -tests = create {output}_test.go, with a round-trip test of each type through EncodeMsg and DecodeMsg (with -io) and through MarshalMsg and UnmarshalMsg (with -marshal), made from its zero value with new(T), and benchmarks of each of those methods that report allocations; -tests=false leaves the file out, for output that's vendored (default is true)
+//  -strict = fail on unknown or malformed struct tag options, fields that are skipped because their types aren't supported, and unresolved identifiers, listing each of them, instead of warning about them (default is false)
+//  -import = import path of the msgp runtime package (default is the path this tool was built against)
+//  -clone = create deep-copying Clone and CopyTo methods; types referenced by name must have them, too (default is false)
+//  -schema = create a {Type}SchemaHash constant and {Type}Schema function for each type, for checking at runtime that two programs agree on its fields (default is false)
+//  -descriptors = create a {Type}Descriptor variable (a msgp.TypeDescriptor) for each struct, which lists its fields as they're written: tags, wire types, and options, leaving out skipped fields, for tooling that works on encoded messages (default is false)
+//  -method-suffix = append a suffix to the names of the generated methods (MarshalMsgMP, etc., for MP), and to the methods they call on other types, to avoid collisions; a Msgp{suffix} method returns them as a msgp.Funcs, which has the usual names (default is no suffix)
+//  -split = split the methods of structs with more than N fields into unexported helper methods (encodeFieldGroup1, etc.) of at most N fields each, which compile faster than one huge function; the output encodes and decodes the same; 0 never splits (default is 100)
+//  -nocheck = don't type-check the generated file with the rest of its package before writing it (default is false)
+//  -nojson = name fields that have no msg tag by their Go names; otherwise, such a field that has a json tag is named by it, without its options, and `json:"-"` fields are skipped (default is false)
+//  -unexported = generate methods for unexported types, too, and read and write unexported fields, which are otherwise left out; the generated file is in the same package, so it can get at them (blank fields are still left out) (default is false)
+//  -analyze = print findings, with a severity, about types that waste space on the wire: long tags on types that are listed, keys that are most of a struct's smallest encoding, floats named like counters, and lists of one-field structs; under -strict, a finding of severity "error" fails generation (default is false)
+//  -golden = create {output}_golden_test.go, with a test of each type that marshals its zero value and a sample made from a seed, and compares the bytes to golden files in the given directory (default is none)
+//  -random = create {output}_random_test.go, with a Random{Type}(*rand.Rand) function for each type, which fills every field it can with short random values (strings and slices of up to 40 characters and 8 elements, types that contain themselves a few levels deep), the same ones for the same seed, for property tests and fuzz corpora; the generated tests encode and decode values from it, made from several seeds, instead of zero values; needs -tests (default is false)
+//  -fuzz = create {output}_fuzz_test.go, with a Fuzz{Type}(*testing.F) test of each type for go test -fuzz, which seeds the corpus with the encodings of its zero value and a seed value, made as -golden makes samples, and decodes mutations of them with UnmarshalMsg and DecodeMsg, failing on a panic or an error that isn't a msgp.Error (or io.EOF or io.ErrUnexpectedEOF from DecodeMsg's reader); without -fuzz on the go test command line, it only decodes the seeds (default is false)
+//  -maxbytes = fail if the generated file would be larger than N bytes, listing the types whose methods take up the most of it, so that a package's generated code can't grow past a budget unnoticed (default is 0, no limit)
+//  -observe = create an UnmarshalMsgObserved method for each struct, which is UnmarshalMsg, but also calls a func([]byte) with the key of each map entry it skipped because the struct has no such field (not those skipped in its fields' maps), for noticing fields that a newer writer added (default is false)
+//  -batch = create an Unmarshal{Type}Batch(bts []byte, fn func(*Type) error) function for each type, which unmarshals the messages that 'bts' holds one after another into one value, reset before each, and calls fn with it, stopping at the first error, as msgp.UnmarshalBatch does with a new value for each; fn has to copy what it keeps (default is false)
+//  -clean = when the input has no types to generate methods for (only constants, functions or aliases, say), remove the files that an earlier run generated for it (the methods, tests, golden tests, random values and fuzz tests), so that the methods of deleted types don't break the build; files without the generated header are left alone; either way, nothing is written (default is false)
+//  -q = only print warnings and errors (the default if stdout isn't a terminal)
+//  -v = also print each type and output file as it's processed (the default if stdout is a terminal)
+//
+// If -o names a directory, one that exists or a path that ends
+// in a separator, the output is {filename}_gen.go in it. Directories
+// that don't exist are created, and the tests go next to the output.
+// The output has to be in the package of the types, or their
+// methods won't compile.
+//
+// In place of -file, -pkg can be the import path of the package to
+// generate, which is found as the go command finds it from the
+// working directory. The files of it that are built for this
+// platform, without its tests or the files this tool generated, are
+// generated into {package}_gen.go in its directory, unless -o is
+// set. A package with cgo files, or with a type that build
+// constraints choose between two declarations of, is an error,
+// since the output would only fit some builds.
+//
+// Messages are printed to stderr, in color if stderr is a terminal
+// (unless $NO_COLOR is set).
+//
+// Generation fails if a type already has a hand-written method
+// with the name of a method that would be generated for it, such
+// as MarshalMsg, since the package wouldn't compile. The error names
+// the file and line of the existing method. Methods in the output
+// file (and its test file) are left out, since they're from an earlier run.
+//
+// Before the generated file is written, it's type-checked together
+// with the rest of its package, so that generated code that wouldn't
+// compile, such as a call to the methods of a field whose type has
+// none, fails generation instead. Each error names the file and
+// line of the type or field the code was generated for. If the
+// package's imports can't be found, the check is skipped with a warning.
+//
+// With -analyze, each finding is printed with the file and line of the
+// type or field it's about, its severity, and the name of the rule, as in
+//
+//     error: types.go:12:2: field "Retries": is a float64, but is named like a counter; ... [float-counter]
+//
+// With -golden=testdata/golden, the golden files of a type T are
+// T.zero.msgp and T.sample.msgp, and a hexdump of each (T.zero.hex
+// and T.sample.hex) for reviewing changes. The tests write them
+// when they're run with MSGP_UPDATE_GOLDEN=1, and fail when the
+// bytes don't match them otherwise, so that a change to the wire
+// format (a reordered field, an edited tag, or a number written
+// in a different width) shows up as a diff of the golden files.
+// The samples are the same every time: each field of T has a value
+// of its own, slices have two elements, maps (whose entries aren't
+// written in a set order) have one, and the types that T refers to
+// are filled two levels deep. Types from other packages than the
+// runtime, time, and those imported with //msgp:import, whose
+// import paths aren't known, keep their zero values, as do
+// extensions.
 //
 // For more information, please read README.md, and the wiki at github.com/philhofer/msgp
 //
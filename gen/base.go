@@ -0,0 +1,177 @@
+package gen
+
+// BaseInfo describes how values of a Base are
+// represented in Go source and which msgp runtime
+// methods read, write, append, and size them.
+type BaseInfo struct {
+	Name   string   // name of the base (e.g. "Float64")
+	GoType string   // Go type of the base (e.g. "float64")
+	Idents []string // Go type names parsed as this base
+
+	Read      string // (*msgp.Reader) method (e.g. "ReadFloat64")
+	ReadBytes string // msgp function reading from []byte (e.g. "ReadFloat64Bytes")
+	Write     string // (*msgp.Writer) method (e.g. "WriteFloat64")
+	Append    string // msgp function appending to []byte (e.g. "AppendFloat64")
+
+	// methods reading into a value whose memory they
+	// reuse, if the base has them (e.g. "ReadBytes")
+	ReadInto      string // (*msgp.Reader) method
+	ReadIntoBytes string // msgp function reading from []byte
+
+	Size    string // msgp size constant; the prefix size for variable-length types
+	SizeOf  string // msgp function returning the exact size of a value, if it varies
+	SizeArg string // format of the argument to SizeOf (%s is the value)
+
+	Coerce string // family of msgp.Read{{Coerce}}Coerce, if any
+	Bits   int    // size in bits of fixed-size numbers (0 if platform-dependent)
+}
+
+// std returns the BaseInfo for a base with
+// the usual method naming convention
+func std(name string, gotype string, idents ...string) *BaseInfo {
+	return &BaseInfo{
+		Name:      name,
+		GoType:    gotype,
+		Idents:    idents,
+		Read:      "Read" + name,
+		ReadBytes: "Read" + name + "Bytes",
+		Write:     "Write" + name,
+		Append:    "Append" + name,
+		Size:      name + "Size",
+	}
+}
+
+// into sets the ReadInto methods of 'b'
+// by the usual naming convention
+func into(b *BaseInfo) *BaseInfo {
+	b.ReadInto = "Read" + b.Name + "Into"
+	b.ReadIntoBytes = "Read" + b.Name + "IntoBytes"
+	return b
+}
+
+// number returns std(...) for a number that can be coerced
+func number(name string, gotype string, coerce string, bits int) *BaseInfo {
+	b := std(name, gotype, gotype)
+	b.Coerce = coerce
+	b.Bits = bits
+	switch coerce {
+	case "Int":
+		b.SizeOf, b.SizeArg = "Int64SizeFor", "int64(%s)"
+	case "Uint":
+		b.SizeOf, b.SizeArg = "Uint64SizeFor", "uint64(%s)"
+	}
+	return b
+}
+
+// bases is the registry of every Base with
+// runtime support. Supporting a new base type
+// means adding a Base constant and an entry here.
+var bases = map[Base]*BaseInfo{
+	Bytes: func() *BaseInfo {
+		b := std("Bytes", "[]byte", "[]byte")
+		b.ReadInto, b.ReadIntoBytes = "ReadBytes", "ReadBytesBytes"
+		b.Size = "BytesPrefixSize"
+		b.SizeOf, b.SizeArg = "BytesSize", "len(%s)"
+		return b
+	}(),
+	String: func() *BaseInfo {
+		b := std("String", "string", "string")
+		b.Size = "StringPrefixSize"
+		b.SizeOf, b.SizeArg = "StringSize", "%s"
+		return b
+	}(),
+	Float32:    number("Float32", "float32", "Float", 32),
+	Float64:    number("Float64", "float64", "Float", 64),
+	Complex64:  std("Complex64", "complex64", "complex64"),
+	Complex128: std("Complex128", "complex128", "complex128"),
+	Uint:       number("Uint", "uint", "Uint", 0),
+	Uint8:      number("Uint8", "uint8", "Uint", 8),
+	Uint16:     number("Uint16", "uint16", "Uint", 16),
+	Uint32:     number("Uint32", "uint32", "Uint", 32),
+	Uint64:     number("Uint64", "uint64", "Uint", 64),
+	Byte: func() *BaseInfo {
+		b := number("Byte", "byte", "Uint", 8)
+		// (*msgp.Reader).ReadByte would be mistaken
+		// for io.ByteReader, so bytes are read and
+		// sized as uint8s
+		b.Read = "ReadUint8"
+		b.Size = "Uint8Size"
+		return b
+	}(),
+	Int:   number("Int", "int", "Int", 0),
+	Int8:  number("Int8", "int8", "Int", 8),
+	Int16: number("Int16", "int16", "Int", 16),
+	Int32: number("Int32", "int32", "Int", 32),
+	Int64: number("Int64", "int64", "Int", 64),
+	Bool:  std("Bool", "bool", "bool"),
+	Intf: func() *BaseInfo {
+		b := std("Intf", "interface{}", "interface{}")
+		b.Size = "GuessSize"
+		return b
+	}(),
+	Time:  std("Time", "time.Time", "time.Time"),
+	IP:    into(std("IP", "net.IP", "net.IP")),
+	IPNet: into(std("IPNet", "net.IPNet", "net.IPNet")),
+	Addr: func() *BaseInfo {
+		b := std("Addr", "netip.Addr", "netip.Addr")
+		b.Size = "BytesPrefixSize"
+		b.SizeOf, b.SizeArg = "AddrSize", "%s"
+		return b
+	}(),
+	Ext: func() *BaseInfo {
+		b := std("Extension", "msgp.Extension", "msgp.Extension", "Extension")
+		b.Size = "ExtensionSize"
+		return b
+	}(),
+}
+
+// identBases maps Go type names to bases
+var identBases map[string]Base
+
+// definedBases maps the names of types from other
+// packages to the bases that types defined as them are
+// written as: those they're defined as, as in 'type
+// Duration int64', or their own, for base types whose
+// methods the generated code doesn't call, since a
+// type defined as one doesn't have them
+var definedBases = map[string]Base{
+	"time.Duration": Int64,
+	"net.IP":        IP,
+	"net.IPNet":     IPNet,
+}
+
+func init() {
+	identBases = make(map[string]Base)
+	for k, info := range bases {
+		for _, id := range info.Idents {
+			identBases[id] = k
+		}
+	}
+}
+
+// Info returns the BaseInfo for the base,
+// or nil if it has no runtime support
+// (e.g. Invalid or IDENT).
+func (k Base) Info() *BaseInfo { return bases[k] }
+
+// BaseOf returns the Base for the Go type
+// name 'name', or IDENT if it isn't a base type.
+func BaseOf(name string) Base {
+	if k, ok := identBases[name]; ok {
+		return k
+	}
+	return IDENT
+}
+
+// DefinedBase returns the Base that a type defined as the
+// type 'name' from another package is written as: the one
+// that "time.Duration" is defined as, or that of "net.IP"
+// itself, or IDENT if it isn't one of the known ones.
+// Values of the type are converted to and from the base,
+// as those of named base types in the same package are.
+func DefinedBase(name string) Base {
+	if k, ok := definedBases[name]; ok {
+		return k
+	}
+	return IDENT
+}
@@ -0,0 +1,109 @@
+package gen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// runtimeDecls returns the names of the methods on
+// *msgp.Reader and *msgp.Writer, and the names of
+// the top-level funcs and consts in package msgp.
+func runtimeDecls(t *testing.T) (reader, writer, funcs, consts map[string]bool) {
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "msgp")
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, ok := pkgs["msgp"]
+	if !ok {
+		t.Fatalf("package msgp not found in %s", dir)
+	}
+	reader, writer = make(map[string]bool), make(map[string]bool)
+	funcs, consts = make(map[string]bool), make(map[string]bool)
+	for _, f := range pkg.Files {
+		for _, decl := range f.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					funcs[d.Name.Name] = true
+					continue
+				}
+				if star, ok := d.Recv.List[0].Type.(*ast.StarExpr); ok {
+					switch star.X.(*ast.Ident).Name {
+					case "Reader":
+						reader[d.Name.Name] = true
+					case "Writer":
+						writer[d.Name.Name] = true
+					}
+				}
+			case *ast.GenDecl:
+				if d.Tok != token.CONST {
+					continue
+				}
+				for _, spec := range d.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						consts[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func TestBaseRegistry(t *testing.T) {
+	reader, writer, funcs, consts := runtimeDecls(t)
+
+	for k := Invalid + 1; k < IDENT; k++ {
+		info := k.Info()
+		if info == nil {
+			t.Errorf("base %d has no BaseInfo", k)
+			continue
+		}
+		if info.Name == "" || info.GoType == "" {
+			t.Errorf("%s: missing name or Go type", info.Name)
+		}
+		if !reader[info.Read] {
+			t.Errorf("%s: (*msgp.Reader).%s doesn't exist", info.Name, info.Read)
+		}
+		if !funcs[info.ReadBytes] {
+			t.Errorf("%s: msgp.%s doesn't exist", info.Name, info.ReadBytes)
+		}
+		if !writer[info.Write] {
+			t.Errorf("%s: (*msgp.Writer).%s doesn't exist", info.Name, info.Write)
+		}
+		if !funcs[info.Append] {
+			t.Errorf("%s: msgp.%s doesn't exist", info.Name, info.Append)
+		}
+		if !consts[info.Size] && !funcs[info.Size] {
+			t.Errorf("%s: msgp.%s doesn't exist", info.Name, info.Size)
+		}
+		if info.SizeOf != "" && (!funcs[info.SizeOf] || !strings.Contains(info.SizeArg, "%s")) {
+			t.Errorf("%s: msgp.%s doesn't exist or %q doesn't take the value", info.Name, info.SizeOf, info.SizeArg)
+		}
+		if info.Coerce != "" && !reader["Read"+info.Coerce+"Coerce"] {
+			t.Errorf("%s: (*msgp.Reader).Read%sCoerce doesn't exist", info.Name, info.Coerce)
+		}
+		if len(info.Idents) == 0 {
+			t.Errorf("%s: no Go type names map to it", info.Name)
+		}
+		for _, id := range info.Idents {
+			if BaseOf(id) != k {
+				t.Errorf("BaseOf(%q) is %s; want %s", id, BaseOf(id), info.Name)
+			}
+		}
+	}
+
+	if BaseOf("NotABaseType") != IDENT {
+		t.Error("expected unknown names to be IDENT")
+	}
+	if Invalid.Info() != nil || IDENT.Info() != nil {
+		t.Error("expected Invalid and IDENT to have no BaseInfo")
+	}
+}
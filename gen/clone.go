@@ -0,0 +1,140 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// copier writes the statements that deep-copy
+// an element. Every copy starts from a shallow
+// copy of the element (dst = src), so it only
+// has to replace the parts that share memory.
+type copier struct {
+	buf bytes.Buffer
+	n   int // for naming temporaries
+}
+
+func (c *copier) printf(s string, v ...interface{}) {
+	fmt.Fprintf(&c.buf, s, v...)
+}
+
+// tmp returns a new temporary variable name
+func (c *copier) tmp(prefix string) string {
+	c.n++
+	return fmt.Sprintf("%s%d", prefix, c.n)
+}
+
+// needsCopy returns whether or not a shallow
+// copy of the element can share memory with
+// the original.
+func needsCopy(e Elem) bool {
+	switch e := e.(type) {
+	case *BaseElem:
+		switch e.Value {
+		case Bytes, IP, IPNet, Intf, Ext, IDENT:
+			return true
+		}
+		return false
+	case *Array:
+		return needsCopy(e.Els)
+	case *Struct:
+		for _, f := range e.Fields {
+			if needsCopy(f.FieldElem) {
+				return true
+			}
+		}
+		return false
+	default:
+		// pointers, slices, and maps
+		return true
+	}
+}
+
+// deref returns the expression for *x
+func deref(x string) string { return "(*" + x + ")" }
+
+// addr returns the expression for &x
+func addr(x string) string {
+	if strings.HasPrefix(x, "(*") && strings.HasSuffix(x, ")") {
+		return x[2 : len(x)-1]
+	}
+	return "&" + x
+}
+
+// elem writes the code to finish copying 'src'
+// into 'dst', which already hold the same value.
+func (c *copier) elem(e Elem, dst, src string) {
+	if !needsCopy(e) {
+		return
+	}
+	switch e := e.(type) {
+	case *BaseElem:
+		switch e.Value {
+		case Bytes, IP:
+			c.printf("%s = append(%s[:0:0], %s...)\n", dst, src, src)
+		case IPNet:
+			for _, f := range []string{".IP", ".Mask"} {
+				c.printf("%s = append(%s[:0:0], %s...)\n", dst+f, src+f, src+f)
+			}
+		case Intf:
+			c.printf("%s = msgp.CopyIntf(%s)\n", dst, src)
+		case Ext:
+			c.printf("msgp.CopyExtension(%s, %s)\n", addr(dst), addr(src))
+		case IDENT:
+			c.printf("%s.CopyTo(%s)\n", strings.TrimPrefix(addr(src), "&"), addr(dst))
+		}
+
+	case *Ptr:
+		v := c.tmp("cv")
+		c.printf("if %s != nil {\n%s := *%s\n", src, v, src)
+		c.elem(e.Value, v, deref(src))
+		c.printf("%s = &%s\n}\n", dst, v)
+
+	case *Slice:
+		c.printf("%s = append(%s[:0:0], %s...)\n", dst, src, src)
+		if needsCopy(e.Els) {
+			i := c.tmp("ci")
+			c.printf("for %s := range %s {\n", i, src)
+			c.elem(e.Els, dst+"["+i+"]", src+"["+i+"]")
+			c.printf("}\n")
+		}
+
+	case *Array:
+		i := c.tmp("ci")
+		c.printf("for %s := range %s {\n", i, src)
+		c.elem(e.Els, dst+"["+i+"]", src+"["+i+"]")
+		c.printf("}\n")
+
+	case *Map:
+		k, v := c.tmp("ck"), c.tmp("cv")
+		c.printf("if %s != nil {\n%s = make(%s, len(%s))\n", src, dst, e.TypeName(), src)
+		c.printf("for %s, %s := range %s {\n", k, v, src)
+		if needsCopy(e.Value) {
+			nv := c.tmp("cv")
+			c.printf("%s := %s\n", nv, v)
+			c.elem(e.Value, nv, v)
+			v = nv
+		}
+		c.printf("%s[%s] = %s\n}\n}\n", dst, k, v)
+
+	case *Struct:
+		for _, f := range e.Fields {
+			c.elem(f.FieldElem, dst+"."+f.FieldName, src+"."+f.FieldName)
+		}
+	}
+}
+
+// CopyCode returns the statements that finish
+// a deep copy of the value pointed to by 'src'
+// into the one pointed to by 'dst', after *dst = *src.
+func (s *Ptr) CopyCode(dst string, src string) string {
+	c := &copier{}
+	if s.Value.Type() == StructType {
+		// fields are dereferenced automatically
+		c.elem(s.Value, dst, src)
+	} else {
+		c.elem(s.Value, deref(dst), deref(src))
+	}
+	return strings.TrimSuffix(c.buf.String(), "\n")
+}
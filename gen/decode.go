@@ -7,7 +7,10 @@ import (
 	"io"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"text/template"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -17,22 +20,86 @@ var (
 	unmTemplate         *template.Template
 	benTemplate         *template.Template
 	sizTemplate         *template.Template
+	cloTemplate         *template.Template
+	schTemplate         *template.Template
+	desTemplate         *template.Template
+	adpTemplate         *template.Template
+	obsTemplate         *template.Template
+	batTemplate         *template.Template
+	tupTemplate         *template.Template
+	gldTemplate         *template.Template
+	rndTemplate         *template.Template
+	fuzTemplate         *template.Template
 	marshalTestTemplate *template.Template
 	encodeTestTemplate  *template.Template
+
+	// MethodSuffix is appended to the names of the
+	// generated methods, and of the methods they call
+	// on other types, so that they don't collide with
+	// methods of the same names from other packages.
+	// (See WriteAdapter.)
+	MethodSuffix string
+
+	// NoMarshal is whether the MarshalMsg, UnmarshalMsg
+	// and Msgsize methods are left out (-marshal=false),
+	// so that the other methods and the tests can't call
+	// them.
+	NoMarshal bool
+
+	funcs = template.FuncMap{
+		"suffix":   func() string { return MethodSuffix },
+		"marshal":  func() bool { return !NoMarshal },
+		"random":   func() bool { return RandomTests },
+		"testname": testName,
+		"oneline":  oneLine,
+	}
 )
 
+// testName returns the name of the type 'name' as it's
+// written in the names of tests and benchmarks, which
+// are only run if it doesn't start with a lower-case
+// letter, as unexported types' names do
+func testName(name string) string {
+	if r, _ := utf8.DecodeRuneInString(name); unicode.IsLower(r) {
+		return "_" + name
+	}
+	return name
+}
+
+// oneLine returns 's', like the literal of an anonymous
+// struct, on one line, for a comment
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parseFiles parses the named template files,
+// which can use the functions in 'funcs'
+func parseFiles(names ...string) *template.Template {
+	return template.Must(template.New(filepath.Base(names[0])).Funcs(funcs).ParseFiles(names...))
+}
+
 func init() {
 	_, prefix, _, _ := runtime.Caller(0)
 	prefix = filepath.Dir(prefix) + "/"
 
-	decTemplate = template.Must(template.ParseFiles(prefix+"decode.tmpl", prefix+"elem_dec.tmpl"))
-	encTemplate = template.Must(template.ParseFiles(prefix+"encode.tmpl", prefix+"elem_enc.tmpl"))
-	marTemplate = template.Must(template.ParseFiles(prefix+"marshal.tmpl", prefix+"marshal_enc.tmpl"))
-	unmTemplate = template.Must(template.ParseFiles(prefix+"unmarshal.tmpl", prefix+"elem_unm.tmpl"))
-	sizTemplate = template.Must(template.ParseFiles(prefix+"size.tmpl", prefix+"size_enc.tmpl"))
+	decTemplate = parseFiles(prefix+"decode.tmpl", prefix+"elem_dec.tmpl", prefix+"transform.tmpl")
+	encTemplate = parseFiles(prefix+"encode.tmpl", prefix+"elem_enc.tmpl", prefix+"transform.tmpl", prefix+"omitempty.tmpl")
+	marTemplate = parseFiles(prefix+"marshal.tmpl", prefix+"marshal_enc.tmpl", prefix+"transform.tmpl", prefix+"omitempty.tmpl")
+	unmTemplate = parseFiles(prefix+"unmarshal.tmpl", prefix+"elem_unm.tmpl", prefix+"transform.tmpl")
+	sizTemplate = parseFiles(prefix+"size.tmpl", prefix+"size_enc.tmpl")
+	cloTemplate = parseFiles(prefix + "clone.tmpl")
+	schTemplate = parseFiles(prefix + "schema.tmpl")
+	desTemplate = parseFiles(prefix + "descriptor.tmpl")
+	adpTemplate = parseFiles(prefix + "adapter.tmpl")
+	obsTemplate = parseFiles(prefix + "observed.tmpl")
+	batTemplate = parseFiles(prefix + "batch.tmpl")
+	tupTemplate = parseFiles(prefix + "tuple.tmpl")
 
-	marshalTestTemplate = template.Must(template.ParseFiles(prefix + "testMarshal.tmpl"))
-	encodeTestTemplate = template.Must(template.ParseFiles(prefix + "testEncode.tmpl"))
+	marshalTestTemplate = parseFiles(prefix + "testMarshal.tmpl")
+	encodeTestTemplate = parseFiles(prefix + "testEncode.tmpl")
+	gldTemplate = parseFiles(prefix + "golden.tmpl")
+	rndTemplate = parseFiles(prefix + "random.tmpl")
+	fuzTemplate = parseFiles(prefix + "fuzz.tmpl")
 }
 
 // execAndFormat executes a template and formats the output, using buf as temporary storage
@@ -77,3 +144,67 @@ func WriteMarshalUnmarshal(w io.Writer, p *Ptr, buf *bytes.Buffer) error {
 	}
 	return execAndFormat(sizTemplate, w, p, buf)
 }
+
+// WriteTupleOrder writes a comment with the order of
+// the fields of a struct that's encoded as a tuple,
+// for readers in other languages, using buf as scratch
+// space. It writes nothing for other types, or for
+// structs that are marshaled as another type.
+func WriteTupleOrder(w io.Writer, p *Ptr, buf *bytes.Buffer) error {
+	if s, ok := p.Value.(*Struct); !ok || !s.AsTuple || s.MarshalAs != "" {
+		return nil
+	}
+	return execAndFormat(tupTemplate, w, p, buf)
+}
+
+// WriteClone writes the Clone and CopyTo
+// methods using buf as scratch space.
+func WriteClone(w io.Writer, p *Ptr, buf *bytes.Buffer) error {
+	return execAndFormat(cloTemplate, w, p, buf)
+}
+
+// WriteObserved writes the UnmarshalMsgObserved method
+// of a struct using buf as scratch space. It writes
+// nothing for other types, which have no keys to skip.
+func WriteObserved(w io.Writer, p *Ptr, buf *bytes.Buffer) error {
+	if _, ok := p.Value.(*Struct); !ok {
+		return nil
+	}
+	return execAndFormat(obsTemplate, w, p, buf)
+}
+
+// WriteBatch writes the Unmarshal{Type}Batch function,
+// which unmarshals one message after another into
+// one value, using buf as scratch space.
+func WriteBatch(w io.Writer, p *Ptr, buf *bytes.Buffer) error {
+	return execAndFormat(batTemplate, w, p.Value, buf)
+}
+
+// WriteSchema writes the SchemaHash constant and
+// Schema function using buf as scratch space.
+func WriteSchema(w io.Writer, p *Ptr, buf *bytes.Buffer) error {
+	return execAndFormat(schTemplate, w, p, buf)
+}
+
+// WriteDescriptor writes the Descriptor variable of
+// a struct using buf as scratch space. It writes nothing
+// for other types, or for structs that are marshaled
+// as another type, whose descriptor is that type's.
+func WriteDescriptor(w io.Writer, p *Ptr, buf *bytes.Buffer) error {
+	if s, ok := p.Value.(*Struct); !ok || s.MarshalAs != "" {
+		return nil
+	}
+	return execAndFormat(desTemplate, w, p, buf)
+}
+
+// WriteAdapter writes the Msgp{MethodSuffix} method,
+// which returns the renamed methods as a msgp.Funcs,
+// using buf as scratch space. 'marshal' and 'encode'
+// are whether or not each set of methods was written.
+func WriteAdapter(w io.Writer, p *Ptr, marshal bool, encode bool, buf *bytes.Buffer) error {
+	return execAndFormat(adpTemplate, w, struct {
+		*Ptr
+		Marshal bool
+		Encode  bool
+	}{p, marshal, encode}, buf)
+}
@@ -0,0 +1,90 @@
+package gen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Descriptor returns the keyed fields of the
+// msgp.FieldDescriptor literal that describes
+// the field (see msgp.TypeDescriptor).
+func (f StructField) Descriptor() string {
+	kind, ext := wireKind(f.FieldElem)
+	parts := []string{
+		fmt.Sprintf("Name: %q", f.FieldName),
+		fmt.Sprintf("Tag: %q", f.FieldTag),
+		"Kind: msgp." + kind,
+		fmt.Sprintf("TypeName: %q", f.FieldElem.TypeName()),
+	}
+	for _, opt := range []struct {
+		name string
+		on   bool
+	}{
+		{"Extension", ext},
+		{"OmitEmpty", f.OmitEmpty},
+		{"DecodeOnly", f.DecodeOnly},
+		{"EncodeOnly", f.EncodeOnly},
+	} {
+		if opt.on {
+			parts = append(parts, opt.name+": true")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// wireKind returns the name of the msgp.Type
+// that 'e' is written as, and whether or not
+// it's written as an extension
+func wireKind(e Elem) (string, bool) {
+	switch e := e.(type) {
+	case *Ptr:
+		return wireKind(e.Value)
+	case *Slice, *Array:
+		return "ArrayType", false
+	case *Map:
+		return "MapType", false
+	case *Struct:
+		switch {
+		case e.MarshalAs != "":
+			return "InvalidType", false
+		case e.AsTuple:
+			return "ArrayType", false
+		default:
+			return "MapType", false
+		}
+	case *BaseElem:
+		if e.Transform != "" {
+			return "BinType", false
+		}
+		if e.IsEpoch() {
+			return "IntType", false
+		}
+		switch e.Value {
+		case String:
+			return "StrType", false
+		case Bytes, IP, Addr:
+			return "BinType", false
+		case IPNet:
+			return "ArrayType", false
+		case Float32:
+			return "Float32Type", false
+		case Float64:
+			return "Float64Type", false
+		case Complex64:
+			return "Complex64Type", true
+		case Complex128:
+			return "Complex128Type", true
+		case Uint, Uint8, Uint16, Uint32, Uint64, Byte:
+			return "UintType", false
+		case Int, Int8, Int16, Int32, Int64:
+			return "IntType", false
+		case Bool:
+			return "BoolType", false
+		case Time:
+			return "TimeType", true
+		case Ext:
+			return "ExtensionType", true
+		}
+	}
+	return "InvalidType", false
+}
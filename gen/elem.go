@@ -2,7 +2,9 @@ package gen
 
 import (
 	"fmt"
-	"math/rand"
+	"go/token"
+	"go/types"
+	"hash/fnv"
 	"strings"
 )
 
@@ -11,13 +13,51 @@ const (
 	idxLen   = 3
 )
 
-// generate a random index variable name
-func randIdx() string {
-	bts := make([]byte, idxLen)
-	for i := range bts {
-		bts[i] = idxChars[rand.Intn(len(idxChars))]
+// idxNames returns 'n' distinct index variable
+// names for the element named 'varname'. They're
+// derived from the name, so that the same element
+// always gets the same names, and an element
+// nested in another, whose name is different,
+// gets different ones instead of shadowing them.
+func idxNames(varname string, n int) []string {
+	out := make([]string, 0, n)
+	h := fnv.New32a()
+	h.Write([]byte(varname))
+	for len(out) < n {
+		sum := h.Sum32()
+		h.Write([]byte{0}) // for the next candidate
+		bts := make([]byte, idxLen)
+		for i := range bts {
+			bts[i] = idxChars[sum%uint32(len(idxChars))]
+			sum /= uint32(len(idxChars))
+		}
+		idx := string(bts)
+		// the indexes of parent slices
+		// and arrays are in the name
+		if reservedIdx(idx) || strings.Contains(varname, idx) {
+			continue
+		}
+		for _, prev := range out {
+			if prev == idx {
+				idx = ""
+				break
+			}
+		}
+		if idx != "" {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+// reservedIdx returns whether or not 'idx' is a
+// keyword or a name that generated code uses
+func reservedIdx(idx string) bool {
+	switch idx {
+	case "err", "bts", "key", "tmp":
+		return true
 	}
-	return string(bts)
+	return token.Lookup(idx).IsKeyword() || types.Universe.Lookup(idx) != nil
 }
 
 // This code defines the template
@@ -85,9 +125,12 @@ const (
 	Int32
 	Int64
 	Bool
-	Intf // interface{}
-	Time // time.Time
-	Ext  // extension
+	Intf  // interface{}
+	Time  // time.Time
+	IP    // net.IP
+	IPNet // net.IPNet
+	Addr  // netip.Addr
+	Ext   // extension
 
 	IDENT // IDENT means an unrecognized identifier
 )
@@ -102,7 +145,7 @@ const (
 	SliceType            // slice-of-object
 	StructType           // struct-of-objects
 	BaseType             // object
-	MapType              // map[string]object
+	MapType              // map[string]object or map[int]object
 	ArrayType            // [Size]object
 )
 
@@ -140,10 +183,11 @@ type Elem interface {
 }
 
 type Array struct {
-	name  string // Varname
-	Index string // index variable name
-	Size  string // array size
-	Els   Elem   // child
+	name    string // Varname
+	Index   string // index variable name
+	Size    string // array size
+	Els     Elem   // child
+	Context string // field it's in, for errors
 }
 
 func (a *Array) Type() ElemType  { return ArrayType }
@@ -155,15 +199,7 @@ func (a *Array) Map() *Map       { return nil }
 func (a *Array) Array() *Array   { return a }
 func (a *Array) SetVarname(s string) {
 	a.name = s
-ridx:
-	a.Index = randIdx()
-
-	// try to avoid using the same
-	// index as a parent slice
-	if strings.Contains(a.name, a.Index) {
-		goto ridx
-	}
-
+	a.Index = idxNames(a.name, 1)[0]
 	a.Els.SetVarname(fmt.Sprintf("%s[%s]", a.name, a.Index))
 }
 func (a *Array) Varname() string  { return a.name }
@@ -172,12 +208,29 @@ func (a *Array) String() string {
 	return fmt.Sprintf("Array[%s]Of(%s - %s)", a.Size, a.Els.String(), a.Varname())
 }
 
-// Map is a map[string]Elem
+// Map is a map[string]Elem, or a map with
+// integer keys, if Key is set, or keys of a
+// named string type, if KeyIdent is set
 type Map struct {
-	name   string
-	Keyidx string // key variable name
-	Validx string // value variable name
-	Value  Elem
+	Name     string // type name, if the map is a named type
+	name     string
+	Keyidx   string // key variable name
+	Validx   string // value variable name
+	Sizeidx  string // entries left to decode
+	Dropidx  string // entries to skip (see DropOverflow)
+	Key      Base   // integer key type; Invalid for string keys
+	KeyIdent string // named type of string keys, if they have one
+	Value    Elem
+	AllowNil bool // encode a nil map as 'nil'
+
+	// MaxEntries, if non-zero, is the largest number
+	// of entries that are decoded. A map with more is
+	// an error, or, if DropOverflow is set, the rest
+	// of its entries are skipped.
+	MaxEntries   uint32
+	DropOverflow bool
+
+	Fresh bool // declared just before decoding, so always nil
 }
 
 func (m *Map) Type() ElemType  { return MapType }
@@ -189,27 +242,86 @@ func (m *Map) Map() *Map       { return m }
 func (m *Map) Array() *Array   { return nil }
 func (m *Map) SetVarname(s string) {
 	m.name = s
-ridx:
-	m.Keyidx = randIdx()
-	m.Validx = randIdx()
+	idx := idxNames(s, 4)
+	m.Keyidx, m.Validx, m.Sizeidx, m.Dropidx = idx[0], idx[1], idx[2], idx[3]
+	m.Value.SetVarname(m.Validx)
+	// map values are decoded into a new variable
+	switch v := m.Value.(type) {
+	case *Ptr:
+		v.Fresh = true
+	case *Map:
+		v.Fresh = true
+	}
+}
+func (m *Map) Varname() string { return m.name }
+func (m *Map) TypeName() string {
+	if m.Name != "" {
+		return m.Name
+	}
+	return fmt.Sprintf("map[%s]%s", m.KeyTypeName(), m.Value.TypeName())
+}
+func (m *Map) String() string {
+	return fmt.Sprintf("MapOf([%s]%s - %s)", m.KeyTypeName(), m.Value.String(), m.Varname())
+}
+
+// IntKeys returns whether or not the
+// map has integer keys
+func (m *Map) IntKeys() bool { return m.Key != Invalid }
 
-	// just in case
-	if m.Keyidx == m.Validx {
-		goto ridx
+// KeyTypeName returns the Go type of the keys
+func (m *Map) KeyTypeName() string {
+	if m.IntKeys() {
+		return m.Key.Info().GoType
 	}
+	if m.KeyIdent != "" {
+		return m.KeyIdent
+	}
+	return "string"
+}
 
-	m.Value.SetVarname(m.Validx)
+// KeyString returns an expression for
+// a string key as a string, converting
+// it if it has a named type
+func (m *Map) KeyString() string {
+	if m.KeyIdent != "" {
+		return "string(" + m.Keyidx + ")"
+	}
+	return m.Keyidx
 }
-func (m *Map) Varname() string  { return m.name }
-func (m *Map) TypeName() string { return fmt.Sprintf("map[string]%s", m.Value.TypeName()) }
-func (m *Map) String() string {
-	return fmt.Sprintf("MapOf([string]%s - %s)", m.Value.String(), m.Varname())
+
+// KeyInfo returns the runtime methods for
+// integer keys, or nil for string keys.
+func (m *Map) KeyInfo() *BaseInfo { return m.Key.Info() }
+
+// KeyRead returns the family of msgp.Read{{KeyRead}}Key
+// and msgp.Read{{KeyRead}}KeyBytes, which read integer
+// keys encoded as either signed or unsigned integers
+func (m *Map) KeyRead() string { return m.KeyInfo().Coerce }
+
+// KeySizeExpr returns an expression for
+// the exact encoded size of the key
+func (m *Map) KeySizeExpr() string {
+	if !m.IntKeys() {
+		return "msgp.StringSize(" + m.KeyString() + ")"
+	}
+	info := m.KeyInfo()
+	return "msgp." + info.SizeOf + "(" + fmt.Sprintf(info.SizeArg, m.Keyidx) + ")"
+}
+
+// KeyReadType returns the type returned
+// by the msgp.Read{{KeyRead}}Key method.
+func (m *Map) KeyReadType() string {
+	return strings.ToLower(m.KeyRead()) + "64"
 }
 
 type Slice struct {
-	name  string
-	Index string
-	Els   Elem // The type of each element
+	Name     string // type name, if the slice is a named type
+	name     string
+	Index    string
+	Sizeidx  string // length variable name
+	Els      Elem   // The type of each element
+	AllowNil bool   // encode a nil slice as 'nil'
+	Bitset   bool   // a []bool written as a msgp bitset, with its bools packed into bits
 }
 
 func (s *Slice) Type() ElemType  { return SliceType }
@@ -221,11 +333,17 @@ func (s *Slice) Map() *Map       { return nil }
 func (s *Slice) Array() *Array   { return nil }
 func (s *Slice) SetVarname(a string) {
 	s.name = a
-	s.Index = randIdx()
+	idx := idxNames(a, 2)
+	s.Index, s.Sizeidx = idx[0], idx[1]
 	s.Els.SetVarname(fmt.Sprintf("%s[%s]", s.name, s.Index))
 }
-func (s *Slice) Varname() string  { return s.name }
-func (s *Slice) TypeName() string { return "[]" + s.Els.TypeName() }
+func (s *Slice) Varname() string { return s.name }
+func (s *Slice) TypeName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return "[]" + s.Els.TypeName()
+}
 func (s *Slice) String() string {
 	return fmt.Sprintf("SliceOf(%s - %s)", s.Els.String(), s.Varname())
 }
@@ -233,6 +351,7 @@ func (s *Slice) String() string {
 type Ptr struct {
 	name  string
 	Value Elem
+	Fresh bool // declared just before decoding, so always nil
 }
 
 func (s *Ptr) Type() ElemType  { return PtrType }
@@ -253,6 +372,11 @@ func (s *Ptr) SetVarname(a string) {
 		s.Value.SetVarname(a)
 		return
 
+	case MapType, SliceType, ArrayType:
+		// indexing binds tighter than '*'
+		s.Value.SetVarname(deref(a))
+		return
+
 	case BaseType:
 		// identities and extensions have pointer receivers
 		if s.Value.Base().IsIdent() {
@@ -276,6 +400,19 @@ type Struct struct {
 	Name    string        // struct type name
 	Fields  []StructField // field list
 	AsTuple bool          // write as an array instead of a map
+	Literal string        // type literal, if the struct is anonymous
+	Sizeidx string        // fields left to decode
+
+	// AcceptBoth is set if the struct can be
+	// decoded from either an array or a map,
+	// whichever the next object is, and not
+	// only from the form that it's written as
+	AcceptBoth bool
+
+	// MarshalAs is the name of the type that the
+	// struct is converted to, with its ToWire and
+	// FromWire methods, and encoded as, if any
+	MarshalAs string
 }
 
 func (s *Struct) Type() ElemType  { return StructType }
@@ -287,9 +424,29 @@ func (s *Struct) Map() *Map       { return nil }
 func (s *Struct) Array() *Array   { return nil }
 func (s *Struct) Varname() string { return "" } // structs are special
 func (s *Struct) SetVarname(a string) {
+	s.Sizeidx = idxNames(a, 1)[0]
 	writeStructFields(s.Fields, a)
+	s.setContext(s.Name)
+}
+
+// setContext sets the context of each field
+// of the struct to "ctx.tag", or to "tag"
+// if 'ctx' is empty
+func (s *Struct) setContext(ctx string) {
+	for i := range s.Fields {
+		c := s.Fields[i].FieldTag
+		if ctx != "" {
+			c = ctx + "." + c
+		}
+		setContext(s.Fields[i].FieldElem, c)
+	}
+}
+func (s *Struct) TypeName() string {
+	if s.Name == "" {
+		return s.Literal
+	}
+	return s.Name
 }
-func (s *Struct) TypeName() string { return s.Name }
 func (s *Struct) String() string {
 	return fmt.Sprintf("%s{%s}", s.Name, s.Fields)
 }
@@ -298,6 +455,44 @@ type StructField struct {
 	FieldTag  string
 	FieldName string
 	FieldElem Elem
+
+	// DecodeOnly fields are read, but never
+	// written, and EncodeOnly fields are written,
+	// but skipped like unknown fields when read
+	DecodeOnly bool
+	EncodeOnly bool
+
+	// OmitEmpty fields aren't written
+	// when they're empty (see EmptyExpr)
+	OmitEmpty bool
+}
+
+// EncodedFields returns the fields
+// that are written, in order
+func (s *Struct) EncodedFields() []StructField {
+	return s.fieldsWithout(func(f *StructField) bool { return f.DecodeOnly })
+}
+
+// DecodedFields returns the fields
+// that are read, in order
+func (s *Struct) DecodedFields() []StructField {
+	return s.fieldsWithout(func(f *StructField) bool { return f.EncodeOnly })
+}
+
+func (s *Struct) fieldsWithout(skip func(*StructField) bool) []StructField {
+	for i := range s.Fields {
+		if !skip(&s.Fields[i]) {
+			continue
+		}
+		out := append([]StructField{}, s.Fields[:i]...)
+		for _, f := range s.Fields[i+1:] {
+			if !skip(&f) {
+				out = append(out, f)
+			}
+		}
+		return out
+	}
+	return s.Fields
 }
 
 func (s StructField) String() string {
@@ -311,6 +506,11 @@ type BaseElem struct {
 	Convert      bool   // should we do an explicit conversion?
 	ShimToBase   string // shim to base type
 	ShimFromBase string // shim from base type
+	Transform    string // name of registered transform, if any
+	Coerce       bool   // decode numbers from strings, too
+	Epoch        string // unit (s, ms or ns) of a time.Time written as an integer, if any
+	Context      string // field it's in, for errors
+	AllowNil     bool   // write a named slice or map type as 'nil' when it's nil
 }
 
 func (s *BaseElem) Type() ElemType  { return BaseType }
@@ -369,40 +569,80 @@ func (s *BaseElem) FromBase() string {
 	return s.Ident
 }
 
+// SizeExpr returns an expression for the exact
+// encoded size of the element, or "" if the
+// size is the constant msgp.{{Info.Size}}.
+func (s *BaseElem) SizeExpr() string {
+	info := s.Value.Info()
+	if info == nil || info.SizeOf == "" {
+		return ""
+	}
+	v := s.Varname()
+	if s.Convert {
+		v = s.ToBase() + "(" + v + ")"
+	}
+	return "msgp." + info.SizeOf + "(" + fmt.Sprintf(info.SizeArg, v) + ")"
+}
+
+// fixedSize returns whether or not Msgsize adds
+// the same size for every value of the element,
+// without referring to the element. Named types
+// never are: their sizes come from calls to their
+// Msgsize methods, which aren't expanded in place,
+// so a type that refers to itself (through a map,
+// slice or pointer) is sized by walking the value,
+// which ends where the value does, and never by
+// expanding the type into a size that doesn't.
+func fixedSize(e Elem) bool {
+	switch e := e.(type) {
+	case *BaseElem:
+		return !e.IsIntf() && !e.IsIdent() && !e.IsExt() && e.SizeExpr() == ""
+	case *Struct:
+		for _, f := range e.EncodedFields() {
+			if !fixedSize(f.FieldElem) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// ElemsFixedSize returns whether or not
+// every element has the same size
+func (s *Slice) ElemsFixedSize() bool { return fixedSize(s.Els) }
+
+// ElemsFixedSize returns whether or not
+// every element has the same size
+func (a *Array) ElemsFixedSize() bool { return fixedSize(a.Els) }
+
+// ValueFixedSize returns whether or not
+// every value has the same size
+func (m *Map) ValueFixedSize() bool { return fixedSize(m.Value) }
+
 // BaseName returns the string form of the
 // base type (e.g. Float64, Ident, etc)
 func (s *BaseElem) BaseName() string {
-	// time is a special case;
-	// we strip the package prefix
-	if s.Value == Time {
-		return "Time"
-	}
 	return s.Value.String()
 }
 
+// BaseType returns the Go type of the base
+// type (e.g. float64, time.Time, etc)
 func (s *BaseElem) BaseType() string {
-	switch s.Value {
-	case IDENT:
+	if s.Value == IDENT {
 		return s.Ident
-
-	// exceptions to the naming/capitalization
-	// rule:
-	case Intf:
-		return "interface{}"
-	case Bytes:
-		return "[]byte"
-	case Time:
-		return "time.Time"
-	case Ext:
-		return "msgp.Extension"
-
-	// everything else is base.String() with
-	// the first letter as lowercase
-	default:
-		return strings.ToLower(s.BaseName())
 	}
+	if info := s.Value.Info(); info != nil {
+		return info.GoType
+	}
+	return "invalid"
 }
 
+// Info returns the runtime methods for the
+// base type. It is nil for unresolved identifiers.
+func (s *BaseElem) Info() *BaseInfo { return s.Value.Info() }
+
 // is this an interface{} ?
 func (s *BaseElem) IsIntf() bool { return s.Value == Intf }
 
@@ -412,59 +652,96 @@ func (s *BaseElem) IsExt() bool { return s.Value == Ext }
 // is this an external identity?
 func (s *BaseElem) IsIdent() bool { return s.Value == IDENT }
 
+// is this passed through a transform?
+func (s *BaseElem) IsTransform() bool { return s.Transform != "" }
+
+// is this a time.Time written as an integer?
+func (s *BaseElem) IsEpoch() bool { return s.Epoch != "" && s.Value == Time }
+
+// EpochUnit returns the name of the msgp.EpochUnit
+// of the element's Epoch, or "" if it has none.
+func (s *BaseElem) EpochUnit() string { return epochUnits[s.Epoch] }
+
+// epochUnits are the msgp.EpochUnits of
+// the values of the epoch tag option
+var epochUnits = map[string]string{
+	"s":  "EpochSeconds",
+	"ms": "EpochMillis",
+	"ns": "EpochNanos",
+}
+
+// EpochUnitOK returns whether or not 'unit' is a
+// value of the epoch tag option (s, ms or ns).
+func EpochUnitOK(unit string) bool { return epochUnits[unit] != "" }
+
+// CanCoerce returns whether or not the base
+// type is a number that can be decoded from a string
+func (s *BaseElem) CanCoerce() bool { return s.CoerceName() != "" }
+
+// is this a number decoded from strings, too?
+func (s *BaseElem) IsCoerce() bool { return s.Coerce && s.CanCoerce() }
+
+// CoerceName returns the family of the
+// msgp.Read{{CoerceName}}Coerce method used
+// to decode the element, or "" if there is none.
+func (s *BaseElem) CoerceName() string {
+	if info := s.Value.Info(); info != nil {
+		return info.Coerce
+	}
+	return ""
+}
+
+// CoerceType returns the type returned
+// by the msgp.Read{{CoerceName}}Coerce method.
+func (s *BaseElem) CoerceType() string {
+	return strings.ToLower(s.CoerceName()) + "64"
+}
+
+// BitSize returns the size of the base type in
+// bits, or 0 if it is the size of an int.
+func (s *BaseElem) BitSize() int {
+	if info := s.Value.Info(); info != nil {
+		return info.Bits
+	}
+	return 0
+}
+
 func (k Base) String() string {
-	switch k {
-	case String:
-		return "String"
-	case Bytes:
-		return "Bytes"
-	case Float32:
-		return "Float32"
-	case Float64:
-		return "Float64"
-	case Complex64:
-		return "Complex64"
-	case Complex128:
-		return "Complex128"
-	case Uint:
-		return "Uint"
-	case Uint8:
-		return "Uint8"
-	case Uint16:
-		return "Uint16"
-	case Uint32:
-		return "Uint32"
-	case Uint64:
-		return "Uint64"
-	case Byte:
-		return "Byte"
-	case Int:
-		return "Int"
-	case Int8:
-		return "Int8"
-	case Int16:
-		return "Int16"
-	case Int32:
-		return "Int32"
-	case Int64:
-		return "Int64"
-	case Bool:
-		return "Bool"
-	case Intf:
-		return "Intf"
-	case Time:
-		return "time.Time"
-	case Ext:
-		return "Extension"
-	case IDENT:
+	if info := k.Info(); info != nil {
+		return info.Name
+	}
+	if k == IDENT {
 		return "Ident"
-	default:
-		return "INVALID"
 	}
+	return "INVALID"
 }
 
 // writeStructFields is a trampoline for writeBase for
 // all of the fields in a struct
+// setContext sets the context of the errors
+// that decoding 'e', a field or a part of one,
+// returns (see msgp.ErrorContext) to 'ctx'.
+// Anonymous structs name their fields after it.
+func setContext(e Elem, ctx string) {
+	switch e := e.(type) {
+	case *Ptr:
+		setContext(e.Value, ctx)
+	case *Slice:
+		setContext(e.Els, ctx)
+	case *Array:
+		e.Context = ctx
+		setContext(e.Els, ctx)
+	case *Map:
+		setContext(e.Value, ctx)
+	case *Struct:
+		if e.Name == "" {
+			e.setContext(ctx)
+		}
+	case *BaseElem:
+		e.Context = ctx
+	}
+}
+
 func writeStructFields(s []StructField, name string) {
 	for i := range s {
 		s[i].FieldElem.SetVarname(fmt.Sprintf("%s.%s", name, s[i].FieldName))
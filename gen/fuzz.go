@@ -0,0 +1,40 @@
+package gen
+
+import (
+	"bytes"
+	"io"
+)
+
+// fuzzFile is what fuzz.tmpl is executed with
+type fuzzFile struct {
+	Decode bool // whether there are DecodeMsg methods to fuzz
+	Types  []goldenType
+}
+
+// WriteFuzzTests writes, for each of the named types in
+// 'elems', a function that returns a seed value of the
+// type, as WriteGoldenTests writes a sample, and a fuzz
+// test (FuzzType, for go test -fuzz) that decodes mutations
+// of the encodings of its zero value and the seed with
+// UnmarshalMsg and, if 'decode', DecodeMsg, and fails if
+// either returns an error that isn't a msgp.Error or one
+// of the io.Reader's. Panics fail it, too. It uses buf as
+// scratch space, and returns the packages that the tests
+// import, as WriteGoldenTests does.
+func WriteFuzzTests(w io.Writer, elems []Elem, decode bool, pkgs map[string]string, buf *bytes.Buffer) (map[string]string, error) {
+	imports := map[string]string{
+		"msgp":    pkgs["msgp"],
+		"testing": "testing",
+	}
+	if decode {
+		imports["bytes"] = "bytes"
+		imports["io"] = "io"
+	}
+	s := newSampler("fuzz", pkgs, imports)
+	f := fuzzFile{Decode: decode, Types: s.samples(elems)}
+	err := execAndFormat(fuzTemplate, w, f, buf)
+	if err != nil {
+		return nil, err
+	}
+	return s.imports, nil
+}
@@ -0,0 +1,287 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// qualifier matches the package names in type names
+var qualifier = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)\.[A-Za-z_]`)
+
+// sampler writes the statements that fill an
+// element with a sample value, made from the
+// variables 'seed' and 'depth' of the function
+// they're written in. Each leaf gets a value of
+// its own, from 'seed' and its place in the type,
+// so that moving a field changes the bytes.
+type sampler struct {
+	buf     *bytes.Buffer
+	fn      string            // prefix of the names of the sample functions
+	n       int               // for numbering leaves
+	tmps    int               // for naming temporaries
+	idents  map[string]bool   // types that have sample functions
+	pkgs    map[string]string // import paths of the packages that can be used, by name
+	imports map[string]string // the ones that are
+}
+
+func (s *sampler) printf(f string, v ...interface{}) {
+	fmt.Fprintf(s.buf, f, v...)
+}
+
+// next returns an expression for the
+// value of the next leaf (an int)
+func (s *sampler) next() string {
+	s.n++
+	return fmt.Sprintf("seed+%d", s.n)
+}
+
+// tmp returns a new temporary variable name
+func (s *sampler) tmp(prefix string) string {
+	s.tmps++
+	return fmt.Sprintf("%s%d", prefix, s.tmps)
+}
+
+// use returns whether or not the packages named in
+// 'code' can be imported, and imports them if they can
+func (s *sampler) use(code string) bool {
+	ms := qualifier.FindAllStringSubmatch(code, -1)
+	for _, m := range ms {
+		if _, ok := s.pkgs[m[1]]; !ok {
+			return false
+		}
+	}
+	for _, m := range ms {
+		s.imports[m[1]] = s.pkgs[m[1]]
+	}
+	return true
+}
+
+// typeName returns the name of the type of 'e',
+// or false if it names a package that the
+// tests don't know the import path of
+func (s *sampler) typeName(e Elem) (string, bool) {
+	name := e.TypeName()
+	return name, s.use(name)
+}
+
+// base returns an expression for a sample value
+// of the base type of 'e', or "" if the zero
+// value is the sample, as for extensions
+func (s *sampler) base(e *BaseElem) string {
+	switch e.Value {
+	case String:
+		return fmt.Sprintf("\"s\" + strconv.Itoa(%s)", s.next())
+	case Bytes:
+		return fmt.Sprintf("[]byte(\"b\" + strconv.Itoa(%s))", s.next())
+	case Bool:
+		return fmt.Sprintf("(%s)%%2 == 1", s.next())
+	case Complex64, Complex128:
+		return fmt.Sprintf("%s(complex(float64(%s), 0.5))", e.BaseType(), s.next())
+	case Intf:
+		return fmt.Sprintf("int64(%s)", s.next())
+	case Time:
+		return fmt.Sprintf("time.Unix(int64(%s)*86400, 0).UTC()", s.next())
+	case IP:
+		return fmt.Sprintf("net.IP{10, 0, 0, byte(%s)}", s.next())
+	case IPNet:
+		return fmt.Sprintf("net.IPNet{IP: net.IP{10, byte(%s), 0, 0}, Mask: net.CIDRMask(16, 32)}", s.next())
+	case Addr:
+		return fmt.Sprintf("netip.AddrFrom4([4]byte{10, 0, 0, byte(%s)})", s.next())
+	}
+	switch e.CoerceName() {
+	case "Float":
+		return fmt.Sprintf("%s(%s) + 0.5", e.BaseType(), s.next())
+	case "Int", "Uint":
+		return fmt.Sprintf("%s(%s)", e.BaseType(), s.next())
+	}
+	return ""
+}
+
+// elem writes the statements that fill
+// 'dst', which holds its zero value
+func (s *sampler) elem(e Elem, dst string) {
+	switch e := e.(type) {
+	case *BaseElem:
+		if e.Value == IDENT {
+			// types that aren't generated here
+			// keep their zero values
+			if s.idents[e.Ident] {
+				s.printf("if depth > 0 {\n%s = %s%s(%s, depth-1)\n}\n", dst, s.fn, e.Ident, s.next())
+			}
+			return
+		}
+		v := s.base(e)
+		if v == "" {
+			return
+		}
+		if e.Convert {
+			v = e.FromBase() + "(" + v + ")"
+		}
+		if !s.use(v) {
+			return
+		}
+		s.printf("%s = %s\n", dst, v)
+
+	case *Ptr:
+		name, ok := s.typeName(e.Value)
+		if !ok {
+			return
+		}
+		s.printf("%s = new(%s)\n", dst, name)
+		s.elem(e.Value, deref(dst))
+
+	case *Slice:
+		// two elements, each with a seed of its own
+		name, ok := s.typeName(e)
+		if !ok {
+			return
+		}
+		s.printf("%s = make(%s, 2)\n", dst, name)
+		s.each(e.Els, dst)
+
+	case *Array:
+		s.each(e.Els, dst)
+
+	case *Map:
+		// one entry, since the entries of
+		// a map are written in no set order
+		name, ok := s.typeName(e)
+		if !ok {
+			return
+		}
+		vname, ok := s.typeName(e.Value)
+		if !ok {
+			return
+		}
+		var key string
+		if e.IntKeys() {
+			key = fmt.Sprintf("%s(%s)", e.KeyTypeName(), s.next())
+		} else {
+			key = fmt.Sprintf("%s(\"k\" + strconv.Itoa(%s))", e.KeyTypeName(), s.next())
+		}
+		v := s.tmp("sv")
+		s.printf("var %s %s\n", v, vname)
+		s.elem(e.Value, v)
+		s.printf("%s = %s{%s: %s}\n", dst, name, key, v)
+
+	case *Struct:
+		for _, f := range e.Fields {
+			s.elem(f.FieldElem, dst+"."+f.FieldName)
+		}
+	}
+}
+
+// each writes the statements that fill each
+// of the elements 'els' of the slice or array
+// 'dst', each with a seed of its own
+func (s *sampler) each(els Elem, dst string) {
+	i := s.tmp("si")
+	// the loop is left out if the
+	// elements keep their zero values
+	outer := s.buf
+	s.buf = new(bytes.Buffer)
+	s.elem(els, dst+"["+i+"]")
+	code := s.buf.String()
+	s.buf = outer
+	if code == "" {
+		return
+	}
+	s.printf("for %s := range %s {\n", i, dst)
+	if strings.Contains(code, "seed+") {
+		s.printf("seed := seed + %s\n", i)
+	}
+	s.printf("%s}\n", code)
+}
+
+// goldenType is what golden.tmpl
+// is executed with for each type
+type goldenType struct {
+	TypeName string
+	Code     string // fills 'v' with the sample
+}
+
+// goldenFile is what golden.tmpl is executed with
+type goldenFile struct {
+	Dir   string
+	Types []goldenType
+}
+
+// newSampler returns a sampler whose sample functions are
+// named 'fn'{Type}. Samples may use the packages in 'pkgs'
+// and in 'imports', which the file imports anyway, each
+// of which holds import paths by the names they're used
+// under.
+func newSampler(fn string, pkgs map[string]string, imports map[string]string) *sampler {
+	s := &sampler{
+		buf:    new(bytes.Buffer),
+		fn:     fn,
+		idents: make(map[string]bool),
+		pkgs: map[string]string{
+			"strconv": "strconv",
+			"time":    "time",
+			"net":     "net",
+			"netip":   "net/netip",
+		},
+		imports: imports,
+	}
+	for name, path := range pkgs {
+		s.pkgs[name] = path
+	}
+	for name, path := range s.imports {
+		s.pkgs[name] = path
+	}
+	return s
+}
+
+// samples returns the code of the sample
+// function of each of the named types in 'elems'
+func (s *sampler) samples(elems []Elem) []goldenType {
+	var ptrs []*Ptr
+	for _, el := range elems {
+		if p, ok := el.(*Ptr); ok {
+			ptrs = append(ptrs, p)
+			s.idents[p.Value.TypeName()] = true
+		}
+	}
+	var types []goldenType
+	for _, p := range ptrs {
+		s.buf.Reset()
+		s.n, s.tmps = 0, 0
+		s.elem(p.Value, "v")
+		types = append(types, goldenType{
+			TypeName: p.Value.TypeName(),
+			Code:     strings.TrimSuffix(s.buf.String(), "\n"),
+		})
+	}
+	return types
+}
+
+// WriteGoldenTests writes, for each of the named types in
+// 'elems', a function that returns a sample value of the
+// type, made from a seed, and a test that marshals its zero
+// value and a sample and compares the bytes to the golden
+// files in 'dir', using buf as scratch space. The samples
+// may use the packages in 'pkgs', which holds their import
+// paths by the names they're used under; values of types
+// (or shims) from other packages are left zero. It returns
+// the packages that the tests import, in the same form,
+// which aren't written.
+func WriteGoldenTests(w io.Writer, elems []Elem, dir string, pkgs map[string]string, buf *bytes.Buffer) (map[string]string, error) {
+	s := newSampler("golden", pkgs, map[string]string{
+		"bytes":    "bytes",
+		"hex":      "encoding/hex",
+		"ioutil":   "io/ioutil",
+		"os":       "os",
+		"filepath": "path/filepath",
+		"testing":  "testing",
+	})
+	f := goldenFile{Dir: dir, Types: s.samples(elems)}
+	err := execAndFormat(gldTemplate, w, f, buf)
+	if err != nil {
+		return nil, err
+	}
+	return s.imports, nil
+}
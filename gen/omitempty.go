@@ -0,0 +1,79 @@
+package gen
+
+// OmitsEmpty returns whether or not the struct leaves
+// out some of its fields when they're empty, in which
+// case the size of its map is counted as it's written.
+func (s *Struct) OmitsEmpty() bool {
+	if s.AsTuple || s.MarshalAs != "" {
+		return false
+	}
+	for _, f := range s.EncodedFields() {
+		if f.OmitEmpty {
+			return true
+		}
+	}
+	return false
+}
+
+// EmptyExpr returns an expression that's true
+// if the field is empty, and is left out.
+func (s StructField) EmptyExpr() string { return emptyExpr(s.FieldElem, true) }
+
+// NonEmptyExpr returns an expression that's true
+// if the field isn't empty, and is written.
+func (s StructField) NonEmptyExpr() string { return emptyExpr(s.FieldElem, false) }
+
+// CanOmitEmpty returns whether or not it can be
+// told if an element is empty: pointers, slices,
+// maps and interfaces are empty if they're nil,
+// and other base types if they're zero. Named types
+// with generated methods (identifiers) are assumed
+// to be maps, slices or pointers, which the parser
+// makes sure of. Arrays and structs (including
+// net.IPNet) are never empty.
+func CanOmitEmpty(e Elem) bool { return emptyExpr(e, true) != "" }
+
+func emptyExpr(e Elem, empty bool) string {
+	eq := " == "
+	if !empty {
+		eq = " != "
+	}
+	switch e := e.(type) {
+	case *Ptr, *Slice, *Map:
+		return e.Varname() + eq + "nil"
+	case *BaseElem:
+		v := e.Varname()
+		if e.Value == IDENT {
+			return v + eq + "nil"
+		}
+		if e.Convert {
+			v = e.ToBase() + "(" + v + ")"
+		}
+		switch e.Value {
+		case Bytes, IP, Intf:
+			return v + eq + "nil"
+		case String:
+			return v + eq + `""`
+		case Bool:
+			if empty {
+				return "!" + v
+			}
+			return v
+		case Time:
+			if empty {
+				return v + ".IsZero()"
+			}
+			return "!" + v + ".IsZero()"
+		case Addr:
+			if empty {
+				return "!" + v + ".IsValid()"
+			}
+			return v + ".IsValid()"
+		case IPNet, Ext:
+			return ""
+		default:
+			return v + eq + "0"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,247 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// RandomTests is whether or not the generated tests
+// fill the values they encode with the Random{Type}
+// functions (see WriteRandom), instead of using
+// zero values
+var RandomTests bool
+
+// randomizer writes the statements that fill an
+// element with random values from the variable
+// 'r' (a *rand.Rand) of the function they're written
+// in, and those of the named types in it 'depth' deep
+type randomizer struct {
+	sampler
+}
+
+// randVar matches the uses of the variable 'r',
+// which aren't packages, in generated code
+var randVar = regexp.MustCompile(`\br\.`)
+
+// use is sampler.use for code that uses 'r'
+func (s *randomizer) use(code string) bool {
+	return s.sampler.use(randVar.ReplaceAllString(code, ""))
+}
+
+// base returns an expression for a random value of the
+// base type of 'e', and the condition of an if statement
+// it has to be assigned in, if any, or "" if the value
+// is always zero, as it is for extensions
+func (s *randomizer) base(e *BaseElem) (cond string, v string) {
+	switch e.Value {
+	case String:
+		return "", "msgpRandomString(r)"
+	case Bytes:
+		return "", "msgpRandomBytes(r)"
+	case Bool:
+		return "", "r.Intn(2) == 1"
+	case Float32, Float64:
+		return "", fmt.Sprintf("%s(r.NormFloat64() * 1e6)", e.BaseType())
+	case Complex64, Complex128:
+		return "", fmt.Sprintf("%s(complex(r.NormFloat64(), r.NormFloat64()))", e.BaseType())
+	case Uint, Uint8, Uint16, Uint32, Uint64, Byte:
+		return "", fmt.Sprintf("%s(msgpRandomUint(r))", e.BaseType())
+	case Int, Int8, Int16, Int32, Int64:
+		return "", fmt.Sprintf("%s(msgpRandomInt(r))", e.BaseType())
+	case Intf:
+		return "", "msgpRandomIntf(r)"
+	case Time:
+		if e.Epoch == "ns" {
+			// nanoseconds only fit in an
+			// int64 from 1678 to 2262
+			return "", "time.Unix(r.Int63n(1<<32)-1<<31, r.Int63n(1e9)).UTC()"
+		}
+		return "", "time.Unix(r.Int63n(1<<34)-1<<33, r.Int63n(1e9)).UTC()"
+	case IP:
+		return "", "net.IP(msgpRandomIP(r))"
+	case IPNet:
+		return "ip := msgpRandomIP(r); ip != nil", "net.IPNet{IP: ip, Mask: net.CIDRMask(r.Intn(8*len(ip)+1), 8*len(ip))}"
+	case Addr:
+		return "a, ok := netip.AddrFromSlice(msgpRandomIP(r)); ok", "a"
+	}
+	return "", ""
+}
+
+// elem writes the statements that fill
+// 'dst', which holds its zero value
+func (s *randomizer) elem(e Elem, dst string) {
+	switch e := e.(type) {
+	case *BaseElem:
+		if e.Value == IDENT {
+			// types that aren't generated here
+			// keep their zero values
+			if s.idents[e.Ident] {
+				s.printf("if depth > 0 {\n%s = random%s(r, depth-1)\n}\n", dst, e.Ident)
+			}
+			return
+		}
+		cond, v := s.base(e)
+		if v == "" {
+			return
+		}
+		if e.Convert {
+			v = e.FromBase() + "(" + v + ")"
+		}
+		if !s.use(cond) || !s.use(v) {
+			return
+		}
+		if cond != "" {
+			s.printf("if %s {\n%s = %s\n}\n", cond, dst, v)
+			return
+		}
+		s.printf("%s = %s\n", dst, v)
+
+	case *Ptr:
+		// one in four is nil
+		name, ok := s.typeName(e.Value)
+		if !ok {
+			return
+		}
+		s.printf("if r.Intn(4) > 0 {\n%s = new(%s)\n", dst, name)
+		s.elem(e.Value, deref(dst))
+		s.printf("}\n")
+
+	case *Slice:
+		name, ok := s.typeName(e)
+		if !ok {
+			return
+		}
+		s.printf("%s = make(%s, r.Intn(%d))\n", dst, name, maxRandomLen+1)
+		s.each(e.Els, dst)
+
+	case *Array:
+		s.each(e.Els, dst)
+
+	case *Map:
+		name, ok := s.typeName(e)
+		if !ok {
+			return
+		}
+		vname, ok := s.typeName(e.Value)
+		if !ok {
+			return
+		}
+		n := maxRandomLen
+		if e.MaxEntries > 0 && e.MaxEntries < uint32(n) {
+			n = int(e.MaxEntries)
+		}
+		key := "msgpRandomString(r)"
+		if e.IntKeys() {
+			key = e.KeyTypeName() + "(msgpRandomInt(r))"
+		} else if e.KeyIdent != "" {
+			key = e.KeyIdent + "(" + key + ")"
+		}
+		i, v := s.tmp("ri"), s.tmp("rv")
+		s.printf("%s = make(%s)\n", dst, name)
+		s.printf("for %s := r.Intn(%d); %s > 0; %s-- {\n", i, n+1, i, i)
+		s.printf("var %s %s\n", v, vname)
+		s.elem(e.Value, v)
+		s.printf("%s[%s] = %s\n}\n", dst, key, v)
+
+	case *Struct:
+		for _, f := range e.Fields {
+			s.elem(f.FieldElem, dst+"."+f.FieldName)
+		}
+	}
+}
+
+// each writes the statements that fill each
+// of the elements 'els' of the slice or array
+// 'dst', leaving out the loop if they keep
+// their zero values
+func (s *randomizer) each(els Elem, dst string) {
+	i := s.tmp("ri")
+	outer := s.buf
+	s.buf = new(bytes.Buffer)
+	s.elem(els, dst+"["+i+"]")
+	code := s.buf.String()
+	s.buf = outer
+	if code != "" {
+		s.printf("for %s := range %s {\n%s}\n", i, dst, code)
+	}
+}
+
+const (
+	// maxRandomLen is the most elements that
+	// a random slice or map is made with
+	maxRandomLen = 8
+
+	// randomDepth is how many levels deep the
+	// generated types in a random value are filled
+	randomDepth = 3
+)
+
+// randomFile is what random.tmpl is executed with
+type randomFile struct {
+	Depth int
+	Types []goldenType
+}
+
+// WriteRandom writes, for each of the named types in 'elems',
+// a function Random{Type} that returns a value of the type filled
+// with random values from a *rand.Rand, the same ones for the same
+// seed, and a test of that, using buf as scratch space. Strings
+// and slices are short, and types that contain themselves are
+// filled a few levels deep. The values may use the packages in
+// 'pkgs', which holds their import paths by the names they're
+// used under; values of types (or shims) from other packages are
+// left zero. It returns the packages that the functions import,
+// in the same form, which aren't written.
+func WriteRandom(w io.Writer, elems []Elem, pkgs map[string]string, buf *bytes.Buffer) (map[string]string, error) {
+	s := &randomizer{sampler{
+		buf:    new(bytes.Buffer),
+		idents: make(map[string]bool),
+		pkgs: map[string]string{
+			"time":  "time",
+			"net":   "net",
+			"netip": "net/netip",
+		},
+		imports: map[string]string{
+			"rand":    "math/rand",
+			"reflect": "reflect",
+			"testing": "testing",
+		},
+	}}
+	for name, path := range pkgs {
+		s.pkgs[name] = path
+	}
+	for name, path := range s.imports {
+		s.pkgs[name] = path
+	}
+	var ptrs []*Ptr
+	for _, el := range elems {
+		if p, ok := el.(*Ptr); ok {
+			ptrs = append(ptrs, p)
+			s.idents[p.Value.TypeName()] = true
+		}
+	}
+	f := randomFile{Depth: randomDepth}
+	for _, p := range ptrs {
+		s.buf.Reset()
+		s.tmps = 0
+		s.elem(p.Value, "v")
+		f.Types = append(f.Types, goldenType{
+			TypeName: p.Value.TypeName(),
+			Code:     strings.TrimSuffix(s.buf.String(), "\n"),
+		})
+	}
+	// only the helpers are written
+	// if there are no types
+	if len(f.Types) == 0 {
+		delete(s.imports, "reflect")
+		delete(s.imports, "testing")
+	}
+	err := execAndFormat(rndTemplate, w, f, buf)
+	if err != nil {
+		return nil, err
+	}
+	return s.imports, nil
+}
@@ -0,0 +1,154 @@
+package gen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Schema returns a compact description of the
+// struct: its name, then each field's Go name,
+// tag, whether it's only decoded or only encoded,
+// the transform it's passed through, if any, and
+// wire type, in declaration order.
+// (Declaration order is part of the schema, since
+// generated code writes fields in that order.)
+// Fields that refer to other named types are
+// described by the type name; those types have
+// schemas of their own. So does the type that
+// a struct is marshaled as (see MarshalAs).
+func (s *Struct) Schema() string {
+	var buf bytes.Buffer
+	buf.WriteString(s.Name)
+	writeSchema(&buf, s)
+	return buf.String()
+}
+
+// SchemaHash returns the SHA-256 hash
+// of s.Schema(), e.g. "sha256:9f86d0..."
+func (s *Struct) SchemaHash() string { return schemaHash(s.Schema()) }
+
+// Schema returns a compact description of the
+// named map: its name, then its key and value
+// types, which are described as struct fields are.
+func (m *Map) Schema() string {
+	var buf bytes.Buffer
+	buf.WriteString(m.Name)
+	writeSchema(&buf, m)
+	return buf.String()
+}
+
+// SchemaHash returns the SHA-256 hash
+// of m.Schema(), e.g. "sha256:9f86d0..."
+func (m *Map) SchemaHash() string { return schemaHash(m.Schema()) }
+
+// Schema returns a compact description of the
+// named slice: its name, then its element type,
+// which is described as struct fields are.
+func (s *Slice) Schema() string {
+	var buf bytes.Buffer
+	buf.WriteString(s.Name)
+	writeSchema(&buf, s)
+	return buf.String()
+}
+
+// SchemaHash returns the SHA-256 hash
+// of s.Schema(), e.g. "sha256:9f86d0..."
+func (s *Slice) SchemaHash() string { return schemaHash(s.Schema()) }
+
+// Schema returns a compact description of a
+// named base type, like a named []byte: its
+// name, then the type that it's written as.
+func (s *BaseElem) Schema() string {
+	var buf bytes.Buffer
+	buf.WriteString(s.Ident)
+	buf.WriteByte(' ')
+	writeSchema(&buf, &BaseElem{Value: s.Value})
+	return buf.String()
+}
+
+// SchemaHash returns the SHA-256 hash
+// of s.Schema(), e.g. "sha256:9f86d0..."
+func (s *BaseElem) SchemaHash() string { return schemaHash(s.Schema()) }
+
+func schemaHash(schema string) string {
+	sum := sha256.Sum256([]byte(schema))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func writeSchema(buf *bytes.Buffer, e Elem) {
+	switch e := e.(type) {
+	case *Struct:
+		// the wire type has a
+		// schema of its own
+		if e.MarshalAs != "" {
+			buf.WriteString(" as " + e.MarshalAs)
+			return
+		}
+		if e.AsTuple {
+			buf.WriteString("tuple")
+		}
+		buf.WriteByte('{')
+		for i, f := range e.Fields {
+			if i > 0 {
+				buf.WriteString("; ")
+			}
+			buf.WriteString(f.FieldName)
+			buf.WriteByte(' ')
+			buf.WriteString(strconv.Quote(f.FieldTag))
+			buf.WriteByte(' ')
+			switch {
+			case f.DecodeOnly:
+				buf.WriteString("decodeonly ")
+			case f.EncodeOnly:
+				buf.WriteString("encodeonly ")
+			}
+			if f.OmitEmpty {
+				buf.WriteString("omitempty ")
+			}
+			writeSchema(buf, f.FieldElem)
+		}
+		buf.WriteByte('}')
+	case *Ptr:
+		buf.WriteByte('*')
+		writeSchema(buf, e.Value)
+	case *Slice:
+		// a bitset is written
+		// unlike other slices
+		if e.Bitset {
+			buf.WriteString("bitset ")
+		}
+		buf.WriteString("[]")
+		writeSchema(buf, e.Els)
+	case *Array:
+		buf.WriteString("[" + e.Size + "]")
+		writeSchema(buf, e.Els)
+	case *Map:
+		// named key types are
+		// written as their base
+		key := "string"
+		if e.IntKeys() {
+			key = e.KeyTypeName()
+		}
+		buf.WriteString("map[" + key + "]")
+		writeSchema(buf, e.Value)
+	case *BaseElem:
+		// a transformed value is
+		// written as 'bin'
+		if e.Transform != "" {
+			buf.WriteString("transform=" + e.Transform + " ")
+		}
+		// a shimmed type is
+		// written as its base
+		if e.Value == IDENT {
+			buf.WriteString(e.Ident)
+		} else if e.IsEpoch() {
+			// an integer of the unit
+			buf.WriteString("epoch=" + e.Epoch + " time")
+		} else {
+			buf.WriteString(strings.ToLower(e.BaseName()))
+		}
+	}
+}
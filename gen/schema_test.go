@@ -0,0 +1,20 @@
+package gen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaTransform(t *testing.T) {
+	field := &BaseElem{Value: String}
+	s := &Struct{Name: "T", Fields: []StructField{{FieldName: "A", FieldTag: "a", FieldElem: field}}}
+	plain := s.SchemaHash()
+
+	field.Transform = "pii"
+	if !strings.Contains(s.Schema(), "transform=pii") {
+		t.Errorf("the schema %q doesn't name the transform", s.Schema())
+	}
+	if s.SchemaHash() == plain {
+		t.Error("adding a transform didn't change the schema hash")
+	}
+}
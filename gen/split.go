@@ -0,0 +1,109 @@
+package gen
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SplitFields is the number of fields above which
+// the methods of a struct are split up: each run of
+// at most SplitFields fields is handled by a helper
+// method of its own (encodeFieldGroup1, etc.), which
+// the generated methods call in turn, because huge
+// functions are slow to compile. Zero never splits.
+var SplitFields = 100
+
+// FieldGroup is a run of the fields of
+// a split struct (see SplitFields).
+type FieldGroup struct {
+	Struct *Struct
+	Num    int // from 1, in the name of the helper
+	Fields []StructField
+}
+
+// Split returns whether or not the methods
+// of the struct are split into helpers.
+func (s *Struct) Split() bool {
+	return SplitFields > 0 && s.MarshalAs == "" && len(s.Fields) > SplitFields
+}
+
+// EncodedGroups returns the encoded
+// fields of a split struct in groups.
+func (s *Struct) EncodedGroups() []FieldGroup {
+	return s.groups(s.EncodedFields())
+}
+
+// DecodedGroups returns the decoded
+// fields of a split struct in groups.
+func (s *Struct) DecodedGroups() []FieldGroup {
+	return s.groups(s.DecodedFields())
+}
+
+func (s *Struct) groups(fields []StructField) []FieldGroup {
+	var out []FieldGroup
+	for len(fields) > 0 {
+		n := SplitFields
+		if n > len(fields) {
+			n = len(fields)
+		}
+		out = append(out, FieldGroup{Struct: s, Num: len(out) + 1, Fields: fields[:n]})
+		fields = fields[n:]
+	}
+	return out
+}
+
+// Cases returns the tags of the fields in
+// the group as the list of a switch case.
+func (g FieldGroup) Cases() string {
+	tags := make([]string, len(g.Fields))
+	for i, f := range g.Fields {
+		tags[i] = strconv.Quote(f.FieldTag)
+	}
+	return strings.Join(tags, ", ")
+}
+
+// Span describes the fields in
+// the group for doc comments.
+func (g FieldGroup) Span() string {
+	first, last := g.Fields[0].FieldName, g.Fields[len(g.Fields)-1].FieldName
+	if first == last {
+		return first
+	}
+	return first + " through " + last
+}
+
+// ReadsKeys returns whether or not decoding the group
+// reads the keys of nested structs, which are never
+// tuples, into 'field', which the tuple helpers
+// have to declare, then.
+func (g FieldGroup) ReadsKeys() bool {
+	for _, f := range g.Fields {
+		if hasStruct(f.FieldElem) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasStruct(e Elem) bool {
+	switch e := e.(type) {
+	case *Struct:
+		return true
+	case *Ptr:
+		return hasStruct(e.Value)
+	case *Slice:
+		return hasStruct(e.Els)
+	case *Array:
+		return hasStruct(e.Els)
+	case *Map:
+		return hasStruct(e.Value)
+	default:
+		return false
+	}
+}
+
+// MarshalChunks is Struct.MarshalChunks for
+// the fields in the group, without the header.
+func (g FieldGroup) MarshalChunks() []Chunk {
+	return marshalChunks(nil, g.Fields, g.Struct.AsTuple)
+}
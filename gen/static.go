@@ -0,0 +1,160 @@
+package gen
+
+import (
+	"strconv"
+
+	"github.com/philhofer/msgp/msgp"
+)
+
+// Static is a run of objects whose encoding is
+// known (or known in size) at generation time.
+// It is appended with a single capacity check.
+type Static struct {
+	Size  int          // total encoded size
+	Parts []StaticPart // in order
+}
+
+// StaticPart is either a literal (a header or
+// a field key) or a bool field.
+type StaticPart struct {
+	Offset int       // offset into the run
+	Lit    string    // quoted literal bytes, if any
+	Bool   *BaseElem // bool field, if not a literal
+}
+
+// Index returns the index expression for the
+// start of the part in generated code.
+func (p StaticPart) Index() string {
+	if p.Offset == 0 {
+		return "n"
+	}
+	return "n+" + strconv.Itoa(p.Offset)
+}
+
+// HasBools returns whether or not the run contains
+// bool fields. If it doesn't, it is a single literal.
+func (s *Static) HasBools() bool {
+	for _, p := range s.Parts {
+		if p.Bool != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Lit returns the quoted literal for
+// a run without any bool fields.
+func (s *Static) Lit() string { return s.Parts[0].Lit }
+
+func (s *Static) addLit(b []byte) {
+	if n := len(s.Parts); n > 0 && s.Parts[n-1].Bool == nil {
+		prev := s.Parts[n-1]
+		lit, _ := strconv.Unquote(prev.Lit)
+		s.Parts[n-1].Lit = strconv.Quote(lit + string(b))
+	} else {
+		s.Parts = append(s.Parts, StaticPart{Offset: s.Size, Lit: strconv.Quote(string(b))})
+	}
+	s.Size += len(b)
+}
+
+func (s *Static) addBool(b *BaseElem) {
+	s.Parts = append(s.Parts, StaticPart{Offset: s.Size, Bool: b})
+	s.Size++
+}
+
+// KeysSize returns the encoded size of the
+// header of the struct and, unless it's a
+// tuple, the keys of its fields.
+func (s *Struct) KeysSize() int {
+	fields := s.EncodedFields()
+	n := msgp.MapHeaderSizeFor(uint32(len(fields)))
+	if !s.AsTuple {
+		for _, f := range fields {
+			n += msgp.StringSize(f.FieldTag)
+		}
+	}
+	return n
+}
+
+// Chunk is part of the marshaled form of a
+// struct: an optional static run followed by
+// an optional element that isn't static.
+type Chunk struct {
+	Static *Static
+	Elem   Elem
+	Cond   string // if set, the chunk is only written if it's true (see StructField.OmitEmpty)
+}
+
+// isStaticBool returns whether or not the
+// element is a bool encoded as a single byte.
+func isStaticBool(e Elem) bool {
+	b := e.Base()
+	return b != nil && b.Value == Bool && !b.IsTransform()
+}
+
+// MarshalChunks splits the marshaled form of the
+// struct into chunks, so that headers, field keys,
+// and bool fields are written together with one
+// capacity check instead of one per object.
+func (s *Struct) MarshalChunks() []Chunk {
+	fields := s.EncodedFields()
+	var header []byte
+	switch {
+	case s.OmitsEmpty():
+		// the header is written once the
+		// fields that are written are counted
+	case s.AsTuple:
+		header = msgp.AppendArrayHeader(nil, uint32(len(fields)))
+	default:
+		header = msgp.AppendMapHeader(nil, uint32(len(fields)))
+	}
+	return marshalChunks(header, fields, s.AsTuple)
+}
+
+func marshalChunks(header []byte, fields []StructField, asTuple bool) []Chunk {
+	var (
+		chunks []Chunk
+		cur    = &Static{}
+	)
+	flush := func(e Elem) {
+		c := Chunk{Elem: e}
+		if len(cur.Parts) > 0 {
+			c.Static = cur
+			cur = &Static{}
+		}
+		chunks = append(chunks, c)
+	}
+	if header != nil {
+		cur.addLit(header)
+	}
+	for _, f := range fields {
+		// a field that may be left out
+		// is a chunk of its own
+		if f.OmitEmpty && !asTuple {
+			if len(cur.Parts) > 0 {
+				flush(nil)
+			}
+			c := Chunk{Static: &Static{}, Cond: f.NonEmptyExpr()}
+			c.Static.addLit(msgp.AppendString(nil, f.FieldTag))
+			if isStaticBool(f.FieldElem) {
+				c.Static.addBool(f.FieldElem.Base())
+			} else {
+				c.Elem = f.FieldElem
+			}
+			chunks = append(chunks, c)
+			continue
+		}
+		if !asTuple {
+			cur.addLit(msgp.AppendString(nil, f.FieldTag))
+		}
+		if isStaticBool(f.FieldElem) {
+			cur.addBool(f.FieldElem.Base())
+			continue
+		}
+		flush(f.FieldElem)
+	}
+	if len(cur.Parts) > 0 {
+		flush(nil)
+	}
+	return chunks
+}
@@ -5,14 +5,14 @@ import (
 	"io"
 )
 
-// WriteMarshalUnmarshalTests writes tests for s.MarshalMsg and s.UnmarshalMsg, using
-// buf as scratch space
-func WriteMarshalUnmarshalTests(w io.Writer, s *Struct, buf *bytes.Buffer) error {
-	return execAndFormat(marshalTestTemplate, w, s, buf)
+// WriteMarshalUnmarshalTests writes tests for e.MarshalMsg and e.UnmarshalMsg,
+// where 'e' is a named type, using buf as scratch space
+func WriteMarshalUnmarshalTests(w io.Writer, e Elem, buf *bytes.Buffer) error {
+	return execAndFormat(marshalTestTemplate, w, e, buf)
 }
 
-// WriteEncodeDecodeTests writes tests for s.EncodeMsg and s.DecodeMsg, using
-// buf as scratch space
-func WriteEncodeDecodeTests(w io.Writer, s *Struct, buf *bytes.Buffer) error {
-	return execAndFormat(encodeTestTemplate, w, s, buf)
+// WriteEncodeDecodeTests writes tests for e.EncodeMsg and e.DecodeMsg,
+// where 'e' is a named type, using buf as scratch space
+func WriteEncodeDecodeTests(w io.Writer, e Elem, buf *bytes.Buffer) error {
+	return execAndFormat(encodeTestTemplate, w, e, buf)
 }
@@ -1,53 +1,125 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/philhofer/msgp/gen"
+	"github.com/philhofer/msgp/msgp"
 	"github.com/philhofer/msgp/parse"
 	"github.com/ttacon/chalk"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 var (
 	// command line flags
-	out     string // output file
-	file    string // input file (or directory)
-	pkg     string // output package name
-	encode  bool   // write io.Writer/io.Reader-based methods
-	marshal bool   // write []byte-based methods
-	tests   bool   // write test file
+	out           string // output file
+	file          string // input files, globs (or a directory)
+	pkg           string // output package name (or input import path)
+	encode        bool   // write io.Writer/io.Reader-based methods
+	marshal       bool   // write []byte-based methods
+	tests         bool   // write test file
+	runtimeImport string // import path of the msgp runtime
+	strict        bool   // fail on tag problems, skipped fields and unresolved identifiers
+	clone         bool   // write Clone and CopyTo methods
+	schema        bool   // write schema fingerprints
+	descriptors   bool   // write runtime type descriptors
+	quiet         bool   // only print warnings and errors
+	verbose       bool   // print progress, too
+	methodSuffix  string // appended to the names of the generated methods
+	splitFields   int    // split the methods of structs with more fields
+	nocheck       bool   // don't type-check the generated file
+	nojson        bool   // don't fall back to json tags
+	unexported    bool   // generate unexported types and fields, too
+	analyze       bool   // print findings about wire-inefficient types
+	golden        string // directory of golden files for the wire format tests
+	maxBytes      int    // fail if the generated file would be larger
+	observe       bool   // write UnmarshalMsgObserved methods
+	batch         bool   // write Unmarshal{Type}Batch functions
+	random        bool   // write Random{Type} functions for the tests
+	fuzz          bool   // write Fuzz{Type} fuzz tests
+	cleanStale    bool   // remove generated files when there's nothing to generate
+
+	// where messages are printed, and
+	// whether or not they're in color
+	logw  io.Writer = os.Stderr
+	color bool
+
+	// import path of the msgp runtime
+	// that this tool was built against
+	defaultRuntime = reflect.TypeOf(msgp.Reader{}).PkgPath()
 
 	// marshal/unmarshal imports
-	injectImports []string = []string{
-		"github.com/philhofer/msgp/msgp",
-	}
+	// (in addition to the runtime)
+	injectImports []string = []string{}
 
 	// testing imports
+	// (in addition to the runtime)
 	testImport []string = []string{
 		"testing",
-		"bytes",
-		"github.com/philhofer/msgp/msgp",
 	}
 )
 
 func init() {
-	flag.StringVar(&out, "o", "", "output file")
-	flag.StringVar(&file, "file", "", "input file")
-	flag.StringVar(&pkg, "pkg", "", "output package")
+	flag.StringVar(&out, "o", "", "output file, or directory to put it in (created if need be)")
+	flag.StringVar(&file, "file", "", "input file, directory, or comma-separated list of files and glob patterns")
+	flag.StringVar(&pkg, "pkg", "", "output package, or the import path of the package to generate methods for, in place of -file")
 	flag.BoolVar(&encode, "io", true, "create Encode and Decode methods")
 	flag.BoolVar(&marshal, "marshal", true, "create Marshal and Unmarshal methods")
 	flag.BoolVar(&tests, "tests", true, "create tests and benchmarks")
+	flag.StringVar(&runtimeImport, "import", defaultRuntime, "import path of the msgp runtime package")
+	flag.BoolVar(&strict, "strict", false, "fail on unknown or malformed struct tag options, fields that are skipped, and unresolved identifiers")
+	flag.BoolVar(&clone, "clone", false, "create Clone and CopyTo methods")
+	flag.BoolVar(&schema, "schema", false, "create schema hash constants and description functions")
+	flag.BoolVar(&descriptors, "descriptors", false, "create a msgp.TypeDescriptor variable for each struct, describing its fields as they're written")
+	flag.BoolVar(&quiet, "q", false, "only print warnings and errors (the default if stdout isn't a terminal)")
+	flag.StringVar(&methodSuffix, "method-suffix", "", "append `suffix` to the names of the generated methods (MarshalMsg, etc.)")
+	flag.IntVar(&splitFields, "split", gen.SplitFields, "split the methods of structs with more than `N` fields into helpers of N fields each (0 never splits)")
+	flag.BoolVar(&nocheck, "nocheck", false, "don't type-check the generated file with the rest of its package")
+	flag.BoolVar(&nojson, "nojson", false, "name fields without msg tags by their Go names, even if they have json tags")
+	flag.BoolVar(&unexported, "unexported", false, "generate methods for unexported types, and read and write unexported fields")
+	flag.BoolVar(&analyze, "analyze", false, "print findings about types that are wasteful on the wire (under -strict, errors among them fail)")
+	flag.StringVar(&golden, "golden", "", "create tests that compare the encoding of a sample of each type to the golden files in `dir`")
+	flag.IntVar(&maxBytes, "maxbytes", 0, "fail if the generated file would be larger than `N` bytes, listing the types that take up the most of it (0 is no limit)")
+	flag.BoolVar(&observe, "observe", false, "create an UnmarshalMsgObserved method for each struct, which reports the keys it skipped")
+	flag.BoolVar(&batch, "batch", false, "create an Unmarshal{Type}Batch function for each type, which unmarshals the messages that a []byte holds one after another into one value")
+	flag.BoolVar(&random, "random", false, "create a Random{Type} function for each type, which the tests use instead of zero values")
+	flag.BoolVar(&fuzz, "fuzz", false, "create a Fuzz{Type} test for each type, which decodes mutations of its encoding (go test -fuzz)")
+	flag.BoolVar(&cleanStale, "clean", false, "when there are no types to generate methods for, remove the files generated by an earlier run")
+	flag.BoolVar(&verbose, "v", false, "print each type as it's processed (the default if stdout is a terminal)")
 }
 
 func main() {
 	flag.Parse()
 
+	// -pkg may be the import path of
+	// the package to generate, instead
+	if pkg != "" && !token.IsIdentifier(pkg) {
+		if file != "" {
+			errorf("-pkg %s is an import path, so -file can't be used with it\n", pkg)
+			os.Exit(1)
+		}
+		var err error
+		file, err = packageInput(pkg)
+		if err != nil {
+			errorf("%s\n", err)
+			os.Exit(1)
+		}
+		pkg = ""
+	}
+
 	// GOFILE and GOPACKAGE are
 	// set by `go generate`
 	if file == "" {
@@ -57,29 +129,110 @@ func main() {
 		pkg = os.Getenv("GOPACKAGE")
 	}
 
+	color = isTerminal(os.Stderr) && os.Getenv("NO_COLOR") == ""
+	if quiet && verbose {
+		errorf("-q and -v can't be used together\n")
+		os.Exit(1)
+	}
+	if !quiet && !verbose {
+		verbose = isTerminal(os.Stdout)
+	}
+
 	if file == "" {
-		fmt.Println(chalk.Red.Color("No file to parse."))
+		errorf("No file to parse.\n")
 		os.Exit(1)
 	}
 
 	if !encode && !marshal {
-		fmt.Println(chalk.Red.Color("No methods to generate; -io=false AND -marshal=false"))
+		errorf("No methods to generate; -io=false AND -marshal=false\n")
+		os.Exit(1)
+	}
+
+	if runtimeImport == "" {
+		errorf("No runtime import path; -import is empty\n")
+		os.Exit(1)
+	}
+
+	if golden != "" && !marshal {
+		errorf("-golden needs the Marshal methods; -marshal=false\n")
+		os.Exit(1)
+	}
+
+	if random && !tests {
+		errorf("-random needs the tests; -tests=false\n")
+		os.Exit(1)
+	}
+
+	if observe && !marshal {
+		errorf("-observe needs the Marshal methods; -marshal=false\n")
+		os.Exit(1)
+	}
+
+	if batch && !marshal {
+		errorf("-batch needs the Marshal methods; -marshal=false\n")
+		os.Exit(1)
+	}
+
+	if splitFields < 0 {
+		errorf("-split %d is negative\n", splitFields)
+		os.Exit(1)
+	}
+
+	if maxBytes < 0 {
+		errorf("-maxbytes %d is negative\n", maxBytes)
+		os.Exit(1)
+	}
+
+	if !token.IsIdentifier("Msg" + methodSuffix) {
+		errorf("-method-suffix %q can't be part of a method name\n", methodSuffix)
 		os.Exit(1)
 	}
 
 	err := DoAll(pkg, file, marshal, encode, tests)
 	if err != nil {
-		fmt.Println(chalk.Red.Color(err.Error()))
+		errorf("%s\n", err)
 		os.Exit(1)
 	}
 }
 
+// isTerminal returns whether
+// or not 'f' is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// so is /dev/null
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(fi, null)
+}
+
+// printf prints a message to logw,
+// in color 'c' if color is on
+func printf(c chalk.Color, s string, v ...interface{}) {
+	if color {
+		s = c.Color(s)
+	}
+	fmt.Fprintf(logw, s, v...)
+}
+
+// progressf prints progress,
+// which is only shown with -v
+func progressf(c chalk.Color, s string, v ...interface{}) {
+	if verbose {
+		printf(c, s, v...)
+	}
+}
+
+func errorf(s string, v ...interface{}) { printf(chalk.Red, s, v...) }
+
 // DoAll writes all methods using the associated file and package.
 // (The package is only relevant for writing the new file's package declaration.)
+// Generated files import the msgp runtime from the path set by -import.
 func DoAll(gopkg string, gofile string, marshal bool, encode bool, tests bool) error {
 	var (
-		testwr *bufio.Writer // location to write tests, if applicable
-		outwr  *bufio.Writer // location to write methods
+		testwr bytes.Buffer // tests, if applicable, written out with the methods
+		outwr  bytes.Buffer // methods, written out once they're checked
 	)
 
 	// ...nothing to do!
@@ -87,21 +240,62 @@ func DoAll(gopkg string, gofile string, marshal bool, encode bool, tests bool) e
 		return nil
 	}
 
+	files, err := inputFiles(gofile)
+	if err != nil {
+		return err
+	}
+	// a list of files is generated
+	// into one file, as a directory is
+	isList := len(files) != 1 || files[0] != gofile
+
 	var isDir bool
 	if fInfo, err := os.Stat(gofile); err == nil && fInfo.IsDir() {
 		isDir = true
 	}
 
 	if isDir {
-		fmt.Printf(chalk.Magenta.Color("========= %s =========\n"), filepath.Clean(gofile))
+		progressf(chalk.Magenta, "========= %s =========\n", filepath.Clean(gofile))
 	} else {
-		fmt.Printf(chalk.Magenta.Color("========= %s =========\n"), gofile)
+		progressf(chalk.Magenta, "========= %s =========\n", gofile)
 	}
 
-	elems, pkgName, err := parse.GetElems(gofile)
+	opts := parse.Options{
+		Strict:     strict,
+		NoJSONTags: nojson,
+		Unexported: unexported,
+		Methods:    generatedMethods(marshal, encode),
+		Verbose:    verbose,
+		Color:      color,
+		Log:        logw,
+	}
+	if out != "" && !outputIsDir(out) {
+		opts.Output = out
+	}
+	gen.MethodSuffix = methodSuffix
+	gen.NoMarshal = !marshal
+	gen.SplitFields = splitFields
+	gen.RandomTests = random
+	var (
+		fs    *parse.FileSet
+		elems []gen.Elem
+	)
+	if isList {
+		fs, elems, err = parse.GetFiles(files, opts)
+	} else {
+		fs, elems, err = parse.GetFile(gofile, opts)
+	}
+	// the output of a list of files
+	// goes where a directory's would
+	if isList {
+		gofile, isDir = filepath.Dir(files[0]), true
+	}
+	if nd, ok := err.(*parse.NoDefinitionsError); ok {
+		return nothingToGenerate(nd, outputFile(gofile, isDir, nd.Package), tests)
+	}
 	if err != nil {
 		return err
 	}
+	pkgName := fs.Package
 
 	// use the parsed
 	// package name if it
@@ -110,152 +304,710 @@ func DoAll(gopkg string, gofile string, marshal bool, encode bool, tests bool) e
 		gopkg = pkgName
 	}
 
-	// no need to continue if
-	// we don't need to generate anything
-	if len(elems) == 0 {
-		fmt.Println(chalk.Magenta.Color("No structs requiring code generation were found..."))
-		return nil
-	}
-
-	var newfile string // new file name
-	if out != "" {
-		newfile = out
-		if pre := strings.TrimPrefix(out, gofile); len(pre) > 0 &&
-			!strings.HasSuffix(out, ".go") {
-			newfile = filepath.Join(gofile, out)
-		}
-	} else {
-		// small sanity check if gofile == . or dir
-		// let's just stat it again, not too costly
-		if isDir {
-			gofile = filepath.Join(gofile, pkgName)
+	if analyze {
+		err = reportFindings(analyzeTypes(fs, elems))
+		if err != nil {
+			return err
 		}
-		// new file name is old file name + _gen.go
-		newfile = strings.TrimSuffix(gofile, ".go") + "_gen.go"
-	}
-
-	// GENERATED FILES
-
-	//////////////////
-	/// MAIN FILE ////
-	file, err := os.Create(newfile)
-	if err != nil {
-		return err
 	}
-	defer file.Close()
 
-	outwr = bufio.NewWriter(file)
-
-	err = writePkgHeader(outwr, gopkg)
-	if err != nil {
-		return err
+	newfile := outputFile(gofile, isDir, pkgName)
+	pkgDir := gofile
+	if !isDir {
+		pkgDir = filepath.Dir(gofile)
 	}
-
-	err = writeImportHeader(outwr, injectImports...)
-	if err != nil {
-		return err
+	if outsidePackage(newfile, pkgDir) {
+		printf(chalk.Yellow, "warning: %s isn't in %s, the directory of package %s; methods have to be declared in the package of their types\n", newfile, filepath.Clean(pkgDir), pkgName)
 	}
 
-	///////////////////
+	// GENERATED FILES
 
 	///////////////////
 	// TESTING FILE  //
 	var testfile string
 	if tests {
 		testfile = strings.TrimSuffix(newfile, ".go") + "_test.go"
-		tfl, err := os.Create(testfile)
-		if err != nil {
-			return err
-		}
-		defer tfl.Close()
-		testwr = bufio.NewWriter(tfl)
-		err = writePkgHeader(testwr, gopkg)
-		if err != nil {
-			return err
+		writePkgHeader(&testwr, gopkg)
+		imports := testImport
+		if encode {
+			// only the EncodeMsg tests use a bytes.Buffer
+			imports = append(imports[:len(imports):len(imports)], "bytes")
 		}
-		err = writeImportHeader(testwr, testImport...)
-		if err != nil {
-			return err
+		if random {
+			imports = append(imports[:len(imports):len(imports)], "math/rand")
 		}
+		writeImportHeader(&testwr, importSpecs(imports)...)
 	}
 
 	//////////////////
 	var buf bytes.Buffer
+	sizes := make(map[string]int) // bytes of generated code, by type
 	for _, el := range elems {
 		p, ok := el.(*gen.Ptr)
-		if !ok || p.Value.Type() != gen.StructType {
+		if !ok {
 			continue
 		}
+		start := outwr.Len()
+
+		err = gen.WriteTupleOrder(&outwr, p, &buf)
+		if err != nil {
+			return err
+		}
 
 		if marshal {
 			// write MarshalMsg()
-			err = gen.WriteMarshalUnmarshal(outwr, p, &buf)
+			err = gen.WriteMarshalUnmarshal(&outwr, p, &buf)
 			if err != nil {
-				outwr.Flush()
 				return err
 			}
 
+			if observe {
+				err = gen.WriteObserved(&outwr, p, &buf)
+				if err != nil {
+					return err
+				}
+			}
+
+			if batch {
+				err = gen.WriteBatch(&outwr, p, &buf)
+				if err != nil {
+					return err
+				}
+			}
+
 			if tests {
-				err = gen.WriteMarshalUnmarshalTests(testwr, p.Value.Struct(), &buf)
+				err = gen.WriteMarshalUnmarshalTests(&testwr, p.Value, &buf)
 				if err != nil {
-					testwr.Flush()
 					return err
 				}
 			}
 		}
 
 		if encode {
-			err = gen.WriteEncodeDecode(outwr, p, &buf)
+			err = gen.WriteEncodeDecode(&outwr, p, &buf)
 			if err != nil {
-				outwr.Flush()
 				return err
 			}
 
 			if tests {
-				err = gen.WriteEncodeDecodeTests(testwr, p.Value.Struct(), &buf)
+				err = gen.WriteEncodeDecodeTests(&testwr, p.Value, &buf)
 				if err != nil {
-					testwr.Flush()
 					return err
 				}
 			}
 		}
+
+		if clone {
+			err = gen.WriteClone(&outwr, p, &buf)
+			if err != nil {
+				return err
+			}
+		}
+
+		if schema {
+			err = gen.WriteSchema(&outwr, p, &buf)
+			if err != nil {
+				return err
+			}
+		}
+
+		if descriptors {
+			err = gen.WriteDescriptor(&outwr, p, &buf)
+			if err != nil {
+				return err
+			}
+		}
+
+		if methodSuffix != "" {
+			err = gen.WriteAdapter(&outwr, p, marshal, encode, &buf)
+			if err != nil {
+				return err
+			}
+		}
+		sizes[p.Value.TypeName()] += outwr.Len() - start
 	}
 
-	fmt.Printf(chalk.Magenta.Color("OUTPUT ======> %s "), newfile)
-	err = outwr.Flush()
+	///////////////////
+	// GOLDEN TESTS  //
+	var (
+		goldenfile string
+		goldenwr   bytes.Buffer
+	)
+	if golden != "" {
+		goldenfile = strings.TrimSuffix(newfile, ".go") + "_golden_test.go"
+		err = writeGoldenTests(&goldenwr, gopkg, goldenfile, elems, fs.Imports, &buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	///////////////////
+	// RANDOM VALUES //
+	var (
+		randomfile string
+		randomwr   bytes.Buffer
+	)
+	if random {
+		randomfile = strings.TrimSuffix(newfile, ".go") + "_random_test.go"
+		err = writeRandom(&randomwr, gopkg, elems, fs.Imports, &buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	////////////////
+	// FUZZ TESTS //
+	var (
+		fuzzfile string
+		fuzzwr   bytes.Buffer
+	)
+	if fuzz {
+		fuzzfile = strings.TrimSuffix(newfile, ".go") + "_fuzz_test.go"
+		err = writeFuzzTests(&fuzzwr, gopkg, elems, encode, fs.Imports, &buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	imports, err := fileImports(outwr.Bytes(), fs)
+	if err != nil {
+		return err
+	}
+
+	src := fileSource(gopkg, importSpecs(injectImports, imports...), outwr.Bytes())
+	if maxBytes > 0 && len(src) > maxBytes {
+		return overBudget(len(src), sizes)
+	}
+	if !nocheck {
+		err = typeCheck(fs, newfile, gopkg, src)
+		if err != nil {
+			return err
+		}
+	}
+
+	//////////////////
+	/// MAIN FILE ////
+	progressf(chalk.Magenta, "OUTPUT ======> %s ", newfile)
+	err = os.MkdirAll(filepath.Dir(newfile), 0777)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(newfile, src, 0666)
 	if err != nil {
 		return err
 	}
-	fmt.Print(chalk.Green.Color("\u2713\n"))
+	progressf(chalk.Green, "\u2713\n")
 	if tests {
-		fmt.Printf(chalk.Magenta.Color("TESTS =====> %s "), testfile)
-		err = testwr.Flush()
+		progressf(chalk.Magenta, "TESTS =====> %s ", testfile)
+		err = ioutil.WriteFile(testfile, testwr.Bytes(), 0666)
+		if err != nil {
+			return err
+		}
+		progressf(chalk.Green, "\u2713\n")
+	}
+	if golden != "" {
+		progressf(chalk.Magenta, "GOLDEN ====> %s ", goldenfile)
+		err = ioutil.WriteFile(goldenfile, goldenwr.Bytes(), 0666)
+		if err != nil {
+			return err
+		}
+		progressf(chalk.Green, "\u2713\n")
+	}
+	if random {
+		progressf(chalk.Magenta, "RANDOM ====> %s ", randomfile)
+		err = ioutil.WriteFile(randomfile, randomwr.Bytes(), 0666)
 		if err != nil {
 			return err
 		}
+		progressf(chalk.Green, "\u2713\n")
+	}
+	if fuzz {
+		progressf(chalk.Magenta, "FUZZ ======> %s ", fuzzfile)
+		err = ioutil.WriteFile(fuzzfile, fuzzwr.Bytes(), 0666)
+		if err != nil {
+			return err
+		}
+		progressf(chalk.Green, "\u2713\n")
+	}
+	return nil
+}
+
+// outputFile returns the name of the generated file for
+// 'gofile', the input file or directory, which is in the
+// package 'pkgName': the input's name + _gen.go, or the
+// package's name + _gen.go for a directory. -o replaces
+// it, unless -o is a directory, which it's put in.
+func outputFile(gofile string, isDir bool, pkgName string) string {
+	if isDir {
+		gofile = filepath.Join(gofile, pkgName)
+	}
+	name := strings.TrimSuffix(gofile, ".go") + "_gen.go"
+	switch {
+	case out == "":
+		return name
+	case outputIsDir(out):
+		return filepath.Join(out, filepath.Base(name))
+	default:
+		return out
+	}
+}
 
+// outputIsDir returns whether or not the output
+// 'o' names a directory: one that exists, or any
+// path that ends in a separator
+func outputIsDir(o string) bool {
+	if strings.HasSuffix(o, "/") || strings.HasSuffix(o, string(filepath.Separator)) {
+		return true
+	}
+	fi, err := os.Stat(o)
+	return err == nil && fi.IsDir()
+}
+
+// outsidePackage returns whether or not the generated
+// file 'newfile' isn't in 'dir', the directory of the
+// input's package, where the methods of its types have
+// to be declared
+func outsidePackage(newfile string, dir string) bool {
+	want, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	got, err := filepath.Abs(filepath.Dir(newfile))
+	if err != nil {
+		return false
+	}
+	return got != want
+}
+
+// packageInput returns the input files of the package
+// with the import path 'path', found from the working
+// directory, as -file lists them: the files of it that
+// are built, without its tests or the files that this
+// tool generated. Unless -o is set, the output goes in
+// the package's directory, named as a directory's is.
+func packageInput(path string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	dir, name, files, err := parse.PackageFiles(path, wd)
+	if err != nil {
+		return "", err
+	}
+	var list []string
+	for _, f := range files {
+		ok, err := isGenerated(f)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			list = append(list, f)
+		}
+	}
+	if len(list) == 0 {
+		return "", fmt.Errorf("package %s has only generated files (in %s)", path, dir)
+	}
+	if out == "" {
+		out = filepath.Join(dir, name+"_gen.go")
+	}
+	return strings.Join(list, ","), nil
+}
+
+// nothingToGenerate prints a notice that there
+// are no types to generate methods for, as 'nd'
+// says, and writes nothing. Under -clean, the files
+// that an earlier run generated for 'newfile' (the
+// methods, tests, golden tests, random values and
+// fuzz tests) are removed, since the methods of
+// deleted types would otherwise break the build;
+// files that this tool didn't write are left alone.
+func nothingToGenerate(nd *parse.NoDefinitionsError, newfile string, tests bool) error {
+	if !quiet {
+		printf(chalk.Yellow, "nothing to generate: %s; no files were written\n", nd)
+	}
+	if !cleanStale {
+		return nil
+	}
+	stale := []string{newfile}
+	if tests {
+		stale = append(stale, strings.TrimSuffix(newfile, ".go")+"_test.go")
+	}
+	if golden != "" {
+		stale = append(stale, strings.TrimSuffix(newfile, ".go")+"_golden_test.go")
+	}
+	if random {
+		stale = append(stale, strings.TrimSuffix(newfile, ".go")+"_random_test.go")
+	}
+	if fuzz {
+		stale = append(stale, strings.TrimSuffix(newfile, ".go")+"_fuzz_test.go")
+	}
+	for _, name := range stale {
+		ok, err := isGenerated(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		err = os.Remove(name)
+		if err != nil {
+			return err
+		}
+		if !quiet {
+			printf(chalk.Yellow, "removed %s, which was generated for types that are gone\n", name)
+		}
 	}
-	fmt.Print(chalk.Green.Color("\u2713\n"))
 	return nil
 }
 
+// isGenerated returns whether or not 'name' is a
+// file that this tool wrote (see writePkgHeader);
+// a file that doesn't exist isn't
+func isGenerated(name string) (bool, error) {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return bytes.Contains(head[:n], []byte(generatedMark)), nil
+}
+
+// generatedMark is in the header of every generated file
+const generatedMark = "MSGP CODE GENERATION TOOL"
+
+// writeGoldenTests writes the file of golden tests of
+// 'elems', to go in 'file', which find the golden files
+// (in -golden, which is relative to the working directory)
+// from the directory that 'file' is in, where tests run.
+// Samples may use the runtime and the 'imports' declared
+// with directives, as shims do.
+func writeGoldenTests(w io.Writer, gopkg string, file string, elems []gen.Elem, imports []parse.Import, buf *bytes.Buffer) error {
+	dir := golden
+	if !filepath.IsAbs(dir) {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		base, err := filepath.Abs(filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		dir, err = filepath.Rel(base, abs)
+		if err != nil {
+			return err
+		}
+	}
+	var code bytes.Buffer
+	used, err := gen.WriteGoldenTests(&code, elems, filepath.ToSlash(dir), testPackages(imports), buf)
+	if err != nil {
+		return err
+	}
+	writePkgHeader(w, gopkg)
+	writeImportHeader(w, importPaths(used)...)
+	_, err = w.Write(code.Bytes())
+	return err
+}
+
+// writeRandom writes the file of the Random{Type} functions
+// of 'elems', which may use the runtime and the 'imports'
+// declared with directives, as golden samples do.
+func writeRandom(w io.Writer, gopkg string, elems []gen.Elem, imports []parse.Import, buf *bytes.Buffer) error {
+	var code bytes.Buffer
+	used, err := gen.WriteRandom(&code, elems, testPackages(imports), buf)
+	if err != nil {
+		return err
+	}
+	writePkgHeader(w, gopkg)
+	writeImportHeader(w, importPaths(used)...)
+	_, err = w.Write(code.Bytes())
+	return err
+}
+
+// writeFuzzTests writes the file of the fuzz tests of
+// 'elems', which fuzz DecodeMsg, too, if 'decode', and
+// whose seeds may use the runtime and the 'imports'
+// declared with directives, as golden samples do.
+func writeFuzzTests(w io.Writer, gopkg string, elems []gen.Elem, decode bool, imports []parse.Import, buf *bytes.Buffer) error {
+	var code bytes.Buffer
+	used, err := gen.WriteFuzzTests(&code, elems, decode, testPackages(imports), buf)
+	if err != nil {
+		return err
+	}
+	writePkgHeader(w, gopkg)
+	writeImportHeader(w, importPaths(used)...)
+	_, err = w.Write(code.Bytes())
+	return err
+}
+
+// testPackages returns the import paths of the packages
+// that generated test code can use, by the names they're
+// used under: the runtime and the 'imports' declared
+// with directives
+func testPackages(imports []parse.Import) map[string]string {
+	pkgs := map[string]string{"msgp": runtimeImport}
+	for _, im := range imports {
+		name := im.Name
+		if name == "" {
+			name = path.Base(im.Path)
+		}
+		pkgs[name] = im.Path
+	}
+	return pkgs
+}
+
+// importPaths returns the import specs of the packages
+// in 'used', which holds their paths by the names
+// they're used under, sorted by path
+func importPaths(used map[string]string) []string {
+	names := make([]string, 0, len(used))
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return used[names[i]] < used[names[j]] })
+	specs := make([]string, len(names))
+	for i, name := range names {
+		specs[i] = strconv.Quote(used[name])
+		if path.Base(used[name]) != name {
+			specs[i] = name + " " + specs[i]
+		}
+	}
+	return specs
+}
+
+// inputFiles expands the -file argument, which is
+// a file, a directory, or a comma-separated list
+// of files and glob patterns, and returns the files,
+// sorted. Patterns are expanded here, and not by
+// the shell, so that they work the same everywhere.
+// A pattern that matches no files is an error.
+func inputFiles(arg string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(arg, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		matches := []string{item}
+		if strings.ContainsAny(item, "*?[") {
+			var err error
+			matches, err = filepath.Glob(item)
+			if err != nil {
+				return nil, fmt.Errorf("-file: bad pattern %q: %s", item, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("-file: %q matches no files", item)
+			}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("-file: no files in %q", arg)
+	}
+	// the output doesn't depend
+	// on the order they're listed in
+	sort.Strings(files)
+	if len(files) > 1 {
+		for _, f := range files {
+			if fi, err := os.Stat(f); err == nil && fi.IsDir() {
+				return nil, fmt.Errorf("-file: %s is a directory, which can't be listed with other files", f)
+			}
+		}
+	}
+	return files, nil
+}
+
+// generatedMethods returns the names
+// of the methods written for each type
+func generatedMethods(marshal bool, encode bool) []string {
+	var m []string
+	if marshal {
+		m = append(m, "MarshalMsg"+methodSuffix, "UnmarshalMsg"+methodSuffix, "Msgsize"+methodSuffix)
+		if observe {
+			m = append(m, "UnmarshalMsgObserved"+methodSuffix)
+		}
+	}
+	if encode {
+		m = append(m, "EncodeMsg"+methodSuffix, "DecodeMsg"+methodSuffix)
+	}
+	if methodSuffix != "" {
+		m = append(m, "Msgp"+methodSuffix)
+	}
+	if clone {
+		m = append(m, "Clone", "CopyTo")
+	}
+	return m
+}
+
 func writePkgHeader(w io.Writer, name string) error {
 	_, err := io.WriteString(w, fmt.Sprintf("package %s\n\n", name))
 	if err != nil {
 		return err
 	}
 
-	_, err = io.WriteString(w, "// NOTE: THIS FILE WAS PRODUCED BY THE\n// MSGP CODE GENERATION TOOL (github.com/philhofer/msgp)\n// DO NOT EDIT\n\n")
+	_, err = io.WriteString(w, "// NOTE: THIS FILE WAS PRODUCED BY THE\n// "+generatedMark+" (github.com/philhofer/msgp)\n// DO NOT EDIT\n\n")
 	return err
 }
 
-func writeImportHeader(w io.Writer, imports ...string) error {
+// importSpecs returns the import specs for
+// 'imports' plus the msgp runtime, followed by
+// the 'extra' imports declared with directives
+// that aren't already imported. The runtime is
+// always imported under the name 'msgp', since that
+// is the name used by the generated code.
+func importSpecs(imports []string, extra ...parse.Import) []string {
+	specs := make([]string, 0, len(imports)+len(extra)+1)
+	have := make(map[parse.Import]bool, len(imports)+len(extra)+1)
+	for _, im := range imports {
+		specs = append(specs, strconv.Quote(im))
+		have[parse.Import{Path: im}] = true
+	}
+	if path.Base(runtimeImport) == "msgp" {
+		specs = append(specs, strconv.Quote(runtimeImport))
+		have[parse.Import{Path: runtimeImport}] = true
+	} else {
+		specs = append(specs, "msgp "+strconv.Quote(runtimeImport))
+	}
+	have[parse.Import{Name: "msgp", Path: runtimeImport}] = true
+	for _, im := range extra {
+		if have[im] {
+			continue
+		}
+		have[im] = true
+		if im.Name != "" {
+			specs = append(specs, im.Name+" "+strconv.Quote(im.Path))
+		} else {
+			specs = append(specs, strconv.Quote(im.Path))
+		}
+	}
+	return specs
+}
+
+// overBudget returns the error for a generated file
+// of 'size' bytes, which is over -maxbytes, listing
+// the types whose methods take up the most of it
+// (by their 'sizes'), largest first.
+func overBudget(size int, sizes map[string]int) error {
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sizes[names[i]] != sizes[names[j]] {
+			return sizes[names[i]] > sizes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > 5 {
+		names = names[:5]
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "the generated file would be %d bytes, over the budget of %d (-maxbytes); the largest types are:\n", size, maxBytes)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\t%s: %d bytes (%d%%)\n", name, sizes[name], 100*sizes[name]/size)
+	}
+	b.WriteString("making them tuples (//msgp:tuple), generating fewer methods (-io=false or -marshal=false), or moving some types to a file of their own would make it smaller")
+	return errors.New(b.String())
+}
+
+// fileImports returns the imports of the generated
+// 'code': those declared by directives, which it has
+// to use (see checkImports), and those of the packages
+// of field types (see parse.FileSet.Packages) that it
+// does use.
+func fileImports(code []byte, fs *parse.FileSet) ([]parse.Import, error) {
+	if len(fs.Imports) == 0 && len(fs.Packages) == 0 {
+		return nil, nil
+	}
+	used, err := usedPackages(code)
+	if err != nil {
+		return nil, err
+	}
+	err = checkImports(used, fs.Imports)
+	if err != nil {
+		return nil, err
+	}
+	imports := append([]parse.Import(nil), fs.Imports...)
+	for _, im := range fs.Packages {
+		if used[im.PkgName()] {
+			imports = append(imports, im)
+		}
+	}
+	return imports, nil
+}
+
+// usedPackages returns the names of
+// the packages that 'code' refers to
+func usedPackages(code []byte) (map[string]bool, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "", append([]byte("package p\n"), code...), 0)
+	if err != nil {
+		return nil, err
+	}
+	// references to packages are
+	// the selectors of unresolved names
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	return used, nil
+}
+
+// checkImports returns an error if the generated code,
+// which uses the packages 'used', doesn't use one of the
+// 'imports' declared by directives, since the generated
+// file wouldn't compile, or if one of them has the same
+// name as the runtime.
+func checkImports(used map[string]bool, imports []parse.Import) error {
+	for _, im := range imports {
+		name := im.PkgName()
+		switch {
+		case name == "_":
+		case name == "msgp" && im.Path != runtimeImport:
+			return fmt.Errorf("import %q: the name msgp is used by the msgp runtime; import it with another name", im.Path)
+		case !used[name]:
+			return fmt.Errorf("import %q: %s isn't used by the generated code", im.Path, name)
+		}
+	}
+	return nil
+}
+
+// fileSource returns the generated file: the
+// generated 'code' after its package clause
+// and the import 'specs'
+func fileSource(gopkg string, specs []string, code []byte) []byte {
+	var buf bytes.Buffer
+	// writes to a bytes.Buffer don't fail
+	writePkgHeader(&buf, gopkg)
+	writeImportHeader(&buf, specs...)
+	buf.Write(code)
+	return buf.Bytes()
+}
+
+func writeImportHeader(w io.Writer, specs ...string) error {
 	_, err := io.WriteString(w, "import (\n")
 	if err != nil {
 		return err
 	}
-	for _, im := range imports {
-		_, err = io.WriteString(w, fmt.Sprintf("\t%q\n", im))
+	for _, spec := range specs {
+		_, err = io.WriteString(w, fmt.Sprintf("\t%s\n", spec))
 		if err != nil {
 			return err
 		}
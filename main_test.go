@@ -0,0 +1,1538 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/philhofer/msgp/parse"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const importSrc = `package thing
+
+type Thing struct {
+	Name string ` + "`msg:\"name\"`" + `
+}
+`
+
+// generate runs DoAll on importSrc and returns
+// the contents of the generated file and test file
+func generate(t *testing.T) (string, string) {
+	return generateSrc(t, importSrc)
+}
+
+// generateSrc is generate for 'src'
+func generateSrc(t *testing.T, src string) (string, string) {
+	dir, err := ioutil.TempDir("", "msgp-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "thing.go")
+	err = ioutil.WriteFile(name, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DoAll("", name, true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, err := ioutil.ReadFile(filepath.Join(dir, "thing_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := ioutil.ReadFile(filepath.Join(dir, "thing_gen_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(main), string(test)
+}
+
+func TestImportFlag(t *testing.T) {
+	old := runtimeImport
+	defer func() { runtimeImport = old }()
+
+	tests := []struct {
+		path string // -import
+		spec string // expected import spec
+	}{
+		{defaultRuntime, "\t\"" + defaultRuntime + "\"\n"},
+		{"example.com/fork/msgp", "\t\"example.com/fork/msgp\"\n"},
+		{"example.com/vendor/msgpack", "\tmsgp \"example.com/vendor/msgpack\"\n"},
+	}
+
+	for _, tt := range tests {
+		runtimeImport = tt.path
+		main, test := generate(t)
+		if !strings.Contains(main, tt.spec) {
+			t.Errorf("-import=%s: generated file doesn't contain %q", tt.path, tt.spec)
+		}
+		if !strings.Contains(test, tt.spec) {
+			t.Errorf("-import=%s: generated test file doesn't contain %q", tt.path, tt.spec)
+		}
+	}
+}
+
+const warnSrc = `package thing
+
+type Thing struct {
+	Name string ` + "`msg:\"name\"`" + `
+	Done chan bool
+}
+`
+
+func TestQuietVerbose(t *testing.T) {
+	oldw, oldv := logw, verbose
+	defer func() { logw, verbose = oldw, oldv }()
+
+	// run generates warnSrc and returns what was
+	// printed to stderr; nothing may go to stdout
+	run := func(v bool) string {
+		var stderr bytes.Buffer
+		logw, verbose = &stderr, v
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout := os.Stdout
+		os.Stdout = w
+		generateSrc(t, warnSrc)
+		os.Stdout = stdout
+		w.Close()
+		out, _ := ioutil.ReadAll(r)
+		r.Close()
+		if len(out) > 0 {
+			t.Errorf("-v=%t printed to stdout: %q", v, out)
+		}
+		return stderr.String()
+	}
+
+	warning := "type chan bool isn't supported"
+	quiet := run(false)
+	if !strings.Contains(quiet, warning) {
+		t.Errorf("quiet output doesn't have the warning: %q", quiet)
+	}
+	for _, progress := range []string{"parsing Thing", "OUTPUT", "\u2713"} {
+		if strings.Contains(quiet, progress) {
+			t.Errorf("quiet output has %q: %q", progress, quiet)
+		}
+	}
+
+	loud := run(true)
+	for _, want := range []string{"parsing Thing", warning, "OUTPUT", "TESTS", "\u2713"} {
+		if !strings.Contains(loud, want) {
+			t.Errorf("verbose output doesn't have %q: %q", want, loud)
+		}
+	}
+}
+
+var importDirectiveSrc = `package thing
+
+//msgp:import "strings"
+//msgp:import esc "html" "` + defaultRuntime + `"
+//msgp:shim Upper as:string using:strings.ToUpper/strings.ToLower
+//msgp:shim Escaped as:string using:esc.EscapeString/esc.UnescapeString
+
+type Upper = string
+
+type Escaped = string
+
+type Thing struct {
+	Name Upper   ` + "`msg:\"name\"`" + `
+	Body Escaped ` + "`msg:\"body\"`" + `
+}
+`
+
+func TestImportDirective(t *testing.T) {
+	main, test := generateSrc(t, importDirectiveSrc)
+
+	// the runtime isn't imported twice
+	want := "import (\n\t\"" + defaultRuntime + "\"\n\t\"strings\"\n\tesc \"html\"\n)\n"
+	if !strings.Contains(main, want) {
+		t.Errorf("generated file doesn't contain the import block %q:\n%s", want, main)
+	}
+	if strings.Contains(test, "html") {
+		t.Errorf("generated test file imports the declared packages:\n%s", test)
+	}
+}
+
+func TestImportDirectiveUnused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := strings.Replace(importDirectiveSrc, "package thing\n", "package thing\n\n//msgp:import \"net/url\"\n", 1)
+	name := filepath.Join(dir, "thing.go")
+	err = ioutil.WriteFile(name, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DoAll("", name, true, true, false)
+	if err == nil || !strings.Contains(err.Error(), `import "net/url": url isn't used`) {
+		t.Errorf("expected an error about the unused import; got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "thing_gen.go")); !os.IsNotExist(err) {
+		t.Errorf("the generated file was written anyway (stat: %v)", err)
+	}
+}
+
+// TestTypeImports checks that the package of a field's
+// type is imported only when the generated code names it
+func TestTypeImports(t *testing.T) {
+	const src = `package thing
+
+import "time"
+
+type Thing struct {
+	At time.Time
+}
+`
+	main, _ := generateSrc(t, src)
+	if strings.Contains(main, "\"time\"") {
+		t.Errorf("generated file imports time, but doesn't use it:\n%s", main)
+	}
+	main, _ = generateSrc(t, strings.Replace(src, "At time.Time", "At *time.Time", 1))
+	if !strings.Contains(main, "\t\"time\"\n") {
+		t.Errorf("generated file doesn't import time:\n%s", main)
+	}
+}
+
+const brokenSrc = `package thing
+
+//msgp:ignore Skipped
+
+type Skipped struct{ N int }
+
+type Outer struct {
+	Name  string
+	Inner Skipped
+}
+`
+
+// TestTypeCheck generates methods for a field whose
+// type is skipped, so it has none of its own, and
+// checks that the type check points at the field
+func TestTypeCheck(t *testing.T) {
+	old := nocheck
+	defer func() { nocheck = old }()
+
+	// in this module, so that
+	// the runtime can be found
+	dir, err := ioutil.TempDir(".", "check-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "thing.go")
+	err = ioutil.WriteFile(name, []byte(brokenSrc), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nocheck = false
+	err = DoAll("", name, true, true, false)
+	want := name + `:9:2: field "Inner": the generated code for Outer.Inner doesn't compile: `
+	if err == nil || !strings.HasPrefix(err.Error(), want) || !strings.Contains(err.Error(), "MarshalMsg undefined") {
+		t.Errorf("expected an error starting with %q about MarshalMsg; got %v", want, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "thing_gen.go")); !os.IsNotExist(err) {
+		t.Errorf("the generated file was written anyway (stat: %v)", err)
+	}
+
+	nocheck = true
+	err = DoAll("", name, true, true, false)
+	if err != nil {
+		t.Errorf("-nocheck: %s", err)
+	}
+}
+
+// TestTypeCheckEmbedded checks that the type check of
+// an embedded type from another package, which has no
+// methods of its own, says how to fix it
+func TestTypeCheckEmbedded(t *testing.T) {
+	old := nocheck
+	defer func() { nocheck = old }()
+	nocheck = false
+
+	dir, err := ioutil.TempDir(".", "check-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "thing.go")
+	err = ioutil.WriteFile(name, []byte(`package thing
+
+import "bytes"
+
+type Doc struct {
+	bytes.Buffer
+	Title string
+}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DoAll("", name, true, true, false)
+	want := name + `:6:2: field "Buffer": the generated code for Doc.Buffer doesn't compile: `
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("expected an error starting with %q; got %v", want, err)
+	}
+	if !strings.Contains(err.Error(), "the embedded bytes.Buffer is serialized with its own methods") {
+		t.Errorf("the error doesn't explain the embedded type: %s", err)
+	}
+}
+
+// the transforms used by _generated/def.go,
+// as its tests register them (which the
+// golden files depend on)
+const registerTransforms = `package _generated
+
+import (
+	"bytes"
+	"github.com/philhofer/msgp/msgp"
+)
+
+func init() {
+	xor := func(b []byte) ([]byte, error) {
+		for i := range b {
+			b[i] ^= 0x5a
+		}
+		return b, nil
+	}
+	invert := func(b []byte) ([]byte, error) {
+		for i := range b {
+			b[i] = ^b[i]
+		}
+		return b, nil
+	}
+	tag := bytes.Repeat([]byte{0xee}, 32) // as in _generated/transform_test.go
+	seal := func(b []byte) ([]byte, error) {
+		return append(append([]byte(nil), b...), tag...), nil
+	}
+	unseal := func(b []byte) ([]byte, error) {
+		return b[:len(b)-len(tag)], nil
+	}
+	msgp.RegisterTransform("pii", xor, xor)
+	msgp.RegisterTransform("inplace", invert, invert)
+	msgp.RegisterTransform("seal", seal, unseal)
+	msgp.RegisterTransformSize("seal", func(n int) int { return n + len(tag) })
+}
+`
+
+// TestMethodSuffix generates the kitchen-sink fixture
+// with -method-suffix and runs the generated tests,
+// which round-trip every type through its renamed
+// methods and through the adapter
+func TestMethodSuffix(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldSuffix, oldClone, oldSchema, oldLog := out, methodSuffix, clone, schema, logw
+	defer func() { out, methodSuffix, clone, schema, logw = oldOut, oldSuffix, oldClone, oldSchema, oldLog }()
+	logw = ioutil.Discard
+
+	// the package has to be in this one
+	// to import the msgp runtime
+	dir, err := ioutil.TempDir(".", "suffix-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	def, err := ioutil.ReadFile(filepath.Join("_generated", "def.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "def.go"), def, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "transforms_test.go"), []byte(registerTransforms), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, methodSuffix, clone, schema = filepath.Join(dir, "generated.go"), "MP", true, true
+	err = DoAll("", filepath.Join(dir, "def.go"), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{") MarshalMsg(", ") EncodeMsg(", ") Msgsize("} {
+		if bytes.Contains(gen, []byte(name)) {
+			t.Errorf("generated a method named %s", name)
+		}
+	}
+
+	cmd := exec.Command("go", "test", ".")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go test: %s\n%s", err, output)
+	}
+}
+
+// TestHalfMethodSets generates the kitchen-sink fixture
+// with -io=false and with -marshal=false, splitting most
+// structs into helpers, and runs the generated tests,
+// which have to use only the methods that were
+// generated, and the test that registers the
+// transforms, which fields of generated types use
+func TestHalfMethodSets(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldSplit, oldFuzz, oldLog := out, splitFields, fuzz, logw
+	defer func() { out, splitFields, fuzz, logw = oldOut, oldSplit, oldFuzz, oldLog }()
+	logw = ioutil.Discard
+	splitFields = 2
+	fuzz = true
+
+	def, err := ioutil.ReadFile(filepath.Join("_generated", "def.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		marshal, encode bool
+		left            []string // methods that aren't generated
+		split           string   // a helper of a split struct that is
+		imports         string   // test file imports
+	}{
+		{true, false, []string{") EncodeMsg(", ") DecodeMsg("}, ") marshalFieldGroup2(", "import (\n\t\"testing\"\n\t\"" + runtimeImport + "\"\n)"},
+		{false, true, []string{") MarshalMsg(", ") UnmarshalMsg(", ") Msgsize("}, ") encodeFieldGroup2(", "import (\n\t\"testing\"\n\t\"bytes\"\n\t\"" + runtimeImport + "\"\n)"},
+	}
+	for _, tt := range tests {
+		dir, err := ioutil.TempDir(".", "half-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		err = ioutil.WriteFile(filepath.Join(dir, "def.go"), def, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, "transforms_test.go"), []byte(registerTransforms), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out = filepath.Join(dir, "generated.go")
+		err = DoAll("", filepath.Join(dir, "def.go"), tt.marshal, tt.encode, true)
+		if err != nil {
+			t.Fatalf("-marshal=%t -io=%t: %s", tt.marshal, tt.encode, err)
+		}
+		gen, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range tt.left {
+			if bytes.Contains(gen, []byte(name)) {
+				t.Errorf("-marshal=%t -io=%t: generated a method named %s", tt.marshal, tt.encode, name[2:len(name)-1])
+			}
+		}
+		if !bytes.Contains(gen, []byte(tt.split)) {
+			t.Errorf("-marshal=%t -io=%t: no %s methods", tt.marshal, tt.encode, tt.split[2:len(tt.split)-1])
+		}
+		test, err := ioutil.ReadFile(filepath.Join(dir, "generated_test.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(test, []byte(tt.imports)) {
+			t.Errorf("-marshal=%t -io=%t: the tests' imports aren't %q:\n%s", tt.marshal, tt.encode, tt.imports, test)
+		}
+		fz, err := ioutil.ReadFile(filepath.Join(dir, "generated_fuzz_test.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]bool{".UnmarshalMsg(": tt.marshal, ".DecodeMsg(": tt.encode} {
+			if bytes.Contains(fz, []byte(name)) != want {
+				t.Errorf("-marshal=%t -io=%t: the fuzz tests call %s: %t", tt.marshal, tt.encode, name[1:len(name)-1], !want)
+			}
+		}
+
+		cmd := exec.Command("go", "test", ".")
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("-marshal=%t -io=%t: go test: %s\n%s", tt.marshal, tt.encode, err, output)
+		}
+	}
+}
+
+// TestSplitFields generates the kitchen-sink fixture
+// with a tiny -split, so that most structs are split
+// into helpers, and runs the generated tests, which
+// round-trip every type and check their Msgsize, and
+// the test that decodes fields out of order
+func TestSplitFields(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldSplit, oldClone, oldSchema, oldLog := out, splitFields, clone, schema, logw
+	defer func() { out, splitFields, clone, schema, logw = oldOut, oldSplit, oldClone, oldSchema, oldLog }()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir(".", "split-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	def, err := ioutil.ReadFile(filepath.Join("_generated", "def.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "def.go"), def, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "transforms_test.go"), []byte(registerTransforms), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"fieldorder_test.go", "omitempty_test.go"} {
+		src, err := ioutil.ReadFile(filepath.Join("_generated", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, name), src, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, splitFields, clone, schema = filepath.Join(dir, "generated.go"), 2, true, true
+	err = DoAll("", filepath.Join(dir, "def.go"), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"decodeFieldGroup2(", "decodeTupleGroup1(",
+		"marshalFieldGroup2(", "unmarshalFieldGroup2(", "unmarshalTupleGroup1(", "sizeFieldGroup2(",
+	} {
+		if !bytes.Contains(gen, []byte(") "+name)) {
+			t.Errorf("no %s methods", name)
+		}
+	}
+	// EncodeMsg is written with MarshalMsg's helpers
+	if bytes.Contains(gen, []byte(") encodeFieldGroup")) {
+		t.Error("generated encodeFieldGroup methods along with MarshalMsg")
+	}
+
+	cmd := exec.Command("go", "test", "-v", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("go test: %s\n%s", err, output)
+	} else {
+		for _, name := range []string{"TestFieldOrder", "TestOmitEmpty"} {
+			if !bytes.Contains(output, []byte("--- PASS: "+name)) {
+				t.Errorf("%s didn't run:\n%s", name, output)
+			}
+		}
+	}
+}
+
+// TestCrossBuild builds the runtime's tests and the
+// kitchen-sink fixture, with its generated code, its
+// generated tests and its hand-written tests, for the
+// 32-bit GOARCHes, 386 and arm, where an int is 32
+// bits, so that none of them leans on a 64-bit int
+func TestCrossBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go build in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldGolden, oldClone, oldSchema, oldDesc, oldObserve, oldBatch, oldRandom, oldFuzz, oldLog := out, golden, clone, schema, descriptors, observe, batch, random, fuzz, logw
+	defer func() {
+		out, golden, clone, schema, descriptors, observe, batch, random, fuzz, logw = oldOut, oldGolden, oldClone, oldSchema, oldDesc, oldObserve, oldBatch, oldRandom, oldFuzz, oldLog
+	}()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir(".", "cross-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the hand-written tests use what the flags of
+	// def.go's go:generate line generate, and they
+	// register their own transforms
+	files, err := filepath.Glob(filepath.Join("_generated", "*_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goldenFiles, err := filepath.Glob(filepath.Join("_generated", "testdata", "golden", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "testdata", "golden"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range append(append(files, goldenFiles...), filepath.Join("_generated", "def.go")) {
+		if strings.HasPrefix(filepath.Base(name), "generated") {
+			continue
+		}
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel("_generated", name)
+		err = ioutil.WriteFile(filepath.Join(dir, rel), src, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	out = filepath.Join(dir, "generated.go")
+	golden = filepath.Join(dir, "testdata", "golden")
+	clone, schema, descriptors, observe, batch, random, fuzz = true, true, true, true, true, true, true
+	err = DoAll("", filepath.Join(dir, "def.go"), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bin, err := filepath.Abs(filepath.Join(dir, "pkg.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 386 runs natively where amd64 does, so its tests
+	// are run there; elsewhere, they're only built
+	for _, arch := range []string{"386", "arm"} {
+		run := arch == "386" && runtime.GOOS == "linux" && runtime.GOARCH == "amd64"
+		for _, pkg := range []string{"./msgp", "./" + filepath.Base(dir)} {
+			args := []string{"test", "-c", "-o", bin, pkg}
+			if run {
+				// Test1EncodeDecode fails on every GOARCH, since the
+				// time it round-trips has a monotonic clock reading
+				args = []string{"test", "-skip", "^Test1EncodeDecode$", pkg}
+			}
+			cmd := exec.Command("go", args...)
+			cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+arch, "CGO_ENABLED=0")
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Errorf("GOARCH=%s go %s: %s\n%s", arch, strings.Join(args, " "), err, output)
+			}
+		}
+	}
+}
+
+// TestGolden generates the kitchen-sink fixture with
+// -golden, pointed at a copy of its golden files, and
+// runs the golden tests, which pass, and then again
+// after a tag is changed, which they have to catch
+func TestGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldGolden, oldLog := out, golden, logw
+	defer func() { out, golden, logw = oldOut, oldGolden, oldLog }()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir(".", "golden-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	def, err := ioutil.ReadFile(filepath.Join("_generated", "def.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "transforms_test.go"), []byte(registerTransforms), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join("_generated", "testdata", "golden", "*"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no golden files: %v", err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "testdata", "golden"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		bts, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, "testdata", "golden", filepath.Base(name)), bts, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	goldenTest := func(def []byte) ([]byte, error) {
+		err := ioutil.WriteFile(filepath.Join(dir, "def.go"), def, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, golden = filepath.Join(dir, "generated.go"), filepath.Join(dir, "testdata", "golden")
+		err = DoAll("", filepath.Join(dir, "def.go"), true, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("go", "test", "-run", "Golden", ".")
+		cmd.Dir = dir
+		return cmd.CombinedOutput()
+	}
+
+	output, err := goldenTest(def)
+	if err != nil {
+		t.Fatalf("go test: %s\n%s", err, output)
+	}
+
+	changed := bytes.Replace(def, []byte("`msg:\"complex\"`"), []byte("`msg:\"cmplx\"`"), 1)
+	if bytes.Equal(changed, def) {
+		t.Fatal("no tag to change")
+	}
+	output, err = goldenTest(changed)
+	if err == nil {
+		t.Fatal("go test passed with a changed tag")
+	}
+	if !bytes.Contains(output, []byte("the encoding of Things.sample changed")) {
+		t.Errorf("expected Things.sample to have changed:\n%s", output)
+	}
+	if bytes.Contains(output, []byte("TestType.sample changed")) {
+		t.Errorf("TestType changed, too:\n%s", output)
+	}
+}
+
+// basesSrc has a field of each base type
+// in gen's registry
+const basesSrc = `package thing
+
+import (
+	"net"
+	"net/netip"
+	"time"
+)
+
+type Bases struct {
+	Bytes      []byte
+	String     string
+	Float32    float32
+	Float64    float64
+	Complex64  complex64
+	Complex128 complex128
+	Uint       uint
+	Uint8      uint8
+	Uint16     uint16
+	Uint32     uint32
+	Uint64     uint64
+	Byte       byte
+	Int        int
+	Int8       int8
+	Int16      int16
+	Int32      int32
+	Int64      int64
+	Bool       bool
+	Intf       interface{}
+	Time       time.Time
+	IP         net.IP
+	IPNet      net.IPNet
+	Addr       netip.Addr
+}
+`
+
+// basesGolden is the code generated for
+// basesSrc, as of the last time a change
+// to it was accepted
+var basesGolden = filepath.Join("testdata", "bases_gen.golden")
+
+// TestBasesOutput compares the methods generated for a
+// field of each base type to basesGolden, so that a change
+// to the base registry that's meant to change nothing is
+// shown to; run it with MSGP_UPDATE_GOLDEN=1 to accept
+// a change
+func TestBasesOutput(t *testing.T) {
+	oldOut, oldCheck, oldLog := out, nocheck, logw
+	defer func() { out, nocheck, logw = oldOut, oldCheck, oldLog }()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir("", "msgp-bases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "bases.go")
+	err = ioutil.WriteFile(name, []byte(basesSrc), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, nocheck = filepath.Join(dir, "bases_gen.go"), true
+	err = DoAll("", name, true, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if os.Getenv("MSGP_UPDATE_GOLDEN") != "" {
+		if err := ioutil.WriteFile(basesGolden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(basesGolden)
+	if err != nil {
+		t.Fatalf("%s (set MSGP_UPDATE_GOLDEN=1 to write it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		gl, wl := strings.Split(string(got), "\n"), strings.Split(string(want), "\n")
+		i := 0
+		for i < len(gl) && i < len(wl) && gl[i] == wl[i] {
+			i++
+		}
+		line := func(l []string) string {
+			if i < len(l) {
+				return l[i]
+			}
+			return "(end of file)"
+		}
+		t.Errorf("the generated code differs from %s from line %d (set MSGP_UPDATE_GOLDEN=1 to accept it)\nwas: %s\nnow: %s", basesGolden, i+1, line(wl), line(gl))
+	}
+}
+
+// TestUnexported generates a package whose messages
+// are unexported, and keep their state in unexported
+// fields, and runs the generated tests, which have
+// to be named so that they run
+func TestUnexported(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldUnexported, oldLog := out, unexported, logw
+	defer func() { out, unexported, logw = oldOut, oldUnexported, oldLog }()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir(".", "unexported-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const src = `package state
+
+type counter struct {
+	hits  int64
+	names []string
+	_     int
+}
+
+// Exported keeps its state to itself
+type Exported struct {
+	c    *counter
+	last string ` + "`msg:\"last\"`" + `
+}
+
+func (e *Exported) Last() string { return e.last }
+`
+	const test = `package state
+
+import "testing"
+
+func TestUnexportedRoundTrip(t *testing.T) {
+	in := Exported{c: &counter{hits: 3, names: []string{"a"}}, last: "b"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Exported
+	_, err = out.UnmarshalMsg(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Last() != "b" || out.c == nil || out.c.hits != 3 || len(out.c.names) != 1 {
+		t.Errorf("got %#v", out)
+	}
+}
+`
+	err = ioutil.WriteFile(filepath.Join(dir, "state.go"), []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "roundtrip_test.go"), []byte(test), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, unexported = "", true
+	err = DoAll("", filepath.Join(dir, "state.go"), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "test", "-v", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go test: %s\n%s", err, output)
+	}
+	for _, name := range []string{"Test_counterMarshalUnmarshal", "Test_counterEncodeDecode", "TestExportedMarshalUnmarshal", "TestUnexportedRoundTrip"} {
+		if !bytes.Contains(output, []byte("--- PASS: "+name)) {
+			t.Errorf("%s didn't run:\n%s", name, output)
+		}
+	}
+}
+
+// TestSelectorArraySize generates methods for arrays
+// whose sizes are constants from the standard library
+// and from another package in this module
+func TestSelectorArraySize(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldLog := out, logw
+	defer func() { out, logw = oldOut, oldLog }()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir(".", "selector-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "limits"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "limits", "limits.go"), []byte("package limits\n\nconst MaxSlots = 3\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := `package digest
+
+import (
+	"crypto/sha256"
+
+	lim "` + path.Join(path.Dir(defaultRuntime), filepath.ToSlash(dir), "limits") + `"
+)
+
+type Digest struct {
+	Sum   [sha256.Size]byte
+	Slots [lim.MaxSlots]int
+}
+`
+	name := filepath.Join(dir, "digest.go")
+	err = ioutil.WriteFile(name, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out = ""
+	err = DoAll("", name, true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := ioutil.ReadFile(filepath.Join(dir, "digest_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"\t\"crypto/sha256\"\n", "\tlim \"", "sha256.Size", "lim.MaxSlots"} {
+		if !bytes.Contains(gen, []byte(want)) {
+			t.Errorf("the generated file doesn't have %q:\n%s", want, gen)
+		}
+	}
+	cmd := exec.Command("go", "test", "-v", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go test: %s\n%s", err, output)
+	}
+	if !bytes.Contains(output, []byte("--- PASS: TestDigestMarshalUnmarshal")) {
+		t.Errorf("TestDigestMarshalUnmarshal didn't run:\n%s", output)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	oldOut, oldMax, oldLog := out, maxBytes, logw
+	defer func() { out, maxBytes, logw = oldOut, oldMax, oldLog }()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir("", "msgp-maxbytes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	def, err := ioutil.ReadFile(filepath.Join("_generated", "def.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "def.go")
+	err = ioutil.WriteFile(name, def, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, maxBytes = "", 500
+	err = DoAll("", name, true, true, false)
+	if err == nil {
+		t.Fatal("generation didn't fail with a budget of 500 bytes")
+	}
+	// Converted's many converted fields
+	// make its methods the largest
+	var size int
+	_, serr := fmt.Sscanf(err.Error(), "the generated file would be %d bytes, over the budget of 500", &size)
+	if serr != nil || !strings.Contains(err.Error(), "the largest types are:\n\tConverted: ") {
+		t.Fatalf("expected an error naming Converted first; got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "def_gen.go")); !os.IsNotExist(err) {
+		t.Errorf("the generated file was written anyway (stat: %v)", err)
+	}
+
+	// the size is that of the file
+	maxBytes = size
+	err = DoAll("", name, true, true, false)
+	if err != nil {
+		t.Fatalf("with a budget of %d bytes: %s", size, err)
+	}
+	fi, err := os.Stat(filepath.Join(dir, "def_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(size) {
+		t.Errorf("the generated file is %d bytes, not %d", fi.Size(), size)
+	}
+}
+
+// TestEmbeddedSelector embeds types from another
+// package, which have generated methods of their own
+func TestEmbeddedSelector(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping go test in short mode")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldLog := out, logw
+	defer func() { out, logw = oldOut, oldLog }()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir(".", "embedded-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = os.Mkdir(filepath.Join(dir, "common"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const commonSrc = `package common
+
+type Meta struct {
+	Version int
+}
+
+type Owner struct {
+	Name string
+}
+`
+	src := `package doc
+
+import "` + path.Join(path.Dir(defaultRuntime), filepath.ToSlash(dir), "common") + `"
+
+type Doc struct {
+	common.Meta
+	*common.Owner
+	Title string
+}
+`
+	test := `package doc
+
+import (
+	"reflect"
+	"testing"
+
+	"` + path.Join(path.Dir(defaultRuntime), filepath.ToSlash(dir), "common") + `"
+)
+
+func TestEmbeddedRoundTrip(t *testing.T) {
+	in := Doc{Meta: common.Meta{Version: 2}, Owner: &common.Owner{Name: "o"}, Title: "t"}
+	bts, err := in.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Doc
+	if _, err = out.UnmarshalMsg(bts); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("unmarshaled %#v as %#v", in, out)
+	}
+}
+`
+	for name, src := range map[string]string{
+		filepath.Join("common", "common.go"): commonSrc,
+		"doc.go":                             src,
+		"embedded_test.go":                   test,
+	} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out = ""
+	err = DoAll("", filepath.Join(dir, "common", "common.go"), true, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DoAll("", filepath.Join(dir, "doc.go"), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "test", "-v", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go test: %s\n%s", err, output)
+	}
+	for _, name := range []string{"TestDocMarshalUnmarshal", "TestEmbeddedRoundTrip"} {
+		if !bytes.Contains(output, []byte("--- PASS: "+name)) {
+			t.Errorf("%s didn't run:\n%s", name, output)
+		}
+	}
+}
+
+// globPackage copies testdata/glob, whose messages
+// are in two of its four files, to a new package
+// in this one, so that it can import the runtime
+func globPackage(t *testing.T) string {
+	dir, err := ioutil.TempDir(".", "glob-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := filepath.Glob(filepath.Join("testdata", "glob", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		src, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, filepath.Base(name)), src, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestFileGlob(t *testing.T) {
+	oldOut, oldLog := out, logw
+	defer func() { out, logw = oldOut, oldLog }()
+	var log bytes.Buffer
+	out, logw = "", &log
+
+	dir := globPackage(t)
+	defer os.RemoveAll(dir)
+
+	err := DoAll("", filepath.Join(dir, "msg_*.go"), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the types in the other files
+	// aren't processed at all
+	if log.Len() > 0 {
+		t.Errorf("unexpected output:\n%s", log.String())
+	}
+	name := filepath.Join(dir, "glob_gen.go")
+	gen, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tp := range []string{"Alpha", "Beta"} {
+		if !bytes.Contains(gen, []byte("func (z *"+tp+") MarshalMsg(")) {
+			t.Errorf("no methods for %s", tp)
+		}
+	}
+	if bytes.Contains(gen, []byte("Server")) {
+		t.Error("generated methods for Server")
+	}
+
+	// a list of the same files is the same
+	err = DoAll("", filepath.Join(dir, "msg_beta.go")+","+filepath.Join(dir, "msg_alpha.go"), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(list, gen) {
+		t.Error("the files listed generated different code than the glob")
+	}
+
+	if testing.Short() {
+		return
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	// Level is resolved from level.go, so
+	// the generated code compiles and works
+	cmd := exec.Command("go", "test", ".")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go test: %s\n%s", err, output)
+	}
+}
+
+func TestFileGlobUnmatched(t *testing.T) {
+	oldLog := logw
+	defer func() { logw = oldLog }()
+	logw = ioutil.Discard
+
+	dir := globPackage(t)
+	defer os.RemoveAll(dir)
+
+	pattern := filepath.Join(dir, "msg_*.go") + "," + filepath.Join(dir, "nope_*.go")
+	err := DoAll("", pattern, true, true, true)
+	if err == nil || !strings.Contains(err.Error(), "matches no files") {
+		t.Errorf("expected an error about the unmatched pattern; got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "glob_gen.go")); !os.IsNotExist(err) {
+		t.Errorf("a file was generated anyway (stat: %v)", err)
+	}
+}
+
+// TestImportPath generates the glob package from its
+// import path, which puts the output in its directory,
+// leaving out the tests and the files generated before
+func TestImportPath(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go command")
+	}
+	oldOut, oldLog := out, logw
+	defer func() { out, logw = oldOut, oldLog }()
+	logw = ioutil.Discard
+
+	dir := globPackage(t)
+	defer os.RemoveAll(dir)
+	importPath := path.Join(path.Dir(defaultRuntime), filepath.ToSlash(dir))
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		out = ""
+		list, err := packageInput(importPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(abs, "glob_gen.go"); out != want {
+			t.Errorf("the output is %s; want %s", out, want)
+		}
+		files, err := inputFiles(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, filepath.Base(f))
+		}
+		if got := strings.Join(names, " "); got != "level.go msg_alpha.go msg_beta.go server.go" {
+			t.Errorf("run %d: got files %s", i, got)
+		}
+		err = DoAll("", list, true, true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	gen, err := ioutil.ReadFile(filepath.Join(abs, "glob_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(gen, []byte("func (z *Alpha) MarshalMsg(")) {
+		t.Error("no methods for Alpha")
+	}
+
+	_, err = packageInput(importPath + "/nope")
+	if err == nil || !strings.Contains(err.Error(), "can't find package "+importPath+"/nope") {
+		t.Errorf("expected an error about the missing package; got %v", err)
+	}
+}
+
+// TestOutputFlag checks where -o puts the generated
+// files: at a path whose directories are created, with
+// all the types of a directory in the one file, or in a
+// directory, under the input's name
+func TestOutputFlag(t *testing.T) {
+	oldOut, oldLog := out, logw
+	defer func() { out, logw = oldOut, oldLog }()
+	var log bytes.Buffer
+	logw = &log
+
+	dir := globPackage(t)
+	defer os.RemoveAll(dir)
+
+	out = filepath.Join(dir, "gen", "types_msgp.go")
+	err := DoAll("", dir, true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tp := range []string{"Alpha", "Beta", "Level"} {
+		if !bytes.Contains(gen, []byte(tp+") MarshalMsg(")) {
+			t.Errorf("-o %s: no methods for %s", out, tp)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gen", "types_msgp_test.go")); err != nil {
+		t.Errorf("-o %s: %s", out, err)
+	}
+	// which isn't where the methods can go
+	if !strings.Contains(log.String(), "methods have to be declared in the package of their types") {
+		t.Errorf("no warning about the package:\n%s", log.String())
+	}
+
+	log.Reset()
+	out = dir + string(filepath.Separator)
+	err = DoAll("", filepath.Join(dir, "level.go"), true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"level_gen.go", "level_gen_test.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("-o %s: %s", out, err)
+		}
+	}
+	if strings.Contains(log.String(), "warning") {
+		t.Errorf("unexpected warning:\n%s", log.String())
+	}
+
+}
+
+// inefficientSrc has one of each problem that
+// -analyze finds, and types that are fine
+const inefficientSrc = `package thing
+
+type Event struct {
+	Name       string  ` + "`msg:\"name\"`" + `
+	Attributes string  ` + "`msg:\"the_attributes_of_this_event\"`" + `
+	RetryCount float64 ` + "`msg:\"retries\"`" + `
+}
+
+type Journal struct {
+	Events []Event ` + "`msg:\"events\"`" + `
+	IDs    []ID    ` + "`msg:\"ids\"`" + `
+	Where  Coords  ` + "`msg:\"where\"`" + `
+}
+
+type ID struct {
+	Value int64 ` + "`msg:\"value\"`" + `
+}
+
+type IDList []ID
+
+//msgp:tuple Pair
+
+type Pair struct {
+	A, B float64
+}
+
+type Coords struct {
+	Lat float64 ` + "`msg:\"lat\"`" + `
+	Lon float64 ` + "`msg:\"lon\"`" + `
+}
+
+type Quote struct {
+	TotalPrice float64 ` + "`msg:\"total\"`" + `
+	PriceIndex float64 ` + "`msg:\"index\"`" + `
+	Discount   float64 ` + "`msg:\"discount\"`" + `
+}
+`
+
+func TestAnalyze(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-analyze")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "thing.go")
+	err = ioutil.WriteFile(name, []byte(inefficientSrc), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs, elems, err := parse.GetFile(name, parse.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range analyzeTypes(fs, elems) {
+		got = append(got, fmt.Sprintf("%d %s %s %s.%s", f.Pos.Line, f.Severity, f.Rule, f.Type, f.Field))
+	}
+	want := []string{
+		"5 warning long-tag Event.Attributes",
+		"3 warning key-overhead Event.",
+		"6 error float-counter Event.RetryCount",
+		"11 warning one-field-elements Journal.IDs",
+		"15 warning key-overhead ID.",
+		"19 warning one-field-elements IDList.",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got findings\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	oldAnalyze, oldStrict, oldCheck := analyze, strict, nocheck
+	defer func() { analyze, strict, nocheck = oldAnalyze, oldStrict, oldCheck }()
+	analyze, nocheck = true, true
+
+	// errors among the findings
+	// only fail under -strict
+	strict = false
+	if err = DoAll("", name, true, true, false); err != nil {
+		t.Errorf("-analyze: %s", err)
+	}
+	strict = true
+	os.Remove(filepath.Join(dir, "thing_gen.go"))
+	err = DoAll("", name, true, true, false)
+	if err == nil || !strings.Contains(err.Error(), "1 error") {
+		t.Errorf("-analyze -strict: expected an error about 1 error; got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "thing_gen.go")); !os.IsNotExist(err) {
+		t.Errorf("the generated file was written anyway (stat: %v)", err)
+	}
+}
+
+// constSrc has nothing to generate methods for
+const constSrc = `package thing
+
+const Limit = 8
+
+type Name = string
+
+func Greet(n Name) string { return "hi " + n }
+`
+
+func TestNothingToGenerate(t *testing.T) {
+	oldLog := logw
+	defer func() { logw = oldLog }()
+	var stderr bytes.Buffer
+	logw = &stderr
+
+	dir, err := ioutil.TempDir("", "msgp-empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "thing.go")
+	err = ioutil.WriteFile(name, []byte(constSrc), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = DoAll("", name, true, true, true)
+	if err != nil {
+		t.Fatalf("expected no error; got %s", err)
+	}
+	for _, file := range []string{"thing_gen.go", "thing_gen_test.go"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); !os.IsNotExist(err) {
+			t.Errorf("%s was written (stat: %v)", file, err)
+		}
+	}
+	if !strings.Contains(stderr.String(), "nothing to generate: no exported definitions in "+name) {
+		t.Errorf("no notice was printed: %q", stderr.String())
+	}
+
+	// the parser says why
+	_, _, err = parse.GetElems(name)
+	if nd, ok := err.(*parse.NoDefinitionsError); !ok || nd.Package != "thing" {
+		t.Errorf("expected a *parse.NoDefinitionsError for package thing; got %#v", err)
+	}
+}
+
+func TestCleanStale(t *testing.T) {
+	oldLog, oldClean := logw, cleanStale
+	defer func() { logw, cleanStale = oldLog, oldClean }()
+	logw = ioutil.Discard
+
+	dir, err := ioutil.TempDir("", "msgp-clean")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "thing.go")
+	main := filepath.Join(dir, "thing_gen.go")
+	test := filepath.Join(dir, "thing_gen_test.go")
+
+	// generate the methods of Thing,
+	// then delete it from the file
+	run := func(src string) {
+		err := ioutil.WriteFile(name, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = DoAll("", name, true, true, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(file string) bool {
+		_, err := os.Stat(file)
+		return err == nil
+	}
+	run(importSrc)
+	if !exists(main) || !exists(test) {
+		t.Fatal("the files weren't generated")
+	}
+
+	// without -clean, they're left
+	cleanStale = false
+	run(constSrc)
+	if !exists(main) || !exists(test) {
+		t.Error("the generated files were removed without -clean")
+	}
+
+	// files that weren't generated
+	// aren't removed, either
+	err = ioutil.WriteFile(test, []byte("package thing\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanStale = true
+	run(constSrc)
+	if exists(main) {
+		t.Error("the stale generated file wasn't removed under -clean")
+	}
+	if !exists(test) {
+		t.Error("a file that wasn't generated was removed under -clean")
+	}
+}
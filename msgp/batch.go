@@ -0,0 +1,27 @@
+package msgp
+
+// UnmarshalBatch unmarshals the messages that 'bts'
+// holds one after another, each into a new value from
+// 'newItem', and calls 'onItem' with each in turn. It
+// stops at the first error, from UnmarshalMsg or from
+// 'onItem', and returns it with the rest of 'bts': from
+// the start of the message that failed to unmarshal, or
+// after the one that 'onItem' failed on. Otherwise, it
+// returns no bytes and a nil error, after reading all
+// of them. Errors aren't wrapped, so that they're the
+// ones UnmarshalMsg and 'onItem' return.
+func UnmarshalBatch(bts []byte, newItem func() Unmarshaler, onItem func(Unmarshaler) error) ([]byte, error) {
+	for len(bts) > 0 {
+		v := newItem()
+		o, err := v.UnmarshalMsg(bts)
+		if err != nil {
+			return bts, err
+		}
+		bts = o
+		err = onItem(v)
+		if err != nil {
+			return bts, err
+		}
+	}
+	return bts, nil
+}
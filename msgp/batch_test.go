@@ -0,0 +1,88 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// batchInt is an Unmarshaler of an int64
+type batchInt int64
+
+func (b *batchInt) UnmarshalMsg(bts []byte) ([]byte, error) {
+	i, o, err := ReadInt64Bytes(bts)
+	*b = batchInt(i)
+	return o, err
+}
+
+func TestUnmarshalBatch(t *testing.T) {
+	var msgs []byte
+	for i := int64(0); i < 5; i++ {
+		msgs = AppendInt64(msgs, i)
+	}
+	newInt := func() Unmarshaler { return new(batchInt) }
+
+	// run returns the values that 'onItem' saw,
+	// and what UnmarshalBatch returned
+	run := func(bts []byte, stop int64) ([]int64, []byte, error) {
+		var got []int64
+		left, err := UnmarshalBatch(bts, newInt, func(v Unmarshaler) error {
+			i := int64(*v.(*batchInt))
+			got = append(got, i)
+			if i == stop {
+				return errors.New("stop")
+			}
+			return nil
+		})
+		return got, left, err
+	}
+
+	got, left, err := run(msgs, -1)
+	if err != nil || len(left) > 0 || len(got) != 5 || got[4] != 4 {
+		t.Errorf("read %v (%v), with %d bytes left", got, err, len(left))
+	}
+
+	// each gets a new value
+	var seen []Unmarshaler
+	UnmarshalBatch(msgs, newInt, func(v Unmarshaler) error {
+		seen = append(seen, v)
+		return nil
+	})
+	if len(seen) != 5 || seen[0] == seen[1] {
+		t.Error("the values were reused")
+	}
+
+	// an error from onItem stops it
+	// after the message it was called with
+	got, left, err = run(msgs, 2)
+	if err == nil || err.Error() != "stop" {
+		t.Errorf("got error %v; want stop", err)
+	}
+	if len(got) != 3 || !bytes.Equal(left, msgs[3:]) {
+		t.Errorf("read %v, and left %x; want the last two", got, left)
+	}
+
+	// so does one from UnmarshalMsg, at
+	// the start of the message it failed on
+	bad := append(append(msgs[:2:2], AppendString(nil, "x")...), msgs[2:]...)
+	got, left, err = run(bad, -1)
+	if _, ok := err.(TypeError); !ok {
+		t.Errorf("got error %v; want a TypeError", err)
+	}
+	if len(got) != 2 || !bytes.Equal(left, bad[2:]) {
+		t.Errorf("read %v, and left %x; want the string on", got, left)
+	}
+
+	// and one cut short
+	short := AppendInt64(msgs, 1<<40)
+	got, left, err = run(short[:len(short)-1], -1)
+	if err != ErrShortBytes || len(got) != 5 {
+		t.Errorf("read %v (%v) from a short message", got, err)
+	}
+
+	// nothing is nothing
+	got, left, err = run(nil, -1)
+	if err != nil || len(got) > 0 || len(left) > 0 {
+		t.Errorf("read %v (%v) from nothing", got, err)
+	}
+}
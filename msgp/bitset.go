@@ -0,0 +1,160 @@
+package msgp
+
+import (
+	"math"
+)
+
+// A bitset is a []bool written compactly, as an array
+// of two objects: the number of bools, as an unsigned
+// integer, and a 'bin' of the bools packed into bits,
+// which is exactly (n+7)/8 bytes long for n bools:
+//
+//     [n, bin(packed)]
+//
+// Bool i is bit i%8 of byte i/8, counting from the least
+// significant bit, so the first bool is the low bit of the
+// first byte. The bits past the last bool are zero, and
+// are ignored when reading. Generated code writes []bool
+// fields tagged `msg:"name,bitset"` as bitsets.
+
+// ErrBitsetLength is returned when the bits of
+// a bitset don't fit the number of bools in it.
+// The whole bitset has been read, so it's resumable.
+var ErrBitsetLength error = &errorString{s: "msgp: bitset's bits don't match its length", resumable: true}
+
+// bitsetBytes returns the number of
+// bytes that 'n' bools are packed into
+func bitsetBytes(n int) int { return (n + 7) / 8 }
+
+// BitsetSize returns the encoded size of a bitset of 'n' bools.
+func BitsetSize(n int) int {
+	return ArrayHeaderSizeFor(2) + Uint64SizeFor(uint64(n)) + BytesSize(bitsetBytes(n))
+}
+
+// AppendBitset appends 'bits' to 'b' as a bitset.
+func AppendBitset(b []byte, bits []bool) []byte {
+	b = AppendArrayHeader(b, 2)
+	b = AppendUint64(b, uint64(len(bits)))
+	b = appendBinHeader(b, uint32(bitsetBytes(len(bits))))
+	return packBits(b, bits)
+}
+
+// ReadBitsetBytes reads a bitset from 'b' and returns
+// the bools in it, using 'bits' for storage if it's big
+// enough, and the remaining bytes.
+func ReadBitsetBytes(b []byte, bits []bool) ([]bool, []byte, error) {
+	o, err := ReadArrayHeaderBytesExpect(b, 2)
+	if err != nil {
+		return bits, b, err
+	}
+	n, o, err := ReadUint64Bytes(o)
+	if err != nil {
+		return bits, b, err
+	}
+	packed, o, err := ReadBytesZC(o)
+	if err != nil {
+		return bits, b, err
+	}
+	bits, err = unpackBits(bits, n, packed)
+	if err != nil {
+		return bits, b, err
+	}
+	return bits, o, nil
+}
+
+// WriteBitset writes 'bits' as a bitset.
+func (mw *Writer) WriteBitset(bits []bool) error {
+	err := mw.WriteArrayHeader(2)
+	if err != nil {
+		return err
+	}
+	err = mw.WriteUint64(uint64(len(bits)))
+	if err != nil {
+		return err
+	}
+	// packed in chunks, so that a long
+	// bitset doesn't need a buffer of its own
+	var chunk [64]byte
+	_, err = mw.Write(appendBinHeader(chunk[:0], uint32(bitsetBytes(len(bits)))))
+	for err == nil && len(bits) > 0 {
+		n := len(bits)
+		if n > 8*len(chunk) {
+			n = 8 * len(chunk)
+		}
+		_, err = mw.Write(packBits(chunk[:0], bits[:n]))
+		bits = bits[n:]
+	}
+	return err
+}
+
+// ReadBitset reads a bitset and returns the bools
+// in it, using 'bits' for storage if it's big enough.
+func (m *Reader) ReadBitset(bits []bool) ([]bool, error) {
+	sz, err := m.ReadArrayHeader()
+	if err != nil {
+		return bits, err
+	}
+	if sz != 2 {
+		return bits, ArrayError{Wanted: 2, Got: sz}
+	}
+	n, err := m.ReadUint64()
+	if err != nil {
+		return bits, err
+	}
+	m.scratch, err = m.ReadBytes(m.scratch[:0])
+	if err != nil {
+		return bits, err
+	}
+	return unpackBits(bits, n, m.scratch)
+}
+
+// appendBinHeader appends the header
+// of a 'bin' object of 'sz' bytes
+func appendBinHeader(b []byte, sz uint32) []byte {
+	switch {
+	case sz < math.MaxUint8:
+		o, n := ensure(b, 2)
+		prefixu8(o[n:], mbin8, uint8(sz))
+		return o
+	case sz < math.MaxUint16:
+		o, n := ensure(b, 3)
+		prefixu16(o[n:], mbin16, uint16(sz))
+		return o
+	default:
+		o, n := ensure(b, 5)
+		prefixu32(o[n:], mbin32, sz)
+		return o
+	}
+}
+
+// packBits appends 'bits', packed into bytes, to 'b'
+func packBits(b []byte, bits []bool) []byte {
+	o, n := ensure(b, bitsetBytes(len(bits)))
+	packed := o[n:]
+	for i := range packed {
+		packed[i] = 0
+	}
+	for i, on := range bits {
+		if on {
+			packed[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return o
+}
+
+// unpackBits returns the 'n' bools packed in
+// 'packed', using 'bits' for storage if it can
+func unpackBits(bits []bool, n uint64, packed []byte) ([]bool, error) {
+	if n > uint64(8*len(packed)) || uint64(len(packed)) != (n+7)/8 {
+		return bits, ErrBitsetLength
+	}
+	if cap(bits) > 0 && uint64(cap(bits)) >= n {
+		bits = bits[:n]
+	} else {
+		bits = make([]bool, n)
+	}
+	for i := range bits {
+		bits[i] = packed[i/8]&(1<<uint(i%8)) != 0
+	}
+	return bits, nil
+}
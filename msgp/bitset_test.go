@@ -0,0 +1,94 @@
+package msgp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// bitsetOf returns 'n' bools in a pattern
+// that sets some bits of each byte, and not
+// others, so that misplaced bits show
+func bitsetOf(n int) []bool {
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = i%3 == 0 || i%7 == 1
+	}
+	return bits
+}
+
+func TestBitset(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 8, 9, 64, 65, 1000} {
+		bits := bitsetOf(n)
+
+		b := AppendBitset(nil, bits)
+		if len(b) != BitsetSize(n) {
+			t.Errorf("%d bools: BitsetSize is %d, but AppendBitset wrote %d bytes", n, BitsetSize(n), len(b))
+		}
+		out, left, err := ReadBitsetBytes(b, nil)
+		if err != nil {
+			t.Fatalf("%d bools: ReadBitsetBytes: %s", n, err)
+		}
+		if len(left) != 0 {
+			t.Errorf("%d bools: %d bytes left over", n, len(left))
+		}
+		if len(out) != n || (n > 0 && !reflect.DeepEqual(out, bits)) {
+			t.Errorf("%d bools: read %v back as %v", n, bits, out)
+		}
+
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		err = wr.WriteBitset(bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = wr.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Errorf("%d bools: WriteBitset wrote %x; AppendBitset %x", n, buf.Bytes(), b)
+		}
+		out, err = NewReader(&buf).ReadBitset(make([]bool, 0, 8))
+		if err != nil {
+			t.Fatalf("%d bools: ReadBitset: %s", n, err)
+		}
+		if len(out) != n || (n > 0 && !reflect.DeepEqual(out, bits)) {
+			t.Errorf("%d bools: Reader read %v back as %v", n, bits, out)
+		}
+	}
+}
+
+func TestBitsetWire(t *testing.T) {
+	// bools 0, 2 and 9 are set; the
+	// first is the low bit of byte 0
+	bits := make([]bool, 10)
+	bits[0], bits[2], bits[9] = true, true, true
+	want := []byte{0x92, 0x0a, 0xc4, 0x02, 0x05, 0x02}
+	if got := AppendBitset(nil, bits); !bytes.Equal(got, want) {
+		t.Errorf("wrote %x; want %x", got, want)
+	}
+}
+
+func TestBitsetErrors(t *testing.T) {
+	// too few bytes for the bools
+	short := AppendBytes(AppendUint64(AppendArrayHeader(nil, 2), 9), []byte{0xff})
+	// too many
+	long := AppendBytes(AppendUint64(AppendArrayHeader(nil, 2), 8), []byte{0xff, 0})
+	for _, b := range [][]byte{short, long} {
+		if _, _, err := ReadBitsetBytes(b, nil); err != ErrBitsetLength {
+			t.Errorf("ReadBitsetBytes(%x): got error %v; want ErrBitsetLength", b, err)
+		}
+		if _, err := NewReader(bytes.NewReader(b)).ReadBitset(nil); err != ErrBitsetLength {
+			t.Errorf("ReadBitset(%x): got error %v; want ErrBitsetLength", b, err)
+		}
+	}
+
+	three := AppendArrayHeader(nil, 3)
+	if _, _, err := ReadBitsetBytes(three, nil); err == nil {
+		t.Error("ReadBitsetBytes read a 3-element array")
+	}
+	if _, err := NewReader(bytes.NewReader(three)).ReadBitset(nil); err == nil {
+		t.Error("ReadBitset read a 3-element array")
+	}
+}
@@ -0,0 +1,132 @@
+package msgp
+
+import (
+	"io"
+)
+
+const (
+	// CaptureLimit is the most bytes of one object
+	// that CaptureNext and CaptureNextBytes capture.
+	CaptureLimit = 1 << 20
+
+	// CaptureLookahead is the most bytes after the
+	// point of failure that CaptureNext and
+	// CaptureNextBytes capture along with the
+	// bytes before it.
+	CaptureLookahead = 64
+)
+
+// CaptureNext appends the raw bytes of the next
+// object to 'dst' and consumes them, like (*Raw).DecodeMsg,
+// but it's meant for objects that may be malformed,
+// e.g. to keep a message that couldn't be decoded.
+// Objects are only traversed by their headers,
+// and the bytes are captured even if there's
+// an error, which is returned along with them.
+//
+// An invalid prefix byte is captured as an object
+// of its own, and the traversal goes on, so the
+// rest of the object is captured; the first such
+// error is returned at the end. If the object ends
+// early, everything up to the end is captured, and
+// io.ErrUnexpectedEOF is returned. If the object
+// has (or a header claims that it has) more than
+// CaptureLimit bytes, the traversal stops at the
+// header of the element that doesn't fit: up to
+// CaptureLookahead bytes from there are captured,
+// and a LimitError is returned. Once the traversal
+// has stopped, the reader isn't at the start of an
+// object, so it can't be used to read any more.
+//
+// If there's no data at all, CaptureNext
+// returns 'dst' unchanged and io.EOF.
+func (m *Reader) CaptureNext(dst []byte) ([]byte, error) {
+	return capture(m.r, dst)
+}
+
+// CaptureNextBytes is CaptureNext for the next
+// object in 'b'. It returns 'dst' with the
+// captured bytes appended, and the bytes
+// that follow them in 'b'.
+func CaptureNextBytes(dst []byte, b []byte) ([]byte, []byte, error) {
+	s := sliceSource{b: b}
+	dst, err := capture(&s, dst)
+	if err == io.EOF {
+		err = ErrShortBytes
+	}
+	return dst, s.b, err
+}
+
+// capture is CaptureNext for any source
+func capture(r source, dst []byte) ([]byte, error) {
+	var (
+		start = len(dst)
+		first error // the first invalid prefix
+	)
+	for objs := 1; objs > 0; objs-- {
+		sz, o, err := peekSize(r, 0)
+		if err != nil {
+			if _, ok := err.(InvalidPrefixError); !ok {
+				if err == io.EOF && len(dst) == start {
+					return dst, io.EOF
+				}
+				// a header that's cut short
+				return lookahead(r, dst, noEOF(err))
+			}
+			if first == nil {
+				first = err
+			}
+			sz, o = 1, 0
+		}
+
+		// every element takes at least a
+		// byte, so a container can be too
+		// big for the rest of the budget,
+		// and so can a str, bin or ext
+		// (as int64s, since ints may be 32 bits)
+		left := CaptureLimit - (len(dst) - start)
+		if int64(sz)+int64(o) > int64(left) {
+			return lookahead(r, dst, captureLimit(r, sz, o))
+		}
+		objs += o
+
+		n := len(dst)
+		if cap(dst)-n < sz {
+			dst = append(dst[:cap(dst)], make([]byte, n+sz-cap(dst))...)
+		}
+		k, err := r.ReadFull(dst[n : n+sz])
+		dst = dst[:n+k]
+		if err != nil {
+			return dst, noEOF(err)
+		}
+	}
+	return dst, first
+}
+
+// lookahead appends up to CaptureLookahead
+// of the bytes that are left in 'r' to 'dst',
+// and returns them along with 'err'
+func lookahead(r source, dst []byte, err error) ([]byte, error) {
+	p, _ := r.Peek(CaptureLookahead)
+	dst = append(dst, p...)
+	r.Skip(len(p))
+	return dst, err
+}
+
+// captureLimit returns the LimitError for the
+// object at the head of 'r', which takes 'sz'
+// bytes, not counting any elements, and has 'o'
+// elements
+func captureLimit(r source, sz int, o int) error {
+	p, _ := r.Peek(1)
+	s := &specs[p[0]]
+	kind := s.typ
+	size := sz - int(s.size)
+	switch kind {
+	case MapType:
+		size = o / 2
+	case ArrayType:
+		size = o
+	}
+	return LimitError{Kind: kind, Size: clampUint32(size), Limit: CaptureLimit}
+}
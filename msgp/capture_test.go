@@ -0,0 +1,138 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// captureMsg is a map with an invalid prefix
+// in the middle of it, followed by a valid object
+func captureMsg() (broken, next []byte) {
+	broken = AppendMapHeader(nil, 3)
+	broken = AppendString(broken, "a")
+	broken = AppendInt(broken, 1)
+	broken = AppendString(broken, "b")
+	broken = append(broken, 0xc1) // never used
+	broken = AppendString(broken, "c")
+	broken = AppendArrayHeader(broken, 2)
+	broken = AppendString(broken, "x")
+	broken = AppendBytes(broken, []byte("yz"))
+	return broken, AppendString(nil, "next")
+}
+
+func TestCaptureNextBroken(t *testing.T) {
+	broken, next := captureMsg()
+	msg := append(append([]byte{}, broken...), next...)
+
+	// in memory, and buffered
+	for _, src := range []io.Reader{bytes.NewReader(msg), iotest.OneByteReader(bytes.NewReader(msg))} {
+		rd := NewReader(src)
+		got, err := rd.CaptureNext([]byte("prefix"))
+		if _, ok := err.(InvalidPrefixError); !ok {
+			t.Errorf("got error %v; want an InvalidPrefixError", err)
+		}
+		if want := append([]byte("prefix"), broken...); !bytes.Equal(got, want) {
+			t.Errorf("captured %x; want %x", got, want)
+		}
+		// the traversal got past the bad byte,
+		// so the next object can be read
+		s, err := rd.ReadString()
+		if err != nil || s != "next" {
+			t.Errorf("the next object is %q, %v", s, err)
+		}
+	}
+
+	got, rest, err := CaptureNextBytes(nil, msg)
+	if _, ok := err.(InvalidPrefixError); !ok {
+		t.Errorf("bytes: got error %v; want an InvalidPrefixError", err)
+	}
+	if !bytes.Equal(got, broken) || !bytes.Equal(rest, next) {
+		t.Errorf("bytes: captured %x, left %x", got, rest)
+	}
+}
+
+func TestCaptureNextTruncated(t *testing.T) {
+	obj := AppendMapHeader(nil, 2)
+	obj = AppendString(obj, "list")
+	obj = AppendArrayHeader(obj, 3)
+	obj = AppendString(obj, "one")
+	obj = AppendString(obj, "two")
+	obj = AppendString(obj, "three")
+	obj = AppendString(obj, "blob")
+	obj = AppendBytes(obj, bytes.Repeat([]byte{'x'}, 300))
+
+	for off := 1; off < len(obj); off++ {
+		msg := obj[:off]
+		got, err := NewReaderBytes(msg).CaptureNext(nil)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("cut at %d: got error %v", off, err)
+		}
+		// everything up to the end is kept
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("cut at %d: captured %x", off, got)
+		}
+		got, rest, err := CaptureNextBytes(nil, msg)
+		if err != io.ErrUnexpectedEOF || !bytes.Equal(got, msg) || len(rest) != 0 {
+			t.Fatalf("bytes: cut at %d: captured %x, left %x, %v", off, got, rest, err)
+		}
+	}
+
+	got, err := NewReaderBytes(nil).CaptureNext([]byte("dst"))
+	if err != io.EOF || string(got) != "dst" {
+		t.Errorf("no data: captured %q, %v", got, err)
+	}
+	if _, _, err := CaptureNextBytes(nil, nil); err != ErrShortBytes {
+		t.Errorf("no data: bytes: got error %v", err)
+	}
+}
+
+func TestCaptureNextLimit(t *testing.T) {
+	// a header that claims far more elements
+	// than any budget holds, followed by junk
+	junk := bytes.Repeat([]byte{0xc1}, 2*CaptureLookahead)
+	hdr := AppendArrayHeader(nil, 1<<31)
+	msg := append(append([]byte{}, hdr...), junk...)
+
+	got, err := NewReaderBytes(msg).CaptureNext(nil)
+	lerr, ok := err.(LimitError)
+	if !ok || lerr.Kind != ArrayType || lerr.Size != 1<<31 {
+		t.Fatalf("got error %v", err)
+	}
+	// only a bounded lookahead follows the header
+	if !bytes.Equal(got, msg[:CaptureLookahead]) {
+		t.Errorf("captured %d bytes; want %d", len(got), CaptureLookahead)
+	}
+
+	// the same goes for an element
+	// that doesn't fit in what's left
+	big := AppendArrayHeader(nil, 2)
+	big = AppendBytes(big, make([]byte, CaptureLimit/2))
+	tail := AppendBytes(nil, make([]byte, CaptureLimit/2))
+	big = append(big, tail...)
+
+	got, rest, err := CaptureNextBytes(nil, big)
+	if _, ok := err.(LimitError); !ok {
+		t.Fatalf("bytes: got error %v", err)
+	}
+	want := len(big) - len(tail) + CaptureLookahead
+	if !bytes.Equal(got, big[:want]) || !bytes.Equal(rest, big[want:]) {
+		t.Errorf("bytes: captured %d bytes; want %d", len(got), want)
+	}
+}
+
+func TestCaptureNextValid(t *testing.T) {
+	for i, obj := range sizeObjects() {
+		got, err := NewReaderBytes(obj).CaptureNext(nil)
+		if len(obj) > CaptureLimit {
+			if _, ok := err.(LimitError); !ok {
+				t.Errorf("object %d: got error %v", i, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(got, obj) {
+			t.Errorf("object %d: captured %x, %v", i, got, err)
+		}
+	}
+}
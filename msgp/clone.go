@@ -0,0 +1,88 @@
+package msgp
+
+import (
+	"reflect"
+)
+
+// CopyIntf returns a deep copy of 'i' for the
+// types that ReadIntf and ReadIntfBytes produce:
+// []interface{}, map[string]interface{}, []byte,
+// and extensions are copied, and immutable values
+// (numbers, strings, time.Time, etc.) are returned
+// as-is. Other values are also returned as-is,
+// so they are shared with the original.
+// It is used by generated Clone methods.
+func CopyIntf(i interface{}) interface{} {
+	switch v := i.(type) {
+	case []byte:
+		return append(v[:0:0], v...)
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		out := make([]interface{}, len(v))
+		for j := range v {
+			out[j] = CopyIntf(v[j])
+		}
+		return out
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		out := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			out[key] = CopyIntf(val)
+		}
+		return out
+	case map[string]string:
+		if v == nil {
+			return v
+		}
+		out := make(map[string]string, len(v))
+		for key, val := range v {
+			out[key] = val
+		}
+		return out
+	case *RawExtension:
+		if v == nil {
+			return v
+		}
+		return &RawExtension{Type: v.Type, Data: append(v.Data[:0:0], v.Data...)}
+	case Extension:
+		t := reflect.TypeOf(v)
+		if t.Kind() != reflect.Ptr || reflect.ValueOf(v).IsNil() {
+			return i
+		}
+		out := reflect.New(t.Elem()).Interface().(Extension)
+		CopyExtension(out, v)
+		return out
+	default:
+		return i
+	}
+}
+
+// CopyExtension sets *dst to a copy of *src by
+// marshaling 'src' and unmarshaling the result
+// into a new value, which is then assigned to *dst.
+// Both must be pointers to the same type. It panics
+// if unmarshaling fails, since that means the
+// extension can't round-trip.
+// It is used by generated Clone methods.
+func CopyExtension(dst Extension, src Extension) {
+	// the type of a RawExtension
+	// isn't part of its data
+	if r, ok := src.(*RawExtension); ok {
+		*dst.(*RawExtension) = RawExtension{Type: r.Type, Data: append(r.Data[:0:0], r.Data...)}
+		return
+	}
+	bts := make([]byte, src.Len())
+	if err := src.MarshalBinaryTo(bts); err != nil {
+		panic("msgp: can't copy extension: " + err.Error())
+	}
+	d := reflect.ValueOf(dst)
+	fresh := reflect.New(d.Type().Elem())
+	if err := fresh.Interface().(Extension).UnmarshalBinary(bts); err != nil {
+		panic("msgp: can't copy extension: " + err.Error())
+	}
+	d.Elem().Set(fresh.Elem())
+}
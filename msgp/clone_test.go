@@ -0,0 +1,42 @@
+package msgp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCopyIntf(t *testing.T) {
+	mk := func() interface{} {
+		return map[string]interface{}{
+			"list": []interface{}{int64(1), "two", []byte("three")},
+			"strs": map[string]string{"a": "b"},
+			"ext":  &RawExtension{Type: 5, Data: []byte("ext")},
+			"nil":  nil,
+		}
+	}
+	orig := mk()
+	cp := CopyIntf(orig)
+	if !reflect.DeepEqual(orig, cp) {
+		t.Fatalf("copy isn't equal:\n%v\n%v", orig, cp)
+	}
+
+	m := orig.(map[string]interface{})
+	m["new"] = true
+	m["list"].([]interface{})[2].([]byte)[0] = 'X'
+	m["strs"].(map[string]string)["a"] = "changed"
+	m["ext"].(*RawExtension).Data[0] = 'X'
+
+	if !reflect.DeepEqual(cp, mk()) {
+		t.Errorf("copy was changed by mutating the original:\n%v", cp)
+	}
+}
+
+func TestCopyExtension(t *testing.T) {
+	src := RawExtension{Type: 3, Data: []byte("data")}
+	dst := src
+	CopyExtension(&dst, &src)
+	src.Data[0] = 'X'
+	if dst.Type != 3 || string(dst.Data) != "data" {
+		t.Errorf("got %+v", dst)
+	}
+}
@@ -0,0 +1,210 @@
+package msgp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// CoerceError is returned when a 'str'
+// can't be parsed as the number it is
+// being coerced into.
+type CoerceError struct {
+	Value string // the string that was encoded
+	Kind  Type   // the type it was coerced into
+	Err   error  // the error from package strconv
+}
+
+// Error implements the error interface
+func (c CoerceError) Error() string {
+	return fmt.Sprintf("msgp: can't coerce %q into %s: %s", c.Value, c.Kind, c.Err)
+}
+
+// Resumable returns true, since the
+// 'str' has been read.
+func (c CoerceError) Resumable() bool { return true }
+
+// parseInt parses 's' as an int of size 'bits'
+func parseInt(s []byte, bits int) (int64, error) {
+	i, err := strconv.ParseInt(string(s), 10, bits)
+	if err != nil {
+		return 0, CoerceError{Value: string(s), Kind: IntType, Err: err.(*strconv.NumError).Err}
+	}
+	return i, nil
+}
+
+// parseUint parses 's' as a uint of size 'bits'
+func parseUint(s []byte, bits int) (uint64, error) {
+	u, err := strconv.ParseUint(string(s), 10, bits)
+	if err != nil {
+		return 0, CoerceError{Value: string(s), Kind: UintType, Err: err.(*strconv.NumError).Err}
+	}
+	return u, nil
+}
+
+// parseFloat parses 's' as a float of size 'bits'
+func parseFloat(s []byte, bits int) (float64, error) {
+	kind := Float64Type
+	if bits == 32 {
+		kind = Float32Type
+	}
+	f, err := strconv.ParseFloat(string(s), bits)
+	if err != nil {
+		return 0, CoerceError{Value: string(s), Kind: kind, Err: err.(*strconv.NumError).Err}
+	}
+	return f, nil
+}
+
+// checkInt returns an IntOverflow if 'i'
+// doesn't fit in an int of size 'bits'
+func checkInt(i int64, bits int) error {
+	if bits == 0 {
+		bits = strconv.IntSize
+	}
+	if bits < 64 && (i > 1<<uint(bits-1)-1 || i < -1<<uint(bits-1)) {
+		return IntOverflow{Value: i, FailedBitsize: bits}
+	}
+	return nil
+}
+
+// checkUint returns a UintOverflow if 'u'
+// doesn't fit in a uint of size 'bits'
+func checkUint(u uint64, bits int) error {
+	if bits == 0 {
+		bits = strconv.IntSize
+	}
+	if bits < 64 && u > 1<<uint(bits)-1 {
+		return UintOverflow{Value: u, FailedBitsize: bits}
+	}
+	return nil
+}
+
+// ReadIntCoerce reads an int that fits in 'bits' bits
+// (or the size of an int, if 'bits' is 0). If the next
+// object is a 'str', it is parsed as a base-10 integer.
+// Possible errors:
+// - TypeError{} (not an int or str)
+// - IntOverflow{} (the value doesn't fit)
+// - CoerceError{} (the str isn't an integer)
+func (m *Reader) ReadIntCoerce(bits int) (int64, error) {
+	t, err := m.NextType()
+	if err != nil {
+		return 0, err
+	}
+	if t == StrType {
+		m.scratch, err = m.ReadStringAsBytes(m.scratch[:0])
+		if err != nil {
+			return 0, err
+		}
+		return parseInt(m.scratch, bits)
+	}
+	i, err := m.ReadInt64()
+	if err != nil {
+		return 0, err
+	}
+	return i, checkInt(i, bits)
+}
+
+// ReadUintCoerce reads a uint that fits in 'bits' bits
+// (or the size of a uint, if 'bits' is 0). If the next
+// object is a 'str', it is parsed as a base-10 integer.
+// Possible errors:
+// - TypeError{} (not a uint or str)
+// - UintOverflow{} (the value doesn't fit)
+// - CoerceError{} (the str isn't an unsigned integer)
+func (m *Reader) ReadUintCoerce(bits int) (uint64, error) {
+	t, err := m.NextType()
+	if err != nil {
+		return 0, err
+	}
+	if t == StrType {
+		m.scratch, err = m.ReadStringAsBytes(m.scratch[:0])
+		if err != nil {
+			return 0, err
+		}
+		return parseUint(m.scratch, bits)
+	}
+	u, err := m.ReadUint64()
+	if err != nil {
+		return 0, err
+	}
+	return u, checkUint(u, bits)
+}
+
+// ReadFloatCoerce reads a float32 (if 'bits' is 32)
+// or a float64. If the next object is a 'str', it is
+// parsed as a floating-point number.
+// Possible errors:
+// - TypeError{} (not a float or str)
+// - CoerceError{} (the str isn't a number)
+func (m *Reader) ReadFloatCoerce(bits int) (float64, error) {
+	t, err := m.NextType()
+	if err != nil {
+		return 0, err
+	}
+	if t == StrType {
+		m.scratch, err = m.ReadStringAsBytes(m.scratch[:0])
+		if err != nil {
+			return 0, err
+		}
+		return parseFloat(m.scratch, bits)
+	}
+	if bits == 32 {
+		f, err := m.ReadFloat32()
+		return float64(f), err
+	}
+	return m.ReadFloat64()
+}
+
+// ReadIntCoerceBytes is like ReadIntCoerce, but
+// reads from 'b' and returns the remaining bytes.
+func ReadIntCoerceBytes(b []byte, bits int) (int64, []byte, error) {
+	if len(b) > 0 && getType(b[0]) == StrType {
+		s, o, err := ReadStringZC(b)
+		if err != nil {
+			return 0, b, err
+		}
+		i, err := parseInt(s, bits)
+		return i, o, err
+	}
+	i, o, err := ReadInt64Bytes(b)
+	if err != nil {
+		return 0, o, err
+	}
+	return i, o, checkInt(i, bits)
+}
+
+// ReadUintCoerceBytes is like ReadUintCoerce, but
+// reads from 'b' and returns the remaining bytes.
+func ReadUintCoerceBytes(b []byte, bits int) (uint64, []byte, error) {
+	if len(b) > 0 && getType(b[0]) == StrType {
+		s, o, err := ReadStringZC(b)
+		if err != nil {
+			return 0, b, err
+		}
+		u, err := parseUint(s, bits)
+		return u, o, err
+	}
+	u, o, err := ReadUint64Bytes(b)
+	if err != nil {
+		return 0, o, err
+	}
+	return u, o, checkUint(u, bits)
+}
+
+// ReadFloatCoerceBytes is like ReadFloatCoerce, but
+// reads from 'b' and returns the remaining bytes.
+func ReadFloatCoerceBytes(b []byte, bits int) (float64, []byte, error) {
+	if len(b) > 0 && getType(b[0]) == StrType {
+		s, o, err := ReadStringZC(b)
+		if err != nil {
+			return 0, b, err
+		}
+		f, err := parseFloat(s, bits)
+		return f, o, err
+	}
+	if bits == 32 {
+		f, o, err := ReadFloat32Bytes(b)
+		return float64(f), o, err
+	}
+	return ReadFloat64Bytes(b)
+}
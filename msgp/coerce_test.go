@@ -0,0 +1,137 @@
+package msgp
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestReadCoerce(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		bits int
+		i    int64
+		u    uint64
+		f    float64
+		ierr bool // ReadIntCoerce fails
+		uerr bool // ReadUintCoerce fails
+		ferr bool // ReadFloatCoerce fails
+	}{
+		{AppendString(nil, "42"), 64, 42, 42, 42, false, false, false},
+		{AppendString(nil, "-42"), 8, -42, 0, -42, false, true, false},
+		{AppendString(nil, "255"), 8, 0, 255, 255, true, false, false},
+		{AppendString(nil, "1.5"), 32, 0, 0, 1.5, true, true, false},
+		{AppendString(nil, "nope"), 64, 0, 0, 0, true, true, true},
+		{AppendInt64(nil, -5), 8, -5, 0, 0, false, true, true},
+		{AppendInt64(nil, 300), 8, 0, 0, 0, true, true, true},
+		{AppendUint64(nil, 300), 16, 0, 300, 0, true, false, true},
+		{AppendFloat64(nil, 2.5), 64, 0, 0, 2.5, true, true, false},
+		{AppendFloat32(nil, 2.5), 32, 0, 0, 2.5, true, true, false},
+		{AppendBool(nil, true), 64, 0, 0, 0, true, true, true},
+	}
+
+	for i, tt := range tests {
+		rd := NewReader(bytes.NewReader(tt.in))
+		iv, err := rd.ReadIntCoerce(tt.bits)
+		if (err != nil) != tt.ierr || (err == nil && iv != tt.i) {
+			t.Errorf("test %d: ReadIntCoerce: got %d, %v", i, iv, err)
+		}
+		ib, _, err := ReadIntCoerceBytes(tt.in, tt.bits)
+		if (err != nil) != tt.ierr || (err == nil && ib != tt.i) {
+			t.Errorf("test %d: ReadIntCoerceBytes: got %d, %v", i, ib, err)
+		}
+
+		rd = NewReader(bytes.NewReader(tt.in))
+		uv, err := rd.ReadUintCoerce(tt.bits)
+		if (err != nil) != tt.uerr || (err == nil && uv != tt.u) {
+			t.Errorf("test %d: ReadUintCoerce: got %d, %v", i, uv, err)
+		}
+		ub, _, err := ReadUintCoerceBytes(tt.in, tt.bits)
+		if (err != nil) != tt.uerr || (err == nil && ub != tt.u) {
+			t.Errorf("test %d: ReadUintCoerceBytes: got %d, %v", i, ub, err)
+		}
+
+		rd = NewReader(bytes.NewReader(tt.in))
+		fv, err := rd.ReadFloatCoerce(tt.bits)
+		if (err != nil) != tt.ferr || (err == nil && fv != tt.f) {
+			t.Errorf("test %d: ReadFloatCoerce: got %g, %v", i, fv, err)
+		}
+		fb, _, err := ReadFloatCoerceBytes(tt.in, tt.bits)
+		if (err != nil) != tt.ferr || (err == nil && fb != tt.f) {
+			t.Errorf("test %d: ReadFloatCoerceBytes: got %g, %v", i, fb, err)
+		}
+	}
+
+	_, _, err := ReadIntCoerceBytes(AppendString(nil, "x"), 64)
+	ce, ok := err.(CoerceError)
+	if !ok || ce.Value != "x" || ce.Kind != IntType || ce.Err != strconv.ErrSyntax {
+		t.Errorf("unexpected error %#v", err)
+	}
+	if !IsError(err) {
+		t.Error("expected CoerceError to be a msgp error")
+	}
+}
+
+func TestCheckIntBits(t *testing.T) {
+	// the checks that ReadInt and ReadUint make
+	// with strconv.IntSize, at both sizes an
+	// int can be
+	tests := []struct {
+		bits int
+		i    int64
+		u    uint64
+		ierr bool
+		uerr bool
+	}{
+		{32, 1<<31 - 1, 1<<32 - 1, false, false},
+		{32, -1 << 31, 0, false, false},
+		{32, 1 << 31, 1 << 32, true, true},
+		{32, -1<<31 - 1, 1 << 63, true, true},
+		{64, 1 << 31, 1 << 32, false, false},
+		{64, -1 << 63, 1<<64 - 1, false, false},
+	}
+	for _, tt := range tests {
+		err := checkInt(tt.i, tt.bits)
+		if (err != nil) != tt.ierr {
+			t.Errorf("checkInt(%d, %d): got %v", tt.i, tt.bits, err)
+		}
+		if e, ok := err.(IntOverflow); err != nil && (!ok || e.FailedBitsize != tt.bits || e.Value != tt.i) {
+			t.Errorf("checkInt(%d, %d): got %#v", tt.i, tt.bits, err)
+		}
+		err = checkUint(tt.u, tt.bits)
+		if (err != nil) != tt.uerr {
+			t.Errorf("checkUint(%d, %d): got %v", tt.u, tt.bits, err)
+		}
+		if e, ok := err.(UintOverflow); err != nil && (!ok || e.FailedBitsize != tt.bits || e.Value != tt.u) {
+			t.Errorf("checkUint(%d, %d): got %#v", tt.u, tt.bits, err)
+		}
+	}
+
+	// and ReadInt and ReadUint agree with
+	// them on this platform, leaving the
+	// next object to be read
+	next := AppendString(nil, "next")
+	for _, tt := range tests {
+		msg := append(AppendInt64(nil, tt.i), next...)
+		want := checkInt(tt.i, strconv.IntSize)
+		_, left, err := ReadIntBytes(msg)
+		if err != want || !bytes.Equal(left, next) {
+			t.Errorf("ReadIntBytes(%d): got %v with %x left; want %v", tt.i, err, left, want)
+		}
+		rd := NewReader(bytes.NewReader(msg))
+		if _, err = rd.ReadInt(); err != want {
+			t.Errorf("ReadInt(%d): got %v; want %v", tt.i, err, want)
+		}
+
+		msg = append(AppendUint64(nil, tt.u), next...)
+		want = checkUint(tt.u, strconv.IntSize)
+		_, left, err = ReadUintBytes(msg)
+		if err != want || !bytes.Equal(left, next) {
+			t.Errorf("ReadUintBytes(%d): got %v with %x left; want %v", tt.u, err, left, want)
+		}
+		rd = NewReader(bytes.NewReader(msg))
+		if _, err = rd.ReadUint(); err != want {
+			t.Errorf("ReadUint(%d): got %v; want %v", tt.u, err, want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package compat has the API of the upstream msgp
+// package, which this fork started from, and writes
+// what upstream writes, so that code can move to this
+// fork's msgp one file at a time while the programs
+// that read what it writes haven't.
+//
+// The only difference on the wire is times: msgp writes
+// them as timestamps of the MessagePack spec, which
+// upstream can't read, and this package writes them as
+// extension 5 with their location, as upstream does.
+// Both read either. The writers this package returns
+// use msgp.EncodeOptions.LegacyTime, so the EncodeMsg
+// methods of generated types write times as extension
+// 5, too; MarshalMsg methods write what msgp writes.
+//
+// Everything else is msgp's: the types are aliases, and
+// the functions call the msgp functions of the same name.
+//
+// Deprecated: once everything reading what's written
+// reads spec timestamps, import msgp instead.
+package compat
+
+import (
+	"io"
+	"time"
+
+	"github.com/philhofer/msgp/msgp"
+)
+
+// Types are aliases of the msgp types, so values
+// and methods are shared with code that imports msgp.
+type (
+	ArrayError         = msgp.ArrayError
+	Decodable          = msgp.Decodable
+	Encodable          = msgp.Encodable
+	EndlessReader      = msgp.EndlessReader
+	Extension          = msgp.Extension
+	ExtensionTypeError = msgp.ExtensionTypeError
+	IntOverflow        = msgp.IntOverflow
+	InvalidPrefixError = msgp.InvalidPrefixError
+	Marshaler          = msgp.Marshaler
+	RawExtension       = msgp.RawExtension
+	Reader             = msgp.Reader
+	Sizer              = msgp.Sizer
+	Type               = msgp.Type
+	TypeError          = msgp.TypeError
+	UintOverflow       = msgp.UintOverflow
+	Unmarshaler        = msgp.Unmarshaler
+	Writer             = msgp.Writer
+)
+
+// Constants are those of msgp.
+const (
+	ArrayHeaderSize     = msgp.ArrayHeaderSize
+	ArrayType           = msgp.ArrayType
+	BinType             = msgp.BinType
+	BoolSize            = msgp.BoolSize
+	BoolType            = msgp.BoolType
+	BytesPrefixSize     = msgp.BytesPrefixSize
+	Complex128Extension = msgp.Complex128Extension
+	Complex128Size      = msgp.Complex128Size
+	Complex128Type      = msgp.Complex128Type
+	Complex64Extension  = msgp.Complex64Extension
+	Complex64Size       = msgp.Complex64Size
+	Complex64Type       = msgp.Complex64Type
+	ExtensionPrefixSize = msgp.ExtensionPrefixSize
+	ExtensionType       = msgp.ExtensionType
+	Float32Size         = msgp.Float32Size
+	Float32Type         = msgp.Float32Type
+	Float64Size         = msgp.Float64Size
+	Float64Type         = msgp.Float64Type
+	Int16Size           = msgp.Int16Size
+	Int32Size           = msgp.Int32Size
+	Int64Size           = msgp.Int64Size
+	Int8Size            = msgp.Int8Size
+	IntSize             = msgp.IntSize
+	IntType             = msgp.IntType
+	InvalidType         = msgp.InvalidType
+	MapHeaderSize       = msgp.MapHeaderSize
+	MapType             = msgp.MapType
+	NilSize             = msgp.NilSize
+	NilType             = msgp.NilType
+	StrType             = msgp.StrType
+	StringPrefixSize    = msgp.StringPrefixSize
+	TimeExtension       = msgp.TimeExtension
+	TimeSize            = msgp.TimeSize
+	TimeType            = msgp.TimeType
+	Uint16Size          = msgp.Uint16Size
+	Uint32Size          = msgp.Uint32Size
+	Uint64Size          = msgp.Uint64Size
+	Uint8Size           = msgp.Uint8Size
+	UintSize            = msgp.UintSize
+	UintType            = msgp.UintType
+)
+
+// Variables are those of msgp.
+var (
+	ErrShortBytes = msgp.ErrShortBytes
+	Nowhere       = msgp.Nowhere
+)
+
+// legacy is the options of the writers this
+// package writes with (see the package doc)
+var legacy = msgp.EncodeOptions{LegacyTime: true}
+
+// AppendTime appends a time.Time to the slice
+// as extension 5, as the original msgp did.
+//
+// Deprecated: use msgp.AppendTimeExtension, or
+// msgp.AppendTime to write a spec timestamp.
+func AppendTime(b []byte, t time.Time) []byte {
+	return msgp.AppendTimeExtension(b, t)
+}
+
+// AppendIntf is msgp.AppendIntf, but it appends
+// a time.Time as AppendTime does.
+//
+// Deprecated: use msgp.AppendIntfOpt with
+// msgp.EncodeOptions{LegacyTime: true}.
+func AppendIntf(b []byte, i interface{}) ([]byte, error) {
+	return msgp.AppendIntfOpt(b, i, legacy)
+}
+
+// AppendMapStrIntf is msgp.AppendMapStrIntf, but
+// it appends a time.Time as AppendTime does.
+//
+// Deprecated: use msgp.AppendIntfOpt with
+// msgp.EncodeOptions{LegacyTime: true}.
+func AppendMapStrIntf(b []byte, m map[string]interface{}) ([]byte, error) {
+	return msgp.AppendIntfOpt(b, m, legacy)
+}
+
+// NewWriter is msgp.NewWriter, but the
+// writer writes times as AppendTime does.
+//
+// Deprecated: use msgp.NewWriterWithOptions with
+// msgp.EncodeOptions{LegacyTime: true}.
+func NewWriter(w io.Writer) *Writer {
+	mw := msgp.NewWriter(w)
+	mw.ApplyOptions(legacy)
+	return mw
+}
+
+// NewWriterSize is msgp.NewWriterSize, but the
+// writer writes times as AppendTime does.
+//
+// Deprecated: use msgp.NewWriterSize and
+// (*msgp.Writer).ApplyOptions with
+// msgp.EncodeOptions{LegacyTime: true}.
+func NewWriterSize(w io.Writer, sz int) *Writer {
+	mw := msgp.NewWriterSize(w, sz)
+	mw.ApplyOptions(legacy)
+	return mw
+}
+
+// Encode is msgp.Encode, but
+// it writes with NewWriter.
+//
+// Deprecated: use msgp.Encode.
+func Encode(w io.Writer, e Encodable) error {
+	wr := NewWriter(w)
+	err := e.EncodeMsg(wr)
+	if err == nil {
+		err = wr.Flush()
+	}
+	FreeW(wr)
+	return err
+}
+
+// Write is msgp.Write, but it writes with
+// NewWriter, which rewrites the times that
+// MarshalMsg appends as AppendTime does.
+//
+// Deprecated: use msgp.Write.
+func Write(w io.Writer, m Marshaler) error {
+	wr := NewWriter(w)
+	err := wr.AppendMsg(m.MarshalMsg)
+	if err == nil {
+		err = wr.Flush()
+	}
+	FreeW(wr)
+	return err
+}
@@ -0,0 +1,280 @@
+package compat
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/philhofer/msgp/msgp"
+)
+
+// TestSameAsMsgp checks that each function that calls
+// the msgp function of the same name returns what it
+// does, for random arguments. (The functions that take
+// arguments testing/quick can't make, or that write maps,
+// whose order is random, are checked in TestSameAsMsgpByHand.)
+func TestSameAsMsgp(t *testing.T) {
+	funcs := []struct {
+		name         string
+		compat, msgp interface{}
+	}{
+		{"AppendArrayHeader", AppendArrayHeader, msgp.AppendArrayHeader},
+		{"AppendBool", AppendBool, msgp.AppendBool},
+		{"AppendByte", AppendByte, msgp.AppendByte},
+		{"AppendBytes", AppendBytes, msgp.AppendBytes},
+		{"AppendComplex128", AppendComplex128, msgp.AppendComplex128},
+		{"AppendComplex64", AppendComplex64, msgp.AppendComplex64},
+		{"AppendFloat32", AppendFloat32, msgp.AppendFloat32},
+		{"AppendFloat64", AppendFloat64, msgp.AppendFloat64},
+		{"AppendInt", AppendInt, msgp.AppendInt},
+		{"AppendInt16", AppendInt16, msgp.AppendInt16},
+		{"AppendInt32", AppendInt32, msgp.AppendInt32},
+		{"AppendInt64", AppendInt64, msgp.AppendInt64},
+		{"AppendInt8", AppendInt8, msgp.AppendInt8},
+		{"AppendMapHeader", AppendMapHeader, msgp.AppendMapHeader},
+		{"AppendNil", AppendNil, msgp.AppendNil},
+		{"AppendString", AppendString, msgp.AppendString},
+		{"AppendUint", AppendUint, msgp.AppendUint},
+		{"AppendUint16", AppendUint16, msgp.AppendUint16},
+		{"AppendUint32", AppendUint32, msgp.AppendUint32},
+		{"AppendUint64", AppendUint64, msgp.AppendUint64},
+		{"AppendUint8", AppendUint8, msgp.AppendUint8},
+		{"CopyReplace", CopyReplace, msgp.CopyReplace},
+		{"HasKey", HasKey, msgp.HasKey},
+		{"IsNil", IsNil, msgp.IsNil},
+		{"Locate", Locate, msgp.Locate},
+		{"ReadArrayHeaderBytes", ReadArrayHeaderBytes, msgp.ReadArrayHeaderBytes},
+		{"ReadBoolBytes", ReadBoolBytes, msgp.ReadBoolBytes},
+		{"ReadByteBytes", ReadByteBytes, msgp.ReadByteBytes},
+		{"ReadBytesBytes", ReadBytesBytes, msgp.ReadBytesBytes},
+		{"ReadBytesZC", ReadBytesZC, msgp.ReadBytesZC},
+		{"ReadComplex128Bytes", ReadComplex128Bytes, msgp.ReadComplex128Bytes},
+		{"ReadComplex64Bytes", ReadComplex64Bytes, msgp.ReadComplex64Bytes},
+		{"ReadFloat32Bytes", ReadFloat32Bytes, msgp.ReadFloat32Bytes},
+		{"ReadFloat64Bytes", ReadFloat64Bytes, msgp.ReadFloat64Bytes},
+		{"ReadInt16Bytes", ReadInt16Bytes, msgp.ReadInt16Bytes},
+		{"ReadInt32Bytes", ReadInt32Bytes, msgp.ReadInt32Bytes},
+		{"ReadInt64Bytes", ReadInt64Bytes, msgp.ReadInt64Bytes},
+		{"ReadInt8Bytes", ReadInt8Bytes, msgp.ReadInt8Bytes},
+		{"ReadIntBytes", ReadIntBytes, msgp.ReadIntBytes},
+		{"ReadIntfBytes", ReadIntfBytes, msgp.ReadIntfBytes},
+		{"ReadMapHeaderBytes", ReadMapHeaderBytes, msgp.ReadMapHeaderBytes},
+		{"ReadMapKeyZC", ReadMapKeyZC, msgp.ReadMapKeyZC},
+		{"ReadNilBytes", ReadNilBytes, msgp.ReadNilBytes},
+		{"ReadStringBytes", ReadStringBytes, msgp.ReadStringBytes},
+		{"ReadStringZC", ReadStringZC, msgp.ReadStringZC},
+		{"ReadTimeBytes", ReadTimeBytes, msgp.ReadTimeBytes},
+		{"ReadUint16Bytes", ReadUint16Bytes, msgp.ReadUint16Bytes},
+		{"ReadUint32Bytes", ReadUint32Bytes, msgp.ReadUint32Bytes},
+		{"ReadUint64Bytes", ReadUint64Bytes, msgp.ReadUint64Bytes},
+		{"ReadUint8Bytes", ReadUint8Bytes, msgp.ReadUint8Bytes},
+		{"ReadUintBytes", ReadUintBytes, msgp.ReadUintBytes},
+		{"Remove", Remove, msgp.Remove},
+		{"Replace", Replace, msgp.Replace},
+		{"Skip", Skip, msgp.Skip},
+		{"UnsafeBytes", UnsafeBytes, msgp.UnsafeBytes},
+		{"UnsafeString", UnsafeString, msgp.UnsafeString},
+	}
+	for _, f := range funcs {
+		if err := quick.CheckEqual(f.compat, f.msgp, nil); err != nil {
+			t.Errorf("%s: %s", f.name, err)
+		}
+	}
+}
+
+func TestSameAsMsgpByHand(t *testing.T) {
+	ext := &RawExtension{Type: 9, Data: []byte("ext")}
+	app, err := AppendExtension(nil, ext)
+	want, _ := msgp.AppendExtension(nil, ext)
+	if err != nil || !bytes.Equal(app, want) {
+		t.Errorf("AppendExtension: got %x, %v; want %x", app, err, want)
+	}
+	if ExtensionSize(ext) != msgp.ExtensionSize(ext) {
+		t.Errorf("ExtensionSize: got %d; want %d", ExtensionSize(ext), msgp.ExtensionSize(ext))
+	}
+	out := RawExtension{Type: ext.Type}
+	if _, err := ReadExtensionBytes(app, &out); err != nil || !reflect.DeepEqual(&out, ext) {
+		t.Errorf("ReadExtensionBytes: got %v, %v; want %v", out, err, ext)
+	}
+
+	mss := map[string]string{"a": "b"}
+	if got, want := AppendMapStrStr(nil, mss), msgp.AppendMapStrStr(nil, mss); !bytes.Equal(got, want) {
+		t.Errorf("AppendMapStrStr: got %x; want %x", got, want)
+	}
+
+	for _, v := range []interface{}{nil, 1.5, "str", []byte("bin"), ext, map[string]interface{}{"a": int64(1)}} {
+		if GuessSize(v) != msgp.GuessSize(v) {
+			t.Errorf("GuessSize(%v): got %d; want %d", v, GuessSize(v), msgp.GuessSize(v))
+		}
+	}
+	for _, err := range []error{nil, ErrShortBytes, msgp.ErrShortBytes, TypeError{Method: msgp.StrType, Encoded: msgp.IntType}} {
+		if IsError(err) != msgp.IsError(err) {
+			t.Errorf("IsError(%v): got %t; want %t", err, IsError(err), msgp.IsError(err))
+		}
+	}
+
+	m := map[string]interface{}{"a": "b", "c": []interface{}{int64(1), true}}
+	bts, _ := msgp.AppendMapStrIntf(nil, m)
+	out2, _, err := ReadMapStrIntfBytes(bts, nil)
+	if err != nil || !reflect.DeepEqual(out2, m) {
+		t.Errorf("ReadMapStrIntfBytes: got %v, %v; want %v", out2, err, m)
+	}
+
+	var js, wantjs bytes.Buffer
+	if _, err := UnmarshalAsJSON(&js, bts); err != nil {
+		t.Fatal(err)
+	}
+	msgp.UnmarshalAsJSON(&wantjs, bts)
+	if js.String() != wantjs.String() {
+		t.Errorf("UnmarshalAsJSON: got %s; want %s", js.String(), wantjs.String())
+	}
+	js.Reset()
+	if _, err := CopyToJSON(&js, bytes.NewReader(bts)); err != nil || js.String() != wantjs.String() {
+		t.Errorf("CopyToJSON: got %s, %v; want %s", js.String(), err, wantjs.String())
+	}
+
+	rd := NewReader(bytes.NewReader(bts))
+	v, err := rd.ReadIntf()
+	if err != nil || !reflect.DeepEqual(v, m) {
+		t.Errorf("NewReader: got %v, %v; want %v", v, err, m)
+	}
+	FreeR(rd)
+	rd = NewReaderSize(bytes.NewReader(bts), 32)
+	if v, err = rd.ReadIntf(); err != nil || !reflect.DeepEqual(v, m) {
+		t.Errorf("NewReaderSize: got %v, %v; want %v", v, err, m)
+	}
+	p, wp := make([]byte, 2*len(bts)), make([]byte, 2*len(bts))
+	NewEndlessReader(bts).Read(p)
+	msgp.NewEndlessReader(bts).Read(wp)
+	if !bytes.Equal(p, wp) {
+		t.Errorf("NewEndlessReader: read %x; want %x", p, wp)
+	}
+
+	b := Require(nil, 10)
+	if len(b) != 0 || cap(b) < 10 {
+		t.Errorf("Require: got len %d, cap %d", len(b), cap(b))
+	}
+}
+
+// upstream is a time and the bytes the upstream
+// msgp writes it as, with WriteTime and WriteIntf
+var upstream = struct {
+	t   time.Time
+	hex string
+}{
+	t:   time.Date(2015, 6, 1, 12, 30, 0, 123456789, time.FixedZone("", 3600)),
+	hex: "d805010000000eccfe3938075bcd15003c00",
+}
+
+// timeEnc writes a time as generated
+// code does, both ways
+type timeEnc time.Time
+
+func (t timeEnc) EncodeMsg(w *Writer) error { return w.WriteTime(time.Time(t)) }
+
+func (t timeEnc) MarshalMsg(b []byte) ([]byte, error) {
+	return msgp.AppendTime(b, time.Time(t)), nil
+}
+
+// TestWritesAsUpstream checks that times are
+// written as upstream writes them, by everything
+func TestWritesAsUpstream(t *testing.T) {
+	want, _ := hex.DecodeString(upstream.hex)
+	tm := upstream.t
+
+	// upstream doesn't write times with AppendIntf,
+	// but this writes what its WriteIntf writes
+	got := map[string][]byte{"AppendTime": AppendTime(nil, tm)}
+	got["AppendIntf"], _ = AppendIntf(nil, tm)
+	m, _ := AppendMapStrIntf(nil, map[string]interface{}{"t": tm})
+	got["AppendMapStrIntf"] = m[len(AppendString(AppendMapHeader(nil, 1), "t")):]
+
+	var buf bytes.Buffer
+	for name, fn := range map[string]func(*Writer) error{
+		"WriteTime": func(w *Writer) error { return w.WriteTime(tm) },
+		"WriteIntf": func(w *Writer) error { return w.WriteIntf(tm) },
+	} {
+		buf.Reset()
+		wr := NewWriter(&buf)
+		if err := fn(wr); err != nil {
+			t.Fatal(err)
+		}
+		wr.Flush()
+		FreeW(wr)
+		got["NewWriter "+name] = append([]byte(nil), buf.Bytes()...)
+
+		buf.Reset()
+		wr = NewWriterSize(&buf, 64)
+		fn(wr)
+		wr.Flush()
+		got["NewWriterSize "+name] = append([]byte(nil), buf.Bytes()...)
+	}
+
+	buf.Reset()
+	if err := Encode(&buf, timeEnc(tm)); err != nil {
+		t.Fatal(err)
+	}
+	got["Encode"] = append([]byte(nil), buf.Bytes()...)
+
+	// MarshalMsg writes a timestamp, without the
+	// location, which Write rewrites in UTC
+	buf.Reset()
+	if err := Write(&buf, timeEnc(tm)); err != nil {
+		t.Fatal(err)
+	}
+	got["Write"] = append([]byte(nil), buf.Bytes()...)
+
+	for name, b := range got {
+		w := want
+		if name == "Write" {
+			w = msgp.AppendTimeExtension(nil, tm.UTC())
+		}
+		if !bytes.Equal(b, w) {
+			t.Errorf("%s: got %x; want %x", name, b, w)
+		}
+	}
+
+	// and msgp reads it back, location and all
+	back, _, err := msgp.ReadTimeBytes(want)
+	if err != nil || !back.Equal(tm) || back.Format(time.RFC3339) != tm.Format(time.RFC3339) {
+		t.Errorf("read back %v, %v; want %v", back, err, tm)
+	}
+}
+
+// TestWritesAsMsgp checks that everything
+// but times is written as msgp writes it
+func TestWritesAsMsgp(t *testing.T) {
+	vals := []interface{}{
+		nil, true, 1.5, float32(2.5), int64(-300), uint16(9000),
+		complex64(1 + 2i), "str", []byte("bin"), map[string]string{"a": "b"},
+		[]interface{}{"a", int64(1), nil}, &RawExtension{Type: 9, Data: []byte("e")},
+	}
+	for _, v := range vals {
+		got, err := AppendIntf(nil, v)
+		want, werr := msgp.AppendIntf(nil, v)
+		if err != werr || !bytes.Equal(got, want) {
+			t.Errorf("AppendIntf(%v): got %x, %v; want %x, %v", v, got, err, want, werr)
+		}
+
+		var buf, wbuf bytes.Buffer
+		wr, wwr := NewWriter(&buf), msgp.NewWriter(&wbuf)
+		wr.WriteIntf(v)
+		wwr.WriteIntf(v)
+		wr.Flush()
+		wwr.Flush()
+		if !bytes.Equal(buf.Bytes(), wbuf.Bytes()) {
+			t.Errorf("WriteIntf(%v): got %x; want %x", v, buf.Bytes(), wbuf.Bytes())
+		}
+	}
+
+	m := map[string]interface{}{"a": int64(1), "b": "c"}
+	got, _ := AppendMapStrIntf(nil, m)
+	want, _ := msgp.AppendMapStrIntf(nil, m)
+	back, _, _ := msgp.ReadMapStrIntfBytes(got, nil)
+	if len(got) != len(want) || !reflect.DeepEqual(back, m) {
+		t.Errorf("AppendMapStrIntf: got %x; want %x", got, want)
+	}
+}
@@ -0,0 +1,519 @@
+package compat
+
+import (
+	"io"
+	"time"
+
+	"github.com/philhofer/msgp/msgp"
+)
+
+// AppendArrayHeader is msgp.AppendArrayHeader.
+//
+// Deprecated: use msgp.AppendArrayHeader.
+func AppendArrayHeader(b []byte, sz uint32) []byte {
+	return msgp.AppendArrayHeader(b, sz)
+}
+
+// AppendBool is msgp.AppendBool.
+//
+// Deprecated: use msgp.AppendBool.
+func AppendBool(b []byte, t bool) []byte {
+	return msgp.AppendBool(b, t)
+}
+
+// AppendByte is msgp.AppendByte.
+//
+// Deprecated: use msgp.AppendByte.
+func AppendByte(b []byte, u byte) []byte {
+	return msgp.AppendByte(b, u)
+}
+
+// AppendBytes is msgp.AppendBytes.
+//
+// Deprecated: use msgp.AppendBytes.
+func AppendBytes(b []byte, bts []byte) []byte {
+	return msgp.AppendBytes(b, bts)
+}
+
+// AppendComplex128 is msgp.AppendComplex128.
+//
+// Deprecated: use msgp.AppendComplex128.
+func AppendComplex128(b []byte, c complex128) []byte {
+	return msgp.AppendComplex128(b, c)
+}
+
+// AppendComplex64 is msgp.AppendComplex64.
+//
+// Deprecated: use msgp.AppendComplex64.
+func AppendComplex64(b []byte, c complex64) []byte {
+	return msgp.AppendComplex64(b, c)
+}
+
+// AppendExtension is msgp.AppendExtension.
+//
+// Deprecated: use msgp.AppendExtension.
+func AppendExtension(b []byte, e Extension) ([]byte, error) {
+	return msgp.AppendExtension(b, e)
+}
+
+// AppendFloat32 is msgp.AppendFloat32.
+//
+// Deprecated: use msgp.AppendFloat32.
+func AppendFloat32(b []byte, f float32) []byte {
+	return msgp.AppendFloat32(b, f)
+}
+
+// AppendFloat64 is msgp.AppendFloat64.
+//
+// Deprecated: use msgp.AppendFloat64.
+func AppendFloat64(b []byte, f float64) []byte {
+	return msgp.AppendFloat64(b, f)
+}
+
+// AppendInt is msgp.AppendInt.
+//
+// Deprecated: use msgp.AppendInt.
+func AppendInt(b []byte, i int) []byte {
+	return msgp.AppendInt(b, i)
+}
+
+// AppendInt16 is msgp.AppendInt16.
+//
+// Deprecated: use msgp.AppendInt16.
+func AppendInt16(b []byte, i int16) []byte {
+	return msgp.AppendInt16(b, i)
+}
+
+// AppendInt32 is msgp.AppendInt32.
+//
+// Deprecated: use msgp.AppendInt32.
+func AppendInt32(b []byte, i int32) []byte {
+	return msgp.AppendInt32(b, i)
+}
+
+// AppendInt64 is msgp.AppendInt64.
+//
+// Deprecated: use msgp.AppendInt64.
+func AppendInt64(b []byte, i int64) []byte {
+	return msgp.AppendInt64(b, i)
+}
+
+// AppendInt8 is msgp.AppendInt8.
+//
+// Deprecated: use msgp.AppendInt8.
+func AppendInt8(b []byte, i int8) []byte {
+	return msgp.AppendInt8(b, i)
+}
+
+// AppendMapHeader is msgp.AppendMapHeader.
+//
+// Deprecated: use msgp.AppendMapHeader.
+func AppendMapHeader(b []byte, sz uint32) []byte {
+	return msgp.AppendMapHeader(b, sz)
+}
+
+// AppendMapStrStr is msgp.AppendMapStrStr.
+//
+// Deprecated: use msgp.AppendMapStrStr.
+func AppendMapStrStr(b []byte, m map[string]string) []byte {
+	return msgp.AppendMapStrStr(b, m)
+}
+
+// AppendNil is msgp.AppendNil.
+//
+// Deprecated: use msgp.AppendNil.
+func AppendNil(b []byte) []byte {
+	return msgp.AppendNil(b)
+}
+
+// AppendString is msgp.AppendString.
+//
+// Deprecated: use msgp.AppendString.
+func AppendString(b []byte, s string) []byte {
+	return msgp.AppendString(b, s)
+}
+
+// AppendUint is msgp.AppendUint.
+//
+// Deprecated: use msgp.AppendUint.
+func AppendUint(b []byte, u uint) []byte {
+	return msgp.AppendUint(b, u)
+}
+
+// AppendUint16 is msgp.AppendUint16.
+//
+// Deprecated: use msgp.AppendUint16.
+func AppendUint16(b []byte, u uint16) []byte {
+	return msgp.AppendUint16(b, u)
+}
+
+// AppendUint32 is msgp.AppendUint32.
+//
+// Deprecated: use msgp.AppendUint32.
+func AppendUint32(b []byte, u uint32) []byte {
+	return msgp.AppendUint32(b, u)
+}
+
+// AppendUint64 is msgp.AppendUint64.
+//
+// Deprecated: use msgp.AppendUint64.
+func AppendUint64(b []byte, u uint64) []byte {
+	return msgp.AppendUint64(b, u)
+}
+
+// AppendUint8 is msgp.AppendUint8.
+//
+// Deprecated: use msgp.AppendUint8.
+func AppendUint8(b []byte, u uint8) []byte {
+	return msgp.AppendUint8(b, u)
+}
+
+// CopyReplace is msgp.CopyReplace.
+//
+// Deprecated: use msgp.CopyReplace.
+func CopyReplace(key string, raw []byte, val []byte) []byte {
+	return msgp.CopyReplace(key, raw, val)
+}
+
+// CopyToJSON is msgp.CopyToJSON.
+//
+// Deprecated: use msgp.CopyToJSON.
+func CopyToJSON(dst io.Writer, src io.Reader) (n int64, err error) {
+	return msgp.CopyToJSON(dst, src)
+}
+
+// Decode is msgp.Decode.
+//
+// Deprecated: use msgp.Decode.
+func Decode(r io.Reader, d Decodable) error {
+	return msgp.Decode(r, d)
+}
+
+// ExtensionSize is msgp.ExtensionSize.
+//
+// Deprecated: use msgp.ExtensionSize.
+func ExtensionSize(e Extension) int {
+	return msgp.ExtensionSize(e)
+}
+
+// FreeR is msgp.FreeR.
+//
+// Deprecated: use msgp.FreeR.
+func FreeR(m *Reader) {
+	msgp.FreeR(m)
+}
+
+// FreeW is msgp.FreeW.
+//
+// Deprecated: use msgp.FreeW.
+func FreeW(w *Writer) {
+	msgp.FreeW(w)
+}
+
+// GuessSize is msgp.GuessSize.
+//
+// Deprecated: use msgp.GuessSize.
+func GuessSize(i interface{}) int {
+	return msgp.GuessSize(i)
+}
+
+// HasKey is msgp.HasKey.
+//
+// Deprecated: use msgp.HasKey.
+func HasKey(key string, raw []byte) bool {
+	return msgp.HasKey(key, raw)
+}
+
+// IsError is msgp.IsError.
+//
+// Deprecated: use msgp.IsError.
+func IsError(err error) bool {
+	return msgp.IsError(err)
+}
+
+// IsNil is msgp.IsNil.
+//
+// Deprecated: use msgp.IsNil.
+func IsNil(b []byte) bool {
+	return msgp.IsNil(b)
+}
+
+// Locate is msgp.Locate.
+//
+// Deprecated: use msgp.Locate.
+func Locate(key string, raw []byte) []byte {
+	return msgp.Locate(key, raw)
+}
+
+// NewEndlessReader is msgp.NewEndlessReader.
+//
+// Deprecated: use msgp.NewEndlessReader.
+func NewEndlessReader(b []byte) *EndlessReader {
+	return msgp.NewEndlessReader(b)
+}
+
+// NewReader is msgp.NewReader.
+//
+// Deprecated: use msgp.NewReader.
+func NewReader(r io.Reader) *Reader {
+	return msgp.NewReader(r)
+}
+
+// NewReaderSize is msgp.NewReaderSize.
+//
+// Deprecated: use msgp.NewReaderSize.
+func NewReaderSize(r io.Reader, sz int) *Reader {
+	return msgp.NewReaderSize(r, sz)
+}
+
+// ReadArrayHeaderBytes is msgp.ReadArrayHeaderBytes.
+//
+// Deprecated: use msgp.ReadArrayHeaderBytes.
+func ReadArrayHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
+	return msgp.ReadArrayHeaderBytes(b)
+}
+
+// ReadBoolBytes is msgp.ReadBoolBytes.
+//
+// Deprecated: use msgp.ReadBoolBytes.
+func ReadBoolBytes(b []byte) (bool, []byte, error) {
+	return msgp.ReadBoolBytes(b)
+}
+
+// ReadByteBytes is msgp.ReadByteBytes.
+//
+// Deprecated: use msgp.ReadByteBytes.
+func ReadByteBytes(b []byte) (byte, []byte, error) {
+	return msgp.ReadByteBytes(b)
+}
+
+// ReadBytesBytes is msgp.ReadBytesBytes.
+//
+// Deprecated: use msgp.ReadBytesBytes.
+func ReadBytesBytes(b []byte, scratch []byte) (v []byte, o []byte, err error) {
+	return msgp.ReadBytesBytes(b, scratch)
+}
+
+// ReadBytesZC is msgp.ReadBytesZC.
+//
+// Deprecated: use msgp.ReadBytesZC.
+func ReadBytesZC(b []byte) (v []byte, o []byte, err error) {
+	return msgp.ReadBytesZC(b)
+}
+
+// ReadComplex128Bytes is msgp.ReadComplex128Bytes.
+//
+// Deprecated: use msgp.ReadComplex128Bytes.
+func ReadComplex128Bytes(b []byte) (c complex128, o []byte, err error) {
+	return msgp.ReadComplex128Bytes(b)
+}
+
+// ReadComplex64Bytes is msgp.ReadComplex64Bytes.
+//
+// Deprecated: use msgp.ReadComplex64Bytes.
+func ReadComplex64Bytes(b []byte) (c complex64, o []byte, err error) {
+	return msgp.ReadComplex64Bytes(b)
+}
+
+// ReadExtensionBytes is msgp.ReadExtensionBytes.
+//
+// Deprecated: use msgp.ReadExtensionBytes.
+func ReadExtensionBytes(b []byte, e Extension) ([]byte, error) {
+	return msgp.ReadExtensionBytes(b, e)
+}
+
+// ReadFloat32Bytes is msgp.ReadFloat32Bytes.
+//
+// Deprecated: use msgp.ReadFloat32Bytes.
+func ReadFloat32Bytes(b []byte) (f float32, o []byte, err error) {
+	return msgp.ReadFloat32Bytes(b)
+}
+
+// ReadFloat64Bytes is msgp.ReadFloat64Bytes.
+//
+// Deprecated: use msgp.ReadFloat64Bytes.
+func ReadFloat64Bytes(b []byte) (f float64, o []byte, err error) {
+	return msgp.ReadFloat64Bytes(b)
+}
+
+// ReadInt16Bytes is msgp.ReadInt16Bytes.
+//
+// Deprecated: use msgp.ReadInt16Bytes.
+func ReadInt16Bytes(b []byte) (int16, []byte, error) {
+	return msgp.ReadInt16Bytes(b)
+}
+
+// ReadInt32Bytes is msgp.ReadInt32Bytes.
+//
+// Deprecated: use msgp.ReadInt32Bytes.
+func ReadInt32Bytes(b []byte) (int32, []byte, error) {
+	return msgp.ReadInt32Bytes(b)
+}
+
+// ReadInt64Bytes is msgp.ReadInt64Bytes.
+//
+// Deprecated: use msgp.ReadInt64Bytes.
+func ReadInt64Bytes(b []byte) (i int64, o []byte, err error) {
+	return msgp.ReadInt64Bytes(b)
+}
+
+// ReadInt8Bytes is msgp.ReadInt8Bytes.
+//
+// Deprecated: use msgp.ReadInt8Bytes.
+func ReadInt8Bytes(b []byte) (int8, []byte, error) {
+	return msgp.ReadInt8Bytes(b)
+}
+
+// ReadIntBytes is msgp.ReadIntBytes.
+//
+// Deprecated: use msgp.ReadIntBytes.
+func ReadIntBytes(b []byte) (int, []byte, error) {
+	return msgp.ReadIntBytes(b)
+}
+
+// ReadIntfBytes is msgp.ReadIntfBytes.
+//
+// Deprecated: use msgp.ReadIntfBytes.
+func ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
+	return msgp.ReadIntfBytes(b)
+}
+
+// ReadMapHeaderBytes is msgp.ReadMapHeaderBytes.
+//
+// Deprecated: use msgp.ReadMapHeaderBytes.
+func ReadMapHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
+	return msgp.ReadMapHeaderBytes(b)
+}
+
+// ReadMapKeyZC is msgp.ReadMapKeyZC.
+//
+// Deprecated: use msgp.ReadMapKeyZC.
+func ReadMapKeyZC(b []byte) ([]byte, []byte, error) {
+	return msgp.ReadMapKeyZC(b)
+}
+
+// ReadMapStrIntfBytes is msgp.ReadMapStrIntfBytes.
+//
+// Deprecated: use msgp.ReadMapStrIntfBytes.
+func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (v map[string]interface{}, o []byte, err error) {
+	return msgp.ReadMapStrIntfBytes(b, old)
+}
+
+// ReadNilBytes is msgp.ReadNilBytes.
+//
+// Deprecated: use msgp.ReadNilBytes.
+func ReadNilBytes(b []byte) ([]byte, error) {
+	return msgp.ReadNilBytes(b)
+}
+
+// ReadStringBytes is msgp.ReadStringBytes.
+//
+// Deprecated: use msgp.ReadStringBytes.
+func ReadStringBytes(b []byte) (string, []byte, error) {
+	return msgp.ReadStringBytes(b)
+}
+
+// ReadStringZC is msgp.ReadStringZC.
+//
+// Deprecated: use msgp.ReadStringZC.
+func ReadStringZC(b []byte) (v []byte, o []byte, err error) {
+	return msgp.ReadStringZC(b)
+}
+
+// ReadTimeBytes is msgp.ReadTimeBytes.
+//
+// Deprecated: use msgp.ReadTimeBytes.
+func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
+	return msgp.ReadTimeBytes(b)
+}
+
+// ReadUint16Bytes is msgp.ReadUint16Bytes.
+//
+// Deprecated: use msgp.ReadUint16Bytes.
+func ReadUint16Bytes(b []byte) (uint16, []byte, error) {
+	return msgp.ReadUint16Bytes(b)
+}
+
+// ReadUint32Bytes is msgp.ReadUint32Bytes.
+//
+// Deprecated: use msgp.ReadUint32Bytes.
+func ReadUint32Bytes(b []byte) (uint32, []byte, error) {
+	return msgp.ReadUint32Bytes(b)
+}
+
+// ReadUint64Bytes is msgp.ReadUint64Bytes.
+//
+// Deprecated: use msgp.ReadUint64Bytes.
+func ReadUint64Bytes(b []byte) (u uint64, o []byte, err error) {
+	return msgp.ReadUint64Bytes(b)
+}
+
+// ReadUint8Bytes is msgp.ReadUint8Bytes.
+//
+// Deprecated: use msgp.ReadUint8Bytes.
+func ReadUint8Bytes(b []byte) (uint8, []byte, error) {
+	return msgp.ReadUint8Bytes(b)
+}
+
+// ReadUintBytes is msgp.ReadUintBytes.
+//
+// Deprecated: use msgp.ReadUintBytes.
+func ReadUintBytes(b []byte) (uint, []byte, error) {
+	return msgp.ReadUintBytes(b)
+}
+
+// RegisterExtension is msgp.RegisterExtension.
+//
+// Deprecated: use msgp.RegisterExtension.
+func RegisterExtension(typ int8, f func() Extension) {
+	msgp.RegisterExtension(typ, f)
+}
+
+// Remove is msgp.Remove.
+//
+// Deprecated: use msgp.Remove.
+func Remove(key string, raw []byte) []byte {
+	return msgp.Remove(key, raw)
+}
+
+// Replace is msgp.Replace.
+//
+// Deprecated: use msgp.Replace.
+func Replace(key string, raw []byte, val []byte) []byte {
+	return msgp.Replace(key, raw, val)
+}
+
+// Require is msgp.Require.
+//
+// Deprecated: use msgp.Require.
+func Require(old []byte, extra int) []byte {
+	return msgp.Require(old, extra)
+}
+
+// Skip is msgp.Skip.
+//
+// Deprecated: use msgp.Skip.
+func Skip(b []byte) ([]byte, error) {
+	return msgp.Skip(b)
+}
+
+// UnmarshalAsJSON is msgp.UnmarshalAsJSON.
+//
+// Deprecated: use msgp.UnmarshalAsJSON.
+func UnmarshalAsJSON(w io.Writer, msg []byte) ([]byte, error) {
+	return msgp.UnmarshalAsJSON(w, msg)
+}
+
+// UnsafeBytes is msgp.UnsafeBytes.
+//
+// Deprecated: use msgp.UnsafeBytes.
+func UnsafeBytes(s string) []byte {
+	return msgp.UnsafeBytes(s)
+}
+
+// UnsafeString is msgp.UnsafeString.
+//
+// Deprecated: use msgp.UnsafeString.
+func UnsafeString(b []byte) string {
+	return msgp.UnsafeString(b)
+}
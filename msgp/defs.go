@@ -18,7 +18,8 @@
 //		msgp.Decode(io.Reader, msgp.Decodable)
 //
 // There are also methods for converting MessagePack to JSON without
-// an explicit de-serialization step.
+// an explicit de-serialization step, and AppendJSONFromMsgp and
+// AppendMsgpFromJSON convert between them in buffers, both ways.
 //
 // For additional tips, tricks, and gotchas, please visit
 // the wiki at http://github.com/philhofer/msgp
@@ -0,0 +1,87 @@
+package msgp
+
+// TypeDescriptor describes a struct as the generator
+// sees it: the fields that are written and read, under
+// their tags, and what each is written as. Unlike the
+// reflect package's view of the struct, it leaves out
+// skipped fields, and describes shimmed fields by the
+// type that they're written as.
+//
+// The generator writes a {Type}Descriptor variable for
+// each struct when it's run with -descriptors.
+type TypeDescriptor struct {
+	Name   string
+	Tuple  bool // written as an array, in field order, without tags
+	Fields []FieldDescriptor
+}
+
+// FieldDescriptor describes one field of a struct.
+type FieldDescriptor struct {
+	Name string // Go name of the field
+	Tag  string // key it's written under
+
+	// Kind is the type that the field is written as,
+	// or InvalidType if the generator can't tell, as
+	// for interface{} fields and for named types,
+	// which have methods (and descriptors) of their
+	// own; TypeName is the name of the type, then.
+	// A nil pointer is written as nil, whatever its
+	// Kind. Fields that are transformed are always
+	// written as BinType.
+	Kind     Type
+	TypeName string
+
+	// Extension is whether or not the field is
+	// written as an extension, as complex numbers
+	// and times are
+	Extension bool
+
+	OmitEmpty  bool // left out when it's empty
+	DecodeOnly bool // read, but never written
+	EncodeOnly bool // written, but never read
+}
+
+// Field returns the field that is written under 'tag'.
+func (d *TypeDescriptor) Field(tag string) (FieldDescriptor, bool) {
+	for _, f := range d.Fields {
+		if f.Tag == tag {
+			return f, true
+		}
+	}
+	return FieldDescriptor{}, false
+}
+
+// Locate is like the package-level Locate, but it also
+// finds fields of tuples, which are written without
+// their tags, by their position: it returns the encoded
+// value of the field written under 'tag' in 'raw', which
+// holds an encoded value of the type, or a zero-length
+// []byte if the field isn't in 'raw'.
+func (d *TypeDescriptor) Locate(tag string, raw []byte) []byte {
+	if !d.Tuple {
+		return Locate(tag, raw)
+	}
+	sz, o, err := ReadArrayHeaderBytes(raw)
+	if err != nil {
+		return raw[:0]
+	}
+	var i uint32
+	for _, f := range d.Fields {
+		if f.DecodeOnly {
+			continue
+		}
+		if i == sz {
+			break
+		}
+		end, err := Skip(o)
+		if err != nil {
+			break
+		}
+		if f.Tag == tag {
+			return o[:len(o)-len(end)]
+		}
+		o = end
+		i++
+	}
+	return raw[:0]
+}
@@ -0,0 +1,71 @@
+package msgp
+
+import (
+	"sync"
+)
+
+var (
+	messageReg  map[string]func() Decodable
+	messageLock sync.RWMutex
+)
+
+func init() {
+	messageReg = make(map[string]func() Decodable)
+}
+
+// RegisterMessage registers a function that returns
+// a new value to be decoded when an envelope with
+// the given kind is read by DecodeEnvelope. It is safe
+// to call concurrently with DecodeEnvelope, but it's
+// meant to be called during initialization.
+//
+// For example:
+//
+//	msgp.RegisterMessage("login", func() msgp.Decodable { return new(Login) })
+func RegisterMessage(kind string, f func() Decodable) {
+	messageLock.Lock()
+	messageReg[kind] = f
+	messageLock.Unlock()
+}
+
+// EncodeEnvelope writes 'v' to 'w' as
+// a 2-element array of [kind, payload].
+func EncodeEnvelope(w *Writer, kind string, v Encodable) error {
+	err := w.WriteArrayHeader(2)
+	if err != nil {
+		return err
+	}
+	err = w.WriteString(kind)
+	if err != nil {
+		return err
+	}
+	return v.EncodeMsg(w)
+}
+
+// DecodeEnvelope reads an envelope written by
+// EncodeEnvelope. The payload is decoded into a
+// value created by the function registered for
+// its kind with RegisterMessage. If no function
+// has been registered for the kind, the payload is
+// returned as a *Raw.
+func DecodeEnvelope(r *Reader) (kind string, v Decodable, err error) {
+	err = r.ReadArrayHeaderExpect(2)
+	if err != nil {
+		return
+	}
+	kind, err = r.ReadString()
+	if err != nil {
+		err = noEOF(err)
+		return
+	}
+	messageLock.RLock()
+	f, ok := messageReg[kind]
+	messageLock.RUnlock()
+	if ok {
+		v = f()
+	} else {
+		v = new(Raw)
+	}
+	err = noEOF(v.DecodeMsg(r))
+	return
+}
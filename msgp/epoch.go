@@ -0,0 +1,112 @@
+package msgp
+
+import (
+	"math"
+	"time"
+)
+
+// An EpochUnit is the unit of a time written as
+// an integer: the number of units since the Unix
+// epoch (negative before it). Its value is the
+// number of nanoseconds in the unit. Generated
+// code writes time.Time fields tagged
+// `msg:"name,epoch=s"` (or ms, or ns) this way.
+type EpochUnit int64
+
+// the units of the epoch=s, ms and ns tag options
+const (
+	EpochSeconds EpochUnit = 1e9
+	EpochMillis  EpochUnit = 1e6
+	EpochNanos   EpochUnit = 1
+)
+
+// TimeEpochSize is the largest size of
+// a time written by AppendTimeEpoch
+const TimeEpochSize = TimeSize
+
+// TimeToUnix returns the number of units in 'u'
+// between the Unix epoch and 't', rounded down,
+// so the times of a unit, before the epoch as
+// after it, are all written as the same number.
+// Nanoseconds only fit in an int64 for the years
+// 1678 to 2262, as with t.UnixNano; see EpochFits.
+func TimeToUnix(t time.Time, u EpochUnit) int64 {
+	return t.Unix()*int64(1e9/u) + int64(t.Nanosecond())/int64(u)
+}
+
+// EpochFits returns whether TimeToUnix(t, u)
+// fits in an int64. The zero time.Time doesn't
+// in nanoseconds.
+func EpochFits(t time.Time, u EpochUnit) bool {
+	lim := math.MaxInt64 / int64(1e9/u)
+	sec := t.Unix()
+	return sec > -lim && sec < lim
+}
+
+// TimeFromUnixAny returns the time 'n' units in 'u'
+// after the Unix epoch (or before, if it's negative),
+// in UTC. It reads integers written by producers
+// in any unit, as well as those of TimeToUnix.
+func TimeFromUnixAny(n int64, u EpochUnit) time.Time {
+	per := int64(1e9 / u)
+	sec, rem := n/per, n%per
+	if rem < 0 {
+		sec, rem = sec-1, rem+per
+	}
+	return time.Unix(sec, rem*int64(u)).UTC()
+}
+
+// AppendTimeEpoch appends 't' to 'b' as an
+// integer of units in 'u' (see TimeToUnix).
+// A time that doesn't fit (see EpochFits) is
+// appended as AppendTime does, which
+// ReadTimeEpochBytes reads, too.
+func AppendTimeEpoch(b []byte, t time.Time, u EpochUnit) []byte {
+	if !EpochFits(t, u) {
+		return AppendTime(b, t)
+	}
+	return AppendInt64(b, TimeToUnix(t, u))
+}
+
+// WriteTimeEpoch writes 't' as
+// AppendTimeEpoch appends it.
+func (mw *Writer) WriteTimeEpoch(t time.Time, u EpochUnit) error {
+	if !EpochFits(t, u) {
+		return mw.WriteTime(t)
+	}
+	return mw.WriteInt64(TimeToUnix(t, u))
+}
+
+// ReadTimeEpochBytes reads a time written as an
+// integer of units in 'u' from 'b', and returns
+// it and the remaining bytes. The integer may be
+// signed or unsigned, of any width. A time written
+// as an extension, as ReadTimeBytes reads, is read,
+// too. See ReadMapKeyIntBytes and ReadTimeBytes for
+// the errors.
+func ReadTimeEpochBytes(b []byte, u EpochUnit) (time.Time, []byte, error) {
+	if NextType(b) == TimeType {
+		return ReadTimeBytes(b)
+	}
+	n, o, err := ReadMapKeyIntBytes(b)
+	if err != nil {
+		return time.Time{}, o, err
+	}
+	return TimeFromUnixAny(n, u), o, nil
+}
+
+// ReadTimeEpoch reads a time as ReadTimeEpochBytes does.
+func (m *Reader) ReadTimeEpoch(u EpochUnit) (time.Time, error) {
+	t, err := m.NextType()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t == TimeType {
+		return m.ReadTime()
+	}
+	n, err := m.ReadMapKeyInt()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return TimeFromUnixAny(n, u), nil
+}
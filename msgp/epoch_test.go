@@ -0,0 +1,144 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTimeToUnix(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		u    EpochUnit
+		want int64
+	}{
+		{time.Unix(0, 0), EpochSeconds, 0},
+		{time.Unix(1500000000, 999999999), EpochSeconds, 1500000000},
+		{time.Unix(1500000000, 999999999), EpochMillis, 1500000000999},
+		{time.Unix(1500000000, 999999999), EpochNanos, 1500000000999999999},
+		// before the epoch, rounded down
+		{time.Unix(-1, 0), EpochSeconds, -1},
+		{time.Unix(-1, 500000000), EpochSeconds, -1},
+		{time.Unix(0, -1), EpochSeconds, -1},
+		{time.Unix(0, -1), EpochMillis, -1},
+		{time.Unix(0, -1), EpochNanos, -1},
+		{time.Unix(-86400, 1500000), EpochMillis, -86399999},
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), EpochMillis, -2208988800000},
+	}
+	for _, tt := range tests {
+		if got := TimeToUnix(tt.t, tt.u); got != tt.want {
+			t.Errorf("TimeToUnix(%s, %d): got %d; want %d", tt.t.UTC(), tt.u, got, tt.want)
+		}
+	}
+}
+
+func TestTimeFromUnixAny(t *testing.T) {
+	units := []EpochUnit{EpochSeconds, EpochMillis, EpochNanos}
+	for _, u := range units {
+		for _, n := range []int64{0, 1, -1, 999, -999, 1001, -1001, 1500000000123, -2208988800000} {
+			tm := TimeFromUnixAny(n, u)
+			if tm.Location() != time.UTC {
+				t.Errorf("%d in %d: location %s", n, u, tm.Location())
+			}
+			if back := TimeToUnix(tm, u); back != n {
+				t.Errorf("%d in %d: read %s, written as %d", n, u, tm, back)
+			}
+			if tm.Nanosecond()%int(u) != 0 {
+				t.Errorf("%d in %d: %s isn't a whole number of units", n, u, tm)
+			}
+		}
+	}
+	if got := TimeFromUnixAny(-1, EpochMillis); !got.Equal(time.Unix(0, -1e6)) {
+		t.Errorf("-1ms: got %s", got)
+	}
+}
+
+func TestReadTimeEpoch(t *testing.T) {
+	want := time.Unix(1500000000, 0).UTC()
+	tests := []struct {
+		name string
+		in   []byte
+		u    EpochUnit
+		want time.Time
+	}{
+		{"int64", AppendInt64(nil, 1500000000), EpochSeconds, want},
+		{"uint64", AppendUint64(nil, 1500000000000), EpochMillis, want},
+		{"uint32", AppendUint32(nil, 1500000000), EpochSeconds, want},
+		{"int32", AppendInt32(nil, -1500000000), EpochSeconds, time.Unix(-1500000000, 0).UTC()},
+		{"uint16", AppendUint16(nil, 60000), EpochMillis, time.Unix(60, 0).UTC()},
+		{"int16", AppendInt16(nil, -1000), EpochMillis, time.Unix(-1, 0).UTC()},
+		{"uint8", AppendUint8(nil, 200), EpochSeconds, time.Unix(200, 0).UTC()},
+		{"int8", AppendInt8(nil, -100), EpochNanos, time.Unix(0, -100).UTC()},
+		{"fixint", []byte{0x05}, EpochSeconds, time.Unix(5, 0).UTC()},
+		{"negative fixint", []byte{0xff}, EpochMillis, time.Unix(0, -1e6).UTC()},
+		{"time", AppendTime(nil, want), EpochSeconds, want},
+		{"timestamp", AppendTimestamp(nil, want), EpochMillis, want},
+	}
+	for _, tt := range tests {
+		got, rest, err := ReadTimeEpochBytes(tt.in, tt.u)
+		if err != nil || !got.Equal(tt.want) || len(rest) != 0 {
+			t.Errorf("%s: ReadTimeEpochBytes: got %s, %d bytes left, %v; want %s", tt.name, got, len(rest), err, tt.want)
+		}
+		got, err = NewReader(bytes.NewReader(tt.in)).ReadTimeEpoch(tt.u)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%s: ReadTimeEpoch: got %s, %v; want %s", tt.name, got, err, tt.want)
+		}
+	}
+
+	bad := [][]byte{
+		AppendString(nil, "1500000000"),
+		AppendFloat64(nil, 1.5e9),
+		AppendUint64(nil, 1<<63),
+		append(AppendExtensionHeader(nil, 9, 1), 1),
+		{},
+	}
+	for _, in := range bad {
+		if _, _, err := ReadTimeEpochBytes(in, EpochSeconds); err == nil {
+			t.Errorf("ReadTimeEpochBytes(%x): no error", in)
+		}
+		if _, err := NewReader(bytes.NewReader(in)).ReadTimeEpoch(EpochSeconds); err == nil {
+			t.Errorf("ReadTimeEpoch(%x): no error", in)
+		}
+	}
+}
+
+func TestWriteTimeEpoch(t *testing.T) {
+	times := []time.Time{
+		time.Date(1969, 7, 20, 20, 17, 40, 123456789, time.UTC),
+		time.Date(2262, 4, 11, 23, 47, 16, 854775807, time.UTC),
+		time.Date(2262, 4, 11, 23, 47, 17, 0, time.UTC),
+		{},
+	}
+	for _, tm := range times {
+		for _, u := range []EpochUnit{EpochSeconds, EpochMillis, EpochNanos} {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			if err := w.WriteTimeEpoch(tm, u); err != nil {
+				t.Fatal(err)
+			}
+			w.Flush()
+			b := AppendTimeEpoch(nil, tm, u)
+			if !bytes.Equal(buf.Bytes(), b) {
+				t.Errorf("%s in %d: WriteTimeEpoch wrote %x; AppendTimeEpoch %x", tm, u, buf.Bytes(), b)
+			}
+			if len(b) > TimeEpochSize {
+				t.Errorf("%s in %d: wrote %d bytes; TimeEpochSize is %d", tm, u, len(b), TimeEpochSize)
+			}
+			// times that don't fit are written in full
+			if fits := NextType(b) == IntType; fits != EpochFits(tm, u) {
+				t.Errorf("%s in %d: written as %s", tm, u, NextType(b))
+			}
+			want := tm
+			if EpochFits(tm, u) {
+				want = tm.Truncate(time.Duration(u))
+			}
+			got, _, err := ReadTimeEpochBytes(b, u)
+			if err != nil || !got.Equal(want) {
+				t.Errorf("%s in %d: read %s, %v", tm, u, got, err)
+			}
+		}
+	}
+	if EpochFits(time.Time{}, EpochNanos) || !EpochFits(time.Time{}, EpochMillis) {
+		t.Error("the zero time fits in ms, but not in ns")
+	}
+}
@@ -0,0 +1,31 @@
+package msgp
+
+// Error is the interface of the errors that this package
+// returns for input that it can't decode, and so of the
+// errors of generated UnmarshalMsg and DecodeMsg methods,
+// apart from those of the io.Reader that a Reader reads
+// from (io.EOF and io.ErrUnexpectedEOF, when the input
+// ends early) and of shims and FromWire methods.
+type Error interface {
+	error
+
+	// Resumable returns whether the object that
+	// the error is about has been read in full,
+	// so the next object can be read as if it
+	// hadn't happened.
+	Resumable() bool
+}
+
+// errorString is the type of the errors
+// that are values, like ErrShortBytes,
+// so that they are Errors
+type errorString struct {
+	s         string
+	resumable bool
+}
+
+// Error implements the error interface
+func (e *errorString) Error() string { return e.s }
+
+// Resumable implements Error
+func (e *errorString) Resumable() bool { return e.resumable }
@@ -0,0 +1,70 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestErrorsAreErrors(t *testing.T) {
+	errs := []error{
+		ErrShortBytes,
+		ErrBitsetLength,
+		ErrInvalidUTF8,
+		ErrMapKey,
+		ArrayError{},
+		TypeError{},
+		InvalidPrefixError(0xc1),
+		IntOverflow{},
+		UintOverflow{},
+		CoerceError{},
+		UnknownExtensionError{},
+		ExtensionTypeError{},
+		LimitError{},
+		TransformError("x"),
+		TimestampError{},
+		AddressError{},
+	}
+	for _, err := range errs {
+		if _, ok := err.(Error); !ok {
+			t.Errorf("%T isn't an Error", err)
+		}
+	}
+
+	// the sentinels are still compared by identity
+	if ErrShortBytes == ErrMapKey || ErrShortBytes.(Error).Resumable() || !ErrInvalidUTF8.(Error).Resumable() {
+		t.Error("the sentinel errors are mixed up")
+	}
+}
+
+func TestUnsafeStringEmpty(t *testing.T) {
+	if s := UnsafeString(nil); s != "" {
+		t.Errorf("got %q", s)
+	}
+	if s := UnsafeString([]byte{}); s != "" {
+		t.Errorf("got %q", s)
+	}
+}
+
+func TestReadTimeBadExtension(t *testing.T) {
+	b := AppendTime(nil, time.Now())
+	b[2] = 0xff // the version of time.Time's binary form
+	b = AppendInt(b, 7)
+
+	_, o, err := ReadTimeBytes(b)
+	if _, ok := err.(TimestampError); !ok {
+		t.Fatalf("ReadTimeBytes: got %v; want a TimestampError", err)
+	}
+	if i, _, err := ReadIntBytes(o); err != nil || i != 7 {
+		t.Errorf("ReadTimeBytes didn't read the whole extension: %d, %v", i, err)
+	}
+
+	rd := NewReader(bytes.NewReader(b))
+	_, err = rd.ReadTime()
+	if _, ok := err.(TimestampError); !ok {
+		t.Fatalf("ReadTime: got %v; want a TimestampError", err)
+	}
+	if i, err := rd.ReadInt(); err != nil || i != 7 {
+		t.Errorf("ReadTime didn't read the whole extension: %d, %v", i, err)
+	}
+}
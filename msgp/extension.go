@@ -3,6 +3,7 @@ package msgp
 import (
 	"fmt"
 	"math"
+	"sync"
 )
 
 const (
@@ -14,10 +15,16 @@ const (
 
 	// TimeExtension is the extension number used for time.Time
 	TimeExtension = 5
+
+	// TimestampExtension is the extension number of the
+	// timestamps of the MessagePack spec, which ReadTime
+	// reads, too (see AppendTimestamp)
+	TimestampExtension = -1
 )
 
 var (
-	extensionReg map[int8]func() Extension
+	extensionReg  map[int8]func() Extension
+	extensionLock sync.RWMutex
 )
 
 func init() {
@@ -26,8 +33,9 @@ func init() {
 
 // RegisterExtension registers extensions so that they
 // can be initialized and returned by methods that
-// decode `interface{}` values. This should only
-// be called during initialization. f() should return
+// decode `interface{}` values. It is safe to call
+// concurrently with decoding, but it's meant to be
+// called during initialization. f() should return
 // a newly-initialized zero value of the extension. Keep in
 // mind that extensions 3, 4, and 5 are reserved for
 // complex64, complex128, and time.Time, respectively,
@@ -38,9 +46,55 @@ func init() {
 //  msgp.RegisterExtension(10, func() msgp.Extension { &MyExtension{} })
 //
 func RegisterExtension(typ int8, f func() Extension) {
+	extensionLock.Lock()
 	extensionReg[typ] = f
+	extensionLock.Unlock()
+}
+
+// lookupExtension returns the function
+// registered for extension type 'typ'
+func lookupExtension(typ int8) (func() Extension, bool) {
+	extensionLock.RLock()
+	f, ok := extensionReg[typ]
+	extensionLock.RUnlock()
+	return f, ok
+}
+
+// ExtensionPolicy is what ReadIntf and ReadIntfBytesOpt
+// (and so generated code decoding an interface{})
+// do with an extension type that hasn't been registered.
+// It is set with DecodeOptions.UnknownExtension.
+type ExtensionPolicy int
+
+const (
+	// KeepUnknown decodes unknown extensions
+	// as a *RawExtension. This is the default.
+	KeepUnknown ExtensionPolicy = iota
+
+	// ErrorUnknown returns an UnknownExtensionError
+	// for unknown extensions.
+	ErrorUnknown
+
+	// SkipUnknown skips over unknown
+	// extensions and decodes them as nil.
+	SkipUnknown
+)
+
+// UnknownExtensionError is returned when an
+// extension that hasn't been registered is
+// decoded under the ErrorUnknown policy.
+type UnknownExtensionError struct {
+	Type int8
 }
 
+// Error implements the error interface
+func (u UnknownExtensionError) Error() string {
+	return fmt.Sprintf("msgp: unknown extension type %d", u.Type)
+}
+
+// Resumable returns false.
+func (u UnknownExtensionError) Resumable() bool { return false }
+
 // ExtensionTypeError is an error type returned
 // when there is a mis-match between an extension type
 // and the type encoded on the wire
@@ -54,6 +108,9 @@ func (e ExtensionTypeError) Error() string {
 	return fmt.Sprintf("msgp: error decoding extension: wanted type %d; got type %d", e.Want, e.Got)
 }
 
+// Resumable returns false.
+func (e ExtensionTypeError) Resumable() bool { return false }
+
 func errExt(got int8, wanted int8) error {
 	return ExtensionTypeError{Got: got, Want: wanted}
 }
@@ -78,6 +135,10 @@ type Extension interface {
 	// assuming that the slice has length Len()
 	MarshalBinaryTo([]byte) error
 
+	// UnmarshalBinary should copy the
+	// data it keeps: the slice is part of
+	// the buffer that's being read, which
+	// the caller may reuse afterwards
 	UnmarshalBinary([]byte) error
 }
 
@@ -115,53 +176,9 @@ func (r *RawExtension) UnmarshalBinary(b []byte) error {
 // WriteExtension writes an extension type to the writer
 func (mw *Writer) WriteExtension(e Extension) error {
 	l := e.Len()
-	var err error
-	switch l {
-	case 0:
-		o, err := mw.require(3)
-		if err != nil {
-			return err
-		}
-		mw.buf[o] = mext8
-		mw.buf[o+1] = 0
-		mw.buf[o+2] = byte(e.ExtensionType())
-	case 1:
-		mw.buf = append(mw.buf, mfixext1, byte(e.ExtensionType()))
-	case 2:
-		mw.buf = append(mw.buf, mfixext2, byte(e.ExtensionType()))
-	case 4:
-		mw.buf = append(mw.buf, mfixext4, byte(e.ExtensionType()))
-	case 8:
-		mw.buf = append(mw.buf, mfixext8, byte(e.ExtensionType()))
-	case 16:
-		mw.buf = append(mw.buf, mfixext16, byte(e.ExtensionType()))
-	default:
-		switch {
-		case l < math.MaxUint8:
-			o, err := mw.require(3)
-			if err != nil {
-				return err
-			}
-			mw.buf[o] = mext8
-			mw.buf[o+1] = byte(uint8(l))
-			mw.buf[o+2] = byte(e.ExtensionType())
-		case l < math.MaxUint16:
-			o, err := mw.require(4)
-			if err != nil {
-				return err
-			}
-			mw.buf[o] = mext16
-			big.PutUint16(mw.buf[o+1:], uint16(l))
-			mw.buf[3] = byte(e.ExtensionType())
-		default:
-			o, err := mw.require(6)
-			if err != nil {
-				return err
-			}
-			mw.buf[o] = mext32
-			big.PutUint32(mw.buf[o+1:], uint32(l))
-			mw.buf[5] = byte(e.ExtensionType())
-		}
+	err := mw.WriteExtensionHeader(e.ExtensionType(), l)
+	if err != nil {
+		return err
 	}
 	o, err := mw.require(l)
 	if err != nil {
@@ -170,6 +187,20 @@ func (mw *Writer) WriteExtension(e Extension) error {
 	return e.MarshalBinaryTo(mw.buf[o:])
 }
 
+// WriteExtensionHeader writes the header of an
+// extension of type 'typ' with 'payloadLen' bytes
+// of data. The caller must write exactly 'payloadLen'
+// bytes of data next, e.g. with Write or with other
+// methods on the Writer.
+func (mw *Writer) WriteExtensionHeader(typ int8, payloadLen int) error {
+	o, err := mw.require(extHeaderSize(payloadLen))
+	if err != nil {
+		return err
+	}
+	putExtensionHeader(mw.buf[o:], typ, payloadLen)
+	return nil
+}
+
 // peek at the extension type, assuming the next
 // kind to be read is Extension
 func (m *Reader) peekExtensionType() (int8, error) {
@@ -208,8 +239,14 @@ func (m *Reader) peekExtensionType() (int8, error) {
 func peekExtension(b []byte) (int8, error) {
 	switch b[0] {
 	case mfixext1, mfixext2, mfixext4, mfixext8, mfixext16:
+		if len(b) < 2 {
+			return 0, ErrShortBytes
+		}
 		return int8(b[1]), nil
 	case mext8:
+		if len(b) < 3 {
+			return 0, ErrShortBytes
+		}
 		return int8(b[2]), nil
 	case mext16:
 		if len(b) < 4 {
@@ -217,7 +254,7 @@ func peekExtension(b []byte) (int8, error) {
 		}
 		return int8(b[3]), nil
 	case mext32:
-		if len(b) < 5 {
+		if len(b) < 6 {
 			return 0, ErrShortBytes
 		}
 		return int8(b[5]), nil
@@ -348,7 +385,11 @@ func (m *Reader) ReadExtension(e Extension) (err error) {
 			err = errExt(int8(p[5]), e.ExtensionType())
 			return
 		}
-		read = int(big.Uint32(p[1:]))
+		sz := big.Uint32(p[1:])
+		if err = checkSize(sz, ExtensionType); err != nil {
+			return
+		}
+		read = int(sz)
 		off = 6
 
 	default:
@@ -356,6 +397,11 @@ func (m *Reader) ReadExtension(e Extension) (err error) {
 		return
 	}
 
+	// don't let the header make
+	// us buffer an arbitrary amount
+	if err = m.opts.checkBytes(read, ExtensionType); err != nil {
+		return
+	}
 	p, err = m.r.Peek(read + off)
 	if err != nil {
 		return
@@ -371,51 +417,74 @@ func (m *Reader) ReadExtension(e Extension) (err error) {
 func AppendExtension(b []byte, e Extension) ([]byte, error) {
 	l := e.Len()
 	o, n := ensure(b, ExtensionPrefixSize+l)
+	n += putExtensionHeader(o[n:], e.ExtensionType(), l)
+	return o[:n+l], e.MarshalBinaryTo(o[n : n+l])
+}
+
+// AppendExtensionHeader appends the header of
+// an extension of type 'typ' with 'payloadLen'
+// bytes of data to 'b'. The caller must append
+// exactly 'payloadLen' bytes of data next, e.g.
+// with other Append functions.
+func AppendExtensionHeader(b []byte, typ int8, payloadLen int) []byte {
+	o, n := ensure(b, extHeaderSize(payloadLen))
+	putExtensionHeader(o[n:], typ, payloadLen)
+	return o
+}
+
+// extHeaderSize returns the size of the header
+// of an extension with 'l' bytes of data
+func extHeaderSize(l int) int {
+	switch l {
+	case 1, 2, 4, 8, 16:
+		return 2
+	}
+	switch {
+	case l < math.MaxUint8:
+		return 3
+	case l < math.MaxUint16:
+		return 4
+	default:
+		return 6
+	}
+}
+
+// putExtensionHeader writes the header of an
+// extension with 'l' bytes of data to the start
+// of 'b' and returns its size, extHeaderSize(l)
+func putExtensionHeader(b []byte, typ int8, l int) int {
 	switch l {
-	case 0:
-		o[n] = mext8
-		o[n+1] = 0
-		o[n+2] = byte(e.ExtensionType())
-		return o[:n+3], nil
 	case 1:
-		o[n] = mfixext1
-		o[n+1] = byte(e.ExtensionType())
-		n += 2
+		b[0] = mfixext1
 	case 2:
-		o[n] = mfixext2
-		o[n+1] = byte(e.ExtensionType())
-		n += 2
+		b[0] = mfixext2
 	case 4:
-		o[n] = mfixext4
-		o[n+1] = byte(e.ExtensionType())
-		n += 2
+		b[0] = mfixext4
 	case 8:
-		o[n] = mfixext8
-		o[n+1] = byte(e.ExtensionType())
-		n += 2
+		b[0] = mfixext8
 	case 16:
-		o[n] = mfixext16
-		o[n+1] = byte(e.ExtensionType())
-		n += 2
-	}
-	switch {
-	case l < math.MaxUint8:
-		o[n] = mext8
-		o[n+1] = byte(uint8(l))
-		o[n+2] = byte(e.ExtensionType())
-		n += 3
-	case l < math.MaxUint16:
-		o[n] = mext16
-		big.PutUint16(o[n+1:], uint16(l))
-		o[n+3] = byte(e.ExtensionType())
-		n += 4
+		b[0] = mfixext16
 	default:
-		o[n] = mext32
-		big.PutUint32(o[n+1:], uint32(l))
-		o[n+5] = byte(e.ExtensionType())
-		n += 6
+		switch {
+		case l < math.MaxUint8:
+			b[0] = mext8
+			b[1] = byte(uint8(l))
+			b[2] = byte(typ)
+			return 3
+		case l < math.MaxUint16:
+			b[0] = mext16
+			big.PutUint16(b[1:], uint16(l))
+			b[3] = byte(typ)
+			return 4
+		default:
+			b[0] = mext32
+			big.PutUint32(b[1:], uint32(l))
+			b[5] = byte(typ)
+			return 6
+		}
 	}
-	return o[:n+l], e.MarshalBinaryTo(o[n : n+l])
+	b[1] = byte(typ)
+	return 2
 }
 
 // ReadExtensionBytes reads an extension from 'b' into 'e'
@@ -426,70 +495,64 @@ func AppendExtension(b []byte, e Extension) ([]byte, error) {
 // - TypeErorr{} (next object not an extension)
 // - An umarshal error returned from e.UnmarshalBinary
 func ReadExtensionBytes(b []byte, e Extension) ([]byte, error) {
+	typ, sz, o, err := ReadExtensionHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	if typ != e.ExtensionType() {
+		return b, errExt(typ, e.ExtensionType())
+	}
+	return o[sz:], e.UnmarshalBinary(o[:sz])
+}
+
+// ReadExtensionHeaderBytes reads the header of
+// an extension from 'b' and returns the extension
+// type, the length of its data, and the bytes after
+// the header, which start with the data.
+// Possible errors:
+// - ErrShortBytes ('b' doesn't hold the header and 'payloadLen' bytes of data)
+// - TypeError{} (next object not an extension)
+func ReadExtensionHeaderBytes(b []byte) (typ int8, payloadLen int, rest []byte, err error) {
 	l := len(b)
-	if l < 3 {
-		return b, ErrShortBytes
+	if l < 2 {
+		return 0, 0, b, ErrShortBytes
 	}
-	lead := b[0]
-	var (
-		sz  int // size of 'data'
-		off int // offset of 'data'
-		typ int8
-	)
-	switch lead {
+	var off int // offset of the data
+	switch b[0] {
 	case mfixext1:
-		typ = int8(b[1])
-		sz = 1
-		off = 2
+		payloadLen, off = 1, 2
 	case mfixext2:
-		typ = int8(b[1])
-		sz = 2
-		off = 2
+		payloadLen, off = 2, 2
 	case mfixext4:
-		typ = int8(b[1])
-		sz = 4
-		off = 2
+		payloadLen, off = 4, 2
 	case mfixext8:
-		typ = int8(b[1])
-		sz = 8
-		off = 2
+		payloadLen, off = 8, 2
 	case mfixext16:
-		typ = int8(b[1])
-		sz = 16
-		off = 2
+		payloadLen, off = 16, 2
 	case mext8:
-		sz = int(uint8(b[1]))
-		typ = int8(b[2])
-		off = 3
-		if sz == 0 {
-			return b[3:], e.UnmarshalBinary(b[3:3])
+		if l < 3 {
+			return 0, 0, b, ErrShortBytes
 		}
+		payloadLen, off = int(uint8(b[1])), 3
 	case mext16:
 		if l < 4 {
-			return b, ErrShortBytes
+			return 0, 0, b, ErrShortBytes
 		}
-		sz = int(big.Uint16(b[1:]))
-		typ = int8(b[3])
-		off = 4
+		payloadLen, off = int(big.Uint16(b[1:])), 4
 	case mext32:
 		if l < 6 {
-			return b, ErrShortBytes
+			return 0, 0, b, ErrShortBytes
 		}
-		sz = int(big.Uint32(b[1:]))
-		typ = int8(b[5])
-		off = 6
+		sz := big.Uint32(b[1:])
+		if err := checkSize(sz, ExtensionType); err != nil {
+			return 0, 0, b, err
+		}
+		payloadLen, off = int(sz), 6
 	default:
-		return b, TypeError{Method: ExtensionType, Encoded: getType(lead)}
+		return 0, 0, b, TypeError{Method: ExtensionType, Encoded: getType(b[0])}
 	}
-
-	if typ != e.ExtensionType() {
-		return b, errExt(typ, e.ExtensionType())
-	}
-
-	// the data of the extension starts
-	// at 'off' and is 'sz' bytes long
-	if len(b[off:]) < sz {
-		return b, ErrShortBytes
+	if len(b[off:]) < payloadLen {
+		return 0, 0, b, ErrShortBytes
 	}
-	return b[off+sz:], e.UnmarshalBinary(b[off : off+sz])
+	return int8(b[off-1]), payloadLen, b[off:], nil
 }
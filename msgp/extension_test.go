@@ -47,3 +47,153 @@ func TestReadWriteExtensionBytes(t *testing.T) {
 		}
 	}
 }
+
+func TestExtensionEncodings(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	for _, l := range []int{0, 1, 2, 3, 4, 8, 16, 17, 300, 70000} {
+		e := RawExtension{Type: 55, Data: RandBytes(l)}
+		bts, err := AppendExtension(nil, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		en.WriteExtension(&e)
+		en.Flush()
+		if !bytes.Equal(buf.Bytes(), bts) {
+			t.Errorf("length %d: WriteExtension and AppendExtension disagree", l)
+		}
+		sz, err := Size(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sz != len(bts) {
+			t.Errorf("length %d: encoded %d bytes, but Size returned %d", l, len(bts), sz)
+		}
+		var out RawExtension
+		out.Type = 55
+		left, err := ReadExtensionBytes(bts, &out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) != 0 || !bytes.Equal(out.Data, e.Data) {
+			t.Errorf("length %d: bad round trip", l)
+		}
+	}
+}
+
+func TestUnknownExtensionPolicy(t *testing.T) {
+	// {"ext": <unknown extension>, "after": 1}
+	var payload []byte
+	payload = AppendMapHeader(payload, 2)
+	payload = AppendString(payload, "ext")
+	payload, _ = AppendExtension(payload, &RawExtension{Type: 77, Data: []byte("forward me")})
+	payload = AppendString(payload, "after")
+	payload = AppendInt(payload, 1)
+
+	decode := func(p ExtensionPolicy) []interface{} {
+		opt := DecodeOptions{UnknownExtension: p}
+		bi, _, berr := ReadIntfBytesOpt(payload, opt)
+		ri, rerr := NewReaderWithOptions(bytes.NewReader(payload), opt).ReadIntf()
+		return []interface{}{bi, berr, ri, rerr}
+	}
+
+	res := decode(KeepUnknown)
+	for i := 0; i < len(res); i += 2 {
+		if res[i+1] != nil {
+			t.Fatalf("keep: %v", res[i+1])
+		}
+		ext, ok := res[i].(map[string]interface{})["ext"].(*RawExtension)
+		if !ok || ext.Type != 77 || string(ext.Data) != "forward me" {
+			t.Errorf("keep: got %v", res[i])
+		}
+	}
+
+	res = decode(ErrorUnknown)
+	for i := 0; i < len(res); i += 2 {
+		if err, ok := res[i+1].(UnknownExtensionError); !ok || err.Type != 77 {
+			t.Errorf("error: expected UnknownExtensionError; got %v", res[i+1])
+		}
+	}
+
+	res = decode(SkipUnknown)
+	for i := 0; i < len(res); i += 2 {
+		if res[i+1] != nil {
+			t.Fatalf("skip: %v", res[i+1])
+		}
+		m := res[i].(map[string]interface{})
+		if v, ok := m["ext"]; !ok || v != nil || m["after"] != int64(1) {
+			t.Errorf("skip: got %v", m)
+		}
+	}
+}
+
+func TestExtensionHeader(t *testing.T) {
+	// the header followed by the data is
+	// the same as the whole extension
+	for _, l := range extSizes {
+		e := RawExtension{Type: 9, Data: make([]byte, l)}
+		whole, _ := AppendExtension(nil, &e)
+		split := append(AppendExtensionHeader(nil, 9, l), e.Data...)
+		if !bytes.Equal(split, whole) {
+			t.Errorf("length %d: AppendExtensionHeader wrote %x", l, split[:len(split)-l])
+		}
+
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		wr.WriteExtensionHeader(9, l)
+		wr.Write(e.Data)
+		wr.Flush()
+		if !bytes.Equal(buf.Bytes(), whole) {
+			t.Errorf("length %d: WriteExtensionHeader wrote %x", l, buf.Bytes()[:buf.Len()-l])
+		}
+
+		typ, n, rest, err := ReadExtensionHeaderBytes(whole)
+		if err != nil || typ != 9 || n != l || len(rest) != l {
+			t.Errorf("length %d: got type %d, length %d, %d bytes left, %v", l, typ, n, len(rest), err)
+		}
+		if _, _, _, err = ReadExtensionHeaderBytes(whole[:len(whole)-1]); l > 0 && err != ErrShortBytes {
+			t.Errorf("length %d: expected ErrShortBytes; got %v", l, err)
+		}
+	}
+}
+
+func TestExtensionNestedMsgpack(t *testing.T) {
+	inner := func(b []byte) []byte {
+		b = AppendMapHeader(b, 2)
+		b = AppendString(b, "kind")
+		b = AppendString(b, "login")
+		b = AppendString(b, "id")
+		return AppendInt(b, 42)
+	}
+	n := len(inner(nil))
+
+	b := AppendExtensionHeader(nil, 60, n)
+	b = inner(b)
+	b = AppendString(b, "after")
+
+	e := RawExtension{Type: 60}
+	o, err := ReadExtensionBytes(b, &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, err := ReadMapStrIntfBytes(e.Data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["kind"] != "login" || m["id"] != int64(42) {
+		t.Errorf("got %v", m)
+	}
+
+	typ, l, rest, err := ReadExtensionHeaderBytes(b)
+	if err != nil || typ != 60 || l != n {
+		t.Fatalf("got type %d, length %d, %v", typ, l, err)
+	}
+	m, rest, err = ReadMapStrIntfBytes(rest, nil)
+	if err != nil || m["id"] != int64(42) {
+		t.Fatalf("got %v, %v", m, err)
+	}
+	if !bytes.Equal(rest, o) {
+		t.Errorf("the payload didn't end where the extension did")
+	}
+}
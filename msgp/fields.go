@@ -0,0 +1,104 @@
+package msgp
+
+// ReadMapFields reads a map whose keys are the names of
+// fields, as a generated DecodeMsg method does, for types
+// that are decoded by hand. For each key, it calls the
+// function in 'fields' with that name, which has to read
+// the value, and it skips the values of the keys that
+// aren't in 'fields'. It returns the first error, either
+// from reading the map or from one of the functions.
+//
+// It's slower than a generated method, since it
+// looks up every key and calls a function for
+// every value, but it's less to write:
+//
+//	var t T
+//	err := msgp.ReadMapFields(r, map[string]func(*msgp.Reader) error{
+//		"name": func(r *msgp.Reader) (err error) {
+//			t.Name, err = r.ReadString()
+//			return
+//		},
+//		"age": func(r *msgp.Reader) (err error) {
+//			t.Age, err = r.ReadInt()
+//			return
+//		},
+//	})
+func ReadMapFields(r *Reader, fields map[string]func(*Reader) error) error {
+	sz, err := r.ReadMapHeader()
+	if err != nil {
+		return err
+	}
+	for sz > 0 {
+		sz--
+		r.scratch, err = r.ReadMapKey(r.scratch[:0])
+		if err != nil {
+			return err
+		}
+		f, ok := fields[string(r.scratch)]
+		if !ok {
+			err = r.Skip()
+		} else {
+			err = f(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMapFieldsBytes is ReadMapFields for the map at
+// the start of 'b'. Each function in 'fields' is passed
+// the bytes that start with the value of its key, and
+// returns the bytes that follow the value, as the
+// ReadXxxxBytes functions do. ReadMapFieldsBytes
+// returns the bytes that follow the map.
+func ReadMapFieldsBytes(b []byte, fields map[string]func([]byte) ([]byte, error)) ([]byte, error) {
+	sz, b, err := ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	var key []byte
+	for sz > 0 {
+		sz--
+		key, b, err = ReadMapKeyZC(b)
+		if err != nil {
+			return b, err
+		}
+		f, ok := fields[string(key)]
+		if !ok {
+			b, err = Skip(b)
+		} else {
+			b, err = f(b)
+		}
+		if err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// ReadMapKeysBytes calls 'fn' with each key of the map
+// at the start of 'b', skipping the values, and returns
+// the bytes that follow the map. The keys are slices
+// of 'b', as ReadMapKeyZC returns them.
+func ReadMapKeysBytes(b []byte, fn func(key []byte)) ([]byte, error) {
+	sz, b, err := ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	var key []byte
+	for sz > 0 {
+		sz--
+		key, b, err = ReadMapKeyZC(b)
+		if err != nil {
+			return b, err
+		}
+		fn(key)
+		b, err = Skip(b)
+		if err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,176 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// person is decoded by hand
+// with ReadMapFields
+type person struct {
+	Name string
+	Age  int
+	Tags []string
+}
+
+func (p *person) readerFields() map[string]func(*Reader) error {
+	return map[string]func(*Reader) error{
+		"name": func(r *Reader) (err error) {
+			p.Name, err = r.ReadString()
+			return
+		},
+		"age": func(r *Reader) (err error) {
+			p.Age, err = r.ReadInt()
+			return
+		},
+		"tags": func(r *Reader) error {
+			sz, err := r.ReadArrayHeader()
+			if err != nil {
+				return err
+			}
+			p.Tags = make([]string, sz)
+			for i := range p.Tags {
+				p.Tags[i], err = r.ReadString()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func (p *person) bytesFields() map[string]func([]byte) ([]byte, error) {
+	return map[string]func([]byte) ([]byte, error){
+		"name": func(b []byte) (o []byte, err error) {
+			p.Name, o, err = ReadStringBytes(b)
+			return
+		},
+		"age": func(b []byte) (o []byte, err error) {
+			p.Age, o, err = ReadIntBytes(b)
+			return
+		},
+		"tags": func(b []byte) ([]byte, error) {
+			sz, b, err := ReadArrayHeaderBytes(b)
+			if err != nil {
+				return b, err
+			}
+			p.Tags = make([]string, sz)
+			for i := range p.Tags {
+				p.Tags[i], b, err = ReadStringBytes(b)
+				if err != nil {
+					return b, err
+				}
+			}
+			return b, nil
+		},
+	}
+}
+
+// personMsg is a person with an unknown
+// key, "extra", between its fields
+func personMsg() []byte {
+	b := AppendMapHeader(nil, 4)
+	b = AppendString(b, "name")
+	b = AppendString(b, "ann")
+	b = AppendString(b, "extra")
+	b = AppendMapHeader(b, 1)
+	b = AppendString(b, "nested")
+	b = AppendArrayHeader(b, 2)
+	b = AppendInt(b, 1)
+	b = AppendNil(b)
+	b = AppendString(b, "age")
+	b = AppendInt(b, 41)
+	b = AppendString(b, "tags")
+	b = AppendArrayHeader(b, 2)
+	b = AppendString(b, "a")
+	b = AppendString(b, "b")
+	return b
+}
+
+func TestReadMapFields(t *testing.T) {
+	want := person{Name: "ann", Age: 41, Tags: []string{"a", "b"}}
+	msg := append(personMsg(), AppendString(nil, "next")...)
+
+	var p person
+	r := NewReader(bytes.NewReader(msg))
+	if err := ReadMapFields(r, p.readerFields()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("read %+v; want %+v", p, want)
+	}
+	if s, err := r.ReadString(); s != "next" || err != nil {
+		t.Errorf("the reader is at (%q, %v), not the next object", s, err)
+	}
+
+	p = person{}
+	o, err := ReadMapFieldsBytes(msg, p.bytesFields())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("read %+v from bytes; want %+v", p, want)
+	}
+	if s, _, err := ReadStringBytes(o); s != "next" || err != nil {
+		t.Errorf("the bytes left over start with (%q, %v), not the next object", s, err)
+	}
+}
+
+func TestReadMapFieldsErrors(t *testing.T) {
+	msg := personMsg()
+
+	// errors from the functions are returned
+	bad := errors.New("bad age")
+	var p person
+	fields := p.readerFields()
+	fields["age"] = func(r *Reader) error { return bad }
+	if err := ReadMapFields(NewReader(bytes.NewReader(msg)), fields); err != bad {
+		t.Errorf("got error %v; want %v", err, bad)
+	}
+	bfields := p.bytesFields()
+	bfields["age"] = func(b []byte) ([]byte, error) { return b, bad }
+	if _, err := ReadMapFieldsBytes(msg, bfields); err != bad {
+		t.Errorf("bytes: got error %v; want %v", err, bad)
+	}
+
+	// as are those from reading the map
+	short := msg[:len(msg)-1]
+	if err := ReadMapFields(NewReader(bytes.NewReader(short)), p.readerFields()); err == nil {
+		t.Error("no error reading a map that's cut short")
+	}
+	if _, err := ReadMapFieldsBytes(short, p.bytesFields()); err != ErrShortBytes {
+		t.Errorf("bytes: got error %v reading a map that's cut short; want ErrShortBytes", err)
+	}
+	arr := AppendArrayHeader(nil, 0)
+	if err := ReadMapFields(NewReader(bytes.NewReader(arr)), p.readerFields()); err == nil {
+		t.Error("no error reading an array")
+	}
+	if _, err := ReadMapFieldsBytes(arr, p.bytesFields()); err == nil {
+		t.Error("bytes: no error reading an array")
+	}
+}
+
+func TestReadMapKeysBytes(t *testing.T) {
+	msg := append(personMsg(), AppendString(nil, "next")...)
+	var keys []string
+	o, err := ReadMapKeysBytes(msg, func(key []byte) { keys = append(keys, string(key)) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"name", "extra", "age", "tags"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got keys %q; want %q", keys, want)
+	}
+	if s, _, err := ReadStringBytes(o); s != "next" || err != nil {
+		t.Errorf("the bytes left over start with (%q, %v), not the next object", s, err)
+	}
+
+	if _, err = ReadMapKeysBytes(personMsg()[:20], func([]byte) {}); err != ErrShortBytes {
+		t.Errorf("got error %v reading a map that's cut short; want ErrShortBytes", err)
+	}
+	if _, err = ReadMapKeysBytes(AppendArrayHeader(nil, 0), func([]byte) {}); err == nil {
+		t.Error("no error reading an array")
+	}
+}
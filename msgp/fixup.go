@@ -0,0 +1,98 @@
+package msgp
+
+// Fixup is a map or array header that was
+// written before its size was known. Call
+// Set once the size is known.
+//
+// A deferred header reserves 5 bytes (the size
+// of a map32 or array32 header) in the Writer's
+// buffer, and the Writer holds on to everything
+// written after it until Set is called. Set then
+// writes the smallest header that fits the size,
+// and moves the buffered data down if the header
+// is smaller than 5 bytes, so the output is the
+// same as if WriteMapHeader or WriteArrayHeader
+// had been called with the right size.
+//
+// The other way to stream an object of unknown size
+// is to always write a map32 or array32 header, which
+// needs no buffering but costs 4 bytes more than a
+// fix header (0 to 15 elements) and 2 bytes more than
+// a 16-bit header (up to 65534 elements). A deferred
+// header costs no space on the wire, but the Writer
+// has to keep the contents of the object in memory
+// until Set is called, and has to copy them once if
+// the header shrinks.
+type Fixup struct {
+	w  *Writer
+	id uint32
+}
+
+// pendingHeader is a deferred header
+// in a Writer's buffer
+type pendingHeader struct {
+	id  uint32
+	off int  // offset of the header in the buffer
+	typ Type // MapType or ArrayType
+}
+
+// WriteMapHeaderDeferred writes a placeholder
+// for a map header and returns a Fixup that
+// sets its size. The Writer won't flush the
+// header or anything written after it until
+// the Fixup is set.
+func (mw *Writer) WriteMapHeaderDeferred() (Fixup, error) {
+	return mw.writeDeferred(MapType)
+}
+
+// WriteArrayHeaderDeferred writes a placeholder
+// for an array header and returns a Fixup that
+// sets its size. The Writer won't flush the
+// header or anything written after it until
+// the Fixup is set.
+func (mw *Writer) WriteArrayHeaderDeferred() (Fixup, error) {
+	return mw.writeDeferred(ArrayType)
+}
+
+func (mw *Writer) writeDeferred(t Type) (Fixup, error) {
+	o, err := mw.require(5)
+	if err != nil {
+		return Fixup{}, err
+	}
+	mw.lastid++
+	mw.pending = append(mw.pending, pendingHeader{id: mw.lastid, off: o, typ: t})
+	return Fixup{w: mw, id: mw.lastid}, nil
+}
+
+// Set writes the size of the map (the number
+// of key-value pairs) or array into the deferred
+// header. Calling Set more than once, or after
+// the Writer has been Reset, does nothing.
+func (f Fixup) Set(count uint32) {
+	mw := f.w
+	if mw == nil {
+		return
+	}
+	for i, p := range mw.pending {
+		if p.id != f.id {
+			continue
+		}
+		var hdr [5]byte
+		var h []byte
+		if p.typ == MapType {
+			h = AppendMapHeader(hdr[:0], count)
+		} else {
+			h = AppendArrayHeader(hdr[:0], count)
+		}
+		copy(mw.buf[p.off:], h)
+		if shift := len(hdr) - len(h); shift > 0 {
+			copy(mw.buf[p.off+len(h):], mw.buf[p.off+len(hdr):])
+			mw.buf = mw.buf[:len(mw.buf)-shift]
+			for j := i + 1; j < len(mw.pending); j++ {
+				mw.pending[j].off -= shift
+			}
+		}
+		mw.pending = append(mw.pending[:i], mw.pending[i+1:]...)
+		return
+	}
+}
@@ -0,0 +1,119 @@
+package msgp
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func TestWriteMapHeaderDeferred(t *testing.T) {
+	for _, n := range []int{0, 3, 70000} {
+		var want bytes.Buffer
+		wr := NewWriter(&want)
+		wr.WriteMapHeader(uint32(n))
+		for i := 0; i < n; i++ {
+			wr.WriteString(strconv.Itoa(i))
+			wr.WriteInt(i)
+		}
+		wr.Flush()
+
+		// a small buffer makes the writer
+		// hold data behind the header
+		var buf bytes.Buffer
+		wr = NewWriterSize(&buf, 16)
+		fix, err := wr.WriteMapHeaderDeferred()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			wr.WriteString(strconv.Itoa(i))
+			wr.WriteInt(i)
+		}
+		wr.Flush()
+		if buf.Len() != 0 {
+			t.Fatalf("%d entries: flushed %d bytes before the header was set", n, buf.Len())
+		}
+		fix.Set(uint32(n))
+		if err = wr.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Fatalf("%d entries: deferred output differs from WriteMapHeader", n)
+		}
+
+		m := make(map[string]interface{})
+		if err = NewReader(&buf).ReadMapStrIntf(m); err != nil {
+			t.Fatal(err)
+		}
+		if len(m) != n {
+			t.Errorf("decoded %d entries; want %d", len(m), n)
+		}
+		if n > 0 && m[strconv.Itoa(n-1)] != int64(n-1) {
+			t.Errorf("got %v for the last entry", m[strconv.Itoa(n-1)])
+		}
+	}
+}
+
+func TestWriteArrayHeaderDeferred(t *testing.T) {
+	for _, n := range []int{0, 3, 70000} {
+		var buf bytes.Buffer
+		wr := NewWriterSize(&buf, 16)
+		wr.WriteString("before")
+		fix, err := wr.WriteArrayHeaderDeferred()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			wr.WriteInt(i)
+		}
+		fix.Set(uint32(n))
+		fix.Set(5) // does nothing
+		wr.WriteString("after")
+		wr.Flush()
+
+		rd := NewReader(&buf)
+		if s, err := rd.ReadString(); err != nil || s != "before" {
+			t.Fatalf("got %q, %v", s, err)
+		}
+		v, err := rd.ReadIntf()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l := len(v.([]interface{})); l != n {
+			t.Errorf("decoded %d elements; want %d", l, n)
+		}
+		if s, err := rd.ReadString(); err != nil || s != "after" {
+			t.Fatalf("got %q, %v", s, err)
+		}
+	}
+}
+
+func TestDeferredNested(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriterSize(&buf, 16)
+	outer, _ := wr.WriteMapHeaderDeferred()
+	for i := 0; i < 20; i++ {
+		wr.WriteString(strconv.Itoa(i))
+		inner, _ := wr.WriteArrayHeaderDeferred()
+		for j := 0; j < i; j++ {
+			wr.WriteBool(true)
+		}
+		inner.Set(uint32(i))
+	}
+	outer.Set(20)
+	wr.Flush()
+
+	v, err := NewReader(&buf).ReadIntf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[string]interface{})
+	if len(m) != 20 {
+		t.Fatalf("decoded %d entries; want 20", len(m))
+	}
+	for k, v := range m {
+		if i, _ := strconv.Atoi(k); len(v.([]interface{})) != i {
+			t.Errorf("%s: decoded %d elements", k, len(v.([]interface{})))
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package msgp
+
+import (
+	"errors"
+)
+
+// Funcs adapts methods that don't have the names of
+// the methods of the msgp interfaces to them. The code
+// generator's -method-suffix flag renames the methods
+// it generates (to MarshalMsgMP, etc.) and adds a method
+// that returns them as a Funcs, so that they can still
+// be passed to Encode, Decode, and so on. For example:
+//
+//	msgp.Encode(w, v.MsgpMP())
+//
+// The methods of a Funcs without the corresponding
+// function return an error (or, for Msgsize, zero).
+type Funcs struct {
+	Marshal   func(b []byte) ([]byte, error)
+	Unmarshal func(b []byte) ([]byte, error)
+	Encode    func(w *Writer) error
+	Decode    func(r *Reader) error
+	Size      func() int
+}
+
+// errNoFunc is returned by the methods
+// of a Funcs without the function
+var errNoFunc = errors.New("msgp: Funcs has no function for the method")
+
+// MarshalMsg implements Marshaler
+func (f Funcs) MarshalMsg(b []byte) ([]byte, error) {
+	if f.Marshal == nil {
+		return b, errNoFunc
+	}
+	return f.Marshal(b)
+}
+
+// UnmarshalMsg implements Unmarshaler
+func (f Funcs) UnmarshalMsg(b []byte) ([]byte, error) {
+	if f.Unmarshal == nil {
+		return b, errNoFunc
+	}
+	return f.Unmarshal(b)
+}
+
+// EncodeMsg implements Encodable
+func (f Funcs) EncodeMsg(w *Writer) error {
+	if f.Encode == nil {
+		return errNoFunc
+	}
+	return f.Encode(w)
+}
+
+// DecodeMsg implements Decodable
+func (f Funcs) DecodeMsg(r *Reader) error {
+	if f.Decode == nil {
+		return errNoFunc
+	}
+	return f.Decode(r)
+}
+
+// Msgsize implements Sizer
+func (f Funcs) Msgsize() int {
+	if f.Size == nil {
+		return 0
+	}
+	return f.Size()
+}
@@ -0,0 +1,46 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFuncs(t *testing.T) {
+	raw := Raw(AppendString(nil, "hello"))
+	f := Funcs{
+		Marshal:   raw.MarshalMsg,
+		Unmarshal: raw.UnmarshalMsg,
+		Encode:    raw.EncodeMsg,
+		Size:      raw.Msgsize,
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, f); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), raw) {
+		t.Errorf("encoded %x; expected %x", buf.Bytes(), raw)
+	}
+	bts, err := f.MarshalMsg(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bts, raw) {
+		t.Errorf("marshaled %x; expected %x", bts, raw)
+	}
+	if f.Msgsize() != raw.Msgsize() {
+		t.Errorf("Msgsize() is %d; expected %d", f.Msgsize(), raw.Msgsize())
+	}
+
+	// no Decode function
+	if err := Decode(&buf, f); err != errNoFunc {
+		t.Errorf("expected %v; got %v", errNoFunc, err)
+	}
+	var empty Funcs
+	if _, err := empty.UnmarshalMsg(bts); err != errNoFunc {
+		t.Errorf("expected %v; got %v", errNoFunc, err)
+	}
+	if empty.Msgsize() != 0 {
+		t.Errorf("Msgsize() without a function is %d", empty.Msgsize())
+	}
+}
@@ -0,0 +1,153 @@
+//go:build go1.18
+// +build go1.18
+
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fuzzSeeds returns the encodings of a variety of
+// objects, written with a *Writer
+func fuzzSeeds() [][]byte {
+	objs := []interface{}{
+		nil, true, false,
+		int64(-1), int64(-33), int64(math.MinInt64), uint64(7), uint64(math.MaxUint64),
+		float32(3.5), math.Inf(-1),
+		"", "hello", string(make([]byte, 40)), string(make([]byte, 300)),
+		[]byte{}, []byte("bytes"), make([]byte, 300),
+		complex64(1 + 2i), complex128(3 - 4i),
+		time.Unix(1234567, 890).UTC(),
+		&RawExtension{Type: 40, Data: []byte("extension")},
+		[]interface{}{},
+		[]interface{}{int64(1), "two", nil, []interface{}{true}},
+		map[string]interface{}{},
+		map[string]interface{}{"a": int64(1), "b": map[string]interface{}{"c": []byte("d")}},
+	}
+	var out [][]byte
+	for _, o := range objs {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err := w.WriteIntf(o); err != nil {
+			panic(err)
+		}
+		w.Flush()
+		out = append(out, buf.Bytes())
+	}
+	return out
+}
+
+// intfEqual is reflect.DeepEqual,
+// except that NaNs are equal
+func intfEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case float32:
+		b, ok := b.(float32)
+		return ok && (a == b || (a != a && b != b))
+	case float64:
+		b, ok := b.(float64)
+		return ok && (a == b || (a != a && b != b))
+	case complex64:
+		b, ok := b.(complex64)
+		return ok && intfEqual(real(a), real(b)) && intfEqual(imag(a), imag(b))
+	case complex128:
+		b, ok := b.(complex128)
+		return ok && intfEqual(real(a), real(b)) && intfEqual(imag(a), imag(b))
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !intfEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !intfEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case time.Time:
+		b, ok := b.(time.Time)
+		return ok && a.Equal(b)
+	default:
+		return reflect.DeepEqual(a, b)
+	}
+}
+
+// readIntfBoth reads 'b' with ReadIntfBytes and
+// ReadIntf and checks that the results agree
+func readIntfBoth(t *testing.T, b []byte) {
+	// every level of nesting can allocate
+	// len(b) elements, so big inputs just
+	// exhaust memory
+	if len(b) > 4096 {
+		t.Skip()
+	}
+	// a valid object can't hold more elements
+	// or bytes than the input does; the limits
+	// stop hostile headers from allocating wildly
+	opt := DecodeOptions{MaxElements: uint32(len(b)), MaxBytes: uint32(len(b))}
+
+	bi, rest, berr := ReadIntfBytesOpt(b, opt)
+	bused := len(b) - len(rest)
+
+	rd := NewReaderWithOptions(bytes.NewReader(b), opt)
+	ri, rerr := rd.ReadIntf()
+	left, err := ioutil.ReadAll(rd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rused := len(b) - len(left)
+
+	if (berr == nil) != (rerr == nil) {
+		t.Fatalf("%x: ReadIntfBytes returned %v; ReadIntf returned %v", b, berr, rerr)
+	}
+	if berr != nil {
+		// the bytes have to be present before
+		// ReadIntfBytes checks the limits, but
+		// ReadIntf checks them before reading
+		_, blim := berr.(LimitError)
+		_, rlim := rerr.(LimitError)
+		if blim || rlim {
+			return
+		}
+		// running out of input should look
+		// the same on both sides, and only
+		// empty input ends cleanly
+		short := berr == ErrShortBytes
+		eof := rerr == io.ErrUnexpectedEOF || (rerr == io.EOF && len(b) == 0)
+		if short != eof {
+			t.Fatalf("%x: ReadIntfBytes returned %v; ReadIntf returned %v", b, berr, rerr)
+		}
+		return
+	}
+	if !intfEqual(bi, ri) {
+		t.Fatalf("%x: ReadIntfBytes returned %#v; ReadIntf returned %#v", b, bi, ri)
+	}
+	if bused != rused {
+		t.Fatalf("%x: ReadIntfBytes consumed %d bytes; ReadIntf consumed %d", b, bused, rused)
+	}
+}
+
+func FuzzReadIntf(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(readIntfBoth)
+}
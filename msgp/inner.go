@@ -0,0 +1,69 @@
+package msgp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNoInnerWriter is returned by InnerWriter
+// for a Writer that doesn't write to an io.Writer;
+// see NewWriterBuf and SetFlushFunc.
+var ErrNoInnerWriter = errors.New("msgp: Writer has no underlying io.Writer")
+
+// ErrHeldData is returned by InnerWriter when the
+// Writer is holding data behind a deferred header
+// that hasn't been set, which it can't flush.
+var ErrHeldData = errors.New("msgp: Writer is holding data behind a deferred header")
+
+// InnerWriter flushes the Writer and returns the
+// io.Writer underneath it, so that data can be
+// written to it directly, for example a large
+// object that is already encoded, after the
+// start of a map written with the Writer:
+//
+//	mw.WriteMapHeader(1)
+//	mw.WriteString("blob")
+//	w, err := mw.InnerWriter()
+//	if err != nil {
+//		return err
+//	}
+//	_, err = io.Copy(w, encodedBlob)
+//
+// Writing to the underlying writer while the Writer has
+// data buffered puts the bytes out of order, so it has to
+// be done through InnerWriter, and again after each use
+// of the Writer. In builds with the msgp_debug tag, the
+// returned writer panics if it's written to while the
+// Writer has data buffered.
+func (mw *Writer) InnerWriter() (io.Writer, error) {
+	if mw.w == nil {
+		return nil, ErrNoInnerWriter
+	}
+	err := mw.flush()
+	if err != nil {
+		return nil, err
+	}
+	if len(mw.buf) > 0 {
+		return nil, ErrHeldData
+	}
+	if debug {
+		return &checkedWriter{mw: mw, w: mw.w}, nil
+	}
+	return mw.w, nil
+}
+
+// checkedWriter is the writer returned
+// by InnerWriter in msgp_debug builds
+type checkedWriter struct {
+	mw *Writer
+	w  io.Writer
+}
+
+func (c *checkedWriter) Write(p []byte) (int, error) {
+	if c.mw.w == c.w && len(c.mw.buf) > 0 {
+		panic(fmt.Sprintf("msgp: write to the io.Writer underneath a Writer with %d bytes buffered, "+
+			"which would put them out of order; call InnerWriter again before each direct write", len(c.mw.buf)))
+	}
+	return c.w.Write(p)
+}
@@ -0,0 +1,32 @@
+//go:build msgp_debug
+// +build msgp_debug
+
+package msgp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestInnerWriterMisuse(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewWriter(&buf)
+	w, err := mw.InnerWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fine: nothing is buffered
+	w.Write(AppendNil(nil))
+
+	mw.WriteString("header")
+	defer func() {
+		r := recover()
+		msg, _ := r.(string)
+		if !strings.Contains(msg, "buffered") {
+			t.Errorf("got panic %v; want one about buffered data", r)
+		}
+	}()
+	w.Write(AppendNil(nil))
+	t.Error("no panic writing to the inner writer with data buffered")
+}
@@ -0,0 +1,64 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInnerWriter(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewWriter(&buf)
+	mw.WriteMapHeader(1)
+	mw.WriteString("blob")
+	blob := AppendString(nil, "payload")
+
+	w, err := mw.InnerWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mw.Buffered() != 0 {
+		t.Errorf("%d bytes are still buffered", mw.Buffered())
+	}
+	if _, err = w.Write(blob); err != nil {
+		t.Fatal(err)
+	}
+	mw.WriteString("next")
+	if err = mw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := AppendMapHeader(nil, 1)
+	want = AppendString(want, "blob")
+	want = append(want, blob...)
+	want = AppendString(want, "next")
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("wrote %x; want %x", buf.Bytes(), want)
+	}
+}
+
+func TestInnerWriterErrors(t *testing.T) {
+	if _, err := NewWriterBuf(nil).InnerWriter(); err != ErrNoInnerWriter {
+		t.Errorf("NewWriterBuf: got error %v; want ErrNoInnerWriter", err)
+	}
+	mw := NewWriter(&bytes.Buffer{})
+	mw.SetFlushFunc(func([]byte) error { return nil })
+	if _, err := mw.InnerWriter(); err != ErrNoInnerWriter {
+		t.Errorf("SetFlushFunc: got error %v; want ErrNoInnerWriter", err)
+	}
+
+	var buf bytes.Buffer
+	mw = NewWriter(&buf)
+	mw.WriteString("before")
+	f, _ := mw.WriteArrayHeaderDeferred()
+	mw.WriteString("held")
+	if _, err := mw.InnerWriter(); err != ErrHeldData {
+		t.Errorf("deferred header: got error %v; want ErrHeldData", err)
+	}
+	if !bytes.Equal(buf.Bytes(), AppendString(nil, "before")) {
+		t.Errorf("flushed %x; want only the data before the deferred header", buf.Bytes())
+	}
+	f.Set(1)
+	if _, err := mw.InnerWriter(); err != nil {
+		t.Errorf("after Set: %s", err)
+	}
+}
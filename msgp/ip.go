@@ -0,0 +1,243 @@
+package msgp
+
+import (
+	"net"
+	"strconv"
+)
+
+const (
+	// IPSize is the largest encoded size
+	// of a net.IP: a bin8 header and the
+	// 16 bytes of an IPv6 address.
+	IPSize = 2 + net.IPv6len
+
+	// IPNetSize is the largest encoded size of
+	// a net.IPNet: an array header, an IP, and
+	// a prefix length of up to 128.
+	IPNetSize = 1 + IPSize + 2
+)
+
+// AddressError is returned when a network address
+// (a net.IP, net.IPNet or netip.Addr) is read from
+// an object of the right type that doesn't hold
+// one, like a 'bin' of 5 bytes. The whole object
+// has been read, so the error is resumable: the
+// next object can be read as if it hadn't happened.
+type AddressError struct {
+	Type   string // the Go type being read, e.g. "net.IP"
+	Reason string
+}
+
+// Error implements the error interface
+func (e AddressError) Error() string {
+	return "msgp: bad " + e.Type + ": " + e.Reason
+}
+
+// Resumable returns true; see AddressError.
+func (e AddressError) Resumable() bool { return true }
+
+// ipOf returns a copy of the address in 'b',
+// which has to be 4 or 16 bytes long, in the
+// memory of 'dst' if it has room, or nil if
+// 'b' is empty, as it is for a nil IP
+func ipOf(typ string, b []byte, dst net.IP) (net.IP, error) {
+	switch len(b) {
+	case 0:
+		return nil, nil
+	case net.IPv4len, net.IPv6len:
+		return append(dst[:0], b...), nil
+	}
+	return nil, AddressError{Type: typ, Reason: strconv.Itoa(len(b)) + " bytes aren't an IPv4 or IPv6 address"}
+}
+
+// AppendIP appends a net.IP to the slice as a 'bin'
+// of its bytes, which are 4 for an IPv4 address in
+// the short form, 16 for an IPv6 address, or an IPv4
+// address in the long form (as net.ParseIP returns
+// them), or none for a nil IP. An IP of any other
+// length is written as it is, and can't be read back.
+func AppendIP(b []byte, ip net.IP) []byte { return AppendBytes(b, ip) }
+
+// WriteIP writes a net.IP as AppendIP does.
+func (mw *Writer) WriteIP(ip net.IP) error { return mw.WriteBytes(ip) }
+
+// ReadIPBytes reads a net.IP written by AppendIP from 'b'
+// and returns it and the remaining bytes. An empty 'bin'
+// is read as a nil IP. If the 'bin' isn't 4 or 16 bytes
+// long, the error is an AddressError, and the remaining
+// bytes are those after it.
+func ReadIPBytes(b []byte) (ip net.IP, o []byte, err error) {
+	return ReadIPIntoBytes(b, nil)
+}
+
+// ReadIPIntoBytes is ReadIPBytes, but the address is
+// read into the memory of 'dst' if it has room, as
+// ReadBytesBytes reads into its scratch slice.
+func ReadIPIntoBytes(b []byte, dst net.IP) (ip net.IP, o []byte, err error) {
+	var v []byte
+	v, o, err = ReadBytesZC(b)
+	if err != nil {
+		return nil, b, err
+	}
+	ip, err = ipOf("net.IP", v, dst)
+	return
+}
+
+// ReadIP reads a net.IP written by WriteIP.
+// See ReadIPBytes for the errors.
+func (m *Reader) ReadIP() (net.IP, error) {
+	return m.ReadIPInto(nil)
+}
+
+// ReadIPInto is ReadIP, but the address is read into
+// the memory of 'dst' if it has room, as ReadBytes
+// reads into its scratch slice.
+func (m *Reader) ReadIPInto(dst net.IP) (net.IP, error) {
+	var err error
+	m.scratch, err = m.ReadBytes(m.scratch[:0])
+	if err != nil {
+		return nil, err
+	}
+	return ipOf("net.IP", m.scratch, dst)
+}
+
+// ipNetParts returns the address and prefix length of 'n'.
+// The address is written in the length of the mask, so
+// that an IPv4 network read back has an IPv4 mask.
+func ipNetParts(n net.IPNet) (net.IP, int) {
+	ip := n.IP
+	if len(n.Mask) == net.IPv4len {
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+	}
+	ones, _ := n.Mask.Size()
+	return ip, ones
+}
+
+// AppendIPNet appends a net.IPNet to the slice as an
+// array of its address, as AppendIP writes it, and its
+// prefix length. A mask that isn't a prefix (which
+// net.ParseCIDR never returns) is written as 0 bits.
+func AppendIPNet(b []byte, n net.IPNet) []byte {
+	ip, ones := ipNetParts(n)
+	o := AppendArrayHeader(b, 2)
+	o = AppendBytes(o, ip)
+	return AppendInt(o, ones)
+}
+
+// WriteIPNet writes a net.IPNet as AppendIPNet does.
+func (mw *Writer) WriteIPNet(n net.IPNet) error {
+	ip, ones := ipNetParts(n)
+	err := mw.WriteArrayHeader(2)
+	if err != nil {
+		return err
+	}
+	err = mw.WriteBytes(ip)
+	if err != nil {
+		return err
+	}
+	return mw.WriteInt(ones)
+}
+
+// ReadIPNetBytes reads a net.IPNet written by AppendIPNet
+// from 'b' and returns it and the remaining bytes. The
+// mask is as long as the address, and a nil address
+// (the zero IPNet) has a nil mask. If 'b' starts with
+// an array that isn't an IPNet, the error is an
+// AddressError, and the remaining bytes are those
+// after the array.
+func ReadIPNetBytes(b []byte) (n net.IPNet, o []byte, err error) {
+	return ReadIPNetIntoBytes(b, net.IPNet{})
+}
+
+// ReadIPNetIntoBytes is ReadIPNetBytes, but the address
+// and mask are read into the memory of those of 'dst'
+// if they have room, as ReadIPIntoBytes does.
+func ReadIPNetIntoBytes(b []byte, dst net.IPNet) (n net.IPNet, o []byte, err error) {
+	var sz uint32
+	sz, o, err = ReadArrayHeaderBytes(b)
+	if err != nil {
+		return n, b, err
+	}
+	end, err := Skip(b)
+	if err != nil {
+		return n, b, err
+	}
+	n, err = ipNetOf(sz, o, dst)
+	return n, end, err
+}
+
+// ipNetOf reads the 'sz' elements of an IPNet
+// from the start of 'b', into the memory of 'dst'
+func ipNetOf(sz uint32, b []byte, dst net.IPNet) (n net.IPNet, err error) {
+	fail := func(reason string) (net.IPNet, error) {
+		return net.IPNet{}, AddressError{Type: "net.IPNet", Reason: reason}
+	}
+	if sz != 2 {
+		return fail("an array of " + strconv.Itoa(int(sz)) + " elements, not 2")
+	}
+	v, b, err := ReadBytesZC(b)
+	if err != nil {
+		return fail("the address: " + err.Error())
+	}
+	n.IP, err = ipOf("net.IPNet", v, dst.IP)
+	if err != nil {
+		return n, err
+	}
+	ones, _, err := ReadIntBytes(b)
+	if err != nil {
+		return fail("the prefix length: " + err.Error())
+	}
+	bits := 8 * len(n.IP)
+	if ones < 0 || ones > bits {
+		return fail("a prefix of " + strconv.Itoa(ones) + " bits for a " + strconv.Itoa(bits) + "-bit address")
+	}
+	if n.IP != nil {
+		n.Mask = cidrMask(ones, bits, dst.Mask)
+	}
+	return n, nil
+}
+
+// cidrMask is net.CIDRMask, for a valid prefix,
+// in the memory of 'dst' if it has room
+func cidrMask(ones int, bits int, dst net.IPMask) net.IPMask {
+	m := dst[:0]
+	for i := 0; i < bits/8; i++ {
+		switch {
+		case ones >= 8:
+			m = append(m, 0xff)
+			ones -= 8
+		default:
+			m = append(m, ^byte(0xff>>uint(ones)))
+			ones = 0
+		}
+	}
+	return m
+}
+
+// ReadIPNet reads a net.IPNet written by WriteIPNet.
+// See ReadIPNetBytes for the errors; after an
+// AddressError, the whole array has been read.
+func (m *Reader) ReadIPNet() (n net.IPNet, err error) {
+	return m.ReadIPNetInto(net.IPNet{})
+}
+
+// ReadIPNetInto is ReadIPNet, but the address and mask
+// are read into the memory of those of 'dst' if they
+// have room, as ReadIPInto does.
+func (m *Reader) ReadIPNetInto(dst net.IPNet) (n net.IPNet, err error) {
+	t, err := m.NextType()
+	if err != nil {
+		return n, err
+	}
+	if t != ArrayType {
+		return n, TypeError{Method: ArrayType, Encoded: t}
+	}
+	m.scratch, err = m.CaptureNext(m.scratch[:0])
+	if err != nil {
+		return n, err
+	}
+	n, _, err = ReadIPNetIntoBytes(m.scratch, dst)
+	return n, err
+}
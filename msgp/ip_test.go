@@ -0,0 +1,207 @@
+package msgp
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestIP(t *testing.T) {
+	for _, ip := range []net.IP{
+		nil,
+		net.IP{192, 0, 2, 1},
+		net.ParseIP("192.0.2.1"), // in the 16-byte form
+		net.ParseIP("2001:db8::1"),
+	} {
+		b := AppendIP(nil, ip)
+		if len(b) > IPSize {
+			t.Errorf("%v: wrote %d bytes; IPSize is %d", ip, len(b), IPSize)
+		}
+		out, left, err := ReadIPBytes(b)
+		if err != nil {
+			t.Fatalf("%v: %s", ip, err)
+		}
+		if len(left) > 0 || !reflect.DeepEqual(out, ip) {
+			t.Errorf("%v: read back %#v, with %d bytes left", ip, out, len(left))
+		}
+
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		if err = wr.WriteIP(ip); err != nil {
+			t.Fatal(err)
+		}
+		wr.Flush()
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Errorf("%v: WriteIP wrote %x; AppendIP %x", ip, buf.Bytes(), b)
+		}
+		out, err = NewReader(&buf).ReadIP()
+		if err != nil {
+			t.Fatalf("%v: ReadIP: %s", ip, err)
+		}
+		if !reflect.DeepEqual(out, ip) {
+			t.Errorf("%v: ReadIP read %#v", ip, out)
+		}
+	}
+}
+
+func TestIPNet(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+	long := net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(8, 32)}
+	for _, tt := range []struct {
+		in, want net.IPNet
+	}{
+		{net.IPNet{}, net.IPNet{}},
+		{*v4, *v4},
+		{*v6, *v6},
+		// an IPv4 address in the 16-byte form is
+		// written in the length of its mask
+		{long, net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}},
+	} {
+		b := AppendIPNet(nil, tt.in)
+		if len(b) > IPNetSize {
+			t.Errorf("%v: wrote %d bytes; IPNetSize is %d", tt.in, len(b), IPNetSize)
+		}
+		out, left, err := ReadIPNetBytes(b)
+		if err != nil {
+			t.Fatalf("%v: %s", tt.in, err)
+		}
+		if len(left) > 0 || !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("%v: read back %#v, with %d bytes left", tt.in, out, len(left))
+		}
+
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		if err = wr.WriteIPNet(tt.in); err != nil {
+			t.Fatal(err)
+		}
+		wr.Flush()
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Errorf("%v: WriteIPNet wrote %x; AppendIPNet %x", tt.in, buf.Bytes(), b)
+		}
+		out, err = NewReader(&buf).ReadIPNet()
+		if err != nil {
+			t.Fatalf("%v: ReadIPNet: %s", tt.in, err)
+		}
+		if !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("%v: ReadIPNet read %#v", tt.in, out)
+		}
+	}
+}
+
+func TestAddressErrors(t *testing.T) {
+	ipnet := func(ip []byte, ones int) []byte {
+		return AppendInt(AppendBytes(AppendArrayHeader(nil, 2), ip), ones)
+	}
+	tests := []struct {
+		name  string
+		msg   []byte
+		ipnet bool
+	}{
+		{"5-byte IP", AppendBytes(nil, make([]byte, 5)), false},
+		{"3-element IPNet", AppendInt(AppendInt(AppendBytes(AppendArrayHeader(nil, 3), make([]byte, 4)), 8), 1), true},
+		{"5-byte IPNet", ipnet(make([]byte, 5), 8), true},
+		{"33-bit IPv4 prefix", ipnet(make([]byte, 4), 33), true},
+		{"negative prefix", ipnet(make([]byte, 16), -1), true},
+		{"prefix of a nil IP", ipnet(nil, 8), true},
+		{"IPNet of strings", AppendString(AppendString(AppendArrayHeader(nil, 2), "a"), "b"), true},
+	}
+	// the next object is read
+	// after each error
+	next := AppendString(nil, "next")
+	for _, tt := range tests {
+		msg := append(tt.msg, next...)
+		var left []byte
+		var err error
+		if tt.ipnet {
+			_, left, err = ReadIPNetBytes(msg)
+		} else {
+			_, left, err = ReadIPBytes(msg)
+		}
+		if _, ok := err.(AddressError); !ok {
+			t.Errorf("%s: got error %v; want an AddressError", tt.name, err)
+		}
+		if !bytes.Equal(left, next) {
+			t.Errorf("%s: %x left; want the next object", tt.name, left)
+		}
+
+		r := NewReader(bytes.NewReader(msg))
+		if tt.ipnet {
+			_, err = r.ReadIPNet()
+		} else {
+			_, err = r.ReadIP()
+		}
+		if _, ok := err.(AddressError); !ok {
+			t.Errorf("%s: Reader: got error %v; want an AddressError", tt.name, err)
+		}
+		if s, err := r.ReadString(); s != "next" || err != nil {
+			t.Errorf("%s: the reader is at (%q, %v), not the next object", tt.name, s, err)
+		}
+	}
+
+	// other types aren't addresses
+	str := AppendString(nil, "192.0.2.1")
+	if _, _, err := ReadIPBytes(str); err == nil {
+		t.Error("ReadIPBytes read a string")
+	}
+	if _, _, err := ReadIPNetBytes(str); err == nil {
+		t.Error("ReadIPNetBytes read a string")
+	}
+	if _, err := NewReader(bytes.NewReader(str)).ReadIPNet(); err == nil {
+		t.Error("ReadIPNet read a string")
+	}
+}
+
+func TestReadIPInto(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("192.0.2.0/23")
+	b := AppendIPNet(AppendIP(nil, v4.IP), *v4)
+
+	// room for IPv6 addresses
+	dst := net.IPNet{IP: make(net.IP, net.IPv6len), Mask: make(net.IPMask, net.IPv6len)}
+	ip, left, err := ReadIPIntoBytes(b, dst.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(v4.IP) || &ip[0] != &dst.IP[0] {
+		t.Errorf("ReadIPIntoBytes read %v, not into the IP given", ip)
+	}
+	n, _, err := ReadIPNetIntoBytes(left, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(n, *v4) || &n.IP[0] != &dst.IP[0] || &n.Mask[0] != &dst.Mask[0] {
+		t.Errorf("ReadIPNetIntoBytes read %v, not into the IPNet given", n)
+	}
+
+	r := NewReader(bytes.NewReader(b))
+	ip, err = r.ReadIPInto(dst.IP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ip.Equal(v4.IP) || &ip[0] != &dst.IP[0] {
+		t.Errorf("ReadIPInto read %v, not into the IP given", ip)
+	}
+	n, err = r.ReadIPNetInto(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(n, *v4) || &n.Mask[0] != &dst.Mask[0] {
+		t.Errorf("ReadIPNetInto read %v, not into the IPNet given", n)
+	}
+
+	// without room, they're
+	// read into new memory
+	short := net.IP{0}
+	ip, _, err = ReadIPIntoBytes(b, short)
+	if err != nil || !ip.Equal(v4.IP) || short[0] != 0 {
+		t.Errorf("ReadIPIntoBytes read %v (%v) into %v", ip, err, short)
+	}
+
+	// and the masks are those of CIDRMask
+	for ones := 0; ones <= 128; ones++ {
+		if m := cidrMask(ones, 128, dst.Mask); !bytes.Equal(m, net.CIDRMask(ones, 128)) {
+			t.Errorf("a /%d mask is %x", ones, m)
+		}
+	}
+}
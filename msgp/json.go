@@ -69,6 +69,9 @@ func rwNext(w jsWriter, src *Reader) (int, error) {
 	}
 	switch t {
 	case NilType:
+		if err = src.ReadNil(); err != nil {
+			return 0, err
+		}
 		return w.Write(null)
 	case BoolType:
 		return rwBool(w, src)
@@ -122,6 +125,7 @@ func rwMap(dst jsWriter, src *Reader) (n int, err error) {
 
 		src.scratch, err = src.ReadMapKey(src.scratch)
 		if err != nil {
+			err = noEOF(err)
 			return
 		}
 
@@ -139,6 +143,7 @@ func rwMap(dst jsWriter, src *Reader) (n int, err error) {
 		nn, err = rwNext(dst, src)
 		n += nn
 		if err != nil {
+			err = noEOF(err)
 			return
 		}
 		if !comma {
@@ -177,6 +182,7 @@ func rwArray(dst jsWriter, src *Reader) (n int, err error) {
 		nn, err = rwNext(dst, src)
 		n += nn
 		if err != nil {
+			err = noEOF(err)
 			return
 		}
 		if !comma {
@@ -244,7 +250,7 @@ func rwBool(dst jsWriter, src *Reader) (int, error) {
 
 func rwExtension(dst jsWriter, src *Reader, t Type) (n int, err error) {
 	// time.Time is a json.Marshaler
-	if t == TimeExtension {
+	if t == TimeType {
 		var t time.Time
 		var bts []byte
 		t, err = src.ReadTime()
@@ -266,7 +272,7 @@ func rwExtension(dst jsWriter, src *Reader, t Type) (n int, err error) {
 
 	// registered extensions can override
 	// the JSON encoding
-	if j, ok := extensionReg[et]; ok {
+	if j, ok := lookupExtension(et); ok {
 		var bts []byte
 		e := j()
 		err = src.ReadExtension(e)
@@ -369,7 +375,11 @@ func rwString(dst jsWriter, src *Reader) (n int, err error) {
 		if err != nil {
 			return
 		}
-		read = int(big.Uint32(p[1:]))
+		sz := big.Uint32(p[1:])
+		if err = checkSize(sz, StrType); err != nil {
+			return
+		}
+		read = int(sz)
 		off = 5
 	default:
 		err = TypeError{Method: StrType, Encoded: getType(lead)}
@@ -0,0 +1,711 @@
+package msgp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrJSONFloat is returned by AppendJSONFromMsgp
+// for a NaN or an infinity, which JSON has no
+// number for.
+var ErrJSONFloat = errors.New("msgp: NaN and infinities can't be written as JSON")
+
+// JSONError is returned by AppendMsgpFromJSON
+// when its input isn't JSON, or holds a number
+// too large for a float64. Offset is where in
+// the input the problem is.
+type JSONError struct {
+	Offset int
+	Reason string
+}
+
+// Error implements the error interface
+func (e JSONError) Error() string {
+	return "msgp: bad JSON at offset " + strconv.Itoa(e.Offset) + ": " + e.Reason
+}
+
+// AppendJSONFromMsgp appends the first object in 'src'
+// to 'dst' as JSON, and returns the extended slice and
+// the rest of 'src'. It writes what UnmarshalAsJSON
+// does, except that very large and very small floats
+// are written with an exponent (1e+21, 1e-7), as
+// encoding/json writes them, a NaN or an infinity is an
+// error (ErrJSONFloat), a tab is written as \t, and each
+// byte of a 'str' that isn't UTF-8 as \ufffd.
+//
+// It doesn't allocate, apart from growing 'dst', except
+// for extensions registered with RegisterExtension, which
+// are written with encoding/json. If an error is returned,
+// 'dst' holds the JSON written before it, and the rest of
+// 'src' starts at the object that failed.
+func AppendJSONFromMsgp(dst []byte, src []byte) ([]byte, []byte, error) {
+	if len(src) < 1 {
+		return dst, src, ErrShortBytes
+	}
+	switch getType(src[0]) {
+	case MapType:
+		return appendJSONMap(dst, src)
+	case ArrayType:
+		return appendJSONArray(dst, src)
+	case StrType:
+		s, o, err := ReadStringZC(src)
+		if err != nil {
+			return dst, src, err
+		}
+		return appendJSONString(dst, s), o, nil
+	case BinType:
+		b, o, err := ReadBytesZC(src)
+		if err != nil {
+			return dst, src, err
+		}
+		return appendJSONBase64(dst, b), o, nil
+	case IntType:
+		i, o, err := ReadInt64Bytes(src)
+		if err != nil {
+			return dst, src, err
+		}
+		return strconv.AppendInt(dst, i, 10), o, nil
+	case UintType:
+		u, o, err := ReadUint64Bytes(src)
+		if err != nil {
+			return dst, src, err
+		}
+		return strconv.AppendUint(dst, u, 10), o, nil
+	case Float32Type:
+		f, o, err := ReadFloat32Bytes(src)
+		if err != nil {
+			return dst, src, err
+		}
+		dst, err = appendJSONFloat(dst, float64(f), 32)
+		if err != nil {
+			return dst, src, err
+		}
+		return dst, o, nil
+	case Float64Type:
+		f, o, err := ReadFloat64Bytes(src)
+		if err != nil {
+			return dst, src, err
+		}
+		dst, err = appendJSONFloat(dst, f, 64)
+		if err != nil {
+			return dst, src, err
+		}
+		return dst, o, nil
+	case BoolType:
+		b, o, err := ReadBoolBytes(src)
+		if err != nil {
+			return dst, src, err
+		}
+		if b {
+			return append(dst, "true"...), o, nil
+		}
+		return append(dst, "false"...), o, nil
+	case NilType:
+		o, err := ReadNilBytes(src)
+		if err != nil {
+			return dst, src, err
+		}
+		return append(dst, null...), o, nil
+	case ExtensionType:
+		return appendJSONExtension(dst, src)
+	default:
+		return dst, src, InvalidPrefixError(src[0])
+	}
+}
+
+func appendJSONMap(dst []byte, src []byte) ([]byte, []byte, error) {
+	sz, o, err := ReadMapHeaderBytes(src)
+	if err != nil {
+		return dst, src, err
+	}
+	dst = append(dst, '{')
+	for i := uint32(0); i < sz; i++ {
+		if i != 0 {
+			dst = append(dst, ',')
+		}
+		var key []byte
+		key, o, err = ReadMapKeyZC(o)
+		if err != nil {
+			return dst, o, err
+		}
+		dst = append(appendJSONString(dst, key), ':')
+		dst, o, err = AppendJSONFromMsgp(dst, o)
+		if err != nil {
+			return dst, o, err
+		}
+	}
+	return append(dst, '}'), o, nil
+}
+
+func appendJSONArray(dst []byte, src []byte) ([]byte, []byte, error) {
+	sz, o, err := ReadArrayHeaderBytes(src)
+	if err != nil {
+		return dst, src, err
+	}
+	dst = append(dst, '[')
+	for i := uint32(0); i < sz; i++ {
+		if i != 0 {
+			dst = append(dst, ',')
+		}
+		dst, o, err = AppendJSONFromMsgp(dst, o)
+		if err != nil {
+			return dst, o, err
+		}
+	}
+	return append(dst, ']'), o, nil
+}
+
+func appendJSONExtension(dst []byte, src []byte) ([]byte, []byte, error) {
+	et, err := peekExtension(src)
+	if err != nil {
+		return dst, src, err
+	}
+
+	// times are written as time.Time.MarshalJSON
+	// writes them, which fails outside years 0-9999
+	if et == TimeExtension || et == TimestampExtension {
+		tm, o, err := ReadTimeBytes(src)
+		if err != nil {
+			return dst, src, err
+		}
+		if y := tm.Year(); y < 0 || y > 9999 {
+			_, err = tm.MarshalJSON()
+			return dst, src, err
+		}
+		dst = append(dst, '"')
+		dst = tm.AppendFormat(dst, time.RFC3339Nano)
+		return append(dst, '"'), o, nil
+	}
+
+	// registered extensions use their
+	// canonical JSON form
+	if f, ok := lookupExtension(et); ok {
+		e := f()
+		o, err := ReadExtensionBytes(src, e)
+		if err != nil {
+			return dst, src, err
+		}
+		bts, err := json.Marshal(e)
+		if err != nil {
+			return dst, src, err
+		}
+		return append(dst, bts...), o, nil
+	}
+
+	// otherwise, `{"type":<num>,"data":"<base64data>"}`
+	_, sz, o, err := ReadExtensionHeaderBytes(src)
+	if err != nil {
+		return dst, src, err
+	}
+	dst = append(dst, `{"type":`...)
+	dst = strconv.AppendInt(dst, int64(et), 10)
+	dst = append(dst, `,"data":`...)
+	dst = appendJSONBase64(dst, o[:sz])
+	return append(dst, '}'), o[sz:], nil
+}
+
+// appendJSONBase64 appends 'b' as a quoted
+// base64 string, encoded straight into 'dst'
+func appendJSONBase64(dst []byte, b []byte) []byte {
+	l := base64.StdEncoding.EncodedLen(len(b))
+	o, n := ensure(dst, l+2)
+	o[n] = '"'
+	base64.StdEncoding.Encode(o[n+1:], b)
+	o[n+l+1] = '"'
+	return o
+}
+
+// appendJSONFloat appends 'f', which is a float of
+// size 'bits', as encoding/json writes it: with an
+// exponent only when it's very large or very small
+func appendJSONFloat(dst []byte, f float64, bits int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return dst, ErrJSONFloat
+	}
+	format := byte('f')
+	if a := math.Abs(f); a != 0 {
+		if bits == 64 && (a < 1e-6 || a >= 1e21) || bits == 32 && (float32(a) < 1e-6 || float32(a) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// 1e-07 is written 1e-7
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst, nil
+}
+
+// appendJSONString appends 's' as a quoted JSON string,
+// escaped as encoding/json escapes it: quotes, backslashes,
+// control characters, <, > and & (for HTML), and U+2028
+// and U+2029 (for JavaScript). Bytes that aren't UTF-8
+// are written as \ufffd, the replacement character.
+func appendJSONString(dst []byte, s []byte) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if 0x20 <= b && b != '\\' && b != '"' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '\\', '"':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRune(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, `\ufffd`...)
+			i++
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// AppendMsgpFromJSON appends the first JSON value in 'src'
+// to 'dst' as MessagePack, and returns the extended slice
+// and the rest of 'src', after any whitespace. Objects are
+// written as maps, arrays as arrays, strings as 'str', true
+// and false as bools and null as nil. A number is written
+// as an int if it's whole and fits in an int64 (or as a
+// uint, if it only fits in a uint64), and as a float64
+// otherwise. Maps, arrays and strings get the smallest
+// headers that fit them.
+//
+// It doesn't allocate, apart from growing 'dst'. If an
+// error is returned, it's a JSONError, and 'dst' is as
+// long as it was when it was passed in.
+func AppendMsgpFromJSON(dst []byte, src []byte) ([]byte, []byte, error) {
+	p := jsonParser{src: src}
+	o, err := p.value(dst)
+	if err != nil {
+		return o[:len(dst)], src, err
+	}
+	p.space()
+	return o, src[p.i:], nil
+}
+
+// jsonParser reads JSON from 'src',
+// starting at offset 'i'
+type jsonParser struct {
+	src []byte
+	i   int
+}
+
+// fail returns a JSONError at the parser's offset
+func (p *jsonParser) fail(reason string) error {
+	if p.i >= len(p.src) {
+		reason = "unexpected end of input"
+	}
+	return JSONError{Offset: p.i, Reason: reason}
+}
+
+// next returns the byte at the parser's
+// offset, or 0 at the end of the input
+func (p *jsonParser) next() byte {
+	if p.i < len(p.src) {
+		return p.src[p.i]
+	}
+	return 0
+}
+
+// space skips whitespace
+func (p *jsonParser) space() {
+	for p.i < len(p.src) {
+		switch p.src[p.i] {
+		case ' ', '\t', '\n', '\r':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) value(dst []byte) ([]byte, error) {
+	p.space()
+	switch c := p.next(); {
+	case c == '{':
+		return p.object(dst)
+	case c == '[':
+		return p.array(dst)
+	case c == '"':
+		return p.str(dst)
+	case c == 't':
+		return p.literal(dst, "true", mtrue)
+	case c == 'f':
+		return p.literal(dst, "false", mfalse)
+	case c == 'n':
+		return p.literal(dst, "null", mnil)
+	case c == '-' || ('0' <= c && c <= '9'):
+		return p.number(dst)
+	default:
+		return dst, p.fail("unexpected character " + strconv.QuoteToASCII(string(c)))
+	}
+}
+
+func (p *jsonParser) object(dst []byte) ([]byte, error) {
+	p.i++ // '{'
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0)
+	var hdr [5]byte
+	var n uint32
+	p.space()
+	if p.next() == '}' {
+		p.i++
+		return setHeader(dst, start, AppendMapHeader(hdr[:0], 0)), nil
+	}
+	for {
+		var err error
+		p.space()
+		if p.next() != '"' {
+			return dst, p.fail("an object key isn't a string")
+		}
+		dst, err = p.str(dst)
+		if err != nil {
+			return dst, err
+		}
+		p.space()
+		if p.next() != ':' {
+			return dst, p.fail("no ':' after an object key")
+		}
+		p.i++
+		dst, err = p.value(dst)
+		if err != nil {
+			return dst, err
+		}
+		n++
+		p.space()
+		switch p.next() {
+		case ',':
+			p.i++
+		case '}':
+			p.i++
+			return setHeader(dst, start, AppendMapHeader(hdr[:0], n)), nil
+		default:
+			return dst, p.fail("no ',' or '}' after an object value")
+		}
+	}
+}
+
+func (p *jsonParser) array(dst []byte) ([]byte, error) {
+	p.i++ // '['
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0)
+	var hdr [5]byte
+	var n uint32
+	p.space()
+	if p.next() == ']' {
+		p.i++
+		return setHeader(dst, start, AppendArrayHeader(hdr[:0], 0)), nil
+	}
+	for {
+		var err error
+		dst, err = p.value(dst)
+		if err != nil {
+			return dst, err
+		}
+		n++
+		p.space()
+		switch p.next() {
+		case ',':
+			p.i++
+		case ']':
+			p.i++
+			return setHeader(dst, start, AppendArrayHeader(hdr[:0], n)), nil
+		default:
+			return dst, p.fail("no ',' or ']' after an array element")
+		}
+	}
+}
+
+// setHeader writes the header 'h' at dst[start:], where
+// 5 bytes (the largest header) were set aside for it, and
+// moves what follows down if 'h' is smaller, as Fixup.Set
+// does for a Writer
+func setHeader(dst []byte, start int, h []byte) []byte {
+	copy(dst[start:], h)
+	if shift := 5 - len(h); shift > 0 {
+		copy(dst[start+len(h):], dst[start+5:])
+		dst = dst[:len(dst)-shift]
+	}
+	return dst
+}
+
+// appendStrHeader appends the header
+// of a 'str' object of 'sz' bytes
+func appendStrHeader(b []byte, sz uint32) []byte {
+	switch {
+	case sz < 32:
+		return append(b, wfixstr(uint8(sz)))
+	case sz < 256:
+		o, n := ensure(b, 2)
+		prefixu8(o[n:], mstr8, uint8(sz))
+		return o
+	case sz < math.MaxUint16:
+		o, n := ensure(b, 3)
+		prefixu16(o[n:], mstr16, uint16(sz))
+		return o
+	default:
+		o, n := ensure(b, 5)
+		prefixu32(o[n:], mstr32, sz)
+		return o
+	}
+}
+
+// str appends the string at the parser's offset. A string
+// with nothing to unescape is copied after its header; any
+// other is unescaped after 5 bytes set aside for the header.
+func (p *jsonParser) str(dst []byte) ([]byte, error) {
+	p.i++ // '"'
+	start := p.i
+	plain := true
+	end := p.i
+	for ; end < len(p.src); end++ {
+		c := p.src[end]
+		if c == '"' {
+			break
+		}
+		if c == '\\' || c >= utf8.RuneSelf {
+			plain = false
+			break
+		}
+		if c < 0x20 {
+			p.i = end
+			return dst, p.fail("a control character in a string")
+		}
+	}
+	if plain && end < len(p.src) {
+		dst = appendStrHeader(dst, uint32(end-start))
+		dst = append(dst, p.src[start:end]...)
+		p.i = end + 1
+		return dst, nil
+	}
+
+	hdr := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0)
+	p.i = start
+	for {
+		if p.i >= len(p.src) {
+			return dst, p.fail("")
+		}
+		c := p.src[p.i]
+		switch {
+		case c == '"':
+			p.i++
+			var h [5]byte
+			return setHeader(dst, hdr, appendStrHeader(h[:0], uint32(len(dst)-hdr-5))), nil
+		case c < 0x20:
+			return dst, p.fail("a control character in a string")
+		case c == '\\':
+			var err error
+			dst, err = p.escape(dst)
+			if err != nil {
+				return dst, err
+			}
+		case c < utf8.RuneSelf:
+			dst = append(dst, c)
+			p.i++
+		default:
+			r, size := utf8.DecodeRune(p.src[p.i:])
+			if r == utf8.RuneError && size == 1 {
+				dst = appendRune(dst, utf8.RuneError)
+			} else {
+				dst = append(dst, p.src[p.i:p.i+size]...)
+			}
+			p.i += size
+		}
+	}
+}
+
+// escape appends the character of the escape
+// sequence at the parser's offset. A \u escape
+// of half a surrogate pair that isn't followed
+// by the other half is U+FFFD.
+func (p *jsonParser) escape(dst []byte) ([]byte, error) {
+	p.i++ // '\\'
+	c := p.next()
+	p.i++
+	switch c {
+	case '"', '\\', '/':
+		return append(dst, c), nil
+	case 'b':
+		return append(dst, '\b'), nil
+	case 'f':
+		return append(dst, '\f'), nil
+	case 'n':
+		return append(dst, '\n'), nil
+	case 'r':
+		return append(dst, '\r'), nil
+	case 't':
+		return append(dst, '\t'), nil
+	case 'u':
+		r, ok := p.hex4()
+		if !ok {
+			return dst, p.fail("a bad \\u escape")
+		}
+		if utf16.IsSurrogate(r) {
+			// the other half has to be next
+			save := p.i
+			r2 := utf8.RuneError
+			if p.next() == '\\' && p.i+1 < len(p.src) && p.src[p.i+1] == 'u' {
+				p.i += 2
+				r2, ok = p.hex4()
+				if !ok {
+					return dst, p.fail("a bad \\u escape")
+				}
+			}
+			if r = utf16.DecodeRune(r, r2); r == utf8.RuneError {
+				p.i = save
+			}
+		}
+		return appendRune(dst, r), nil
+	default:
+		p.i--
+		return dst, p.fail("a bad escape sequence")
+	}
+}
+
+// hex4 reads the 4 hex digits of a \u escape
+func (p *jsonParser) hex4() (rune, bool) {
+	if len(p.src)-p.i < 4 {
+		return 0, false
+	}
+	var r rune
+	for _, c := range p.src[p.i : p.i+4] {
+		switch {
+		case '0' <= c && c <= '9':
+			c -= '0'
+		case 'a' <= c && c <= 'f':
+			c -= 'a' - 10
+		case 'A' <= c && c <= 'F':
+			c -= 'A' - 10
+		default:
+			return 0, false
+		}
+		r = r<<4 | rune(c)
+	}
+	p.i += 4
+	return r, true
+}
+
+// appendRune appends 'r' as UTF-8
+func appendRune(dst []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+	n := utf8.EncodeRune(buf[:], r)
+	return append(dst, buf[:n]...)
+}
+
+// literal appends 'b' for the literal 'lit'
+// (true, false or null) at the parser's offset
+func (p *jsonParser) literal(dst []byte, lit string, b byte) ([]byte, error) {
+	for k := 0; k < len(lit); k++ {
+		if p.next() != lit[k] {
+			return dst, p.fail("unexpected character " + strconv.QuoteToASCII(string(p.next())))
+		}
+		p.i++
+	}
+	return append(dst, b), nil
+}
+
+// number appends the number at the parser's offset,
+// which matches -?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?
+func (p *jsonParser) number(dst []byte) ([]byte, error) {
+	start := p.i
+	whole := true
+	if p.next() == '-' {
+		p.i++
+	}
+	switch c := p.next(); {
+	case c == '0':
+		p.i++
+	case '1' <= c && c <= '9':
+		p.digits()
+	default:
+		return dst, p.fail("no digits in a number")
+	}
+	if p.next() == '.' {
+		whole = false
+		p.i++
+		if p.digits() == 0 {
+			return dst, p.fail("no digits after a decimal point")
+		}
+	}
+	if c := p.next(); c == 'e' || c == 'E' {
+		whole = false
+		p.i++
+		if c := p.next(); c == '+' || c == '-' {
+			p.i++
+		}
+		if p.digits() == 0 {
+			return dst, p.fail("no digits in an exponent")
+		}
+	}
+
+	// the number is only read
+	// while 'num' is unchanged
+	num := UnsafeString(p.src[start:p.i])
+	if whole {
+		if num[0] == '-' {
+			if i, err := strconv.ParseInt(num, 10, 64); err == nil {
+				return AppendInt64(dst, i), nil
+			}
+		} else if u, err := strconv.ParseUint(num, 10, 64); err == nil {
+			if u <= math.MaxInt64 {
+				return AppendInt64(dst, int64(u)), nil
+			}
+			return AppendUint64(dst, u), nil
+		}
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		p.i = start
+		return dst, p.fail("a number too large for a float64")
+	}
+	return AppendFloat64(dst, f), nil
+}
+
+// digits skips digits and returns how many there were
+func (p *jsonParser) digits() int {
+	n := 0
+	for c := p.next(); '0' <= c && c <= '9'; c = p.next() {
+		p.i++
+		n++
+	}
+	return n
+}
@@ -0,0 +1,323 @@
+package msgp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendJSONFromMsgp(t *testing.T) {
+	tests := []struct {
+		in   []byte
+		want string
+	}{
+		{AppendString(nil, "plain"), `"plain"`},
+		{AppendString(nil, "\x00\x1f\t\n\r\"\\</>&"), `"\u0000\u001f\t\n\r\"\\\u003c/\u003e\u0026"`},
+		{AppendString(nil, "\xffa\xc3b\xe2\x80"), `"\ufffda\ufffdb\ufffd\ufffd"`},
+		{AppendString(nil, "é\u2028\u2029😀"), `"é\u2028\u2029😀"`},
+		{AppendString(nil, ""), `""`},
+		{AppendBytes(nil, []byte{0, 1, 2, 0xff}), `"AAEC/w=="`},
+		{AppendInt64(nil, math.MinInt64), "-9223372036854775808"},
+		{AppendUint64(nil, math.MaxUint64), "18446744073709551615"},
+		{AppendFloat64(nil, 1e21), "1e+21"},
+		{AppendFloat64(nil, 1e20), "100000000000000000000"},
+		{AppendFloat64(nil, -1e-7), "-1e-7"},
+		{AppendFloat64(nil, 1e-6), "0.000001"},
+		{AppendFloat64(nil, math.MaxFloat64), "1.7976931348623157e+308"},
+		{AppendFloat64(nil, 0.1), "0.1"},
+		{AppendFloat32(nil, 1e21), "1e+21"},
+		{AppendFloat32(nil, 0.1), "0.1"},
+		{AppendNil(nil), "null"},
+		{AppendTime(nil, time.Date(2001, 2, 3, 4, 5, 6, 7, time.UTC)), `"2001-02-03T04:05:06.000000007Z"`},
+		{append(AppendExtensionHeader(nil, 9, 3), "raw"...), `{"type":9,"data":"cmF3"}`},
+	}
+	next := AppendString(nil, "next")
+	for i, tt := range tests {
+		out, left, err := AppendJSONFromMsgp([]byte("prefix "), append(tt.in, next...))
+		if err != nil {
+			t.Errorf("test %d: %s", i, err)
+			continue
+		}
+		if got := string(out); got != "prefix "+tt.want {
+			t.Errorf("test %d: got %s; want %s", i, got, tt.want)
+		}
+		if !bytes.Equal(left, next) {
+			t.Errorf("test %d: %x left; want the next object", i, left)
+		}
+	}
+
+	// nested objects
+	msg := AppendMapHeader(nil, 2)
+	msg = AppendString(msg, "a")
+	msg = AppendArrayHeader(msg, 3)
+	msg = AppendInt(msg, 1)
+	msg = AppendMapHeader(msg, 0)
+	msg = AppendArrayHeader(msg, 0)
+	msg = AppendString(msg, "b")
+	msg = AppendBool(msg, false)
+	out, left, err := AppendJSONFromMsgp(nil, msg)
+	if err != nil || len(left) != 0 {
+		t.Fatalf("%s, with %d bytes left", err, len(left))
+	}
+	if got, want := string(out), `{"a":[1,{},[]],"b":false}`; got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
+
+func TestAppendJSONFloats(t *testing.T) {
+	// the same as encoding/json
+	for _, f := range []float64{0, -0.0, 1, -1.5, 1e-6, 9.99e-7, 1e-7, 123456789, 1e20, 1e21, 12345e30, 5e-324} {
+		want, _ := json.Marshal(f)
+		out, _, err := AppendJSONFromMsgp(nil, AppendFloat64(nil, f))
+		if err != nil || string(out) != string(want) {
+			t.Errorf("%g: got %s (%v); want %s", f, out, err, want)
+		}
+		want, _ = json.Marshal(float32(f))
+		out, _, err = AppendJSONFromMsgp(nil, AppendFloat32(nil, float32(f)))
+		if err != nil || string(out) != string(want) {
+			t.Errorf("float32(%g): got %s (%v); want %s", f, out, err, want)
+		}
+	}
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		msg := AppendFloat64(nil, f)
+		if _, left, err := AppendJSONFromMsgp(nil, msg); err != ErrJSONFloat || !bytes.Equal(left, msg) {
+			t.Errorf("%g: got %v, with %x left", f, err, left)
+		}
+	}
+}
+
+func TestAppendJSONLargeBin(t *testing.T) {
+	// base64 is encoded into 'dst'
+	// with no buffer in between
+	data := make([]byte, 1<<20+1)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	msg := AppendBytes(nil, data)
+	want := `"` + base64.StdEncoding.EncodeToString(data) + `"`
+	dst := make([]byte, 0, len(want))
+	allocs := testing.AllocsPerRun(10, func() {
+		out, _, err := AppendJSONFromMsgp(dst, msg)
+		if err != nil || string(out) != want {
+			t.Fatalf("got %d bytes (%v)", len(out), err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("%g allocations", allocs)
+	}
+}
+
+func TestAppendMsgpFromJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{} // as ReadIntfBytes reads it
+	}{
+		{`null`, nil},
+		{` true `, true},
+		{"\t\r\nfalse", false},
+		{`0`, int64(0)},
+		{`-0`, int64(0)},
+		{`-9223372036854775808`, int64(math.MinInt64)},
+		{`9223372036854775807`, int64(math.MaxInt64)},
+		{`18446744073709551615`, uint64(math.MaxUint64)},
+		{`18446744073709551616`, float64(1 << 64)},
+		{`-9223372036854775809`, float64(-1 << 63)},
+		{`1.5`, 1.5},
+		{`-2.5E+3`, -2500.0},
+		{`1e2`, 100.0},
+		{`1e-400`, 0.0},
+		{`""`, ""},
+		{`"a\"\\\/\b\f\n\r\tb"`, "a\"\\/\b\f\n\r\tb"},
+		{`"\u00e9\u00E9\ud83d\ude00"`, "éé😀"},
+		{`"\ud800x\udc00\ud800\u0041"`, "\ufffdx\ufffd\ufffdA"},
+		{"\"é\xff\"", "é\ufffd"},
+		{`[]`, []interface{}{}},
+		{`{}`, map[string]interface{}{}},
+		{`[1, "two", [3], {"four": 4}]`, []interface{}{int64(1), "two", []interface{}{int64(3)}, map[string]interface{}{"four": int64(4)}}},
+		{`{"a" : {"b": [true, null]}, "c\n": -1}`, map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{true, nil}}, "c\n": int64(-1)}},
+	}
+	for _, tt := range tests {
+		out, left, err := AppendMsgpFromJSON([]byte{0xc0}, []byte(tt.in+" 1"))
+		if err != nil {
+			t.Errorf("%s: %s", tt.in, err)
+			continue
+		}
+		if string(left) != "1" {
+			t.Errorf("%s: %q left; want the next value", tt.in, left)
+		}
+		if out[0] != 0xc0 {
+			t.Errorf("%s: 'dst' was overwritten", tt.in)
+		}
+		got, rest, err := ReadIntfBytes(out[1:])
+		if err != nil || len(rest) != 0 {
+			t.Errorf("%s: wrote %x, which reads as %v, with %d bytes left", tt.in, out[1:], err, len(rest))
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v; want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAppendMsgpFromJSONHeaders(t *testing.T) {
+	// headers are as small as AppendMapHeader, AppendArrayHeader
+	// and AppendString write them, whether or not a string has
+	// escapes, so the output is byte for byte what the Append
+	// functions write
+	for _, n := range []int{0, 15, 16, 31, 32, 255, 256, 65534, 65535, 70000} {
+		s := strings.Repeat("x", n)
+		want := AppendString(nil, s)
+		for _, in := range []string{`"` + s + `"`, `"` + strings.Replace(s, "x", `\u0078`, -1) + `"`} {
+			out, _, err := AppendMsgpFromJSON(nil, []byte(in))
+			if err != nil || !bytes.Equal(out, want) {
+				t.Errorf("a string of %d bytes: got %d bytes (%v); want %d", n, len(out), err, len(want))
+			}
+		}
+
+		arr := AppendArrayHeader(nil, uint32(n))
+		obj := AppendMapHeader(nil, uint32(n))
+		var jarr, jobj bytes.Buffer
+		jarr.WriteByte('[')
+		jobj.WriteByte('{')
+		for i := 0; i < n; i++ {
+			if i > 0 {
+				jarr.WriteByte(',')
+				jobj.WriteByte(',')
+			}
+			jarr.WriteString("[]")
+			jobj.WriteString(`"k":0`)
+			arr = AppendArrayHeader(arr, 0)
+			obj = AppendInt(AppendString(obj, "k"), 0)
+		}
+		jarr.WriteByte(']')
+		jobj.WriteByte('}')
+		if out, _, err := AppendMsgpFromJSON(nil, jarr.Bytes()); err != nil || !bytes.Equal(out, arr) {
+			t.Errorf("an array of %d: got %d bytes (%v); want %d", n, len(out), err, len(arr))
+		}
+		if out, _, err := AppendMsgpFromJSON(nil, jobj.Bytes()); err != nil || !bytes.Equal(out, obj) {
+			t.Errorf("an object of %d: got %d bytes (%v); want %d", n, len(out), err, len(obj))
+		}
+	}
+}
+
+func TestAppendMsgpFromJSONErrors(t *testing.T) {
+	tests := []struct {
+		in     string
+		offset int
+	}{
+		{``, 0},
+		{`  `, 2},
+		{`nul`, 3},
+		{`nulL`, 3},
+		{`tru e`, 3},
+		{`x`, 0},
+		{`-`, 1},
+		{`[01]`, 2},
+		{`1.e5`, 2},
+		{`1e`, 2},
+		{`1e+x`, 3},
+		{`1e400`, 0},
+		{`"abc`, 4},
+		{`"ab\`, 4},
+		{`"a\x"`, 3},
+		{`"a\u12"`, 4},
+		{`"\ud800\u12"`, 9},
+		{"\"a\tb\"", 2},
+		{"\"\\n\x01\"", 3},
+		{`[1,]`, 3},
+		{`[1 2]`, 3},
+		{`[`, 1},
+		{`{"a" 1}`, 5},
+		{`{"a":1,}`, 7},
+		{`{1:1}`, 1},
+		{`{"a":1 "b":2}`, 7},
+	}
+	for _, tt := range tests {
+		dst := []byte("dst")
+		out, left, err := AppendMsgpFromJSON(dst, []byte(tt.in))
+		je, ok := err.(JSONError)
+		if !ok {
+			t.Errorf("%q: got error %v; want a JSONError", tt.in, err)
+			continue
+		}
+		if je.Offset != tt.offset {
+			t.Errorf("%q: %s; want offset %d", tt.in, je, tt.offset)
+		}
+		if string(out) != "dst" || string(left) != tt.in {
+			t.Errorf("%q: got %q and %q left", tt.in, out, left)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	in := `{"name":"\u003ctag\u003e \"quoted\"\n","n":[0,-1,18446744073709551615,1.5,1e+21,1e-7],"ok":true,"nil":null,"nested":{"empty":{},"list":[]}}`
+	msg, left, err := AppendMsgpFromJSON(nil, []byte(in))
+	if err != nil || len(left) != 0 {
+		t.Fatalf("%v, with %q left", err, left)
+	}
+	out, rest, err := AppendJSONFromMsgp(nil, msg)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("%v, with %d bytes left", err, len(rest))
+	}
+	if string(out) != in {
+		t.Errorf("got  %s\nwant %s", out, in)
+	}
+}
+
+func TestAppendJSONAllocs(t *testing.T) {
+	js := []byte(`{"a":[1,-2,3.5,"\u00e9\n",true,null],"b":{"c":"` + strings.Repeat("x", 300) + `"}}`)
+	msg := AppendArrayHeader(nil, 3)
+	msg = AppendTimestamp(msg, time.Date(2001, 2, 3, 4, 5, 6, 7, time.UTC))
+	msg, _, err := AppendMsgpFromJSON(msg, js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg = AppendBytes(msg, make([]byte, 100))
+	buf := make([]byte, 0, 4096)
+
+	if allocs := testing.AllocsPerRun(100, func() {
+		if _, _, err := AppendMsgpFromJSON(buf, js); err != nil {
+			t.Fatal(err)
+		}
+	}); allocs != 0 {
+		t.Errorf("AppendMsgpFromJSON: %g allocations", allocs)
+	}
+	if allocs := testing.AllocsPerRun(100, func() {
+		if _, _, err := AppendJSONFromMsgp(buf, msg); err != nil {
+			t.Fatal(err)
+		}
+	}); allocs != 0 {
+		t.Errorf("AppendJSONFromMsgp: %g allocations", allocs)
+	}
+}
+
+func BenchmarkAppendJSONFromMsgp(b *testing.B) {
+	js := []byte(`{"thing_1":"a string object","a_first_map":{"float_a":1,"int_b":-100},"an array":[true,2089]}`)
+	msg, _, err := AppendMsgpFromJSON(nil, js)
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, 0, 256)
+	b.SetBytes(int64(len(js)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		AppendJSONFromMsgp(buf, msg)
+	}
+}
+
+func BenchmarkAppendMsgpFromJSON(b *testing.B) {
+	js := []byte(`{"thing_1":"a string object","a_first_map":{"float_a":1,"int_b":-100},"an array":[true,2089]}`)
+	buf := make([]byte, 0, 256)
+	b.SetBytes(int64(len(js)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		AppendMsgpFromJSON(buf, js)
+	}
+}
@@ -245,7 +245,7 @@ func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, e
 	}
 
 	// if it's time.Time
-	if et == TimeExtension {
+	if et == TimeExtension || et == TimestampExtension {
 		var tm time.Time
 		tm, msg, err = ReadTimeBytes(msg)
 		if err != nil {
@@ -261,7 +261,7 @@ func rwExtensionBytes(w jsWriter, msg []byte, scratch []byte) ([]byte, []byte, e
 
 	// if the extension is registered,
 	// use its canonical JSON form
-	if f, ok := extensionReg[et]; ok {
+	if f, ok := lookupExtension(et); ok {
 		e := f()
 		msg, err = ReadExtensionBytes(msg, e)
 		if err != nil {
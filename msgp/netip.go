@@ -0,0 +1,76 @@
+//go:build go1.18
+// +build go1.18
+
+package msgp
+
+import "net/netip"
+
+// addrBytes returns the bytes of 'a' as
+// (netip.Addr).MarshalBinary returns them
+func addrBytes(a netip.Addr) []byte {
+	switch {
+	case !a.IsValid():
+		return nil
+	case a.Is4():
+		v := a.As4()
+		return v[:]
+	}
+	v := a.As16()
+	return append(v[:], a.Zone()...)
+}
+
+// AddrSize returns the encoded size of 'a'
+func AddrSize(a netip.Addr) int {
+	n := 0
+	switch {
+	case !a.IsValid():
+	case a.Is4():
+		n = 4
+	default:
+		n = 16 + len(a.Zone())
+	}
+	return BytesSize(n)
+}
+
+// AppendAddr appends a netip.Addr to the slice as a
+// 'bin' of the bytes that its MarshalBinary method
+// returns: none for the zero Addr, 4 for an IPv4
+// address, or 16 for an IPv6 address, followed
+// by its zone, if it has one.
+func AppendAddr(b []byte, a netip.Addr) []byte { return AppendBytes(b, addrBytes(a)) }
+
+// WriteAddr writes a netip.Addr as AppendAddr does.
+func (mw *Writer) WriteAddr(a netip.Addr) error { return mw.WriteBytes(addrBytes(a)) }
+
+// addrOf returns the address in 'b'
+func addrOf(b []byte) (a netip.Addr, err error) {
+	err = a.UnmarshalBinary(b)
+	if err != nil {
+		return a, AddressError{Type: "netip.Addr", Reason: err.Error()}
+	}
+	return a, nil
+}
+
+// ReadAddrBytes reads a netip.Addr written by AppendAddr
+// from 'b' and returns it and the remaining bytes. If the
+// 'bin' isn't an address, the error is an AddressError,
+// and the remaining bytes are those after it.
+func ReadAddrBytes(b []byte) (a netip.Addr, o []byte, err error) {
+	var v []byte
+	v, o, err = ReadBytesZC(b)
+	if err != nil {
+		return a, b, err
+	}
+	a, err = addrOf(v)
+	return
+}
+
+// ReadAddr reads a netip.Addr written by WriteAddr.
+// See ReadAddrBytes for the errors.
+func (m *Reader) ReadAddr() (a netip.Addr, err error) {
+	m.scratch, err = m.ReadBytes(m.scratch[:0])
+	if err != nil {
+		return a, err
+	}
+	return addrOf(m.scratch)
+}
@@ -0,0 +1,74 @@
+//go:build go1.18
+// +build go1.18
+
+package msgp
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestAddr(t *testing.T) {
+	for _, a := range []netip.Addr{
+		{},
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("::ffff:192.0.2.1"),
+		netip.MustParseAddr("2001:db8::1"),
+		netip.MustParseAddr("fe80::1%eth0"),
+	} {
+		b := AppendAddr(nil, a)
+		if len(b) != AddrSize(a) {
+			t.Errorf("%v: wrote %d bytes; AddrSize is %d", a, len(b), AddrSize(a))
+		}
+		want, _ := a.MarshalBinary()
+		if v, _, _ := ReadBytesZC(b); !bytes.Equal(v, want) {
+			t.Errorf("%v: wrote %x; MarshalBinary returns %x", a, v, want)
+		}
+		out, left, err := ReadAddrBytes(b)
+		if err != nil {
+			t.Fatalf("%v: %s", a, err)
+		}
+		if len(left) > 0 || out != a {
+			t.Errorf("%v: read back %v, with %d bytes left", a, out, len(left))
+		}
+
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		if err = wr.WriteAddr(a); err != nil {
+			t.Fatal(err)
+		}
+		wr.Flush()
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Errorf("%v: WriteAddr wrote %x; AppendAddr %x", a, buf.Bytes(), b)
+		}
+		out, err = NewReader(&buf).ReadAddr()
+		if err != nil {
+			t.Fatalf("%v: ReadAddr: %s", a, err)
+		}
+		if out != a {
+			t.Errorf("%v: ReadAddr read %v", a, out)
+		}
+	}
+}
+
+func TestAddrErrors(t *testing.T) {
+	next := AppendString(nil, "next")
+	for _, n := range []int{3, 5, 15} {
+		msg := append(AppendBytes(nil, make([]byte, n)), next...)
+		_, left, err := ReadAddrBytes(msg)
+		if _, ok := err.(AddressError); !ok {
+			t.Errorf("%d bytes: got error %v; want an AddressError", n, err)
+		}
+		if !bytes.Equal(left, next) {
+			t.Errorf("%d bytes: %x left; want the next object", n, left)
+		}
+		r := NewReader(bytes.NewReader(msg))
+		if _, err = r.ReadAddr(); err == nil {
+			t.Errorf("%d bytes: ReadAddr read an address", n)
+		}
+		if s, err := r.ReadString(); s != "next" || err != nil {
+			t.Errorf("%d bytes: the reader is at (%q, %v), not the next object", n, s, err)
+		}
+	}
+}
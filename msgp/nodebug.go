@@ -0,0 +1,8 @@
+//go:build !msgp_debug
+// +build !msgp_debug
+
+package msgp
+
+// debug turns on checks for misuse
+// that cost time in normal builds
+const debug = false
@@ -0,0 +1,206 @@
+package msgp
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 is returned when a 'str'
+// isn't valid UTF-8 and DecodeOptions.ValidateUTF8
+// is set.
+var ErrInvalidUTF8 error = &errorString{s: "msgp: 'str' is not valid UTF-8", resumable: true}
+
+// ErrMapKey is returned when a map is read with
+// DecodeOptions.InterfaceKeys set, and one of its
+// keys is a map or array, which can't be a map key.
+var ErrMapKey error = &errorString{s: "msgp: a map or array can't be a map key"}
+
+// DecodeOptions configures a Reader (or the
+// *Opt variants of the []byte API). The zero
+// value of each field is the default behavior.
+type DecodeOptions struct {
+	// MaxElements, if non-zero, is the largest
+	// number of elements allowed in a map or array.
+	MaxElements uint32
+
+	// MaxBytes, if non-zero, is the largest
+	// length allowed for a 'str' or 'bin'. A Reader
+	// also applies it to the data of an extension,
+	// since it has to buffer the whole object.
+	MaxBytes uint32
+
+	// ValidateUTF8 makes reading a 'str' that
+	// isn't valid UTF-8 return ErrInvalidUTF8.
+	ValidateUTF8 bool
+
+	// UnknownExtension is what ReadIntf does with
+	// an extension type that hasn't been registered
+	// with RegisterExtension. The default is KeepUnknown.
+	UnknownExtension ExtensionPolicy
+
+	// InterfaceKeys makes ReadIntf read maps as
+	// map[interface{}]interface{}, so that keys can
+	// be of any type, instead of map[string]interface{},
+	// which only allows 'str' and 'bin' keys. Integer
+	// keys are read as int64, or uint64 if they don't
+	// fit, so a key is the same however it was written.
+	// 'str' and 'bin' keys are read as strings.
+	InterfaceKeys bool
+}
+
+// EncodeOptions configures a Writer (or the
+// *Opt variants of the []byte API). The zero
+// value of each field is the default behavior.
+type EncodeOptions struct {
+	// OldSpec writes only the types in the original
+	// MessagePack spec: strings never use 'str8',
+	// and []byte is written as 'str' instead of 'bin'.
+	// It's followed by the Write methods of a Writer
+	// (and so by EncodeMsg methods generated with
+	// -marshal=false), by Writer.AppendMsg (and so by
+	// the default EncodeMsg methods, whose output it
+	// rewrites), and by AppendIntfOpt. It's not
+	// followed by MarshalMsg methods, the other
+	// Append functions, or Writer.Encode, which
+	// writes what MarshalMsg returns as it is.
+	OldSpec bool
+
+	// LegacyTime writes times as WriteTimeExtension
+	// does, as extension 5 with their location, which
+	// is what this package wrote before it wrote spec
+	// timestamps, and what the original msgp reads.
+	// It's followed by the same methods as OldSpec;
+	// Writer.AppendMsg rewrites each timestamp that
+	// 'fn' appends, which has no location, in UTC.
+	LegacyTime bool
+}
+
+// LimitError is returned when an object is
+// larger than a limit set in DecodeOptions,
+// or, where an int is 32 bits, larger than
+// an int can hold the size of (see maxSize32).
+type LimitError struct {
+	Kind  Type   // the type of the object
+	Size  uint32 // elements (map, array) or bytes (str, bin, ext)
+	Limit uint32 // the limit that was exceeded
+}
+
+// Error implements the error interface
+func (l LimitError) Error() string {
+	return fmt.Sprintf("msgp: %s of size %d exceeds the limit of %d", l.Kind, l.Size, l.Limit)
+}
+
+// Resumable returns false, since only the
+// header of the object has been read.
+func (l LimitError) Resumable() bool { return false }
+
+// checkElems checks the size of a map or array
+func (o *DecodeOptions) checkElems(sz uint32, kind Type) error {
+	if o.MaxElements != 0 && sz > o.MaxElements {
+		return LimitError{Kind: kind, Size: sz, Limit: o.MaxElements}
+	}
+	return nil
+}
+
+// checkBytes checks the length of a str or bin
+func (o *DecodeOptions) checkBytes(sz int, kind Type) error {
+	if o.MaxBytes != 0 && int64(sz) > int64(o.MaxBytes) {
+		return LimitError{Kind: kind, Size: clampUint32(sz), Limit: o.MaxBytes}
+	}
+	return nil
+}
+
+// maxSize32 is the largest length of a str, bin or
+// ext, and number of elements of a map or array, that
+// can be read where an int is 32 bits: sizes, and the
+// objects of a map, which are twice its elements, are
+// added up as ints, which have to hold the sums
+const maxSize32 = 1<<30 - 1
+
+// checkSize checks the length or number of elements
+// 'sz', from the header of an object of type 'kind',
+// before it's converted to an int, which wraps around
+// if it's 32 bits and the size is too big for it
+func checkSize(sz uint32, kind Type) error {
+	if strconv.IntSize == 32 && sz > maxSize32 {
+		return LimitError{Kind: kind, Size: sz, Limit: maxSize32}
+	}
+	return nil
+}
+
+// clampUint32 returns 'n', or math.MaxUint32 if
+// it's more than that, as the Size of a LimitError
+// (an int can be 32 bits, too small to compare)
+func clampUint32(n int) uint32 {
+	if int64(n) > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(n)
+}
+
+// checkUTF8 checks the contents of a str
+func (o *DecodeOptions) checkUTF8(s []byte) error {
+	if o.ValidateUTF8 && !utf8.Valid(s) {
+		return ErrInvalidUTF8
+	}
+	return nil
+}
+
+// checkStr checks both the length and contents of a str
+func (o *DecodeOptions) checkStr(s []byte) error {
+	if err := o.checkBytes(len(s), StrType); err != nil {
+		return err
+	}
+	return o.checkUTF8(s)
+}
+
+// NewReaderWithOptions returns a *Reader
+// that reads from 'r' using the options 'opt'.
+func NewReaderWithOptions(r io.Reader, opt DecodeOptions) *Reader {
+	m := NewReader(r)
+	m.opts = opt
+	return m
+}
+
+// ApplyOptions sets the options used by the
+// reader. Options are kept when the reader is Reset.
+func (m *Reader) ApplyOptions(opt DecodeOptions) { m.opts = opt }
+
+// Options returns the options used by the reader.
+func (m *Reader) Options() DecodeOptions { return m.opts }
+
+// NewWriterWithOptions returns a *Writer
+// that writes to 'w' using the options 'opt'.
+func NewWriterWithOptions(w io.Writer, opt EncodeOptions) *Writer {
+	mw := NewWriter(w)
+	mw.opts = opt
+	return mw
+}
+
+// ApplyOptions sets the options used by the
+// writer. Options are kept when the writer is Reset.
+func (mw *Writer) ApplyOptions(opt EncodeOptions) { mw.opts = opt }
+
+// Options returns the options used by the writer.
+func (mw *Writer) Options() EncodeOptions { return mw.opts }
+
+// ReadIntfBytesOpt is like ReadIntfBytes,
+// but reads using the options 'opt'.
+func ReadIntfBytesOpt(b []byte, opt DecodeOptions) (interface{}, []byte, error) {
+	return readIntfBytes(b, &opt)
+}
+
+// ReadMapStrIntfBytesOpt is like ReadMapStrIntfBytes,
+// but reads using the options 'opt'.
+func ReadMapStrIntfBytesOpt(b []byte, old map[string]interface{}, opt DecodeOptions) (map[string]interface{}, []byte, error) {
+	return readMapStrIntfBytes(b, old, &opt)
+}
+
+// AppendIntfOpt is like AppendIntf,
+// but writes using the options 'opt'.
+func AppendIntfOpt(b []byte, i interface{}, opt EncodeOptions) ([]byte, error) {
+	return appendIntf(b, i, &opt)
+}
@@ -0,0 +1,359 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDecodeOptionsLimits(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	en.WriteArrayHeader(3)
+	en.WriteString("hello")
+	en.WriteBytes([]byte("world!"))
+	en.WriteMapHeader(2)
+	en.WriteString("a")
+	en.WriteNil()
+	en.WriteString("b")
+	en.WriteNil()
+	en.Flush()
+	data := buf.Bytes()
+
+	tests := []struct {
+		opt  DecodeOptions
+		kind Type // of the LimitError, or InvalidType if none
+	}{
+		{DecodeOptions{}, InvalidType},
+		{DecodeOptions{MaxElements: 3, MaxBytes: 6}, InvalidType},
+		{DecodeOptions{MaxElements: 2}, ArrayType},
+		{DecodeOptions{MaxBytes: 4}, StrType},
+		{DecodeOptions{MaxBytes: 5}, BinType},
+	}
+
+	for i, tt := range tests {
+		_, _, berr := ReadIntfBytesOpt(data, tt.opt)
+		rd := NewReaderWithOptions(bytes.NewReader(data), tt.opt)
+		_, rerr := rd.ReadIntf()
+		for _, err := range []error{berr, rerr} {
+			if tt.kind == InvalidType {
+				if err != nil {
+					t.Errorf("test %d: unexpected error: %s", i, err)
+				}
+				continue
+			}
+			le, ok := err.(LimitError)
+			if !ok {
+				t.Errorf("test %d: expected LimitError; got %v", i, err)
+				continue
+			}
+			if le.Kind != tt.kind {
+				t.Errorf("test %d: limit exceeded by %s; want %s", i, le.Kind, tt.kind)
+			}
+			if !IsError(err) {
+				t.Errorf("test %d: expected IsError(%v)", i, err)
+			}
+		}
+	}
+
+	// maps are limited, too
+	var m map[string]interface{}
+	mp := data[len(data)-7:]
+	_, _, err := ReadIntfBytesOpt(mp, DecodeOptions{MaxElements: 1})
+	if le, ok := err.(LimitError); !ok || le.Kind != MapType || le.Size != 2 || le.Limit != 1 {
+		t.Errorf("expected map LimitError; got %v", err)
+	}
+	m, _, err = ReadMapStrIntfBytesOpt(mp, nil, DecodeOptions{MaxElements: 2})
+	if err != nil || len(m) != 2 {
+		t.Errorf("got %v, %v", m, err)
+	}
+
+	// a Reader won't buffer an extension
+	// that's larger than MaxBytes
+	ext := []byte{mext32, 0xbe, 0x55, 0x94, 0x38, 40}
+	rd := NewReaderWithOptions(bytes.NewReader(ext), DecodeOptions{MaxBytes: 64})
+	_, err = rd.ReadIntf()
+	if le, ok := err.(LimitError); !ok || le.Kind != ExtensionType || le.Size != 0xbe559438 {
+		t.Errorf("expected extension LimitError; got %v", err)
+	}
+}
+
+func TestDecodeOptionsUTF8(t *testing.T) {
+	bad := AppendString(nil, "ok\xff")
+	long := AppendString(nil, strings.Repeat("x", 40)+"\xff")
+
+	for _, data := range [][]byte{bad, long} {
+		// off by default
+		if _, _, err := ReadIntfBytes(data); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if _, _, err := ReadIntfBytesOpt(data, DecodeOptions{ValidateUTF8: true}); err != ErrInvalidUTF8 {
+			t.Errorf("expected ErrInvalidUTF8; got %v", err)
+		}
+
+		rd := NewReader(bytes.NewReader(data))
+		rd.ApplyOptions(DecodeOptions{ValidateUTF8: true})
+		if _, err := rd.ReadString(); err != ErrInvalidUTF8 {
+			t.Errorf("expected ErrInvalidUTF8 from ReadString; got %v", err)
+		}
+		rd.Reset(bytes.NewReader(data))
+		if _, err := rd.ReadStringAsBytes(nil); err != ErrInvalidUTF8 {
+			t.Errorf("expected ErrInvalidUTF8 from ReadStringAsBytes; got %v", err)
+		}
+		if !rd.Options().ValidateUTF8 {
+			t.Error("expected options to be kept across Reset")
+		}
+	}
+
+	good := AppendString(nil, "héllo")
+	if _, _, err := ReadIntfBytesOpt(good, DecodeOptions{ValidateUTF8: true}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestEncodeOptionsOldSpec(t *testing.T) {
+	s := strings.Repeat("a", 100)
+	v := map[string]interface{}{"str": s, "bin": []byte("bytes")}
+
+	var buf bytes.Buffer
+	wr := NewWriterWithOptions(&buf, EncodeOptions{OldSpec: true})
+	if err := wr.WriteIntf(v); err != nil {
+		t.Fatal(err)
+	}
+	wr.Flush()
+	app, err := AppendIntfOpt(nil, v, EncodeOptions{OldSpec: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range [][]byte{buf.Bytes(), app} {
+		// there should be no 'str8' or 'bin',
+		// and both values should read as strings
+		out, _, err := ReadMapStrIntfBytes(data, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"str": s, "bin": "bytes"}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("got %v; want %v", out, want)
+		}
+		if bytes.IndexByte(data, mstr8) != -1 {
+			t.Errorf("found a str8 prefix in %x", data)
+		}
+	}
+
+	// the default is unchanged
+	def, _ := AppendIntf(nil, s)
+	if def[0] != mstr8 {
+		t.Errorf("expected a str8 by default; got prefix %x", def[0])
+	}
+}
+
+func TestEncodeOptionsLegacyTime(t *testing.T) {
+	// one of each form of timestamp: 32, 64 and 96-bit
+	times := []time.Time{
+		time.Unix(1433158200, 0).UTC(),
+		time.Unix(1433158200, 123456789).UTC(),
+		time.Date(1960, 1, 2, 3, 4, 5, 6, time.UTC),
+	}
+	var want []byte
+	want = AppendArrayHeader(want, uint32(len(times)))
+	for _, tm := range times {
+		want = AppendTimeExtension(want, tm)
+	}
+	opt := EncodeOptions{LegacyTime: true}
+
+	var buf bytes.Buffer
+	wr := NewWriterWithOptions(&buf, opt)
+	wr.WriteArrayHeader(uint32(len(times)))
+	for _, tm := range times {
+		wr.WriteTime(tm)
+	}
+	wr.Flush()
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("WriteTime: got %x; want %x", buf.Bytes(), want)
+	}
+
+	// the timestamps that AppendTime writes are rewritten
+	buf.Reset()
+	err := wr.AppendMsg(func(b []byte) ([]byte, error) {
+		b = AppendArrayHeader(b, uint32(len(times)))
+		for _, tm := range times {
+			b = AppendTime(b, tm)
+		}
+		return b, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wr.Flush()
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("AppendMsg: got %x; want %x", buf.Bytes(), want)
+	}
+
+	ifs := make([]interface{}, len(times))
+	for i := range times {
+		ifs[i] = times[i]
+	}
+	app, err := AppendIntfOpt(nil, ifs, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(app, want) {
+		t.Errorf("AppendIntfOpt: got %x; want %x", app, want)
+	}
+
+	// the default is unchanged
+	def, _ := AppendIntf(nil, times[0])
+	if !bytes.Equal(def, AppendTimestamp(nil, times[0])) {
+		t.Errorf("expected a timestamp by default; got %x", def)
+	}
+}
+
+func TestOptionsPooled(t *testing.T) {
+	rd := NewReaderWithOptions(bytes.NewReader(nil), DecodeOptions{MaxBytes: 1})
+	FreeR(rd)
+	for i := 0; i < 10; i++ {
+		rd = NewReader(bytes.NewReader(AppendString(nil, "hello")))
+		if _, err := rd.ReadString(); err != nil {
+			t.Fatalf("options leaked through the reader pool: %s", err)
+		}
+		FreeR(rd)
+	}
+}
+
+// TestOptionsIsolation checks that Readers and Writers
+// configured differently don't affect each other when
+// they're used concurrently. Run it with -race.
+func TestOptionsIsolation(t *testing.T) {
+	var payload []byte
+	payload = AppendMapHeader(payload, 2)
+	payload = AppendString(payload, strings.Repeat("k", 40))
+	payload = AppendString(payload, "\xff")
+	payload = AppendString(payload, "ext")
+	payload, _ = AppendExtension(payload, &RawExtension{Type: 78, Data: []byte("x")})
+
+	configs := []struct {
+		enc  EncodeOptions
+		dec  DecodeOptions
+		fail bool // whether decoding should fail
+	}{
+		{},
+		{enc: EncodeOptions{OldSpec: true}},
+		{dec: DecodeOptions{MaxBytes: 8}, fail: true},
+		{dec: DecodeOptions{ValidateUTF8: true}, fail: true},
+		{dec: DecodeOptions{UnknownExtension: ErrorUnknown}, fail: true},
+		{dec: DecodeOptions{UnknownExtension: SkipUnknown}},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := configs[i%len(configs)]
+
+			// the registry can change while others decode
+			RegisterExtension(int8(100+i%8), func() Extension { return new(RawExtension) })
+
+			var buf bytes.Buffer
+			wr := NewWriterWithOptions(&buf, c.enc)
+			wr.WriteString(strings.Repeat("a", 40))
+			wr.Flush()
+			if got := buf.Bytes()[0] == mstr8; got == c.enc.OldSpec {
+				t.Errorf("config %d: wrote prefix %x", i%len(configs), buf.Bytes()[0])
+			}
+			FreeW(wr)
+
+			rd := NewReaderWithOptions(bytes.NewReader(payload), c.dec)
+			v, err := rd.ReadIntf()
+			if (err != nil) != c.fail {
+				t.Errorf("config %d: got %v, %v", i%len(configs), v, err)
+			}
+			_, _, berr := ReadIntfBytesOpt(payload, c.dec)
+			if (berr != nil) != c.fail {
+				t.Errorf("config %d: ReadIntfBytesOpt returned %v", i%len(configs), berr)
+			}
+			FreeR(rd)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestDecodeOptionsInterfaceKeys(t *testing.T) {
+	// int64 keys, which an int can't hold where it's 32 bits
+	in := map[int64]interface{}{}
+	for _, k := range intKeys {
+		in[k] = map[uint8]string{uint8(k): "value"}
+	}
+	want := map[interface{}]interface{}{}
+	for _, k := range intKeys {
+		want[k] = map[interface{}]interface{}{int64(uint8(k)): "value"}
+	}
+	mixed := map[interface{}]interface{}{
+		int64(-3):              "int",
+		uint64(math.MaxUint64): "uint",
+		"str":                  int64(1),
+		false:                  nil,
+		float64(1.5):           []interface{}{"a"},
+	}
+	opt := DecodeOptions{InterfaceKeys: true}
+
+	for i, tt := range []struct {
+		in, want interface{}
+	}{
+		{in, want},
+		{mixed, mixed},
+		{map[string]interface{}{"a": nil}, map[interface{}]interface{}{"a": nil}},
+	} {
+		var buf bytes.Buffer
+		en := NewWriter(&buf)
+		if err := en.WriteIntf(tt.in); err != nil {
+			t.Fatal(err)
+		}
+		en.Flush()
+		b, err := AppendIntf(nil, tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, _, err := ReadIntfBytesOpt(b, opt)
+		if err != nil {
+			t.Fatalf("test case %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("test case %d: got %v from the bytes", i, out)
+		}
+		out, err = NewReaderWithOptions(&buf, opt).ReadIntf()
+		if err != nil {
+			t.Fatalf("test case %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("test case %d: got %v from the Reader", i, out)
+		}
+	}
+
+	// without the option, integer keys are a TypeError
+	b, _ := AppendIntf(nil, in)
+	if _, _, err := ReadIntfBytes(b); err == nil {
+		t.Error("expected an error reading integer keys into a map[string]interface{}")
+	}
+
+	b = AppendMapHeader(nil, 1)
+	b = AppendMapHeader(b, 0)
+	b = AppendNil(b)
+	if _, _, err := ReadIntfBytesOpt(b, opt); err != ErrMapKey {
+		t.Errorf("expected ErrMapKey from the bytes; got %v", err)
+	}
+	if _, err := NewReaderWithOptions(bytes.NewReader(b), opt).ReadIntf(); err != ErrMapKey {
+		t.Errorf("expected ErrMapKey from the Reader; got %v", err)
+	}
+
+	if _, err := AppendIntf(nil, map[float64]string{1: "a"}); err == nil {
+		t.Error("expected an error appending a map with float keys")
+	}
+}
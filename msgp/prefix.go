@@ -0,0 +1,155 @@
+package msgp
+
+// bytespec describes the objects
+// that start with a prefix byte
+type bytespec struct {
+	typ  Type  // InvalidType for unused prefixes
+	size uint8 // bytes in the header; the whole object if lenw is 0
+	lenw uint8 // width of the length field that follows the prefix, if any
+	fixn uint8 // length stored in the prefix (fixstr, fixarray, fixmap)
+	objs uint8 // objects following a fixarray or fixmap header
+}
+
+// specs is indexed by prefix byte. The "length"
+// of an object is a number of bytes (str, bin, ext),
+// elements (array), or key-value pairs (map).
+var specs [256]bytespec
+
+func init() {
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+		switch {
+		case isfixint(b), isnfixint(b):
+			specs[i] = bytespec{typ: IntType, size: 1}
+		case isfixmap(b):
+			specs[i] = bytespec{typ: MapType, size: 1, fixn: rfixmap(b), objs: 2 * rfixmap(b)}
+		case isfixarray(b):
+			specs[i] = bytespec{typ: ArrayType, size: 1, fixn: rfixarray(b), objs: rfixarray(b)}
+		case isfixstr(b):
+			specs[i] = bytespec{typ: StrType, size: 1 + rfixstr(b), fixn: rfixstr(b)}
+		}
+	}
+
+	specs[mnil] = bytespec{typ: NilType, size: 1}
+	specs[mfalse] = bytespec{typ: BoolType, size: 1}
+	specs[mtrue] = bytespec{typ: BoolType, size: 1}
+	specs[mfloat32] = bytespec{typ: Float32Type, size: 5}
+	specs[mfloat64] = bytespec{typ: Float64Type, size: 9}
+	specs[mint8] = bytespec{typ: IntType, size: 2}
+	specs[mint16] = bytespec{typ: IntType, size: 3}
+	specs[mint32] = bytespec{typ: IntType, size: 5}
+	specs[mint64] = bytespec{typ: IntType, size: 9}
+	specs[muint8] = bytespec{typ: UintType, size: 2}
+	specs[muint16] = bytespec{typ: UintType, size: 3}
+	specs[muint32] = bytespec{typ: UintType, size: 5}
+	specs[muint64] = bytespec{typ: UintType, size: 9}
+
+	specs[mstr8] = bytespec{typ: StrType, size: 2, lenw: 1}
+	specs[mstr16] = bytespec{typ: StrType, size: 3, lenw: 2}
+	specs[mstr32] = bytespec{typ: StrType, size: 5, lenw: 4}
+	specs[mbin8] = bytespec{typ: BinType, size: 2, lenw: 1}
+	specs[mbin16] = bytespec{typ: BinType, size: 3, lenw: 2}
+	specs[mbin32] = bytespec{typ: BinType, size: 5, lenw: 4}
+	specs[marray16] = bytespec{typ: ArrayType, size: 3, lenw: 2}
+	specs[marray32] = bytespec{typ: ArrayType, size: 5, lenw: 4}
+	specs[mmap16] = bytespec{typ: MapType, size: 3, lenw: 2}
+	specs[mmap32] = bytespec{typ: MapType, size: 5, lenw: 4}
+
+	// the header of an extension
+	// includes its type byte
+	specs[mfixext1] = bytespec{typ: ExtensionType, size: 3}
+	specs[mfixext2] = bytespec{typ: ExtensionType, size: 4}
+	specs[mfixext4] = bytespec{typ: ExtensionType, size: 6}
+	specs[mfixext8] = bytespec{typ: ExtensionType, size: 10}
+	specs[mfixext16] = bytespec{typ: ExtensionType, size: 18}
+	specs[mext8] = bytespec{typ: ExtensionType, size: 3, lenw: 1}
+	specs[mext16] = bytespec{typ: ExtensionType, size: 4, lenw: 2}
+	specs[mext32] = bytespec{typ: ExtensionType, size: 6, lenw: 4}
+}
+
+// length returns the length of the object
+// whose header is 'b' (len(b) >= s.size)
+func (s *bytespec) length(b []byte) uint32 {
+	switch s.lenw {
+	case 1:
+		return uint32(b[1])
+	case 2:
+		return uint32(big.Uint16(b[1:]))
+	case 4:
+		return big.Uint32(b[1:])
+	default:
+		return uint32(s.fixn)
+	}
+}
+
+// readHeader reads the header of a map or array
+// of type 't' from the start of 'b', and returns
+// the length and the size of the header
+func readHeader(b []byte, t Type) (uint32, int, error) {
+	if len(b) < 1 {
+		return 0, 0, ErrShortBytes
+	}
+	s := &specs[b[0]]
+	if s.typ != t {
+		return 0, 0, TypeError{Method: t, Encoded: s.typ}
+	}
+	if len(b) < int(s.size) {
+		return 0, 0, ErrShortBytes
+	}
+	return s.length(b), int(s.size), nil
+}
+
+// readHeader is readHeader for the next object
+func (m *Reader) readHeader(t Type) (sz uint32, err error) {
+	p, err := m.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	s := &specs[p[0]]
+	if s.typ != t {
+		return 0, TypeError{Method: t, Encoded: s.typ}
+	}
+	if s.size > 1 {
+		p, err = m.r.Peek(int(s.size))
+		if err != nil {
+			return 0, err
+		}
+	}
+	sz = s.length(p)
+	_, err = m.r.Skip(int(s.size))
+	return sz, err
+}
+
+func getType(v byte) Type { return specs[v].typ }
+
+// returns (skip N bytes, skip M objects, error)
+func getSize(b []byte) (int, int, error) {
+	if len(b) < 1 {
+		return 0, 0, ErrShortBytes
+	}
+	s := &specs[b[0]]
+	if s.lenw == 0 {
+		if s.typ == InvalidType {
+			return 0, 0, InvalidPrefixError(b[0])
+		}
+		// the caller checks that the rest
+		// of the object is present
+		return int(s.size), int(s.objs), nil
+	}
+	if len(b) < int(s.size) {
+		return 0, 0, ErrShortBytes
+	}
+	l := s.length(b)
+	if err := checkSize(l, s.typ); err != nil {
+		return 0, 0, err
+	}
+	n := int(l)
+	switch s.typ {
+	case MapType:
+		return int(s.size), 2 * n, nil
+	case ArrayType:
+		return int(s.size), n, nil
+	default:
+		return int(s.size) + n, 0, nil
+	}
+}
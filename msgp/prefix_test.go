@@ -0,0 +1,373 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// oldGetType and oldGetSize are the switch-based
+// classifiers that the prefix table replaced
+
+func oldGetType(v byte) Type {
+
+	// fixed encoding
+	switch {
+	case isfixmap(v):
+		return MapType
+	case isfixarray(v):
+		return ArrayType
+	case isfixint(v), isnfixint(v):
+		return IntType
+	case isfixstr(v):
+		return StrType
+	}
+
+	// var encoding
+	switch v {
+	case mmap16, mmap32:
+		return MapType
+	case marray16, marray32:
+		return ArrayType
+	case mfloat32:
+		return Float32Type
+	case mfloat64:
+		return Float64Type
+	case mint8, mint16, mint32, mint64:
+		return IntType
+	case muint8, muint16, muint32, muint64:
+		return UintType
+	case mfixext1, mfixext2, mfixext4, mfixext8, mfixext16, mext8, mext16, mext32:
+		return ExtensionType
+	case mstr8, mstr16, mstr32:
+		return StrType
+	case mbin8, mbin16, mbin32:
+		return BinType
+	case mnil:
+		return NilType
+	case mfalse, mtrue:
+		return BoolType
+	default:
+		return InvalidType
+	}
+}
+
+func oldGetSize(b []byte) (int, int, error) {
+	if len(b) < 1 {
+		return 0, 0, ErrShortBytes
+	}
+
+	lead := b[0]
+
+	switch {
+	case isfixarray(lead):
+		return 1, int(rfixarray(lead)), nil
+
+	case isfixmap(lead):
+		return 1, 2 * int(rfixmap(lead)), nil
+
+	case isfixstr(lead):
+		return int(rfixstr(lead)) + 1, 0, nil
+
+	case isfixint(lead):
+		return 1, 0, nil
+
+	case isnfixint(lead):
+		return 1, 0, nil
+	}
+
+	switch lead {
+
+	// the following objects
+	// are always the same
+	// number of bytes (including
+	// the leading byte)
+	case mnil, mfalse, mtrue:
+		return 1, 0, nil
+	case mint64, muint64, mfloat64:
+		return 9, 0, nil
+	case mint32, muint32, mfloat32:
+		return 5, 0, nil
+	case mint16, muint16:
+		return 3, 0, nil
+	case mint8, muint8:
+		return 2, 0, nil
+	case mfixext1:
+		return 3, 0, nil
+	case mfixext2:
+		return 4, 0, nil
+	case mfixext4:
+		return 6, 0, nil
+	case mfixext8:
+		return 10, 0, nil
+	case mfixext16:
+		return 18, 0, nil
+
+	// the following objects
+	// need to be skipped N bytes
+	// plus the lead byte and size bytes
+	case mbin8, mstr8:
+		if len(b) < 2 {
+			return 0, 0, ErrShortBytes
+		}
+		return int(uint8(b[1])) + 2, 0, nil
+
+	case mbin16, mstr16:
+		if len(b) < 3 {
+			return 0, 0, ErrShortBytes
+		}
+		return int(big.Uint16(b[1:])) + 3, 0, nil
+
+	case mbin32, mstr32:
+		if len(b) < 5 {
+			return 0, 0, ErrShortBytes
+		}
+		return int(big.Uint32(b[1:])) + 5, 0, nil
+
+	// variable extensions
+	// require 1 extra byte
+	// to skip
+	case mext8:
+		if len(b) < 3 {
+			return 0, 0, ErrShortBytes
+		}
+		return int(uint8(b[1])) + 3, 0, nil
+
+	case mext16:
+		if len(b) < 4 {
+			return 0, 0, ErrShortBytes
+		}
+		return int(big.Uint16(b[1:])) + 4, 0, nil
+
+	case mext32:
+		if len(b) < 6 {
+			return 0, 0, ErrShortBytes
+		}
+		return int(big.Uint32(b[1:])) + 6, 0, nil
+
+	// arrays skip lead byte,
+	// size byte, N objects
+	case marray16:
+		if len(b) < 3 {
+			return 0, 0, ErrShortBytes
+		}
+		return 3, int(big.Uint16(b[1:])), nil
+
+	case marray32:
+		if len(b) < 5 {
+			return 0, 0, ErrShortBytes
+		}
+		return 5, int(big.Uint32(b[1:])), nil
+
+	// maps skip lead byte,
+	// size byte, 2N objects
+	case mmap16:
+		if len(b) < 3 {
+			return 0, 0, ErrShortBytes
+		}
+		return 3, 2 * (int(big.Uint16(b[1:]))), nil
+
+	case mmap32:
+		if len(b) < 5 {
+			return 0, 0, ErrShortBytes
+		}
+		return 5, 2 * (int(big.Uint32(b[1:]))), nil
+
+	default:
+		return 0, 0, InvalidPrefixError(lead)
+
+	}
+}
+
+func TestPrefixTable(t *testing.T) {
+	// a header of every length, with length
+	// fields that aren't all the same byte
+	full := []byte{0, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	for i := 0; i < 256; i++ {
+		lead := byte(i)
+		if got, want := getType(lead), oldGetType(lead); got != want {
+			t.Errorf("prefix %#x: type is %s; was %s", lead, got, want)
+		}
+		full[0] = lead
+		for l := 0; l <= len(full); l++ {
+			b := full[:l]
+			sz, o, err := getSize(b)
+			osz, oo, oerr := oldGetSize(b)
+			if sz != osz || o != oo || err != oerr {
+				t.Errorf("%x: getSize returned (%d, %d, %v); was (%d, %d, %v)", b, sz, o, err, osz, oo, oerr)
+			}
+		}
+	}
+}
+
+func TestReadHeaders(t *testing.T) {
+	// every prefix, followed by enough
+	// bytes for the longest header
+	for i := 0; i < 256; i++ {
+		b := []byte{byte(i), 0, 0x01, 0x02, 0x03}
+		for _, typ := range []Type{MapType, ArrayType} {
+			var bsz, rsz uint32
+			var berr, rerr error
+			if typ == MapType {
+				bsz, _, berr = ReadMapHeaderBytes(b)
+				rsz, rerr = NewReader(bytes.NewReader(b)).ReadMapHeader()
+			} else {
+				bsz, _, berr = ReadArrayHeaderBytes(b)
+				rsz, rerr = NewReader(bytes.NewReader(b)).ReadArrayHeader()
+			}
+			if (getType(b[0]) == typ) != (berr == nil) {
+				t.Errorf("%x: reading %s header returned %v", b, typ, berr)
+			}
+			if bsz != rsz || (berr == nil) != (rerr == nil) {
+				t.Errorf("%x: []byte read (%d, %v); Reader read (%d, %v)", b, bsz, berr, rsz, rerr)
+			}
+		}
+	}
+}
+
+// objectOf returns a whole object that starts with
+// 'lead', with a length of one where it has one, or
+// nil if 'lead' isn't a prefix. Map keys are strings,
+// so that every object can be read with ReadIntf.
+func objectOf(lead byte) []byte {
+	s := &specs[lead]
+	if s.typ == InvalidType {
+		return nil
+	}
+	b := []byte{lead}
+	n := int(s.fixn)
+	if s.lenw > 0 {
+		n = 1
+		b = append(b, make([]byte, s.lenw-1)...)
+		b = append(b, 1)
+	}
+	switch s.typ {
+	case StrType:
+		b = append(b, bytes.Repeat([]byte{'a'}, n)...)
+	case BinType:
+		b = append(b, make([]byte, n)...)
+	case ArrayType:
+		for i := 0; i < n; i++ {
+			b = append(b, 0x01)
+		}
+	case MapType:
+		for i := 0; i < n; i++ {
+			b = append(b, wfixstr(1), 'k', 0x01)
+		}
+	case ExtensionType:
+		// a type that isn't registered
+		b = append(b, 99)
+		if s.lenw == 0 {
+			n = int(s.size) - 2
+		}
+		b = append(b, make([]byte, n)...)
+	default:
+		b = append(b, make([]byte, int(s.size)-1)...)
+	}
+	return b
+}
+
+// TestEveryPrefix reads an object of every prefix in
+// the spec, including those (like 'str8') that aren't
+// written with EncodeOptions.OldSpec, with each of
+// the functions that take any type of object, and
+// checks that the unused prefix is rejected by them.
+func TestEveryPrefix(t *testing.T) {
+	for i := 0; i < 256; i++ {
+		lead := byte(i)
+		b := objectOf(lead)
+		if b == nil {
+			if lead != 0xc1 {
+				t.Errorf("prefix %#x is unused", lead)
+			}
+			b = []byte{lead, 0, 0, 0, 0, 0, 0}
+			if _, err := Skip(b); err != InvalidPrefixError(lead) {
+				t.Errorf("%x: Skip returned %v", b, err)
+			}
+			if err := NewReader(bytes.NewReader(b)).Skip(); err != InvalidPrefixError(lead) {
+				t.Errorf("%x: Reader.Skip returned %v", b, err)
+			}
+			if _, _, err := ReadIntfBytes(b); err != InvalidPrefixError(lead) {
+				t.Errorf("%x: ReadIntfBytes returned %v", b, err)
+			}
+			if _, err := NewReader(bytes.NewReader(b)).ReadIntf(); err != InvalidPrefixError(lead) {
+				t.Errorf("%x: ReadIntf returned %v", b, err)
+			}
+			if _, err := UnmarshalAsJSON(ioutil.Discard, b); err != InvalidPrefixError(lead) {
+				t.Errorf("%x: UnmarshalAsJSON returned %v", b, err)
+			}
+			if _, err := CopyToJSON(ioutil.Discard, bytes.NewReader(b)); err != InvalidPrefixError(lead) {
+				t.Errorf("%x: CopyToJSON returned %v", b, err)
+			}
+			continue
+		}
+
+		if sz, err := Size(b); sz != len(b) || err != nil {
+			t.Errorf("%x: Size returned (%d, %v)", b, sz, err)
+		}
+		if sz, err := NewReader(bytes.NewReader(b)).NextSize(); sz != len(b) || err != nil {
+			t.Errorf("%x: NextSize returned (%d, %v)", b, sz, err)
+		}
+		if o, err := Skip(b); len(o) != 0 || err != nil {
+			t.Errorf("%x: Skip returned (%x, %v)", b, o, err)
+		}
+		if o, _, err := CaptureNextBytes(nil, b); !bytes.Equal(o, b) || err != nil {
+			t.Errorf("%x: CaptureNextBytes returned (%x, %v)", b, o, err)
+		}
+		if _, o, err := ReadIntfBytes(b); len(o) != 0 || err != nil {
+			t.Errorf("%x: ReadIntfBytes returned (%x, %v)", b, o, err)
+		}
+		if o, err := UnmarshalAsJSON(ioutil.Discard, b); len(o) != 0 || err != nil {
+			t.Errorf("%x: UnmarshalAsJSON returned (%x, %v)", b, o, err)
+		}
+		if _, err := CopyToJSON(ioutil.Discard, bytes.NewReader(b)); err != nil {
+			t.Errorf("%x: CopyToJSON returned %v", b, err)
+		}
+
+		for name, read := range map[string]func(*Reader) error{
+			"Skip": (*Reader).Skip,
+			"ReadIntf": func(m *Reader) error {
+				_, err := m.ReadIntf()
+				return err
+			},
+			"CaptureNext": func(m *Reader) error {
+				o, err := m.CaptureNext(nil)
+				if err == nil && !bytes.Equal(o, b) {
+					t.Errorf("%x: CaptureNext returned %x", b, o)
+				}
+				return err
+			},
+		} {
+			m := NewReader(bytes.NewReader(b))
+			if err := read(m); err != nil {
+				t.Errorf("%x: Reader.%s returned %v", b, name, err)
+			}
+			if _, err := m.NextType(); err != io.EOF {
+				t.Errorf("%x: Reader.%s left the reader at %v, not io.EOF", b, name, err)
+			}
+		}
+
+		if getType(lead) != StrType {
+			continue
+		}
+		if _, o, err := ReadStringZC(b); len(o) != 0 || err != nil {
+			t.Errorf("%x: ReadStringZC returned (%x, %v)", b, o, err)
+		}
+		if _, o, err := ReadStringBytes(b); len(o) != 0 || err != nil {
+			t.Errorf("%x: ReadStringBytes returned (%x, %v)", b, o, err)
+		}
+		if _, o, err := ReadMapKeyZC(b); len(o) != 0 || err != nil {
+			t.Errorf("%x: ReadMapKeyZC returned (%x, %v)", b, o, err)
+		}
+		if _, err := NewReader(bytes.NewReader(b)).ReadString(); err != nil {
+			t.Errorf("%x: Reader.ReadString returned %v", b, err)
+		}
+		if _, err := NewReader(bytes.NewReader(b)).ReadStringAsBytes(nil); err != nil {
+			t.Errorf("%x: Reader.ReadStringAsBytes returned %v", b, err)
+		}
+		if _, err := NewReader(bytes.NewReader(b)).ReadMapKey(nil); err != nil {
+			t.Errorf("%x: Reader.ReadMapKey returned %v", b, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package msgp
+
+// Raw is raw MessagePack.
+// Raw allows you to read and write
+// data without interpreting its contents.
+type Raw []byte
+
+// MarshalMsg implements Marshaler. It appends
+// the raw contents of 'r' to the provided
+// byte slice. If 'r' is empty, it appends 'nil'.
+func (r Raw) MarshalMsg(b []byte) ([]byte, error) {
+	if len(r) == 0 {
+		return AppendNil(b), nil
+	}
+	return append(b, []byte(r)...), nil
+}
+
+// UnmarshalMsg implements Unmarshaler.
+// It sets the contents of *Raw to be the next
+// object in the provided byte slice.
+func (r *Raw) UnmarshalMsg(b []byte) ([]byte, error) {
+	l := len(b)
+	out, err := Skip(b)
+	if err != nil {
+		return b, err
+	}
+	rlen := l - len(out)
+	if cap(*r) < rlen {
+		*r = make(Raw, rlen)
+	} else {
+		*r = (*r)[0:rlen]
+	}
+	copy(*r, b[:rlen])
+	return out, nil
+}
+
+// EncodeMsg implements Encodable. It writes
+// the raw bytes to the writer. If r is empty,
+// it writes 'nil' instead.
+func (r Raw) EncodeMsg(w *Writer) error {
+	if len(r) == 0 {
+		return w.WriteNil()
+	}
+	_, err := w.Write([]byte(r))
+	return err
+}
+
+// DecodeMsg implements Decodable.
+// It sets the value of *Raw to be the
+// next object on the wire.
+func (r *Raw) DecodeMsg(f *Reader) error {
+	var err error
+	*r, err = f.appendNext((*r)[:0])
+	return err
+}
+
+// Msgsize implements msgp.Sizer
+func (r Raw) Msgsize() int {
+	l := len(r)
+	if l == 0 {
+		return 1 // for 'nil'
+	}
+	return l
+}
+
+// appendNext appends the raw encoding of
+// the next object on the wire to 'b'
+func (m *Reader) appendNext(b []byte) ([]byte, error) {
+	sz, err := m.NextSize()
+	if err != nil {
+		return b, err
+	}
+	p, err := m.r.Next(sz)
+	if err != nil {
+		return b, err
+	}
+	return append(b, p...), nil
+}
@@ -0,0 +1,67 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestRaw(t *testing.T) {
+	var buf bytes.Buffer
+	en := NewWriter(&buf)
+	en.WriteMapHeader(2)
+	en.WriteString("thing_one")
+	en.WriteString("value_one")
+	en.WriteString("thing_two")
+	en.WriteArrayHeader(3)
+	en.WriteTime(time.Unix(1234, 0))
+	en.WriteFloat64(3.5)
+	en.WriteBytes(RandBytes(1000))
+	en.WriteNil() // trailing object
+	en.Flush()
+
+	in := buf.Bytes()
+
+	// Reader -> Raw
+	var r Raw
+	dc := NewReaderSize(bytes.NewReader(in), 64)
+	err := r.DecodeMsg(dc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte(r), in[:len(in)-1]) {
+		t.Fatal("decoded Raw doesn't match the input")
+	}
+	if !dc.IsNil() {
+		t.Error("expected the reader to be positioned at the trailing nil")
+	}
+
+	// []byte -> Raw
+	var ur Raw
+	left, err := ur.UnmarshalMsg(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte(ur), []byte(r)) || len(left) != 1 {
+		t.Errorf("unmarshaled Raw doesn't match; %d bytes left", len(left))
+	}
+
+	// Raw -> Writer
+	buf.Reset()
+	en.Reset(&buf)
+	err = r.EncodeMsg(en)
+	if err != nil {
+		t.Fatal(err)
+	}
+	en.Flush()
+	if !bytes.Equal(buf.Bytes(), []byte(r)) {
+		t.Error("encoded Raw doesn't match")
+	}
+
+	// empty Raw is 'nil'
+	var empty Raw
+	o, _ := empty.MarshalMsg(nil)
+	if !bytes.Equal(o, []byte{mnil}) || empty.Msgsize() != len(o) {
+		t.Errorf("expected empty Raw to marshal as nil; got %x", o)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"math"
 	"reflect"
+	"strconv"
 	"sync"
 	"time"
 	"unsafe"
@@ -17,19 +18,44 @@ var (
 	readerPool sync.Pool
 )
 
+// maxPrealloc is the largest number of elements
+// that ReadIntf and friends make room for before
+// reading them. Bigger containers grow as their
+// elements are read, so that a header can't make
+// them allocate much more than the message's size.
+const maxPrealloc = 1024
+
+// prealloc returns the number of elements to make
+// room for in a container with 'sz' elements
+func prealloc(sz uint32) int {
+	if sz > maxPrealloc {
+		return maxPrealloc
+	}
+	return int(sz)
+}
+
 // ArrayError is an error returned
 // when decoding a fix-sized array
 // of the wrong size
 type ArrayError struct {
 	Wanted uint32
 	Got    uint32
+
+	// Context is what the array is, such
+	// as "Type.field" in generated code,
+	// if it's known (see ErrorContext)
+	Context string
 }
 
 // Error implements the error interface
 func (a ArrayError) Error() string {
-	return fmt.Sprintf("msgp: wanted array of size %d; got %d", a.Wanted, a.Got)
+	return fmt.Sprintf("msgp: %swanted array of size %d; got %d", contextPrefix(a.Context), a.Wanted, a.Got)
 }
 
+// Resumable returns false, since only
+// the header of the array has been read.
+func (a ArrayError) Resumable() bool { return false }
+
 // Type is a MessagePack wire type,
 // including this package's built-in
 // extension types.
@@ -98,11 +124,50 @@ func (t Type) String() string {
 type TypeError struct {
 	Method  Type // Type expected by method
 	Encoded Type // Type actually encoded
+
+	// Context is what was being decoded, such
+	// as "Type.field" in generated code, if it's
+	// known (see ErrorContext)
+	Context string
 }
 
 // Error implements the error interface
 func (t TypeError) Error() string {
-	return fmt.Sprintf("msgp: attempted to decode type %q with method for %q", t.Encoded, t.Method)
+	return fmt.Sprintf("msgp: %sattempted to decode type %q with method for %q", contextPrefix(t.Context), t.Encoded, t.Method)
+}
+
+// Resumable returns false, since the
+// object hasn't been read.
+func (t TypeError) Resumable() bool { return false }
+
+// ErrorContext returns 'err' with its Context set
+// to 'ctx' if it's an ArrayError or a TypeError
+// without one, and any other error as it is.
+// Generated code uses it to say which field
+// ("Type.field") the error is about.
+func ErrorContext(err error, ctx string) error {
+	switch e := err.(type) {
+	case ArrayError:
+		if e.Context == "" {
+			e.Context = ctx
+			return e
+		}
+	case TypeError:
+		if e.Context == "" {
+			e.Context = ctx
+			return e
+		}
+	}
+	return err
+}
+
+// contextPrefix returns the start of the
+// message of an error with context 'ctx'
+func contextPrefix(ctx string) string {
+	if ctx == "" {
+		return ""
+	}
+	return ctx + ": "
 }
 
 // InvalidPrefixError is returned when a bad encoding
@@ -114,6 +179,10 @@ func (i InvalidPrefixError) Error() string {
 	return fmt.Sprintf("msgp: unrecognized type prefix 0x%x", byte(i))
 }
 
+// Resumable returns false, since there's
+// no telling where the object ends.
+func (i InvalidPrefixError) Resumable() bool { return false }
+
 func init() {
 	readerPool.New = func() interface{} {
 		return &Reader{}
@@ -122,10 +191,7 @@ func init() {
 
 func popReader(r io.Reader) *Reader {
 	p := readerPool.Get().(*Reader)
-	if p.r == nil {
-		p.r = fwd.NewReaderSize(r, 512)
-		return p
-	}
+	p.opts = DecodeOptions{}
 	p.Reset(r)
 	return p
 }
@@ -151,6 +217,13 @@ func FreeR(m *Reader) {
 // UnmarshalMsg unmarshals the object
 // from binary, returing any leftover
 // bytes and any errors encountered.
+//
+// UnmarshalMsg must not modify its input, or
+// keep any references to it once it returns:
+// callers may reuse the buffer right away.
+// The methods written by the generator copy
+// everything they keep, as do the readers in
+// this package other than the *ZC ones.
 type Unmarshaler interface {
 	UnmarshalMsg([]byte) ([]byte, error)
 }
@@ -170,9 +243,54 @@ func Decode(r io.Reader, d Decodable) error {
 	return err
 }
 
+// DecodeInto reads the next object from 'r' into 'v'.
+// A Decodable is decoded with DecodeMsg, and an
+// Unmarshaler is passed the raw object. If 'v' is
+// a *interface{} that holds a (non-nil) Decodable or
+// Unmarshaler, the object is decoded into that value,
+// which is kept; otherwise, the *interface{} is set
+// to the object read by ReadIntf. Anything else,
+// including a nil pointer, is an error.
+func DecodeInto(r *Reader, v interface{}) error {
+	if p, ok := v.(*interface{}); ok && p != nil {
+		switch (*p).(type) {
+		case Decodable, Unmarshaler:
+			if !isNil(*p) {
+				return DecodeInto(r, *p)
+			}
+		}
+		i, err := r.ReadIntf()
+		if err != nil {
+			return err
+		}
+		*p = i
+		return nil
+	}
+	if v == nil {
+		return errors.New("msgp: can't decode into nil")
+	}
+	if isNil(v) {
+		return fmt.Errorf("msgp: can't decode into nil %T", v)
+	}
+	switch v := v.(type) {
+	case Decodable:
+		return v.DecodeMsg(r)
+	case Unmarshaler:
+		raw, err := r.appendNext(nil)
+		if err != nil {
+			return err
+		}
+		_, err = v.UnmarshalMsg(raw)
+		return err
+	default:
+		return fmt.Errorf("msgp: can't decode into %T; it isn't a Decodable, an Unmarshaler or a *interface{}", v)
+	}
+}
+
 // NewReader returns a *Reader that
 // reads from the provided reader. The
-// reader will be buffered.
+// reader will be buffered, unless it's
+// a *bytes.Buffer or *bytes.Reader (see Reset).
 func NewReader(r io.Reader) *Reader {
 	return popReader(r)
 }
@@ -180,17 +298,58 @@ func NewReader(r io.Reader) *Reader {
 // NewReaderSize returns a *Reader with a buffer of the given size.
 // (This is vastly preferable to passing the decoder a reader that is already buffered.)
 func NewReaderSize(r io.Reader, sz int) *Reader {
-	return &Reader{
-		r: fwd.NewReaderSize(r, sz),
-	}
+	m := &Reader{fwd: fwd.NewReaderSize(nil, sz)}
+	m.Reset(r)
+	return m
+}
+
+// NewReaderBytes returns a *Reader that reads
+// from 'b' without copying it. The Reader
+// doesn't modify 'b', but 'b' must not be
+// modified while the Reader is in use.
+func NewReaderBytes(b []byte) *Reader {
+	m := readerPool.Get().(*Reader)
+	m.opts = DecodeOptions{}
+	m.mem = sliceSource{b: b}
+	m.segs = segSource{join: m.segs.join}
+	m.r = &m.mem
+	return m
+}
+
+// NewMultiReaderBytes returns a *Reader that reads
+// from the concatenation of 'segs' without copying
+// them, as NewReaderBytes reads from one slice.
+// Objects may span segments: the few bytes that
+// have to be contiguous to be read, such as a
+// header or a number, or a string, which is read
+// whole, are copied together when they're read
+// across the end of a segment. The segments must
+// not be modified while the Reader is in use.
+func NewMultiReaderBytes(segs ...[]byte) *Reader {
+	m := readerPool.Get().(*Reader)
+	m.opts = DecodeOptions{}
+	m.mem = sliceSource{}
+	m.segs = segSource{segs: append([][]byte(nil), segs...), join: m.segs.join}
+	m.r = &m.segs
+	return m
 }
 
 // Reader wraps an io.Reader and provides
 // methods to read MessagePack-encoded values
 // from it. Readers are buffered.
+//
+// A Reader's methods return io.EOF only if the
+// data ends where the next object would begin.
+// If it ends partway through an object (including
+// between the elements of a map or array that a
+// method reads whole), they return io.ErrUnexpectedEOF.
 type Reader struct {
-	r       *fwd.Reader
-	scratch []byte // recycled []byte for temporary storage
+	r       source        // fwdSource{fwd} or &mem
+	fwd     *fwd.Reader   // buffers an io.Reader
+	mem     sliceSource   // reads from memory
+	segs    segSource     // reads from segments of memory
+	scratch []byte        // recycled []byte for temporary storage
+	opts    DecodeOptions // see ApplyOptions
 }
 
 // Read implements io.Reader
@@ -203,9 +362,29 @@ func (m *Reader) ReadFull(p []byte) (int, error) {
 	return m.r.ReadFull(p)
 }
 
-// Reset resets the underlying reader
+// Reset resets the underlying reader.
+//
+// A *bytes.Buffer or *bytes.Reader isn't buffered:
+// the Reader reads the data they hold in place,
+// without copying it. A *bytes.Buffer is advanced
+// as the Reader goes, so it's in the right place
+// once the Reader is done with it, and it can be
+// written to in the meantime. A *bytes.Reader is
+// read all at once, the way a buffered reader
+// reads ahead. Either way, the data they hold
+// must not be modified while the Reader uses it.
 func (m *Reader) Reset(r io.Reader) {
-	m.r.Reset(r)
+	m.segs = segSource{join: m.segs.join}
+	if m.setSlice(r) {
+		return
+	}
+	m.mem = sliceSource{}
+	if m.fwd == nil {
+		m.fwd = fwd.NewReaderSize(r, 512)
+	} else {
+		m.fwd.Reset(r)
+	}
+	m.r = fwdSource{m.fwd}
 }
 
 // NextType returns the next object type to be decoded.
@@ -228,7 +407,7 @@ func (m *Reader) NextType() (Type, error) {
 			return Complex64Type, nil
 		case Complex128Extension:
 			return Complex128Type, nil
-		case TimeExtension:
+		case TimeExtension, TimestampExtension:
 			return TimeType, nil
 		}
 	}
@@ -247,143 +426,52 @@ func (m *Reader) IsNil() bool {
 
 // returns (obj size, obj elements, error)
 // only maps and arrays have non-zero obj elements
-func getNextSize(r *fwd.Reader) (int, int, error) {
-	var (
-		p   []byte
-		err error
-	)
-	p, err = r.Peek(1)
-	if err != nil {
-		return 0, 0, err
-	}
-	lead := p[0]
-
-	switch {
-	case isfixarray(lead):
-		return 1, int(rfixarray(lead)), nil
-
-	case isfixmap(lead):
-		return 1, 2 * int(rfixmap(lead)), nil
-
-	case isfixstr(lead):
-		return int(rfixstr(lead)) + 1, 0, nil
-
-	case isfixint(lead):
-		return 1, 0, nil
-
-	case isnfixint(lead):
-		return 1, 0, nil
-	}
-
-	switch lead {
-
-	// the following objects
-	// are always the same
-	// number of bytes (including
-	// the leading byte)
-	case mnil, mfalse, mtrue:
-		return 1, 0, nil
-	case mint64, muint64, mfloat64:
-		return 9, 0, nil
-	case mint32, muint32, mfloat32:
-		return 5, 0, nil
-	case mint8, muint8:
-		return 2, 0, nil
-	case mfixext1:
-		return 3, 0, nil
-	case mfixext2:
-		return 4, 0, nil
-	case mfixext4:
-		return 6, 0, nil
-	case mfixext8:
-		return 10, 0, nil
-	case mfixext16:
-		return 18, 0, nil
-
-	// the following objects
-	// need to be skipped N bytes
-	// plus the lead byte and size bytes
-	case mbin8, mstr8:
-		p, err = r.Peek(2)
-		if err != nil {
-			return 0, 0, err
-		}
-		return int(uint8(p[1])) + 2, 0, nil
-
-	case mbin16, mstr16:
-		p, err = r.Peek(3)
-		if err != nil {
-			return 0, 0, err
-		}
-		return int(big.Uint16(p[1:])) + 3, 0, nil
-
-	case mbin32, mstr32:
-		p, err = r.Peek(5)
-		if err != nil {
-			return 0, 0, err
-		}
-		return int(big.Uint32(p[1:])) + 5, 0, nil
-
-	// variable extensions
-	// require 1 extra byte
-	// to skip
-	case mext8:
-		p, err = r.Peek(3)
-		if err != nil {
-			return 0, 0, err
-		}
-		return int(uint8(p[1])) + 3, 0, nil
-
-	case mext16:
-		p, err = r.Peek(4)
-		if err != nil {
-			return 0, 0, err
-		}
-		return int(big.Uint16(p[1:])) + 4, 0, nil
-
-	case mext32:
-		p, err = r.Peek(6)
-		if err != nil {
-			return 0, 0, err
-		}
-		return int(big.Uint32(p[1:])) + 6, 0, nil
+func getNextSize(r source) (int, int, error) {
+	return peekSize(r, 0)
+}
 
-	// arrays skip lead byte,
-	// size byte, N objects
-	case marray16:
-		p, err = r.Peek(3)
+// peekSize is getSize for the object that begins 'off'
+// bytes into the reader. It only peeks as many bytes
+// as are necessary to read the object's header.
+func peekSize(r source, off int) (int, int, error) {
+	for n := 1; ; n++ {
+		p, err := r.Peek(off + n)
 		if err != nil {
 			return 0, 0, err
 		}
-		return 3, int(big.Uint16(p[1:])), nil
-
-	case marray32:
-		p, err = r.Peek(5)
-		if err != nil {
-			return 0, 0, err
+		sz, o, err := getSize(p[off:])
+		// headers are never longer than 6 bytes
+		if err != ErrShortBytes || n == 6 {
+			return sz, o, err
 		}
-		return 5, int(big.Uint32(p[1:])), nil
+	}
+}
 
-	// maps skip lead byte,
-	// size byte, 2N objects
-	case mmap16:
-		p, err = r.Peek(3)
-		if err != nil {
-			return 0, 0, err
-		}
-		return 3, 2 * (int(big.Uint16(p[1:]))), nil
+// NextSize returns the number of bytes occupied by
+// the next object without consuming it. In order to
+// measure a map or array, the reader has to buffer
+// all of its elements except for the contents of the
+// last one, so the reader's buffer may grow to nearly
+// the size of the object.
+func (m *Reader) NextSize() (int, error) {
+	return m.sizeAt(0)
+}
 
-	case mmap32:
-		p, err = r.Peek(5)
+// sizeAt returns the size of the
+// object 'off' bytes into the reader
+func (m *Reader) sizeAt(off int) (int, error) {
+	sz, o, err := peekSize(m.r, off)
+	if err != nil {
+		return 0, err
+	}
+	for x := 0; x < o; x++ {
+		n, err := m.sizeAt(off + sz)
 		if err != nil {
-			return 0, 0, err
+			return 0, err
 		}
-		return 5, 2 * (int(big.Uint32(p[1:]))), nil
-
-	default:
-		return 0, 0, InvalidPrefixError(lead)
-
+		sz += n
 	}
+	return sz, nil
 }
 
 // Skip skips over the next object, regardless of
@@ -406,7 +494,7 @@ func (m *Reader) Skip() error {
 	for x := 0; x < o; x++ {
 		err = m.Skip()
 		if err != nil {
-			return err
+			return noEOF(err)
 		}
 	}
 	return nil
@@ -416,98 +504,149 @@ func (m *Reader) Skip() error {
 // as a map header and returns the size
 // of the map and the number of bytes written.
 // It will return a TypeError{} if the next
-// object is not a map.
+// object is not a map, or a LimitError{} if the
+// map has more elements than the reader allows.
 func (m *Reader) ReadMapHeader() (sz uint32, err error) {
-	var p []byte
-	var lead byte
-	p, err = m.r.Peek(1)
-	if err != nil {
-		return
-	}
-	lead = p[0]
-	if isfixmap(lead) {
-		sz = uint32(rfixmap(lead))
-		_, err = m.r.Skip(1)
-		return
-	}
-	switch lead {
-	case mmap16:
-		p, err = m.r.Peek(3)
-		if err != nil {
-			return
-		}
-		usz := big.Uint16(p[1:])
-		sz = uint32(usz)
-		_, err = m.r.Skip(3)
-		return
-	case mmap32:
-		p, err = m.r.Peek(5)
-		if err != nil {
-			return
-		}
-		sz = big.Uint32(p[1:])
-		_, err = m.r.Skip(5)
-		return
-	default:
-		err = TypeError{Method: MapType, Encoded: getType(lead)}
-		return
+	sz, err = m.readMapHeader()
+	if err == nil {
+		err = m.opts.checkElems(sz, MapType)
 	}
+	return
+}
+
+func (m *Reader) readMapHeader() (sz uint32, err error) {
+	return m.readHeader(MapType)
 }
 
 // ReadMapKey reads either a 'str' or 'bin' field from
 // the reader and returns the value as a []byte. It uses
-// scratch for storage if it is large enough.
+// scratch for storage if it is large enough, so reading
+// keys into the same scratch buffer does not allocate.
 func (m *Reader) ReadMapKey(scratch []byte) ([]byte, error) {
+	p, err := m.r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if getType(p[0]) == BinType {
+		return m.ReadBytes(scratch)
+	}
 	out, err := m.ReadStringAsBytes(scratch)
 	if err != nil {
-		if tperr, ok := err.(TypeError); ok && tperr.Encoded == BinType {
-			return m.ReadBytes(scratch)
-		}
 		return nil, err
 	}
 	return out, nil
 }
 
+// ReadMapKeyInt reads an integer map key. The
+// key may be encoded as either a signed or an
+// unsigned integer. It returns a UintOverflow{}
+// if the key is unsigned and doesn't fit in an int64.
+func (m *Reader) ReadMapKeyInt() (int64, error) {
+	p, err := m.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	if getType(p[0]) != UintType {
+		return m.ReadInt64()
+	}
+	u, err := m.ReadUint64()
+	if err != nil {
+		return 0, err
+	}
+	if u > math.MaxInt64 {
+		return 0, UintOverflow{Value: u, FailedBitsize: 63}
+	}
+	return int64(u), nil
+}
+
+// ReadIntKey reads an integer map key that fits in
+// 'bits' bits (or the size of an int, if 'bits' is 0).
+// Like ReadMapKeyInt, it takes keys encoded as either
+// signed or unsigned integers. It returns an IntOverflow{}
+// or a UintOverflow{} if the key doesn't fit.
+func (m *Reader) ReadIntKey(bits int) (int64, error) {
+	i, err := m.ReadMapKeyInt()
+	if err != nil {
+		return 0, err
+	}
+	return i, checkInt(i, bits)
+}
+
+// ReadUintKey reads an unsigned integer map key that
+// fits in 'bits' bits (or the size of a uint, if 'bits'
+// is 0). The key may be encoded as either a signed or
+// an unsigned integer, but it returns a TypeError{}
+// if the key is negative, and a UintOverflow{} if
+// the key doesn't fit.
+func (m *Reader) ReadUintKey(bits int) (uint64, error) {
+	p, err := m.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	if getType(p[0]) != IntType {
+		u, err := m.ReadUint64()
+		if err != nil {
+			return 0, err
+		}
+		return u, checkUint(u, bits)
+	}
+	i, err := m.ReadInt64()
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		return 0, TypeError{Method: UintType, Encoded: IntType}
+	}
+	return uint64(i), checkUint(uint64(i), bits)
+}
+
 // ReadArrayHeader reads the next object as an
 // array header and returns the size of the array
-// and the number of bytes read.
+// and the number of bytes read. It will return
+// a LimitError{} if the array has more elements
+// than the reader allows.
 func (m *Reader) ReadArrayHeader() (sz uint32, err error) {
-	var lead byte
-	var p []byte
-	p, err = m.r.Peek(1)
+	sz, err = m.readArrayHeader()
+	if err == nil {
+		err = m.opts.checkElems(sz, ArrayType)
+	}
+	return
+}
+
+func (m *Reader) readArrayHeader() (sz uint32, err error) {
+	return m.readHeader(ArrayType)
+}
+
+// ReadArrayHeaderExpect reads the next object as an
+// array header and returns an ArrayError if the size
+// of the array is not 'want'.
+func (m *Reader) ReadArrayHeaderExpect(want uint32) error {
+	sz, err := m.ReadArrayHeader()
 	if err != nil {
-		return
+		return err
 	}
-	lead = p[0]
-	if isfixarray(lead) {
-		sz = uint32(rfixarray(lead))
-		_, err = m.r.Skip(1)
-		return
+	if sz != want {
+		return ArrayError{Wanted: want, Got: sz}
 	}
-	switch lead {
-	case marray16:
-		p, err = m.r.Peek(3)
-		if err != nil {
-			return
-		}
-		usz := big.Uint16(p[1:])
-		sz = uint32(usz)
-		_, err = m.r.Skip(3)
-		return
+	return nil
+}
 
-	case marray32:
-		p, err = m.r.Peek(5)
+// ReadArrayHeaderExpectNil is identical to
+// ReadArrayHeaderExpect, except that a 'nil'
+// object is also accepted and treated as
+// an array of length 0.
+func (m *Reader) ReadArrayHeaderExpectNil(want uint32) error {
+	if m.IsNil() {
+		err := m.ReadNil()
 		if err != nil {
-			return
+			return err
 		}
-		sz = big.Uint32(p[1:])
-		_, err = m.r.Skip(5)
-		return
-
-	default:
-		err = TypeError{Method: ArrayType, Encoded: getType(lead)}
-		return
+		if want != 0 {
+			return ArrayError{Wanted: want, Got: 0}
+		}
+		return nil
 	}
+	return m.ReadArrayHeaderExpect(want)
 }
 
 // ReadNil reads a 'nil' MessagePack byte from the reader
@@ -532,7 +671,7 @@ func (m *Reader) ReadFloat64() (f float64, err error) {
 	if err != nil {
 		// we'll allow a coversion from float32 to float64,
 		// since we don't loose any precision
-		if err == io.EOF && len(p) > 0 && p[0] == mfloat32 {
+		if err == io.ErrUnexpectedEOF && p[0] == mfloat32 {
 			ef, err := m.ReadFloat32()
 			return float64(ef), err
 		}
@@ -686,16 +825,19 @@ func (m *Reader) ReadInt8() (i int8, err error) {
 	return
 }
 
-// ReadInt reads an int from the reader
+// ReadInt reads an int from the reader. It returns
+// an IntOverflow if the value doesn't fit in an int
+// on this platform, as one over 32 bits doesn't
+// on GOARCH=386 or arm.
 func (m *Reader) ReadInt() (i int, err error) {
-	if unsafe.Sizeof(i) == 4 {
-		var in int32
-		in, err = m.ReadInt32()
-		i = int(in)
-		return
-	}
 	var in int64
 	in, err = m.ReadInt64()
+	if err == nil {
+		err = checkInt(in, strconv.IntSize)
+	}
+	if err != nil {
+		return
+	}
 	i = int(in)
 	return
 }
@@ -794,16 +936,18 @@ func (m *Reader) ReadUint8() (u uint8, err error) {
 	return
 }
 
-// ReadUint reads a uint from the reader
+// ReadUint reads a uint from the reader. It returns
+// a UintOverflow if the value doesn't fit in a uint
+// on this platform (see ReadInt).
 func (m *Reader) ReadUint() (u uint, err error) {
-	if unsafe.Sizeof(u) == 4 {
-		var un uint32
-		un, err = m.ReadUint32()
-		u = uint(un)
-		return
-	}
 	var un uint64
 	un, err = m.ReadUint64()
+	if err == nil {
+		err = checkUint(un, strconv.IntSize)
+	}
+	if err != nil {
+		return
+	}
 	u = uint(un)
 	return
 }
@@ -837,12 +981,19 @@ func (m *Reader) ReadBytes(scratch []byte) (b []byte, err error) {
 		if err != nil {
 			return
 		}
-		read = int(big.Uint32(p[1:]))
+		sz := big.Uint32(p[1:])
+		if err = checkSize(sz, BinType); err != nil {
+			return
+		}
+		read = int(sz)
 		off = 5
 	default:
 		err = TypeError{Method: BinType, Encoded: getType(lead)}
 		return
 	}
+	if err = m.opts.checkBytes(read, BinType); err != nil {
+		return
+	}
 	b, err = readN(m, scratch, off, read)
 	return
 }
@@ -885,8 +1036,7 @@ func (m *Reader) ReadStringAsBytes(scratch []byte) (b []byte, err error) {
 	if isfixstr(lead) {
 		read = int(rfixstr(lead))
 		off = 1
-		b, err = readN(m, scratch, off, read)
-		return
+		return m.readStrN(scratch, off, read)
 	}
 
 	switch lead {
@@ -909,14 +1059,29 @@ func (m *Reader) ReadStringAsBytes(scratch []byte) (b []byte, err error) {
 		if err != nil {
 			return
 		}
-		read = int(big.Uint32(p[1:]))
+		sz := big.Uint32(p[1:])
+		if err = checkSize(sz, StrType); err != nil {
+			return
+		}
+		read = int(sz)
 		off = 5
 	default:
 		err = TypeError{Method: StrType, Encoded: getType(lead)}
 		return
 	}
-	b, err = readN(m, scratch, off, read)
-	return
+	return m.readStrN(scratch, off, read)
+}
+
+// readStrN is readN for the body of a 'str'
+func (m *Reader) readStrN(scratch []byte, off int, read int) ([]byte, error) {
+	if err := m.opts.checkBytes(read, StrType); err != nil {
+		return nil, err
+	}
+	b, err := readN(m, scratch, off, read)
+	if err != nil {
+		return b, err
+	}
+	return b, m.opts.checkUTF8(b)
 }
 
 // ReadString reads a utf-8 string from the reader
@@ -937,6 +1102,9 @@ func (m *Reader) ReadString() (s string, err error) {
 		if err != nil {
 			return
 		}
+		if err = m.opts.checkStr(p[1:]); err != nil {
+			return
+		}
 		s = string(p[1:])
 		_, err = m.r.Skip(k)
 		return
@@ -962,17 +1130,27 @@ func (m *Reader) ReadString() (s string, err error) {
 		if err != nil {
 			return
 		}
-		read = int(big.Uint32(p[1:]))
+		sz := big.Uint32(p[1:])
+		if err = checkSize(sz, StrType); err != nil {
+			return
+		}
+		read = int(sz)
 		off = 5
 	default:
 		err = TypeError{Method: StrType, Encoded: getType(lead)}
 		return
 	}
+	if err = m.opts.checkBytes(read, StrType); err != nil {
+		return
+	}
 	k := read + off
 	p, err = m.r.Peek(k)
 	if err != nil {
 		return
 	}
+	if err = m.opts.checkUTF8(p[off:]); err != nil {
+		return
+	}
 	s = string(p[off:])
 	_, err = m.r.Skip(k)
 	return
@@ -1036,20 +1214,83 @@ func (m *Reader) ReadMapStrIntf(mp map[string]interface{}) (err error) {
 		var val interface{}
 		scratch, err = m.ReadMapKey(scratch)
 		if err != nil {
-			return
+			return noEOF(err)
 		}
 		val, err = m.ReadIntf()
 		if err != nil {
-			return
+			return noEOF(err)
 		}
+		// the key is only copied into
+		// a string once the value is stored
 		mp[string(scratch)] = val
 	}
 	return
 }
 
+// readMapIntfIntf reads a map with any
+// keys (see DecodeOptions.InterfaceKeys)
+func (m *Reader) readMapIntfIntf() (map[interface{}]interface{}, error) {
+	sz, err := m.ReadMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	mp := make(map[interface{}]interface{})
+	for i := uint32(0); i < sz; i++ {
+		key, err := m.readIntfKey()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		val, err := m.ReadIntf()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		mp[key] = val
+	}
+	return mp, nil
+}
+
+// readIntfKey reads a key of a
+// map read by readMapIntfIntf
+func (m *Reader) readIntfKey() (interface{}, error) {
+	t, err := m.NextType()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case IntType, UintType:
+		i, err := m.ReadMapKeyInt()
+		if u, ok := err.(UintOverflow); ok {
+			return u.Value, nil
+		}
+		return i, err
+	case StrType, BinType:
+		m.scratch, err = m.ReadMapKey(m.scratch[:0])
+		if err != nil {
+			return nil, err
+		}
+		return string(m.scratch), nil
+	case MapType, ArrayType:
+		return nil, ErrMapKey
+	default:
+		return m.ReadIntf()
+	}
+}
+
 // ReadTime reads a time.Time object from the reader.
+// It reads the timestamps of the MessagePack spec, of
+// any size, which WriteTime writes, in UTC, and the form
+// that WriteTimeExtension writes, with the time's location.
+// See ReadTimeBytes for the errors; after a TimestampError,
+// the whole extension has been read.
 func (m *Reader) ReadTime() (t time.Time, err error) {
 	var p []byte
+	if et, _ := m.peekExtensionType(); et == TimestampExtension {
+		m.scratch, err = m.CaptureNext(m.scratch[:0])
+		if err != nil {
+			return
+		}
+		return timestampOf(m.scratch)
+	}
 	p, err = m.r.Peek(18)
 	if err != nil {
 		return
@@ -1063,9 +1304,10 @@ func (m *Reader) ReadTime() (t time.Time, err error) {
 		err = errExt(int8(p[1]), TimeExtension)
 		return
 	}
-	err = t.UnmarshalBinary(p[2:17]) // wants 15 bytes; last byte is 0
-	if err == nil {
-		_, err = m.r.Skip(18)
+	uerr := t.UnmarshalBinary(p[2:17]) // wants 15 bytes; last byte is 0
+	_, err = m.r.Skip(18)
+	if err == nil && uerr != nil {
+		err = TimestampError{Reason: uerr.Error()}
 	}
 	return
 }
@@ -1078,7 +1320,10 @@ func (m *Reader) ReadIdent(d Decodable) error {
 // ReadIntf reads out the next object as a raw interface{}.
 // Arrays are decoded as []interface{}, and maps are decoded
 // as map[string]interface{}. Integers are decoded as int64
-// and unsigned integers are decoded as uint64.
+// and unsigned integers are decoded as uint64. Nil is
+// decoded as an untyped nil, with no error, and empty
+// maps, arrays and bins as empty, not nil, values, so
+// that WriteIntf writes back what was read.
 func (m *Reader) ReadIntf() (i interface{}, err error) {
 	var t Type
 	t, err = m.NextType()
@@ -1099,7 +1344,9 @@ func (m *Reader) ReadIntf() (i interface{}, err error) {
 		return
 
 	case BinType:
-		i, err = m.ReadBytes(nil)
+		// not nil when it's empty,
+		// which WriteIntf writes as nil
+		i, err = m.ReadBytes([]byte{})
 		return
 
 	case StrType:
@@ -1124,13 +1371,21 @@ func (m *Reader) ReadIntf() (i interface{}, err error) {
 		if err != nil {
 			return
 		}
-		f, ok := extensionReg[t]
+		f, ok := lookupExtension(t)
 		if ok {
 			e := f()
 			err = m.ReadExtension(e)
 			i = e
 			return
 		}
+		switch m.opts.UnknownExtension {
+		case ErrorUnknown:
+			err = UnknownExtensionError{Type: t}
+			return
+		case SkipUnknown:
+			err = m.Skip()
+			return
+		}
 		var e RawExtension
 		e.Type = t
 		err = m.ReadExtension(&e)
@@ -1138,6 +1393,10 @@ func (m *Reader) ReadIntf() (i interface{}, err error) {
 		return
 
 	case MapType:
+		if m.opts.InterfaceKeys {
+			i, err = m.readMapIntfIntf()
+			return
+		}
 		mp := make(map[string]interface{})
 		err = m.ReadMapStrIntf(mp)
 		i = mp
@@ -1163,12 +1422,14 @@ func (m *Reader) ReadIntf() (i interface{}, err error) {
 		if err != nil {
 			return
 		}
-		out := make([]interface{}, int(sz))
-		for j := range out {
-			out[j], err = m.ReadIntf()
+		out := make([]interface{}, 0, prealloc(sz))
+		for j := uint32(0); j < sz; j++ {
+			var v interface{}
+			v, err = m.ReadIntf()
 			if err != nil {
-				return
+				return nil, noEOF(err)
 			}
+			out = append(out, v)
 		}
 		i = out
 		return
@@ -1185,6 +1446,9 @@ func (m *Reader) ReadIntf() (i interface{}, err error) {
 // THIS IS EVIL CODE
 // YOU HAVE BEEN WARNED
 func UnsafeString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
 	return *(*string)(unsafe.Pointer(&reflect.StringHeader{Data: uintptr(unsafe.Pointer(&b[0])), Len: len(b)}))
 }
 
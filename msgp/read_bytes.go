@@ -2,9 +2,9 @@ package msgp
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 	"time"
 	"unsafe"
@@ -14,7 +14,7 @@ var (
 	// ErrShortBytes is returned when the
 	// slice being decoded is too short to
 	// contain the contents of the message
-	ErrShortBytes = errors.New("msgp: too few bytes left to read object")
+	ErrShortBytes error = &errorString{s: "msgp: too few bytes left to read object"}
 )
 
 var big = binary.BigEndian
@@ -29,6 +29,34 @@ func IsNil(b []byte) bool {
 	return false
 }
 
+// NextType returns the type of the next object
+// in 'b', or InvalidType if 'b' is empty or begins
+// with an invalid prefix. Like (*Reader).NextType,
+// it reports the extensions that this package
+// knows about as their own types.
+func NextType(b []byte) Type {
+	if len(b) == 0 {
+		return InvalidType
+	}
+	t := getType(b[0])
+	if t != ExtensionType {
+		return t
+	}
+	v, err := peekExtension(b)
+	if err != nil {
+		return t
+	}
+	switch v {
+	case Complex64Extension:
+		return Complex64Type
+	case Complex128Extension:
+		return Complex128Type
+	case TimeExtension, TimestampExtension:
+		return TimeType
+	}
+	return t
+}
+
 // IsError returns whether or not
 // an error belongs to the msgp package.
 // (This is useful for determining if an
@@ -36,12 +64,14 @@ func IsNil(b []byte) bool {
 // an encoding error.)
 func IsError(err error) bool {
 	if err != nil {
-		if err == ErrShortBytes {
+		if err == ErrShortBytes || err == ErrInvalidUTF8 {
 			return true
 		}
 		switch err.(type) {
 		case IntOverflow, UintOverflow, TypeError,
-			ArrayError, InvalidPrefixError, ExtensionTypeError:
+			ArrayError, InvalidPrefixError, ExtensionTypeError,
+			TransformError, CoerceError, LimitError,
+			UnknownExtensionError:
 			return true
 		default:
 			return strings.HasPrefix(err.Error(), "msgp")
@@ -63,6 +93,10 @@ func (i IntOverflow) Error() string {
 	return fmt.Sprintf("msgp: %d overflows int%d", i.Value, i.FailedBitsize)
 }
 
+// Resumable returns true, since the
+// integer has been read.
+func (i IntOverflow) Resumable() bool { return true }
+
 // UintOverflow is returned when a call
 // would downcast an unsigned integer to a type
 // with too few bits to hold its value
@@ -76,48 +110,22 @@ func (u UintOverflow) Error() string {
 	return fmt.Sprintf("msgp: %d overflows uint%d", u.Value, u.FailedBitsize)
 }
 
+// Resumable returns true, since the
+// integer has been read.
+func (u UintOverflow) Resumable() bool { return true }
+
 // ReadMapHeaderBytes reads a map header size
 // from 'b' and returns the remaining bytes.
 // Possible errors:
 // - ErrShortBytes (too few bytes)
 // - TypeError{} (not a map)
 func ReadMapHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
-	l := len(b)
-	if l < 1 {
-		err = ErrShortBytes
-		return
-	}
-
-	lead := b[0]
-	if isfixmap(lead) {
-		sz = uint32(rfixmap(lead))
-		o = b[1:]
-		return
-	}
-
-	switch lead {
-	case mmap16:
-		if l < 3 {
-			err = ErrShortBytes
-			return
-		}
-		sz = uint32(big.Uint16(b[1:]))
-		o = b[3:]
-		return
-
-	case mmap32:
-		if l < 5 {
-			err = ErrShortBytes
-			return
-		}
-		sz = big.Uint32(b[1:])
-		o = b[5:]
-		return
-
-	default:
-		err = TypeError{Method: MapType, Encoded: getType(lead)}
-		return
+	var n int
+	sz, n, err = readHeader(b, MapType)
+	if err == nil {
+		o = b[n:]
 	}
+	return
 }
 
 // ReadMapKeyZC attempts to read a map key
@@ -126,16 +134,68 @@ func ReadMapHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
 // - ErrShortBytes (too few bytes)
 // - TypeError{} (not a str or bin)
 func ReadMapKeyZC(b []byte) ([]byte, []byte, error) {
+	if len(b) > 0 && getType(b[0]) == BinType {
+		return ReadBytesZC(b)
+	}
 	o, b, err := ReadStringZC(b)
 	if err != nil {
-		if tperr, ok := err.(TypeError); ok && tperr.Encoded == BinType {
-			return ReadBytesZC(b)
-		}
 		return nil, b, err
 	}
 	return o, b, nil
 }
 
+// ReadMapKeyIntBytes reads an integer map key
+// from 'b' and returns the key and the remaining
+// bytes. The key may be encoded as either a
+// signed or an unsigned integer.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not an int or uint)
+// - UintOverflow{} (an unsigned key that doesn't fit in an int64)
+func ReadMapKeyIntBytes(b []byte) (int64, []byte, error) {
+	if len(b) > 0 && getType(b[0]) == UintType {
+		u, o, err := ReadUint64Bytes(b)
+		if err != nil {
+			return 0, o, err
+		}
+		if u > math.MaxInt64 {
+			return 0, o, UintOverflow{Value: u, FailedBitsize: 63}
+		}
+		return int64(u), o, nil
+	}
+	return ReadInt64Bytes(b)
+}
+
+// ReadIntKeyBytes is like ReadIntKey, but reads
+// from 'b' and returns the remaining bytes.
+func ReadIntKeyBytes(b []byte, bits int) (int64, []byte, error) {
+	i, o, err := ReadMapKeyIntBytes(b)
+	if err != nil {
+		return 0, o, err
+	}
+	return i, o, checkInt(i, bits)
+}
+
+// ReadUintKeyBytes is like ReadUintKey, but reads
+// from 'b' and returns the remaining bytes.
+func ReadUintKeyBytes(b []byte, bits int) (uint64, []byte, error) {
+	if len(b) == 0 || getType(b[0]) != IntType {
+		u, o, err := ReadUint64Bytes(b)
+		if err != nil {
+			return 0, o, err
+		}
+		return u, o, checkUint(u, bits)
+	}
+	i, o, err := ReadInt64Bytes(b)
+	if err != nil {
+		return 0, o, err
+	}
+	if i < 0 {
+		return 0, o, TypeError{Method: UintType, Encoded: IntType}
+	}
+	return uint64(i), o, checkUint(uint64(i), bits)
+}
+
 // ReadArrayHeaderBytes attempts to read
 // the array header size off of 'b' and return
 // the size and remaining bytes.
@@ -143,39 +203,44 @@ func ReadMapKeyZC(b []byte) ([]byte, []byte, error) {
 // - ErrShortBytes (too few bytes)
 // - TypeError{} (not an array)
 func ReadArrayHeaderBytes(b []byte) (sz uint32, o []byte, err error) {
-	if len(b) < 1 {
-		return 0, nil, ErrShortBytes
-	}
-	lead := b[0]
-	if isfixarray(lead) {
-		sz = uint32(rfixarray(lead))
-		o = b[1:]
-		return
+	var n int
+	sz, n, err = readHeader(b, ArrayType)
+	if err == nil {
+		o = b[n:]
 	}
+	return
+}
 
-	switch lead {
-	case marray16:
-		if len(b) < 3 {
-			err = ErrShortBytes
-			return
-		}
-		sz = uint32(big.Uint16(b[1:]))
-		o = b[3:]
-		return
+// ReadArrayHeaderBytesExpect reads an array header
+// from 'b' and returns the remaining bytes. It returns
+// an ArrayError if the size of the array is not 'want'.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not an array)
+// - ArrayError{} (wrong size)
+func ReadArrayHeaderBytesExpect(b []byte, want uint32) ([]byte, error) {
+	sz, o, err := ReadArrayHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	if sz != want {
+		return o, ArrayError{Wanted: want, Got: sz}
+	}
+	return o, nil
+}
 
-	case marray32:
-		if len(b) < 5 {
-			err = ErrShortBytes
-			return
+// ReadArrayHeaderBytesExpectNil is identical to
+// ReadArrayHeaderBytesExpect, except that a 'nil'
+// object is also accepted and treated as an array
+// of length 0.
+func ReadArrayHeaderBytesExpectNil(b []byte, want uint32) ([]byte, error) {
+	if IsNil(b) {
+		if want != 0 {
+			return b[1:], ArrayError{Wanted: want, Got: 0}
 		}
-		sz = big.Uint32(b[1:])
-		o = b[5:]
-		return
-
-	default:
-		err = TypeError{Method: ArrayType, Encoded: getType(lead)}
-		return
+		return b[1:], nil
 	}
+	return ReadArrayHeaderBytesExpect(b, want)
 }
 
 // ReadNilBytes tries to read a "nil" byte
@@ -381,15 +446,14 @@ func ReadInt8Bytes(b []byte) (int8, []byte, error) {
 // - TypeError{} (not a int)
 // - IntOverflow{} (value doesn't fit in int; 32-bit platforms only)
 func ReadIntBytes(b []byte) (int, []byte, error) {
-	var v int
 	i, o, err := ReadInt64Bytes(b)
-	if unsafe.Sizeof(v) == 4 {
-		if i > math.MaxInt32 || i < math.MinInt32 {
-			return 0, o, IntOverflow{Value: i, FailedBitsize: 32}
-		}
+	if err == nil {
+		err = checkInt(i, strconv.IntSize)
 	}
-	v = int(i)
-	return v, o, err
+	if err != nil {
+		return 0, o, err
+	}
+	return int(i), o, nil
 }
 
 // ReadUint64Bytes tries to read a uint64
@@ -502,13 +566,14 @@ func ReadUint8Bytes(b []byte) (uint8, []byte, error) {
 // - TypeError{} (not a uint)
 // - UintOverflow{} (value too large for uint; 32-bit platforms only)
 func ReadUintBytes(b []byte) (uint, []byte, error) {
-	var l uint
 	v, o, err := ReadUint64Bytes(b)
-	if unsafe.Sizeof(l) == 4 && v > math.MaxUint32 {
-		return 0, nil, UintOverflow{Value: v, FailedBitsize: 32}
+	if err == nil {
+		err = checkUint(v, strconv.IntSize)
 	}
-	l = uint(v)
-	return l, o, err
+	if err != nil {
+		return 0, o, err
+	}
+	return uint(v), o, nil
 }
 
 // ReadByteBytes is analagous to ReadUint8Bytes
@@ -557,7 +622,11 @@ func readBytesBytes(b []byte, scratch []byte, zc bool) (v []byte, o []byte, err
 			err = ErrShortBytes
 			return
 		}
-		read = int(big.Uint32(b[1:]))
+		sz := big.Uint32(b[1:])
+		if err = checkSize(sz, BinType); err != nil {
+			return
+		}
+		read = int(sz)
 		b = b[5:]
 
 	default:
@@ -638,7 +707,11 @@ func ReadStringZC(b []byte) (v []byte, o []byte, err error) {
 				err = ErrShortBytes
 				return
 			}
-			read = int(big.Uint32(b[1:]))
+			sz := big.Uint32(b[1:])
+			if err = checkSize(sz, StrType); err != nil {
+				return
+			}
+			read = int(sz)
 			b = b[5:]
 
 		default:
@@ -668,6 +741,36 @@ func ReadStringBytes(b []byte) (string, []byte, error) {
 	return string(v), o, err
 }
 
+// readStringBytes is ReadStringBytes
+// using the options 'opt'
+func readStringBytes(b []byte, opt *DecodeOptions) (string, []byte, error) {
+	v, o, err := ReadStringZC(b)
+	if err != nil {
+		return "", o, err
+	}
+	if err = opt.checkStr(v); err != nil {
+		return "", o, err
+	}
+	return string(v), o, nil
+}
+
+// readMapKeyBytes is like ReadMapKeyZC,
+// but it returns a copy of the key and
+// checks it against 'opt'
+func readMapKeyBytes(b []byte, opt *DecodeOptions) (string, []byte, error) {
+	if len(b) > 0 && getType(b[0]) == BinType {
+		v, o, err := ReadBytesZC(b)
+		if err != nil {
+			return "", o, err
+		}
+		if err = opt.checkBytes(len(v), BinType); err != nil {
+			return "", o, err
+		}
+		return string(v), o, nil
+	}
+	return readStringBytes(b, opt)
+}
+
 // ReadComplex128Bytes reads a complex128
 // extension object from 'b' and returns the
 // remaining bytes.
@@ -726,12 +829,28 @@ func ReadComplex64Bytes(b []byte) (c complex64, o []byte, err error) {
 
 // ReadTimeBytes reads a time.Time
 // extension object from 'b' and returns the
-// remaining bytes.
+// remaining bytes. It reads the timestamps of
+// the MessagePack spec, of any size, which
+// AppendTime writes, in UTC, and the form that
+// AppendTimeExtension writes, with the time's
+// location.
 // Possible errors:
 // - ErrShortBytes (not enough bytes in 'b')
-// - TypeError{} (object not a complex64)
+// - TypeError{} (object not a time.Time)
 // - ExtensionTypeError{} (object an extension of the correct size, but not a time.Time)
+// - TimestampError{} (object a timestamp or time extension that doesn't hold a time)
 func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
+	if len(b) > 0 {
+		if et, _ := peekExtension(b); et == TimestampExtension {
+			o, err = Skip(b)
+			if err != nil {
+				return t, b, err
+			}
+			t, err = timestampOf(b[:len(b)-len(o)])
+			return
+		}
+	}
+
 	if len(b) < 18 {
 		err = ErrShortBytes
 		return
@@ -748,7 +867,9 @@ func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
 		return
 	}
 
-	err = t.UnmarshalBinary(b[2:17])
+	if uerr := t.UnmarshalBinary(b[2:17]); uerr != nil {
+		err = TimestampError{Reason: uerr.Error()}
+	}
 	o = b[18:]
 	return
 }
@@ -757,6 +878,10 @@ func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
 // out of 'b' and returns the map and remaining bytes.
 // If 'old' is non-nil, the values will be read into that map.
 func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (v map[string]interface{}, o []byte, err error) {
+	return readMapStrIntfBytes(b, old, &DecodeOptions{})
+}
+
+func readMapStrIntfBytes(b []byte, old map[string]interface{}, opt *DecodeOptions) (v map[string]interface{}, o []byte, err error) {
 	var sz uint32
 	o = b
 	sz, o, err = ReadMapHeaderBytes(o)
@@ -764,6 +889,14 @@ func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (v map[string]int
 	if err != nil {
 		return
 	}
+	if err = opt.checkElems(sz, MapType); err != nil {
+		return
+	}
+	// every key and value is at least one byte
+	if uint64(len(o)) < 2*uint64(sz) {
+		err = ErrShortBytes
+		return
+	}
 
 	if old != nil {
 		for key := range old {
@@ -771,7 +904,7 @@ func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (v map[string]int
 		}
 		v = old
 	} else {
-		v = make(map[string]interface{}, int(sz))
+		v = make(map[string]interface{}, prealloc(sz))
 	}
 
 	for z := uint32(0); z < sz; z++ {
@@ -780,12 +913,12 @@ func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (v map[string]int
 			return
 		}
 		var key string
-		key, o, err = ReadStringBytes(o)
+		key, o, err = readMapKeyBytes(o, opt)
 		if err != nil {
 			return
 		}
 		var val interface{}
-		val, o, err = ReadIntfBytes(o)
+		val, o, err = readIntfBytes(o, opt)
 		if err != nil {
 			return
 		}
@@ -794,10 +927,69 @@ func ReadMapStrIntfBytes(b []byte, old map[string]interface{}) (v map[string]int
 	return
 }
 
+// readMapIntfIntfBytes reads a map with
+// any keys (see DecodeOptions.InterfaceKeys)
+func readMapIntfIntfBytes(b []byte, opt *DecodeOptions) (v map[interface{}]interface{}, o []byte, err error) {
+	var sz uint32
+	sz, o, err = ReadMapHeaderBytes(b)
+	if err != nil {
+		return
+	}
+	if err = opt.checkElems(sz, MapType); err != nil {
+		return
+	}
+	if uint64(len(o)) < 2*uint64(sz) {
+		err = ErrShortBytes
+		return
+	}
+	v = make(map[interface{}]interface{}, prealloc(sz))
+	for z := uint32(0); z < sz; z++ {
+		var key, val interface{}
+		key, o, err = readIntfKeyBytes(o, opt)
+		if err != nil {
+			return
+		}
+		val, o, err = readIntfBytes(o, opt)
+		if err != nil {
+			return
+		}
+		v[key] = val
+	}
+	return
+}
+
+// readIntfKeyBytes reads a key of a
+// map read by readMapIntfIntfBytes
+func readIntfKeyBytes(b []byte, opt *DecodeOptions) (interface{}, []byte, error) {
+	if len(b) < 1 {
+		return nil, b, ErrShortBytes
+	}
+	switch getType(b[0]) {
+	case IntType, UintType:
+		i, o, err := ReadMapKeyIntBytes(b)
+		if u, ok := err.(UintOverflow); ok {
+			return u.Value, o, nil
+		}
+		return i, o, err
+	case StrType, BinType:
+		return readMapKeyBytes(b, opt)
+	case MapType, ArrayType:
+		return nil, b, ErrMapKey
+	default:
+		return readIntfBytes(b, opt)
+	}
+}
+
 // ReadIntfBytes attempts to read
 // the next object out of 'b' as a raw interface{} and
-// return the remaining bytes.
+// return the remaining bytes. Like ReadIntf, it
+// decodes nil as an untyped nil, with no error, and
+// empty containers as empty, not nil, values.
 func ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
+	return readIntfBytes(b, &DecodeOptions{})
+}
+
+func readIntfBytes(b []byte, opt *DecodeOptions) (i interface{}, o []byte, err error) {
 	if len(b) < 1 {
 		err = ErrShortBytes
 		return
@@ -807,23 +999,37 @@ func ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
 
 	switch k {
 	case MapType:
-		i, o, err = ReadMapStrIntfBytes(b, nil)
+		if opt.InterfaceKeys {
+			i, o, err = readMapIntfIntfBytes(b, opt)
+			return
+		}
+		i, o, err = readMapStrIntfBytes(b, nil, opt)
 		return
 
 	case ArrayType:
 		var sz uint32
-		sz, b, err = ReadArrayHeaderBytes(b)
+		sz, o, err = ReadArrayHeaderBytes(b)
 		if err != nil {
 			return
 		}
-		j := make([]interface{}, int(sz))
-		i = j
-		for d := range j {
-			j[d], b, err = ReadIntfBytes(b)
+		if err = opt.checkElems(sz, ArrayType); err != nil {
+			return
+		}
+		// every element is at least one byte
+		if uint64(len(o)) < uint64(sz) {
+			err = ErrShortBytes
+			return
+		}
+		j := make([]interface{}, 0, prealloc(sz))
+		for d := uint32(0); d < sz; d++ {
+			var v interface{}
+			v, o, err = readIntfBytes(o, opt)
 			if err != nil {
 				return
 			}
+			j = append(j, v)
 		}
+		i = j
 		return
 
 	case Float32Type:
@@ -857,7 +1063,7 @@ func ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
 			return
 		}
 		switch t {
-		case TimeExtension:
+		case TimeExtension, TimestampExtension:
 			i, o, err = ReadTimeBytes(b)
 			return
 		case Complex128Extension:
@@ -869,13 +1075,21 @@ func ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
 		}
 		// use a user-defined extension,
 		// if it's been registered
-		f, ok := extensionReg[t]
+		f, ok := lookupExtension(t)
 		if ok {
 			e := f()
 			o, err = ReadExtensionBytes(b, e)
 			i = e
 			return
 		}
+		switch opt.UnknownExtension {
+		case ErrorUnknown:
+			err = UnknownExtensionError{Type: t}
+			return
+		case SkipUnknown:
+			o, err = Skip(b)
+			return
+		}
 		// last resort is a raw extension
 		e := RawExtension{}
 		e.Type = int8(t)
@@ -888,11 +1102,19 @@ func ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
 		return
 
 	case BinType:
-		i, o, err = ReadBytesBytes(b, nil)
+		var v []byte
+		v, o, err = ReadBytesZC(b)
+		if err != nil {
+			return
+		}
+		if err = opt.checkBytes(len(v), BinType); err != nil {
+			return
+		}
+		i = append([]byte{}, v...)
 		return
 
 	case StrType:
-		i, o, err = ReadStringBytes(b)
+		i, o, err = readStringBytes(b, opt)
 		return
 
 	default:
@@ -901,49 +1123,6 @@ func ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
 	}
 }
 
-func getType(v byte) Type {
-
-	// fixed encoding
-	switch {
-	case isfixmap(v):
-		return MapType
-	case isfixarray(v):
-		return ArrayType
-	case isfixint(v), isnfixint(v):
-		return IntType
-	case isfixstr(v):
-		return StrType
-	}
-
-	// var encoding
-	switch v {
-	case mmap16, mmap32:
-		return MapType
-	case marray16, marray32:
-		return ArrayType
-	case mfloat32:
-		return Float32Type
-	case mfloat64:
-		return Float64Type
-	case mint8, mint16, mint32, mint64:
-		return IntType
-	case muint8, muint16, muint32, muint64:
-		return UintType
-	case mfixext1, mfixext2, mfixext4, mfixext8, mfixext16, mext8, mext16, mext32:
-		return ExtensionType
-	case mstr8, mstr16, mstr32:
-		return StrType
-	case mbin8, mbin16, mbin32:
-		return BinType
-	case mnil:
-		return NilType
-	case mfalse, mtrue:
-		return BoolType
-	default:
-		return InvalidType
-	}
-}
-
 // Skip skips the next object in 'b' and
 // returns the remaining bytes. If the object
 // is a map or array, all of its elements
@@ -952,152 +1131,34 @@ func getType(v byte) Type {
 // - ErrShortBytes (not enough bytes in b)
 // - InvalidPrefixError (bad encoding)
 func Skip(b []byte) ([]byte, error) {
-	sz, asz, err := getSize(b)
-	if err != nil {
-		return b, err
-	}
-	b, err = skipN(b, sz)
+	sz, err := Size(b)
 	if err != nil {
 		return b, err
 	}
-	for i := 0; i < asz; i++ {
-		b, err = Skip(b)
-		if err != nil {
-			return b, err
-		}
-	}
-	return b, nil
+	return b[sz:], nil
 }
 
-func skipN(b []byte, n int) ([]byte, error) {
-	if len(b) < n {
-		return nil, ErrShortBytes
-	}
-	return b[n:], nil
-}
-
-// returns (skip N bytes, skip M objects, error)
-func getSize(b []byte) (int, int, error) {
-	if len(b) < 1 {
-		return 0, 0, ErrShortBytes
+// Size returns the number of bytes occupied
+// by the next object in 'b', including all of
+// the elements of a map or array. It does not
+// modify 'b'.
+// Possible Errors:
+// - ErrShortBytes (not enough bytes in b)
+// - InvalidPrefixError (bad encoding)
+func Size(b []byte) (int, error) {
+	sz, asz, err := getSize(b)
+	if err != nil {
+		return 0, err
 	}
-
-	lead := b[0]
-
-	switch {
-	case isfixarray(lead):
-		return 1, int(rfixarray(lead)), nil
-
-	case isfixmap(lead):
-		return 1, 2 * int(rfixmap(lead)), nil
-
-	case isfixstr(lead):
-		return int(rfixstr(lead)) + 1, 0, nil
-
-	case isfixint(lead):
-		return 1, 0, nil
-
-	case isnfixint(lead):
-		return 1, 0, nil
+	if len(b) < sz {
+		return 0, ErrShortBytes
 	}
-
-	switch lead {
-
-	// the following objects
-	// are always the same
-	// number of bytes (including
-	// the leading byte)
-	case mnil, mfalse, mtrue:
-		return 1, 0, nil
-	case mint64, muint64, mfloat64:
-		return 9, 0, nil
-	case mint32, muint32, mfloat32:
-		return 5, 0, nil
-	case mint8, muint8:
-		return 2, 0, nil
-	case mfixext1:
-		return 3, 0, nil
-	case mfixext2:
-		return 4, 0, nil
-	case mfixext4:
-		return 6, 0, nil
-	case mfixext8:
-		return 10, 0, nil
-	case mfixext16:
-		return 18, 0, nil
-
-	// the following objects
-	// need to be skipped N bytes
-	// plus the lead byte and size bytes
-	case mbin8, mstr8:
-		if len(b) < 2 {
-			return 0, 0, ErrShortBytes
-		}
-		return int(uint8(b[1])) + 2, 0, nil
-
-	case mbin16, mstr16:
-		if len(b) < 3 {
-			return 0, 0, ErrShortBytes
-		}
-		return int(big.Uint16(b[1:])) + 3, 0, nil
-
-	case mbin32, mstr32:
-		if len(b) < 5 {
-			return 0, 0, ErrShortBytes
-		}
-		return int(big.Uint32(b[1:])) + 5, 0, nil
-
-	// variable extensions
-	// require 1 extra byte
-	// to skip
-	case mext8:
-		if len(b) < 3 {
-			return 0, 0, ErrShortBytes
-		}
-		return int(uint8(b[1])) + 3, 0, nil
-
-	case mext16:
-		if len(b) < 4 {
-			return 0, 0, ErrShortBytes
-		}
-		return int(big.Uint16(b[1:])) + 4, 0, nil
-
-	case mext32:
-		if len(b) < 6 {
-			return 0, 0, ErrShortBytes
-		}
-		return int(big.Uint32(b[1:])) + 6, 0, nil
-
-	// arrays skip lead byte,
-	// size byte, N objects
-	case marray16:
-		if len(b) < 3 {
-			return 0, 0, ErrShortBytes
-		}
-		return 3, int(big.Uint16(b[1:])), nil
-
-	case marray32:
-		if len(b) < 5 {
-			return 0, 0, ErrShortBytes
-		}
-		return 5, int(big.Uint32(b[1:])), nil
-
-	// maps skip lead byte,
-	// size byte, 2N objects
-	case mmap16:
-		if len(b) < 3 {
-			return 0, 0, ErrShortBytes
-		}
-		return 3, 2 * (int(big.Uint16(b[1:]))), nil
-
-	case mmap32:
-		if len(b) < 5 {
-			return 0, 0, ErrShortBytes
+	for i := 0; i < asz; i++ {
+		n, err := Size(b[sz:])
+		if err != nil {
+			return 0, err
 		}
-		return 5, 2 * (int(big.Uint32(b[1:]))), nil
-
-	default:
-		return 0, 0, InvalidPrefixError(lead)
-
+		sz += n
 	}
+	return sz, nil
 }
@@ -2,6 +2,7 @@ package msgp
 
 import (
 	"bytes"
+	"math"
 	"reflect"
 	"testing"
 	"time"
@@ -33,6 +34,63 @@ func TestReadMapHeaderBytes(t *testing.T) {
 	}
 }
 
+func TestReadMapKeyIntBytes(t *testing.T) {
+	for _, want := range intKeys {
+		encs := [][]byte{AppendInt64(nil, want)}
+		if want >= 0 {
+			encs = append(encs, AppendUint64(nil, uint64(want)))
+		}
+		for _, b := range encs {
+			k, left, err := ReadMapKeyIntBytes(append(b, 0xc0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k != want {
+				t.Errorf("wanted key %d; got %d", want, k)
+			}
+			if len(left) != 1 {
+				t.Errorf("expected 1 byte left; found %d", len(left))
+			}
+		}
+	}
+
+	_, left, err := ReadMapKeyIntBytes(AppendUint64(nil, math.MaxUint64))
+	if uerr, ok := err.(UintOverflow); !ok || uerr.Value != math.MaxUint64 {
+		t.Errorf("expected UintOverflow; got %v", err)
+	}
+	if len(left) != 0 {
+		t.Errorf("expected the key to be consumed; found %d bytes left", len(left))
+	}
+	_, _, err = ReadMapKeyIntBytes(AppendString(nil, "key"))
+	if tperr, ok := err.(TypeError); !ok || tperr.Encoded != StrType {
+		t.Errorf("expected TypeError; got %v", err)
+	}
+	_, _, err = ReadMapKeyIntBytes(nil)
+	if err != ErrShortBytes {
+		t.Errorf("expected ErrShortBytes; got %v", err)
+	}
+}
+
+func TestNextTypeBytes(t *testing.T) {
+	if typ := NextType(nil); typ != InvalidType {
+		t.Errorf("empty input: got %s", typ)
+	}
+	for i, obj := range sizeObjects() {
+		want, err := NewReaderBytes(obj).NextType()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ := NextType(obj); typ != want {
+			t.Errorf("object %d: got %s; want %s", i, typ, want)
+		}
+		// truncated extension headers
+		// mustn't be read past
+		for off := 1; off < len(obj) && off < 8; off++ {
+			NextType(obj[:off])
+		}
+	}
+}
+
 func TestReadArrayHeaderBytes(t *testing.T) {
 	var buf bytes.Buffer
 	en := NewWriter(&buf)
@@ -59,6 +117,42 @@ func TestReadArrayHeaderBytes(t *testing.T) {
 	}
 }
 
+func TestReadArrayHeaderBytesExpect(t *testing.T) {
+	var b []byte
+	b = AppendArrayHeader(b, 3)
+	b = AppendArrayHeader(b, 4)
+	b = AppendNil(b)
+	b = AppendNil(b)
+
+	b, err := ReadArrayHeaderBytesExpect(b, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ReadArrayHeaderBytesExpect(b, 3)
+	if aerr, ok := err.(ArrayError); !ok || aerr.Wanted != 3 || aerr.Got != 4 {
+		t.Errorf("expected ArrayError{3, 4}; got %v", err)
+	}
+	b, err = ReadArrayHeaderBytesExpect(b, 3)
+	if _, ok := err.(TypeError); !ok {
+		t.Errorf("expected TypeError; got %v", err)
+	}
+	b, err = ReadArrayHeaderBytesExpectNil(b, 0)
+	if err != nil {
+		t.Errorf("nil should be read as an array of length 0; got %v", err)
+	}
+	b, err = ReadArrayHeaderBytesExpectNil(b, 2)
+	if aerr, ok := err.(ArrayError); !ok || aerr.Wanted != 2 || aerr.Got != 0 {
+		t.Errorf("expected ArrayError{2, 0}; got %v", err)
+	}
+	if len(b) != 0 {
+		t.Errorf("expected 0 bytes left; found %d", len(b))
+	}
+	_, err = ReadArrayHeaderBytesExpect(b, 0)
+	if err != ErrShortBytes {
+		t.Errorf("expected ErrShortBytes; got %v", err)
+	}
+}
+
 func TestReadNilBytes(t *testing.T) {
 	var buf bytes.Buffer
 	en := NewWriter(&buf)
@@ -352,6 +446,22 @@ func TestReadTimeBytes(t *testing.T) {
 	}
 }
 
+func TestReadIntfBytesHostile(t *testing.T) {
+	const limit = 64 << 10
+	for _, opt := range []DecodeOptions{{}, {InterfaceKeys: true}} {
+		for i, msg := range hostile {
+			var err error
+			n := allocated(func() { _, _, err = ReadIntfBytesOpt(msg, opt) })
+			if err != ErrShortBytes {
+				t.Errorf("message %d: expected %v; got %v", i, ErrShortBytes, err)
+			}
+			if n > limit {
+				t.Errorf("message %d: allocated %d bytes reading %d", i, n, len(msg))
+			}
+		}
+	}
+}
+
 func TestReadIntfBytes(t *testing.T) {
 	var buf bytes.Buffer
 	en := NewWriter(&buf)
@@ -421,3 +531,94 @@ func BenchmarkSkipBytes(b *testing.B) {
 		}
 	}
 }
+
+// sizeObjects returns one encoded object
+// for each family of MessagePack types
+func sizeObjects() [][]byte {
+	ext := func(n int) []byte {
+		o, _ := AppendExtension(nil, &RawExtension{Type: 55, Data: RandBytes(n)})
+		return o
+	}
+	nested := AppendMapHeader(nil, 2)
+	nested = AppendString(nested, "array")
+	nested = AppendArrayHeader(nested, 3)
+	nested = AppendInt64(nested, int64(tint64))
+	nested = AppendMapStrStr(nested, map[string]string{"a": "b", "c": "d"})
+	nested = AppendArrayHeader(nested, 0)
+	nested = AppendString(nested, "ext")
+	nested = append(nested, ext(300)...)
+
+	return [][]byte{
+		AppendNil(nil),
+		AppendBool(nil, true),
+		AppendInt64(nil, -1),
+		AppendInt64(nil, int64(tint8)),
+		AppendInt64(nil, int64(tint16)),
+		AppendInt64(nil, int64(tint32)),
+		AppendInt64(nil, int64(tint64)),
+		AppendUint64(nil, 1),
+		AppendUint64(nil, uint64(tuint16)),
+		AppendUint64(nil, uint64(tuint32)),
+		AppendUint64(nil, tuint64),
+		AppendFloat32(nil, 3.5),
+		AppendFloat64(nil, 3.5),
+		AppendString(nil, "fixstr"),
+		AppendString(nil, string(RandBytes(200))),
+		AppendString(nil, string(RandBytes(1000))),
+		AppendString(nil, string(RandBytes(70000))),
+		AppendBytes(nil, RandBytes(10)),
+		AppendBytes(nil, RandBytes(1000)),
+		AppendBytes(nil, RandBytes(70000)),
+		ext(0), ext(1), ext(2), ext(4), ext(8), ext(16),
+		ext(3), ext(300), ext(70000),
+		AppendComplex64(nil, complex(1, 2)),
+		AppendComplex128(nil, complex(1, 2)),
+		AppendTime(nil, time.Now()),
+		AppendArrayHeader(nil, 0),
+		AppendMapHeader(nil, 0),
+		append(AppendArrayHeader(nil, 20), bytes.Repeat([]byte{mnil}, 20)...),
+		append(AppendMapHeader(nil, 20), bytes.Repeat([]byte{mnil}, 40)...),
+		nested,
+	}
+}
+
+func TestSize(t *testing.T) {
+	for i, obj := range sizeObjects() {
+		trailing := append(append([]byte{}, obj...), mnil)
+		sz, err := Size(trailing)
+		if err != nil {
+			t.Errorf("object %d: %s", i, err)
+			continue
+		}
+		if sz != len(obj) {
+			t.Errorf("object %d: got size %d; want %d", i, sz, len(obj))
+		}
+		if len(trailing) != len(obj)+1 {
+			t.Errorf("object %d: Size modified its input", i)
+		}
+
+		left, err := Skip(trailing)
+		if err != nil {
+			t.Errorf("object %d: %s", i, err)
+		}
+		if len(left) != 1 {
+			t.Errorf("object %d: Skip left %d bytes; want 1", i, len(left))
+		}
+
+		// every truncation is an error
+		for _, n := range []int{0, 1, len(obj) / 2, len(obj) - 1} {
+			if n >= len(obj) {
+				continue
+			}
+			_, err = Size(obj[:n])
+			if err != ErrShortBytes {
+				t.Errorf("object %d truncated to %d bytes: expected ErrShortBytes; got %v", i, n, err)
+			}
+		}
+	}
+
+	_, err := Size([]byte{0xc1})
+	if _, ok := err.(InvalidPrefixError); !ok {
+		t.Errorf("expected InvalidPrefixError; got %v", err)
+	}
+}
@@ -2,11 +2,14 @@ package msgp
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"math"
 	"math/rand"
 	"reflect"
+	"runtime"
 	"testing"
+	"testing/iotest"
 	"time"
 )
 
@@ -28,7 +31,7 @@ func TestReadIntf(t *testing.T) {
 		float32(9082.092),
 		int64(-40),
 		uint64(9082981),
-		time.Now(),
+		time.Now().UTC(), // which is read without a monotonic clock or zone
 		"hello!",
 		[]byte("hello!"),
 		map[string]interface{}{
@@ -66,6 +69,119 @@ func TestReadIntf(t *testing.T) {
 
 }
 
+// allocated returns the number of
+// bytes allocated while running f
+func allocated(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// hostile are messages with containers that claim
+// many more elements than the messages hold
+var hostile = [][]byte{
+	{marray32, 0x01, 0x00, 0x00, 0x00, mnil, mnil, mnil},
+	{mmap32, 0x01, 0x00, 0x00, 0x00, 0xa1, 'a', mnil},
+	{mfixarray | 1, marray32, 0x01, 0x00, 0x00, 0x00, mnil},
+	{mfixmap | 1, 0xa1, 'a', mmap32, 0x01, 0x00, 0x00, 0x00, 0xa1, 'b', mnil},
+}
+
+// TestReadIntfHostile checks that the memory ReadIntf
+// allocates depends on the length of the message,
+// and not on the sizes its headers claim
+func TestReadIntfHostile(t *testing.T) {
+	const limit = 64 << 10
+	for _, opt := range []DecodeOptions{{}, {InterfaceKeys: true}} {
+		for i, msg := range hostile {
+			rd := NewReaderWithOptions(bytes.NewReader(msg), opt)
+			var err error
+			n := allocated(func() { _, err = rd.ReadIntf() })
+			if err != io.ErrUnexpectedEOF {
+				t.Errorf("message %d: expected %v; got %v", i, io.ErrUnexpectedEOF, err)
+			}
+			if n > limit {
+				t.Errorf("message %d: allocated %d bytes reading %d", i, n, len(msg))
+			}
+		}
+	}
+}
+
+// unmarshalOnly is an Unmarshaler,
+// but not a Decodable
+type unmarshalOnly struct{ s string }
+
+func (u *unmarshalOnly) UnmarshalMsg(b []byte) ([]byte, error) {
+	var err error
+	u.s, b, err = ReadStringBytes(b)
+	return b, err
+}
+
+func TestDecodeInto(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	wr.WriteString("decodable")
+	wr.WriteString("unmarshaler")
+	wr.WriteString("in place")
+	wr.WriteMapHeader(1)
+	wr.WriteString("replaced")
+	wr.WriteInt64(1)
+	wr.WriteString("left over")
+	wr.Flush()
+	rd := NewReader(&buf)
+
+	// Decodable
+	raw := new(Raw)
+	if err := DecodeInto(rd, raw); err != nil {
+		t.Fatal(err)
+	}
+	if want := AppendString(nil, "decodable"); !bytes.Equal(*raw, want) {
+		t.Errorf("decoded %x into the Raw; expected %x", *raw, want)
+	}
+
+	// Unmarshaler
+	u := new(unmarshalOnly)
+	if err := DecodeInto(rd, u); err != nil {
+		t.Fatal(err)
+	}
+	if u.s != "unmarshaler" {
+		t.Errorf("decoded %q into the Unmarshaler", u.s)
+	}
+
+	// *interface{} holding a Decodable
+	var v interface{} = raw
+	if err := DecodeInto(rd, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v != interface{}(raw) {
+		t.Errorf("the value in the interface was replaced with %#v", v)
+	}
+	if want := AppendString(nil, "in place"); !bytes.Equal(*raw, want) {
+		t.Errorf("decoded %x into the Raw; expected %x", *raw, want)
+	}
+
+	// *interface{} holding anything else
+	var w interface{} = "not decodable"
+	if err := DecodeInto(rd, &w); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"replaced": int64(1)}; !reflect.DeepEqual(w, want) {
+		t.Errorf("decoded %#v into the interface; expected %#v", w, want)
+	}
+
+	// errors, which don't read anything
+	var nilIntf *interface{}
+	for _, dst := range []interface{}{nil, "string", map[string]interface{}{}, (*Raw)(nil), (*unmarshalOnly)(nil), nilIntf} {
+		if err := DecodeInto(rd, dst); err == nil {
+			t.Errorf("no error decoding into %#v", dst)
+		}
+	}
+	if s, err := rd.ReadString(); err != nil || s != "left over" {
+		t.Errorf("read %q, %v after the errors", s, err)
+	}
+}
+
 func TestReadMapHeader(t *testing.T) {
 	tests := []struct {
 		Sz uint32
@@ -101,6 +217,150 @@ func TestReadMapHeader(t *testing.T) {
 	}
 }
 
+func TestReadMapKey(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			wr.WriteString(fmt.Sprintf("key_%d", i))
+		} else {
+			wr.WriteBytes([]byte(fmt.Sprintf("key_%d", i)))
+		}
+	}
+	wr.Flush()
+	bts := buf.Bytes()
+
+	brd := bytes.NewReader(bts)
+	rd := NewReader(brd)
+	scratch := make([]byte, 0, 32)
+	allocs := testing.AllocsPerRun(10, func() {
+		brd.Seek(0, 0)
+		rd.Reset(brd)
+		for i := 0; i < 1000; i++ {
+			var err error
+			scratch, err = rd.ReadMapKey(scratch)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("reading 1000 keys caused %v allocations", allocs)
+	}
+	if string(scratch) != "key_999" {
+		t.Errorf("expected last key to be \"key_999\"; got %q", scratch)
+	}
+
+	// non-key types are still an error
+	buf.Reset()
+	wr.WriteInt(3)
+	wr.Flush()
+	rd.Reset(&buf)
+	_, err := rd.ReadMapKey(scratch)
+	if tperr, ok := err.(TypeError); !ok || tperr.Encoded != IntType {
+		t.Errorf("expected TypeError; got %v", err)
+	}
+}
+
+// intKeys are map keys on either side of
+// the edges of the fixint and int8 encodings
+var intKeys = []int64{0, 1, 127, 128, 255, 256, -1, -32, -33, -128, -129, math.MaxInt64, math.MinInt64}
+
+func TestReadMapKeyInt(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	wr.WriteMapHeader(uint32(len(intKeys)))
+	for _, k := range intKeys {
+		wr.WriteInt64(k)
+		wr.WriteString("value")
+	}
+	// keys written as uints read the same
+	wr.WriteMapHeader(uint32(len(intKeys)))
+	for _, k := range intKeys {
+		if k >= 0 {
+			wr.WriteUint64(uint64(k))
+		} else {
+			wr.WriteInt64(k)
+		}
+		wr.WriteString("value")
+	}
+	wr.Flush()
+
+	rd := NewReader(&buf)
+	for i := 0; i < 2; i++ {
+		sz, err := rd.ReadMapHeader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sz != uint32(len(intKeys)) {
+			t.Fatalf("expected %d keys; got %d", len(intKeys), sz)
+		}
+		for _, want := range intKeys {
+			k, err := rd.ReadMapKeyInt()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k != want {
+				t.Errorf("wanted key %d; got %d", want, k)
+			}
+			if err = rd.Skip(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	buf.Reset()
+	wr.WriteUint64(math.MaxInt64 + 1)
+	wr.WriteString("key")
+	wr.Flush()
+	_, err := rd.ReadMapKeyInt()
+	if uerr, ok := err.(UintOverflow); !ok || uerr.Value != math.MaxInt64+1 {
+		t.Errorf("expected UintOverflow; got %v", err)
+	}
+	_, err = rd.ReadMapKeyInt()
+	if tperr, ok := err.(TypeError); !ok || tperr.Encoded != StrType {
+		t.Errorf("expected TypeError; got %v", err)
+	}
+}
+
+func TestReadIntKey(t *testing.T) {
+	tests := []struct {
+		enc  []byte
+		bits int
+		ikey int64
+		ierr bool
+		ukey uint64
+		uerr bool
+	}{
+		{AppendInt8(nil, 5), 8, 5, false, 5, false},
+		{AppendUint8(nil, 5), 8, 5, false, 5, false},
+		{AppendInt64(nil, -5), 8, -5, false, 0, true},
+		{AppendUint16(nil, 200), 8, 0, true, 200, false},
+		{AppendUint16(nil, 300), 8, 0, true, 0, true},
+		{AppendInt64(nil, -129), 8, 0, true, 0, true},
+		{AppendUint64(nil, math.MaxUint64), 64, 0, true, math.MaxUint64, false},
+		{AppendInt64(nil, math.MinInt64), 64, math.MinInt64, false, 0, true},
+		{AppendString(nil, "5"), 64, 0, true, 0, true},
+	}
+	for i, tt := range tests {
+		k, err := NewReaderBytes(tt.enc).ReadIntKey(tt.bits)
+		kb, left, errb := ReadIntKeyBytes(tt.enc, tt.bits)
+		if (err != nil) != tt.ierr || (errb != nil) != tt.ierr {
+			t.Errorf("test %d: ReadIntKey: got errors %v, %v", i, err, errb)
+		} else if !tt.ierr && (k != tt.ikey || kb != tt.ikey || len(left) != 0) {
+			t.Errorf("test %d: ReadIntKey: got %d, %d", i, k, kb)
+		}
+
+		u, err := NewReaderBytes(tt.enc).ReadUintKey(tt.bits)
+		ub, left, errb := ReadUintKeyBytes(tt.enc, tt.bits)
+		if (err != nil) != tt.uerr || (errb != nil) != tt.uerr {
+			t.Errorf("test %d: ReadUintKey: got errors %v, %v", i, err, errb)
+		} else if !tt.uerr && (u != tt.ukey || ub != tt.ukey || len(left) != 0) {
+			t.Errorf("test %d: ReadUintKey: got %d, %d", i, u, ub)
+		}
+	}
+}
+
 func TestReadArrayHeader(t *testing.T) {
 	tests := []struct {
 		Sz uint32
@@ -136,6 +396,66 @@ func TestReadArrayHeader(t *testing.T) {
 	}
 }
 
+func TestReadArrayHeaderExpect(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	rd := NewReader(&buf)
+
+	wr.WriteArrayHeader(3)
+	wr.WriteArrayHeader(4)
+	wr.WriteNil()
+	wr.WriteNil()
+	wr.Flush()
+
+	err := rd.ReadArrayHeaderExpect(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rd.ReadArrayHeaderExpect(3)
+	if aerr, ok := err.(ArrayError); !ok || aerr.Wanted != 3 || aerr.Got != 4 {
+		t.Errorf("expected ArrayError{3, 4}; got %v", err)
+	}
+	err = rd.ReadArrayHeaderExpect(3)
+	if _, ok := err.(TypeError); !ok {
+		t.Errorf("expected TypeError; got %v", err)
+	}
+	err = rd.ReadArrayHeaderExpectNil(0)
+	if err != nil {
+		t.Errorf("nil should be read as an array of length 0; got %v", err)
+	}
+	err = rd.ReadArrayHeaderExpectNil(2)
+	if aerr, ok := err.(ArrayError); !ok || aerr.Wanted != 2 || aerr.Got != 0 {
+		t.Errorf("expected ArrayError{2, 0}; got %v", err)
+	}
+}
+
+func TestErrorContext(t *testing.T) {
+	tests := []struct {
+		in, out error
+		msg     string
+	}{
+		{ArrayError{Wanted: 3, Got: 4}, ArrayError{Wanted: 3, Got: 4, Context: "T.arr"},
+			"msgp: T.arr: wanted array of size 3; got 4"},
+		{TypeError{Method: StrType, Encoded: IntType}, TypeError{Method: StrType, Encoded: IntType, Context: "T.arr"},
+			`msgp: T.arr: attempted to decode type "int" with method for "str"`},
+		// the context that's there is kept
+		{ArrayError{Wanted: 1, Context: "U.x"}, ArrayError{Wanted: 1, Context: "U.x"},
+			"msgp: U.x: wanted array of size 1; got 0"},
+		// other errors are as they are
+		{ErrShortBytes, ErrShortBytes, ErrShortBytes.Error()},
+	}
+	for _, tt := range tests {
+		err := ErrorContext(tt.in, "T.arr")
+		if err != tt.out || err.Error() != tt.msg {
+			t.Errorf("ErrorContext(%#v) = %#v (%q); want %q", tt.in, err, err, tt.msg)
+		}
+	}
+	// without a context, the message is as it was
+	if msg := (ArrayError{Wanted: 3, Got: 4}).Error(); msg != "msgp: wanted array of size 3; got 4" {
+		t.Errorf("got %q", msg)
+	}
+}
+
 func TestReadNil(t *testing.T) {
 	var buf bytes.Buffer
 	wr := NewWriter(&buf)
@@ -431,6 +751,149 @@ func TestSkip(t *testing.T) {
 
 }
 
+// truncReaders are the ways a
+// Reader can get at its data
+var truncReaders = map[string]func(b []byte) *Reader{
+	"buffered":     func(b []byte) *Reader { return NewReader(plainReader{bytes.NewReader(b)}) },
+	"onebyte":      func(b []byte) *Reader { return NewReader(iotest.OneByteReader(bytes.NewReader(b))) },
+	"bytes.Reader": func(b []byte) *Reader { return NewReader(bytes.NewReader(b)) },
+	"slice":        func(b []byte) *Reader { return NewReaderBytes(b) },
+}
+
+// truncMethods returns the methods
+// that can read an object of type 't'
+func truncMethods(t Type) map[string]func(rd *Reader) error {
+	methods := map[string]func(rd *Reader) error{
+		"Skip":     func(rd *Reader) error { return rd.Skip() },
+		"ReadIntf": func(rd *Reader) error { _, err := rd.ReadIntf(); return err },
+		"Raw": func(rd *Reader) error {
+			var r Raw
+			return r.DecodeMsg(rd)
+		},
+		"WriteToJSON": func(rd *Reader) error { _, err := rd.WriteToJSON(io.Discard); return err },
+	}
+	var typed func(rd *Reader) error
+	switch t {
+	case NilType:
+		typed = func(rd *Reader) error { return rd.ReadNil() }
+	case BoolType:
+		typed = func(rd *Reader) error { _, err := rd.ReadBool(); return err }
+	case IntType:
+		typed = func(rd *Reader) error { _, err := rd.ReadInt64(); return err }
+	case UintType:
+		typed = func(rd *Reader) error { _, err := rd.ReadUint64(); return err }
+	case Float32Type:
+		typed = func(rd *Reader) error { _, err := rd.ReadFloat32(); return err }
+		methods["ReadFloat64"] = func(rd *Reader) error { _, err := rd.ReadFloat64(); return err }
+	case Float64Type:
+		typed = func(rd *Reader) error { _, err := rd.ReadFloat64(); return err }
+	case StrType:
+		typed = func(rd *Reader) error { _, err := rd.ReadString(); return err }
+		methods["ReadStringAsBytes"] = func(rd *Reader) error { _, err := rd.ReadStringAsBytes(nil); return err }
+		methods["ReadMapKey"] = func(rd *Reader) error { _, err := rd.ReadMapKey(nil); return err }
+	case BinType:
+		typed = func(rd *Reader) error { _, err := rd.ReadBytes(nil); return err }
+	case Complex64Type:
+		typed = func(rd *Reader) error { _, err := rd.ReadComplex64(); return err }
+	case Complex128Type:
+		typed = func(rd *Reader) error { _, err := rd.ReadComplex128(); return err }
+	case TimeType:
+		typed = func(rd *Reader) error { _, err := rd.ReadTime(); return err }
+	case ExtensionType:
+		typed = func(rd *Reader) error { return rd.ReadExtension(&RawExtension{Type: 55}) }
+	case MapType:
+		typed = func(rd *Reader) error { return rd.ReadMapStrIntf(map[string]interface{}{}) }
+	}
+	if typed != nil {
+		methods["typed"] = typed
+	}
+	return methods
+}
+
+func TestReadTruncated(t *testing.T) {
+	for i, obj := range sizeObjects() {
+		if len(obj) > 2000 {
+			continue
+		}
+		typ, err := NewReaderBytes(obj).NextType()
+		if err != nil {
+			t.Fatal(err)
+		}
+		methods := truncMethods(typ)
+		for name, method := range methods {
+			// not every object can be read with
+			// every method (e.g. maps with nil keys)
+			if method(NewReaderBytes(obj)) != nil {
+				delete(methods, name)
+			}
+		}
+		for off := 0; off <= len(obj); off++ {
+			var want error
+			switch off {
+			case 0:
+				want = io.EOF
+			case len(obj):
+				want = nil
+			default:
+				want = io.ErrUnexpectedEOF
+			}
+			for rname, mk := range truncReaders {
+				for mname, method := range methods {
+					want := want
+					if mname == "WriteToJSON" && off == 0 {
+						// it reads until the data ends
+						// cleanly, between objects
+						want = nil
+					}
+					if err := method(mk(obj[:off])); err != want {
+						t.Errorf("object %d (%s) cut at %d of %d bytes: %s from %s: got %v; want %v", i, typ, off, len(obj), mname, rname, err, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNextSize(t *testing.T) {
+	for i, obj := range sizeObjects() {
+		// use a small buffer so that
+		// measuring has to grow it
+		in := append(append([]byte{}, obj...), mnil)
+		rd := NewReaderSize(bytes.NewReader(in), 16)
+		sz, err := rd.NextSize()
+		if err != nil {
+			t.Errorf("object %d: %s", i, err)
+			continue
+		}
+		if sz != len(obj) {
+			t.Errorf("object %d: got size %d; want %d", i, sz, len(obj))
+		}
+
+		// NextSize doesn't consume the object
+		err = rd.Skip()
+		if err != nil {
+			t.Errorf("object %d: %s", i, err)
+		}
+		if !rd.IsNil() {
+			t.Errorf("object %d: expected the reader to be positioned at the trailing nil", i)
+		}
+
+	}
+
+	// truncated headers and containers can't be measured
+	for _, in := range [][]byte{
+		{mstr16, 0},
+		{mext32, 0, 0, 0, 1},
+		AppendNil(AppendArrayHeader(nil, 2)),
+		AppendString(AppendMapHeader(nil, 1), "key"),
+	} {
+		_, err := NewReader(bytes.NewReader(in)).NextSize()
+		if err == nil {
+			t.Errorf("%x: expected an error", in)
+		}
+	}
+}
+
 func BenchmarkSkip(b *testing.B) {
 	var buf bytes.Buffer
 	wr := NewWriter(&buf)
@@ -462,3 +925,32 @@ func BenchmarkSkip(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkReadMapStrIntf(b *testing.B) {
+	var buf bytes.Buffer
+	wr := NewWriter(&buf)
+	wr.WriteMapHeader(1000)
+	for i := 0; i < 1000; i++ {
+		wr.WriteString(fmt.Sprintf("key_%d", i))
+		wr.WriteNil()
+	}
+	wr.Flush()
+
+	bts := buf.Bytes()
+	b.SetBytes(int64(len(bts)))
+
+	brd := bytes.NewReader(bts)
+	rd := NewReader(brd)
+	mp := make(map[string]interface{}, 1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		brd.Seek(0, 0)
+		rd.Reset(brd)
+		err := rd.ReadMapStrIntf(mp)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
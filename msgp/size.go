@@ -1,5 +1,9 @@
 package msgp
 
+import (
+	"math"
+)
+
 // The sizes provided
 // are the worst-case
 // encoded sizes for
@@ -8,6 +12,8 @@ package msgp
 // the total encoded size is
 // the prefix size plus the
 // length of the object.
+// (The functions below return
+// the exact size of a value.)
 const (
 	Int64Size      = 9
 	IntSize        = Int64Size
@@ -36,7 +42,94 @@ const (
 	ExtensionPrefixSize = 6
 )
 
-// ExtensionSize is a shim for computing the size of an extension
+// ExtensionSize returns the encoded size of an extension
 func ExtensionSize(e Extension) int {
-	return ExtensionPrefixSize + e.Len()
+	l := e.Len()
+	return extHeaderSize(l) + l
+}
+
+// Int64SizeFor returns the encoded size of 'i'.
+// It is the same for every signed integer type.
+func Int64SizeFor(i int64) int {
+	a := abs(i)
+	switch {
+	case i < 0 && i > -32, i >= 0 && i < 128:
+		return 1
+	case a < math.MaxInt8:
+		return 2
+	case a < math.MaxInt16:
+		return 3
+	case a < math.MaxInt32:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// Uint64SizeFor returns the encoded size of 'u'.
+// It is the same for every unsigned integer type.
+func Uint64SizeFor(u uint64) int {
+	switch {
+	case u < (1 << 7):
+		return 1
+	case u < math.MaxUint8:
+		return 2
+	case u < math.MaxUint16:
+		return 3
+	case u < math.MaxUint32:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// StringSize returns the encoded size of 's'.
+// (A Writer with EncodeOptions.OldSpec set writes
+// strings of 32 to 254 bytes with a larger header.)
+func StringSize(s string) int {
+	l := len(s)
+	switch {
+	case l < 32:
+		return 1 + l
+	case l < 256:
+		return 2 + l
+	case l < math.MaxUint16:
+		return 3 + l
+	default:
+		return 5 + l
+	}
+}
+
+// BytesSize returns the encoded
+// size of 'n' bytes of 'bin' data.
+func BytesSize(n int) int {
+	switch {
+	case n < math.MaxUint8:
+		return 2 + n
+	case n < math.MaxUint16:
+		return 3 + n
+	default:
+		return 5 + n
+	}
+}
+
+// MapHeaderSizeFor returns the encoded
+// size of the header of a map with 'n'
+// key-value pairs.
+func MapHeaderSizeFor(n uint32) int {
+	switch {
+	case n < 16:
+		return 1
+	case n < math.MaxUint16:
+		return 3
+	default:
+		return 5
+	}
+}
+
+// ArrayHeaderSizeFor returns the encoded
+// size of the header of an array with 'n'
+// elements.
+func ArrayHeaderSizeFor(n uint32) int {
+	return MapHeaderSizeFor(n)
 }
@@ -0,0 +1,100 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+// writerLen returns the number of
+// bytes written by 'fn' to a Writer
+func writerLen(fn func(w *Writer) error) int {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	fn(w)
+	w.Flush()
+	return buf.Len()
+}
+
+func TestInt64SizeFor(t *testing.T) {
+	var vals []int64
+	for _, b := range []int64{0, 31, 32, 127, 128, math.MaxInt8, math.MaxInt16, math.MaxInt32, math.MaxInt64} {
+		vals = append(vals, b-1, b, b+1, -b-1, -b, -b+1)
+	}
+	vals = append(vals, math.MinInt64, math.MinInt64+1)
+	for _, v := range vals {
+		want := len(AppendInt64(nil, v))
+		if got := Int64SizeFor(v); got != want {
+			t.Errorf("Int64SizeFor(%d) is %d; AppendInt64 wrote %d bytes", v, got, want)
+		}
+		if n := writerLen(func(w *Writer) error { return w.WriteInt64(v) }); n != want {
+			t.Errorf("WriteInt64(%d) wrote %d bytes; AppendInt64 wrote %d", v, n, want)
+		}
+		if out, _, err := ReadInt64Bytes(AppendInt64(nil, v)); err != nil || out != v {
+			t.Errorf("%d read back as %d, %v", v, out, err)
+		}
+	}
+}
+
+func TestUint64SizeFor(t *testing.T) {
+	var vals []uint64
+	for _, b := range []uint64{1 << 7, math.MaxUint8, math.MaxUint16, math.MaxUint32} {
+		vals = append(vals, b-1, b, b+1)
+	}
+	vals = append(vals, 0, math.MaxUint64)
+	for _, v := range vals {
+		want := len(AppendUint64(nil, v))
+		if got := Uint64SizeFor(v); got != want {
+			t.Errorf("Uint64SizeFor(%d) is %d; AppendUint64 wrote %d bytes", v, got, want)
+		}
+		if n := writerLen(func(w *Writer) error { return w.WriteUint64(v) }); n != want {
+			t.Errorf("WriteUint64(%d) wrote %d bytes; AppendUint64 wrote %d", v, n, want)
+		}
+	}
+}
+
+func TestStringAndBytesSize(t *testing.T) {
+	for _, l := range []int{0, 1, 31, 32, 33, 254, 255, 256, 65534, 65535, 65536} {
+		s := strings.Repeat("a", l)
+		want := len(AppendString(nil, s))
+		if got := StringSize(s); got != want {
+			t.Errorf("StringSize of %d bytes is %d; AppendString wrote %d bytes", l, got, want)
+		}
+		if n := writerLen(func(w *Writer) error { return w.WriteString(s) }); n != want {
+			t.Errorf("WriteString of %d bytes wrote %d bytes; AppendString wrote %d", l, n, want)
+		}
+
+		want = len(AppendBytes(nil, []byte(s)))
+		if got := BytesSize(l); got != want {
+			t.Errorf("BytesSize(%d) is %d; AppendBytes wrote %d bytes", l, got, want)
+		}
+		if n := writerLen(func(w *Writer) error { return w.WriteBytes([]byte(s)) }); n != want {
+			t.Errorf("WriteBytes of %d bytes wrote %d bytes; AppendBytes wrote %d", l, n, want)
+		}
+	}
+}
+
+func TestHeaderSizeFor(t *testing.T) {
+	for _, n := range []uint32{0, 15, 16, 65534, 65535, 65536, math.MaxUint32} {
+		if got, want := MapHeaderSizeFor(n), len(AppendMapHeader(nil, n)); got != want {
+			t.Errorf("MapHeaderSizeFor(%d) is %d; AppendMapHeader wrote %d bytes", n, got, want)
+		}
+		if got, want := ArrayHeaderSizeFor(n), len(AppendArrayHeader(nil, n)); got != want {
+			t.Errorf("ArrayHeaderSizeFor(%d) is %d; AppendArrayHeader wrote %d bytes", n, got, want)
+		}
+		if got := writerLen(func(w *Writer) error { return w.WriteMapHeader(n) }); got != MapHeaderSizeFor(n) {
+			t.Errorf("WriteMapHeader(%d) wrote %d bytes", n, got)
+		}
+	}
+}
+
+func TestExtensionSize(t *testing.T) {
+	for _, l := range extSizes {
+		e := RawExtension{Type: 10, Data: make([]byte, l)}
+		b, _ := AppendExtension(nil, &e)
+		if got := ExtensionSize(&e); got != len(b) {
+			t.Errorf("ExtensionSize of %d bytes is %d; AppendExtension wrote %d bytes", l, got, len(b))
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/philhofer/fwd"
+)
+
+// source is what a Reader reads from: a
+// fwdSource, which buffers an io.Reader,
+// or a *sliceSource, for data that's
+// already in memory.
+//
+// Peek returns io.EOF only if there's no
+// data left at all. If some, but not all,
+// of the data is there, it returns
+// io.ErrUnexpectedEOF, as Skip, Next and
+// ReadFull do.
+type source interface {
+	Peek(n int) ([]byte, error)
+	Skip(n int) (int, error)
+	Next(n int) ([]byte, error)
+	Read(p []byte) (int, error)
+	ReadFull(p []byte) (int, error)
+}
+
+// fwdSource is a *fwd.Reader whose Peek
+// tells a short read from the end of the data
+type fwdSource struct{ *fwd.Reader }
+
+func (f fwdSource) Peek(n int) ([]byte, error) {
+	p, err := f.Reader.Peek(n)
+	if err == io.EOF && len(p) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return p, err
+}
+
+// Skip consumes what's buffered before it
+// skips the rest: if the buffer is full,
+// (*fwd.Reader).Skip has no room to read
+// into, and fails with io.ErrNoProgress
+func (f fwdSource) Skip(n int) (int, error) {
+	b := f.Buffered()
+	if b >= n {
+		return f.Reader.Skip(n)
+	}
+	f.Reader.Skip(b)
+	m, err := f.Reader.Skip(n - b)
+	return b + m, err
+}
+
+// noEOF returns io.ErrUnexpectedEOF in place
+// of io.EOF, for the reads that follow the
+// first one in an object: once an object has
+// begun, the end of the data means it was cut
+// short.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// sliceSource reads straight from memory, so
+// nothing is copied into a buffer first. The
+// errors it returns are the same as those
+// returned by a *fwd.Reader.
+//
+// A *bytes.Buffer is advanced past the data
+// that's been consumed as the data is consumed.
+// A *bytes.Reader is read the way a *fwd.Reader
+// would read it, except that its data is used in
+// place: all of it is taken at once, and more
+// is taken if it's been moved with Seek or Reset.
+type sliceSource struct {
+	b   []byte        // unread data, unless buf is set
+	buf *bytes.Buffer // the origin of the data, if any
+	rd  *bytes.Reader
+}
+
+// bytes returns the unread data
+func (s *sliceSource) bytes() []byte {
+	if s.buf != nil {
+		return s.buf.Bytes()
+	}
+	return s.b
+}
+
+// advance consumes 'n' bytes
+func (s *sliceSource) advance(n int) {
+	if s.buf != nil {
+		s.buf.Next(n)
+		return
+	}
+	s.b = s.b[n:]
+}
+
+// fill takes the data that rd hasn't
+// read yet, and returns the unread data
+func (s *sliceSource) fill() []byte {
+	if s.rd != nil && s.rd.Len() > 0 {
+		s.rd.WriteTo((*sliceWriter)(&s.b))
+	}
+	return s.bytes()
+}
+
+func (s *sliceSource) Peek(n int) ([]byte, error) {
+	b := s.bytes()
+	if len(b) < n {
+		if b = s.fill(); len(b) == 0 {
+			return b, io.EOF
+		} else if len(b) < n {
+			return b, io.ErrUnexpectedEOF
+		}
+	}
+	return b[:n], nil
+}
+
+func (s *sliceSource) Skip(n int) (int, error) {
+	b := s.bytes()
+	if len(b) < n {
+		if b = s.fill(); len(b) < n {
+			s.advance(len(b))
+			return len(b), io.ErrUnexpectedEOF
+		}
+	}
+	s.advance(n)
+	return n, nil
+}
+
+func (s *sliceSource) Next(n int) ([]byte, error) {
+	b := s.bytes()
+	if len(b) < n {
+		if b = s.fill(); len(b) < n {
+			return b, io.ErrUnexpectedEOF
+		}
+	}
+	s.advance(n)
+	return b[:n], nil
+}
+
+func (s *sliceSource) Read(p []byte) (int, error) {
+	b := s.bytes()
+	if len(b) == 0 {
+		if b = s.fill(); len(b) == 0 {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, b)
+	s.advance(n)
+	return n, nil
+}
+
+func (s *sliceSource) ReadFull(p []byte) (int, error) {
+	b := s.bytes()
+	if len(b) < len(p) {
+		b = s.fill()
+	}
+	n := copy(p, b)
+	s.advance(n)
+	if n < len(p) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+// sliceWriter is an io.Writer that keeps the
+// first slice passed to Write instead of copying
+// it. (*bytes.Reader).WriteTo passes the reader's
+// unread data to a single Write call, so this is
+// how a Reader gets at the data without copying.
+// Data written after other data is copied.
+type sliceWriter []byte
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	if len(*w) == 0 {
+		*w = p
+	} else {
+		// there's data in front of it, or
+		// it came in pieces after all
+		*w = append((*w)[:len(*w):len(*w)], p...)
+	}
+	return len(p), nil
+}
+
+// setSlice makes 'm' read from memory if 'r' is
+// a *bytes.Buffer or *bytes.Reader, and returns
+// whether or not it did
+func (m *Reader) setSlice(r io.Reader) bool {
+	switch r := r.(type) {
+	case *bytes.Buffer:
+		if r == nil {
+			return false
+		}
+		m.mem = sliceSource{buf: r}
+	case *bytes.Reader:
+		if r == nil {
+			return false
+		}
+		m.mem = sliceSource{rd: r}
+	default:
+		return false
+	}
+	m.r = &m.mem
+	return true
+}
+
+// segSource reads from a list of segments the
+// way a *sliceSource reads from one slice: the
+// data is used in place, except where an object
+// is read whole (by Peek or Next) across the end
+// of a segment. Only those bytes are copied, into
+// a buffer of their own, so that they're contiguous.
+type segSource struct {
+	b    []byte   // unread data in the current segment, or in join
+	segs [][]byte // the segments after it
+	join []byte   // recycled buffer for data joined across segments
+}
+
+// fill makes the first 'n' bytes of the unread
+// data contiguous, as far as there are that many,
+// and returns the unread data that's contiguous
+func (s *segSource) fill(n int) []byte {
+	for len(s.b) == 0 && len(s.segs) > 0 {
+		s.b, s.segs = s.segs[0], s.segs[1:]
+	}
+	if len(s.b) >= n || len(s.segs) == 0 {
+		return s.b
+	}
+	// s.b may be the tail of join; append
+	// moves it to the front before growing it
+	j := append(s.join[:0], s.b...)
+	for len(j) < n && len(s.segs) > 0 {
+		seg := s.segs[0]
+		if k := n - len(j); k < len(seg) {
+			j = append(j, seg[:k]...)
+			s.segs[0] = seg[k:]
+			break
+		}
+		j = append(j, seg...)
+		s.segs = s.segs[1:]
+	}
+	s.join, s.b = j, j
+	return j
+}
+
+func (s *segSource) Peek(n int) ([]byte, error) {
+	b := s.fill(n)
+	if len(b) < n {
+		if len(b) == 0 {
+			return b, io.EOF
+		}
+		return b, io.ErrUnexpectedEOF
+	}
+	return b[:n], nil
+}
+
+func (s *segSource) Skip(n int) (int, error) {
+	skipped := 0
+	for skipped < n {
+		b := s.fill(1)
+		if len(b) == 0 {
+			return skipped, io.ErrUnexpectedEOF
+		}
+		k := n - skipped
+		if k > len(b) {
+			k = len(b)
+		}
+		s.b = b[k:]
+		skipped += k
+	}
+	return n, nil
+}
+
+func (s *segSource) Next(n int) ([]byte, error) {
+	b := s.fill(n)
+	if len(b) < n {
+		return b, io.ErrUnexpectedEOF
+	}
+	s.b = b[n:]
+	return b[:n], nil
+}
+
+func (s *segSource) Read(p []byte) (int, error) {
+	b := s.fill(1)
+	if len(b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, b)
+	s.b = b[n:]
+	return n, nil
+}
+
+func (s *segSource) ReadFull(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		b := s.fill(1)
+		if len(b) == 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		k := copy(p[n:], b)
+		s.b = b[k:]
+		n += k
+	}
+	return n, nil
+}
@@ -0,0 +1,265 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sourceMessage is {"id": 1234567, "body": <4KB>, "tags": ["tag", ...]}
+func sourceMessage() []byte {
+	var b []byte
+	b = AppendMapHeader(b, 3)
+	b = AppendString(b, "id")
+	b = AppendInt64(b, 1234567)
+	b = AppendString(b, "body")
+	b = AppendString(b, strings.Repeat("payload ", 512))
+	b = AppendString(b, "tags")
+	b = AppendArrayHeader(b, 8)
+	for i := 0; i < 8; i++ {
+		b = AppendString(b, "tag")
+	}
+	return b
+}
+
+// readSourceMessage reads sourceMessage
+// into 'scratch', and returns the body
+func readSourceMessage(rd *Reader, scratch []byte) ([]byte, error) {
+	sz, err := rd.ReadMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	for i := uint32(0); i < sz; i++ {
+		key, err := rd.ReadMapKey(scratch[:0])
+		if err != nil {
+			return nil, err
+		}
+		switch string(key) {
+		case "id":
+			_, err = rd.ReadInt64()
+		case "body":
+			body, err = rd.ReadStringAsBytes(scratch[:0])
+		default:
+			var n uint32
+			n, err = rd.ReadArrayHeader()
+			for j := uint32(0); j < n && err == nil; j++ {
+				_, err = rd.ReadStringAsBytes(scratch[:0])
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// plainReader hides everything but Read
+type plainReader struct{ io.Reader }
+
+func TestReaderSources(t *testing.T) {
+	msg := sourceMessage()
+	data := append(append([]byte{}, msg...), msg...)
+	want := strings.Repeat("payload ", 512)
+	sources := map[string]func() (io.Reader, *Reader){
+		"bytes.Reader": func() (io.Reader, *Reader) {
+			r := bytes.NewReader(data)
+			return r, NewReader(r)
+		},
+		"bytes.Buffer": func() (io.Reader, *Reader) {
+			r := bytes.NewBuffer(append([]byte{}, data...))
+			return r, NewReader(r)
+		},
+		"slice": func() (io.Reader, *Reader) {
+			return nil, NewReaderBytes(data)
+		},
+		"buffered": func() (io.Reader, *Reader) {
+			r := plainReader{bytes.NewReader(data)}
+			return r, NewReader(r)
+		},
+	}
+	for name, mk := range sources {
+		src, rd := mk()
+		scratch := make([]byte, 0, 64)
+		for i := 0; i < 2; i++ {
+			body, err := readSourceMessage(rd, scratch)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if string(body) != want {
+				t.Errorf("%s: read the wrong body", name)
+			}
+		}
+		if _, err := rd.ReadInt64(); err != io.EOF {
+			t.Errorf("%s: expected io.EOF at the end; got %v", name, err)
+		}
+		if _, ok := src.(plainReader); ok || src == nil {
+			continue
+		}
+		// the source has been read up to
+		// where the Reader stopped
+		if n, _ := src.Read(make([]byte, 1)); n != 0 {
+			t.Errorf("%s: the source wasn't advanced", name)
+		}
+	}
+}
+
+func TestReaderBytesReaderSeek(t *testing.T) {
+	msg := sourceMessage()
+	src := bytes.NewReader(msg)
+	rd := NewReader(src)
+	for i := 0; i < 3; i++ {
+		if _, err := readSourceMessage(rd, nil); err != nil {
+			t.Fatalf("read %d: %s", i, err)
+		}
+		// the source can be moved
+		// with Seek or Reset between
+		// messages, as if it were buffered
+		if i == 0 {
+			src.Seek(0, io.SeekStart)
+		} else {
+			src.Reset(msg)
+		}
+	}
+}
+
+func TestReaderSourceErrors(t *testing.T) {
+	msg := sourceMessage()
+	short := msg[:len(msg)-2]
+
+	// a truncated message gets the same error
+	// from memory as from a buffered reader
+	_, want := readSourceMessage(NewReader(plainReader{bytes.NewReader(short)}), nil)
+	if want == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := readSourceMessage(NewReader(bytes.NewReader(short)), nil); err != want {
+		t.Errorf("bytes.Reader: got %v; want %v", err, want)
+	}
+	if _, err := readSourceMessage(NewReaderBytes(short), nil); err != want {
+		t.Errorf("slice: got %v; want %v", err, want)
+	}
+
+	for _, n := range []int{0, 1, 3} {
+		p := make([]byte, 2)
+		want, werr := NewReader(plainReader{bytes.NewReader(short[:n])}).ReadFull(p)
+		got, err := NewReaderBytes(short[:n]).ReadFull(p)
+		if got != want || err != werr {
+			t.Errorf("ReadFull of %d bytes: got %d, %v; want %d, %v", n, got, err, want, werr)
+		}
+	}
+}
+
+func TestMultiReaderBytes(t *testing.T) {
+	msg := sourceMessage()
+	want := strings.Repeat("payload ", 512)
+	short := msg[:len(msg)-2]
+	_, werr := readSourceMessage(NewReaderBytes(short), nil)
+	scratch := make([]byte, 0, 64)
+
+	// every split of the message, so that each
+	// header, key and string spans the two segments
+	for i := 0; i <= len(msg); i++ {
+		rd := NewMultiReaderBytes(msg[:i], nil, msg[i:])
+		body, err := readSourceMessage(rd, scratch)
+		if err != nil {
+			t.Fatalf("split at %d: %s", i, err)
+		}
+		if string(body) != want {
+			t.Fatalf("split at %d: read the wrong body", i)
+		}
+		if _, err := rd.ReadInt64(); err != io.EOF {
+			t.Fatalf("split at %d: expected io.EOF at the end; got %v", i, err)
+		}
+
+		rd = NewMultiReaderBytes(msg[:i], msg[i:])
+		if err = rd.Skip(); err != nil {
+			t.Fatalf("split at %d: Skip: %s", i, err)
+		}
+		if _, err := rd.ReadInt64(); err != io.EOF {
+			t.Fatalf("split at %d: expected io.EOF after Skip; got %v", i, err)
+		}
+
+		if i <= len(short) {
+			_, err = readSourceMessage(NewMultiReaderBytes(short[:i], short[i:]), nil)
+			if err != werr {
+				t.Fatalf("split at %d of a truncated message: got %v; want %v", i, err, werr)
+			}
+		}
+	}
+}
+
+func TestMultiReaderBytesIntf(t *testing.T) {
+	msg, err := AppendIntf(nil, map[string]interface{}{
+		"float": 1.5,
+		"list":  []interface{}{int64(-3), "x", true, nil, uint64(1 << 40)},
+		"bin":   []byte("binary"),
+		"time":  time.Unix(1500000000, 12345).UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := NewReaderBytes(msg).ReadIntf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// three segments, so that the middle
+	// of one object spans all of them
+	for i := 0; i < len(msg); i++ {
+		for j := i; j <= len(msg) && j <= i+3; j++ {
+			got, err := NewMultiReaderBytes(msg[:i], msg[i:j], msg[j:]).ReadIntf()
+			if err != nil {
+				t.Fatalf("split at %d and %d: %s", i, j, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("split at %d and %d: got %v; want %v", i, j, got, want)
+			}
+		}
+	}
+}
+
+func benchmarkSource(b *testing.B, reset func(rd *Reader, data []byte)) {
+	data := sourceMessage()
+	scratch := make([]byte, 0, len(data))
+	rd := NewReader(nil)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		reset(rd, data)
+		if _, err := readSourceMessage(rd, scratch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadBuffered is the way any
+// io.Reader is read: the data is copied
+// into the Reader's buffer first
+func BenchmarkReadBuffered(b *testing.B) {
+	src := bytes.NewReader(nil)
+	benchmarkSource(b, func(rd *Reader, data []byte) {
+		src.Reset(data)
+		rd.Reset(plainReader{src})
+	})
+}
+
+func BenchmarkReadBytesReader(b *testing.B) {
+	src := bytes.NewReader(nil)
+	benchmarkSource(b, func(rd *Reader, data []byte) {
+		src.Reset(data)
+		rd.Reset(src)
+	})
+}
+
+func BenchmarkReadBytesBuffer(b *testing.B) {
+	var src bytes.Buffer
+	benchmarkSource(b, func(rd *Reader, data []byte) {
+		src.Reset()
+		src.Write(data)
+		rd.Reset(&src)
+	})
+}
@@ -0,0 +1,512 @@
+package msgp
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+var long = flag.Bool("long", false, "run many more seeds in the symmetry tests")
+
+// a symValue is a value in a random stream,
+// with the ways of writing and reading it
+type symValue struct {
+	desc   string
+	write  func(w *Writer) error
+	append func(b []byte) ([]byte, error)
+	read   func(r *Reader) (interface{}, error)
+	readb  func(b []byte) (interface{}, []byte, error)
+	want   interface{} // what read and readb return
+	intf   interface{} // what ReadIntf returns
+	in     interface{} // the value passed to WriteIntf
+	maxMap int         // largest number of map entries in the value
+}
+
+// intfValue returns the value that ReadIntf
+// returns for a value written by 'w'
+func intfValue(w interface{}) interface{} {
+	switch w := w.(type) {
+	case int8:
+		return int64(w)
+	case int16:
+		return int64(w)
+	case int32:
+		return int64(w)
+	case int:
+		return int64(w)
+	case uint8:
+		return intfUint(uint64(w))
+	case uint16:
+		return intfUint(uint64(w))
+	case uint32:
+		return intfUint(uint64(w))
+	case uint:
+		return intfUint(uint64(w))
+	case uint64:
+		return intfUint(w)
+	default:
+		return w
+	}
+}
+
+// small unsigned integers are
+// written as positive fixints
+func intfUint(u uint64) interface{} {
+	if u < 128 {
+		return int64(u)
+	}
+	return u
+}
+
+// interesting integers, at the edges
+// of each of the encodings
+var symInts = []int64{
+	0, 1, -1, 31, 32, -31, -32, -33, 127, 128, -127, -128, -129, 255, 256,
+	math.MaxInt16 - 1, math.MaxInt16, math.MaxInt16 + 1, math.MinInt16, math.MinInt16 - 1,
+	math.MaxUint16 - 1, math.MaxUint16, math.MaxUint16 + 1,
+	math.MaxInt32 - 1, math.MaxInt32, math.MaxInt32 + 1, math.MinInt32, math.MinInt32 - 1,
+	math.MaxUint32 - 1, math.MaxUint32, math.MaxUint32 + 1,
+	math.MaxInt64, math.MinInt64,
+}
+
+// interesting lengths of strings, bins and
+// extensions; one in 64 is one of symLongLens
+var (
+	symLens     = []int{0, 1, 2, 3, 4, 5, 8, 15, 16, 17, 20, 31, 32, 33, 100, 254, 255, 256, 257}
+	symLongLens = []int{math.MaxUint16 - 1, math.MaxUint16, math.MaxUint16 + 1}
+)
+
+func symInt(r *rand.Rand) int64 {
+	if r.Intn(2) == 0 {
+		return symInts[r.Intn(len(symInts))]
+	}
+	return r.Int63() >> uint(r.Intn(63)) * int64(1-2*r.Intn(2))
+}
+
+func symFloat(r *rand.Rand) float64 {
+	switch r.Intn(8) {
+	case 0:
+		return 0
+	case 1:
+		return math.MaxFloat64
+	case 2:
+		return math.SmallestNonzeroFloat64
+	default:
+		return r.NormFloat64() * math.Pow(10, float64(r.Intn(40)-20))
+	}
+}
+
+func symBytes(r *rand.Rand) []byte {
+	n := symLens[r.Intn(len(symLens))]
+	if r.Intn(64) == 0 {
+		n = symLongLens[r.Intn(len(symLongLens))]
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+func symString(r *rand.Rand) string {
+	b := symBytes(r)
+	for i := range b {
+		b[i] = 'a' + b[i]%26
+	}
+	return string(b)
+}
+
+// scalar returns a random value
+// that isn't a map or an array
+func scalar(r *rand.Rand) symValue {
+	var v symValue
+	switch r.Intn(21) {
+	case 0:
+		x := int8(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteInt8(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendInt8(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadInt8() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadInt8Bytes(b) }
+		v.want = x
+	case 1:
+		x := int16(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteInt16(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendInt16(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadInt16() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadInt16Bytes(b) }
+		v.want = x
+	case 2:
+		x := int32(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteInt32(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendInt32(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadInt32() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadInt32Bytes(b) }
+		v.want = x
+	case 3:
+		x := symInt(r)
+		v.write = func(w *Writer) error { return w.WriteInt64(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendInt64(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadInt64() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadInt64Bytes(b) }
+		v.want = x
+	case 4:
+		x := int(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteInt(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendInt(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadInt() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadIntBytes(b) }
+		v.want = x
+	case 5:
+		x := uint8(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteUint8(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendUint8(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadUint8() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadUint8Bytes(b) }
+		v.want = x
+	case 6:
+		x := uint16(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteUint16(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendUint16(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadUint16() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadUint16Bytes(b) }
+		v.want = x
+	case 7:
+		x := uint32(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteUint32(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendUint32(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadUint32() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadUint32Bytes(b) }
+		v.want = x
+	case 8:
+		x := uint64(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteUint64(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendUint64(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadUint64() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadUint64Bytes(b) }
+		v.want = x
+	case 9:
+		x := uint(symInt(r))
+		v.write = func(w *Writer) error { return w.WriteUint(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendUint(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadUint() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadUintBytes(b) }
+		v.want = x
+	case 10:
+		x := float32(symFloat(r))
+		v.write = func(w *Writer) error { return w.WriteFloat32(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendFloat32(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadFloat32() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadFloat32Bytes(b) }
+		v.want = x
+	case 11:
+		x := symFloat(r)
+		v.write = func(w *Writer) error { return w.WriteFloat64(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendFloat64(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadFloat64() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadFloat64Bytes(b) }
+		v.want = x
+	case 12:
+		x := complex(float32(symFloat(r)), float32(symFloat(r)))
+		v.write = func(w *Writer) error { return w.WriteComplex64(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendComplex64(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadComplex64() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadComplex64Bytes(b) }
+		v.want = x
+	case 13:
+		x := complex(symFloat(r), symFloat(r))
+		v.write = func(w *Writer) error { return w.WriteComplex128(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendComplex128(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadComplex128() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadComplex128Bytes(b) }
+		v.want = x
+	case 14:
+		x := r.Intn(2) == 0
+		v.write = func(w *Writer) error { return w.WriteBool(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendBool(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadBool() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadBoolBytes(b) }
+		v.want = x
+	case 15:
+		v.write = func(w *Writer) error { return w.WriteNil() }
+		v.append = func(b []byte) ([]byte, error) { return AppendNil(b), nil }
+		v.read = func(r *Reader) (interface{}, error) { return nil, r.ReadNil() }
+		v.readb = func(b []byte) (interface{}, []byte, error) {
+			o, err := ReadNilBytes(b)
+			return nil, o, err
+		}
+	case 16:
+		x := symString(r)
+		v.write = func(w *Writer) error { return w.WriteString(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendString(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadString() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadStringBytes(b) }
+		v.want = x
+	case 17:
+		x := symBytes(r)
+		v.write = func(w *Writer) error { return w.WriteBytes(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendBytes(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadBytes(nil) }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadBytesBytes(b, nil) }
+		v.want = x
+	case 18:
+		x := time.Unix(symInt(r)>>30, int64(r.Intn(1e9)))
+		v.write = func(w *Writer) error { return w.WriteTime(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendTime(b, x), nil }
+		v.read = func(r *Reader) (interface{}, error) { return r.ReadTime() }
+		v.readb = func(b []byte) (interface{}, []byte, error) { return ReadTimeBytes(b) }
+		v.want = x
+	default:
+		// types 10 to 99 aren't built in or
+		// registered by the other tests
+		x := &RawExtension{Type: int8(10 + r.Intn(90)), Data: symBytes(r)}
+		v.write = func(w *Writer) error { return w.WriteExtension(x) }
+		v.append = func(b []byte) ([]byte, error) { return AppendExtension(b, x) }
+		v.read = func(r *Reader) (interface{}, error) {
+			e := &RawExtension{Type: x.Type}
+			return e, r.ReadExtension(e)
+		}
+		v.readb = func(b []byte) (interface{}, []byte, error) {
+			e := &RawExtension{Type: x.Type}
+			o, err := ReadExtensionBytes(b, e)
+			return e, o, err
+		}
+		v.want = x
+	}
+	v.desc = fmt.Sprintf("%T", v.want)
+	v.intf = intfValue(v.want)
+	v.in = v.want
+	return v
+}
+
+// symSizes are the sizes of random maps and arrays
+var symSizes = []int{0, 1, 2, 3, 4, 15, 16, 17}
+
+// symValueOf returns a random value, which is a
+// map or array with probability 1/(4 << depth)
+// while 'depth' is less than 4
+func symValueOf(r *rand.Rand, depth int) symValue {
+	if depth >= 4 || r.Intn(4<<uint(depth)) != 0 {
+		return scalar(r)
+	}
+	n := symSizes[r.Intn(len(symSizes))]
+	els := make([]symValue, n)
+	for i := range els {
+		els[i] = symValueOf(r, depth+1)
+	}
+	isMap := r.Intn(2) == 0
+	var keys []string
+	if isMap {
+		keys = make([]string, n)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("%d%s", i, symString(r))
+		}
+	}
+
+	var v symValue
+	v.write = func(w *Writer) error {
+		var err error
+		if isMap {
+			err = w.WriteMapHeader(uint32(n))
+		} else {
+			err = w.WriteArrayHeader(uint32(n))
+		}
+		for i := 0; err == nil && i < n; i++ {
+			if isMap {
+				err = w.WriteString(keys[i])
+				if err != nil {
+					break
+				}
+			}
+			err = els[i].write(w)
+		}
+		return err
+	}
+	v.append = func(b []byte) ([]byte, error) {
+		if isMap {
+			b = AppendMapHeader(b, uint32(n))
+		} else {
+			b = AppendArrayHeader(b, uint32(n))
+		}
+		var err error
+		for i := 0; err == nil && i < n; i++ {
+			if isMap {
+				b = AppendString(b, keys[i])
+			}
+			b, err = els[i].append(b)
+		}
+		return b, err
+	}
+	v.read = func(r *Reader) (interface{}, error) { return r.ReadIntf() }
+	v.readb = func(b []byte) (interface{}, []byte, error) { return ReadIntfBytes(b) }
+
+	descs := make([]string, n)
+	for i := range els {
+		descs[i] = els[i].desc
+		if els[i].maxMap > v.maxMap {
+			v.maxMap = els[i].maxMap
+		}
+	}
+	if isMap {
+		intf, in := make(map[string]interface{}, n), make(map[string]interface{}, n)
+		for i := range els {
+			intf[keys[i]], in[keys[i]] = els[i].intf, els[i].in
+		}
+		v.intf, v.in = intf, in
+		if n > v.maxMap {
+			v.maxMap = n
+		}
+		v.desc = "map{" + strings.Join(descs, ", ") + "}"
+	} else {
+		intf, in := make([]interface{}, n), make([]interface{}, n)
+		for i := range els {
+			intf[i], in[i] = els[i].intf, els[i].in
+		}
+		v.intf, v.in = intf, in
+		v.desc = "[" + strings.Join(descs, ", ") + "]"
+	}
+	v.want = v.intf
+	return v
+}
+
+// symStream returns a random sequence of values.
+// Values without maps of more than one entry are
+// sometimes written with WriteIntf and AppendIntf,
+// since they write maps in random order.
+func symStream(r *rand.Rand) []symValue {
+	vals := make([]symValue, 1+r.Intn(16))
+	for i := range vals {
+		v := symValueOf(r, 0)
+		if v.maxMap <= 1 && r.Intn(3) == 0 {
+			in := v.in
+			v.desc = "intf " + v.desc
+			v.write = func(w *Writer) error { return w.WriteIntf(in) }
+			v.append = func(b []byte) ([]byte, error) { return AppendIntf(b, in) }
+			v.read = func(r *Reader) (interface{}, error) { return r.ReadIntf() }
+			v.readb = func(b []byte) (interface{}, []byte, error) { return ReadIntfBytes(b) }
+			v.want = v.intf
+		}
+		vals[i] = v
+	}
+	return vals
+}
+
+// symEqual returns whether or not
+// a value read back equals 'want'
+func symEqual(want, got interface{}) bool {
+	switch want := want.(type) {
+	case []byte:
+		got, ok := got.([]byte)
+		return ok && bytes.Equal(want, got)
+	case time.Time:
+		got, ok := got.(time.Time)
+		return ok && want.Equal(got)
+	case *RawExtension:
+		got, ok := got.(*RawExtension)
+		return ok && want.Type == got.Type && bytes.Equal(want.Data, got.Data)
+	case []interface{}:
+		got, ok := got.([]interface{})
+		if !ok || len(want) != len(got) {
+			return false
+		}
+		for i := range want {
+			if !symEqual(want[i], got[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok || len(want) != len(got) {
+			return false
+		}
+		for k, v := range want {
+			g, ok := got[k]
+			if !ok || !symEqual(v, g) {
+				return false
+			}
+		}
+		return true
+	default:
+		return want == got
+	}
+}
+
+// checkSymmetry writes the stream for 'seed' with a
+// Writer and with the Append functions, checks that
+// they wrote the same bytes, and reads it back with
+// a Reader and with the Bytes functions, recording
+// what it covered of the wire format with markWire
+func checkSymmetry(seed int64) error {
+	vals := symStream(rand.New(rand.NewSource(seed)))
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	var b []byte
+	for i, v := range vals {
+		if err := v.write(w); err != nil {
+			return fmt.Errorf("writing value %d (%s): %s", i, v.desc, err)
+		}
+		var err error
+		b, err = v.append(b)
+		if err != nil {
+			return fmt.Errorf("appending value %d (%s): %s", i, v.desc, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf.Bytes(), b) {
+		return fmt.Errorf("the Writer wrote\n%x\nbut the Append functions wrote\n%x", buf.Bytes(), b)
+	}
+	markWire(wireWriter, buf.Bytes())
+	markWire(wireAppend, b)
+	wire := b
+
+	r := NewReader(&buf)
+	for i, v := range vals {
+		got, err := v.read(r)
+		if err != nil {
+			return fmt.Errorf("reading value %d (%s): %s", i, v.desc, err)
+		}
+		if !symEqual(v.want, got) {
+			return fmt.Errorf("value %d (%s): wrote %#v; the Reader read %#v", i, v.desc, v.want, got)
+		}
+
+		got, b, err = v.readb(b)
+		if err != nil {
+			return fmt.Errorf("reading value %d (%s) from bytes: %s", i, v.desc, err)
+		}
+		if !symEqual(v.want, got) {
+			return fmt.Errorf("value %d (%s): wrote %#v; read %#v from bytes", i, v.desc, v.want, got)
+		}
+	}
+	if _, err := r.NextType(); err != io.EOF {
+		return fmt.Errorf("the Reader didn't read everything (%v)", err)
+	}
+	if len(b) > 0 {
+		return fmt.Errorf("%d bytes weren't read", len(b))
+	}
+	markWire(wireReader, wire)
+	markWire(wireBytes, wire)
+	return nil
+}
+
+// TestSymmetry is the main check that the Writer
+// and the Append functions write the same things,
+// and that the Reader and the Bytes functions read
+// them back. Run with -long to check more seeds.
+func TestSymmetry(t *testing.T) {
+	seeds := int64(2000)
+	if *long {
+		seeds = 200000
+	}
+	for seed := int64(0); seed < seeds; seed++ {
+		if err := checkSymmetry(seed); err != nil {
+			t.Fatalf("seed %d: %s", seed, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package msgp
+
+import (
+	"strconv"
+	"time"
+)
+
+// TimestampMaxSize is the largest encoded size of a
+// timestamp: an ext8 header and the 96-bit form.
+const TimestampMaxSize = 3 + 12
+
+// TimestampError is returned when a timestamp extension
+// (TimestampExtension) doesn't hold a time: it isn't 4,
+// 8 or 12 bytes long, or its nanoseconds add up to a
+// second or more; or when a time extension (TimeExtension)
+// doesn't, by time.Time.UnmarshalBinary. The whole
+// extension has been read, so the error is resumable:
+// the next object can be read as if it hadn't happened.
+type TimestampError struct {
+	Reason string
+}
+
+// Error implements the error interface
+func (e TimestampError) Error() string {
+	return "msgp: bad timestamp: " + e.Reason
+}
+
+// Resumable returns true; see TimestampError.
+func (e TimestampError) Resumable() bool { return true }
+
+// TimestampSize returns the encoded size of 't'
+// as AppendTimestamp writes it: 6, 10 or 15 bytes.
+func TimestampSize(t time.Time) int {
+	sec, nsec := t.Unix(), t.Nanosecond()
+	switch {
+	case sec>>32 == 0 && nsec == 0:
+		return 2 + 4
+	case sec>>34 == 0:
+		return 2 + 8
+	default:
+		return TimestampMaxSize
+	}
+}
+
+// AppendTimestamp appends a time.Time to the slice as a
+// timestamp extension of the MessagePack spec, which is
+// what other implementations read and write times as, in
+// the smallest of its forms that holds 't' exactly: a
+// fixext4 of seconds for whole seconds from 1970 to 2106,
+// a fixext8 of nanoseconds and seconds from 1970 to 2514,
+// and an ext8 of 12 bytes for the rest, before 1970 or
+// after 2514. It doesn't write the location of 't';
+// ReadTimeBytes reads it back in UTC. AppendTime
+// writes times this way.
+func AppendTimestamp(b []byte, t time.Time) []byte {
+	o, n := ensure(b, TimestampSize(t))
+	putTimestamp(o[n:], t)
+	return o
+}
+
+// WriteTimestamp writes a time.Time
+// as AppendTimestamp does.
+func (mw *Writer) WriteTimestamp(t time.Time) error {
+	o, err := mw.require(TimestampSize(t))
+	if err != nil {
+		return err
+	}
+	putTimestamp(mw.buf[o:], t)
+	return nil
+}
+
+// putTimestamp writes 't' to the start of 'b',
+// which has room for TimestampSize(t) bytes
+func putTimestamp(b []byte, t time.Time) {
+	sec, nsec := t.Unix(), uint32(t.Nanosecond())
+	switch TimestampSize(t) {
+	case 2 + 4:
+		b[0], b[1] = mfixext4, byte(TimestampExtension&0xff)
+		big.PutUint32(b[2:], uint32(sec))
+	case 2 + 8:
+		b[0], b[1] = mfixext8, byte(TimestampExtension&0xff)
+		big.PutUint64(b[2:], uint64(nsec)<<34|uint64(sec))
+	default:
+		b[0], b[1], b[2] = mext8, 12, byte(TimestampExtension&0xff)
+		big.PutUint32(b[3:], nsec)
+		big.PutUint64(b[7:], uint64(sec))
+	}
+}
+
+// isTimestamp returns whether 'b', which is a
+// whole object, is a timestamp extension in one
+// of the forms timestampOf reads
+func isTimestamp(b []byte) bool {
+	switch {
+	case b[0] == mfixext4 || b[0] == mfixext8:
+		return int8(b[1]) == TimestampExtension
+	case b[0] == mext8 && len(b) == 3+12:
+		return int8(b[2]) == TimestampExtension
+	default:
+		return false
+	}
+}
+
+// timestampOf returns the time in the timestamp
+// extension 'b', which is all of the extension,
+// header and all, in UTC
+func timestampOf(b []byte) (time.Time, error) {
+	var sec int64
+	var nsec uint32
+	switch {
+	case b[0] == mfixext4:
+		sec = int64(big.Uint32(b[2:]))
+	case b[0] == mfixext8:
+		v := big.Uint64(b[2:])
+		sec, nsec = int64(v&(1<<34-1)), uint32(v>>34)
+	case b[0] == mext8 && b[1] == 12:
+		nsec = big.Uint32(b[3:])
+		sec = int64(big.Uint64(b[7:]))
+	default:
+		return time.Time{}, TimestampError{Reason: strconv.Itoa(len(b)) + " bytes, with the header, aren't a 32, 64 or 96-bit timestamp"}
+	}
+	if nsec >= 1e9 {
+		return time.Time{}, TimestampError{Reason: strconv.FormatUint(uint64(nsec), 10) + " nanoseconds are more than a second"}
+	}
+	return time.Unix(sec, int64(nsec)).UTC(), nil
+}
@@ -0,0 +1,224 @@
+package msgp
+
+import (
+	"bufio"
+	"bytes"
+	hexenc "encoding/hex"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// timestampCase is a line of testdata/timestamps.txt
+type timestampCase struct {
+	t   time.Time
+	enc []byte
+}
+
+func readTimestampCases(t *testing.T) []timestampCase {
+	f, err := os.Open("testdata/timestamps.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var cases []timestampCase
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			t.Fatalf("bad line %q", line)
+		}
+		tm, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc, err := hexenc.DecodeString(fields[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		cases = append(cases, timestampCase{tm, enc})
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return cases
+}
+
+func TestTimestamp(t *testing.T) {
+	for _, tc := range readTimestampCases(t) {
+		name := tc.t.Format(time.RFC3339Nano)
+
+		// written byte for byte, in any location
+		b := AppendTimestamp(nil, tc.t.In(time.FixedZone("X", 3600)))
+		if !bytes.Equal(b, tc.enc) {
+			t.Errorf("%s: AppendTimestamp wrote %x; want %x", name, b, tc.enc)
+		}
+		if n := TimestampSize(tc.t); n != len(tc.enc) {
+			t.Errorf("%s: TimestampSize is %d; want %d", name, n, len(tc.enc))
+		}
+		if b = AppendTime(nil, tc.t); !bytes.Equal(b, tc.enc) {
+			t.Errorf("%s: AppendTime wrote %x; want %x", name, b, tc.enc)
+		}
+		for _, write := range []struct {
+			name string
+			fn   func(w *Writer) error
+		}{
+			{"WriteTimestamp", func(w *Writer) error { return w.WriteTimestamp(tc.t) }},
+			{"WriteTime", func(w *Writer) error { return w.WriteTime(tc.t) }},
+		} {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			if err := write.fn(w); err != nil {
+				t.Fatal(err)
+			}
+			w.Flush()
+			if !bytes.Equal(buf.Bytes(), tc.enc) {
+				t.Errorf("%s: %s wrote %x; want %x", name, write.name, buf.Bytes(), tc.enc)
+			}
+		}
+
+		// and read back in UTC
+		if typ := NextType(tc.enc); typ != TimeType {
+			t.Errorf("%s: NextType is %s", name, typ)
+		}
+		out, left, err := ReadTimeBytes(tc.enc)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if len(left) > 0 || !out.Equal(tc.t) || out.Location() != time.UTC {
+			t.Errorf("%s: read %s, with %d bytes left", name, out, len(left))
+		}
+		i, _, err := ReadIntfBytes(tc.enc)
+		if err != nil || !i.(time.Time).Equal(tc.t) {
+			t.Errorf("%s: ReadIntfBytes read %v (%v)", name, i, err)
+		}
+
+		// at the very end of a stream, too
+		r := NewReader(bytes.NewReader(tc.enc))
+		if typ, err := r.NextType(); typ != TimeType || err != nil {
+			t.Errorf("%s: Reader.NextType is %s (%v)", name, typ, err)
+		}
+		out, err = r.ReadTime()
+		if err != nil {
+			t.Fatalf("%s: ReadTime: %s", name, err)
+		}
+		if !out.Equal(tc.t) || out.Location() != time.UTC {
+			t.Errorf("%s: ReadTime read %s", name, out)
+		}
+	}
+}
+
+func TestTimestampLimits(t *testing.T) {
+	// each form is used as far as it goes
+	tests := []struct {
+		t    time.Time
+		size int
+	}{
+		{time.Unix(1<<32-1, 0), 6},
+		{time.Unix(1<<32-1, 1), 10},
+		{time.Unix(1<<32, 0), 10},
+		{time.Unix(1<<34-1, 999999999), 10},
+		{time.Unix(1<<34, 0), 15},
+		{time.Unix(-1, 999999999), 15},
+		{time.Time{}, 15},
+		{time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC), 15},
+	}
+	for _, tt := range tests {
+		b := AppendTimestamp(nil, tt.t)
+		if len(b) != tt.size {
+			t.Errorf("%s: wrote %d bytes; want %d", tt.t, len(b), tt.size)
+		}
+		out, _, err := ReadTimeBytes(b)
+		if err != nil || !out.Equal(tt.t) {
+			t.Errorf("%s: read back %s (%v)", tt.t, out, err)
+		}
+	}
+}
+
+func TestTimeStillReadsItsOwnForm(t *testing.T) {
+	// AppendTimeExtension's form keeps the
+	// location, and ReadTime reads it as before
+	in := time.Date(2020, 2, 29, 12, 0, 0, 5, time.FixedZone("X", -7200))
+	out, left, err := ReadTimeBytes(AppendTimeExtension(nil, in))
+	if err != nil || len(left) > 0 || !out.Equal(in) {
+		t.Fatalf("read %s (%v), with %d bytes left", out, err, len(left))
+	}
+	if _, off := out.Zone(); off != -7200 {
+		t.Errorf("the offset is %d", off)
+	}
+}
+
+func TestTimestampErrors(t *testing.T) {
+	ext := func(data []byte) []byte {
+		return append(AppendExtensionHeader(nil, TimestampExtension, len(data)), data...)
+	}
+	nsec := make([]byte, 12)
+	big.PutUint32(nsec, 1e9)
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{"1 byte", ext([]byte{1})},
+		{"16 bytes", ext(make([]byte, 16))},
+		{"5 bytes", ext(make([]byte, 5))},
+		{"a second of nanoseconds", ext(nsec)},
+		{"64 bits with a second of nanoseconds", ext([]byte{0xee, 0x6b, 0x28, 0, 0, 0, 0, 0})},
+	}
+	// the next object is read
+	// after each error
+	next := AppendString(nil, "next")
+	for _, tt := range tests {
+		msg := append(tt.msg, next...)
+		_, left, err := ReadTimeBytes(msg)
+		if _, ok := err.(TimestampError); !ok {
+			t.Errorf("%s: got error %v; want a TimestampError", tt.name, err)
+		}
+		if !bytes.Equal(left, next) {
+			t.Errorf("%s: %x left; want the next object", tt.name, left)
+		}
+
+		r := NewReader(bytes.NewReader(msg))
+		_, err = r.ReadTime()
+		if _, ok := err.(TimestampError); !ok {
+			t.Errorf("%s: Reader: got error %v; want a TimestampError", tt.name, err)
+		}
+		if s, err := r.ReadString(); s != "next" || err != nil {
+			t.Errorf("%s: the reader is at (%q, %v), not the next object", tt.name, s, err)
+		}
+	}
+
+	// a timestamp cut short
+	if _, _, err := ReadTimeBytes([]byte{mfixext8, 0xff, 0, 0}); err != ErrShortBytes {
+		t.Errorf("got error %v; want ErrShortBytes", err)
+	}
+	// other extensions aren't times
+	if _, _, err := ReadTimeBytes(AppendComplex64(nil, 1)); err == nil {
+		t.Error("ReadTimeBytes read a complex64")
+	}
+}
+
+func TestTimestampJSON(t *testing.T) {
+	in := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	want, _ := in.MarshalJSON()
+	msg := AppendTimestamp(AppendArrayHeader(nil, 1), in)
+
+	var buf bytes.Buffer
+	if _, err := UnmarshalAsJSON(&buf, msg); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "["+string(want)+"]" {
+		t.Errorf("UnmarshalAsJSON wrote %s", got)
+	}
+	buf.Reset()
+	if _, err := CopyToJSON(&buf, bytes.NewReader(msg)); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "["+string(want)+"]" {
+		t.Errorf("CopyToJSON wrote %s", got)
+	}
+}
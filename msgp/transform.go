@@ -0,0 +1,147 @@
+package msgp
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+var (
+	transformReg   map[string]transform
+	transformSizes map[string]func(int) int
+	transformLock  sync.RWMutex
+)
+
+func init() {
+	transformReg = make(map[string]transform)
+	transformSizes = make(map[string]func(int) int)
+}
+
+type transform struct {
+	enc func([]byte) ([]byte, error)
+	dec func([]byte) ([]byte, error)
+}
+
+// RegisterTransform registers a pair of functions
+// under 'name' so that they can be used by generated
+// code for fields tagged with `msg:",transform=name"`.
+// The value of such a field is encoded as MessagePack,
+// passed through enc, and written as 'bin'; decoding
+// passes the 'bin' payload through dec before decoding
+// the value. Generated code passes dec a copy of the
+// payload, so dec may modify it in place. If enc
+// can make its input larger, register how much
+// larger with RegisterTransformSize. It is safe to
+// call concurrently with TransformEncode and
+// TransformDecode, but it's meant to be called
+// during initialization.
+//
+// For example, to encrypt a field at rest:
+//
+//	msgp.RegisterTransform("pii", encrypt, decrypt)
+func RegisterTransform(name string, enc func([]byte) ([]byte, error), dec func([]byte) ([]byte, error)) {
+	transformLock.Lock()
+	transformReg[name] = transform{enc: enc, dec: dec}
+	transformLock.Unlock()
+}
+
+// RegisterTransformSize registers a function that
+// returns the largest number of bytes the encoding
+// function of the transform 'name' can return for
+// 'n' bytes of input, so that generated Msgsize
+// methods don't underestimate the size of a field
+// it transforms. Without one, the transform is
+// assumed not to make its input any larger.
+//
+// For example, if encrypt adds a 12-byte nonce
+// and a 16-byte tag:
+//
+//	msgp.RegisterTransformSize("pii", func(n int) int { return n + 28 })
+func RegisterTransformSize(name string, size func(n int) int) {
+	transformLock.Lock()
+	transformSizes[name] = size
+	transformLock.Unlock()
+}
+
+// TransformSize returns the largest size that the
+// transform 'name' encodes 'n' bytes to, according
+// to the function registered with RegisterTransformSize,
+// or 'n' if none has been registered.
+func TransformSize(name string, n int) int {
+	transformLock.RLock()
+	size := transformSizes[name]
+	transformLock.RUnlock()
+	if size == nil {
+		return n
+	}
+	return size(n)
+}
+
+// lookupTransform returns the
+// transform registered as 'name'
+func lookupTransform(name string) (transform, bool) {
+	transformLock.RLock()
+	t, ok := transformReg[name]
+	transformLock.RUnlock()
+	return t, ok
+}
+
+// TransformError is returned when
+// a transform is used that has not
+// been registered with RegisterTransform
+type TransformError string
+
+// Error implements the error interface
+func (t TransformError) Error() string {
+	return fmt.Sprintf("msgp: transform %q has not been registered", string(t))
+}
+
+// Resumable returns false.
+func (t TransformError) Resumable() bool { return false }
+
+// TransformEncode passes 'b' through the encoding
+// function registered under 'name'.
+func TransformEncode(name string, b []byte) ([]byte, error) {
+	t, ok := lookupTransform(name)
+	if !ok {
+		return nil, TransformError(name)
+	}
+	return t.enc(b)
+}
+
+// TransformDecode passes 'b' through the decoding
+// function registered under 'name'.
+func TransformDecode(name string, b []byte) ([]byte, error) {
+	t, ok := lookupTransform(name)
+	if !ok {
+		return nil, TransformError(name)
+	}
+	return t.dec(b)
+}
+
+// AppendEncodeMsg appends what 'encode', an
+// EncodeMsg method, writes to 'b'. Generated
+// code uses it to transform a field whose type
+// has no MarshalMsg method, because only the
+// EncodeMsg and DecodeMsg methods were generated
+// for it (-marshal=false).
+func AppendEncodeMsg(b []byte, encode func(*Writer) error) ([]byte, error) {
+	buf := bytes.NewBuffer(b)
+	w := popWriter(buf)
+	err := encode(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	pushWriter(w)
+	return buf.Bytes(), err
+}
+
+// DecodeMsgBytes calls 'decode', a DecodeMsg
+// method, to read from 'b'. It is the reverse
+// of AppendEncodeMsg.
+func DecodeMsgBytes(b []byte, decode func(*Reader) error) error {
+	r := NewReaderBytes(b)
+	err := decode(r)
+	FreeR(r)
+	return err
+}
@@ -0,0 +1,74 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func xor(b []byte) ([]byte, error) {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ 0x5a
+	}
+	return out, nil
+}
+
+func TestTransform(t *testing.T) {
+	RegisterTransform("xor", xor, xor)
+
+	in := AppendString(nil, "123-45-6789")
+	enc, err := TransformEncode("xor", in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(enc, in) {
+		t.Error("transform didn't change the input")
+	}
+	dec, err := TransformDecode("xor", enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, in) {
+		t.Errorf("%q in; %q out", in, dec)
+	}
+
+	_, err = TransformDecode("not-registered", enc)
+	if _, ok := err.(TransformError); !ok {
+		t.Errorf("expected TransformError; got %v", err)
+	}
+	if !IsError(err) {
+		t.Error("expected TransformError to be a msgp error")
+	}
+}
+
+func TestTransformSize(t *testing.T) {
+	if n := TransformSize("unsized", 10); n != 10 {
+		t.Errorf("unsized transform: got %d; want 10", n)
+	}
+	RegisterTransformSize("sized", func(n int) int { return 2*n + 1 })
+	if n := TransformSize("sized", 10); n != 21 {
+		t.Errorf("sized transform: got %d; want 21", n)
+	}
+}
+
+func TestAppendEncodeMsg(t *testing.T) {
+	in := &RawExtension{Type: 7, Data: []byte("payload")}
+	b, err := AppendEncodeMsg([]byte("prefix"), func(w *Writer) error { return w.WriteExtension(in) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := AppendExtension([]byte("prefix"), in)
+	if !bytes.Equal(b, want) {
+		t.Fatalf("got %x; want %x", b, want)
+	}
+
+	out := &RawExtension{Type: 7}
+	err = DecodeMsgBytes(b[len("prefix"):], func(r *Reader) error { return r.ReadExtension(out) })
+	if err != nil || !bytes.Equal(out.Data, in.Data) {
+		t.Errorf("read %q (%v)", out.Data, err)
+	}
+	err = DecodeMsgBytes(b[len("prefix"):len(b)-1], func(r *Reader) error { return r.ReadExtension(out) })
+	if err == nil {
+		t.Error("read an extension cut short")
+	}
+}
@@ -0,0 +1,213 @@
+package msgp
+
+import (
+	"fmt"
+	"testing"
+)
+
+// The wire coverage of the tests is the set of prefixes
+// that each of the four ways of writing and reading
+// has produced or consumed. Each prefix is its own
+// class, apart from the fix families (fixint, fixstr,
+// ...), which are one class each. Tests record what
+// they wrote and read with markWire, and
+// TestWireCoverage checks the matrix of classes and
+// surfaces when they're done.
+
+// a wireSurface is a way of writing or reading
+type wireSurface uint8
+
+const (
+	wireWriter wireSurface = iota
+	wireAppend
+	wireReader
+	wireBytes
+	wireSurfaces
+)
+
+func (s wireSurface) String() string {
+	switch s {
+	case wireWriter:
+		return "Writer"
+	case wireAppend:
+		return "Append"
+	case wireReader:
+		return "Reader"
+	case wireBytes:
+		return "Bytes"
+	default:
+		return "<invalid>"
+	}
+}
+
+// wireCoverageMin is the fraction of the cells
+// that the tests have to cover. The cells that
+// aren't covered are array32 and map32, since
+// the tests don't write 65536 objects in one
+// array or map.
+const wireCoverageMin = 0.9
+
+// the names of the prefixes that
+// aren't in one of the fix families
+var wireNames = map[byte]string{
+	mnil: "nil", mfalse: "false", mtrue: "true",
+	mfloat32: "float32", mfloat64: "float64",
+	mint8: "int8", mint16: "int16", mint32: "int32", mint64: "int64",
+	muint8: "uint8", muint16: "uint16", muint32: "uint32", muint64: "uint64",
+	mstr8: "str8", mstr16: "str16", mstr32: "str32",
+	mbin8: "bin8", mbin16: "bin16", mbin32: "bin32",
+	marray16: "array16", marray32: "array32",
+	mmap16: "map16", mmap32: "map32",
+	mfixext1: "fixext1", mfixext2: "fixext2", mfixext4: "fixext4",
+	mfixext8: "fixext8", mfixext16: "fixext16",
+	mext8: "ext8", mext16: "ext16", mext32: "ext32",
+}
+
+var (
+	// wireClass is the class of each prefix,
+	// or -1 for the prefixes that aren't used
+	wireClass [256]int8
+
+	// wireClasses are the names of the
+	// classes, in order of their first prefix
+	wireClasses []string
+
+	// wireSeen is bit c of the classes
+	// that each surface has covered
+	wireSeen [wireSurfaces]uint64
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		b := byte(i)
+		var name string
+		switch {
+		case specs[b].typ == InvalidType:
+			wireClass[i] = -1
+			continue
+		case isfixint(b):
+			name = "fixint"
+		case isnfixint(b):
+			name = "negative fixint"
+		case isfixmap(b):
+			name = "fixmap"
+		case isfixarray(b):
+			name = "fixarray"
+		case isfixstr(b):
+			name = "fixstr"
+		default:
+			name = wireNames[b]
+		}
+		if n := len(wireClasses); n == 0 || wireClasses[n-1] != name {
+			wireClasses = append(wireClasses, name)
+		}
+		wireClass[i] = int8(len(wireClasses) - 1)
+	}
+	if len(wireClasses) > 64 {
+		panic("msgp: too many wire classes for wireSeen")
+	}
+}
+
+// markWire records the prefixes of the
+// objects in 'b' as covered by 's'. It
+// stops at the first invalid prefix.
+func markWire(s wireSurface, b []byte) {
+	for len(b) > 0 {
+		c := wireClass[b[0]]
+		if c < 0 {
+			return
+		}
+		wireSeen[s] |= 1 << uint(c)
+		sp := &specs[b[0]]
+		if len(b) < int(sp.size) {
+			return
+		}
+		// the objects in maps and arrays
+		// follow their headers
+		n := int(sp.size)
+		if sp.lenw > 0 && sp.typ != MapType && sp.typ != ArrayType {
+			n += int(sp.length(b))
+		}
+		if n > len(b) {
+			return
+		}
+		b = b[n:]
+	}
+}
+
+// wireMissing returns the cells that
+// haven't been covered, and the number
+// of cells
+func wireMissing() ([]string, int) {
+	var missing []string
+	for s := wireSurface(0); s < wireSurfaces; s++ {
+		for c, name := range wireClasses {
+			if wireSeen[s]&(1<<uint(c)) == 0 {
+				missing = append(missing, fmt.Sprintf("%s %s", s, name))
+			}
+		}
+	}
+	return missing, int(wireSurfaces) * len(wireClasses)
+}
+
+func TestMarkWire(t *testing.T) {
+	saved := wireSeen
+	defer func() { wireSeen = saved }()
+	wireSeen = [wireSurfaces]uint64{}
+
+	var b []byte
+	b = AppendArrayHeader(b, 3)
+	b = AppendString(b, string(make([]byte, 40)))
+	b = AppendMapHeader(b, 1)
+	b = AppendString(b, "k")
+	b = AppendComplex64(b, 1)
+	b = AppendInt64(b, -1)
+	markWire(wireAppend, b)
+
+	want := []string{"fixarray", "str8", "fixmap", "fixstr", "fixext8", "negative fixint"}
+	got := make(map[string]bool)
+	for c, name := range wireClasses {
+		if wireSeen[wireAppend]&(1<<uint(c)) != 0 {
+			got[name] = true
+		}
+	}
+	for _, w := range want {
+		if !got[w] {
+			t.Errorf("%s isn't marked", w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("marked %v; want only %q", got, want)
+	}
+	for s := wireSurface(0); s < wireSurfaces; s++ {
+		if s != wireAppend && wireSeen[s] != 0 {
+			t.Errorf("marked the %s surface", s)
+		}
+	}
+}
+
+// TestWireCoverage fails if the tests that ran
+// before it haven't covered enough of the wire
+// format. If it runs alone, it runs the
+// symmetry checks first.
+func TestWireCoverage(t *testing.T) {
+	if wireSeen == [wireSurfaces]uint64{} {
+		for seed := int64(0); seed < 2000; seed++ {
+			if err := checkSymmetry(seed); err != nil {
+				t.Fatalf("seed %d: %s", seed, err)
+			}
+		}
+	}
+	missing, cells := wireMissing()
+	covered := float64(cells-len(missing)) / float64(cells)
+	if covered < wireCoverageMin {
+		t.Errorf("the tests covered %d of %d cells (%.0f%%; want %.0f%%); missing:", cells-len(missing), cells, covered*100, wireCoverageMin*100)
+		for _, m := range missing {
+			t.Errorf("\t%s", m)
+		}
+		return
+	}
+	for _, m := range missing {
+		t.Logf("not covered: %s", m)
+	}
+}
@@ -12,7 +12,11 @@ import (
 )
 
 func abs(i int64) int64 {
-	if i < 0 {
+	switch {
+	case i == math.MinInt64:
+		// -i would overflow
+		return math.MaxInt64
+	case i < 0:
 		return -i
 	}
 	return i
@@ -52,6 +56,7 @@ func init() {
 
 func popWriter(w io.Writer) *Writer {
 	wr := writerPool.Get().(*Writer)
+	wr.opts = EncodeOptions{}
 	wr.Reset(w)
 	return wr
 }
@@ -59,6 +64,7 @@ func popWriter(w io.Writer) *Writer {
 func pushWriter(wr *Writer) {
 	if wr != nil && cap(wr.buf) > 256 {
 		wr.w = nil
+		wr.flushFn = nil
 		writerPool.Put(wr)
 	}
 }
@@ -78,7 +84,11 @@ func Require(old []byte, extra int) []byte {
 	if len(old) == 0 {
 		return make([]byte, 0, extra)
 	}
-	n := make([]byte, len(old), cap(old)-len(old)+extra)
+	// it grows as append would, so that
+	// marshaling many values one after
+	// another into a slice doesn't copy
+	// it for each of them
+	n := make([]byte, len(old), 2*cap(old)+extra)
 	copy(n, old)
 	return n
 }
@@ -110,10 +120,16 @@ type Encodable interface {
 // MessagePack objects to an io.Writer.
 // You must call *Writer.Flush() in order
 // to flush all of the buffered data
-// to the underlying writer.
+// to the underlying writer. To write to
+// the underlying writer directly in
+// between, use *Writer.InnerWriter().
 type Writer struct {
-	w   io.Writer
-	buf []byte // buffered data; [0:len(buf)] is valid
+	w       io.Writer
+	flushFn func([]byte) error // takes the flushed buffers instead of w; see SetFlushFunc
+	buf     []byte             // buffered data; [0:len(buf)] is valid
+	opts    EncodeOptions      // see ApplyOptions
+	pending []pendingHeader    // deferred headers that haven't been set
+	lastid  uint32             // last Fixup id handed out
 }
 
 // NewWriter returns a new *Writer.
@@ -135,6 +151,15 @@ func NewWriterSize(w io.Writer, sz int) *Writer {
 	}
 }
 
+// NewWriterBuf returns a writer that appends
+// to 'buf' instead of writing to an io.Writer.
+// Flush does nothing, since the data is never
+// written anywhere; use Bytes to retrieve 'buf'
+// with everything written to the Writer appended.
+func NewWriterBuf(buf []byte) *Writer {
+	return &Writer{buf: buf}
+}
+
 // Encode encodes an Encodable to an io.Writer.
 func Encode(w io.Writer, e Encodable) error {
 	wr := NewWriter(w)
@@ -158,31 +183,107 @@ func Write(w io.Writer, m Marshaler) error {
 }
 
 func (mw *Writer) flush() error {
-	if len(mw.buf) > 0 {
-		n, err := mw.w.Write(mw.buf)
-		if err != nil {
-			// copy unwritten data
-			// back to index 0
-			if n > 0 {
-				mw.buf = mw.buf[:copy(mw.buf[0:], mw.buf[n:])]
-			}
-			return err
-		}
-		mw.buf = mw.buf[0:0]
+	if mw.w == nil && mw.flushFn == nil {
+		// see NewWriterBuf
 		return nil
 	}
-	return nil
+	l := len(mw.buf)
+	if len(mw.pending) > 0 {
+		// hold everything from the
+		// first unset header onwards
+		l = mw.pending[0].off
+	}
+	if l == 0 {
+		return nil
+	}
+	if mw.flushFn != nil {
+		return mw.handoff(l)
+	}
+	n, err := mw.w.Write(mw.buf[:l])
+	if err == nil {
+		n = l
+	}
+	// copy unwritten data
+	// back to index 0
+	if n > 0 {
+		mw.buf = mw.buf[:copy(mw.buf[0:], mw.buf[n:])]
+		for i := range mw.pending {
+			mw.pending[i].off -= n
+		}
+	}
+	return err
+}
+
+// handoff passes the first 'l' bytes of the
+// buffer to flushFn, which keeps them, and
+// carries on with a new buffer of the same size
+func (mw *Writer) handoff(l int) error {
+	full := mw.buf[:l:l]
+	rest := mw.buf[l:]
+	mw.buf = make([]byte, len(rest), cap(mw.buf))
+	copy(mw.buf, rest)
+	for i := range mw.pending {
+		mw.pending[i].off -= l
+	}
+	return mw.flushFn(full)
 }
 
 // Flush flushes all of the buffered
-// data to the underlying writer.
+// data to the underlying writer, up to
+// the first deferred header that hasn't
+// been set. (See WriteMapHeaderDeferred.)
 func (mw *Writer) Flush() error { return mw.flush() }
 
+// SetFlushFunc makes the Writer pass its buffer
+// to 'fn' whenever it would write it to the
+// underlying writer, in place of the writer:
+// when it fills up, and on Flush. The buffer
+// isn't copied first; 'fn' owns it from then on,
+// even if it returns an error, and the Writer
+// carries on in a new buffer of the same size.
+// This hands the encoded data over without
+// copying it, for example into a ring of buffers.
+// A buffer may end partway through an object; the
+// buffers can be read back as one stream with
+// NewMultiReaderBytes. Data written to the Writer
+// is always buffered, however big it is, so
+// that 'fn' only ever sees the Writer's buffers.
+//
+// A nil 'fn' makes the Writer behave like one
+// returned by NewWriterBuf. Reset ends the mode.
+func (mw *Writer) SetFlushFunc(fn func([]byte) error) {
+	mw.w = nil
+	mw.flushFn = fn
+}
+
 // Buffered returns the number bytes in the write buffer
 func (mw *Writer) Buffered() int { return len(mw.buf) }
 
+// Bytes returns the write buffer. For a Writer
+// returned by NewWriterBuf, that is everything
+// written so far. The returned slice is only
+// valid until the next write to the Writer.
+func (mw *Writer) Bytes() []byte { return mw.buf }
+
 func (mw *Writer) avail() int { return cap(mw.buf) - len(mw.buf) }
 
+// grow makes room for at least 'n' more
+// bytes in the buffer, which may be holding
+// data behind a deferred header, or everything
+// written to a Writer from NewWriterBuf
+func (mw *Writer) grow(n int) {
+	if mw.avail() >= n {
+		return
+	}
+	sz := len(mw.buf) + n
+	if len(mw.buf) > 0 && sz < 2*cap(mw.buf) {
+		sz = 2 * cap(mw.buf)
+	}
+	nb := make([]byte, len(mw.buf), sz)
+	copy(nb, mw.buf)
+	mw.buf = nb
+}
+
 func (mw *Writer) require(n int) (int, error) {
 	if mw.avail() >= n {
 		o := len(mw.buf)
@@ -193,14 +294,12 @@ func (mw *Writer) require(n int) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	// after flush,
-	// len(mw.buf) = 0
-	if n > cap(mw.buf) {
-		mw.buf = make([]byte, n)
-		return 0, nil
-	}
-	mw.buf = mw.buf[:n]
-	return 0, nil
+	// after flush, len(mw.buf) = 0
+	// unless a deferred header is unset
+	mw.grow(n)
+	o := len(mw.buf)
+	mw.buf = mw.buf[:o+n]
+	return o, nil
 }
 
 // Write implements io.Writer, and writes
@@ -217,11 +316,11 @@ func (mw *Writer) Write(p []byte) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	if l > cap(mw.buf) {
+	if l > cap(mw.buf) && len(mw.buf) == 0 && mw.w != nil {
 		return mw.w.Write(p)
 	}
-	mw.buf = mw.buf[:l]
-	copy(mw.buf, p)
+	mw.grow(l)
+	mw.buf = append(mw.buf, p...)
 	return l, nil
 }
 
@@ -238,12 +337,12 @@ func (mw *Writer) writeString(s string) error {
 	if err != nil {
 		return err
 	}
-	if l > cap(mw.buf) {
+	if l > cap(mw.buf) && len(mw.buf) == 0 && mw.w != nil {
 		_, err := io.WriteString(mw.w, s)
 		return err
 	}
-	mw.buf = mw.buf[:l]
-	copy(mw.buf, s)
+	mw.grow(l)
+	mw.buf = append(mw.buf, s...)
 	return nil
 }
 
@@ -262,9 +361,7 @@ func (mw *Writer) Encode(m Marshaler) error {
 			if err != nil {
 				return err
 			}
-			if sz > cap(mw.buf) {
-				mw.buf = make([]byte, 0, sz)
-			}
+			mw.grow(sz)
 		}
 	} else if mw.avail() < 3*cap(mw.buf)/4 {
 		// flush if more than 3/4 full
@@ -283,10 +380,97 @@ func (mw *Writer) Encode(m Marshaler) error {
 	return nil
 }
 
-// Reset changes the underlying writer used by the MsgWriter
+// AppendMsg appends to the buffer with 'fn', which
+// is usually the MarshalMsg method of a value, so
+// that the bytes don't have to be copied. The
+// generated EncodeMsg methods are written this way.
+// The buffer is flushed first if it's more than half
+// full; after that, it grows to fit whatever 'fn'
+// appends, however big it is, and if it had to grow,
+// it's flushed again and goes back to its size, so
+// that one huge value doesn't grow it for good. If
+// 'fn' returns an error, nothing it appended is kept.
+// If the Writer uses EncodeOptions.OldSpec, what 'fn'
+// appends is rewritten as the Write methods would
+// write it: a 'str8' or 'bin' becomes a 'str'; if it
+// uses EncodeOptions.LegacyTime, a timestamp becomes
+// a time extension.
+func (mw *Writer) AppendMsg(fn func(b []byte) ([]byte, error)) error {
+	if mw.avail() < cap(mw.buf)/2 {
+		err := mw.flush()
+		if err != nil {
+			return err
+		}
+	}
+	old := mw.buf
+	b, err := fn(mw.buf)
+	if err != nil {
+		return err
+	}
+	if mw.opts.OldSpec || mw.opts.LegacyTime {
+		// 'b' holds the bytes that are rewritten,
+		// so they're copied out of its way first
+		src := append([]byte(nil), b[len(old):]...)
+		b, err = appendWithOptions(b[:len(old)], src, &mw.opts)
+		if err != nil {
+			return err
+		}
+	}
+	mw.buf = b
+	if cap(b) > cap(old) {
+		err = mw.flush()
+		if err != nil {
+			return err
+		}
+		// unless there's no io.Writer (see NewWriterBuf),
+		// or a header is pending, it's all been written
+		if len(mw.buf) == 0 {
+			mw.buf = old[:0]
+		}
+	}
+	return nil
+}
+
+// appendWithOptions appends the objects in 'src'
+// to 'dst', rewriting each 'str8' and 'bin' as the
+// 'str' that a Writer with EncodeOptions.OldSpec
+// writes, and each timestamp as the time extension
+// that one with EncodeOptions.LegacyTime writes;
+// everything else is copied as it is
+func appendWithOptions(dst []byte, src []byte, opt *EncodeOptions) ([]byte, error) {
+	for len(src) > 0 {
+		sz, _, err := getSize(src)
+		if err != nil {
+			return dst, err
+		}
+		if sz > len(src) {
+			return dst, ErrShortBytes
+		}
+		switch {
+		case opt.OldSpec && (src[0] == mstr8 || src[0] == mbin8 || src[0] == mbin16 || src[0] == mbin32):
+			dst = appendStrBody(dst, src[specs[src[0]].size:sz])
+		case opt.LegacyTime && isTimestamp(src[:sz]):
+			t, err := timestampOf(src[:sz])
+			if err != nil {
+				return dst, err
+			}
+			dst = AppendTimeExtension(dst, t)
+		default:
+			dst = append(dst, src[:sz]...)
+		}
+		src = src[sz:]
+	}
+	return dst, nil
+}
+
+// Reset changes the underlying writer used by the MsgWriter.
+// A nil io.Writer makes it behave like a Writer returned
+// by NewWriterBuf, starting from an empty buffer.
 func (mw *Writer) Reset(w io.Writer) {
 	mw.w = w
+	mw.flushFn = nil
 	mw.buf = mw.buf[0:0]
+	mw.pending = mw.pending[:0]
 }
 
 // WriteMapHeader writes a map header of the given
@@ -471,11 +655,16 @@ func (mw *Writer) WriteUint32(u uint32) error { return mw.WriteUint64(uint64(u))
 func (mw *Writer) WriteUint(u uint) error { return mw.WriteUint64(uint64(u)) }
 
 // WriteBytes writes binary as 'bin' to the writer
+// (or as 'str' if the writer uses EncodeOptions.OldSpec)
 func (mw *Writer) WriteBytes(b []byte) error {
 	sz := uint32(len(b))
 
 	// write size
 	switch {
+	case mw.opts.OldSpec:
+		if err := mw.writeStrHeader(sz); err != nil {
+			return err
+		}
 	case sz < math.MaxUint8:
 		mw.buf = append(mw.buf, mbin8, byte(sz))
 	case sz < math.MaxUint16:
@@ -510,13 +699,18 @@ func (mw *Writer) WriteBool(b bool) error {
 // WriteString writes a string to the writer.
 // (This is NOT an implementation of io.StringWriter)
 func (mw *Writer) WriteString(s string) error {
-	sz := uint32(len(s))
+	if err := mw.writeStrHeader(uint32(len(s))); err != nil {
+		return err
+	}
+	return mw.writeString(s)
+}
 
-	// write size
+// writeStrHeader writes the prefix of a 'str' of length 'sz'
+func (mw *Writer) writeStrHeader(sz uint32) error {
 	switch {
 	case sz < 32:
 		mw.buf = append(mw.buf, wfixstr(uint8(sz)))
-	case sz < 256:
+	case sz < 256 && !mw.opts.OldSpec:
 		mw.buf = append(mw.buf, mstr8, byte(sz))
 	case sz < (1<<16)-1:
 		o, err := mw.require(3)
@@ -531,9 +725,7 @@ func (mw *Writer) WriteString(s string) error {
 		}
 		prefixu32(mw.buf[o:], mstr32, sz)
 	}
-
-	// write body
-	return mw.writeString(s)
+	return nil
 }
 
 // WriteComplex64 writes a complex64 to the writer
@@ -603,8 +795,22 @@ func (mw *Writer) WriteIdent(e Encodable) error {
 	return e.EncodeMsg(mw)
 }
 
-// WriteTime writes a time.Time object to the wire
+// WriteTime writes a time.Time as AppendTime does:
+// as a timestamp of the MessagePack spec, in the
+// smallest form that holds it, or, if the Writer
+// uses EncodeOptions.LegacyTime, as WriteTimeExtension
+// does.
 func (mw *Writer) WriteTime(t time.Time) error {
+	if mw.opts.LegacyTime {
+		return mw.WriteTimeExtension(t)
+	}
+	return mw.WriteTimestamp(t)
+}
+
+// WriteTimeExtension writes a time.Time as
+// AppendTimeExtension does, with its location,
+// in the form WriteTime used to write.
+func (mw *Writer) WriteTimeExtension(t time.Time) error {
 	var bts []byte
 	var err error
 	bts, err = t.MarshalBinary()
@@ -624,13 +830,19 @@ func (mw *Writer) WriteTime(t time.Time) error {
 
 // WriteIntf writes the concrete type of 'v'.
 // WriteIntf will error if 'v' is not one of the following:
+//  - 'nil'
 //  - A bool, float, string, []byte, int, uint, or complex
 //  - A map of supported types (with string keys)
 //  - An array or slice of supported types
 //  - A pointer to a supported type
 //  - A type that satisfies the msgp.Encodable interface
 //  - A type that satisfies the msgp.Extension interface
+// Nil pointers, maps and slices are written as nil,
+// which ReadIntf reads back as an untyped nil.
 func (mw *Writer) WriteIntf(v interface{}) error {
+	if isNil(v) {
+		return mw.WriteNil()
+	}
 	if enc, ok := v.(Encodable); ok {
 		return enc.EncodeMsg(mw)
 	}
@@ -640,9 +852,6 @@ func (mw *Writer) WriteIntf(v interface{}) error {
 	if ext, ok := v.(Extension); ok {
 		return mw.WriteExtension(ext)
 	}
-	if v == nil {
-		return mw.WriteNil()
-	}
 	switch v.(type) {
 	case bool:
 		return mw.WriteBool(v.(bool))
@@ -693,9 +902,6 @@ func (mw *Writer) WriteIntf(v interface{}) error {
 
 	switch val.Kind() {
 	case reflect.Ptr:
-		if val.IsNil() {
-			return mw.WriteNil()
-		}
 		return mw.WriteIntf(val.Elem().Interface())
 	case reflect.Slice:
 		return mw.writeSlice(val)
@@ -705,9 +911,44 @@ func (mw *Writer) WriteIntf(v interface{}) error {
 	return fmt.Errorf("msgp: type %s not supported", val.Type())
 }
 
+// isNil returns whether or not 'v' is
+// nil, or a nil pointer, map or slice
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		return val.IsNil()
+	default:
+		return false
+	}
+}
+
+// errMapKey is returned when a map
+// passed to WriteIntf or AppendIntf
+// has keys of an unsupported type
+var errMapKey = errors.New("msgp: map keys must be strings, integers or interfaces")
+
+// isMapKey returns whether or not
+// maps with keys of kind 'k' can be
+// written by WriteIntf and AppendIntf
+func isMapKey(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Interface,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
 func (mw *Writer) writeMap(v reflect.Value) (err error) {
-	if v.Elem().Kind() != reflect.String {
-		return errors.New("msgp: map keys must be strings")
+	kind := v.Type().Key().Kind()
+	if !isMapKey(kind) {
+		return errMapKey
 	}
 	ks := v.MapKeys()
 	err = mw.WriteMapHeader(uint32(len(ks)))
@@ -716,7 +957,16 @@ func (mw *Writer) writeMap(v reflect.Value) (err error) {
 	}
 	for _, key := range ks {
 		val := v.MapIndex(key)
-		err = mw.WriteString(key.String())
+		switch kind {
+		case reflect.String:
+			err = mw.WriteString(key.String())
+		case reflect.Interface:
+			err = mw.WriteIntf(key.Interface())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			err = mw.WriteUint64(key.Uint())
+		default:
+			err = mw.WriteInt64(key.Int())
+		}
 		if err != nil {
 			return
 		}
@@ -18,6 +18,13 @@ func ensure(b []byte, sz int) ([]byte, int) {
 	return o[:n+sz], n
 }
 
+// Ensure extends 'b' by 'sz' bytes, reallocating
+// if necessary, and returns the extended slice
+// along with the index of the first new byte.
+// It is used by generated code to append several
+// fixed-size objects with one capacity check.
+func Ensure(b []byte, sz int) ([]byte, int) { return ensure(b, sz) }
+
 // AppendMapHeader appends a map header with the
 // given size to the slice
 func AppendMapHeader(b []byte, sz uint32) []byte {
@@ -189,6 +196,14 @@ func AppendBool(b []byte, t bool) []byte {
 	return append(b, mfalse)
 }
 
+// BoolByte returns the encoding of 't'
+func BoolByte(t bool) byte {
+	if t {
+		return mtrue
+	}
+	return mfalse
+}
+
 // AppendString appends a string as a MessagePack 'str' to the slice
 func AppendString(b []byte, s string) []byte {
 	sz := uint32(len(s))
@@ -197,7 +212,7 @@ func AppendString(b []byte, s string) []byte {
 	case sz < 32:
 		o[n] = wfixstr(uint8(sz))
 		n++
-	case sz < math.MaxUint8:
+	case sz < 256:
 		prefixu8(o[n:], mstr8, uint8(sz))
 		n += 2
 	case sz < math.MaxUint16:
@@ -210,6 +225,35 @@ func AppendString(b []byte, s string) []byte {
 	return o[:n+copy(o[n:], s)]
 }
 
+// appendString is AppendString
+// using the options 'opt'
+func appendString(b []byte, s string, opt *EncodeOptions) []byte {
+	if opt.OldSpec {
+		return appendStrBody(b, []byte(s))
+	}
+	return AppendString(b, s)
+}
+
+// appendStrBody appends 'bts' as a 'str'
+// without using 'str8', which isn't in
+// the original MessagePack spec
+func appendStrBody(b []byte, bts []byte) []byte {
+	sz := uint32(len(bts))
+	o, n := ensure(b, BytesPrefixSize+len(bts))
+	switch {
+	case sz < 32:
+		o[n] = wfixstr(uint8(sz))
+		n++
+	case sz < math.MaxUint16:
+		prefixu16(o[n:], mstr16, uint16(sz))
+		n += 3
+	default:
+		prefixu32(o[n:], mstr32, sz)
+		n += 5
+	}
+	return o[:n+copy(o[n:], bts)]
+}
+
 // AppendComplex64 appends a complex64 to the slice as a MessagePack extension
 func AppendComplex64(b []byte, c complex64) []byte {
 	o, n := ensure(b, Complex64Size)
@@ -228,13 +272,28 @@ func AppendComplex128(b []byte, c complex128) []byte {
 	return o
 }
 
-// AppendTime appends a time.Time to the slice as a MessagePack extension
+// AppendTime appends a time.Time to the slice as a
+// timestamp of the MessagePack spec, in the smallest
+// form that holds it, as AppendTimestamp does. Its
+// location isn't written; it's read back in UTC.
+// (Times used to be written as AppendTimeExtension
+// writes them, which is still read, too.)
 func AppendTime(b []byte, t time.Time) []byte {
+	return AppendTimestamp(b, t)
+}
+
+// AppendTimeExtension appends a time.Time to the slice
+// as extension 5 (TimeExtension), which holds what
+// t.MarshalBinary returns, with its location. It's
+// what upstream msgp writes times as, so it's for
+// readers that don't read the timestamps of the spec.
+func AppendTimeExtension(b []byte, t time.Time) []byte {
 	o, n := ensure(b, TimeSize)
 	bts, _ := t.MarshalBinary()
 	o[n] = mfixext16
 	o[n+1] = TimeExtension
 	copy(o[n+2:], bts)
+	o[n+17] = 0 // padding, as WriteTimeExtension writes it
 	return o
 }
 
@@ -253,12 +312,47 @@ func AppendMapStrStr(b []byte, m map[string]string) []byte {
 // AppendMapStrIntf appends a map[string]interface{} to the slice
 // as a MessagePack map with 'str'-type keys.
 func AppendMapStrIntf(b []byte, m map[string]interface{}) ([]byte, error) {
+	return appendMapStrIntf(b, m, &EncodeOptions{})
+}
+
+func appendMapStrIntf(b []byte, m map[string]interface{}, opt *EncodeOptions) ([]byte, error) {
 	sz := uint32(len(m))
 	b = AppendMapHeader(b, sz)
 	var err error
 	for key, val := range m {
-		b = AppendString(b, key)
-		b, err = AppendIntf(b, val)
+		b = appendString(b, key, opt)
+		b, err = appendIntf(b, val, opt)
+		if err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// appendMap is appendIntf for any map
+// whose keys isMapKey supports
+func appendMap(b []byte, v reflect.Value, opt *EncodeOptions) ([]byte, error) {
+	kind := v.Type().Key().Kind()
+	if !isMapKey(kind) {
+		return b, errMapKey
+	}
+	b = AppendMapHeader(b, uint32(v.Len()))
+	var err error
+	for _, key := range v.MapKeys() {
+		switch kind {
+		case reflect.String:
+			b = appendString(b, key.String(), opt)
+		case reflect.Interface:
+			b, err = appendIntf(b, key.Interface(), opt)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			b = AppendUint64(b, key.Uint())
+		default:
+			b = AppendInt64(b, key.Int())
+		}
+		if err != nil {
+			return b, err
+		}
+		b, err = appendIntf(b, v.MapIndex(key).Interface(), opt)
 		if err != nil {
 			return b, err
 		}
@@ -270,12 +364,22 @@ func AppendMapStrIntf(b []byte, m map[string]interface{}) ([]byte, error) {
 // provided []byte. 'i' must be one of the following:
 //  - 'nil'
 //  - A bool, float, string, []byte, int, uint, or complex
-//  - A map[string]T, where T is another supported type
+//  - A map[K]T, where K is a string, integer or interface
+//    type, and T is another supported type
 //  - A []T, where T is another supported type
 //  - A *T, where T is another supported type
 //  - A type that satisfieds the msgp.Marshaler interface
 //  - A type that satisfies the msgp.Extension interface
+// Nil pointers, maps and slices are appended as nil,
+// which ReadIntfBytes reads back as an untyped nil.
 func AppendIntf(b []byte, i interface{}) ([]byte, error) {
+	return appendIntf(b, i, &EncodeOptions{})
+}
+
+func appendIntf(b []byte, i interface{}, opt *EncodeOptions) ([]byte, error) {
+	if isNil(i) {
+		return AppendNil(b), nil
+	}
 	if m, ok := i.(Marshaler); ok {
 		return m.MarshalMsg(b)
 	}
@@ -283,10 +387,6 @@ func AppendIntf(b []byte, i interface{}) ([]byte, error) {
 		return AppendExtension(b, ext)
 	}
 
-	if i == nil {
-		return AppendNil(b), nil
-	}
-
 	// all the concrete types
 	// for which we have methods
 	switch i.(type) {
@@ -301,8 +401,11 @@ func AppendIntf(b []byte, i interface{}) ([]byte, error) {
 	case complex128:
 		return AppendComplex128(b, i.(complex128)), nil
 	case string:
-		return AppendString(b, i.(string)), nil
+		return appendString(b, i.(string), opt), nil
 	case []byte:
+		if opt.OldSpec {
+			return appendStrBody(b, i.([]byte)), nil
+		}
 		return AppendBytes(b, i.([]byte)), nil
 	case int8:
 		return AppendInt8(b, i.(int8)), nil
@@ -325,15 +428,29 @@ func AppendIntf(b []byte, i interface{}) ([]byte, error) {
 	case uint64:
 		return AppendUint64(b, i.(uint64)), nil
 	case map[string]interface{}:
-		return AppendMapStrIntf(b, i.(map[string]interface{}))
+		return appendMapStrIntf(b, i.(map[string]interface{}), opt)
 	case map[string]string:
+		if opt.OldSpec {
+			m := i.(map[string]string)
+			b = AppendMapHeader(b, uint32(len(m)))
+			for key, val := range m {
+				b = appendString(b, key, opt)
+				b = appendString(b, val, opt)
+			}
+			return b, nil
+		}
 		return AppendMapStrStr(b, i.(map[string]string)), nil
+	case time.Time:
+		if opt.LegacyTime {
+			return AppendTimeExtension(b, i.(time.Time)), nil
+		}
+		return AppendTime(b, i.(time.Time)), nil
 	case []interface{}:
 		j := i.([]interface{})
 		b = AppendArrayHeader(b, uint32(len(j)))
 		var err error
 		for _, k := range j {
-			b, err = AppendIntf(b, k)
+			b, err = appendIntf(b, k, opt)
 			if err != nil {
 				return b, err
 			}
@@ -348,13 +465,19 @@ func AppendIntf(b []byte, i interface{}) ([]byte, error) {
 		l := v.Len()
 		b = AppendArrayHeader(b, uint32(l))
 		for i := 0; i < l; i++ {
-			b, err = AppendIntf(b, v.Index(i).Interface())
+			b, err = appendIntf(b, v.Index(i).Interface(), opt)
 			if err != nil {
 				return b, err
 			}
 		}
 		return b, nil
 
+	case reflect.Map:
+		return appendMap(b, v, opt)
+
+	case reflect.Ptr:
+		return appendIntf(b, v.Elem().Interface(), opt)
+
 	// TODO: maybe some struct fiddling?
 
 	default:
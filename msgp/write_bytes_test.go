@@ -3,6 +3,7 @@ package msgp
 import (
 	"bytes"
 	"testing"
+	"time"
 )
 
 func TestAppendMapHeader(t *testing.T) {
@@ -163,3 +164,67 @@ func TestAppendBool(t *testing.T) {
 		}
 	}
 }
+
+// TestUpstreamExtensions checks that complex numbers, and
+// times written by WriteTimeExtension, are written as upstream
+// philhofer/msgp writes them, so that both can decode what
+// the other encodes
+func TestUpstreamExtensions(t *testing.T) {
+	tm := time.Date(2015, 6, 1, 12, 30, 0, 123456789, time.FixedZone("", 3600))
+	tbin, err := tm.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c64 := complex64(complex(1.5, -2))
+	c128 := complex(1.5, -2)
+	tests := []struct {
+		name  string
+		write func(w *Writer) error
+		app   func(b []byte) []byte
+		head  []byte // the prefix and the extension type
+		size  int    // of the data
+	}{
+		{"complex64", func(w *Writer) error { return w.WriteComplex64(c64) }, func(b []byte) []byte { return AppendComplex64(b, c64) }, []byte{mfixext8, 3}, 8},
+		{"complex128", func(w *Writer) error { return w.WriteComplex128(c128) }, func(b []byte) []byte { return AppendComplex128(b, c128) }, []byte{mfixext16, 4}, 16},
+		{"time", func(w *Writer) error { return w.WriteTimeExtension(tm) }, func(b []byte) []byte { return AppendTimeExtension(b, tm) }, []byte{mfixext16, 5}, 16},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		if err := tt.write(wr); err != nil {
+			t.Fatal(err)
+		}
+		wr.Flush()
+		// appending over old data mustn't keep any of it
+		dirty := bytes.Repeat([]byte{0xff}, 32)
+		app := tt.app(dirty[:0])
+
+		for name, got := range map[string][]byte{"Writer": buf.Bytes(), "Append": app} {
+			if len(got) != len(tt.head)+tt.size || !bytes.Equal(got[:2], tt.head) {
+				t.Errorf("%s: %s: wrote %x", tt.name, name, got)
+				continue
+			}
+			// a time is its MarshalBinary
+			// form, padded with zeros
+			if tt.name == "time" {
+				want := append(append([]byte{}, tbin...), make([]byte, tt.size-len(tbin))...)
+				if !bytes.Equal(got[2:], want) {
+					t.Errorf("time: %s: wrote %x; want %x", name, got[2:], want)
+				}
+			}
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	// more in the slice than room left in it
+	old := make([]byte, 60, 64)
+	old[59] = 1
+	b := Require(old, 10)
+	if len(b) != 60 || cap(b)-len(b) < 10 || b[59] != 1 {
+		t.Errorf("Require(60 of 64, 10) is %d of %d", len(b), cap(b))
+	}
+	if b = Require(b, 10); cap(b) != cap(Require(b, 10)) {
+		t.Error("Require grew a slice with room")
+	}
+}
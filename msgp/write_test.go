@@ -2,8 +2,11 @@ package msgp
 
 import (
 	"bytes"
+	"errors"
 	"math"
 	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 	"unsafe"
 )
@@ -12,12 +15,28 @@ var (
 	tint8          = 126                  // cannot be most fix* types
 	tint16         = 150                  // cannot be int8
 	tint32         = math.MaxInt16 + 100  // cannot be int16
-	tint64         = math.MaxInt32 + 100  // cannot be int32
+	tint64  int64  = math.MaxInt32 + 100  // cannot be int32
 	tuint16 uint32 = 300                  // cannot be uint8
 	tuint32 uint32 = math.MaxUint16 + 100 // cannot be uint16
 	tuint64 uint64 = math.MaxUint32 + 100 // cannot be uint32
 )
 
+// testSink holds the output of
+// a Writer returned by newTestWriter
+type testSink interface {
+	Reset()
+	Bytes() []byte
+	Len() int
+}
+
+// newTestWriter returns the Writer used by
+// the Write* tests, which TestWriterBuf swaps
+// out to run them against NewWriterBuf
+var newTestWriter = func() (*Writer, testSink) {
+	var buf bytes.Buffer
+	return NewWriter(&buf), &buf
+}
+
 func RandBytes(sz int) []byte {
 	out := make([]byte, sz)
 	for i := range out {
@@ -44,9 +63,8 @@ func TestWriteMapHeader(t *testing.T) {
 		},
 	}
 
-	var buf bytes.Buffer
 	var err error
-	wr := NewWriter(&buf)
+	wr, buf := newTestWriter()
 	for _, test := range tests {
 		buf.Reset()
 		err = wr.WriteMapHeader(test.Sz)
@@ -74,9 +92,8 @@ func TestWriteArrayHeader(t *testing.T) {
 		{tuint32, []byte{marray32, byte(tuint32 >> 24), byte(tuint32 >> 16), byte(tuint32 >> 8), byte(tuint32)}},
 	}
 
-	var buf bytes.Buffer
 	var err error
-	wr := NewWriter(&buf)
+	wr, buf := newTestWriter()
 	for _, test := range tests {
 		buf.Reset()
 		err = wr.WriteArrayHeader(test.Sz)
@@ -94,8 +111,7 @@ func TestWriteArrayHeader(t *testing.T) {
 }
 
 func TestWriteNil(t *testing.T) {
-	var buf bytes.Buffer
-	wr := NewWriter(&buf)
+	wr, buf := newTestWriter()
 
 	err := wr.WriteNil()
 	if err != nil {
@@ -112,9 +128,159 @@ func TestWriteNil(t *testing.T) {
 	}
 }
 
+// nils are the typed and untyped nils
+// that WriteIntf and AppendIntf write as nil
+var nils = []interface{}{
+	nil,
+	(*int)(nil),
+	(*string)(nil),
+	(*RawExtension)(nil), // Extension
+	(*Raw)(nil),          // Marshaler and Encodable
+	[]byte(nil),
+	[]int(nil),
+	[]interface{}(nil),
+	map[string]string(nil),
+	map[string]interface{}(nil),
+	map[int]string(nil),
+}
+
+func TestWriteIntfNil(t *testing.T) {
+	for _, v := range nils {
+		wr, buf := newTestWriter()
+		err := wr.WriteIntf(v)
+		if err != nil {
+			t.Errorf("WriteIntf(%#v): %s", v, err)
+			continue
+		}
+		err = wr.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), []byte{mnil}) {
+			t.Errorf("WriteIntf(%#v) wrote %x; expected %x", v, buf.Bytes(), mnil)
+		}
+
+		bts, err := AppendIntf(nil, v)
+		if err != nil {
+			t.Errorf("AppendIntf(%#v): %s", v, err)
+			continue
+		}
+		if !bytes.Equal(bts, []byte{mnil}) {
+			t.Errorf("AppendIntf(%#v) wrote %x; expected %x", v, bts, mnil)
+		}
+	}
+}
+
+// TestIntfNilSymmetry checks that nils in any position
+// of a []interface{} are read back as untyped nils
+func TestIntfNilSymmetry(t *testing.T) {
+	x := 5
+	for _, n := range nils {
+		in := []interface{}{n, "a", n, int64(1), &x, n, []interface{}{n, n}, map[string]interface{}{"n": n}, n}
+		want := []interface{}{nil, "a", nil, int64(1), int64(5), nil, []interface{}{nil, nil}, map[string]interface{}{"n": nil}, nil}
+
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		err := wr.WriteIntf(in)
+		if err != nil {
+			t.Fatalf("WriteIntf(%#v): %s", n, err)
+		}
+		err = wr.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bts, err := AppendIntf(nil, in)
+		if err != nil {
+			t.Fatalf("AppendIntf(%#v): %s", n, err)
+		}
+		if !bytes.Equal(bts, buf.Bytes()) {
+			t.Errorf("with %#v: WriteIntf wrote %x, but AppendIntf wrote %x", n, buf.Bytes(), bts)
+		}
+
+		out, err := NewReader(&buf).ReadIntf()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("with %#v: ReadIntf returned %#v; expected %#v", n, out, want)
+		}
+		out, left, err := ReadIntfBytes(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("with %#v: %d bytes left over", n, len(left))
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("with %#v: ReadIntfBytes returned %#v; expected %#v", n, out, want)
+		}
+	}
+}
+
+// TestIntfReencode reads documents with nil, empty and
+// populated containers in nested positions with ReadIntf
+// and ReadIntfBytes, and checks that WriteIntf and
+// AppendIntf write back exactly what was read. (Each
+// map has one entry, since maps are written in no
+// particular order.)
+func TestIntfReencode(t *testing.T) {
+	// each of the values, in a map
+	// and in an array of its own
+	values := [][]byte{
+		AppendNil(nil),
+		AppendMapHeader(nil, 0),
+		AppendArrayHeader(nil, 0),
+		AppendBytes(nil, nil),
+		AppendString(nil, ""),
+		AppendNil(AppendString(AppendMapHeader(nil, 1), "k")),
+		AppendInt64(AppendArrayHeader(nil, 1), 1),
+		AppendBytes(nil, []byte("bin")),
+	}
+
+	var docs [][]byte
+	for _, v := range values {
+		docs = append(docs, v)
+		docs = append(docs, append(AppendString(AppendMapHeader(nil, 1), "v"), v...))
+		docs = append(docs, append(append(append(AppendArrayHeader(nil, 3), v...), v...), v...))
+		docs = append(docs, append(AppendString(AppendMapHeader(nil, 1), "a"), append(AppendArrayHeader(nil, 1), v...)...))
+		docs = append(docs, append(AppendArrayHeader(AppendString(AppendMapHeader(AppendArrayHeader(nil, 1), 1), "m"), 2), append(v, AppendNil(nil)...)...))
+	}
+
+	for _, doc := range docs {
+		v, err := NewReader(bytes.NewReader(doc)).ReadIntf()
+		if err != nil {
+			t.Fatalf("ReadIntf(%x): %s", doc, err)
+		}
+		var buf bytes.Buffer
+		wr := NewWriter(&buf)
+		err = wr.WriteIntf(v)
+		if err != nil {
+			t.Fatalf("WriteIntf(%#v): %s", v, err)
+		}
+		err = wr.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), doc) {
+			t.Errorf("read %x as %#v, but WriteIntf wrote %x", doc, v, buf.Bytes())
+		}
+
+		v, _, err = ReadIntfBytes(doc)
+		if err != nil {
+			t.Fatalf("ReadIntfBytes(%x): %s", doc, err)
+		}
+		out, err := AppendIntf(nil, v)
+		if err != nil {
+			t.Fatalf("AppendIntf(%#v): %s", v, err)
+		}
+		if !bytes.Equal(out, doc) {
+			t.Errorf("read %x as %#v, but AppendIntf wrote %x", doc, v, out)
+		}
+	}
+}
+
 func TestWriteFloat64(t *testing.T) {
-	var buf bytes.Buffer
-	wr := NewWriter(&buf)
+	wr, buf := newTestWriter()
 
 	for i := 0; i < 10000; i++ {
 		buf.Reset()
@@ -141,8 +307,7 @@ func TestWriteFloat64(t *testing.T) {
 }
 
 func TestWriteFloat32(t *testing.T) {
-	var buf bytes.Buffer
-	wr := NewWriter(&buf)
+	wr, buf := newTestWriter()
 
 	for i := 0; i < 10000; i++ {
 		buf.Reset()
@@ -169,8 +334,7 @@ func TestWriteFloat32(t *testing.T) {
 }
 
 func TestWriteInt64(t *testing.T) {
-	var buf bytes.Buffer
-	wr := NewWriter(&buf)
+	wr, buf := newTestWriter()
 
 	for i := 0; i < 10000; i++ {
 		buf.Reset()
@@ -193,8 +357,7 @@ func TestWriteInt64(t *testing.T) {
 }
 
 func TestWriteUint64(t *testing.T) {
-	var buf bytes.Buffer
-	wr := NewWriter(&buf)
+	wr, buf := newTestWriter()
 
 	for i := 0; i < 10000; i++ {
 		buf.Reset()
@@ -217,8 +380,7 @@ func TestWriteUint64(t *testing.T) {
 }
 
 func TestWriteBytes(t *testing.T) {
-	var buf bytes.Buffer
-	wr := NewWriter(&buf)
+	wr, buf := newTestWriter()
 	sizes := []int{0, 1, 225, int(tuint32)}
 
 	for _, size := range sizes {
@@ -240,3 +402,179 @@ func TestWriteBytes(t *testing.T) {
 		}
 	}
 }
+
+// bufSink is the testSink for a
+// Writer returned by NewWriterBuf
+type bufSink struct{ wr *Writer }
+
+func (b bufSink) Reset()        { b.wr.Reset(nil) }
+func (b bufSink) Bytes() []byte { return b.wr.Bytes() }
+func (b bufSink) Len() int      { return len(b.wr.Bytes()) }
+
+func TestWriterBuf(t *testing.T) {
+	old := newTestWriter
+	newTestWriter = func() (*Writer, testSink) {
+		wr := NewWriterBuf(nil)
+		return wr, bufSink{wr}
+	}
+	defer func() { newTestWriter = old }()
+
+	for _, test := range []struct {
+		name string
+		fn   func(*testing.T)
+	}{
+		{"MapHeader", TestWriteMapHeader},
+		{"ArrayHeader", TestWriteArrayHeader},
+		{"Nil", TestWriteNil},
+		{"Float64", TestWriteFloat64},
+		{"Float32", TestWriteFloat32},
+		{"Int64", TestWriteInt64},
+		{"Uint64", TestWriteUint64},
+		{"Bytes", TestWriteBytes},
+	} {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestWriterFlushFunc(t *testing.T) {
+	var segs [][]byte
+	wr := NewWriterSize(nil, 64)
+	wr.SetFlushFunc(func(b []byte) error {
+		segs = append(segs, b)
+		return nil
+	})
+	msg := sourceMessage()
+	wr.WriteMapHeader(3)
+	wr.WriteString("id")
+	wr.WriteInt64(1234567)
+	wr.WriteString("body")
+	wr.WriteString(strings.Repeat("payload ", 512))
+	wr.WriteString("tags")
+	wr.WriteArrayHeader(8)
+	for i := 0; i < 8; i++ {
+		wr.WriteString("tag")
+	}
+	if err := wr.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if wr.Buffered() != 0 {
+		t.Errorf("%d bytes still buffered after Flush", wr.Buffered())
+	}
+	if len(segs) < 2 {
+		t.Fatalf("expected several buffers; got %d", len(segs))
+	}
+
+	// the buffers that were handed
+	// over were never written again
+	if got := bytes.Join(segs, nil); !bytes.Equal(got, msg) {
+		t.Fatalf("got %x; want %x", got, msg)
+	}
+	if _, err := readSourceMessage(NewMultiReaderBytes(segs...), nil); err != nil {
+		t.Errorf("reading the buffers back: %s", err)
+	}
+
+	// errors are passed on
+	fail := errors.New("full")
+	wr.SetFlushFunc(func(b []byte) error { return fail })
+	wr.WriteString("more")
+	if err := wr.Flush(); err != fail {
+		t.Errorf("Flush returned %v; want %v", err, fail)
+	}
+}
+
+func TestWriterAppendMsg(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriterSize(&buf, 64)
+	wr.WriteString(strings.Repeat("a", 40))
+	big := strings.Repeat("b", 20)
+	err := wr.AppendMsg(func(b []byte) ([]byte, error) {
+		return AppendString(b, big), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the buffer was more than half full,
+	// so it was flushed before appending
+	if buf.Len() != 42 {
+		t.Errorf("flushed %d bytes first; want 42", buf.Len())
+	}
+
+	// nothing is kept from a failed append
+	fail := errors.New("fail")
+	err = wr.AppendMsg(func(b []byte) ([]byte, error) {
+		return AppendString(b, "half"), fail
+	})
+	if err != fail {
+		t.Errorf("AppendMsg returned %v; want %v", err, fail)
+	}
+	wr.WriteNil()
+	wr.Flush()
+
+	want := AppendString(nil, strings.Repeat("a", 40))
+	want = AppendString(want, big)
+	want = AppendNil(want)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("wrote %x; want %x", buf.Bytes(), want)
+	}
+}
+
+func TestWriterAppendMsgOldSpec(t *testing.T) {
+	strs := []string{"", "abc", strings.Repeat("a", 40), strings.Repeat("b", 300)}
+	opt := EncodeOptions{OldSpec: true}
+
+	// what the Write methods write...
+	var want bytes.Buffer
+	wr := NewWriterWithOptions(&want, opt)
+	wr.WriteMapHeader(uint32(len(strs)))
+	for _, s := range strs {
+		wr.WriteString(s)
+		wr.WriteBytes([]byte(s))
+	}
+	wr.WriteExtension(&RawExtension{Type: 9, Data: []byte{mstr8, mbin8}})
+	wr.Flush()
+
+	// ...is what AppendMsg writes
+	var got bytes.Buffer
+	wr = NewWriterWithOptions(&got, opt)
+	err := wr.AppendMsg(func(b []byte) ([]byte, error) {
+		b = AppendMapHeader(b, uint32(len(strs)))
+		for _, s := range strs {
+			b = AppendString(b, s)
+			b = AppendBytes(b, []byte(s))
+		}
+		return AppendExtension(b, &RawExtension{Type: 9, Data: []byte{mstr8, mbin8}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wr.Flush()
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("AppendMsg wrote %x; the Write methods wrote %x", got.Bytes(), want.Bytes())
+	}
+}
+
+func TestWriterAppendMsgShrinks(t *testing.T) {
+	var buf bytes.Buffer
+	wr := NewWriterSize(&buf, 64)
+	big := strings.Repeat("b", 1000)
+	err := wr.AppendMsg(func(b []byte) ([]byte, error) {
+		return AppendString(b, big), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the value that didn't fit is written
+	// out, and the buffer is back to its size
+	if buf.Len() != 1003 || len(wr.buf) != 0 || cap(wr.buf) != 64 {
+		t.Errorf("wrote %d bytes, and kept a buffer of %d/%d", buf.Len(), len(wr.buf), cap(wr.buf))
+	}
+
+	// one without an io.Writer keeps it all
+	wr = NewWriterBuf(nil)
+	wr.AppendMsg(func(b []byte) ([]byte, error) {
+		return AppendString(b, big), nil
+	})
+	if len(wr.buf) != 1003 {
+		t.Errorf("kept %d bytes; want 1003", len(wr.buf))
+	}
+}
@@ -1,8 +1,15 @@
 package parse
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/philhofer/msgp/gen"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -28,6 +35,276 @@ func TestAST(t *testing.T) {
 
 }
 
+// parseSource writes 'src' to a temporary
+// file and runs GetElemsOpts on it
+func parseSource(t *testing.T, src string, opts Options) ([]gen.Elem, error) {
+	dir, err := ioutil.TempDir("", "msgp-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "src.go")
+	err = ioutil.WriteFile(name, []byte(src), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	els, _, err := GetElemsOpts(name, opts)
+	return els, err
+}
+
+func TestUnknownTransform(t *testing.T) {
+	_, err := parseSource(t, `package x
+
+//msgp:transform pii
+
+type A struct {
+	B string `+"`msg:\"b,transform=pii\"`"+`
+	C string `+"`msg:\"c,transform=nope\"`"+`
+}
+`, Options{})
+	if err == nil {
+		t.Fatal("expected an error for an unknown transform")
+	}
+	if !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("error should name the unknown transform: %s", err)
+	}
+}
+
+func TestStrictTags(t *testing.T) {
+	const src = `package x
+
+type A struct {
+	B string ` + "`msg:\"b,omitempy\"`" + `
+	C []int  ` + "`msg:\"c,allownil=true\"`" + `
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error without strict: %s", err)
+	}
+	if len(els) != 1 {
+		t.Fatalf("expected 1 element; got %d", len(els))
+	}
+	if n := len(els[0].Ptr().Value.Struct().Fields); n != 2 {
+		t.Errorf("expected 2 fields; got %d", n)
+	}
+
+	_, err = parseSource(t, src, Options{Strict: true})
+	if err == nil {
+		t.Fatal("expected an error with strict")
+	}
+	if !strings.Contains(err.Error(), "omitempy") {
+		t.Errorf("error should name the unknown option: %s", err)
+	}
+	if !strings.Contains(err.Error(), "and 1 more") {
+		t.Errorf("error should count the malformed option: %s", err)
+	}
+}
+
+func TestStrictSkippedFields(t *testing.T) {
+	const src = `package x
+
+type A struct {
+	other.Thing
+	Ch    chan int
+	Ext   map[string]int ` + "`msg:\"ext,extension\"`" + `
+	Tag   string ` + "`msg:\"tag,omitempy\"`" + `
+	Name  string
+}
+
+type B struct {
+	Un Unknown
+}
+`
+	var log bytes.Buffer
+	els, err := parseSource(t, src, Options{Log: &log})
+	if err != nil {
+		t.Fatalf("unexpected error without strict: %s", err)
+	}
+	var names []string
+	for _, f := range els[0].Ptr().Value.Struct().Fields {
+		names = append(names, f.FieldName)
+	}
+	if got := strings.Join(names, " "); got != "Tag Name" {
+		t.Errorf("got fields %q", got)
+	}
+	if strings.Contains(log.String(), "error") {
+		t.Errorf("without strict, there are only warnings:\n%s", log.String())
+	}
+
+	// each of them is listed, and
+	// generation fails at the end
+	log.Reset()
+	_, err = parseSource(t, src, Options{Strict: true, Log: &log})
+	if err == nil || !strings.Contains(err.Error(), "and 4 more") {
+		t.Fatalf("expected 5 errors with strict; got %v", err)
+	}
+	for _, want := range []string{
+		`src.go:4:2: field "Thing": package other isn't imported, so none of the fields of the embedded other.Thing can be serialized`,
+		`src.go:5:2: field "Ch": type chan int isn't supported`,
+		`src.go:6:2: field "Ext": couldn't be cast as an extension`,
+		`src.go:7:15: field "Tag": tag option "omitempy": unknown option`,
+		`src.go:12:5: type "Unknown": unresolved identifier`,
+	} {
+		if !strings.Contains(log.String(), "error: ") || !strings.Contains(log.String(), want) {
+			t.Errorf("%q isn't listed:\n%s", want, log.String())
+		}
+	}
+	if strings.Contains(log.String(), "warning") {
+		t.Errorf("with strict, there are only errors:\n%s", log.String())
+	}
+}
+
+func TestTypeDirectives(t *testing.T) {
+	const src = `package x
+
+// Point is a tuple
+//
+//msgp:tuple
+type Point struct {
+	X, Y float64
+}
+
+//msgp:accept-both
+type Line struct {
+	A, B Point
+}
+
+//msgp:ignore
+type Scratch struct {
+	Buf []byte
+}
+
+type Map struct {
+	P Point
+}
+
+type (
+	//msgp:tuple
+	Pair struct {
+		L, R int
+	}
+	Other struct {
+		N int
+	}
+)
+
+//msgp:tuple
+
+type Apart struct {
+	N int
+}
+`
+	var log bytes.Buffer
+	els, err := parseSource(t, src, Options{Log: &log})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, el := range els {
+		s := el.Ptr().Value.Struct()
+		got[s.Name] = fmt.Sprintf("tuple=%v both=%v", s.AsTuple, s.AcceptBoth)
+	}
+	want := map[string]string{
+		"Point": "tuple=true both=false",
+		"Line":  "tuple=false both=true",
+		"Map":   "tuple=false both=false",
+		"Pair":  "tuple=true both=false",
+		"Other": "tuple=false both=false",
+		"Apart": "tuple=false both=false",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	// a directive that's apart from the
+	// type isn't applied to it
+	if n := strings.Count(log.String(), "warning: "); n != 1 || !strings.Contains(log.String(),
+		"src.go:34:1: error applying directive: tuple directive names no types, and isn't right above a type declaration") {
+		t.Errorf("expected a warning about line 34:\n%s", log.String())
+	}
+}
+
+// generateDir parses the files in 'files' from a
+// temporary directory and returns the generated
+// code for every element, along with the warnings.
+func generateDir(t *testing.T, files map[string]string) (string, []Warning) {
+	dir, err := ioutil.TempDir("", "msgp-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := File(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.ApplyDirectives()
+	var out bytes.Buffer
+	for _, el := range fs.Process() {
+		// the Writer-based EncodeMsg, which is
+		// only written with -marshal=false, first
+		gen.NoMarshal = true
+		err := gen.WriteEncodeDecode(&out, el.Ptr(), nil)
+		gen.NoMarshal = false
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := gen.WriteEncodeDecode(&out, el.Ptr(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := gen.WriteMarshalUnmarshal(&out, el.Ptr(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out.String(), fs.Warnings
+}
+
+func TestShimPrecedence(t *testing.T) {
+	const types = `package x
+
+type ID struct {
+	Value string
+}
+
+type Holder struct {
+	ID   ID
+	Ptr  *ID
+}
+`
+	const shim = `package x
+
+//msgp:shim ID as:string using:idToString/idFromString
+
+func idToString(i ID) string   { return i.Value }
+func idFromString(s string) ID { return ID{Value: s} }
+`
+	first, fwarn := generateDir(t, map[string]string{"a.go": types, "b.go": shim})
+	second, swarn := generateDir(t, map[string]string{"a.go": shim, "b.go": types})
+	if first != second {
+		t.Errorf("output depends on file order:\n%s\n----\n%s", first, second)
+	}
+
+	// the shim wins over the generated methods
+	if !strings.Contains(first, "idToString(z.ID)") || !strings.Contains(first, "idFromString(") {
+		t.Errorf("expected the shim to be used for Holder:\n%s", first)
+	}
+	if strings.Contains(first, "z.ID.EncodeMsg") || strings.Contains(first, "z.ID.DecodeMsg") {
+		t.Errorf("expected the generated methods not to be used for Holder:\n%s", first)
+	}
+
+	for _, w := range [][]Warning{fwarn, swarn} {
+		if len(w) != 1 || w[0].Type != "ID" {
+			t.Errorf("expected one warning for ID; got %v", w)
+		}
+	}
+}
+
 var want gen.Elem = &gen.Ptr{
 	Value: &gen.Struct{
 		Name: "TestType",
@@ -75,3 +352,1227 @@ var want gen.Elem = &gen.Ptr{
 		},
 	},
 }
+
+func TestSchemaHash(t *testing.T) {
+	hash := func(src string) string {
+		els, err := parseSource(t, "package x\n\n"+src, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return els[0].Ptr().Value.Struct().SchemaHash()
+	}
+	const orig = "type A struct {\n\tB string `msg:\"b\"`\n\tC []int\n}\n"
+	h := hash(orig)
+	if !strings.HasPrefix(h, "sha256:") {
+		t.Fatalf("bad hash %q", h)
+	}
+	if hash(orig) != h {
+		t.Error("hash isn't stable across runs")
+	}
+	for _, src := range []string{
+		"type A struct {\n\tB string `msg:\"bb\"`\n\tC []int\n}\n",
+		"type A struct {\n\tB []byte `msg:\"b\"`\n\tC []int\n}\n",
+		"type A struct {\n\tC []int\n\tB string `msg:\"b\"`\n}\n",
+	} {
+		if hash(src) == h {
+			t.Errorf("hash didn't change for\n%s", src)
+		}
+	}
+}
+
+func TestWarningPositions(t *testing.T) {
+	const src = `package x
+
+type A struct {
+	Ok   string
+	Ch   chan int
+	Tag  string ` + "`msg:\"tag,omitempy\"`" + `
+	Name Unknown
+}
+`
+	dir, err := ioutil.TempDir("", "msgp-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "src.go")
+	if err = ioutil.WriteFile(name, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := File(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.ApplyDirectives()
+	fs.Process()
+
+	want := map[string]int{"Ch": 5, "Tag": 6, "Unknown": 7}
+	for _, w := range fs.Warnings {
+		key := w.Field
+		if key == "" {
+			key = w.Type
+		}
+		line, ok := want[key]
+		if !ok {
+			t.Errorf("unexpected warning: %s", w)
+			continue
+		}
+		delete(want, key)
+		if w.Pos.Filename != name || w.Pos.Line != line {
+			t.Errorf("%s: expected the position to be %s:%d", w, name, line)
+		}
+		if !strings.HasPrefix(w.Error(), fmt.Sprintf("%s:%d:", name, line)) {
+			t.Errorf("%q doesn't start with the position", w.Error())
+		}
+	}
+	for key := range want {
+		t.Errorf("no warning for %s", key)
+	}
+
+	// strict failures carry the position, too,
+	// starting with the field that's skipped
+	_, _, err = GetElemsOpts(name, Options{Strict: true})
+	if err == nil || !strings.HasPrefix(err.Error(), name+":5:") {
+		t.Errorf("expected a strict error at line 5; got %v", err)
+	}
+}
+
+func TestMethodCollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"types.go": `package x
+
+type A struct{ N int }
+
+type B struct{ N int }
+`,
+		"hand.go": `package x
+
+func (a A) String() string { return "" }
+
+func (a *A) MarshalMsg(b []byte) ([]byte, error) { return b, nil }
+
+func (b *B) Clone() *B { return b }
+`,
+		// output from an earlier run
+		"types_gen.go": `package x
+
+func (z *B) MarshalMsg(b []byte) ([]byte, error) { return b, nil }
+`,
+	}
+	for name, src := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name := filepath.Join(dir, "types.go")
+	methods := []string{"MarshalMsg", "UnmarshalMsg", "Msgsize"}
+
+	_, _, err = GetElemsOpts(name, Options{Methods: methods})
+	if err == nil {
+		t.Fatal("expected an error for the hand-written MarshalMsg")
+	}
+	hand := filepath.Join(dir, "hand.go")
+	if !strings.HasPrefix(err.Error(), hand+":5:") || !strings.Contains(err.Error(), "MarshalMsg") {
+		t.Errorf("error should point at %s:5: %s", hand, err)
+	}
+	if strings.Contains(err.Error(), "more error") {
+		t.Errorf("expected one error; got %s", err)
+	}
+
+	// Clone isn't generated here
+	if _, _, err = GetElemsOpts(name, Options{Methods: []string{"Clone"}}); err == nil {
+		t.Error("expected an error for the hand-written Clone")
+	}
+	if _, _, err = GetElemsOpts(name, Options{Methods: []string{"EncodeMsg", "DecodeMsg"}}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// with -o, the default output name is
+	// no longer assumed to be generated
+	_, _, err = GetElemsOpts(name, Options{Methods: methods, Output: filepath.Join(dir, "out.go")})
+	if err == nil || !strings.Contains(err.Error(), "and 1 more") {
+		t.Errorf("expected two errors; got %v", err)
+	}
+}
+
+func TestMarshalAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	types := `package x
+
+//msgp:marshalas A AWire
+
+type A struct{ N int }
+
+type AWire struct{ M int }
+`
+	tests := []struct {
+		hand string // the methods of A
+		err  string // part of the error, if any
+	}{
+		{`func (a *A) ToWire() *AWire { return nil }
+func (a *A) FromWire(w *AWire) error { return nil }`, ""},
+		{`func (a A) ToWire() (w *AWire) { return nil }
+func (a *A) FromWire(*AWire) (err error) { return nil }`, ""},
+		{`func (a *A) FromWire(w *AWire) error { return nil }`, "no method ToWire() *AWire"},
+		{`func (a *A) ToWire() AWire { return AWire{} }
+func (a *A) FromWire(w *AWire) error { return nil }`, "no method ToWire() *AWire"},
+		{`func (a *A) ToWire() *AWire { return nil }
+func (a *A) FromWire(w *AWire) {}`, "no method FromWire(*AWire) error"},
+	}
+	name := filepath.Join(dir, "types.go")
+	if err = ioutil.WriteFile(name, []byte(types), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		if err = ioutil.WriteFile(filepath.Join(dir, "hand.go"), []byte("package x\n\n"+tt.hand+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		elems, _, err := GetElemsOpts(name, Options{})
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("test case %d: unexpected error: %s", i, err)
+				continue
+			}
+			for _, el := range elems {
+				if s := el.Ptr().Value.Struct(); s.Name == "A" && s.MarshalAs != "AWire" {
+					t.Errorf("test case %d: A is marshaled as %q", i, s.MarshalAs)
+				}
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.HasPrefix(err.Error(), name+":5:") {
+			t.Errorf("test case %d: expected an error at %s:5 about %q; got %v", i, name, tt.err, err)
+		}
+	}
+
+	// the wire type must have generated methods
+	ignored := strings.Replace(types, "//msgp:marshalas A AWire", "//msgp:marshalas A AWire\n//msgp:ignore AWire", 1)
+	if err = ioutil.WriteFile(name, []byte(ignored), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = GetElemsOpts(name, Options{})
+	if err == nil || !strings.Contains(err.Error(), "AWire, which isn't a struct") {
+		t.Errorf("expected an error about AWire; got %v", err)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	const src = `package x
+
+type A struct {
+	Strict map[string]int ` + "`msg:\"strict,maxentries=64\"`" + `
+	Drop   map[string]int ` + "`msg:\"drop,maxentries=8,overflow=drop\"`" + `
+	Error  map[string]int ` + "`msg:\"error,maxentries=8,overflow=error\"`" + `
+	Slice  []int          ` + "`msg:\"slice,maxentries=8\"`" + `
+	Zero   map[string]int ` + "`msg:\"zero,maxentries=0\"`" + `
+	Policy map[string]int ` + "`msg:\"policy,maxentries=8,overflow=truncate\"`" + `
+	Alone  map[string]int ` + "`msg:\"alone,overflow=drop\"`" + `
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		max  uint32
+		drop bool
+	}{{64, false}, {8, true}, {8, false}, {}, {}, {8, false}, {}}
+	fields := els[0].Ptr().Value.Struct().Fields
+	for i, f := range fields {
+		m := f.FieldElem.Map()
+		if m == nil {
+			continue
+		}
+		if m.MaxEntries != want[i].max || m.DropOverflow != want[i].drop {
+			t.Errorf("%s: got maxentries=%d, drop=%v; want %d, %v", f.FieldName, m.MaxEntries, m.DropOverflow, want[i].max, want[i].drop)
+		}
+	}
+
+	// everything but the slice is a tag problem
+	_, err = parseSource(t, src, Options{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "and 2 more") {
+		t.Errorf("expected 3 errors with strict; got %v", err)
+	}
+}
+
+func TestBitsetTag(t *testing.T) {
+	const src = `package x
+
+type A struct {
+	Flags []bool ` + "`msg:\"flags,bitset\"`" + `
+	Plain []bool ` + "`msg:\"plain\"`" + `
+	Named []Flag ` + "`msg:\"named,bitset\"`" + `
+	Ints  []int  ` + "`msg:\"ints,bitset\"`" + `
+	One   bool   ` + "`msg:\"one,bitset\"`" + `
+}
+
+type Flag bool
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range els[0].Ptr().Value.Struct().Fields {
+		s := f.FieldElem.Slice()
+		if got := s != nil && s.Bitset; got != (f.FieldName == "Flags") {
+			t.Errorf("%s: bitset is %v", f.FieldName, got)
+		}
+	}
+
+	// the fields that aren't []bool are warned about
+	_, warnings := generateDir(t, map[string]string{"src.go": src})
+	var n int
+	for _, w := range warnings {
+		if strings.Contains(w.Error(), "isn't a []bool; ignoring bitset") {
+			n++
+		}
+	}
+	if n != 3 {
+		t.Errorf("got %d bitset warnings; want 3: %v", n, warnings)
+	}
+}
+
+func TestAllowNilNamed(t *testing.T) {
+	src := `package x
+
+import "net/url"
+
+type A struct {
+	List   Names      ` + "`msg:\"list,allownil\"`" + `
+	Index  Lookup     ` + "`msg:\"index,allownil\"`" + `
+	Query  url.Values ` + "`msg:\"query,allownil\"`" + `
+	Count  int        ` + "`msg:\"count,allownil\"`" + `
+}
+
+type Names []string
+
+type Lookup map[string]int
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, el := range els {
+		st := el.Ptr().Value.Struct()
+		if st == nil {
+			continue
+		}
+		for _, f := range st.Fields {
+			b := f.FieldElem.Base()
+			if got := b != nil && b.AllowNil; got != (f.FieldName == "List" || f.FieldName == "Index") {
+				t.Errorf("%s: allownil is %v", f.FieldName, got)
+			}
+		}
+	}
+
+	// the named types are checked for nil before their
+	// methods are called, and the others warned about
+	out, warnings := generateDir(t, map[string]string{"src.go": src})
+	for _, want := range []string{"if z.List == nil {\n\t\to = msgp.AppendNil(o)", "if z.Index == nil {\n\t\terr = en.WriteNil()"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't contain %q", want)
+		}
+	}
+	var got []string
+	for _, w := range warnings {
+		if strings.Contains(w.Error(), "allownil") {
+			got = append(got, w.Error())
+		}
+	}
+	if len(got) != 2 || !strings.Contains(got[0], "type url.Values isn't a slice or map type declared in this package") || !strings.Contains(got[1], "isn't a slice or map; ignoring allownil") {
+		t.Errorf("got allownil warnings %q", got)
+	}
+}
+
+func TestEpochTag(t *testing.T) {
+	const src = `package x
+
+import "time"
+
+type A struct {
+	Sec   time.Time   ` + "`msg:\"sec,epoch=s\"`" + `
+	Ptr   *time.Time  ` + "`msg:\"ptr,epoch=ms\"`" + `
+	Plain time.Time   ` + "`msg:\"plain\"`" + `
+	Unit  time.Time   ` + "`msg:\"unit,epoch=us\"`" + `
+	Int   int64       ` + "`msg:\"int,epoch=s\"`" + `
+	Times []time.Time ` + "`msg:\"times,epoch=ns\"`" + `
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Sec": "s", "Ptr": "ms"}
+	for _, f := range els[0].Ptr().Value.Struct().Fields {
+		be := f.FieldElem.Base()
+		if p := f.FieldElem.Ptr(); p != nil {
+			be = p.Value.Base()
+		}
+		var got string
+		if be != nil {
+			got = be.Epoch
+		}
+		if got != want[f.FieldName] {
+			t.Errorf("%s: epoch is %q; want %q", f.FieldName, got, want[f.FieldName])
+		}
+	}
+
+	// the rest are warned about
+	_, warnings := generateDir(t, map[string]string{"src.go": src})
+	var unit, notTime int
+	for _, w := range warnings {
+		switch {
+		case strings.Contains(w.Error(), `epoch unit "us" isn't s, ms or ns`):
+			unit++
+		case strings.Contains(w.Error(), "isn't a time.Time; ignoring epoch"):
+			notTime++
+		}
+	}
+	if unit != 1 || notTime != 2 {
+		t.Errorf("got %d unit and %d type warnings; want 1 and 2: %v", unit, notTime, warnings)
+	}
+}
+
+func TestDecodeOnlyEncodeOnly(t *testing.T) {
+	const src = `package x
+
+//msgp:tuple T
+
+type A struct {
+	Old  int ` + "`msg:\"old,decodeonly\"`" + `
+	Sum  int ` + "`msg:\"sum,encodeonly\"`" + `
+	Both int ` + "`msg:\"both,decodeonly,encodeonly\"`" + `
+	Name string
+}
+
+type T struct {
+	Old  int ` + "`msg:\"old,decodeonly\"`" + `
+	Name string
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]bool{
+		"A.Old":  {true, false},
+		"A.Sum":  {false, true},
+		"A.Both": {false, false},
+		"A.Name": {false, false},
+		"T.Old":  {false, false}, // tuples read and write every field
+		"T.Name": {false, false},
+	}
+	for _, el := range els {
+		s := el.Ptr().Value.Struct()
+		for _, f := range s.Fields {
+			name := s.Name + "." + f.FieldName
+			if got := [2]bool{f.DecodeOnly, f.EncodeOnly}; got != want[name] {
+				t.Errorf("%s: got decodeonly=%v, encodeonly=%v; want %v", name, got[0], got[1], want[name])
+			}
+		}
+	}
+
+	// both problems are tag problems
+	_, err = parseSource(t, src, Options{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "and 1 more") {
+		t.Errorf("expected 2 errors with strict; got %v", err)
+	}
+}
+
+func TestOmitEmpty(t *testing.T) {
+	tag := func(opts string) string { return "`msg:\"" + opts + "\"`" }
+	src := `package x
+
+//msgp:tuple T
+
+type Level int
+type List []string
+type Inner struct{ N int }
+
+type A struct {
+	Name  string ` + tag("name,omitempty") + `
+	Level Level ` + tag("level,omitempty") + `
+	List  List ` + tag("list,omitempty") + `
+	Ptr   *Inner ` + tag("ptr,omitempty") + `
+	Inner Inner ` + tag("inner,omitempty") + `
+	Arr   [2]int ` + tag("arr,omitempty") + `
+	Old   int ` + tag("old,decodeonly,omitempty") + `
+}
+
+type T struct {
+	Name string ` + tag("name,omitempty") + `
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"A.Name":  true,
+		"A.Level": true,
+		"A.List":  true,
+		"A.Ptr":   true,
+		"A.Inner": false, // structs are never empty
+		"A.Arr":   false, // nor are arrays
+		"A.Old":   false, // it's never written
+		"T.Name":  false, // tuples write every field
+	}
+	for _, el := range els {
+		s := el.Ptr().Value.Struct()
+		if s == nil {
+			continue
+		}
+		for _, f := range s.Fields {
+			name := s.Name + "." + f.FieldName
+			if f.OmitEmpty != want[name] {
+				t.Errorf("%s: got omitempty=%v; want %v", name, f.OmitEmpty, want[name])
+			}
+		}
+	}
+
+	_, warnings := generateDir(t, map[string]string{"src.go": src})
+	var got []string
+	for _, w := range warnings {
+		if strings.Contains(w.Error(), "omitempty") {
+			got = append(got, w.Field+w.Type)
+		}
+	}
+	if !reflect.DeepEqual(got, []string{"Inner", "Arr", "Old", "T"}) {
+		t.Errorf("got warnings about %q", got)
+	}
+}
+
+// TestFieldShim checks that the as and using tag
+// options shim a field in place of its type's shim
+func TestFieldShim(t *testing.T) {
+	tag := func(opts string) string { return "`msg:\"" + opts + "\"`" }
+	src := `package x
+
+//msgp:shim Level as:int64 using:levelToInt/levelFromInt
+
+type Level int8
+
+type A struct {
+	Dir   Level ` + tag("dir") + `
+	List  []Level ` + tag("list") + `
+	Str   Level ` + tag("str,as=string,using=levelStr/levelFromStr") + `
+	Ptr   *Level ` + tag("ptr,as=string,using=levelStr/levelFromStr") + `
+	Plain int ` + tag("plain,as=string,using=strconv.Itoa/atoi") + `
+	Bad   Level ` + tag("bad,as=nope,using=a/b") + `
+	Half  Level ` + tag("half,as=string") + `
+	Map   map[string]int ` + tag("map,as=string,using=a/b") + `
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s *gen.Struct
+	for _, el := range els {
+		if st := el.Ptr().Value.Struct(); st != nil && st.Name == "A" {
+			s = st
+		}
+	}
+	if s == nil {
+		t.Fatal("no struct A")
+	}
+	want := map[string]string{
+		"Dir":   "Level int64 levelToInt/levelFromInt",
+		"List":  "Level int64 levelToInt/levelFromInt",
+		"Str":   "Level string levelStr/levelFromStr",
+		"Ptr":   "Level string levelStr/levelFromStr",
+		"Plain": "int string strconv.Itoa/atoi",
+		"Bad":   "Level int64 levelToInt/levelFromInt",
+		"Half":  "Level int64 levelToInt/levelFromInt",
+		"Map":   "",
+	}
+	for _, f := range s.Fields {
+		e := f.FieldElem
+		switch {
+		case e.Ptr() != nil:
+			e = e.Ptr().Value
+		case e.Slice() != nil:
+			e = e.Slice().Els
+		}
+		var got string
+		if b := e.Base(); b != nil {
+			got = fmt.Sprintf("%s %s %s/%s", b.TypeName(), b.BaseType(), b.ShimToBase, b.ShimFromBase)
+		}
+		if got != want[f.FieldName] {
+			t.Errorf("%s: got %q; want %q", f.FieldName, got, want[f.FieldName])
+		}
+	}
+
+	_, warnings := generateDir(t, map[string]string{"src.go": src})
+	var got []string
+	for _, w := range warnings {
+		got = append(got, w.Field+": "+w.Err.Error())
+	}
+	wantWarnings := []string{
+		`Bad: as "nope" isn't a base type`,
+		"Half: as and using go together",
+		"Map: type map[string]int can't be shimmed; ignoring as and using",
+	}
+	if !reflect.DeepEqual(got, wantWarnings) {
+		t.Errorf("got warnings %q; want %q", got, wantWarnings)
+	}
+	if _, err := parseSource(t, src, Options{Strict: true}); err == nil {
+		t.Error("expected an error under Strict")
+	}
+}
+
+func TestUnexported(t *testing.T) {
+	const src = `package x
+
+type state struct {
+	count  int
+	Name   string
+	_      [4]byte
+	a, _   int
+	hidden string ` + "`msg:\"h\"`" + `
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err == nil || !strings.Contains(err.Error(), "no exported definitions") {
+		t.Errorf("expected no exported definitions; got %v (%d types)", err, len(els))
+	}
+
+	els, err = parseSource(t, src, Options{Unexported: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(els) != 1 || els[0].Ptr().Value.TypeName() != "state" {
+		t.Fatalf("got %v; want state", els)
+	}
+	var got []string
+	for _, f := range els[0].Ptr().Value.Struct().Fields {
+		got = append(got, f.FieldName+":"+f.FieldTag)
+	}
+	// blank fields are left out
+	if want := "count:count Name:Name a:a hidden:h"; strings.Join(got, " ") != want {
+		t.Errorf("got fields %q; want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestJSONTags(t *testing.T) {
+	src := `package x
+
+type A struct {
+	ID     int64  ` + "`json:\"user_id,omitempty\"`" + `
+	Secret string ` + "`json:\"-\"`" + `
+	Name   string ` + "`json:\"name\" msg:\"display_name\"`" + `
+	Dash   string ` + "`json:\"-,\"`" + `
+	Plain  bool   ` + "`json:\",omitempty\"`" + `
+	Other  int    ` + "`yaml:\"other\"`" + `
+}
+`
+	tags := func(opts Options) string {
+		els, err := parseSource(t, src, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, f := range els[0].Ptr().Value.Struct().Fields {
+			out = append(out, f.FieldName+":"+f.FieldTag)
+			if f.OmitEmpty {
+				t.Errorf("%s: json's omitempty was taken for msgp's", f.FieldName)
+			}
+		}
+		return strings.Join(out, " ")
+	}
+	want := "ID:user_id Name:display_name Dash:- Plain:Plain Other:Other"
+	if got := tags(Options{}); got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	want = "ID:ID Secret:Secret Name:display_name Dash:Dash Plain:Plain Other:Other"
+	if got := tags(Options{NoJSONTags: true}); got != want {
+		t.Errorf("NoJSONTags: got %q; want %q", got, want)
+	}
+}
+
+func TestGroupedFields(t *testing.T) {
+	tag := func(opts string) string { return "`msg:\"" + opts + "\"`" }
+	src := `package x
+
+type Level int8
+
+type A struct {
+	X, Y, Z int64 ` + tag(",extension") + `
+	P, Q    []int ` + tag(",omitempty,allownil") + `
+	H, I    string ` + tag("-") + `
+	U, V    Level ` + tag(",as=string,using=levelStr/levelFromStr") + `
+	M, N    int ` + tag("same") + `
+	_, K    bool ` + tag(",omitempty") + `
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s *gen.Struct
+	for _, el := range els {
+		if st := el.Ptr().Value.Struct(); st != nil && st.Name == "A" {
+			s = st
+		}
+	}
+	if s == nil {
+		t.Fatal("no struct A")
+	}
+	var got []string
+	seen := make(map[gen.Elem]bool)
+	for _, f := range s.Fields {
+		e := f.FieldElem
+		if seen[e] {
+			t.Errorf("%s: shares its element with another field", f.FieldName)
+		}
+		seen[e] = true
+		desc := f.FieldName + ":" + f.FieldTag
+		if sl := e.Slice(); sl != nil && sl.AllowNil {
+			desc += ",allownil"
+		}
+		if f.OmitEmpty {
+			desc += ",omitempty"
+		}
+		if b := e.Base(); b != nil && b.Value == gen.Ext {
+			desc += ",extension"
+		}
+		if b := e.Base(); b != nil && b.ShimToBase != "" {
+			desc += ",as=" + b.BaseType() + ",using=" + b.ShimToBase + "/" + b.ShimFromBase
+		}
+		got = append(got, desc)
+	}
+	want := []string{
+		"X:X,extension", "Y:Y,extension", "Z:Z,extension",
+		"P:P,allownil,omitempty", "Q:Q,allownil,omitempty",
+		"U:U,as=string,using=levelStr/levelFromStr", "V:V,as=string,using=levelStr/levelFromStr",
+		"M:M", "N:N",
+		"K:K,omitempty",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got fields %q; want %q", got, want)
+	}
+
+	// one name can't name both fields
+	_, warnings := generateDir(t, map[string]string{"src.go": src})
+	var n int
+	for _, w := range warnings {
+		if strings.Contains(w.Error(), `names 2 fields "same"`) {
+			n++
+		}
+	}
+	if n != 1 || len(warnings) != 1 {
+		t.Errorf("got warnings %v; want one about \"same\"", warnings)
+	}
+	if _, err := parseSource(t, src, Options{Strict: true}); err == nil {
+		t.Error("expected an error under Strict")
+	}
+}
+
+func TestIntMapKeys(t *testing.T) {
+	const src = `package x
+
+type A struct {
+	Str   map[string]int
+	Int   map[int]int
+	Small map[int8]string
+	Byte  map[byte]bool
+	Float map[float64]int
+	Bool  map[bool]int
+}
+`
+	els, err := parseSource(t, src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Str":   "map[string]int",
+		"Int":   "map[int]int",
+		"Small": "map[int8]string",
+		"Byte":  "map[byte]bool",
+	}
+	s := els[0].Ptr().Value.Struct()
+	if len(s.Fields) != len(want) {
+		t.Errorf("got %d fields; want %d", len(s.Fields), len(want))
+	}
+	for _, f := range s.Fields {
+		m := f.FieldElem.Map()
+		if m == nil || m.TypeName() != want[f.FieldName] {
+			t.Errorf("%s: got %s; want %s", f.FieldName, f.FieldElem.TypeName(), want[f.FieldName])
+		}
+		if m != nil && m.IntKeys() != (f.FieldName != "Str") {
+			t.Errorf("%s: IntKeys() is %v", f.FieldName, m.IntKeys())
+		}
+	}
+}
+
+func TestNamedStringMapKeys(t *testing.T) {
+	out, warnings := generateDir(t, map[string]string{
+		"keys.go": `package x
+
+type Region string
+
+type Zone Region
+
+type Code string
+
+type Ratio float64
+
+//msgp:shim Code as:string using:codeStr/codeFrom
+`,
+		"types.go": `package x
+
+type A struct {
+	Counts map[Region]int
+	Zones  map[Zone][]string
+	Codes  map[Code]int
+	Ratios map[Ratio]int
+}
+`})
+	for _, want := range []string{
+		"err = en.WriteString(string(",
+		"o = msgp.AppendString(o, string(",
+		"msgp.StringSize(string(",
+		" = Region(tmp)",
+		" = Zone(tmp)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	// keys with shims, and over other
+	// base types, aren't supported
+	var msgs []string
+	for _, w := range warnings {
+		msgs = append(msgs, w.Error())
+	}
+	if len(msgs) != 2 || !strings.Contains(msgs[0], `field "Codes": type map[Code]int isn't supported`) ||
+		!strings.Contains(msgs[1], `field "Ratios": type map[Ratio]int isn't supported`) {
+		t.Errorf("got warnings %q", msgs)
+	}
+}
+
+func TestNamedMaps(t *testing.T) {
+	out, warnings := generateDir(t, map[string]string{"src.go": `package x
+
+type Headers map[string]string
+
+type Funcs map[string]func()
+
+type A struct {
+	H Headers
+	F Funcs
+}
+`})
+	for _, want := range []string{
+		"func (z *Headers) DecodeMsg(",
+		"func (z *Headers) MarshalMsg(",
+		"err = z.H.DecodeMsg(dc)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	if strings.Contains(out, "Funcs)") {
+		t.Error("methods were generated for Funcs")
+	}
+	// the unsupported map is reported as a type,
+	// and as an identifier that the field refers to
+	var msgs []string
+	for _, w := range warnings {
+		msgs = append(msgs, w.Error())
+	}
+	if len(msgs) != 2 || !strings.Contains(msgs[0], `type "Funcs": type map[string]func() isn't supported`) ||
+		!strings.Contains(msgs[1], `type "Funcs": unresolved identifier`) {
+		t.Errorf("got warnings %q", msgs)
+	}
+}
+
+func TestNamedSlices(t *testing.T) {
+	out, warnings := generateDir(t, map[string]string{"src.go": `package x
+
+type Event struct {
+	Kind string
+}
+
+type EventList []Event
+
+type Blob []byte
+
+type Funcs []func()
+
+type Fixed [4]int
+
+type A struct {
+	E EventList
+	B Blob
+	F Funcs
+}
+`})
+	for _, want := range []string{
+		"func (z *EventList) DecodeMsg(",
+		"func (z *EventList) MarshalMsg(",
+		"err = z.E.DecodeMsg(dc)",
+		"func (z *Blob) EncodeMsg(",
+		"err = en.WriteBytes([]byte(*z))",
+		// fields of a named []byte are
+		// still converted, not called
+		"tmp, err = dc.ReadBytes([]byte(z.B))",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	if strings.Contains(out, "Funcs)") || strings.Contains(out, "Fixed)") {
+		t.Error("methods were generated for Funcs or Fixed")
+	}
+	var msgs []string
+	for _, w := range warnings {
+		msgs = append(msgs, w.Error())
+	}
+	if len(msgs) != 2 || !strings.Contains(msgs[0], `type "Funcs": type []func() isn't supported`) ||
+		!strings.Contains(msgs[1], `type "Funcs": unresolved identifier`) {
+		t.Errorf("got warnings %q", msgs)
+	}
+}
+
+func TestNamedBaseTypes(t *testing.T) {
+	out, warnings := generateDir(t, map[string]string{
+		"token.go": `package x
+
+type Token string
+`,
+		"src.go": `package x
+
+//msgp:shim Level as:string using:levelName/parseLevel
+
+type UserID uint64
+
+type Level int
+
+type Other Token
+
+type Alias = string
+
+type A struct {
+	U UserID
+}
+`})
+	for _, want := range []string{
+		"func (z *Token) EncodeMsg(",
+		"err = en.WriteString(string(*z))",
+		"func (z *UserID) DecodeMsg(",
+		"*z = UserID(tmp)",
+		// fields of the type are
+		// still converted, not called
+		"z.U = UserID(tmp)",
+		// and the shim is used
+		"err = en.WriteString(levelName(*z))",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	if strings.Contains(out, "Other)") || strings.Contains(out, "Alias)") {
+		t.Error("methods were generated for Other or Alias")
+	}
+	if len(warnings) > 0 {
+		t.Errorf("got warnings %v", warnings)
+	}
+}
+
+func TestFileOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.go": `package x
+
+type A struct {
+	L Level
+	N Names
+	B *B
+}
+
+type Level Base
+`,
+		"b.go": `package x
+
+type B struct {
+	L Level
+}
+
+type Base Root
+
+type Names []string
+
+type Root int
+`,
+	}
+	var names []string
+	for name, src := range files {
+		name = filepath.Join(dir, name)
+		err = ioutil.WriteFile(name, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	generate := func(names []string) string {
+		fs, els, err := GetFiles(names, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fs.Warnings) > 0 {
+			t.Errorf("%v: got warnings %v", names, fs.Warnings)
+		}
+		var out bytes.Buffer
+		for _, el := range els {
+			if err := gen.WriteMarshalUnmarshal(&out, el.Ptr(), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return out.String()
+	}
+	out := generate(names)
+	// Level is defined as Base, in the other
+	// file, which is defined as Root, an int
+	for _, want := range []string{
+		"o = msgp.AppendInt(o, int(z.L))",
+		"z.L = Level(tmp)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	if rev := generate([]string{names[1], names[0]}); rev != out {
+		t.Errorf("the files in reverse order generated\n%s\nnot\n%s", rev, out)
+	}
+}
+
+func TestSelectorArraySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-parse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	const src = `package x
+
+import (
+	"crypto/sha256"
+	lim "example.com/app/limits"
+	"gopkg.in/yaml.v2"
+)
+
+type A struct {
+	Sum   [sha256.Size]byte
+	Slots [lim.MaxSlots]int
+	Bufs  [yaml.Bufs]byte
+}
+`
+	name := filepath.Join(dir, "src.go")
+	write := func(src string) {
+		err := ioutil.WriteFile(name, []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// yaml isn't named after its path
+	write(src)
+	_, _, err = GetFile(name, Options{})
+	if err == nil || !strings.Contains(err.Error(), `can't tell which import is package yaml; declare it with //msgp:import yaml "{Path}"`) {
+		t.Errorf("expected an error about yaml; got %v", err)
+	}
+
+	write(strings.Replace(src, "package x\n", "package x\n\n//msgp:import yaml \"gopkg.in/yaml.v2\"\n", 1))
+	fs, els, err := GetFile(name, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := gen.WriteMarshalUnmarshal(&out, els[0].Ptr(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"sha256.Size", "lim.MaxSlots", "yaml.Bufs"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	want := []Import{
+		{Name: "yaml", Path: "gopkg.in/yaml.v2"},
+		{Path: "crypto/sha256"},
+		{Name: "lim", Path: "example.com/app/limits"},
+	}
+	if !reflect.DeepEqual(fs.Imports, want) {
+		t.Errorf("got imports %v; want %v", fs.Imports, want)
+	}
+}
+
+func TestEmbeddedSelector(t *testing.T) {
+	out, warnings := generateDir(t, map[string]string{"src.go": `package x
+
+import "example.com/app/common"
+
+type A struct {
+	common.Meta
+	*common.Owner
+	other.Thing
+	Name string
+}
+`})
+	for _, want := range []string{
+		"o, err = z.Meta.MarshalMsg(o)",
+		"bts, err = z.Owner.UnmarshalMsg(bts)",
+		"z.Owner = new(common.Owner)",
+		`case "Meta":`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	// only the type whose package
+	// is unknown is warned about
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), `field "Thing": package other isn't imported`) {
+		t.Fatalf("got warnings %v", warnings)
+	}
+	// which says what's lost with it
+	if !strings.Contains(warnings[0].Error(), "NONE of the fields of the embedded other.Thing will be serialized") {
+		t.Errorf("the warning doesn't say that the fields of other.Thing are left out: %s", warnings[0])
+	}
+}
+
+func TestValueCycles(t *testing.T) {
+	out, warnings := generateDir(t, map[string]string{"src.go": `package x
+
+type A struct {
+	B B
+	N int
+}
+
+type B struct {
+	A [2]A
+}
+
+type Self struct {
+	Inner struct{ S Self }
+}
+
+// pointers, slices and maps
+// end the recursion
+type List struct {
+	Next  *List
+	Kids  []List
+	Named map[string]List
+}
+
+// a type that holds a cycle,
+// but isn't in one, is generated
+type Holder struct {
+	A *A
+	N int
+}
+`})
+	for _, want := range []string{"func (z *List) MarshalMsg(", "func (z *Holder) MarshalMsg("} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	for _, typ := range []string{"A", "B", "Self"} {
+		if strings.Contains(out, "func (z *"+typ+")") {
+			t.Errorf("methods were generated for %s", typ)
+		}
+	}
+	var msgs []string
+	for _, w := range warnings {
+		msgs = append(msgs, w.Error())
+	}
+	if len(msgs) != 3 || !strings.Contains(msgs[0], `type "A": contains itself by value (A -> B -> A)`) ||
+		!strings.Contains(msgs[1], `type "Self": contains itself by value (Self -> Self)`) ||
+		!strings.Contains(msgs[2], `type "A": unresolved identifier`) {
+		t.Errorf("got warnings %q", msgs)
+	}
+}
+
+func TestDurationFields(t *testing.T) {
+	out, warnings := generateDir(t, map[string]string{"src.go": `package x
+
+import "time"
+
+type Timeout time.Duration
+
+type A struct {
+	D  time.Duration
+	DS []time.Duration
+	T  Timeout
+}
+`})
+	for _, want := range []string{
+		"err = en.WriteInt64(int64(z.D))",
+		"o = msgp.AppendInt64(o, int64(z.T))",
+		"z.D = time.Duration(tmp)",
+		"] = time.Duration(tmp)",
+		"func (z *Timeout) MarshalMsg(",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the generated code doesn't have %q", want)
+		}
+	}
+	if len(warnings) > 0 {
+		t.Errorf("got warnings %v", warnings)
+	}
+}
+
+func TestPackageFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "msgp-package")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, src string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.go", "package x\n\ntype A struct{}\n")
+	write("a_test.go", "package x\n\ntype ATest struct{}\n")
+	write("c.go", "//go:build msgpx\n\npackage x\n\ntype C struct{}\n")
+
+	// tests and files that aren't built are left out,
+	// and a type that's only in the latter is fine
+	pkgDir, name, files, err := PackageFiles(".", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkgDir != dir || name != "x" {
+		t.Errorf("got package %s in %s", name, pkgDir)
+	}
+	if want := []string{filepath.Join(dir, "a.go")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got files %v; want %v", files, want)
+	}
+
+	// a type that build constraints choose between
+	write("b.go", "//go:build !msgpx\n\npackage x\n\ntype B struct{ N int }\n")
+	write("b_x.go", "//go:build msgpx\n\npackage x\n\ntype B struct{}\n")
+	_, _, _, err = PackageFiles(".", dir)
+	if err == nil || !strings.Contains(err.Error(), "declares type B in both b.go and b_x.go") {
+		t.Errorf("expected an error about type B; got %v", err)
+	}
+
+	_, _, _, err = PackageFiles("./nope", dir)
+	if err == nil || !strings.Contains(err.Error(), "can't find package ./nope") {
+		t.Errorf("expected an error about the missing package; got %v", err)
+	}
+}
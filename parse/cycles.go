@@ -0,0 +1,106 @@
+package parse
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// checkCycles finds the types in the file set that
+// contain themselves by value, like 'type A struct { B B }'
+// and 'type B struct { A A }', with no pointer, slice or map
+// along the way to end the recursion. Go rejects them, and
+// their methods would recurse forever, so it prints an error
+// naming each cycle, and returns the types in them, which
+// no methods are generated for. The error doesn't fail
+// generation, so that the other types are still generated;
+// the package won't compile until the cycle is broken anyway.
+func (fs *FileSet) checkCycles() map[string]bool {
+	specs := make(map[string]*ast.TypeSpec, len(fs.Specs))
+	for _, ts := range fs.Specs {
+		specs[ts.Name.Name] = ts
+	}
+	edges := make(map[string][]string, len(fs.Specs))
+	for _, ts := range fs.Specs {
+		edges[ts.Name.Name] = valueRefs(ts.Type, specs, nil)
+	}
+
+	cyclic := make(map[string]bool)
+	for _, ts := range fs.Specs {
+		start := ts.Name.Name
+		if cyclic[start] {
+			continue
+		}
+		path := cycleFrom(start, edges)
+		if path == nil {
+			continue
+		}
+		for _, name := range path {
+			cyclic[name] = true
+		}
+		w := Warning{
+			Pos:  fs.position(ts.Pos()),
+			Type: start,
+			Err: fmt.Errorf("contains itself by value (%s), with no pointer, slice or map to end the recursion; no methods are generated for %s",
+				strings.Join(path, " -> "), strings.Join(path[:len(path)-1], ", ")),
+		}
+		fs.log.fatalf("error: %s\n", w)
+		fs.Warnings = append(fs.Warnings, w)
+	}
+	return cyclic
+}
+
+// valueRefs appends the names of the types in 'specs' that
+// a value of type 'e' holds by value to 'refs', in order
+func valueRefs(e ast.Expr, specs map[string]*ast.TypeSpec, refs []string) []string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if _, ok := specs[e.Name]; ok {
+			refs = append(refs, e.Name)
+		}
+	case *ast.ParenExpr:
+		refs = valueRefs(e.X, specs, refs)
+	case *ast.ArrayType:
+		// a slice's elements are
+		// behind a pointer
+		if e.Len != nil {
+			refs = valueRefs(e.Elt, specs, refs)
+		}
+	case *ast.StructType:
+		for _, f := range e.Fields.List {
+			refs = valueRefs(f.Type, specs, refs)
+		}
+	}
+	return refs
+}
+
+// cycleFrom returns the shortest path of value references
+// from 'start' back to itself, like [A B A], or nil if
+// there is none
+func cycleFrom(start string, edges map[string][]string) []string {
+	prev := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[name] {
+			if next == start {
+				path := []string{start}
+				for n := name; n != start; n = prev[n] {
+					path = append(path, n)
+				}
+				path = append(path, start)
+				// it was built from the end
+				for i, j := 1, len(path)-2; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+				return path
+			}
+			if _, seen := prev[next]; !seen {
+				prev[next] = name
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/philhofer/msgp/gen"
 	"go/ast"
+	"go/token"
+	"strconv"
 	"strings"
 )
 
@@ -12,9 +14,22 @@ import (
 // to add a directive, define a func([]string, *FileSet) error
 // and then add it to this list.
 var directives = map[string]func([]string, *FileSet) error{
-	"shim":   applyShim,
-	"ignore": ignore,
-	"tuple":  astuple,
+	"shim":        applyShim,
+	"ignore":      ignore,
+	"tuple":       astuple,
+	"accept-both": acceptBoth,
+	"transform":   declareTransform,
+	"marshalas":   marshalAs,
+	"import":      addImport,
+}
+
+// typeDirectives are the directives that take a list
+// of types; without one, they're applied to the type
+// declared right below them (see nameTypeDirectives)
+var typeDirectives = map[string]bool{
+	"ignore":      true,
+	"tuple":       true,
+	"accept-both": true,
 }
 
 type shim struct {
@@ -24,18 +39,69 @@ type shim struct {
 }
 
 // find all comment lines that begin with //msgp:
-func yieldComments(c []*ast.CommentGroup) []string {
+func yieldComments(c []*ast.CommentGroup) ([]string, []token.Pos) {
 	var out []string
+	var pos []token.Pos
 	for _, cg := range c {
 		for _, line := range cg.List {
 			if strings.HasPrefix(line.Text, "//msgp:") {
 				out = append(out, strings.TrimPrefix(line.Text, "//msgp:"))
+				pos = append(pos, line.Pos())
+			}
+		}
+	}
+	return out, pos
+}
+
+// nameTypeDirectives adds the name of the type to each
+// directive in the doc comment of a type declaration
+// that takes a list of types, but has none, like
+//
+//	//msgp:tuple
+//	type Point struct { ... }
+//
+// so that it's applied to that type. 'comments' and
+// 'pos' are the directives of 'files' and their positions.
+func nameTypeDirectives(files []*ast.File, comments []string, pos []token.Pos) {
+	at := make(map[token.Pos]int, len(pos))
+	for i, p := range pos {
+		at[p] = i
+	}
+	for _, fl := range files {
+		for _, d := range fl.Decls {
+			g, ok := d.(*ast.GenDecl)
+			if !ok || g.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range g.Specs {
+				ts := s.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && !g.Lparen.IsValid() {
+					doc = g.Doc
+				}
+				if doc == nil {
+					continue
+				}
+				for _, c := range doc.List {
+					i, ok := at[c.Pos()]
+					if ok && typeDirectives[strings.TrimSpace(comments[i])] {
+						comments[i] = strings.TrimSpace(comments[i]) + " " + ts.Name.Name
+					}
+				}
 			}
 		}
 	}
-	return out
 }
 
+// errNoTypes is returned by the directives that
+// take a list of types, when they have none
+func errNoTypes(text []string) error {
+	return fmt.Errorf("%s directive names no types, and isn't right above a type declaration", text[0])
+}
+
+// A shim takes precedence over methods
+// generated for {Type}, if there are any.
+//
 //msgp:shim {Type} as:{Newtype} using:{toFunc/fromFunc}
 func applyShim(text []string, f *FileSet) error {
 	if len(text) != 4 {
@@ -49,7 +115,7 @@ func applyShim(text []string, f *FileSet) error {
 	if _, ok := f.shims[name]; ok {
 		return fmt.Errorf("shim already exists for %s", name)
 	}
-	tp := pullIdent(strings.TrimPrefix(strings.TrimSpace(text[2]), "as:")) // parse as::{base}
+	tp := gen.BaseOf(strings.TrimPrefix(strings.TrimSpace(text[2]), "as:")) // parse as::{base}
 
 	usestr := strings.TrimPrefix(strings.TrimSpace(text[3]), "using:") // parse using::{method/method}
 
@@ -57,7 +123,7 @@ func applyShim(text []string, f *FileSet) error {
 	if len(methods) != 2 {
 		return fmt.Errorf("expected 2 using::{} methods; found %d (%q)", len(methods), text[3])
 	}
-	infof("applying shim for %s -> %s ...\n", name, tp.String())
+	f.log.infof("applying shim for %s -> %s ...\n", name, tp.String())
 	f.shims[name] = &shim{
 		tp:   tp,
 		to:   methods[0],
@@ -66,10 +132,13 @@ func applyShim(text []string, f *FileSet) error {
 	return nil
 }
 
+// Without types, ignore, tuple and accept-both
+// are applied to the type declared right below.
+//
 //msgp:ignore {TypeA} {TypeB}...
 func ignore(text []string, f *FileSet) error {
 	if len(text) < 2 {
-		return nil
+		return errNoTypes(text)
 	}
 	for _, item := range text[1:] {
 		name := strings.TrimSpace(item)
@@ -77,25 +146,184 @@ func ignore(text []string, f *FileSet) error {
 			if dec != nil && dec.Name != nil && name == dec.Name.Name {
 				// delete spec
 				f.Specs, f.Specs[i], f.Specs[len(f.Specs)-1] = f.Specs[:len(f.Specs)-1], f.Specs[len(f.Specs)-1], nil
-				infof("ignoring: %s...\n", name)
+				f.log.infof("ignoring: %s...\n", name)
 			}
 		}
 	}
 	return nil
 }
 
+// {Type} is encoded as an array of its
+// fields, in order, instead of a map.
+//
+//msgp:tuple {TypeA} {TypeB}...
 func astuple(text []string, f *FileSet) error {
 	if len(text) < 2 {
-		return nil
+		return errNoTypes(text)
 	}
 	for _, item := range text[1:] {
 		name := strings.TrimSpace(item)
 		for _, dec := range f.Specs {
 			if dec != nil && dec.Name != nil && name == dec.Name.Name {
 				f.tuples[name] = set
-				infof("using type %s as tuple...\n", name)
+				f.log.infof("using type %s as tuple...\n", name)
 			}
 		}
 	}
 	return nil
 }
+
+// The decoders generated for {Type} accept both
+// the map and the tuple form of it, whichever the
+// next object is. It's still encoded in the form
+// it's declared with.
+//
+//msgp:accept-both {TypeA} {TypeB}...
+func acceptBoth(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return errNoTypes(text)
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		for _, dec := range f.Specs {
+			if dec != nil && dec.Name != nil && name == dec.Name.Name {
+				f.acceptBoth[name] = set
+				f.log.infof("decoding type %s from maps and tuples...\n", name)
+			}
+		}
+	}
+	return nil
+}
+
+//msgp:transform {NameA} {NameB}...
+func declareTransform(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		if name == "" {
+			continue
+		}
+		f.transforms[name] = set
+		f.log.infof("declaring transform %s...\n", name)
+	}
+	return nil
+}
+
+// The methods generated for {Type} convert it
+// to {WireType} and use the methods generated
+// for {WireType}. {Type} must have the methods
+// ToWire() *{WireType} and FromWire(*{WireType}) error.
+//
+//msgp:marshalas {Type} {WireType}
+func marshalAs(text []string, f *FileSet) error {
+	if len(text) != 3 {
+		return fmt.Errorf("marshalas directive should have 2 arguments; found %d", len(text)-1)
+	}
+	if f.marshalas == nil {
+		f.marshalas = make(map[string]string)
+	}
+	name, wire := strings.TrimSpace(text[1]), strings.TrimSpace(text[2])
+	if _, ok := f.marshalas[name]; ok {
+		return fmt.Errorf("%s is already marshaled as %s", name, f.marshalas[name])
+	}
+	f.log.infof("marshaling %s as %s...\n", name, wire)
+	f.marshalas[name] = wire
+	return nil
+}
+
+// An Import is a package imported by the
+// generated file, declared with //msgp:import.
+type Import struct {
+	Name string // name it's imported as, if any
+	Path string // import path
+}
+
+// PkgName returns the name that the generated
+// code uses for the package: its name in the
+// directive, or else the last element of its
+// path that isn't a major version (like "v2").
+func (i Import) PkgName() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	elems := strings.Split(i.Path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.ParseUint(s[1:], 10, 32)
+	return err == nil
+}
+
+// Adds imports to the generated file, for shims
+// that use functions from other packages. Like
+// a Go import spec, each {Path} can be preceded
+// by the {Name} it's imported as. Every import
+// (besides _ imports) must be used by the
+// generated code.
+//
+//msgp:import [{Name}] "{Path}"...
+func addImport(text []string, f *FileSet) error {
+	var name string
+	var n int
+	for _, item := range text[1:] {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+		case !strings.HasPrefix(item, `"`):
+			if name != "" {
+				return fmt.Errorf("expected an import path after %s; found %s", name, item)
+			}
+			if item == "." {
+				return fmt.Errorf("dot imports aren't supported")
+			}
+			if !token.IsIdentifier(item) {
+				return fmt.Errorf("%q isn't a valid package name", item)
+			}
+			name = item
+			continue
+		}
+		path, err := strconv.Unquote(item)
+		if err != nil || path == "" {
+			return fmt.Errorf("%s isn't a valid import path", item)
+		}
+		if err := f.addImport(Import{Name: name, Path: path}); err != nil {
+			return err
+		}
+		name = ""
+		n++
+	}
+	if name != "" {
+		return fmt.Errorf("expected an import path after %s", name)
+	}
+	if n == 0 {
+		return fmt.Errorf("import directive has no import paths")
+	}
+	return nil
+}
+
+// addImport adds 'im' to the imports,
+// unless it's already there
+func (f *FileSet) addImport(im Import) error {
+	for _, old := range f.Imports {
+		if old == im {
+			return nil
+		}
+		if im.Name != "_" && old.PkgName() == im.PkgName() {
+			return fmt.Errorf("%s is already imported from %q", im.PkgName(), old.Path)
+		}
+	}
+	f.log.infof("importing %q...\n", im.Path)
+	f.Imports = append(f.Imports, im)
+	return nil
+}
@@ -1,14 +1,21 @@
 package parse
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/philhofer/msgp/gen"
 	"github.com/ttacon/chalk"
 	"go/ast"
 	"go/parser"
+	"go/printer"
 	"go/token"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -25,16 +32,113 @@ type FileSet struct {
 	Specs      []*ast.TypeSpec     // type specs in file
 	Directives []string            // preprocessor directives
 	Identities map[string]gen.Base // alias types (e.g. type Flag uint32)
+	Warnings   []Warning           // problems that didn't fail generation
+	Strict     bool                // treat tag problems and skipped fields as errors
+	NoJSONTags bool                // don't name fields without msg tags by their json tags
+	Unexported bool                // unexported types and fields are generated, too
+	Imports    []Import            // imports declared with //msgp:import
+	Packages   []Import            // imports of the packages that field types are from
 
-	processed map[string]flag  // processed type decls
-	shims     map[string]*shim // shims
-	tuples    map[string]flag  // tuples
+	fset       *token.FileSet       // positions of the parsed files
+	dirpos     []token.Pos          // positions of Directives
+	identpos   map[string]token.Pos // first use of each identifier
+	processed  map[string]flag      // processed type decls
+	shims      map[string]*shim     // shims
+	tuples     map[string]flag      // tuples
+	acceptBoth map[string]flag      // types decoded from maps and tuples
+	transforms map[string]flag      // declared transforms
+	marshalas  map[string]string    // types marshaled as other types
+	nilable    map[string]flag      // named pointer, map and slice types
+	defined    map[string]string    // types defined as other named types
+	imports    map[string][]Import  // imports of each parsed file
+	embeds     map[string]flag      // embedded types from other packages
+	errs       []error              // errors that fail generation
+	name       string               // what was parsed, for messages
+	log        logger               // prints progress, warnings and errors
+}
+
+// Options control how a file is processed.
+type Options struct {
+	// Strict causes unknown or malformed
+	// struct tag options, fields that are
+	// left out because their types aren't
+	// supported, and unresolved identifiers
+	// to fail generation, instead of being
+	// ignored with a warning.
+	Strict bool
+
+	// Methods are the names of the methods that
+	// will be generated for each type. Generation
+	// fails if a type already declares one of them
+	// outside of the generated files.
+	Methods []string
+
+	// Output is the file that generated code
+	// will be written to. It's skipped when
+	// looking for methods declared by hand.
+	Output string
+
+	// NoJSONTags names fields that have no msg
+	// tag by their Go names, and not by the
+	// names in their json tags, if they have them.
+	NoJSONTags bool
+
+	// Unexported generates methods for unexported
+	// types, too, and reads and writes their
+	// unexported fields, which the generated file
+	// can get at, since it's in the same package.
+	// (Otherwise, they're left out.)
+	Unexported bool
+
+	// Verbose prints each type as it's parsed
+	// and each directive as it's applied.
+	// Warnings and errors are printed either way.
+	Verbose bool
+
+	// Color prints messages in color.
+	Color bool
+
+	// Log is where messages are printed.
+	// If it's nil, they go to os.Stderr.
+	Log io.Writer
+}
+
+// Warning is a problem with a field or type
+// that doesn't stop generation, unless
+// the file set is processed strictly.
+type Warning struct {
+	Pos   token.Position // where the problem is, if known
+	Type  string         // name of the type, if not a field
+	Field string         // name of the field
+	Err   error          // the problem
+}
+
+// Error implements the error interface
+func (w Warning) Error() string {
+	var pos string
+	if w.Pos.IsValid() {
+		pos = w.Pos.String() + ": "
+	}
+	switch {
+	case w.Field != "":
+		return fmt.Sprintf("%sfield %q: %s", pos, w.Field, w.Err)
+	case w.Type != "":
+		return fmt.Sprintf("%stype %q: %s", pos, w.Type, w.Err)
+	default:
+		return pos + w.Err.Error()
+	}
 }
 
 // File parses a file at the relative path
 // provided and produces a new *FileSet.
 // (No exported structs is considered an error.)
 func File(name string) (*FileSet, error) {
+	return parseFile(name, false)
+}
+
+// parseFile is File, which leaves unexported
+// types and fields in if 'unexported' is set
+func parseFile(name string, unexported bool) (*FileSet, error) {
 	var files []*ast.File
 	var finfo os.FileInfo
 	var err error
@@ -58,10 +162,7 @@ func File(name string) (*FileSet, error) {
 			break
 		}
 		pkg = one.Name
-		files = make([]*ast.File, 0, len(one.Files))
-		for _, file := range one.Files {
-			files = append(files, file)
-		}
+		files = sortedFiles(one)
 	} else {
 		var f *ast.File
 		f, err = parser.ParseFile(fset, name, nil, parser.ParseComments)
@@ -72,14 +173,127 @@ func File(name string) (*FileSet, error) {
 		pkg = f.Name.Name
 	}
 
+	fs := newFileSet(fset, pkg, files, unexported)
+	fs.name = name
+	if len(fs.Specs) == 0 {
+		return nil, fs.noDefinitions()
+	}
+	return fs, nil
+}
+
+// NoDefinitionsError is the error returned when the
+// files parsed have no types to generate methods for:
+// they only hold constants, functions, aliases or types
+// that are skipped. It isn't a failure; it means that
+// there is nothing to write.
+type NoDefinitionsError struct {
+	Package    string // the package of the files
+	Files      string // the file, directory or files parsed
+	Unexported bool   // unexported types were looked for, too
+}
+
+func (e *NoDefinitionsError) Error() string {
+	return fmt.Sprintf("no %s in %s", definitions(e.Unexported), e.Files)
+}
+
+// noDefinitions returns the *NoDefinitionsError
+// for the file set
+func (fs *FileSet) noDefinitions() error {
+	return &NoDefinitionsError{Package: fs.Package, Files: fs.name, Unexported: fs.Unexported}
+}
+
+// definitions is what there are none of, when
+// there are no types to generate methods for
+func definitions(unexported bool) string {
+	if unexported {
+		return "definitions"
+	}
+	return "exported definitions"
+}
+
+// Files is like File, but parses the files
+// 'names', which have to be in the same package.
+// Like a directory's, they're processed in the
+// order of their names, not the order given.
+// The identifiers declared in the package's other
+// files are recorded, but their types aren't
+// processed, so that fields can refer to them as
+// they would if the whole package were parsed.
+func Files(names []string) (*FileSet, error) {
+	return parseFiles(names, false)
+}
+
+// parseFiles is Files, which leaves unexported
+// types and fields in if 'unexported' is set
+func parseFiles(names []string, unexported bool) (*FileSet, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no files to parse")
+	}
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	fset := token.NewFileSet()
+	files := make([]*ast.File, 0, len(names))
+	parsed := make(map[string]bool, len(names))
+	dir := filepath.Dir(names[0])
+	for _, name := range names {
+		if d := filepath.Dir(name); d != dir {
+			return nil, fmt.Errorf("%s and %s are in different directories", names[0], name)
+		}
+		f, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) > 0 && f.Name.Name != files[0].Name.Name {
+			return nil, fmt.Errorf("%s is in package %s, but %s is in package %s", names[0], files[0].Name.Name, name, f.Name.Name)
+		}
+		files = append(files, f)
+		parsed[filepath.Base(name)] = true
+	}
+	pkg := files[0].Name.Name
+
+	fs := newFileSet(fset, pkg, files, unexported)
+	fs.name = strings.Join(names, ", ")
+	if len(fs.Specs) == 0 {
+		return nil, fs.noDefinitions()
+	}
+
+	// the rest of the package; if it can't
+	// be parsed, neither can the package,
+	// but the files themselves may be fine
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !parsed[fi.Name()] && !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err == nil && pkgs[pkg] != nil {
+		for _, f := range sortedFiles(pkgs[pkg]) {
+			if !unexported {
+				ast.FileExports(f)
+			}
+			fs.getIdentities(f)
+		}
+	}
+	return fs, nil
+}
+
+// newFileSet returns the *FileSet for 'files', which
+// are in the package 'pkg', leaving out unexported
+// types and fields unless 'unexported' is set
+func newFileSet(fset *token.FileSet, pkg string, files []*ast.File, unexported bool) *FileSet {
 	var comments []string
+	var dirpos []token.Pos
 	for _, fl := range files {
-		comments = append(comments, yieldComments(fl.Comments)...)
+		text, pos := yieldComments(fl.Comments)
+		comments = append(comments, text...)
+		dirpos = append(dirpos, pos...)
 	}
+	// before unexported types are dropped,
+	// so that their directives are named, too
+	nameTypeDirectives(files, comments, dirpos)
 
 	// drop non-exported fields
-	for _, fl := range files {
-		ast.FileExports(fl)
+	if !unexported {
+		for _, fl := range files {
+			ast.FileExports(fl)
+		}
 	}
 
 	fs := &FileSet{
@@ -87,34 +301,65 @@ func File(name string) (*FileSet, error) {
 		Specs:      make([]*ast.TypeSpec, 0, 8), // pre-allocate some space
 		Directives: comments,
 		Identities: make(map[string]gen.Base),
+		Unexported: unexported,
+		fset:       fset,
+		dirpos:     dirpos,
+		identpos:   make(map[string]token.Pos),
 		processed:  make(map[string]flag),
 		shims:      make(map[string]*shim),
 		tuples:     make(map[string]flag),
+		acceptBoth: make(map[string]flag),
+		transforms: make(map[string]flag),
+		marshalas:  make(map[string]string),
+		nilable:    make(map[string]flag),
+		defined:    make(map[string]string),
+		imports:    make(map[string][]Import),
+		embeds:     make(map[string]flag),
+	}
+	for _, fl := range files {
+		name := fset.Position(fl.Pos()).Filename
+		fs.imports[name] = fileImports(fl)
 	}
 
 	// get specs from each *ast.File
 	for _, fl := range files {
 		fs.getTypeSpecs(fl)
 	}
+	return fs
+}
 
-	if len(fs.Specs) == 0 {
-		return nil, fmt.Errorf("no exported definitions in %s", name)
+// sortedFiles returns the files in 'pkg' in a fixed
+// order, so that directives and types are processed
+// the same way every time
+func sortedFiles(pkg *ast.Package) []*ast.File {
+	names := make([]string, 0, len(pkg.Files))
+	for fname := range pkg.Files {
+		names = append(names, fname)
 	}
-
-	return fs, nil
+	sort.Strings(names)
+	files := make([]*ast.File, 0, len(names))
+	for _, fname := range names {
+		files = append(files, pkg.Files[fname])
+	}
+	return files
 }
 
 // ApplyDirectives applies all of the preprocessor
 // directives to the file set in the order that they
 // appear in the source file.
 func (f *FileSet) ApplyDirectives() {
-	for _, d := range f.Directives {
+	for i, d := range f.Directives {
 		chunks := strings.Split(d, " ")
 		if len(chunks) > 0 {
 			if fn, ok := directives[chunks[0]]; ok {
 				err := fn(chunks, f)
 				if err != nil {
-					warnf("error applying directive: %s\n", err)
+					w := Warning{Err: fmt.Errorf("error applying directive: %s", err)}
+					if i < len(f.dirpos) {
+						w.Pos = f.position(f.dirpos[i])
+					}
+					f.log.warnf("warning: %s\n", w)
+					f.Warnings = append(f.Warnings, w)
 				}
 			}
 		}
@@ -126,19 +371,33 @@ func (f *FileSet) ApplyDirectives() {
 func (f *FileSet) Process() []gen.Elem {
 	g := make([]gen.Elem, 0, len(f.Specs))
 
+	// every file's identifiers are known
+	// by now, so types defined as others
+	// can be resolved before any are used
+	f.resolveIdentities()
+
 	// process each element, then
 	// resolve identifiers. we have
 	// to do this in two passes, b/c
 	// types are added to the "processed"
 	// list as we generate elements.
 
+	// types that contain themselves
+	// by value are left out
+	cyclic := f.checkCycles()
+
 	// generate elements
 	for _, spec := range f.Specs {
+		if cyclic[spec.Name.Name] {
+			continue
+		}
 		e := f.genElem(spec)
 		if e != nil {
 			g = append(g, e)
 		}
 	}
+	f.checkShims()
+
 	// resolve typedefs
 	var unresolved []string
 	for _, el := range g {
@@ -147,12 +406,20 @@ func (f *FileSet) Process() []gen.Elem {
 			unresolved = append(unresolved, un...)
 		}
 	}
-	// warn about unresolved identifiers
-	if len(unresolved) > 0 {
-		warnln("unresolved identifiers:")
-		for _, u := range unresolved {
-			warnf("\t-> %q\n", u)
+	// warn about unresolved identifiers,
+	// or fail, if the file set is strict
+	for _, u := range unresolved {
+		w := Warning{
+			Pos:  f.position(f.identpos[u]),
+			Type: u,
+			Err:  errors.New("unresolved identifier"),
+		}
+		if f.Strict {
+			f.fail(w)
+			continue
 		}
+		f.log.warnf("warning: %s\n", w)
+		f.Warnings = append(f.Warnings, w)
 	}
 
 	// propogate variable names
@@ -163,16 +430,274 @@ func (f *FileSet) Process() []gen.Elem {
 	return g
 }
 
+// resolveIdentities resolves the types that are
+// defined as other named types, like 'type B A',
+// to what those are, no matter which file or in
+// what order they're declared, so that fields of
+// the types are converted like fields of 'A' are.
+func (f *FileSet) resolveIdentities() {
+	for name := range f.defined {
+		seen := map[string]bool{name: true}
+		next := f.defined[name]
+		for {
+			if seen[next] {
+				break // an invalid cycle
+			}
+			seen[next] = true
+			to, ok := f.defined[next]
+			if !ok {
+				break
+			}
+			next = to
+		}
+		if tp, ok := f.Identities[next]; ok {
+			f.Identities[name] = tp
+			if _, ok := f.nilable[next]; ok {
+				f.nilable[name] = set
+			}
+		}
+	}
+}
+
+// checkShims warns about shimmed types that
+// also have generated methods. A shim always
+// takes precedence: fields of the type are
+// converted with the shim functions, and
+// the generated methods are not used for them.
+func (f *FileSet) checkShims() {
+	names := make([]string, 0, len(f.shims))
+	for name := range f.shims {
+		if _, ok := f.processed[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		shm := f.shims[name]
+		w := Warning{
+			Pos:  f.position(f.specPos(name)),
+			Type: name,
+			Err:  fmt.Errorf("has generated methods, but fields of this type use the shim %s/%s", shm.to, shm.from),
+		}
+		f.log.warnf("warning: %s\n", w)
+		f.Warnings = append(f.Warnings, w)
+	}
+}
+
 // GetElems creates a FileSet from 'filename' and
-// returns the processed elements.
+// returns the processed elements. If there are none,
+// the error is a *NoDefinitionsError.
 func GetElems(filename string) ([]gen.Elem, string, error) {
-	fs, err := File(filename)
+	return GetElemsOpts(filename, Options{})
+}
+
+// GetElemsOpts is like GetElems, but
+// processes the file according to 'opts'.
+func GetElemsOpts(filename string, opts Options) ([]gen.Elem, string, error) {
+	fs, g, err := GetFile(filename, opts)
 	if err != nil {
 		return nil, "", err
 	}
+	return g, fs.Package, nil
+}
+
+// GetFile is like GetElemsOpts, but returns
+// the processed file set, which also has the
+// imports declared by directives.
+func GetFile(filename string, opts Options) (*FileSet, []gen.Elem, error) {
+	fs, err := parseFile(filename, opts.Unexported)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fs.process(filename, opts)
+}
+
+// GetFiles is GetFile for the files 'names'
+// in one package (see Files).
+func GetFiles(names []string, opts Options) (*FileSet, []gen.Elem, error) {
+	fs, err := parseFiles(names, opts.Unexported)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fs.process(names[0], opts)
+}
+
+// process applies the directives and processes
+// the file set, which was parsed from 'name'
+func (fs *FileSet) process(filename string, opts Options) (*FileSet, []gen.Elem, error) {
+	fs.Strict = opts.Strict
+	fs.NoJSONTags = opts.NoJSONTags
+	fs.log = logger{w: opts.Log, verbose: opts.Verbose, color: opts.Color}
 	fs.ApplyDirectives()
 	g := fs.Process()
-	return g, fs.Package, nil
+	fs.checkMethods(filename, opts)
+	fs.checkMarshalAs(filename, opts)
+	if err := fs.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(g) == 0 {
+		return nil, nil, fs.noDefinitions()
+	}
+	return fs, g, nil
+}
+
+// Err returns a non-nil error if any
+// errors were encountered while processing
+// the file set that should cause generation
+// to fail.
+func (fs *FileSet) Err() error {
+	switch len(fs.errs) {
+	case 0:
+		return nil
+	case 1:
+		return fs.errs[0]
+	default:
+		return fmt.Errorf("%s (and %d more errors)", fs.errs[0], len(fs.errs)-1)
+	}
+}
+
+// fail records a problem that will
+// cause generation to fail
+func (fs *FileSet) fail(w Warning) {
+	if fs.log.verbose {
+		fs.log.fatalf(" (\u2717 %s)", w)
+	} else {
+		fs.log.fatalf("error: %s\n", w)
+	}
+	fs.errs = append(fs.errs, w)
+}
+
+// warn records a problem with a struct
+// tag, which is an error if the file
+// set is strict
+func (fs *FileSet) warn(w Warning) {
+	if fs.Strict {
+		fs.fail(w)
+		return
+	}
+	if fs.log.verbose {
+		fs.log.warnf(" (\u26a0 %s; ignoring)", w)
+	} else {
+		fs.log.warnf("warning: %s; ignoring\n", w)
+	}
+	fs.Warnings = append(fs.Warnings, w)
+}
+
+// skipField records a field that's left
+// out of the generated code, which is an
+// error if the file set is strict
+func (fs *FileSet) skipField(w Warning) {
+	if fs.Strict {
+		fs.fail(w)
+		return
+	}
+	w.Err = fmt.Errorf("%s; ignoring the field", w.Err)
+	fs.addWarning(w)
+}
+
+// skipEmbedded is skipField for 'f', an embedded
+// field, which takes all of the fields of its type
+// with it, so the warning (or error) says so
+func (fs *FileSet) skipEmbedded(f *ast.Field, w Warning) {
+	typ := fs.source(f.Type)
+	if star, ok := f.Type.(*ast.StarExpr); ok {
+		typ = fs.source(star.X)
+	}
+	if fs.Strict {
+		w.Err = fmt.Errorf("%s, so none of the fields of the embedded %s can be serialized (declare them in the struct instead)", w.Err, typ)
+		fs.fail(w)
+		return
+	}
+	w.Err = fmt.Errorf("%s; ignoring the field, so NONE of the fields of the embedded %s will be serialized (declare them in the struct instead to serialize them)", w.Err, typ)
+	fs.addWarning(w)
+}
+
+// addWarning records a warning that
+// never causes generation to fail
+func (fs *FileSet) addWarning(w Warning) {
+	if fs.log.verbose {
+		fs.log.warnf(" (\u26a0 %s)", w)
+	} else {
+		fs.log.warnf("warning: %s\n", w)
+	}
+	fs.Warnings = append(fs.Warnings, w)
+}
+
+// position returns the file, line, and
+// column of 'p', if it is known
+func (fs *FileSet) position(p token.Pos) token.Position {
+	if fs.fset == nil || !p.IsValid() {
+		return token.Position{}
+	}
+	return fs.fset.Position(p)
+}
+
+// specPos returns the position of
+// the declaration of type 'name'
+func (fs *FileSet) specPos(name string) token.Pos {
+	for _, ts := range fs.Specs {
+		if ts.Name.Name == name {
+			return ts.Pos()
+		}
+	}
+	return token.NoPos
+}
+
+// Position returns the position of the declaration
+// of type 'typ', or of its field 'field', if it's a
+// struct with a field by that name
+func (fs *FileSet) Position(typ string, field string) token.Position {
+	for _, ts := range fs.Specs {
+		if ts.Name.Name != typ {
+			continue
+		}
+		if st, ok := ts.Type.(*ast.StructType); ok && field != "" {
+			for _, f := range st.Fields.List {
+				if len(f.Names) == 0 && embedded(f.Type) == field {
+					return fs.position(f.Pos())
+				}
+				for _, n := range f.Names {
+					if n.Name == field {
+						return fs.position(n.Pos())
+					}
+				}
+			}
+		}
+		return fs.position(ts.Pos())
+	}
+	return token.Position{}
+}
+
+// EmbeddedType returns the type of the field 'field' of
+// the struct 'typ', like pb.Header, if it's embedded and
+// from another package, so that it's written with the
+// methods of its own; otherwise, it returns ""
+func (fs *FileSet) EmbeddedType(typ string, field string) string {
+	for _, ts := range fs.Specs {
+		st, ok := ts.Type.(*ast.StructType)
+		if !ok || ts.Name.Name != typ {
+			continue
+		}
+		for _, f := range st.Fields.List {
+			if len(f.Names) > 0 || embedded(f.Type) != field {
+				continue
+			}
+			if sel := embeddedSelector(f.Type); sel != nil {
+				return stringify(sel)
+			}
+		}
+	}
+	return ""
+}
+
+// fieldWarning returns a Warning about field 'f'
+func (fs *FileSet) fieldWarning(f *ast.Field, format string, v ...interface{}) Warning {
+	return Warning{Pos: fs.position(f.Pos()), Field: fieldName(f), Err: fmt.Errorf(format, v...)}
+}
+
+// tagWarning returns a Warning about the tag of field 'f'
+func (fs *FileSet) tagWarning(f *ast.Field, format string, v ...interface{}) Warning {
+	return Warning{Pos: fs.position(f.Tag.Pos()), Field: fieldName(f), Err: fmt.Errorf(format, v...)}
 }
 
 // getTypeSpecs extracts all of the *ast.TypeSpecs in the file.
@@ -191,49 +716,101 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 				if ts, ok := s.(*ast.TypeSpec); ok {
 					//out = append(out, ts)
 					fs.Specs = append(fs.Specs, ts)
+					fs.addIdentity(ts)
+				}
+			}
+		}
+	}
+}
 
-					// record identifier
-					switch ts.Type.(type) {
-					case *ast.StructType:
-						fs.Identities[ts.Name.Name] = gen.IDENT
-
-					case *ast.Ident:
-						// we will resolve this later
-						fs.Identities[ts.Name.Name] = pullIdent(ts.Type.(*ast.Ident).Name)
-
-					case *ast.ArrayType:
-						a := ts.Type.(*ast.ArrayType)
-						switch a.Elt.(type) {
-						case *ast.Ident:
-							if a.Elt.(*ast.Ident).Name == "byte" && a.Len == nil {
-								fs.Identities[ts.Name.Name] = gen.Bytes
-							} else {
-								fs.Identities[ts.Name.Name] = gen.IDENT
-							}
-						default:
-							fs.Identities[ts.Name.Name] = gen.IDENT
-						}
-
-					case *ast.StarExpr:
-						fs.Identities[ts.Name.Name] = gen.IDENT
-
-					case *ast.MapType:
-						fs.Identities[ts.Name.Name] = gen.IDENT
-
-					}
+// getIdentities records the identifiers declared
+// in a file of the package that isn't processed,
+// so that fields of those types can be resolved.
+func (fs *FileSet) getIdentities(f *ast.File) {
+	for _, d := range f.Decls {
+		if g, ok := d.(*ast.GenDecl); ok {
+			for _, s := range g.Specs {
+				if ts, ok := s.(*ast.TypeSpec); ok {
+					fs.addIdentity(ts)
 				}
 			}
 		}
 	}
 }
 
+// addIdentity records the identifier declared by 'ts'
+func (fs *FileSet) addIdentity(ts *ast.TypeSpec) {
+	switch ts.Type.(type) {
+	case *ast.StructType:
+		fs.Identities[ts.Name.Name] = gen.IDENT
+
+	case *ast.Ident:
+		// we will resolve this later
+		// (see resolveIdentities)
+		name := ts.Type.(*ast.Ident).Name
+		fs.Identities[ts.Name.Name] = gen.BaseOf(name)
+		if gen.BaseOf(name) == gen.IDENT {
+			fs.defined[ts.Name.Name] = name
+		}
+
+	case *ast.ArrayType:
+		a := ts.Type.(*ast.ArrayType)
+		switch a.Elt.(type) {
+		case *ast.Ident:
+			if a.Elt.(*ast.Ident).Name == "byte" && a.Len == nil {
+				fs.Identities[ts.Name.Name] = gen.Bytes
+			} else {
+				fs.Identities[ts.Name.Name] = gen.IDENT
+			}
+		default:
+			fs.Identities[ts.Name.Name] = gen.IDENT
+		}
+		if a.Len == nil {
+			fs.nilable[ts.Name.Name] = set
+		}
+
+	case *ast.StarExpr:
+		fs.Identities[ts.Name.Name] = gen.IDENT
+		fs.nilable[ts.Name.Name] = set
+
+	case *ast.SelectorExpr:
+		// like 'type Timeout time.Duration' or 'type Gateway net.IP'
+		if b := gen.DefinedBase(stringify(ts.Type)); b != gen.IDENT {
+			fs.Identities[ts.Name.Name] = b
+		}
+
+	case *ast.MapType:
+		fs.Identities[ts.Name.Name] = gen.IDENT
+		fs.nilable[ts.Name.Name] = set
+
+	}
+}
+
 // genElem creates the gen.Elem out of an
 // ast.TypeSpec. Right now the only supported
-// TypeSpec.Type is *ast.StructType. Unsupported
-// types will yield a 'nil' return value.
+// TypeSpec.Types are *ast.StructType,
+// *ast.MapType, *ast.ArrayType without a
+// length (slices), and *ast.Ident naming a
+// base type. Unsupported types will yield
+// a 'nil' return value.
 func (fs *FileSet) genElem(in *ast.TypeSpec) gen.Elem {
+	// aliases can't have methods
+	if in.Assign.IsValid() {
+		return nil
+	}
+	if _, ok := in.Type.(*ast.MapType); ok {
+		return fs.genMap(in)
+	}
+	if a, ok := in.Type.(*ast.ArrayType); ok && a.Len == nil {
+		return fs.genSlice(in)
+	}
+	switch in.Type.(type) {
+	case *ast.Ident, *ast.SelectorExpr:
+		return fs.genBase(in)
+	}
 	if v, ok := in.Type.(*ast.StructType); ok {
-		fmt.Printf(chalk.Green.Color("parsing %s..."), in.Name.Name)
+		fs.log.infof("parsing %s...", in.Name.Name)
+		nerr := len(fs.errs)
 		p := &gen.Ptr{
 			Value: &gen.Struct{
 				Name:   in.Name.Name, // ast.Ident
@@ -248,15 +825,145 @@ func (fs *FileSet) genElem(in *ast.TypeSpec) gen.Elem {
 		if _, ok := fs.tuples[in.Name.Name]; ok {
 			p.Value.(*gen.Struct).AsTuple = true
 		}
+		if _, ok := fs.acceptBoth[in.Name.Name]; ok {
+			p.Value.(*gen.Struct).AcceptBoth = true
+		}
+
+		// tuples are positional, so every
+		// field has to be read and written
+		if p.Value.(*gen.Struct).AsTuple {
+			fields := p.Value.(*gen.Struct).Fields
+			for i := range fields {
+				f := &fields[i]
+				if f.DecodeOnly || f.EncodeOnly {
+					fs.warn(Warning{Pos: fs.position(in.Pos()), Type: in.Name.Name, Err: fmt.Errorf("is a tuple, so field %s can't be decodeonly or encodeonly", f.FieldName)})
+					f.DecodeOnly, f.EncodeOnly = false, false
+				}
+				if f.OmitEmpty {
+					fs.warn(Warning{Pos: fs.position(in.Pos()), Type: in.Name.Name, Err: fmt.Errorf("is a tuple, so field %s can't be omitempty", f.FieldName)})
+					f.OmitEmpty = false
+				}
+			}
+		}
 
-		if len(p.Value.(*gen.Struct).Fields) == 0 {
-			fmt.Printf(chalk.Red.Color(" has no exported fields \u2717\n")) // X
+		// its fields are only
+		// used by Clone and CopyTo
+		wire := fs.marshalas[in.Name.Name]
+		p.Value.(*gen.Struct).MarshalAs = wire
+
+		if len(fs.errs) > nerr {
+			fs.log.progressf(chalk.Red, "  \u2717\n") // X
+			return nil
+		}
+
+		if len(p.Value.(*gen.Struct).Fields) == 0 && wire == "" {
+			fs.log.progressf(chalk.Red, " has no exported fields \u2717\n") // X
 			return nil
 		}
-		fmt.Print(chalk.Green.Color("  \u2713\n")) // check
+		fs.log.progressf(chalk.Green, "  \u2713\n") // check
 		return p
 	}
-	return nil // all non-*ast.StructType elements are unsupported
+	return nil // all other elements are unsupported
+}
+
+// genMap creates the gen.Elem for a named map
+// type, which gets the same methods as a struct
+func (fs *FileSet) genMap(in *ast.TypeSpec) gen.Elem {
+	fs.log.infof("parsing %s...", in.Name.Name)
+
+	// only structs can be marshaled
+	// as other types (see checkMarshalAs)
+	if _, ok := fs.marshalas[in.Name.Name]; ok {
+		fs.log.progressf(chalk.Red, "  \u2717\n") // X
+		return nil
+	}
+
+	m, ok := fs.parseExpr(in.Type).(*gen.Map)
+	if !ok {
+		fs.addWarning(Warning{
+			Pos:  fs.position(in.Pos()),
+			Type: in.Name.Name,
+			Err:  fmt.Errorf("type %s isn't supported", fs.source(in.Type)),
+		})
+		return nil
+	}
+	m.Name = in.Name.Name
+	fs.processed[in.Name.Name] = set
+	fs.log.progressf(chalk.Green, "  \u2713\n") // check
+	return &gen.Ptr{Value: m}
+}
+
+// genSlice creates the gen.Elem for a named
+// slice type, which gets the same methods as
+// a struct. A named []byte is written as bytes,
+// and fields of its type are still converted
+// to []byte instead of calling its methods.
+func (fs *FileSet) genSlice(in *ast.TypeSpec) gen.Elem {
+	fs.log.infof("parsing %s...", in.Name.Name)
+
+	// only structs can be marshaled
+	// as other types (see checkMarshalAs)
+	if _, ok := fs.marshalas[in.Name.Name]; ok {
+		fs.log.progressf(chalk.Red, "  \u2717\n") // X
+		return nil
+	}
+
+	switch e := fs.parseExpr(in.Type).(type) {
+	case *gen.Slice:
+		e.Name = in.Name.Name
+		fs.processed[in.Name.Name] = set
+		fs.log.progressf(chalk.Green, "  \u2713\n") // check
+		return &gen.Ptr{Value: e}
+	case *gen.BaseElem:
+		return fs.namedBase(in, e.Value)
+	}
+	fs.addWarning(Warning{
+		Pos:  fs.position(in.Pos()),
+		Type: in.Name.Name,
+		Err:  fmt.Errorf("type %s isn't supported", fs.source(in.Type)),
+	})
+	return nil
+}
+
+// genBase creates the gen.Elem for a named
+// base type, like 'type UserID uint64' or
+// 'type Timeout time.Duration'. Types defined
+// as other named types are skipped.
+func (fs *FileSet) genBase(in *ast.TypeSpec) gen.Elem {
+	var b gen.Base
+	if id, ok := in.Type.(*ast.Ident); ok {
+		b = gen.BaseOf(id.Name)
+	} else {
+		b = gen.DefinedBase(stringify(in.Type))
+	}
+	if b == gen.IDENT {
+		return nil
+	}
+	fs.log.infof("parsing %s...", in.Name.Name)
+
+	// only structs can be marshaled
+	// as other types (see checkMarshalAs)
+	if _, ok := fs.marshalas[in.Name.Name]; ok {
+		fs.log.progressf(chalk.Red, "  \u2717\n") // X
+		return nil
+	}
+	return fs.namedBase(in, b)
+}
+
+// namedBase returns the gen.Elem for a type
+// whose underlying type is the base type 'b'.
+// Its methods convert it to and from 'b', or
+// use its shim, just as fields of the type do.
+// The type isn't marked as processed, so those
+// fields are still converted, and don't call
+// the methods.
+func (fs *FileSet) namedBase(in *ast.TypeSpec, b gen.Base) gen.Elem {
+	e := &gen.BaseElem{Value: b, Convert: true, Ident: in.Name.Name}
+	if shm, ok := fs.shims[in.Name.Name]; ok {
+		e.Value, e.ShimToBase, e.ShimFromBase = shm.tp, shm.to, shm.from
+	}
+	fs.log.progressf(chalk.Green, "  \u2713\n") // check
+	return &gen.Ptr{Value: e}
 }
 
 // this is where most of the magic happens
@@ -276,49 +983,140 @@ func (fs *FileSet) parseFieldList(fl *ast.FieldList) []gen.StructField {
 
 // translate *ast.Field into []gen.StructField
 func (fs *FileSet) getField(f *ast.Field) []gen.StructField {
-	sf := make([]gen.StructField, 1)
-	var extension bool
-	// parse tag; otherwise field name is field tag
-	if f.Tag != nil {
-		body := reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Get("msg")
-		tags := strings.Split(body, ",")
-		if len(tags) == 2 && tags[1] == "extension" {
-			extension = true
+	// blank fields can't be read or written
+	// (and are only here with Unexported)
+	if len(f.Names) > 0 {
+		var names []*ast.Ident
+		for _, nm := range f.Names {
+			if nm.Name != "_" {
+				names = append(names, nm)
+			}
 		}
-		// ignore "-" fields
-		if tags[0] == "-" {
+		if len(names) == 0 {
 			return nil
 		}
-		sf[0].FieldTag = tags[0]
+		if len(names) < len(f.Names) {
+			nf := *f
+			nf.Names = names
+			f = &nf
+		}
+	}
+	tag, ok := fs.fieldTag(f)
+	if !ok {
+		return nil
+	}
+	if len(f.Names) <= 1 {
+		if sf, ok := fs.fieldOf(f, tag); ok {
+			return []gen.StructField{sf}
+		}
+		return nil
+	}
+
+	// a multiple in-line declaration, e.g. type A struct
+	// { One, Two int }, is a field for each name, with all
+	// of the tag but its name, which can only name one
+	if tag.Name != "" {
+		fs.warn(fs.tagWarning(f, "names %d fields %q; using their own names", len(f.Names), tag.Name))
+		tag.Name = ""
+	}
+	var out []gen.StructField
+	for _, nm := range f.Names {
+		nf := *f
+		nf.Names = []*ast.Ident{nm}
+		if sf, ok := fs.fieldOf(&nf, tag); ok {
+			out = append(out, sf)
+		}
+	}
+	return out
+}
+
+// fieldTag parses the tag of 'f', and returns false
+// if it leaves the field out (as "-" does)
+func (fs *FileSet) fieldTag(f *ast.Field) (Tag, bool) {
+	var tag Tag
+	// parse tag; otherwise field name is field tag
+	if f.Tag == nil {
+		return tag, true
+	}
+	st := reflect.StructTag(strings.Trim(f.Tag.Value, "`"))
+	if body, ok := st.Lookup("msg"); ok || fs.NoJSONTags {
+		var errs []error
+		tag, errs = ParseTag(body)
+		// ignore "-" fields
+		if tag.Name == "-" {
+			return tag, false
+		}
+		for _, err := range errs {
+			fs.warn(Warning{Pos: fs.position(f.Tag.Pos()), Field: fieldName(f), Err: err})
+		}
+	} else if body, ok := st.Lookup("json"); ok {
+		// without a msg tag, the field has the name
+		// in its json tag, but none of its options,
+		// which aren't ours
+		if body == "-" {
+			return tag, false
+		}
+		tag.Name = strings.SplitN(body, ",", 2)[0]
+	}
+	return tag, true
+}
+
+// fieldOf translates 'f', which has one name or none
+// (if it's embedded), with tag 'tag', and returns false
+// if the field is left out
+func (fs *FileSet) fieldOf(f *ast.Field, tag Tag) (gen.StructField, bool) {
+	sf := gen.StructField{FieldTag: tag.Name}
+	extension := tag.Has("extension")
+	allownil := tag.Has("allownil")
+	bitset := tag.Has("bitset")
+	coerce := tag.Has("coerce")
+	decodeOnly := tag.Has("decodeonly")
+	encodeOnly := tag.Has("encodeonly")
+	omitEmpty := tag.Has("omitempty")
+	transform := tag.Options["transform"]
+	epoch, hasEpoch := tag.Options["epoch"]
+	maxentries, hasMax := tag.Options["maxentries"]
+	overflow, hasOverflow := tag.Options["overflow"]
+	as, hasAs := tag.Options["as"]
+	using, hasUsing := tag.Options["using"]
+
+	skip := fs.skipField
+	if len(f.Names) == 0 {
+		skip = func(w Warning) { fs.skipEmbedded(f, w) }
 	}
 
+	nerr := len(fs.errs)
 	ex := fs.parseExpr(f.Type)
 	if ex == nil {
-		return nil
+		// unless parseExpr has said why
+		if len(fs.errs) > nerr {
+			return sf, false
+		}
+		skip(fs.fieldWarning(f, "type %s isn't supported", fs.source(f.Type)))
+		return sf, false
 	}
 
 	// parse field name
 	switch len(f.Names) {
 	case 0:
-		sf[0].FieldName = embedded(f.Type)
-	case 1:
-		sf[0].FieldName = f.Names[0].Name
-	default:
-		// this is for a multiple in-line declaration,
-		// e.g. type A struct { One, Two int }
-		sf = sf[0:0]
-		for _, nm := range f.Names {
-			sf = append(sf, gen.StructField{
-				FieldTag:  nm.Name,
-				FieldName: nm.Name,
-				FieldElem: fs.parseExpr(f.Type),
-			})
+		sf.FieldName = embedded(f.Type)
+		// a type from another package has to have
+		// methods of its own, which the type check
+		// of the generated file makes sure of
+		if sel := embeddedSelector(f.Type); sel != nil {
+			pkg := sel.X.(*ast.Ident).Name
+			if _, ok := fs.fileImport(pkg, sel.Pos()); !ok && !fs.imported(pkg) {
+				skip(fs.fieldWarning(f, "package %s isn't imported", pkg))
+				return sf, false
+			}
+			fs.embeds[stringify(sel)] = set
 		}
-		return sf
+	default:
+		sf.FieldName = f.Names[0].Name
 	}
-	sf[0].FieldElem = ex
-	if sf[0].FieldTag == "" {
-		sf[0].FieldTag = sf[0].FieldName
+	sf.FieldElem = ex
+	if sf.FieldTag == "" {
+		sf.FieldTag = sf.FieldName
 	}
 
 	// validate extension
@@ -328,17 +1126,222 @@ func (fs *FileSet) getField(f *ast.Field) []gen.StructField {
 			if ex.Ptr().Value.Type() == gen.BaseType {
 				ex.Ptr().Value.Base().Value = gen.Ext
 			} else {
-				warnf(" (\u26a0 field %q couldn't be cast as an extension)", sf[0].FieldName)
-				return nil
+				skip(fs.fieldWarning(f, "couldn't be cast as an extension"))
+				return sf, false
 			}
 		case gen.BaseType:
 			ex.Base().Value = gen.Ext
 		default:
-			warnf(" (\u26a0 field %q couldn't be cast as an extension)", sf[0].FieldName)
-			return nil
+			skip(fs.fieldWarning(f, "couldn't be cast as an extension"))
+			return sf, false
+		}
+	}
+
+	// validate as and using, which shim the field
+	// as //msgp:shim does every field of its type
+	// (and take the place of that shim, if any)
+	if hasAs || hasUsing {
+		fs.fieldShim(f, ex, as, using, hasAs && hasUsing)
+	}
+
+	// validate allownil
+	if allownil {
+		switch ex.Type() {
+		case gen.SliceType:
+			ex.Slice().AllowNil = true
+		case gen.MapType:
+			ex.Map().AllowNil = true
+		case gen.BaseType:
+			// a named slice or map type is written by its
+			// own methods, which the field checks for nil
+			// before calling; they read 'nil' back as nil
+			b := ex.Base()
+			_, nilable := fs.nilable[b.Ident]
+			switch {
+			case b.Value == gen.IDENT && nilable:
+				b.AllowNil = true
+			case b.Value == gen.IDENT:
+				fs.addWarning(fs.fieldWarning(f, "type %s isn't a slice or map type declared in this package; ignoring allownil", b.Ident))
+			default:
+				fs.addWarning(fs.fieldWarning(f, "isn't a slice or map; ignoring allownil"))
+			}
+		default:
+			fs.addWarning(fs.fieldWarning(f, "isn't a slice or map; ignoring allownil"))
+		}
+	}
+
+	// validate bitset, which only
+	// packs plain []bool fields
+	if bitset {
+		if s, ok := ex.(*gen.Slice); ok && isPlainBool(s.Els) {
+			s.Bitset = true
+		} else {
+			fs.addWarning(fs.fieldWarning(f, "isn't a []bool; ignoring bitset"))
+		}
+	}
+
+	// validate maxentries and overflow
+	if hasMax {
+		n, err := strconv.ParseUint(maxentries, 10, 32)
+		switch {
+		case err != nil || n == 0:
+			fs.warn(fs.tagWarning(f, "maxentries %q isn't a positive 32-bit number", maxentries))
+		case ex.Type() != gen.MapType:
+			fs.addWarning(fs.fieldWarning(f, "isn't a map; ignoring maxentries"))
+		default:
+			ex.Map().MaxEntries = uint32(n)
+		}
+	}
+	if hasOverflow {
+		switch {
+		case overflow != "error" && overflow != "drop":
+			fs.warn(fs.tagWarning(f, "overflow policy %q isn't \"error\" or \"drop\"", overflow))
+		case !hasMax:
+			fs.warn(fs.tagWarning(f, "overflow needs maxentries"))
+		case ex.Type() == gen.MapType:
+			ex.Map().DropOverflow = overflow == "drop"
+		}
+	}
+
+	// validate coerce
+	if coerce {
+		be := ex.Base()
+		if ex.Type() == gen.PtrType {
+			be = ex.Ptr().Value.Base()
+		}
+		// identifiers may turn out to be numbers
+		// once they are resolved
+		if be != nil && (be.CanCoerce() || be.Value == gen.IDENT) {
+			be.Coerce = true
+		} else {
+			fs.addWarning(fs.fieldWarning(f, "isn't a number; ignoring coerce"))
+		}
+	}
+
+	// validate transform
+	if transform != "" {
+		if _, ok := fs.transforms[transform]; !ok {
+			fs.fail(fs.fieldWarning(f, "uses unknown transform %q (declare it with //msgp:transform %s)", transform, transform))
+			return sf, false
+		}
+		switch ex.Type() {
+		case gen.PtrType:
+			if ex.Ptr().Value.Type() == gen.BaseType {
+				ex.Ptr().Value.Base().Transform = transform
+			} else {
+				fs.fail(fs.fieldWarning(f, "can't be transformed; only base types and identities are supported"))
+				return sf, false
+			}
+		case gen.BaseType:
+			ex.Base().Transform = transform
+		default:
+			fs.fail(fs.fieldWarning(f, "can't be transformed; only base types and identities are supported"))
+			return sf, false
 		}
 	}
-	return sf
+
+	// validate epoch, which writes a time.Time
+	// as an integer of the unit
+	if hasEpoch {
+		be := ex.Base()
+		if ex.Type() == gen.PtrType {
+			be = ex.Ptr().Value.Base()
+		}
+		switch {
+		case !gen.EpochUnitOK(epoch):
+			fs.warn(fs.tagWarning(f, "epoch unit %q isn't s, ms or ns", epoch))
+		// identifiers may turn out to be times
+		// once they are resolved
+		case be == nil || (be.Value != gen.Time && be.Value != gen.IDENT):
+			fs.addWarning(fs.fieldWarning(f, "isn't a time.Time; ignoring epoch"))
+		case be.IsTransform():
+			fs.addWarning(fs.fieldWarning(f, "is transformed; ignoring epoch"))
+		default:
+			be.Epoch = epoch
+		}
+	}
+
+	// validate decodeonly and encodeonly
+	if decodeOnly && encodeOnly {
+		fs.warn(fs.tagWarning(f, "decodeonly and encodeonly together would leave the field out entirely"))
+	} else {
+		sf.DecodeOnly = decodeOnly
+		sf.EncodeOnly = encodeOnly
+	}
+
+	// validate omitempty
+	if omitEmpty {
+		switch {
+		case sf.DecodeOnly:
+			fs.addWarning(fs.fieldWarning(f, "is decodeonly, so it's never written; ignoring omitempty"))
+		case !fs.canOmitEmpty(ex):
+			fs.addWarning(fs.fieldWarning(f, "type %s has no empty value to leave out; ignoring omitempty", fs.source(f.Type)))
+		default:
+			sf.OmitEmpty = true
+		}
+	}
+	return sf, true
+}
+
+// fieldShim applies the shim in the as and using options
+// of the tag of 'f', whose type is 'ex'; 'both' is whether
+// or not both are set
+func (fs *FileSet) fieldShim(f *ast.Field, ex gen.Elem, as string, using string, both bool) {
+	typ := f.Type
+	be := ex.Base()
+	if star, ok := typ.(*ast.StarExpr); ok && ex.Type() == gen.PtrType {
+		typ, be = star.X, ex.Ptr().Value.Base()
+	}
+	base := gen.BaseOf(as)
+	methods := strings.Split(using, "/")
+	switch {
+	case !both:
+		fs.warn(fs.tagWarning(f, "as and using go together"))
+	case base == gen.IDENT || base == gen.Intf || base == gen.Ext:
+		fs.warn(fs.tagWarning(f, "as %q isn't a base type", as))
+	case len(methods) != 2 || methods[0] == "" || methods[1] == "":
+		fs.warn(fs.tagWarning(f, "using %q isn't toFunc/fromFunc", using))
+	case be == nil:
+		fs.addWarning(fs.fieldWarning(f, "type %s can't be shimmed; ignoring as and using", fs.source(f.Type)))
+	default:
+		be.Value, be.Convert, be.Ident = base, true, stringify(typ)
+		be.ShimToBase, be.ShimFromBase = methods[0], methods[1]
+	}
+}
+
+// canOmitEmpty returns whether or not it can be told
+// if 'e' is empty (see gen.CanOmitEmpty). Named types
+// are, if they're declared as base types, which fields
+// are converted to, or pointers, maps or slices, which
+// are empty if they're nil.
+func (fs *FileSet) canOmitEmpty(e gen.Elem) bool {
+	if b := e.Base(); b != nil && b.Value == gen.IDENT {
+		if _, ok := fs.nilable[b.Ident]; ok {
+			return true
+		}
+		if _, ok := fs.shims[b.Ident]; ok {
+			return true
+		}
+		tp, ok := fs.Identities[b.Ident]
+		return ok && tp != gen.IDENT
+	}
+	return gen.CanOmitEmpty(e)
+}
+
+// isPlainBool returns whether or not 'e' is a bool
+// that's written as one, and not a named or shimmed
+// type that's converted to and from a bool
+func isPlainBool(e gen.Elem) bool {
+	b, ok := e.(*gen.BaseElem)
+	return ok && b.Value == gen.Bool && !b.Convert && b.Transform == ""
+}
+
+// fieldName returns the (first) name of a field
+func fieldName(f *ast.Field) string {
+	if len(f.Names) > 0 {
+		return f.Names[0].Name
+	}
+	return embedded(f.Type)
 }
 
 // extract embedded field name
@@ -348,14 +1351,29 @@ func embedded(f ast.Expr) string {
 		return f.(*ast.Ident).Name
 	case *ast.StarExpr:
 		return embedded(f.(*ast.StarExpr).X)
+	case *ast.SelectorExpr:
+		// pkg.Type is named Type
+		return f.(*ast.SelectorExpr).Sel.Name
 	default:
-		// other possibilities (like selector expressions)
-		// are disallowed; we can't reasonably know
-		// their type
 		return ""
 	}
 }
 
+// embeddedSelector returns the type of an embedded
+// field 'f' if it's from another package, like
+// pb.Header in pb.Header or *pb.Header, or nil
+func embeddedSelector(f ast.Expr) *ast.SelectorExpr {
+	if star, ok := f.(*ast.StarExpr); ok {
+		f = star.X
+	}
+	if sel, ok := f.(*ast.SelectorExpr); ok {
+		if _, ok := sel.X.(*ast.Ident); ok {
+			return sel
+		}
+	}
+	return nil
+}
+
 // stringify a field type name
 func stringify(e ast.Expr) string {
 	switch e.(type) {
@@ -411,19 +1429,36 @@ func (fs *FileSet) parseExpr(e ast.Expr) gen.Elem {
 
 	case *ast.MapType:
 		m := e.(*ast.MapType)
-		if k, ok := m.Key.(*ast.Ident); ok && k.Name == "string" {
-			if in := fs.parseExpr(m.Value); in != nil {
-				return &gen.Map{Value: in}
+		k, ok := m.Key.(*ast.Ident)
+		if !ok {
+			return nil
+		}
+		var key gen.Base
+		var ident string
+		if k.Name != "string" {
+			if key = intKey(k.Name); key == gen.Invalid {
+				// a named type over string, declared
+				// in any file, is converted to and from
+				// a string, unless it has a shim
+				_, shimmed := fs.shims[k.Name]
+				if fs.Identities[k.Name] != gen.String || shimmed {
+					return nil
+				}
+				ident = k.Name
 			}
 		}
+		if in := fs.parseExpr(m.Value); in != nil {
+			return &gen.Map{Key: key, KeyIdent: ident, Value: in}
+		}
 		return nil
 
 	case *ast.Ident:
 		b := &gen.BaseElem{
-			Value: pullIdent(e.(*ast.Ident).Name),
+			Value: gen.BaseOf(e.(*ast.Ident).Name),
 		}
 		if b.Value == gen.IDENT {
 			b.Ident = (e.(*ast.Ident).Name)
+			fs.useIdent(b.Ident, e)
 		}
 		return b
 
@@ -432,8 +1467,8 @@ func (fs *FileSet) parseExpr(e ast.Expr) gen.Elem {
 
 		// special case for []byte
 		if arr.Len == nil {
-			if i, ok := arr.Elt.(*ast.Ident); ok && i.Name == "byte" {
-				return &gen.BaseElem{Value: gen.Bytes}
+			if b := gen.BaseOf(stringify(arr)); b != gen.IDENT {
+				return &gen.BaseElem{Value: b}
 			}
 		}
 
@@ -459,7 +1494,18 @@ func (fs *FileSet) parseExpr(e ast.Expr) gen.Elem {
 					Els:  els,
 				}
 
-			default: // TODO: support *ast.SelectorExpr; requires custom import(s)
+			case *ast.SelectorExpr:
+				// a constant from another package,
+				// which the generated file imports
+				if !fs.importPackage(arr.Len.(*ast.SelectorExpr)) {
+					return nil
+				}
+				return &gen.Array{
+					Size: stringify(arr.Len),
+					Els:  els,
+				}
+
+			default:
 				return nil
 			}
 		}
@@ -472,30 +1518,38 @@ func (fs *FileSet) parseExpr(e ast.Expr) gen.Elem {
 		return nil
 
 	case *ast.StructType:
+		// an anonymous struct; named
+		// structs are identifiers
 		if fields := fs.parseFieldList(e.(*ast.StructType).Fields); len(fields) > 0 {
-			return &gen.Struct{Fields: fields}
+			return &gen.Struct{Fields: fields, Literal: fs.source(e)}
 		}
 		return nil
 
 	case *ast.SelectorExpr:
 		v := e.(*ast.SelectorExpr)
-		// special case for time.Time; others go to Ident
+		// special case for base types like
+		// time.Time; others go to Ident
 		if im, ok := v.X.(*ast.Ident); ok {
-			if v.Sel.Name == "Time" && im.Name == "time" {
-				return &gen.BaseElem{Value: gen.Time}
-			} else {
-				return &gen.BaseElem{
-					Value: gen.IDENT,
-					Ident: im.Name + "." + v.Sel.Name,
-				}
+			name := im.Name + "." + v.Sel.Name
+			fs.usePackage(v)
+			if b := gen.BaseOf(name); b != gen.IDENT {
+				return &gen.BaseElem{Value: b}
+			}
+			if b := gen.DefinedBase(name); b != gen.IDENT {
+				return &gen.BaseElem{Value: b, Convert: true, Ident: name}
+			}
+			fs.useIdent(name, e)
+			return &gen.BaseElem{
+				Value: gen.IDENT,
+				Ident: name,
 			}
 		}
 		return nil
 
 	case *ast.InterfaceType:
 		// support `interface{}`
-		if len(e.(*ast.InterfaceType).Methods.List) == 0 {
-			return &gen.BaseElem{Value: gen.Intf}
+		if b := gen.BaseOf(stringify(e)); b != gen.IDENT {
+			return &gen.BaseElem{Value: b}
 		}
 		return nil
 
@@ -504,58 +1558,150 @@ func (fs *FileSet) parseExpr(e ast.Expr) gen.Elem {
 	}
 }
 
-// convert an identity to a base type
-func pullIdent(name string) gen.Base {
-	switch name {
-	case "string":
-		return gen.String
-	case "[]byte":
-		return gen.Bytes
-	case "byte":
-		return gen.Byte
-	case "int":
-		return gen.Int
-	case "int8":
-		return gen.Int8
-	case "int16":
-		return gen.Int16
-	case "int32":
-		return gen.Int32
-	case "int64":
-		return gen.Int64
-	case "uint":
-		return gen.Uint
-	case "uint8":
-		return gen.Uint8
-	case "uint16":
-		return gen.Uint16
-	case "uint32":
-		return gen.Uint32
-	case "uint64":
-		return gen.Uint64
-	case "bool":
-		return gen.Bool
-	case "float64":
-		return gen.Float64
-	case "float32":
-		return gen.Float32
-	case "complex64":
-		return gen.Complex64
-	case "complex128":
-		return gen.Complex128
-	case "time.Time":
-		return gen.Time
-	case "interface{}":
-		return gen.Intf
-	case "msgp.Extension", "Extension":
-		return gen.Ext
-	default:
-		// unrecognized identity
-		return gen.IDENT
+// intKey returns the base type of integer map
+// keys named 'name', or gen.Invalid if 'name'
+// isn't a built-in integer type
+func intKey(name string) gen.Base {
+	b := gen.BaseOf(name)
+	if info := b.Info(); info != nil && (info.Coerce == "Int" || info.Coerce == "Uint") {
+		return b
+	}
+	return gen.Invalid
+}
+
+// fileImports returns the imports of 'f'
+func fileImports(f *ast.File) []Import {
+	out := make([]Import, 0, len(f.Imports))
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		im := Import{Path: path}
+		if spec.Name != nil {
+			im.Name = spec.Name.Name
+		}
+		out = append(out, im)
+	}
+	return out
+}
+
+// fileImport returns the import of the package
+// 'name' by the file that 'pos' is in, if any
+func (fs *FileSet) fileImport(name string, pos token.Pos) (Import, bool) {
+	for _, im := range fs.imports[fs.position(pos).Filename] {
+		if im.PkgName() == name {
+			return im, true
+		}
+	}
+	return Import{}, false
+}
+
+// imported returns whether or not a directive
+// imports a package named 'name'
+func (fs *FileSet) imported(name string) bool {
+	for _, im := range fs.Imports {
+		if im.PkgName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// importPackage adds the package of 'sel', like
+// 'sha256' in 'sha256.Size', to the imports of the
+// generated file, as it's imported by the file that
+// 'sel' is in, unless it's imported by a directive.
+// It returns false if the package can't be imported.
+func (fs *FileSet) importPackage(sel *ast.SelectorExpr) bool {
+	pkg, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	if fs.imported(pkg.Name) {
+		return true
+	}
+	if im, ok := fs.fileImport(pkg.Name, sel.Pos()); ok {
+		if err := fs.addImport(im); err != nil {
+			fs.fail(Warning{Pos: fs.position(sel.Pos()), Err: err})
+			return false
+		}
+		return true
+	}
+	// packages that aren't named after their
+	// paths (like "gopkg.in/yaml.v2") can't be
+	// told apart without loading them
+	fs.fail(Warning{
+		Pos: fs.position(sel.Pos()),
+		Err: fmt.Errorf("can't tell which import is package %s; declare it with //msgp:import %s \"{Path}\"", pkg.Name, pkg.Name),
+	})
+	return false
+}
+
+// usePackage records the import of the package of
+// the type 'sel', like 'time' in 'time.Time', which
+// the generated code names when it makes pointers,
+// slices or maps of the type, but not otherwise, so
+// it's only imported if it's used (see Packages).
+func (fs *FileSet) usePackage(sel *ast.SelectorExpr) {
+	pkg := sel.X.(*ast.Ident).Name
+	if fs.imported(pkg) {
+		return
+	}
+	for _, im := range fs.Packages {
+		if im.PkgName() == pkg {
+			return
+		}
+	}
+	if im, ok := fs.fileImport(pkg, sel.Pos()); ok {
+		fs.Packages = append(fs.Packages, im)
+	}
+}
+
+// useIdent records the first use of an identifier,
+// for warnings about it that aren't about a field
+func (fs *FileSet) useIdent(name string, e ast.Expr) {
+	if _, ok := fs.identpos[name]; !ok && fs.identpos != nil {
+		fs.identpos[name] = e.Pos()
+	}
+}
+
+// source returns the source text of 'e'
+func (fs *FileSet) source(e ast.Expr) string {
+	var buf bytes.Buffer
+	if fs.fset == nil || printer.Fprint(&buf, fs.fset, e) != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// logger prints messages about a file set
+// as it's processed. Progress is only printed
+// if the logger is verbose.
+type logger struct {
+	w       io.Writer // os.Stderr if nil
+	verbose bool
+	color   bool
+}
+
+func (l *logger) printf(c chalk.Color, s string, v ...interface{}) {
+	w := l.w
+	if w == nil {
+		w = os.Stderr
+	}
+	if l.color {
+		s = c.Color(s)
+	}
+	fmt.Fprintf(w, s, v...)
+}
+
+// progressf prints progress in color 'c'
+func (l *logger) progressf(c chalk.Color, s string, v ...interface{}) {
+	if l.verbose {
+		l.printf(c, s, v...)
 	}
 }
 
-func infof(s string, v ...interface{})  { fmt.Printf(chalk.Green.Color(s), v...) }
-func warnf(s string, v ...interface{})  { fmt.Printf(chalk.Yellow.Color(s), v...) }
-func warnln(s string)                   { fmt.Println(chalk.Yellow.Color(s)) }
-func fatalf(s string, v ...interface{}) { fmt.Printf(chalk.Red.Color(s), v...) }
+func (l *logger) infof(s string, v ...interface{})  { l.progressf(chalk.Green, s, v...) }
+func (l *logger) warnf(s string, v ...interface{})  { l.printf(chalk.Yellow, s, v...) }
+func (l *logger) fatalf(s string, v ...interface{}) { l.printf(chalk.Red, s, v...) }
@@ -0,0 +1,197 @@
+package parse
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checkMethods fails generation for each type
+// that already declares one of opts.Methods in
+// the package that 'name' (a file or directory)
+// belongs to. The output file, opts.Output, and
+// its tests hold methods from an earlier run, so
+// they're skipped; if no output file is given,
+// files ending in "_gen.go" and "_gen_test.go" are
+// skipped instead.
+func (fs *FileSet) checkMethods(name string, opts Options) {
+	if len(opts.Methods) == 0 {
+		return
+	}
+	pkg := fs.parsePackage(name, opts)
+	if pkg == nil {
+		return
+	}
+
+	generates := make(map[string]bool, len(opts.Methods))
+	for _, m := range opts.Methods {
+		generates[m] = true
+	}
+	for _, f := range sortedFiles(pkg) {
+		for _, d := range f.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) == 0 || !generates[fn.Name.Name] {
+				continue
+			}
+			recv := receiverName(fn.Recv.List[0].Type)
+			if _, ok := fs.processed[recv]; !ok {
+				continue
+			}
+			w := Warning{
+				Pos:  fs.position(fn.Pos()),
+				Type: recv,
+				Err:  fmt.Errorf("method %s is already declared here and would collide with the generated one", fn.Name.Name),
+			}
+			fs.log.fatalf("error: %s\n", w)
+			fs.errs = append(fs.errs, w)
+		}
+	}
+}
+
+// parsePackage parses the package that 'name'
+// (a file or directory) belongs to, leaving out
+// the files that checkMethods skips. It returns
+// nil if the package can't be parsed.
+func (fs *FileSet) parsePackage(name string, opts Options) *ast.Package {
+	dir := name
+	if fi, err := os.Stat(name); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(name)
+	}
+	generated := func(file string) bool {
+		if opts.Output == "" {
+			return strings.HasSuffix(file, "_gen.go") || strings.HasSuffix(file, "_gen_test.go")
+		}
+		out := filepath.Base(opts.Output)
+		return file == out || file == strings.TrimSuffix(out, ".go")+"_test.go"
+	}
+	pkgs, err := parser.ParseDir(fs.fset, dir, func(fi os.FileInfo) bool {
+		return !generated(fi.Name())
+	}, 0)
+	if err != nil {
+		// the package will fail to
+		// compile for other reasons
+		return nil
+	}
+	return pkgs[fs.Package]
+}
+
+// checkMarshalAs fails generation for each
+// //msgp:marshalas directive whose types don't
+// both have generated methods, or whose type
+// doesn't declare ToWire and FromWire methods
+// that convert to and from the wire type.
+func (fs *FileSet) checkMarshalAs(name string, opts Options) {
+	if len(fs.marshalas) == 0 {
+		return
+	}
+	names := make([]string, 0, len(fs.marshalas))
+	for tp := range fs.marshalas {
+		names = append(names, tp)
+	}
+	sort.Strings(names)
+
+	// the methods each type declares
+	declared := make(map[string]map[string]*ast.FuncDecl)
+	if pkg := fs.parsePackage(name, opts); pkg != nil {
+		for _, f := range sortedFiles(pkg) {
+			for _, d := range f.Decls {
+				fn, ok := d.(*ast.FuncDecl)
+				if !ok || fn.Recv == nil || len(fn.Recv.List) == 0 {
+					continue
+				}
+				recv := receiverName(fn.Recv.List[0].Type)
+				if declared[recv] == nil {
+					declared[recv] = make(map[string]*ast.FuncDecl)
+				}
+				declared[recv][fn.Name.Name] = fn
+			}
+		}
+	}
+
+	for _, tp := range names {
+		wire := fs.marshalas[tp]
+		fail := func(format string, v ...interface{}) {
+			w := Warning{
+				Pos:  fs.position(fs.specPos(tp)),
+				Type: tp,
+				Err:  fmt.Errorf(format, v...),
+			}
+			fs.log.fatalf("error: %s\n", w)
+			fs.errs = append(fs.errs, w)
+		}
+		if _, ok := fs.processed[tp]; !ok {
+			fail("has a marshalas directive, but isn't a struct that methods are generated for")
+			continue
+		}
+		if _, ok := fs.processed[wire]; !ok {
+			fail("is marshaled as %s, which isn't a struct that methods are generated for", wire)
+			continue
+		}
+		if next, ok := fs.marshalas[wire]; ok {
+			fail("is marshaled as %s, which is marshaled as %s itself", wire, next)
+			continue
+		}
+		methods := declared[tp]
+		if !hasSignature(methods["ToWire"], nil, []string{"*" + wire}) {
+			fail("is marshaled as %s, but has no method ToWire() *%s", wire, wire)
+		}
+		if !hasSignature(methods["FromWire"], []string{"*" + wire}, []string{"error"}) {
+			fail("is marshaled as %s, but has no method FromWire(*%s) error", wire, wire)
+		}
+	}
+}
+
+// hasSignature returns whether or not 'fn' takes
+// parameters of the types 'params' and returns
+// results of the types 'results'
+func hasSignature(fn *ast.FuncDecl, params []string, results []string) bool {
+	if fn == nil {
+		return false
+	}
+	return sameTypes(fn.Type.Params, params) && sameTypes(fn.Type.Results, results)
+}
+
+// sameTypes returns whether or not
+// 'fl' is a list of the types 'want'
+func sameTypes(fl *ast.FieldList, want []string) bool {
+	var got []string
+	if fl != nil {
+		for _, f := range fl.List {
+			n := len(f.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				got = append(got, stringify(f.Type))
+			}
+		}
+	}
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// receiverName returns the name of
+// the type of a method receiver
+func receiverName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.ParenExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,92 @@
+package parse
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// PackageFiles finds the source of the package with the
+// import path 'path', as the go command would from the
+// directory 'srcDir', and returns its directory, its name,
+// and the files of it that are built, without its tests.
+// It's an error if the package has cgo files, which can't
+// be parsed for the types they declare, or if a type in it
+// is declared again in a file that build constraints leave
+// out, since the generated methods would only fit one of
+// the two.
+func PackageFiles(path string, srcDir string) (dir string, name string, files []string, err error) {
+	pkg, err := build.Import(path, srcDir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok {
+			return "", "", nil, fmt.Errorf("package %s has no Go files (in %s)", path, pkg.Dir)
+		}
+		return "", "", nil, fmt.Errorf("can't find package %s: %s", path, err)
+	}
+	if len(pkg.CgoFiles) > 0 {
+		return "", "", nil, fmt.Errorf("package %s uses cgo (in %s), so its types can't be told; list its other files with -file instead", path, strings.Join(pkg.CgoFiles, ", "))
+	}
+
+	declared, err := typesDeclared(pkg.Dir, pkg.GoFiles, pkg.Name)
+	if err != nil {
+		return "", "", nil, err
+	}
+	var ignored []string
+	for _, f := range pkg.IgnoredGoFiles {
+		if !strings.HasSuffix(f, "_test.go") {
+			ignored = append(ignored, f)
+		}
+	}
+	variants, err := typesDeclared(pkg.Dir, ignored, pkg.Name)
+	if err != nil {
+		return "", "", nil, err
+	}
+	for _, out := range ignored {
+		for _, typ := range variants[out] {
+			for _, in := range pkg.GoFiles {
+				for _, t := range declared[in] {
+					if t == typ {
+						return "", "", nil, fmt.Errorf("package %s declares type %s in both %s and %s, which build constraints choose between, so its methods can't be generated for both; list the files of each build with -file, and give each output the same constraints", path, typ, in, out)
+					}
+				}
+			}
+		}
+	}
+
+	files = make([]string, len(pkg.GoFiles))
+	for i, f := range pkg.GoFiles {
+		files[i] = filepath.Join(pkg.Dir, f)
+	}
+	return pkg.Dir, pkg.Name, files, nil
+}
+
+// typesDeclared returns the names of the types that
+// each of the files 'names' in 'dir' declares, if the
+// file is in package 'pkg'
+func typesDeclared(dir string, names []string, pkg string) (map[string][]string, error) {
+	fset := token.NewFileSet()
+	declared := make(map[string][]string, len(names))
+	for _, name := range names {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		if f.Name.Name != pkg {
+			continue
+		}
+		for _, d := range f.Decls {
+			g, ok := d.(*ast.GenDecl)
+			if !ok || g.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range g.Specs {
+				declared[name] = append(declared[name], s.(*ast.TypeSpec).Name.Name)
+			}
+		}
+	}
+	return declared, nil
+}
@@ -17,10 +17,18 @@ func (fs *FileSet) findUnresolved(g gen.Elem) []string {
 	case gen.SliceType:
 		return fs.findUnresolved(g.(*gen.Slice).Els)
 
+	case gen.ArrayType:
+		return fs.findUnresolved(g.(*gen.Array).Els)
+
 	case gen.BaseType:
 		b := g.(*gen.BaseElem)
 		if b.Value == gen.IDENT { // type is unrecognized
 			id := b.Ident
+			// embedded types from other packages
+			// are known to have methods (see getField)
+			if _, ok := fs.embeds[id]; ok {
+				return nil
+			}
 			if tp, ok := fs.Identities[id]; ok {
 
 				// skip types that the code generator has seen
@@ -31,13 +39,11 @@ func (fs *FileSet) findUnresolved(g gen.Elem) []string {
 
 				// if we have found another identity
 				if tp != gen.IDENT {
-					// Lower type one level
-					i := b.Ident
-					*b = gen.BaseElem{
-						Value:   tp,   // "true" type
-						Ident:   i,    // identifier name
-						Convert: true, // requires explicit conversion
-					}
+					// Lower type one level, keeping
+					// the identifier name and any
+					// field options
+					b.Value = tp     // "true" type
+					b.Convert = true // requires explicit conversion
 					return nil
 				}
 			}
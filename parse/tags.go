@@ -0,0 +1,157 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tagOptions is the grammar of the options that
+// may follow the name in a `msg:"name,opt,..."` tag.
+// The value is whether or not the option takes
+// a value, as in `msg:"name,transform=pii"`.
+var tagOptions = map[string]bool{
+	"extension":  false,
+	"allownil":   false,
+	"bitset":     false,
+	"coerce":     false,
+	"decodeonly": false,
+	"encodeonly": false,
+	"omitempty":  false,
+	"transform":  true,
+	"epoch":      true,
+	"maxentries": true,
+	"overflow":   true,
+	"as":         true,
+	"using":      true,
+}
+
+// Tag is a parsed `msg:"..."` struct tag.
+type Tag struct {
+	Name    string            // wire name ("" if unset)
+	Options map[string]string // options and their values ("" for flags)
+}
+
+// Has returns whether or not the tag has the option 'opt'
+func (t *Tag) Has(opt string) bool {
+	_, ok := t.Options[opt]
+	return ok
+}
+
+// TagError describes an unknown or
+// malformed option in a struct tag.
+type TagError struct {
+	Option string // the offending option
+	Reason string
+}
+
+// Error implements the error interface
+func (t TagError) Error() string {
+	return fmt.Sprintf("tag option %q: %s", t.Option, t.Reason)
+}
+
+// ParseTag parses the body of a `msg:"..."` tag.
+// Option values may be quoted with single or double
+// quotes, in which case they may contain commas, and
+// backslash escapes the next character. Unknown
+// options and malformed values are returned as
+// TagErrors and are left out of the returned Tag.
+func ParseTag(body string) (Tag, []error) {
+	var errs []error
+	parts, err := splitTag(body)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	t := Tag{Options: make(map[string]string)}
+	if len(parts) == 0 {
+		return t, errs
+	}
+	t.Name = parts[0].key
+	for _, p := range parts[1:] {
+		hasValue, ok := tagOptions[p.key]
+		switch {
+		case p.key == "":
+			errs = append(errs, TagError{Option: p.raw, Reason: "empty option"})
+		case !ok:
+			errs = append(errs, TagError{Option: p.raw, Reason: "unknown option"})
+		case hasValue && !p.set:
+			errs = append(errs, TagError{Option: p.raw, Reason: "missing value"})
+		case hasValue && p.value == "":
+			errs = append(errs, TagError{Option: p.raw, Reason: "empty value"})
+		case !hasValue && p.set:
+			errs = append(errs, TagError{Option: p.raw, Reason: "option doesn't take a value"})
+		case t.Has(p.key):
+			errs = append(errs, TagError{Option: p.raw, Reason: "duplicate option"})
+		default:
+			t.Options[p.key] = p.value
+		}
+	}
+	return t, errs
+}
+
+// tagPart is one comma-separated
+// element of a tag
+type tagPart struct {
+	raw   string // as written
+	key   string // before '='
+	value string // after '=', unquoted
+	set   bool   // '=' was present
+}
+
+// splitTag splits a tag body on the commas
+// that aren't inside quoted values. A trailing
+// unterminated quote is an error, but the parts
+// before it are still returned.
+func splitTag(body string) ([]tagPart, error) {
+	var (
+		parts []tagPart
+		cur   tagPart
+		val   []byte
+		start int
+		quote byte // current quote character, if any
+	)
+	finish := func(end int) {
+		cur.raw = body[start:end]
+		if cur.set {
+			cur.value = string(val)
+		} else {
+			cur.key = strings.TrimSpace(cur.raw)
+		}
+		parts = append(parts, cur)
+		cur, val, start = tagPart{}, nil, end+1
+	}
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case quote != 0:
+			switch c {
+			case '\\':
+				if i+1 < len(body) {
+					i++
+					val = append(val, body[i])
+				}
+			case quote:
+				quote = 0
+				// a closing quote must end the part
+				if i+1 < len(body) && body[i+1] != ',' {
+					return parts, TagError{Option: body[start:], Reason: "unexpected characters after quoted value"}
+				}
+			default:
+				val = append(val, c)
+			}
+		case c == ',':
+			finish(i)
+		case !cur.set && c == '=' && len(parts) > 0:
+			cur.key = strings.TrimSpace(body[start:i])
+			cur.set = true
+		case cur.set && (c == '"' || c == '\'') && len(val) == 0:
+			quote = c
+		case cur.set:
+			val = append(val, c)
+		}
+	}
+	if quote != 0 {
+		return parts, TagError{Option: body[start:], Reason: "unterminated quoted value"}
+	}
+	finish(len(body))
+	return parts, nil
+}
@@ -0,0 +1,99 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		body string
+		name string
+		opts map[string]string
+		errs []string // offending options
+	}{
+		// names
+		{"", "", nil, nil},
+		{"name", "name", nil, nil},
+		{"-", "-", nil, nil},
+		{",allownil", "", map[string]string{"allownil": ""}, nil},
+		{"a=b", "a=b", nil, nil}, // '=' in a name is literal
+
+		// flags
+		{"name,extension", "name", map[string]string{"extension": ""}, nil},
+		{"name,allownil,extension", "name", map[string]string{"allownil": "", "extension": ""}, nil},
+		{"name, allownil ", "name", map[string]string{"allownil": ""}, nil},
+
+		// values
+		{"name,transform=pii", "name", map[string]string{"transform": "pii"}, nil},
+		{`name,transform="pii"`, "name", map[string]string{"transform": "pii"}, nil},
+		{`name,transform='pii'`, "name", map[string]string{"transform": "pii"}, nil},
+		{`name,transform="a,b",allownil`, "name", map[string]string{"transform": "a,b", "allownil": ""}, nil},
+		{`name,transform='a,"b"'`, "name", map[string]string{"transform": `a,"b"`}, nil},
+		{`name,transform="a\"b,c"`, "name", map[string]string{"transform": `a"b,c`}, nil},
+		{`name,transform="a\\"`, "name", map[string]string{"transform": `a\`}, nil},
+		{`name,transform=a"b`, "name", map[string]string{"transform": `a"b`}, nil},
+		{"name,maxentries=64,overflow=drop", "name", map[string]string{"maxentries": "64", "overflow": "drop"}, nil},
+
+		// unknown options
+		{"name,omitempy", "name", nil, []string{"omitempy"}},
+		{"name,omitempy,allownil", "name", map[string]string{"allownil": ""}, []string{"omitempy"}},
+		{"name,Extension", "name", nil, []string{"Extension"}},
+
+		// malformed options
+		{"name,", "name", nil, []string{""}},
+		{"name,,allownil", "name", map[string]string{"allownil": ""}, []string{""}},
+		{"name,transform", "name", nil, []string{"transform"}},
+		{"name,transform=", "name", nil, []string{"transform="}},
+		{`name,transform=""`, "name", nil, []string{`transform=""`}},
+		{"name,allownil=true", "name", nil, []string{"allownil=true"}},
+		{"name,allownil,allownil", "name", map[string]string{"allownil": ""}, []string{"allownil"}},
+		{"name,transform=a,transform=b", "name", map[string]string{"transform": "a"}, []string{"transform=b"}},
+		{`name,transform="pii`, "name", nil, []string{`transform="pii`}},
+		{`name,transform="a,b`, "name", nil, []string{`transform="a,b`}},
+		{`name,transform="pii"x,allownil`, "name", nil, []string{`transform="pii"x,allownil`}},
+		{`name,allownil,transform="pii`, "name", map[string]string{"allownil": ""}, []string{`transform="pii`}},
+	}
+
+	for _, tt := range tests {
+		tag, errs := ParseTag(tt.body)
+		if tag.Name != tt.name {
+			t.Errorf("%q: name is %q; want %q", tt.body, tag.Name, tt.name)
+		}
+		want := tt.opts
+		if want == nil {
+			want = map[string]string{}
+		}
+		if !reflect.DeepEqual(tag.Options, want) {
+			t.Errorf("%q: options are %v; want %v", tt.body, tag.Options, want)
+		}
+		if len(errs) != len(tt.errs) {
+			t.Errorf("%q: got errors %v; want errors for %q", tt.body, errs, tt.errs)
+			continue
+		}
+		for i, err := range errs {
+			te, ok := err.(TagError)
+			if !ok {
+				t.Errorf("%q: expected TagError; got %T", tt.body, err)
+				continue
+			}
+			if te.Option != tt.errs[i] {
+				t.Errorf("%q: error is for option %q; want %q", tt.body, te.Option, tt.errs[i])
+			}
+		}
+	}
+}
+
+func TestTagHas(t *testing.T) {
+	tag, _ := ParseTag("name,allownil")
+	if !tag.Has("allownil") {
+		t.Error("expected tag to have allownil")
+	}
+	if tag.Has("extension") {
+		t.Error("expected tag not to have extension")
+	}
+	var zero Tag
+	if zero.Has("allownil") {
+		t.Error("expected zero tag to have no options")
+	}
+}
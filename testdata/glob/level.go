@@ -0,0 +1,10 @@
+package glob
+
+// Level isn't a message, but
+// messages have fields of its type
+type Level uint8
+
+const (
+	Low Level = iota
+	High
+)
@@ -0,0 +1,8 @@
+package glob
+
+// Alpha is a message; its Level
+// is declared in another file
+type Alpha struct {
+	Name  string `msg:"name"`
+	Level Level  `msg:"level"`
+}
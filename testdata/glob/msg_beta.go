@@ -0,0 +1,8 @@
+package glob
+
+// Beta is a message that
+// refers to another message
+type Beta struct {
+	ID     uint64  `msg:"id"`
+	Alphas []Alpha `msg:"alphas"`
+}
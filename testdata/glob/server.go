@@ -0,0 +1,9 @@
+package glob
+
+// Server isn't a message, and
+// can't be one: its fields
+// can't be serialized
+type Server struct {
+	Conns chan int
+	Done  func()
+}
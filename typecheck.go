@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"github.com/philhofer/msgp/parse"
+	"github.com/ttacon/chalk"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+// typeCheck type-checks the generated file 'src', which
+// is about to be written to 'name', together with the rest
+// of package 'gopkg', leaving out the file it replaces. Each
+// problem in the generated code fails generation, and is
+// reported at the type (and field, if it can tell) of the
+// source that it was generated for. If the package can't
+// be checked at all, as when its imports can't be found,
+// the check is skipped with a warning.
+func typeCheck(fs *parse.FileSet, name string, gopkg string, src []byte) error {
+	skip := func(format string, v ...interface{}) error {
+		printf(chalk.Yellow, "warning: not type-checking %s: %s (-nocheck skips the check)\n", name, fmt.Sprintf(format, v...))
+		return nil
+	}
+
+	fset := token.NewFileSet()
+	out, err := parser.ParseFile(fset, name, src, 0)
+	if err != nil {
+		return fmt.Errorf("the generated code doesn't parse: %s", err)
+	}
+	files := []*ast.File{out}
+
+	dir := filepath.Dir(name)
+	pkg, err := build.ImportDir(dir, 0)
+	if _, ok := err.(*build.NoGoError); ok {
+		pkg, err = &build.Package{Name: gopkg}, nil
+	}
+	if err != nil {
+		return skip("%s", err)
+	}
+	if pkg.Name != gopkg {
+		return skip("the package in %s is %s, not %s", dir, pkg.Name, gopkg)
+	}
+	for _, list := range [][]string{pkg.GoFiles, pkg.CgoFiles} {
+		for _, f := range list {
+			if f == filepath.Base(name) {
+				continue
+			}
+			af, err := parser.ParseFile(fset, filepath.Join(dir, f), nil, 0)
+			if err != nil {
+				return skip("%s", err)
+			}
+			files = append(files, af)
+		}
+	}
+
+	var errs []types.Error
+	conf := types.Config{
+		Importer:    importer.ForCompiler(fset, "source", nil),
+		FakeImportC: true,
+		Error: func(err error) {
+			if te, ok := err.(types.Error); ok {
+				errs = append(errs, te)
+			}
+		},
+	}
+	conf.Check(gopkg, fset, files, nil)
+
+	// problems in the other files are
+	// the package's own, but if imports
+	// are missing, nothing can be told
+	var failed []error
+	generated := fset.File(out.Pos())
+	for _, e := range errs {
+		for _, f := range files {
+			for _, im := range f.Imports {
+				if e.Pos >= im.Pos() && e.Pos <= im.End() {
+					return skip("%s", e)
+				}
+			}
+		}
+		if fset.File(e.Pos) != generated {
+			continue
+		}
+		typ, field := generatedFor(out, e.Pos)
+		what := "the generated code"
+		if field != "" {
+			what += " for " + typ + "." + field
+		}
+		w := parse.Warning{
+			Pos:   fs.Position(typ, field),
+			Type:  typ,
+			Field: field,
+			Err:   fmt.Errorf("%s doesn't compile: %s (at %s)", what, e.Msg, fset.Position(e.Pos)),
+		}
+		// an embedded type from another package is
+		// written by its own methods, which it lacks
+		if emb := fs.EmbeddedType(typ, field); emb != "" && strings.Contains(e.Msg, "has no field or method") {
+			w.Err = fmt.Errorf("%s; the embedded %s is serialized with its own methods, so generate them in its package, or declare its fields in %s instead", w.Err, emb, typ)
+		}
+		errorf("error: %s\n", w)
+		failed = append(failed, w)
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	default:
+		return fmt.Errorf("%s (and %d more errors)", failed[0], len(failed)-1)
+	}
+}
+
+// generatedFor returns the type that the code at 'pos' in
+// the generated file 'f' was generated for, which is the
+// receiver of the method it's in, and the field of that
+// type that the code reads or writes, if there is one
+func generatedFor(f *ast.File, pos token.Pos) (typ string, field string) {
+	for _, d := range f.Decls {
+		fn, ok := d.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) == 0 || pos < fn.Pos() || pos > fn.End() {
+			continue
+		}
+		recv := fn.Recv.List[0]
+		typ = receiverType(recv.Type)
+		if len(recv.Names) == 0 {
+			return typ, ""
+		}
+		z := recv.Names[0].Name
+
+		// the innermost z.Field around 'pos',
+		// or ranged over by a loop around it
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if n == nil || pos < n.Pos() || pos > n.End() {
+				return false
+			}
+			var name string
+			switch n := n.(type) {
+			case *ast.RangeStmt:
+				name = fieldOf(n.X, z)
+			case ast.Expr:
+				name = fieldOf(n, z)
+			}
+			if name != "" {
+				field = name
+			}
+			return true
+		})
+		return typ, field
+	}
+	return "", ""
+}
+
+// fieldOf returns the name of the field of
+// receiver 'z' that 'e' is, or is part of
+func fieldOf(e ast.Expr, z string) string {
+	for {
+		switch x := e.(type) {
+		case *ast.SelectorExpr:
+			if id, ok := x.X.(*ast.Ident); ok && id.Name == z {
+				return x.Sel.Name
+			}
+			e = x.X
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.StarExpr:
+			e = x.X
+		case *ast.ParenExpr:
+			e = x.X
+		case *ast.UnaryExpr:
+			e = x.X
+		default:
+			return ""
+		}
+	}
+}
+
+// receiverType returns the name of
+// the type of a method receiver
+func receiverType(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.StarExpr:
+		return receiverType(e.X)
+	case *ast.ParenExpr:
+		return receiverType(e.X)
+	case *ast.Ident:
+		return e.Name
+	default:
+		return ""
+	}
+}